@@ -0,0 +1,111 @@
+package ai
+
+import (
+	"sync"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// ActionFeaturesCache caches the ActionFeatures of (board, action) pairs, which
+// recur during search when different sequences of moves transpose to the same
+// board. It is safe for concurrent use, and holds at most MaxSize entries.
+//
+// Boards are keyed by Board.Hash and not by Board.CanonicalHash: the features
+// are relative to the action's positions, which are not canonical.
+type ActionFeaturesCache struct {
+	MaxSize int
+
+	mu           sync.Mutex
+	entries      map[actionFeaturesKey]ActionFeatures
+	hits, misses int64
+}
+
+type actionFeaturesKey struct {
+	boardHash uint64
+	action    Action
+	version   int
+}
+
+// NewActionFeaturesCache creates a cache that holds at most maxSize ActionFeatures.
+func NewActionFeaturesCache(maxSize int) *ActionFeaturesCache {
+	return &ActionFeaturesCache{
+		MaxSize: maxSize,
+		entries: make(map[actionFeaturesKey]ActionFeatures),
+	}
+}
+
+// BoardActionsFeatures returns the features of all the actions of the board, in
+// the order of b.Derived.Actions. It works also on a nil cache, in which case the
+// features are simply computed.
+//
+// The returned features are shared with the cache, and must not be modified.
+func (c *ActionFeaturesCache) BoardActionsFeatures(b *Board, version int) []ActionFeatures {
+	actions := b.Derived.Actions
+	afs := make([]ActionFeatures, len(actions))
+	if c == nil {
+		for ii, action := range actions {
+			afs[ii] = NewActionFeatures(b, action, version)
+		}
+		return afs
+	}
+
+	key := actionFeaturesKey{boardHash: b.Hash(), version: version}
+	var missing []int
+	c.mu.Lock()
+	for ii, action := range actions {
+		key.action = action
+		if af, ok := c.entries[key]; ok {
+			afs[ii] = af
+		} else {
+			missing = append(missing, ii)
+		}
+	}
+	c.hits += int64(len(actions) - len(missing))
+	c.misses += int64(len(missing))
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return afs
+	}
+
+	// Compute features without holding the lock.
+	for _, ii := range missing {
+		afs[ii] = NewActionFeatures(b, actions[ii], version)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ii := range missing {
+		if len(c.entries) >= c.MaxSize {
+			c.evict()
+		}
+		key.action = actions[ii]
+		c.entries[key] = afs[ii]
+	}
+	return afs
+}
+
+// evict removes a quarter of the entries, chosen arbitrarily: it's cheaper than
+// keeping track of the least recently used ones. It must be called with the lock held.
+func (c *ActionFeaturesCache) evict() {
+	toRemove := len(c.entries)/4 + 1
+	for key := range c.entries {
+		if toRemove == 0 {
+			break
+		}
+		delete(c.entries, key)
+		toRemove--
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *ActionFeaturesCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *ActionFeaturesCache) Stats() (hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
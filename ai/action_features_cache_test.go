@@ -0,0 +1,64 @@
+package ai_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// searchTree returns all boards visited by a full search of the given depth,
+// including transpositions, in the order a depth-first search would visit them.
+func searchTree(b *Board, depth int) (boards []*Board) {
+	boards = append(boards, b)
+	if depth == 0 || b.IsFinished() {
+		return
+	}
+	for _, action := range b.Derived.Actions {
+		boards = append(boards, searchTree(b.Act(action), depth-1)...)
+	}
+	return
+}
+
+func TestActionFeaturesCache(t *testing.T) {
+	boards := searchTree(symmetryTestBoards()[2], 2)
+	cache := ai.NewActionFeaturesCache(1000)
+	for _, b := range boards {
+		got := cache.BoardActionsFeatures(b, ai.AllFeaturesDim)
+		for ii, action := range b.Derived.Actions {
+			if want := ai.NewActionFeatures(b, action, ai.AllFeaturesDim); !reflect.DeepEqual(got[ii], want) {
+				t.Fatalf("Cached features for action %s differ from computed ones", action)
+			}
+		}
+		if cache.Len() > cache.MaxSize {
+			t.Fatalf("Cache grew to %d entries, beyond its max size %d", cache.Len(), cache.MaxSize)
+		}
+	}
+
+	// Second pass on a board should only hit the cache.
+	b := boards[len(boards)-1]
+	hitsBefore, missesBefore := cache.Stats()
+	cache.BoardActionsFeatures(b, ai.AllFeaturesDim)
+	hits, misses := cache.Stats()
+	if misses != missesBefore || hits != hitsBefore+int64(b.NumActions()) {
+		t.Errorf("Expected %d cache hits and no misses, got %d hits and %d misses",
+			b.NumActions(), hits-hitsBefore, misses-missesBefore)
+	}
+}
+
+func benchmarkActionFeatures(bench *testing.B, cache *ai.ActionFeaturesCache) {
+	boards := searchTree(symmetryTestBoards()[2], 2)
+	bench.ResetTimer()
+	for ii := 0; ii < bench.N; ii++ {
+		for _, b := range boards {
+			cache.BoardActionsFeatures(b, ai.AllFeaturesDim)
+		}
+	}
+}
+
+func BenchmarkActionFeaturesNoCache(bench *testing.B) { benchmarkActionFeatures(bench, nil) }
+
+func BenchmarkActionFeaturesCache(bench *testing.B) {
+	benchmarkActionFeatures(bench, ai.NewActionFeaturesCache(1000000))
+}
@@ -1,6 +1,9 @@
 package ai
 
 import (
+	"math"
+	"math/rand"
+
 	. "github.com/janpfeifer/hiveGo/state"
 )
 
@@ -9,6 +12,9 @@ import (
 //     a score from +10 and -10.
 //   policy: Probability for each of the action. This is optional, and
 //     some models may not return it.
+//
+// Score (and BatchScore for a BatchScorer) must be safe to call concurrently
+// from many goroutines, as the parallelized searchers do.
 type Scorer interface {
 	Score(board *Board) (score float32, actionProbs []float32)
 
@@ -25,6 +31,10 @@ type BatchScorer interface {
 	BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32)
 }
 
+// LearnerScorer is a BatchScorer that can be trained. Whether Learn can be
+// called concurrently with scoring depends on the implementation: the
+// TensorFlow scorer serializes them, while LinearScorer updates its weights in
+// place, so it must not be used for scoring while it learns.
 type LearnerScorer interface {
 	BatchScorer
 
@@ -36,6 +46,18 @@ type LearnerScorer interface {
 	String() string
 }
 
+// ExamplesLossesLearner is a LearnerScorer that can weight the loss of each example
+// and report the individual losses, as used by ReplayBuffer.
+type ExamplesLossesLearner interface {
+	LearnerScorer
+
+	// LearnWithExamplesLosses is like Learn, but the loss of each board is multiplied by
+	// the corresponding weight (if weights is not nil). It also returns the loss of each
+	// board, as measured in the last step.
+	LearnWithExamplesLosses(boards []*Board, boardLabels []float32, actionsLabels [][]float32,
+		weights []float32, learningRate float32, steps int) (loss float32, examplesLosses []float32)
+}
+
 // Trivial implementation of a BatchScorer, wity no efficiency gains.
 type BatchScorerWrapper struct {
 	Scorer
@@ -82,3 +104,197 @@ func OneHotEncoding(total, selected int) (vec []float32) {
 	}
 	return
 }
+
+// VisitCountPolicy converts the number of visits of each action during a search (e.g. MCTS)
+// to a probability distribution proportional to visits^(1/temperature), to be used as
+// action labels. With temperature=1 it is proportional to the visits, and as the
+// temperature goes to 0 it approaches the one-hot encoding of the most visited action
+// (ties are split evenly). If there were no visits, the distribution is uniform.
+func VisitCountPolicy(visits []int, temperature float64) (probs []float32) {
+	probs = make([]float32, len(visits))
+	maxVisits := 0
+	for _, count := range visits {
+		if count > maxVisits {
+			maxVisits = count
+		}
+	}
+	if maxVisits == 0 {
+		for ii := range probs {
+			probs[ii] = 1.0 / float32(len(probs))
+		}
+		return
+	}
+
+	weights := make([]float64, len(visits))
+	total := 0.0
+	for ii, count := range visits {
+		if temperature <= 0 {
+			if count == maxVisits {
+				weights[ii] = 1
+			}
+		} else {
+			// Normalized by maxVisits to avoid overflows for small temperatures.
+			weights[ii] = math.Pow(float64(count)/float64(maxVisits), 1.0/temperature)
+		}
+		total += weights[ii]
+	}
+	for ii, weight := range weights {
+		probs[ii] = float32(weight / total)
+	}
+	return
+}
+
+// TemperedPolicy re-normalizes the actions probabilities returned by a policy to be
+// proportional to probs^(1/temperature), the same as dividing the logits of the
+// softmax by the temperature. Temperatures above 1 flatten the distribution and
+// below 1 sharpen it, and as it goes to 0 it approaches the one-hot encoding of
+// the most probable action (ties are split evenly). With temperature=1 probs is
+// returned unchanged.
+func TemperedPolicy(probs []float32, temperature float64) []float32 {
+	if temperature == 1 || len(probs) == 0 {
+		return probs
+	}
+	maxProb := float32(0)
+	for _, prob := range probs {
+		if prob > maxProb {
+			maxProb = prob
+		}
+	}
+	if maxProb == 0 {
+		return probs
+	}
+	weights := make([]float64, len(probs))
+	total := 0.0
+	for ii, prob := range probs {
+		if temperature <= 0 {
+			if prob == maxProb {
+				weights[ii] = 1
+			}
+		} else {
+			// Normalized by maxProb to avoid overflows for small temperatures.
+			weights[ii] = math.Pow(float64(prob/maxProb), 1.0/temperature)
+		}
+		total += weights[ii]
+	}
+	tempered := make([]float32, len(probs))
+	for ii, weight := range weights {
+		tempered[ii] = float32(weight / total)
+	}
+	return tempered
+}
+
+// MAX_LABEL_SMOOTHING bounds (exclusive) the epsilon of SmoothLabels.
+const MAX_LABEL_SMOOTHING = 0.5
+
+// SmoothLabels moves epsilon of the probability mass of the actions labels to the
+// other actions: each label p becomes (1-epsilon)*p + epsilon*(1-p)/(n-1), for n
+// actions. For one-hot labels (see OneHotEncoding) the action taken gets
+// 1-epsilon, and epsilon is spread uniformly over the other actions. It's used
+// to keep the policy head from becoming overconfident. With epsilon <= 0 or a
+// single action, labels is returned unchanged.
+//
+// The most probable action keeps the largest mass only if epsilon < (n-1)/n, so
+// for any number of actions epsilon must be below MAX_LABEL_SMOOTHING, the bound
+// for 2 actions.
+func SmoothLabels(labels []float32, epsilon float32) []float32 {
+	if epsilon <= 0 || len(labels) < 2 {
+		return labels
+	}
+	others := epsilon / float32(len(labels)-1)
+	smoothed := make([]float32, len(labels))
+	for ii, label := range labels {
+		smoothed[ii] = (1-epsilon)*label + others*(1-label)
+	}
+	return smoothed
+}
+
+// BestMove returns the action the scorer prefers with a one-ply look-ahead: the
+// one whose resulting board has the best score for b.NextPlayer (the opposite of
+// the score for the opponent), along with that score. Actions that finish the
+// game are scored with EndGameScore. If b has no actions, it returns the
+// SKIP_ACTION.
+func BestMove(b *Board, scorer BatchScorer) (action Action, score float32) {
+	actions := b.Derived.Actions
+	if len(actions) == 0 {
+		actions = []Action{SKIP_ACTION}
+	}
+	scores := make([]float32, len(actions))
+	var toScore []*Board
+	var toScoreIndices []int
+	for ii, action := range actions {
+		newBoard := b.Act(action)
+		if isEnd, endScore := EndGameScore(newBoard); isEnd {
+			scores[ii] = -endScore
+		} else {
+			toScore = append(toScore, newBoard)
+			toScoreIndices = append(toScoreIndices, ii)
+		}
+	}
+	if len(toScore) > 0 {
+		scored, _ := scorer.BatchScore(toScore)
+		for ii, idx := range toScoreIndices {
+			scores[idx] = -scored[ii]
+		}
+	}
+	best := 0
+	for ii := range scores {
+		if scores[ii] > scores[best] {
+			best = ii
+		}
+	}
+	return actions[best], scores[best]
+}
+
+// PieceContributions attributes part of the score of the board to each piece on
+// it: the contribution of a piece is how much the score (for b.NextPlayer) drops
+// when the piece is hypothetically removed from the board, and returned to its
+// player's available pieces. Only the piece at the top of each stack is
+// considered, and the resulting board may be disconnected -- it's only used to
+// probe the scorer. It returns the score of the board along with the
+// contributions by position.
+//
+// It scores one board per piece on the board, so it should only be computed on
+// demand.
+func PieceContributions(b *Board, scorer Scorer) (score float32, contributions Heatmap) {
+	boardScore := func(b *Board) float32 {
+		if isEnd, endScore := EndGameScore(b); isEnd {
+			return endScore
+		}
+		score, _ := scorer.Score(b)
+		return score
+	}
+	score = boardScore(b)
+	contributions = make(Heatmap)
+	for _, pos := range b.OccupiedPositions() {
+		removed := b.Copy()
+		player, piece := removed.PopPiece(pos)
+		removed.SetAvailable(player, piece, removed.Available(player, piece)+1)
+		removed.BuildDerived()
+		contributions[pos] = score - boardScore(removed)
+	}
+	return
+}
+
+// RandomBoards plays random legal moves from the initial board, and returns num
+// boards at random points of the games (up to maxMoves moves, so MoveNumber is at
+// most maxMoves+1), excluding finished ones. E.g. for benchmarks and warm-ups.
+// Since the order of the actions of a board isn't deterministic, neither are the
+// boards for a given rng.
+func RandomBoards(num, maxMoves int, rng *rand.Rand) (boards []*Board) {
+	for len(boards) < num {
+		board := NewBoard()
+		numMoves := rng.Intn(maxMoves + 1)
+		for ii := 0; ii < numMoves && !board.IsFinished(); ii++ {
+			actions := board.Derived.Actions
+			action := SKIP_ACTION
+			if len(actions) > 0 {
+				action = actions[rng.Intn(len(actions))]
+			}
+			board = board.Act(action)
+		}
+		if !board.IsFinished() {
+			boards = append(boards, board)
+		}
+	}
+	return
+}
@@ -0,0 +1,174 @@
+package ai_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestVisitCountPolicy(t *testing.T) {
+	visits := []int{10, 30, 0, 60}
+
+	// Temperature=1: proportional to visits.
+	probs := ai.VisitCountPolicy(visits, 1)
+	for ii, count := range visits {
+		if want := float32(count) / 100; math.Abs(float64(probs[ii]-want)) > 1e-6 {
+			t.Errorf("temperature=1: probs[%d]=%g, wanted %g", ii, probs[ii], want)
+		}
+	}
+
+	// Temperature->0: approaches one-hot of the most visited action.
+	for _, temperature := range []float64{0.01, 0} {
+		probs = ai.VisitCountPolicy(visits, temperature)
+		for ii, want := range ai.OneHotEncoding(len(visits), 3) {
+			if math.Abs(float64(probs[ii]-want)) > 1e-6 {
+				t.Errorf("temperature=%g: probs[%d]=%g, wanted %g", temperature, ii, probs[ii], want)
+			}
+		}
+	}
+
+	// Ties are split, and no visits gives a uniform distribution.
+	probs = ai.VisitCountPolicy([]int{5, 5, 1}, 0)
+	if probs[0] != 0.5 || probs[1] != 0.5 || probs[2] != 0 {
+		t.Errorf("Ties not split evenly: %v", probs)
+	}
+	probs = ai.VisitCountPolicy([]int{0, 0}, 1)
+	if probs[0] != 0.5 || probs[1] != 0.5 {
+		t.Errorf("No visits should give uniform distribution: %v", probs)
+	}
+}
+
+func TestSmoothLabels(t *testing.T) {
+	const epsilon = 0.03
+	for _, labels := range [][]float32{ai.OneHotEncoding(5, 2), {0.1, 0.6, 0.3}} {
+		smoothed := ai.SmoothLabels(labels, epsilon)
+		sum := float32(0)
+		argmax := 0
+		for ii, label := range smoothed {
+			sum += label
+			if label > smoothed[argmax] {
+				argmax = ii
+			}
+			if label <= 0 {
+				t.Errorf("SmoothLabels(%v): action %d has no probability mass", labels, ii)
+			}
+		}
+		if math.Abs(float64(sum-1)) > 1e-6 {
+			t.Errorf("SmoothLabels(%v)=%v sums to %g, wanted 1", labels, smoothed, sum)
+		}
+		if labels[argmax] != 1 && labels[argmax] != 0.6 {
+			t.Errorf("SmoothLabels(%v)=%v changed the most probable action", labels, smoothed)
+		}
+	}
+	if smoothed := ai.SmoothLabels(ai.OneHotEncoding(4, 0), epsilon); smoothed[0] != 1-epsilon ||
+		math.Abs(float64(smoothed[1]-epsilon/3)) > 1e-7 {
+		t.Errorf("SmoothLabels of one-hot got %v, wanted %g for the action taken and %g for the others",
+			smoothed, 1-epsilon, epsilon/3)
+	}
+	if labels := ai.OneHotEncoding(1, 0); !reflect.DeepEqual(ai.SmoothLabels(labels, epsilon), labels) {
+		t.Errorf("SmoothLabels with a single action should be unchanged")
+	}
+
+	// With 2 actions the most probable one keeps the largest mass for any epsilon
+	// below MAX_LABEL_SMOOTHING.
+	for _, labels := range [][]float32{ai.OneHotEncoding(2, 1), {0.45, 0.55}} {
+		if smoothed := ai.SmoothLabels(labels, 0.49); smoothed[1] <= smoothed[0] {
+			t.Errorf("SmoothLabels(%v, 0.49)=%v changed the most probable action", labels, smoothed)
+		}
+	}
+}
+
+func TestTemperedPolicy(t *testing.T) {
+	probs := []float32{0.1, 0.2, 0.7}
+
+	// Temperature=1 returns the probabilities unchanged.
+	if tempered := ai.TemperedPolicy(probs, 1); !reflect.DeepEqual(tempered, probs) {
+		t.Errorf("temperature=1: got %v, wanted %v", tempered, probs)
+	}
+
+	// Temperature=0.5 squares the probabilities: 0.01, 0.04, 0.49, normalized.
+	tempered := ai.TemperedPolicy(probs, 0.5)
+	for ii, want := range []float32{0.01 / 0.54, 0.04 / 0.54, 0.49 / 0.54} {
+		if math.Abs(float64(tempered[ii]-want)) > 1e-6 {
+			t.Errorf("temperature=0.5: probs[%d]=%g, wanted %g", ii, tempered[ii], want)
+		}
+	}
+
+	// High temperatures approach the uniform distribution, and 0 the one-hot
+	// encoding of the most probable action.
+	tempered = ai.TemperedPolicy(probs, 1e6)
+	for ii := range tempered {
+		if math.Abs(float64(tempered[ii]-1.0/3)) > 1e-4 {
+			t.Errorf("temperature=1e6: probs[%d]=%g, wanted ~1/3", ii, tempered[ii])
+		}
+	}
+	if tempered = ai.TemperedPolicy(probs, 0); !reflect.DeepEqual(tempered, ai.OneHotEncoding(3, 2)) {
+		t.Errorf("temperature=0: got %v, wanted one-hot of the last action", tempered)
+	}
+}
+
+func TestRandomBoards(t *testing.T) {
+	// The boards aren't reproducible for a seed, so only check properties that
+	// hold for any sequence of moves.
+	const maxMoves = 30
+	boards := ai.RandomBoards(10, maxMoves, rand.New(rand.NewSource(1)))
+	if len(boards) != 10 {
+		t.Fatalf("Got %d boards, wanted 10", len(boards))
+	}
+	for ii, board := range boards {
+		// MoveNumber starts at 1.
+		if movesPlayed := board.MoveNumber - 1; board.IsFinished() || movesPlayed > maxMoves {
+			t.Errorf("Board #%d: finished=%v after %d moves, wanted unfinished after at most %d moves",
+				ii, board.IsFinished(), movesPlayed, maxMoves)
+		}
+	}
+}
+
+// pieceCountScorer scores a board by the pieces on the board of the next player
+// minus the ones of the opponent, with ants worth 2 and other pieces 1.
+type pieceCountScorer struct{}
+
+func (pieceCountScorer) Score(b *Board) (score float32, actionProbs []float32) {
+	for _, pos := range b.OccupiedPositions() {
+		player, piece, _ := b.PieceAt(pos)
+		value := float32(1)
+		if piece == ANT {
+			value = 2
+		}
+		if player != b.NextPlayer {
+			value = -value
+		}
+		score += value
+	}
+	return
+}
+
+func (pieceCountScorer) Version() int { return 0 }
+
+func TestPieceContributions(t *testing.T) {
+	board := NewBoard()
+	for _, notation := range []string{"Q@0,0", "A@0,1", "G@0,-1"} {
+		action, err := ParseAction(notation)
+		if err != nil {
+			t.Fatalf("Failed to parse action %q: %v", notation, err)
+		}
+		board = board.Act(board.Derived.Actions[board.FindActionDeep(action)])
+	}
+
+	// Player 1 is next: its ant adds 2 to the score, player 0's pieces take 1 each.
+	score, contributions := ai.PieceContributions(board, pieceCountScorer{})
+	if score != 0 {
+		t.Errorf("Score of the board is %g, wanted 0", score)
+	}
+	want := Heatmap{Pos{0, 0}: -1, Pos{0, 1}: 2, Pos{0, -1}: -1}
+	if !reflect.DeepEqual(contributions, want) {
+		t.Errorf("PieceContributions()=%v, wanted %v", contributions, want)
+	}
+	if board.NumPiecesOnBoard() != 3 || board.Available(1, ANT) != 2 {
+		t.Errorf("PieceContributions changed the board")
+	}
+}
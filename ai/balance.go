@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// Outcome of a game for one of the players, stored with each LabeledExample.
+type Outcome uint8
+
+const (
+	OUTCOME_UNKNOWN Outcome = iota
+	OUTCOME_WIN
+	OUTCOME_LOSS
+	OUTCOME_DRAW
+	NUM_OUTCOMES
+)
+
+var outcomeNames = [NUM_OUTCOMES]string{"unknown", "win", "loss", "draw"}
+
+func (o Outcome) String() string {
+	if o >= NUM_OUTCOMES {
+		return fmt.Sprintf("Outcome(%d)", uint8(o))
+	}
+	return outcomeNames[o]
+}
+
+// BalanceByOutcome reads the dataset in file `in` and writes to file `out` the
+// examples resampled so the proportions of their outcomes match the given ratios,
+// e.g. {OUTCOME_WIN: 0.4, OUTCOME_LOSS: 0.4, OUTCOME_DRAW: 0.2}. Ratios don't need
+// to add up to 1, and outcomes not given are dropped.
+//
+// The output has as many examples as the input (up to rounding): outcomes that
+// are under-represented are oversampled (examples repeated) and the others
+// subsampled. The resampling is deterministic, and preserves the order of the
+// examples. All examples must have a known outcome.
+func BalanceByOutcome(in, out string, ratios map[Outcome]float64) (numIn, numOut int, err error) {
+	// First pass: count examples per outcome.
+	var counts [NUM_OUTCOMES]int
+	version := 0
+	err = forEachExample(in, func(reader *ExampleReader, example LabeledExample) error {
+		version = reader.FeaturesVersion
+		if example.Outcome == OUTCOME_UNKNOWN {
+			return fmt.Errorf("Dataset %q, example #%d: unknown outcome, can't balance", in, numIn)
+		}
+		counts[example.Outcome]++
+		numIn++
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Rate of each outcome: expected number of copies of each example.
+	totalRatio := 0.0
+	for outcome, ratio := range ratios {
+		if outcome == OUTCOME_UNKNOWN || outcome >= NUM_OUTCOMES || ratio < 0 {
+			err = fmt.Errorf("Invalid ratio %g for outcome %s", ratio, outcome)
+			return
+		}
+		totalRatio += ratio
+	}
+	if totalRatio <= 0 {
+		err = fmt.Errorf("No positive ratio given to balance dataset %q", in)
+		return
+	}
+	var rates [NUM_OUTCOMES]float64
+	for outcome, ratio := range ratios {
+		if ratio == 0 {
+			continue
+		}
+		if counts[outcome] == 0 {
+			err = fmt.Errorf("Dataset %q has no examples with outcome %s", in, outcome)
+			return
+		}
+		rates[outcome] = float64(numIn) * ratio / totalRatio / float64(counts[outcome])
+	}
+
+	// Second pass: write each example the number of times given by its rate, carrying
+	// over the fractional part to the next examples of the same outcome.
+	outFile, err := os.Create(out)
+	if err != nil {
+		err = fmt.Errorf("Failed to create dataset %q: %v", out, err)
+		return
+	}
+	defer outFile.Close()
+	writer, err := NewExampleWriter(outFile, version)
+	if err != nil {
+		return
+	}
+	var carry [NUM_OUTCOMES]float64
+	err = forEachExample(in, func(_ *ExampleReader, example LabeledExample) error {
+		carry[example.Outcome] += rates[example.Outcome]
+		for ; carry[example.Outcome] >= 1-1e-9; carry[example.Outcome]-- {
+			if err := writer.Write(&example); err != nil {
+				return fmt.Errorf("Dataset %q: %v", out, err)
+			}
+			numOut++
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+	err = outFile.Close()
+	glog.V(1).Infof("BalanceByOutcome(%q): %d examples (wins=%d, losses=%d, draws=%d) resampled to %d",
+		in, numIn, counts[OUTCOME_WIN], counts[OUTCOME_LOSS], counts[OUTCOME_DRAW], numOut)
+	return
+}
@@ -0,0 +1,128 @@
+package ai_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+func TestBalanceByOutcome(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_balance")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 60% wins, 30% losses and 10% draws.
+	board := symmetryTestBoards()[1]
+	numPerOutcome := map[ai.Outcome]int{ai.OUTCOME_WIN: 600, ai.OUTCOME_LOSS: 300, ai.OUTCOME_DRAW: 100}
+	var examples []ai.LabeledExample
+	for ii := 0; ii < 1000; ii++ {
+		example := ai.MakeLabeledExample(board, float32(ii), ai.AllFeaturesDim)
+		switch {
+		case ii%10 < 6:
+			example.Outcome = ai.OUTCOME_WIN
+		case ii%10 < 9:
+			example.Outcome = ai.OUTCOME_LOSS
+		default:
+			example.Outcome = ai.OUTCOME_DRAW
+		}
+		examples = append(examples, example)
+	}
+	in := path.Join(dir, "in")
+	writeDataset(t, in, ai.AllFeaturesDim, examples)
+
+	// Outcomes are preserved in the dataset.
+	_, got := readDataset(t, in)
+	gotPerOutcome := make(map[ai.Outcome]int)
+	for _, example := range got {
+		gotPerOutcome[example.Outcome]++
+	}
+	for outcome, want := range numPerOutcome {
+		if gotPerOutcome[outcome] != want {
+			t.Errorf("Read %d examples with outcome %s, wanted %d", gotPerOutcome[outcome], outcome, want)
+		}
+	}
+
+	out := path.Join(dir, "out")
+	ratios := map[ai.Outcome]float64{ai.OUTCOME_WIN: 1, ai.OUTCOME_LOSS: 1, ai.OUTCOME_DRAW: 2}
+	numIn, numOut, err := ai.BalanceByOutcome(in, out, ratios)
+	if err != nil {
+		t.Fatalf("Failed to balance dataset: %v", err)
+	}
+	if numIn != 1000 || numOut < 995 || numOut > 1000 {
+		t.Errorf("Balanced %d examples into %d, wanted 1000 into ~1000", numIn, numOut)
+	}
+	_, got = readDataset(t, out)
+	if len(got) != numOut {
+		t.Fatalf("Read %d examples, but BalanceByOutcome reported %d", len(got), numOut)
+	}
+	gotPerOutcome = make(map[ai.Outcome]int)
+	for _, example := range got {
+		gotPerOutcome[example.Outcome]++
+	}
+	for outcome, ratio := range ratios {
+		want := 1000 * ratio / 4
+		if diff := float64(gotPerOutcome[outcome]) - want; diff < -2 || diff > 2 {
+			t.Errorf("Got %d examples with outcome %s, wanted %g", gotPerOutcome[outcome], outcome, want)
+		}
+	}
+
+	// Outcomes not in the ratios are dropped.
+	if _, numOut, err = ai.BalanceByOutcome(in, out, map[ai.Outcome]float64{ai.OUTCOME_WIN: 1}); err != nil {
+		t.Fatalf("Failed to balance dataset: %v", err)
+	}
+	if _, got = readDataset(t, out); numOut != 1000 || len(got) != numOut || got[0].Outcome != ai.OUTCOME_WIN {
+		t.Errorf("Balancing to wins only got %d examples, wanted 1000 wins", numOut)
+	}
+
+	// Examples without outcome can't be balanced.
+	examples[3].Outcome = ai.OUTCOME_UNKNOWN
+	writeDataset(t, in, ai.AllFeaturesDim, examples)
+	if _, _, err = ai.BalanceByOutcome(in, out, ratios); err == nil {
+		t.Errorf("BalanceByOutcome should fail with examples of unknown outcome")
+	}
+}
+
+func TestBalanceGameExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_balance")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A resigned game, so each example is a win or a loss, and a capped one, a draw.
+	resigned, capped := scriptedGame(6), scriptedGame(4)
+	capped.Resigned, capped.Capped = false, true
+	var examples []ai.LabeledExample
+	for _, game := range []ai.GameRecord{resigned, capped} {
+		labels := make([]float32, len(game.Boards))
+		examples = append(examples, ai.GameLabeledExamples(game, labels, ai.AllFeaturesDim)...)
+	}
+	if len(examples) != 10 {
+		t.Fatalf("Got %d examples from games with 10 actions", len(examples))
+	}
+	for ii, example := range examples {
+		want := ai.OUTCOME_DRAW
+		if ii < 6 {
+			want = resigned.OutcomeFor(resigned.Boards[ii].NextPlayer)
+		}
+		if example.Outcome != want || example.Outcome == ai.OUTCOME_UNKNOWN {
+			t.Errorf("Example #%d: got outcome %s, wanted %s", ii, example.Outcome, want)
+		}
+	}
+
+	in, out := path.Join(dir, "in"), path.Join(dir, "out")
+	writeDataset(t, in, ai.AllFeaturesDim, examples)
+	ratios := map[ai.Outcome]float64{ai.OUTCOME_WIN: 1, ai.OUTCOME_LOSS: 1, ai.OUTCOME_DRAW: 1}
+	numIn, numOut, err := ai.BalanceByOutcome(in, out, ratios)
+	if err != nil {
+		t.Fatalf("Failed to balance examples of games: %v", err)
+	}
+	if numIn != len(examples) || numOut == 0 {
+		t.Errorf("Balanced %d examples into %d, wanted %d into some", numIn, numOut, len(examples))
+	}
+}
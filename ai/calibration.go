@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+)
+
+// DEFAULT_VALUE_SCALE maps the scores returned by EndGameScore (+/-10) to win
+// probabilities of 99% and 1%. Use CalibrateValueScale to fit it to a model.
+const DEFAULT_VALUE_SCALE = 2.18
+
+// ValueScale is the scale used by ValueToWinProb. It can be set to the result
+// of CalibrateValueScale for the model in use.
+var ValueScale float32 = DEFAULT_VALUE_SCALE
+
+// ValueToWinProb converts a score (see Scorer), from -10 to 10, to the
+// probability of winning for the current player, using a logistic curve with
+// ValueScale: 1 / (1 + exp(-score/ValueScale)). A draw, or a score of 0, maps
+// to 0.5.
+func ValueToWinProb(score float32) float32 {
+	return float32(valueToWinProb(float64(score), 1/float64(ValueScale)))
+}
+
+func valueToWinProb(score, invScale float64) float64 {
+	return 1 / (1 + math.Exp(-score*invScale))
+}
+
+// MIN_VALUE_SCALE bounds the scale fitted by CalibrateValueScale: when the
+// scores separate perfectly the outcomes, the likelihood keeps improving as the
+// scale shrinks.
+const MIN_VALUE_SCALE = 0.01
+
+// CalibrateValueScale fits the scale of ValueToWinProb to a dataset of scores
+// and the respective outcomes for the player: 1 for a win, 0 for a loss and 0.5
+// for a draw. It maximizes the likelihood of the outcomes (minimizes the
+// cross-entropy), using Newton's method.
+func CalibrateValueScale(scores, outcomes []float32) (scale float32, err error) {
+	if len(scores) != len(outcomes) {
+		return 0, fmt.Errorf("Got %d scores but %d outcomes", len(scores), len(outcomes))
+	}
+	return calibrateValueScale(scores, outcomes, nil)
+}
+
+// calibrateValueScale implements CalibrateValueScale, with optional weights for
+// each example: an example with weight w counts as w examples.
+func calibrateValueScale(scores, outcomes []float32, weights []float64) (scale float32, err error) {
+	weight := func(ii int) float64 {
+		if weights == nil {
+			return 1
+		}
+		return weights[ii]
+	}
+	for ii, outcome := range outcomes {
+		if outcome < 0 || outcome > 1 {
+			return 0, fmt.Errorf("Outcome #%d is %g, it must be between 0 and 1", ii, outcome)
+		}
+	}
+
+	// The loss is convex on the inverse of the scale, and its gradient at 0 is
+	// -sum((outcome-0.5)*score): the optimum is positive only if it is negative.
+	correlation := 0.0
+	for ii, score := range scores {
+		correlation += weight(ii) * (float64(outcomes[ii]) - 0.5) * float64(score)
+	}
+	if correlation <= 0 {
+		return 0, fmt.Errorf("Scores of %d examples are not positively correlated with the outcomes, can't calibrate",
+			len(scores))
+	}
+
+	// Newton's method on the inverse of the scale.
+	const maxIterations = 100
+	maxInvScale := 1.0 / MIN_VALUE_SCALE
+	invScale := 1.0 / DEFAULT_VALUE_SCALE
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		var gradient, hessian float64
+		for ii, score := range scores {
+			s := float64(score)
+			p := valueToWinProb(s, invScale)
+			gradient += weight(ii) * (p - float64(outcomes[ii])) * s
+			hessian += weight(ii) * p * (1 - p) * s * s
+		}
+		if hessian == 0 {
+			// Probabilities saturated: the scores separate the outcomes.
+			invScale = maxInvScale
+			break
+		}
+		newInvScale := invScale - gradient/hessian
+		if newInvScale <= 0 {
+			// Overshoot, the optimum is between 0 and invScale.
+			newInvScale = invScale / 2
+		}
+		if newInvScale >= maxInvScale {
+			invScale = maxInvScale
+			break
+		}
+		converged := math.Abs(newInvScale-invScale) < 1e-9*invScale
+		invScale = newInvScale
+		if converged {
+			break
+		}
+	}
+	return float32(1 / invScale), nil
+}
@@ -0,0 +1,161 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// CALIBRATION_BIN_WIDTH is the width, in units of score, of the bins of the
+// histogram accumulated by CalibrationRecorder.
+const CALIBRATION_BIN_WIDTH = 0.1
+
+// CalibrationBin is a bin of the histogram of scores accumulated by
+// CalibrationRecorder.
+type CalibrationBin struct {
+	// Score at the center of the bin.
+	Score float32
+
+	// Count of scores in the bin.
+	Count int
+
+	// WinRate is the mean outcome (1 for a win, 0 for a loss and 0.5 for a draw)
+	// of the games of the scores in the bin, for the player they were predicted for.
+	WinRate float32
+}
+
+// CalibrationRecorder wraps the BatchScorer of a player to record the score of
+// each move it plays (see RecordMove), and once the game finishes (see
+// GameFinished), pairs them with its outcome. They are accumulated in a
+// histogram (see Histogram), that can be used to fit the scale of
+// ValueToWinProb (see Calibrate).
+//
+// Only the boards of the game are recorded, with the score of the move chosen:
+// not the boards scored during the searches, most of which never happen in the
+// game, and would bias the calibration.
+//
+// Boards are matched to their games by the first board of the match (following
+// Board.Previous), so it works with multiple games played concurrently. The
+// scores of a game are kept until GameFinished is called for it.
+//
+// It is safe for concurrent use if the wrapped scorer is.
+type CalibrationRecorder struct {
+	BatchScorer
+
+	mu sync.Mutex
+
+	// pending scores, binned, for each player, of the games not finished yet,
+	// indexed by their first board.
+	pending map[*Board]*[NUM_PLAYERS]map[int]int
+
+	// bins of the histogram, with the count and sum of outcomes.
+	counts   map[int]int
+	outcomes map[int]float64
+}
+
+// NewCalibrationRecorder returns scorer wrapped by a CalibrationRecorder.
+func NewCalibrationRecorder(scorer BatchScorer) *CalibrationRecorder {
+	return &CalibrationRecorder{
+		BatchScorer: scorer,
+		pending:     make(map[*Board]*[NUM_PLAYERS]map[int]int),
+		counts:      make(map[int]int),
+		outcomes:    make(map[int]float64),
+	}
+}
+
+// firstBoard returns the first board of the match of b.
+func firstBoard(b *Board) *Board {
+	for b.Previous != nil {
+		b = b.Previous
+	}
+	return b
+}
+
+// calibrationBin returns the index of the bin of the histogram of the score.
+func calibrationBin(score float32) int {
+	return int(math.Round(float64(score) / CALIBRATION_BIN_WIDTH))
+}
+
+// RecordMove records the score predicted for board.NextPlayer by the move it
+// played in board, e.g. the score returned by the search.
+func (cr *CalibrationRecorder) RecordMove(board *Board, score float32) {
+	first := firstBoard(board)
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	game, ok := cr.pending[first]
+	if !ok {
+		game = &[NUM_PLAYERS]map[int]int{}
+		for player := range game {
+			game[player] = make(map[int]int)
+		}
+		cr.pending[first] = game
+	}
+	game[board.NextPlayer][calibrationBin(score)]++
+}
+
+// GameFinished adds the scores recorded for the boards of the game to the
+// histogram, paired with the outcome of the game. It should be called once the
+// game is finished, or it has an outcome (e.g. resignation). If the game has no
+// outcome (see GameRecord.OutcomeFor), its scores are discarded.
+func (cr *CalibrationRecorder) GameFinished(game *GameRecord) {
+	first := firstBoard(game.FinalBoard())
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	pending, ok := cr.pending[first]
+	if !ok {
+		return
+	}
+	delete(cr.pending, first)
+	if game.OutcomeFor(0) == OUTCOME_UNKNOWN {
+		return
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		outcome := 0.5
+		switch game.OutcomeFor(player) {
+		case OUTCOME_WIN:
+			outcome = 1
+		case OUTCOME_LOSS:
+			outcome = 0
+		}
+		for bin, count := range pending[player] {
+			cr.counts[bin] += count
+			cr.outcomes[bin] += outcome * float64(count)
+		}
+	}
+}
+
+// Histogram returns the bins of the histogram of the scores recorded, paired
+// with the outcomes of their games, sorted by score. Only non-empty bins are
+// returned.
+func (cr *CalibrationRecorder) Histogram() (bins []CalibrationBin) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for bin, count := range cr.counts {
+		bins = append(bins, CalibrationBin{
+			Score:   float32(bin) * CALIBRATION_BIN_WIDTH,
+			Count:   count,
+			WinRate: float32(cr.outcomes[bin] / float64(count)),
+		})
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i].Score < bins[j].Score })
+	return
+}
+
+// Calibrate fits the scale of ValueToWinProb to the histogram, see
+// CalibrateValueScale. The scores are approximated by the centers of their bins.
+func (cr *CalibrationRecorder) Calibrate() (scale float32, err error) {
+	bins := cr.Histogram()
+	if len(bins) == 0 {
+		return 0, fmt.Errorf("No scores of finished games recorded, can't calibrate")
+	}
+	scores := make([]float32, len(bins))
+	outcomes := make([]float32, len(bins))
+	weights := make([]float64, len(bins))
+	for ii, bin := range bins {
+		scores[ii], outcomes[ii], weights[ii] = bin.Score, bin.WinRate, float64(bin.Count)
+	}
+	return calibrateValueScale(scores, outcomes, weights)
+}
@@ -0,0 +1,66 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// playerScorer always predicts that player 0 wins.
+type playerScorer struct{}
+
+func (playerScorer) Score(b *Board) (float32, []float32) {
+	if b.NextPlayer == 0 {
+		return 2, nil
+	}
+	return -2, nil
+}
+
+func (playerScorer) Version() int { return 0 }
+
+func TestCalibrationRecorder(t *testing.T) {
+	var actions []Action
+	for _, notation := range []string{"G@0,0", "A@0,1", "Q@0,-1"} {
+		action, err := ParseAction(notation)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", notation, err)
+		}
+		actions = append(actions, action)
+	}
+	game := ai.NewGameRecord(NewBoard(), actions)
+	// Player 1 resigns at the end, so player 0 wins.
+	game.Resigned = true
+
+	recorder := ai.NewCalibrationRecorder(ai.BatchScorerWrapper{Scorer: playerScorer{}})
+	for _, board := range game.Boards[:3] {
+		score, _ := recorder.Score(board)
+		recorder.RecordMove(board, score)
+	}
+	// Boards scored by a search, but not played, are not recorded.
+	recorder.Score(game.Boards[1].Act(game.Boards[1].Derived.Actions[0]))
+	recorder.BatchScore([]*Board{game.Boards[2].Act(game.Boards[2].Derived.Actions[0])})
+	// Move of another game, not finished.
+	recorder.RecordMove(NewBoard(), 2)
+	if bins := recorder.Histogram(); len(bins) != 0 {
+		t.Errorf("Histogram has %d bins before the game finished: %v", len(bins), bins)
+	}
+
+	recorder.GameFinished(&game)
+	bins := recorder.Histogram()
+	want := []ai.CalibrationBin{{Score: -2, Count: 1, WinRate: 0}, {Score: 2, Count: 2, WinRate: 1}}
+	if len(bins) != len(want) {
+		t.Fatalf("Got histogram %v, wanted %v", bins, want)
+	}
+	for ii, bin := range bins {
+		if bin.Count != want[ii].Count || bin.WinRate != want[ii].WinRate ||
+			bin.Score < want[ii].Score-0.01 || bin.Score > want[ii].Score+0.01 {
+			t.Errorf("Histogram bin #%d is %+v, wanted %+v", ii, bin, want[ii])
+		}
+	}
+
+	// Scores separate the outcomes perfectly, so the scale is the minimum.
+	if scale, err := recorder.Calibrate(); err != nil || scale > 2*ai.MIN_VALUE_SCALE {
+		t.Errorf("Calibrate()=(%g, %v), wanted scale close to %g", scale, err, ai.MIN_VALUE_SCALE)
+	}
+}
@@ -0,0 +1,63 @@
+package ai_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+func TestValueToWinProb(t *testing.T) {
+	if p := ai.ValueToWinProb(0); p != 0.5 {
+		t.Errorf("ValueToWinProb(0)=%g, wanted 0.5", p)
+	}
+	if p := ai.ValueToWinProb(10); p < 0.98 || p > 1 {
+		t.Errorf("ValueToWinProb(10)=%g, wanted close to 1", p)
+	}
+	if p := ai.ValueToWinProb(-10); p > 0.02 || p < 0 {
+		t.Errorf("ValueToWinProb(-10)=%g, wanted close to 0", p)
+	}
+	previous := float32(-1)
+	for score := float32(-12); score <= 12; score += 0.25 {
+		p := ai.ValueToWinProb(score)
+		if p <= previous {
+			t.Errorf("ValueToWinProb not monotonic: ValueToWinProb(%g)=%g <= %g", score, p, previous)
+		}
+		if sum := p + ai.ValueToWinProb(-score); math.Abs(float64(sum)-1) > 1e-6 {
+			t.Errorf("ValueToWinProb(%g)+ValueToWinProb(%g)=%g, wanted 1", score, -score, sum)
+		}
+		previous = p
+	}
+}
+
+func TestCalibrateValueScale(t *testing.T) {
+	// Outcomes sampled from a logistic with a known scale.
+	const trueScale = 3.0
+	rnd := rand.New(rand.NewSource(7))
+	scores := make([]float32, 20000)
+	outcomes := make([]float32, len(scores))
+	for ii := range scores {
+		scores[ii] = 20*rnd.Float32() - 10
+		if rnd.Float64() < 1/(1+math.Exp(-float64(scores[ii])/trueScale)) {
+			outcomes[ii] = 1
+		}
+	}
+	scale, err := ai.CalibrateValueScale(scores, outcomes)
+	if err != nil {
+		t.Fatalf("Failed to calibrate: %v", err)
+	}
+	if math.Abs(float64(scale)-trueScale) > 0.2 {
+		t.Errorf("Calibrated scale %g, wanted close to %g", scale, trueScale)
+	}
+
+	// Scores that don't predict the outcome can't be calibrated.
+	if _, err := ai.CalibrateValueScale([]float32{1, -1}, []float32{0, 1}); err == nil {
+		t.Errorf("Calibration with anti-correlated scores should fail")
+	}
+	// Separable scores give the minimum scale.
+	scale, err = ai.CalibrateValueScale([]float32{1, -1, 2}, []float32{1, 0, 1})
+	if err != nil || scale != ai.MIN_VALUE_SCALE {
+		t.Errorf("Calibration with separable scores got scale=%g, err=%v, wanted %g", scale, err, ai.MIN_VALUE_SCALE)
+	}
+}
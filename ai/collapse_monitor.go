@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"math"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// CollapseMonitor detects a degenerate model, one that collapsed to predicting
+// (almost) the same score for every board, which is a common failure of broken
+// training setups. It periodically scores a fixed set of diverse boards and
+// checks the standard deviation of the scores.
+//
+// A nil CollapseMonitor never detects a collapse.
+type CollapseMonitor struct {
+	// Boards scored by Check.
+	Boards []*Board
+
+	// MinStdDev is the standard deviation of the scores below which the model is
+	// considered collapsed, e.g. 0.01 for scores in [-10, 10].
+	MinStdDev float32
+}
+
+// NewCollapseMonitor creates a CollapseMonitor with up to numBoards boards picked
+// evenly spaced from the given ones: if they are ordered by match, these are
+// diverse, taken from different matches and stages of the game.
+func NewCollapseMonitor(boards []*Board, numBoards int, minStdDev float32) *CollapseMonitor {
+	if numBoards > len(boards) {
+		numBoards = len(boards)
+	}
+	m := &CollapseMonitor{Boards: make([]*Board, numBoards), MinStdDev: minStdDev}
+	for ii := range m.Boards {
+		m.Boards[ii] = boards[ii*len(boards)/numBoards]
+	}
+	return m
+}
+
+// Check scores the boards with the scorer, and returns the standard deviation of
+// the scores and whether it is below MinStdDev. Scores that are not finite are
+// also considered a collapse.
+func (m *CollapseMonitor) Check(scorer BatchScorer) (stddev float32, collapsed bool) {
+	if m == nil || len(m.Boards) == 0 {
+		return 0, false
+	}
+	scores, _ := scorer.BatchScore(m.Boards)
+	var sum, sumSq float64
+	for _, score := range scores {
+		sum += float64(score)
+		sumSq += float64(score) * float64(score)
+	}
+	n := float64(len(scores))
+	mean := sum / n
+	std := math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+	if math.IsNaN(std) || math.IsInf(std, 0) {
+		return float32(std), true
+	}
+	return float32(std), float32(std) < m.MinStdDev
+}
@@ -0,0 +1,56 @@
+package ai_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// constantScorer scores every board with the same value.
+type constantScorer float32
+
+func (s constantScorer) Score(b *Board) (float32, []float32) { return float32(s), nil }
+func (s constantScorer) Version() int                        { return ai.AllFeaturesDim }
+func (s constantScorer) BatchScore(boards []*Board) ([]float32, [][]float32) {
+	return ai.BatchScorerWrapper{Scorer: s}.BatchScore(boards)
+}
+
+func TestCollapseMonitor(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var boards []*Board
+	for game := 0; game < 3; game++ {
+		board := NewBoard()
+		for ii := 0; ii < 30 && !board.IsFinished(); ii++ {
+			boards = append(boards, board)
+			board = board.Act(board.Derived.Actions[rng.Intn(len(board.Derived.Actions))])
+		}
+	}
+	monitor := ai.NewCollapseMonitor(boards, 20, 0.01)
+	if len(monitor.Boards) != 20 || monitor.Boards[0] != boards[0] {
+		t.Fatalf("Got %d boards for the monitor, wanted 20 starting with the first board", len(monitor.Boards))
+	}
+
+	if stddev, collapsed := monitor.Check(constantScorer(3.5)); !collapsed || stddev != 0 {
+		t.Errorf("Constant scorer not flagged as collapsed: stddev=%g, collapsed=%v", stddev, collapsed)
+	}
+	if stddev, collapsed := monitor.Check(constantScorer(float32(math.NaN()))); !collapsed {
+		t.Errorf("NaN scorer not flagged as collapsed: stddev=%g", stddev)
+	}
+	if stddev, collapsed := monitor.Check(ai.TrainedBest); collapsed {
+		t.Errorf("Trained scorer flagged as collapsed: stddev=%g", stddev)
+	}
+
+	// Disabled monitor.
+	var disabled *ai.CollapseMonitor
+	if _, collapsed := disabled.Check(constantScorer(0)); collapsed {
+		t.Errorf("nil CollapseMonitor flagged a collapse")
+	}
+
+	// Fewer boards than requested.
+	if m := ai.NewCollapseMonitor(boards[:5], 20, 0.01); len(m.Boards) != 5 {
+		t.Errorf("Got %d boards for the monitor, wanted 5", len(m.Boards))
+	}
+}
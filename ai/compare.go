@@ -0,0 +1,78 @@
+package ai
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// MoveComparison compares how two scorers evaluate one position of a game, see
+// CompareScorers.
+type MoveComparison struct {
+	// MoveNumber of the board, and Player to move.
+	MoveNumber int   `json:"move_number"`
+	Player     uint8 `json:"player"`
+
+	// Action taken in the game, in notation (see Action.Notation).
+	Action string `json:"action"`
+
+	// OldScore and NewScore are the scores of the board for Player, by each
+	// scorer, and ScoreDiff is NewScore - OldScore.
+	OldScore  float32 `json:"old_score"`
+	NewScore  float32 `json:"new_score"`
+	ScoreDiff float32 `json:"score_diff"`
+
+	// OldBest and NewBest are the actions each scorer would have chosen (see
+	// BestMove), and Disagree is set if they are different.
+	OldBest  string `json:"old_best"`
+	NewBest  string `json:"new_best"`
+	Disagree bool   `json:"disagree"`
+}
+
+// CompareScorers replays the game and compares the old and new scorers on every
+// position where an action was taken: the score each gives to the board, and the
+// action each would have chosen with BestMove. It's used to find where a newly
+// trained model disagrees with the previous one on a historical game.
+func CompareScorers(game GameRecord, oldScorer, newScorer BatchScorer) (comparisons []MoveComparison) {
+	comparisons = make([]MoveComparison, 0, len(game.Actions))
+	for ii, action := range game.Actions {
+		board := game.Boards[ii]
+		c := MoveComparison{MoveNumber: board.MoveNumber, Player: board.NextPlayer, Action: action.Notation()}
+		c.OldScore, _ = oldScorer.Score(board)
+		c.NewScore, _ = newScorer.Score(board)
+		c.ScoreDiff = c.NewScore - c.OldScore
+		oldBest, _ := BestMove(board, oldScorer)
+		newBest, _ := BestMove(board, newScorer)
+		c.OldBest, c.NewBest = oldBest.Notation(), newBest.Notation()
+		c.Disagree = oldBest != newBest
+		comparisons = append(comparisons, c)
+	}
+	return
+}
+
+// compareCSVHeader are the columns of WriteComparisonsCSV.
+var compareCSVHeader = []string{"move_number", "player", "action", "old_score", "new_score", "score_diff",
+	"old_best", "new_best", "disagree"}
+
+// WriteComparisonsCSV writes the comparisons in CSV format, with a header line.
+func WriteComparisonsCSV(w io.Writer, comparisons []MoveComparison) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(compareCSVHeader); err != nil {
+		return fmt.Errorf("Failed to write CSV: %v", err)
+	}
+	formatScore := func(score float32) string { return strconv.FormatFloat(float64(score), 'g', -1, 32) }
+	for _, c := range comparisons {
+		record := []string{strconv.Itoa(c.MoveNumber), strconv.Itoa(int(c.Player)), c.Action,
+			formatScore(c.OldScore), formatScore(c.NewScore), formatScore(c.ScoreDiff),
+			c.OldBest, c.NewBest, strconv.FormatBool(c.Disagree)}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("Failed to write CSV: %v", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("Failed to write CSV: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ai_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// funcScorer is a stub scorer that scores boards with a function.
+type funcScorer func(b *Board) float32
+
+func (f funcScorer) Score(b *Board) (float32, []float32) { return f(b), nil }
+func (f funcScorer) Version() int                        { return 0 }
+
+func TestCompareScorers(t *testing.T) {
+	// Scripted game: always play the first action.
+	const numMoves = 6
+	board := NewBoard()
+	var actions []Action
+	for ii := 0; ii < numMoves; ii++ {
+		actions = append(actions, board.Derived.Actions[0])
+		board = board.Act(board.Derived.Actions[0])
+	}
+	game := ai.NewGameRecord(NewBoard(), actions)
+
+	// The old scorer has no preferences, so BestMove picks the first action. The
+	// new one prefers the last action of each board.
+	preferred := make(map[string]bool)
+	for _, b := range game.Boards[:numMoves] {
+		preferred[b.Act(b.Derived.Actions[len(b.Derived.Actions)-1]).RenderASCII()] = true
+	}
+	oldScorer := ai.BatchScorerWrapper{Scorer: funcScorer(func(b *Board) float32 { return 0 })}
+	newScorer := ai.BatchScorerWrapper{Scorer: funcScorer(func(b *Board) float32 {
+		if preferred[b.RenderASCII()] {
+			return -5
+		}
+		return 1
+	})}
+
+	comparisons := ai.CompareScorers(game, oldScorer, newScorer)
+	if len(comparisons) != numMoves {
+		t.Fatalf("Got %d comparisons, wanted one per move (%d)", len(comparisons), numMoves)
+	}
+	for ii, c := range comparisons {
+		b := game.Boards[ii]
+		first, last := b.Derived.Actions[0], b.Derived.Actions[len(b.Derived.Actions)-1]
+		if c.MoveNumber != b.MoveNumber || c.Player != b.NextPlayer || c.Action != actions[ii].Notation() {
+			t.Errorf("Move #%d: got move number %d, player %d and action %s, wanted %d, %d and %s",
+				ii, c.MoveNumber, c.Player, c.Action, b.MoveNumber, b.NextPlayer, actions[ii].Notation())
+		}
+		if c.OldBest != first.Notation() || c.NewBest != last.Notation() || c.Disagree != (first != last) {
+			t.Errorf("Move #%d: got best moves %s (old) and %s (new), disagree=%v, wanted %s and %s",
+				ii, c.OldBest, c.NewBest, c.Disagree, first.Notation(), last.Notation())
+		}
+		wantNew, _ := newScorer.Score(b)
+		if c.OldScore != 0 || c.NewScore != wantNew || c.ScoreDiff != wantNew {
+			t.Errorf("Move #%d: got scores %g (old), %g (new), diff %g, wanted 0, %g and %g",
+				ii, c.OldScore, c.NewScore, c.ScoreDiff, wantNew, wantNew)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ai.WriteComparisonsCSV(&buf, comparisons); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(records) != numMoves+1 || records[0][0] != "move_number" || records[1][2] != actions[0].Notation() {
+		t.Errorf("Unexpected CSV output: %v", records)
+	}
+}
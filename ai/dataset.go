@@ -0,0 +1,403 @@
+// This file implements a streaming file format for datasets of LabeledExample,
+// so features don't need to be regenerated from the matches every time.
+//
+// The file starts with a header (DATASET_MAGIC, format version and features
+// version), followed by the examples, each one prefixed by its length in bytes.
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	// DATASET_MAGIC identifies dataset files.
+	DATASET_MAGIC = "HiveGoEx"
+
+	// DATASET_FORMAT_VERSION is the version of the encoding of the examples.
+	// Version 1 didn't include the BoardHash, and version 2 didn't include the
+	// Outcome.
+	DATASET_FORMAT_VERSION = 3
+)
+
+// ExampleWriter writes LabeledExample to a dataset, one at a time.
+type ExampleWriter struct {
+	w   *bufio.Writer
+	buf bytes.Buffer
+
+	// FeaturesVersion of the examples written.
+	FeaturesVersion int
+}
+
+// NewExampleWriter writes the dataset header and returns an ExampleWriter.
+// Call Flush when done.
+func NewExampleWriter(w io.Writer, featuresVersion int) (*ExampleWriter, error) {
+	ew := &ExampleWriter{w: bufio.NewWriter(w), FeaturesVersion: featuresVersion}
+	if _, err := ew.w.WriteString(DATASET_MAGIC); err != nil {
+		return nil, fmt.Errorf("Failed to write dataset header: %v", err)
+	}
+	header := []uint32{DATASET_FORMAT_VERSION, uint32(featuresVersion)}
+	if err := binary.Write(ew.w, binary.LittleEndian, header); err != nil {
+		return nil, fmt.Errorf("Failed to write dataset header: %v", err)
+	}
+	return ew, nil
+}
+
+// Write encodes one example.
+func (ew *ExampleWriter) Write(example *LabeledExample) error {
+	if len(example.Features) != ew.FeaturesVersion {
+		return fmt.Errorf("Example has %d features, but dataset is version %d",
+			len(example.Features), ew.FeaturesVersion)
+	}
+	ew.buf.Reset()
+	writeFloats(&ew.buf, example.Features)
+	binary.Write(&ew.buf, binary.LittleEndian, example.Label)
+	binary.Write(&ew.buf, binary.LittleEndian, uint32(len(example.ActionsFeatures)))
+	for _, actionFeatures := range example.ActionsFeatures {
+		writeFloats(&ew.buf, actionFeatures)
+	}
+	writeFloats(&ew.buf, example.ActionLabels)
+	binary.Write(&ew.buf, binary.LittleEndian, example.BoardHash)
+	ew.buf.WriteByte(byte(example.Outcome))
+
+	if err := binary.Write(ew.w, binary.LittleEndian, uint32(ew.buf.Len())); err != nil {
+		return fmt.Errorf("Failed to write example: %v", err)
+	}
+	if _, err := ew.w.Write(ew.buf.Bytes()); err != nil {
+		return fmt.Errorf("Failed to write example: %v", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (ew *ExampleWriter) Flush() error {
+	return ew.w.Flush()
+}
+
+func writeFloats(buf *bytes.Buffer, values []float32) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(values)))
+	binary.Write(buf, binary.LittleEndian, values)
+}
+
+// ExampleReader reads LabeledExample from a dataset, one at a time.
+type ExampleReader struct {
+	r   *bufio.Reader
+	buf []byte
+
+	// FormatVersion of the encoding of the examples.
+	FormatVersion int
+
+	// FeaturesVersion of the examples in the dataset.
+	FeaturesVersion int
+}
+
+// NewExampleReader reads the dataset header and returns an ExampleReader.
+func NewExampleReader(r io.Reader) (*ExampleReader, error) {
+	er := &ExampleReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(DATASET_MAGIC))
+	if _, err := io.ReadFull(er.r, magic); err != nil {
+		return nil, fmt.Errorf("Failed to read dataset header: %v", err)
+	}
+	if string(magic) != DATASET_MAGIC {
+		return nil, fmt.Errorf("Not a dataset file")
+	}
+	header := make([]uint32, 2)
+	if err := binary.Read(er.r, binary.LittleEndian, header); err != nil {
+		return nil, fmt.Errorf("Failed to read dataset header: %v", err)
+	}
+	if header[0] < 1 || header[0] > DATASET_FORMAT_VERSION {
+		return nil, fmt.Errorf("Unknown dataset format version %d", header[0])
+	}
+	er.FormatVersion = int(header[0])
+	er.FeaturesVersion = int(header[1])
+	return er, nil
+}
+
+// Read decodes the next example. It returns io.EOF when there are no more examples.
+func (er *ExampleReader) Read() (example LabeledExample, err error) {
+	var size uint32
+	if err = binary.Read(er.r, binary.LittleEndian, &size); err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("Failed to read example: %v", err)
+		}
+		return
+	}
+	if cap(er.buf) < int(size) {
+		er.buf = make([]byte, size)
+	}
+	er.buf = er.buf[:size]
+	if _, err = io.ReadFull(er.r, er.buf); err != nil {
+		err = fmt.Errorf("Failed to read example: %v", err)
+		return
+	}
+	err = decodeExample(er.buf, er.FormatVersion, &example)
+	return
+}
+
+// decodeExample decodes the contents of one example record.
+func decodeExample(data []byte, formatVersion int, example *LabeledExample) (err error) {
+	r := bytes.NewReader(data)
+	if example.Features, err = readFloats(r); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.LittleEndian, &example.Label); err != nil {
+		return fmt.Errorf("Failed to decode example: %v", err)
+	}
+	var numActions uint32
+	if err = binary.Read(r, binary.LittleEndian, &numActions); err != nil {
+		return fmt.Errorf("Failed to decode example: %v", err)
+	}
+	if numActions > 0 {
+		example.ActionsFeatures = make([][]float32, numActions)
+		for ii := range example.ActionsFeatures {
+			if example.ActionsFeatures[ii], err = readFloats(r); err != nil {
+				return
+			}
+		}
+	}
+	if example.ActionLabels, err = readFloats(r); err != nil {
+		return
+	}
+	if formatVersion >= 2 {
+		if err = binary.Read(r, binary.LittleEndian, &example.BoardHash); err != nil {
+			return fmt.Errorf("Failed to decode example: %v", err)
+		}
+	}
+	if formatVersion >= 3 {
+		var outcome byte
+		if outcome, err = r.ReadByte(); err != nil {
+			return fmt.Errorf("Failed to decode example: %v", err)
+		}
+		if Outcome(outcome) >= NUM_OUTCOMES {
+			return fmt.Errorf("Failed to decode example: invalid outcome %d", outcome)
+		}
+		example.Outcome = Outcome(outcome)
+	}
+	return
+}
+
+func readFloats(r *bytes.Reader) ([]float32, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("Failed to decode example: %v", err)
+	}
+	if int(size)*4 > r.Len() {
+		return nil, fmt.Errorf("Failed to decode example: %d values don't fit record", size)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	values := make([]float32, size)
+	if err := binary.Read(r, binary.LittleEndian, values); err != nil {
+		return nil, fmt.Errorf("Failed to decode example: %v", err)
+	}
+	return values, nil
+}
+
+// featuresDimForVersion returns the dimension of the feature vector of the given
+// version, or an error if version doesn't match any of the known features versions.
+func featuresDimForVersion(version int) (int, error) {
+	if version > AllFeaturesDim {
+		return 0, fmt.Errorf("Unknown features version %d, only know about %d features", version, AllFeaturesDim)
+	}
+	dim := 0
+	for ii := range AllFeatures {
+		if AllFeatures[ii].Version <= version {
+			dim += AllFeatures[ii].Dim
+		}
+	}
+	if dim != version && version != AllFeaturesDim {
+		return 0, fmt.Errorf("Invalid features version %d", version)
+	}
+	return dim, nil
+}
+
+// UpgradeFeatures converts a feature vector from one version to another.
+// Features that exist in both versions are copied, features only present in
+// toVersion are zero-filled, since they can't be computed without the board.
+// Converting to an older version is exact.
+func UpgradeFeatures(f []float32, fromVersion, toVersion int) ([]float32, error) {
+	fromDim, err := featuresDimForVersion(fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	toDim, err := featuresDimForVersion(toVersion)
+	if err != nil {
+		return nil, err
+	}
+	if len(f) != fromDim {
+		return nil, fmt.Errorf("Feature vector has %d features, but version %d requires %d",
+			len(f), fromVersion, fromDim)
+	}
+	newF := make([]float32, 0, toDim)
+	fromIdx := 0
+	for ii := range AllFeatures {
+		def := &AllFeatures[ii]
+		inFrom, inTo := def.Version <= fromVersion, def.Version <= toVersion
+		if inTo {
+			if inFrom {
+				newF = append(newF, f[fromIdx:fromIdx+def.Dim]...)
+			} else {
+				newF = append(newF, make([]float32, def.Dim)...)
+			}
+		}
+		if inFrom {
+			fromIdx += def.Dim
+		}
+	}
+	return newF, nil
+}
+
+// ConvertDataset reads the dataset in file `in`, whose features must be of version
+// fromVersion, and writes it to file `out` with the features converted to
+// toVersion (see UpgradeFeatures). Labels and action data are preserved.
+func ConvertDataset(in, out string, fromVersion, toVersion int) error {
+	inFile, err := os.Open(in)
+	if err != nil {
+		return fmt.Errorf("Failed to open dataset %q: %v", in, err)
+	}
+	defer inFile.Close()
+	reader, err := NewExampleReader(inFile)
+	if err != nil {
+		return fmt.Errorf("Failed to read dataset %q: %v", in, err)
+	}
+	if reader.FeaturesVersion != fromVersion {
+		return fmt.Errorf("Dataset %q has features version %d, wanted %d",
+			in, reader.FeaturesVersion, fromVersion)
+	}
+
+	outFile, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("Failed to create dataset %q: %v", out, err)
+	}
+	defer outFile.Close()
+	writer, err := NewExampleWriter(outFile, toVersion)
+	if err != nil {
+		return fmt.Errorf("Failed to write dataset %q: %v", out, err)
+	}
+
+	for count := 0; ; count++ {
+		example, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Dataset %q, example #%d: %v", in, count, err)
+		}
+		example.Features, err = UpgradeFeatures(example.Features, fromVersion, toVersion)
+		if err != nil {
+			return fmt.Errorf("Dataset %q, example #%d: %v", in, count, err)
+		}
+		if err = writer.Write(&example); err != nil {
+			return fmt.Errorf("Dataset %q, example #%d: %v", out, count, err)
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("Failed to write dataset %q: %v", out, err)
+	}
+	return outFile.Close()
+}
+
+// DATASET_SUMMARY_BINS is the number of bins of DatasetSummary.LabelHistogram.
+const DATASET_SUMMARY_BINS = 10
+
+// DatasetSummary describes the contents of a dataset, see SummarizeDataset.
+type DatasetSummary struct {
+	FormatVersion, FeaturesVersion int
+
+	// Count of examples, and how many of them have actions features.
+	Count, NumWithActions int
+
+	// Labels distribution. LabelHistogram counts the labels in bins of equal
+	// width over [-10, 10], labels out of this range are counted in the first or
+	// last bins. Non-finite labels (NaN or infinite) are left out of them, and
+	// counted in NumNonFiniteLabels instead.
+	LabelMin, LabelMax, LabelMean float32
+	LabelHistogram                [DATASET_SUMMARY_BINS]int
+	NumNonFiniteLabels            int
+
+	// Outcomes counts the examples of each Outcome.
+	Outcomes [NUM_OUTCOMES]int
+}
+
+// SummarizeDataset reads all the examples of the dataset and summarizes them.
+// onExample, if not nil, is called with each example read.
+func SummarizeDataset(er *ExampleReader, onExample func(idx int, example *LabeledExample)) (
+	summary DatasetSummary, err error) {
+	summary.FormatVersion, summary.FeaturesVersion = er.FormatVersion, er.FeaturesVersion
+	var labelsSum float64
+	for {
+		example, err := er.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, fmt.Errorf("Example #%d: %v", summary.Count, err)
+		}
+		if onExample != nil {
+			onExample(summary.Count, &example)
+		}
+		summary.summarizeLabel(example.Label, &labelsSum)
+		if len(example.ActionsFeatures) > 0 {
+			summary.NumWithActions++
+		}
+		if example.Outcome < NUM_OUTCOMES {
+			summary.Outcomes[example.Outcome]++
+		}
+		summary.Count++
+	}
+	if numFinite := summary.Count - summary.NumNonFiniteLabels; numFinite > 0 {
+		summary.LabelMean = float32(labelsSum / float64(numFinite))
+	}
+	return summary, nil
+}
+
+// summarizeLabel adds the label to the distribution of labels, and to labelsSum,
+// unless it's not finite, since converting NaN or infinities to int, for the
+// histogram bin, is implementation defined.
+func (s *DatasetSummary) summarizeLabel(label float32, labelsSum *float64) {
+	if math.IsNaN(float64(label)) || math.IsInf(float64(label), 0) {
+		s.NumNonFiniteLabels++
+		return
+	}
+	first := s.Count == s.NumNonFiniteLabels
+	if first || label < s.LabelMin {
+		s.LabelMin = label
+	}
+	if first || label > s.LabelMax {
+		s.LabelMax = label
+	}
+	*labelsSum += float64(label)
+	// Clamp before converting to int, which overflows for huge labels.
+	bin := math.Floor((float64(label) + 10) / 20 * DATASET_SUMMARY_BINS)
+	bin = math.Max(0, math.Min(bin, DATASET_SUMMARY_BINS-1))
+	s.LabelHistogram[int(bin)]++
+}
+
+func (s DatasetSummary) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d examples (%d with actions), format version %d, features version %d\n",
+		s.Count, s.NumWithActions, s.FormatVersion, s.FeaturesVersion)
+	fmt.Fprintf(&sb, "Labels: min=%.3f, max=%.3f, mean=%.3f\n", s.LabelMin, s.LabelMax, s.LabelMean)
+	if s.NumNonFiniteLabels > 0 {
+		fmt.Fprintf(&sb, "Non-finite labels (NaN or infinite), not in the distribution: %d\n",
+			s.NumNonFiniteLabels)
+	}
+	const binWidth = 20.0 / DATASET_SUMMARY_BINS
+	for bin, count := range s.LabelHistogram {
+		low := -10 + float64(bin)*binWidth
+		fmt.Fprintf(&sb, "\t[%5.1f, %5.1f): %d\n", low, low+binWidth, count)
+	}
+	sb.WriteString("Outcomes:")
+	for outcome, count := range s.Outcomes {
+		fmt.Fprintf(&sb, " %s=%d", Outcome(outcome), count)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,189 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// DATASET_INDEX_MAGIC identifies the index files of datasets, see MappedExampleReader.
+const DATASET_INDEX_MAGIC = "HiveGoIx"
+
+// MappedExampleReader provides random access to the examples of a dataset file,
+// by index, e.g. to shuffle datasets larger than the memory without a
+// reservoir. The file is memory-mapped, where supported, so only the examples
+// read are loaded.
+//
+// The offsets of the examples are saved in an index file (the dataset file name
+// with ".index" appended), built the first time the dataset is opened, and
+// rebuilt if the dataset changes size or modification time. It is safe for
+// concurrent use, and Example returns an error after Close.
+type MappedExampleReader struct {
+	// mu guards data against Close while examples are being read.
+	mu      sync.RWMutex
+	data    []byte
+	offsets []uint64
+	unmap   func() error
+	modTime int64
+
+	// FormatVersion of the encoding of the examples.
+	FormatVersion int
+
+	// FeaturesVersion of the examples in the dataset.
+	FeaturesVersion int
+}
+
+// OpenMappedExamples maps the dataset in filePath, and loads or builds its index.
+// Call Close when done.
+func OpenMappedExamples(filePath string) (mr *MappedExampleReader, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open dataset %q: %v", filePath, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open dataset %q: %v", filePath, err)
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("Dataset %q is empty", filePath)
+	}
+	mr = &MappedExampleReader{modTime: info.ModTime().UnixNano()}
+	if mr.data, mr.unmap, err = mmapFile(file, int(info.Size())); err != nil {
+		return nil, fmt.Errorf("Failed to map dataset %q: %v", filePath, err)
+	}
+
+	// Reuse the header parsing of ExampleReader.
+	er, err := NewExampleReader(bytes.NewReader(mr.data))
+	if err != nil {
+		mr.Close()
+		return nil, fmt.Errorf("Failed to read dataset %q: %v", filePath, err)
+	}
+	mr.FormatVersion, mr.FeaturesVersion = er.FormatVersion, er.FeaturesVersion
+
+	indexPath := filePath + ".index"
+	if mr.offsets, err = mr.loadIndex(indexPath); err != nil {
+		glog.V(1).Infof("Building index of dataset %q: %v", filePath, err)
+		if mr.offsets, err = mr.buildIndex(); err != nil {
+			mr.Close()
+			return nil, fmt.Errorf("Failed to index dataset %q: %v", filePath, err)
+		}
+		if err = mr.saveIndex(indexPath); err != nil {
+			glog.Warningf("Failed to save index of dataset %q: %v", filePath, err)
+		}
+	}
+	return mr, nil
+}
+
+// Len returns the number of examples in the dataset.
+func (mr *MappedExampleReader) Len() int { return len(mr.offsets) }
+
+// Example decodes the example at the given index.
+func (mr *MappedExampleReader) Example(idx int) (example LabeledExample, err error) {
+	if idx < 0 || idx >= len(mr.offsets) {
+		return example, fmt.Errorf("Example #%d out of range, dataset has %d examples", idx, len(mr.offsets))
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	if mr.data == nil {
+		return example, fmt.Errorf("Example #%d read from a closed dataset", idx)
+	}
+	record, err := mr.record(mr.offsets[idx])
+	if err != nil {
+		return example, fmt.Errorf("Example #%d: %v", idx, err)
+	}
+	err = decodeExample(record, mr.FormatVersion, &example)
+	return
+}
+
+// record returns the encoded example at the given offset, or an error if it
+// doesn't fit in the dataset.
+func (mr *MappedExampleReader) record(offset uint64) ([]byte, error) {
+	total := uint64(len(mr.data))
+	if offset > total || total-offset < 4 {
+		return nil, fmt.Errorf("offset %d out of dataset of %d bytes", offset, total)
+	}
+	size := uint64(binary.LittleEndian.Uint32(mr.data[offset:]))
+	if total-offset-4 < size {
+		return nil, fmt.Errorf("record of %d bytes at offset %d out of dataset of %d bytes", size, offset, total)
+	}
+	return mr.data[offset+4 : offset+4+size], nil
+}
+
+// Close unmaps the dataset. Examples already read remain valid.
+func (mr *MappedExampleReader) Close() error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.unmap == nil {
+		return nil
+	}
+	err := mr.unmap()
+	mr.data, mr.unmap = nil, nil
+	return err
+}
+
+// buildIndex scans the dataset for the offsets of the examples.
+func (mr *MappedExampleReader) buildIndex() (offsets []uint64, err error) {
+	offset := uint64(len(DATASET_MAGIC) + 8)
+	total := uint64(len(mr.data))
+	for offset < total {
+		if offset+4 > total {
+			return nil, fmt.Errorf("truncated example #%d", len(offsets))
+		}
+		size := uint64(binary.LittleEndian.Uint32(mr.data[offset:]))
+		if offset+4+size > total {
+			return nil, fmt.Errorf("truncated example #%d", len(offsets))
+		}
+		offsets = append(offsets, offset)
+		offset += 4 + size
+	}
+	return
+}
+
+// loadIndex reads the offsets of the examples from the index file, and checks
+// that it matches the dataset: its size and modification time, and that every
+// example falls within it.
+func (mr *MappedExampleReader) loadIndex(indexPath string) (offsets []uint64, err error) {
+	contents, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(DATASET_INDEX_MAGIC) + 24
+	if len(contents) < headerLen || string(contents[:len(DATASET_INDEX_MAGIC)]) != DATASET_INDEX_MAGIC {
+		return nil, fmt.Errorf("invalid index file %q", indexPath)
+	}
+	header := contents[len(DATASET_INDEX_MAGIC):]
+	datasetSize := binary.LittleEndian.Uint64(header)
+	modTime := int64(binary.LittleEndian.Uint64(header[8:]))
+	count := binary.LittleEndian.Uint64(header[16:])
+	if datasetSize != uint64(len(mr.data)) || modTime != mr.modTime {
+		return nil, fmt.Errorf("index file %q is stale", indexPath)
+	}
+	if uint64(len(contents)-headerLen)/8 != count || uint64(len(contents)-headerLen)%8 != 0 {
+		return nil, fmt.Errorf("index file %q is truncated", indexPath)
+	}
+	offsets = make([]uint64, count)
+	if err = binary.Read(bytes.NewReader(contents[headerLen:]), binary.LittleEndian, offsets); err != nil {
+		return nil, err
+	}
+	for ii, offset := range offsets {
+		if _, err = mr.record(offset); err != nil {
+			return nil, fmt.Errorf("index file %q is corrupt, example #%d: %v", indexPath, ii, err)
+		}
+	}
+	return
+}
+
+// saveIndex writes the offsets of the examples to the index file.
+func (mr *MappedExampleReader) saveIndex(indexPath string) error {
+	var buf bytes.Buffer
+	buf.WriteString(DATASET_INDEX_MAGIC)
+	binary.Write(&buf, binary.LittleEndian, []uint64{uint64(len(mr.data)), uint64(mr.modTime), uint64(len(mr.offsets))})
+	binary.Write(&buf, binary.LittleEndian, mr.offsets)
+	return ioutil.WriteFile(indexPath, buf.Bytes(), 0644)
+}
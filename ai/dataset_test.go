@@ -0,0 +1,298 @@
+package ai_test
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+const oldFeaturesVersion = 39
+
+func writeDataset(t *testing.T, filePath string, version int, examples []ai.LabeledExample) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatalf("Failed to create %q: %v", filePath, err)
+	}
+	defer file.Close()
+	writer, err := ai.NewExampleWriter(file, version)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	for ii := range examples {
+		if err := writer.Write(&examples[ii]); err != nil {
+			t.Fatalf("Failed to write example #%d: %v", ii, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+}
+
+func readDataset(t *testing.T, filePath string) (version int, examples []ai.LabeledExample) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open %q: %v", filePath, err)
+	}
+	defer file.Close()
+	reader, err := ai.NewExampleReader(file)
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	for {
+		example, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read example #%d: %v", len(examples), err)
+		}
+		examples = append(examples, example)
+	}
+	return reader.FeaturesVersion, examples
+}
+
+func TestConvertDataset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_dataset")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var examples []ai.LabeledExample
+	for ii, b := range symmetryTestBoards() {
+		example := ai.MakeLabeledExample(b, float32(ii)-1, ai.AllFeaturesDim)
+		if ii == 2 {
+			example.ActionsFeatures = [][]float32{{1, 2, 3}, {4, 5, 6}}
+			example.ActionLabels = []float32{0.25, 0.75}
+		}
+		examples = append(examples, example)
+	}
+	original := path.Join(dir, "original")
+	writeDataset(t, original, ai.AllFeaturesDim, examples)
+
+	// Downgrade: features must match the ones generated for the older version.
+	downgraded := path.Join(dir, "downgraded")
+	if err := ai.ConvertDataset(original, downgraded, ai.AllFeaturesDim, oldFeaturesVersion); err != nil {
+		t.Fatalf("Failed to convert dataset: %v", err)
+	}
+	version, got := readDataset(t, downgraded)
+	if version != oldFeaturesVersion || len(got) != len(examples) {
+		t.Fatalf("Got version %d with %d examples, wanted version %d with %d examples",
+			version, len(got), oldFeaturesVersion, len(examples))
+	}
+	for ii, b := range symmetryTestBoards() {
+		if want := ai.FeatureVector(b, oldFeaturesVersion); !reflect.DeepEqual(got[ii].Features, want) {
+			t.Errorf("Example #%d: got features %v, wanted %v", ii, got[ii].Features, want)
+		}
+		if got[ii].Label != examples[ii].Label ||
+			!reflect.DeepEqual(got[ii].ActionsFeatures, examples[ii].ActionsFeatures) ||
+			!reflect.DeepEqual(got[ii].ActionLabels, examples[ii].ActionLabels) {
+			t.Errorf("Example #%d: labels or action data changed from %v to %v", ii, examples[ii], got[ii])
+		}
+	}
+
+	// Upgrading back: new features are zero-filled, old ones preserved.
+	upgraded := path.Join(dir, "upgraded")
+	if err := ai.ConvertDataset(downgraded, upgraded, oldFeaturesVersion, ai.AllFeaturesDim); err != nil {
+		t.Fatalf("Failed to convert dataset: %v", err)
+	}
+	_, got = readDataset(t, upgraded)
+	for ii := range got {
+		want := append([]float32{}, examples[ii].Features...)
+		for _, def := range ai.AllFeatures {
+			if def.Version > oldFeaturesVersion {
+				for jj := def.VecIndex; jj < def.VecIndex+def.Dim; jj++ {
+					want[jj] = 0
+				}
+			}
+		}
+		if !reflect.DeepEqual(got[ii].Features, want) {
+			t.Errorf("Example #%d: got features %v, wanted %v", ii, got[ii].Features, want)
+		}
+	}
+
+	// Wrong source version.
+	if err := ai.ConvertDataset(original, upgraded, oldFeaturesVersion, ai.AllFeaturesDim); err == nil {
+		t.Errorf("Expected error converting from the wrong version")
+	}
+}
+
+func TestMappedExampleReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_dataset")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var examples []ai.LabeledExample
+	for ii, b := range symmetryTestBoards() {
+		example := ai.MakeLabeledExample(b, float32(ii)-1, ai.AllFeaturesDim)
+		if ii == 1 {
+			example.ActionsFeatures = [][]float32{{1, 2, 3}, {4, 5, 6}}
+			example.ActionLabels = []float32{0.25, 0.75}
+		}
+		examples = append(examples, example)
+	}
+	filePath := path.Join(dir, "dataset")
+	writeDataset(t, filePath, ai.AllFeaturesDim, examples)
+	_, sequential := readDataset(t, filePath)
+
+	// Random access reads match the sequential ones, both when the index is built
+	// and when it's loaded.
+	for _, pass := range []string{"built index", "loaded index"} {
+		mr, err := ai.OpenMappedExamples(filePath)
+		if err != nil {
+			t.Fatalf("%s: failed to open dataset: %v", pass, err)
+		}
+		if mr.Len() != len(sequential) || mr.FeaturesVersion != ai.AllFeaturesDim {
+			t.Errorf("%s: got %d examples of version %d, wanted %d of version %d", pass, mr.Len(),
+				mr.FeaturesVersion, len(sequential), ai.AllFeaturesDim)
+		}
+		for _, idx := range rand.Perm(mr.Len()) {
+			example, err := mr.Example(idx)
+			if err != nil {
+				t.Fatalf("%s: failed to read example #%d: %v", pass, idx, err)
+			}
+			if !reflect.DeepEqual(example, sequential[idx]) {
+				t.Errorf("%s: example #%d is %v, wanted %v", pass, idx, example, sequential[idx])
+			}
+		}
+		if _, err = mr.Example(mr.Len()); err == nil {
+			t.Errorf("%s: expected error reading past the last example", pass)
+		}
+		if err = mr.Close(); err != nil {
+			t.Errorf("%s: failed to close: %v", pass, err)
+		}
+		if _, err = os.Stat(filePath + ".index"); err != nil {
+			t.Errorf("%s: index not saved: %v", pass, err)
+		}
+	}
+
+	// Reading from a closed dataset fails instead of panicking.
+	mr, err := ai.OpenMappedExamples(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open dataset: %v", err)
+	}
+	mr.Close()
+	if _, err = mr.Example(0); err == nil {
+		t.Errorf("Expected error reading from a closed dataset")
+	}
+
+	// A truncated or corrupt index is rebuilt.
+	index, err := ioutil.ReadFile(filePath + ".index")
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	corrupt := append([]byte(nil), index...)
+	binary.LittleEndian.PutUint64(corrupt[len(corrupt)-8:], 1<<40)
+	for name, contents := range map[string][]byte{"truncated": index[:len(index)-8], "corrupt": corrupt} {
+		if err = ioutil.WriteFile(filePath+".index", contents, 0644); err != nil {
+			t.Fatalf("Failed to write %s index: %v", name, err)
+		}
+		if mr, err = ai.OpenMappedExamples(filePath); err != nil {
+			t.Fatalf("Failed to open dataset with %s index: %v", name, err)
+		}
+		if mr.Len() != len(sequential) {
+			t.Errorf("Dataset with %s index has %d examples, wanted %d", name, mr.Len(), len(sequential))
+		}
+		for idx := 0; idx < mr.Len(); idx++ {
+			if _, err = mr.Example(idx); err != nil {
+				t.Errorf("Dataset with %s index: failed to read example #%d: %v", name, idx, err)
+			}
+		}
+		mr.Close()
+	}
+
+	// A stale index is rebuilt.
+	writeDataset(t, filePath, ai.AllFeaturesDim, examples[:2])
+	mr, err = ai.OpenMappedExamples(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open rewritten dataset: %v", err)
+	}
+	defer mr.Close()
+	if mr.Len() != 2 {
+		t.Errorf("Rewritten dataset has %d examples, wanted 2", mr.Len())
+	}
+}
+
+func TestSummarizeDataset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_dataset")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := symmetryTestBoards()[0]
+	var examples []ai.LabeledExample
+	// Non-finite labels are counted apart, and left out of the distribution.
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	for ii, label := range []float32{-10, -9.5, 0, 3, 10, nan, inf} {
+		example := ai.MakeLabeledExample(b, label, ai.AllFeaturesDim)
+		example.Outcome = ai.OUTCOME_WIN
+		if ii < 2 {
+			example.Outcome = ai.OUTCOME_LOSS
+			example.ActionsFeatures = [][]float32{{1, 2, 3}}
+			example.ActionLabels = []float32{1}
+		}
+		examples = append(examples, example)
+	}
+	filePath := path.Join(dir, "dataset")
+	writeDataset(t, filePath, ai.AllFeaturesDim, examples)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open %q: %v", filePath, err)
+	}
+	defer file.Close()
+	reader, err := ai.NewExampleReader(file)
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	numSeen := 0
+	summary, err := ai.SummarizeDataset(reader, func(idx int, example *ai.LabeledExample) {
+		if idx != numSeen || (example.Label != examples[idx].Label && !math.IsNaN(float64(example.Label))) {
+			t.Errorf("Example #%d given as #%d with label %g", numSeen, idx, example.Label)
+		}
+		numSeen++
+	})
+	if err != nil {
+		t.Fatalf("Failed to summarize dataset: %v", err)
+	}
+	want := ai.DatasetSummary{
+		FormatVersion: ai.DATASET_FORMAT_VERSION, FeaturesVersion: ai.AllFeaturesDim,
+		Count: 7, NumWithActions: 2,
+		LabelMin: -10, LabelMax: 10, LabelMean: -1.3,
+		LabelHistogram:     [ai.DATASET_SUMMARY_BINS]int{2, 0, 0, 0, 0, 1, 1, 0, 0, 1},
+		NumNonFiniteLabels: 2,
+	}
+	want.Outcomes[ai.OUTCOME_LOSS], want.Outcomes[ai.OUTCOME_WIN] = 2, 5
+	if summary != want || numSeen != 7 {
+		t.Errorf("Got summary %+v after %d examples, wanted %+v", summary, numSeen, want)
+	}
+
+	// Huge labels, whose bins would overflow an int, go to the first or last bin.
+	writeDataset(t, filePath, ai.AllFeaturesDim, []ai.LabeledExample{
+		ai.MakeLabeledExample(b, -1e30, ai.AllFeaturesDim), ai.MakeLabeledExample(b, 1e30, ai.AllFeaturesDim)})
+	hugeFile, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open %q: %v", filePath, err)
+	}
+	defer hugeFile.Close()
+	if reader, err = ai.NewExampleReader(hugeFile); err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	if summary, err = ai.SummarizeDataset(reader, nil); err != nil {
+		t.Fatalf("Failed to summarize dataset: %v", err)
+	}
+	if want := [ai.DATASET_SUMMARY_BINS]int{1, 0, 0, 0, 0, 0, 0, 0, 0, 1}; summary.LabelHistogram != want {
+		t.Errorf("Labels ±1e30 binned as %v, wanted %v", summary.LabelHistogram, want)
+	}
+}
@@ -0,0 +1,218 @@
+package ai
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+
+	"github.com/golang/glog"
+)
+
+// DeduplicateExamples reads the dataset in file `in` and writes to file `out` one
+// example per distinct board position, as identified by LabeledExample.BoardHash
+// (see Board.CanonicalHash). Duplicates are collapsed into the first one seen, with
+// the label set to the mean of their labels, and the action labels set to the mean
+// of their action labels. Action labels can only be averaged if the actions of the
+// duplicates can be matched through their ActionsFeatures, otherwise the duplicate
+// only contributes to the label. Examples with unknown BoardHash (0) are kept as is.
+//
+// To bound memory usage, if the dataset has more than maxExamplesInMemory examples,
+// it is first partitioned by hash into temporary files, each one deduplicated
+// separately. Use maxExamplesInMemory=0 for no limit.
+func DeduplicateExamples(in, out string, maxExamplesInMemory int) (numIn, numOut int, err error) {
+	version, numIn, err := countExamples(in)
+	if err != nil {
+		return
+	}
+
+	numPartitions := 1
+	if maxExamplesInMemory > 0 && numIn > maxExamplesInMemory {
+		numPartitions = (numIn + maxExamplesInMemory - 1) / maxExamplesInMemory
+	}
+	partitions := []string{in}
+	if numPartitions > 1 {
+		partitions, err = partitionExamples(in, numPartitions)
+		defer func() {
+			for _, partition := range partitions {
+				os.Remove(partition)
+			}
+		}()
+		if err != nil {
+			return
+		}
+	}
+
+	outFile, err := os.Create(out)
+	if err != nil {
+		err = fmt.Errorf("Failed to create dataset %q: %v", out, err)
+		return
+	}
+	defer outFile.Close()
+	writer, err := NewExampleWriter(outFile, version)
+	if err != nil {
+		return
+	}
+	for _, partition := range partitions {
+		var examples []LabeledExample
+		examples, err = dedupInMemory(partition)
+		if err != nil {
+			return
+		}
+		for ii := range examples {
+			if err = writer.Write(&examples[ii]); err != nil {
+				return
+			}
+		}
+		numOut += len(examples)
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+	err = outFile.Close()
+	glog.V(1).Infof("DeduplicateExamples(%q): %d examples reduced to %d", in, numIn, numOut)
+	return
+}
+
+// forEachExample calls fn for each example in the dataset.
+func forEachExample(filename string, fn func(reader *ExampleReader, example LabeledExample) error) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to open dataset %q: %v", filename, err)
+	}
+	defer file.Close()
+	reader, err := NewExampleReader(file)
+	if err != nil {
+		return fmt.Errorf("Dataset %q: %v", filename, err)
+	}
+	for count := 0; ; count++ {
+		example, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Dataset %q, example #%d: %v", filename, count, err)
+		}
+		if err = fn(reader, example); err != nil {
+			return err
+		}
+	}
+}
+
+func countExamples(filename string) (version, count int, err error) {
+	err = forEachExample(filename, func(reader *ExampleReader, _ LabeledExample) error {
+		version = reader.FeaturesVersion
+		count++
+		return nil
+	})
+	return
+}
+
+// partitionExamples splits the examples into temporary files according to their
+// BoardHash, so duplicates end up in the same file.
+func partitionExamples(filename string, numPartitions int) (partitions []string, err error) {
+	var files []*os.File
+	var writers []*ExampleWriter
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	err = forEachExample(filename, func(reader *ExampleReader, example LabeledExample) error {
+		if writers == nil {
+			for ii := 0; ii < numPartitions; ii++ {
+				file, err := ioutil.TempFile("", "hive_dedup")
+				if err != nil {
+					return fmt.Errorf("Failed to create temporary file: %v", err)
+				}
+				files = append(files, file)
+				partitions = append(partitions, file.Name())
+				writer, err := NewExampleWriter(file, reader.FeaturesVersion)
+				if err != nil {
+					return err
+				}
+				writers = append(writers, writer)
+			}
+		}
+		return writers[example.BoardHash%uint64(numPartitions)].Write(&example)
+	})
+	for _, writer := range writers {
+		if flushErr := writer.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+	return
+}
+
+// dedupEntry accumulates the duplicates of one board position.
+type dedupEntry struct {
+	example                  LabeledExample
+	count, actionLabelsCount int
+}
+
+func dedupInMemory(filename string) (examples []LabeledExample, err error) {
+	var entries []*dedupEntry
+	hashToEntry := make(map[uint64]*dedupEntry)
+	err = forEachExample(filename, func(_ *ExampleReader, example LabeledExample) error {
+		entry, found := hashToEntry[example.BoardHash]
+		if !found || example.BoardHash == 0 {
+			entry = &dedupEntry{example: example, count: 1, actionLabelsCount: 1}
+			entries = append(entries, entry)
+			if example.BoardHash != 0 {
+				hashToEntry[example.BoardHash] = entry
+			}
+			return nil
+		}
+		entry.count++
+		entry.example.Label += example.Label
+		if len(entry.example.ActionLabels) > 0 {
+			if perm := alignActions(entry.example.ActionsFeatures, example.ActionsFeatures); perm != nil &&
+				len(example.ActionLabels) == len(perm) {
+				entry.actionLabelsCount++
+				for ii, jj := range perm {
+					entry.example.ActionLabels[ii] += example.ActionLabels[jj]
+				}
+			} else {
+				glog.V(2).Infof("Can't match actions of duplicate board, hash=%x", example.BoardHash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	examples = make([]LabeledExample, len(entries))
+	for ii, entry := range entries {
+		examples[ii] = entry.example
+		examples[ii].Label /= float32(entry.count)
+		for jj := range examples[ii].ActionLabels {
+			examples[ii].ActionLabels[jj] /= float32(entry.actionLabelsCount)
+		}
+	}
+	return
+}
+
+// alignActions returns perm such that actions2[perm[ii]] has the same features as
+// actions1[ii], or nil if that is not possible.
+func alignActions(actions1, actions2 [][]float32) (perm []int) {
+	if len(actions1) == 0 || len(actions1) != len(actions2) {
+		return nil
+	}
+	perm = make([]int, len(actions1))
+	used := make([]bool, len(actions2))
+	for ii, features := range actions1 {
+		perm[ii] = -1
+		for jj, features2 := range actions2 {
+			if !used[jj] && reflect.DeepEqual(features, features2) {
+				perm[ii] = jj
+				used[jj] = true
+				break
+			}
+		}
+		if perm[ii] < 0 {
+			return nil
+		}
+	}
+	return
+}
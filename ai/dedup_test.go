@@ -0,0 +1,67 @@
+package ai_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+func TestDeduplicateExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_dedup_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	boards := symmetryTestBoards()
+	board := boards[2]
+	actionsFeatures := [][]float32{{1, 0}, {0, 1}, {1, 1}}
+	examples := []ai.LabeledExample{
+		ai.MakeLabeledExample(board, 1, ai.AllFeaturesDim),
+		ai.MakeLabeledExample(boards[1], 0.5, ai.AllFeaturesDim),
+		// Same position rotated, with conflicting labels and actions in a different order.
+		ai.MakeLabeledExample(board.Rotate(2), -0.5, ai.AllFeaturesDim),
+		ai.MakeLabeledExample(board.Mirror(), 0, ai.AllFeaturesDim),
+	}
+	examples[0].ActionsFeatures = actionsFeatures
+	examples[0].ActionLabels = []float32{1, 0, 0}
+	examples[2].ActionsFeatures = [][]float32{actionsFeatures[2], actionsFeatures[0], actionsFeatures[1]}
+	examples[2].ActionLabels = []float32{1, 0, 0}
+	examples[3].ActionsFeatures = actionsFeatures
+	examples[3].ActionLabels = []float32{0, 0, 1}
+	in := path.Join(dir, "in")
+	writeDataset(t, in, ai.AllFeaturesDim, examples)
+
+	for _, maxInMemory := range []int{0, 1} {
+		out := path.Join(dir, "out")
+		numIn, numOut, err := ai.DeduplicateExamples(in, out, maxInMemory)
+		if err != nil {
+			t.Fatalf("DeduplicateExamples failed: %v", err)
+		}
+		if numIn != 4 || numOut != 2 {
+			t.Errorf("maxInMemory=%d: got %d->%d examples, wanted 4->2", maxInMemory, numIn, numOut)
+		}
+		_, got := readDataset(t, out)
+		byHash := make(map[uint64]ai.LabeledExample)
+		for _, example := range got {
+			byHash[example.BoardHash] = example
+		}
+		merged, found := byHash[board.CanonicalHash()]
+		if !found {
+			t.Fatalf("maxInMemory=%d: merged example missing", maxInMemory)
+		}
+		if merged.Label != 0.5/3 {
+			t.Errorf("maxInMemory=%d: got merged label %g, wanted %g", maxInMemory, merged.Label, 0.5/3)
+		}
+		if want := []float32{float32(1) / 3, 0, float32(2) / 3}; !reflect.DeepEqual(merged.ActionLabels, want) {
+			t.Errorf("maxInMemory=%d: got merged action labels %v, wanted %v", maxInMemory, merged.ActionLabels, want)
+		}
+		if single := byHash[boards[1].CanonicalHash()]; single.Label != 0.5 {
+			t.Errorf("maxInMemory=%d: unique example label changed to %g", maxInMemory, single.Label)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package distributed implements distributed self-play: a Coordinator hands out
+// game tasks to workers, possibly in other machines, and collects the games they
+// play, to be used for training.
+//
+// Coordinator and workers communicate over the standard library's net/rpc, see
+// RegisterCoordinator and Worker.
+package distributed
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+// COORDINATOR_SERVICE_NAME is the name under which the Coordinator is registered.
+const COORDINATOR_SERVICE_NAME = "hive.Coordinator"
+
+// Task is a game to be played by a worker.
+type Task struct {
+	Id int
+
+	// ModelPath is the latest model to use, and PlayerConfig the configuration of
+	// the AI (see players.NewAIPlayer), without the model.
+	ModelPath, PlayerConfig string
+
+	// MaxMoves of the board, and the self-play cap (see ai.SelfPlayCapReached).
+	MaxMoves, SelfPlayMaxMoves int
+
+	// NoQueenFirstMove rule of the board, see Board.NoQueenFirstMove.
+	NoQueenFirstMove bool
+
+	// Done is set when there are no more tasks, and the worker should stop.
+	Done bool
+}
+
+// TaskRequest is the request of Coordinator.GetTask.
+type TaskRequest struct {
+	WorkerId string
+}
+
+// RecordRequest is the request of Coordinator.PushRecord.
+type RecordRequest struct {
+	WorkerId string
+	TaskId   int
+
+	// Record is the game played, a CompactGameRecord encoded with gob.
+	Record []byte
+}
+
+// RecordResponse is the response of Coordinator.PushRecord.
+type RecordResponse struct{}
+
+// assignment of a task to a worker.
+type assignment struct {
+	workerId string
+	deadline time.Time
+}
+
+// Coordinator hands out tasks to play a fixed number of games, and collects the
+// records of the games played. Tasks not finished within TaskTimeout (e.g. the
+// worker died) are re-queued to be handed out again.
+type Coordinator struct {
+	// TaskTimeout is the time a worker has to finish a task before it is re-queued.
+	TaskTimeout time.Duration
+
+	PlayerConfig               string
+	MaxMoves, SelfPlayMaxMoves int
+	NoQueenFirstMove           bool
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	modelPath string
+	pending   []int
+	assigned  map[int]assignment
+	records   map[int]ai.GameRecord
+	numGames  int
+}
+
+// NewCoordinator creates a Coordinator for numGames games, played with the
+// model at modelPath.
+func NewCoordinator(numGames int, modelPath string) *Coordinator {
+	c := &Coordinator{
+		TaskTimeout: 10 * time.Minute,
+		MaxMoves:    100,
+		modelPath:   modelPath,
+		pending:     make([]int, numGames),
+		assigned:    make(map[int]assignment),
+		records:     make(map[int]ai.GameRecord),
+		numGames:    numGames,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	for ii := range c.pending {
+		c.pending[ii] = ii
+	}
+	return c
+}
+
+// coordinatorService exposes only the RPC methods of the Coordinator.
+type coordinatorService struct {
+	c *Coordinator
+}
+
+func (s *coordinatorService) GetTask(req *TaskRequest, task *Task) error {
+	return s.c.GetTask(req, task)
+}
+
+func (s *coordinatorService) PushRecord(req *RecordRequest, resp *RecordResponse) error {
+	return s.c.PushRecord(req, resp)
+}
+
+// RegisterCoordinator registers the Coordinator in the RPC server.
+func RegisterCoordinator(server *rpc.Server, c *Coordinator) error {
+	return server.RegisterName(COORDINATOR_SERVICE_NAME, &coordinatorService{c})
+}
+
+// SetModelPath sets the model to be used by the tasks handed out from now on,
+// e.g. after the learner saves a new version.
+func (c *Coordinator) SetModelPath(modelPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.modelPath = modelPath
+}
+
+// requeueExpired re-queues the tasks whose deadline expired. Must be called with
+// the lock held.
+func (c *Coordinator) requeueExpired() {
+	now := time.Now()
+	for id, a := range c.assigned {
+		if now.After(a.deadline) {
+			glog.Warningf("Task %d assigned to worker %s timed out, re-queuing it", id, a.workerId)
+			delete(c.assigned, id)
+			c.pending = append(c.pending, id)
+		}
+	}
+}
+
+// GetTask hands out the next task. If there are no tasks pending, but not all
+// games are finished, it waits until a task is re-queued or all games finish.
+func (c *Coordinator) GetTask(req *TaskRequest, task *Task) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.requeueExpired()
+		if len(c.records) == c.numGames {
+			task.Done = true
+			return nil
+		}
+		if len(c.pending) > 0 {
+			break
+		}
+		// Wake up when a task is finished, or when the earliest deadline expires.
+		var earliest time.Time
+		for _, a := range c.assigned {
+			if earliest.IsZero() || a.deadline.Before(earliest) {
+				earliest = a.deadline
+			}
+		}
+		timer := time.AfterFunc(time.Until(earliest), func() {
+			c.mu.Lock()
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		})
+		c.cond.Wait()
+		timer.Stop()
+	}
+	id := c.pending[0]
+	c.pending = c.pending[1:]
+	c.assigned[id] = assignment{req.WorkerId, time.Now().Add(c.TaskTimeout)}
+	*task = Task{Id: id, ModelPath: c.modelPath, PlayerConfig: c.PlayerConfig,
+		MaxMoves: c.MaxMoves, SelfPlayMaxMoves: c.SelfPlayMaxMoves, NoQueenFirstMove: c.NoQueenFirstMove}
+	glog.V(1).Infof("Task %d assigned to worker %s", id, req.WorkerId)
+	return nil
+}
+
+// PushRecord receives the record of the game played for a task.
+func (c *Coordinator) PushRecord(req *RecordRequest, _ *RecordResponse) error {
+	compact, err := ai.DecodeCompactGameRecord(gob.NewDecoder(bytes.NewReader(req.Record)))
+	if err != nil {
+		return fmt.Errorf("Failed to decode record of task %d from worker %s: %v", req.TaskId, req.WorkerId, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if req.TaskId < 0 || req.TaskId >= c.numGames {
+		return fmt.Errorf("Unknown task %d from worker %s", req.TaskId, req.WorkerId)
+	}
+	if _, found := c.records[req.TaskId]; found {
+		// Task was re-queued, and finished by more than one worker.
+		glog.V(1).Infof("Discarding duplicate record of task %d from worker %s", req.TaskId, req.WorkerId)
+		return nil
+	}
+	c.records[req.TaskId] = compact.Expand()
+	delete(c.assigned, req.TaskId)
+	for ii, id := range c.pending {
+		if id == req.TaskId {
+			c.pending = append(c.pending[:ii], c.pending[ii+1:]...)
+			break
+		}
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// Wait waits until all games are played, and returns their records, in the order
+// of the tasks.
+func (c *Coordinator) Wait() []ai.GameRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.records) < c.numGames {
+		c.cond.Wait()
+	}
+	records := make([]ai.GameRecord, c.numGames)
+	for id, record := range c.records {
+		records[id] = record
+	}
+	return records
+}
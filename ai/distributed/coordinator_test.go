@@ -0,0 +1,79 @@
+package distributed_test
+
+import (
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/hiveGo/ai/distributed"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// connect returns a client connected in-process to the server.
+func connect(server *rpc.Server) *rpc.Client {
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	return rpc.NewClient(clientConn)
+}
+
+func TestCoordinator(t *testing.T) {
+	const numGames, selfPlayMaxMoves, model = 4, 10, "modelA"
+	c := distributed.NewCoordinator(numGames, model)
+	c.TaskTimeout = 200 * time.Millisecond
+	c.SelfPlayMaxMoves = selfPlayMaxMoves
+	c.NoQueenFirstMove = true
+	server := rpc.NewServer()
+	if err := distributed.RegisterCoordinator(server, c); err != nil {
+		t.Fatalf("Failed to register coordinator: %v", err)
+	}
+
+	// A worker that dies after taking a task: the task must be re-queued.
+	dead := connect(server)
+	var task distributed.Task
+	if err := dead.Call(distributed.COORDINATOR_SERVICE_NAME+".GetTask", &distributed.TaskRequest{WorkerId: "dead"}, &task); err != nil {
+		t.Fatalf("Failed to get task: %v", err)
+	}
+	dead.Close()
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"w0", "w1"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			client := connect(server)
+			defer client.Close()
+			w := &distributed.Worker{Id: id, Client: client,
+				NewPlayer: func(modelPath, config string) players.Player {
+					if modelPath != model {
+						t.Errorf("Worker %s got model %q, wanted %q", id, modelPath, model)
+					}
+					return players.NewAIPlayer("ab,max_depth=1", false)
+				}}
+			if err := w.Run(); err != nil {
+				t.Errorf("Worker %s failed: %v", id, err)
+			}
+		}(id)
+	}
+	records := c.Wait()
+	wg.Wait()
+
+	if len(records) != numGames {
+		t.Fatalf("Got %d records, wanted %d", len(records), numGames)
+	}
+	for ii, record := range records {
+		if len(record.Boards) == 0 || len(record.Actions) > selfPlayMaxMoves {
+			t.Errorf("Task %d: got %d boards and %d actions", ii, len(record.Boards), len(record.Actions))
+		}
+		if !record.Boards[0].NoQueenFirstMove {
+			t.Errorf("Task %d: game played without the NoQueenFirstMove rule", ii)
+		}
+		for jj, action := range record.Actions {
+			if jj < NUM_PLAYERS && action.Piece == QUEEN {
+				t.Errorf("Task %d: player %d placed the queen first, with the NoQueenFirstMove rule", ii, jj)
+			}
+		}
+	}
+}
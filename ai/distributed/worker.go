@@ -0,0 +1,82 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/rpc"
+
+	"github.com/golang/glog"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// Worker pulls tasks from a Coordinator, plays the games and pushes back their
+// records, until there are no more tasks.
+type Worker struct {
+	Id     string
+	Client *rpc.Client
+
+	// NewPlayer creates the player for the given model and configuration. If nil,
+	// players.NewAIPlayer is used, with the model added to the configuration.
+	NewPlayer func(modelPath, config string) players.Player
+
+	// Player is reused while the model and configuration don't change.
+	player                  players.Player
+	playerModel, playerConf string
+}
+
+// getPlayer returns the player for the task, creating a new one if the model
+// changed.
+func (w *Worker) getPlayer(task *Task) players.Player {
+	if w.player != nil && w.playerModel == task.ModelPath && w.playerConf == task.PlayerConfig {
+		return w.player
+	}
+	if w.NewPlayer != nil {
+		w.player = w.NewPlayer(task.ModelPath, task.PlayerConfig)
+	} else {
+		config := task.PlayerConfig
+		if task.ModelPath != "" {
+			if config != "" {
+				config += ","
+			}
+			config += "model=" + task.ModelPath
+		}
+		w.player = players.NewAIPlayer(config, true)
+	}
+	w.playerModel, w.playerConf = task.ModelPath, task.PlayerConfig
+	return w.player
+}
+
+// Run plays the tasks handed out by the coordinator, until it says it's done or
+// there is an error.
+func (w *Worker) Run() error {
+	for {
+		var task Task
+		if err := w.Client.Call(COORDINATOR_SERVICE_NAME+".GetTask", &TaskRequest{w.Id}, &task); err != nil {
+			return fmt.Errorf("Worker %s failed to get task: %v", w.Id, err)
+		}
+		if task.Done {
+			return nil
+		}
+		player := w.getPlayer(&task)
+		board := NewBoard()
+		board.MaxMoves = task.MaxMoves
+		if task.NoQueenFirstMove {
+			board.NoQueenFirstMove = true
+			board.BuildDerived()
+		}
+		game, _ := players.SelfPlay(board, [NUM_PLAYERS]players.Player{player, player}, task.SelfPlayMaxMoves, nil, nil, nil)
+		glog.V(1).Infof("Worker %s finished task %d in %d moves", w.Id, task.Id, len(game.Actions))
+
+		var buf bytes.Buffer
+		compact := game.Compact()
+		if err := compact.Encode(gob.NewEncoder(&buf)); err != nil {
+			return fmt.Errorf("Worker %s failed to encode game of task %d: %v", w.Id, task.Id, err)
+		}
+		req := &RecordRequest{WorkerId: w.Id, TaskId: task.Id, Record: buf.Bytes()}
+		if err := w.Client.Call(COORDINATOR_SERVICE_NAME+".PushRecord", req, &RecordResponse{}); err != nil {
+			return fmt.Errorf("Worker %s failed to push game of task %d: %v", w.Id, task.Id, err)
+		}
+	}
+}
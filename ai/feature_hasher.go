@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"hash/fnv"
+	"log"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// FeatureHasher maps named sparse features into a fixed number of buckets (the
+// "hashing trick"), appended to the dense features. It allows experimenting with
+// new features without growing AllFeatures: only the models with the version
+// of the hasher (see FeatureHasher.Version) use it.
+//
+// Keys that hash to the same bucket have their values summed.
+type FeatureHasher struct {
+	// BaseVersion is the version of the dense features the hashed features are
+	// appended to, see FeatureVersions. It's fixed, so the version of the hashed
+	// models doesn't change when dense features are added.
+	BaseVersion int
+
+	// NumBuckets is the width of the hashed features.
+	NumBuckets int
+
+	// Extractor returns the sparse features of the board, by name. Features
+	// missing are 0.
+	Extractor func(b *Board) map[string]float32
+}
+
+// featureHasher is the registered FeatureHasher, or nil.
+var featureHasher *FeatureHasher
+
+// RegisterFeatureHasher sets the FeatureHasher used by FeatureVector, or
+// disables it if h is nil. It should be called during initialization, before
+// any features are built. It panics if the version of the hasher is also the
+// version of dense features, since FeatureVector couldn't tell them apart: a
+// different number of buckets must be used.
+func RegisterFeatureHasher(h *FeatureHasher) {
+	if h != nil {
+		if h.NumBuckets <= 0 {
+			log.Panicf("FeatureHasher needs a positive number of buckets, got %d", h.NumBuckets)
+		}
+		versions := FeatureVersions()
+		if !intInSlice(versions, h.BaseVersion) {
+			log.Panicf("FeatureHasher base version %d is not one of the features versions %v",
+				h.BaseVersion, versions)
+		}
+		if intInSlice(versions, h.Version()) {
+			log.Panicf("FeatureHasher version %d (base version %d + %d buckets) is also a version of "+
+				"the dense features", h.Version(), h.BaseVersion, h.NumBuckets)
+		}
+	}
+	featureHasher = h
+}
+
+// Version returns the version (number of features) of the models that use the
+// hashed features: the dense features of BaseVersion followed by the buckets.
+func (h *FeatureHasher) Version() int {
+	return h.BaseVersion + h.NumBuckets
+}
+
+// Bucket returns the bucket for the given key: FNV-1a hash of the key, modulo
+// NumBuckets. It is deterministic across runs and platforms.
+func (h *FeatureHasher) Bucket(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(h.NumBuckets))
+}
+
+// Hash maps the sparse features into a vector of NumBuckets, summing the values
+// of the keys that collide.
+func (h *FeatureHasher) Hash(features map[string]float32) (buckets []float32) {
+	buckets = make([]float32, h.NumBuckets)
+	for key, value := range features {
+		buckets[h.Bucket(key)] += value
+	}
+	return
+}
+
+// denseVersion returns the version of the dense features of models of the given
+// version: the BaseVersion of the registered FeatureHasher if it's its version,
+// or version itself otherwise.
+func denseVersion(version int) int {
+	if featureHasher != nil && version == featureHasher.Version() {
+		return featureHasher.BaseVersion
+	}
+	return version
+}
+
+// hashedFeatures returns the hashed features of the board, to be appended to
+// the dense features, if the registered FeatureHasher is used by models of the
+// given version. Otherwise it returns nil.
+func hashedFeatures(b *Board, version int) []float32 {
+	if featureHasher == nil || version != featureHasher.Version() {
+		return nil
+	}
+	return featureHasher.Hash(featureHasher.Extractor(b))
+}
@@ -0,0 +1,86 @@
+package ai_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestFeatureHasher(t *testing.T) {
+	h := &ai.FeatureHasher{NumBuckets: 8}
+	other := &ai.FeatureHasher{NumBuckets: 8}
+
+	// Same keys always map to the same buckets.
+	buckets := make(map[int][]string)
+	for ii := 0; ii < 20; ii++ {
+		key := fmt.Sprintf("feature_%d", ii)
+		bucket := h.Bucket(key)
+		if bucket < 0 || bucket >= h.NumBuckets || bucket != h.Bucket(key) || bucket != other.Bucket(key) {
+			t.Errorf("Key %q mapped to bucket %d, then %d, and %d by another hasher",
+				key, bucket, h.Bucket(key), other.Bucket(key))
+		}
+		buckets[bucket] = append(buckets[bucket], key)
+	}
+
+	// 20 keys in 8 buckets collide: their values are summed.
+	for bucket, keys := range buckets {
+		if len(keys) < 2 {
+			continue
+		}
+		hashed := h.Hash(map[string]float32{keys[0]: 1, keys[1]: 2})
+		want := make([]float32, h.NumBuckets)
+		want[bucket] = 3
+		if !reflect.DeepEqual(hashed, want) {
+			t.Errorf("Keys %q and %q collide in bucket %d: got %v, wanted %v", keys[0], keys[1], bucket, hashed, want)
+		}
+		break
+	}
+}
+
+func TestFeatureVectorHashed(t *testing.T) {
+	h := &ai.FeatureHasher{BaseVersion: ai.AllFeaturesDim, NumBuckets: 4,
+		Extractor: func(b *Board) map[string]float32 {
+			return map[string]float32{"move_number": float32(b.MoveNumber)}
+		}}
+	ai.RegisterFeatureHasher(h)
+	defer ai.RegisterFeatureHasher(nil)
+
+	b := NewBoard()
+	b.MoveNumber = 7
+	f := ai.FeatureVector(b, h.Version())
+	if len(f) != ai.AllFeaturesDim+h.NumBuckets {
+		t.Fatalf("Got %d features, wanted %d dense + %d hashed", len(f), ai.AllFeaturesDim, h.NumBuckets)
+	}
+	if hashed := f[ai.AllFeaturesDim:]; hashed[h.Bucket("move_number")] != 7 {
+		t.Errorf("Hashed features %v should have 7 in bucket %d", hashed, h.Bucket("move_number"))
+	}
+
+	// Other versions don't include the hashed features.
+	if f = ai.FeatureVector(b, ai.AllFeaturesDim); len(f) != ai.AllFeaturesDim {
+		t.Errorf("Got %d features for version %d", len(f), ai.AllFeaturesDim)
+	}
+
+	// Hashed features appended to an older version of the dense features.
+	base := ai.FeatureVersions()[0]
+	old := &ai.FeatureHasher{BaseVersion: base, NumBuckets: 1, Extractor: h.Extractor}
+	ai.RegisterFeatureHasher(old)
+	f = ai.FeatureVector(b, old.Version())
+	if want := append(ai.FeatureVector(b, base), 7); !reflect.DeepEqual(f, want) {
+		t.Errorf("Got features %v for base version %d, wanted %v", f, base, want)
+	}
+}
+
+func TestRegisterFeatureHasherVersionCollision(t *testing.T) {
+	defer ai.RegisterFeatureHasher(nil)
+	versions := ai.FeatureVersions()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Registering a FeatureHasher with the version of dense features should panic")
+		}
+	}()
+	// The version of the hasher is the next version of the dense features.
+	ai.RegisterFeatureHasher(&ai.FeatureHasher{BaseVersion: versions[0], NumBuckets: versions[1] - versions[0]})
+}
@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// FeatureSet is a subset of AllFeatures used by a model, to experiment with
+// fewer features without changing AllFeatures. It applies on top of the version
+// of the features: only the features of the set that exist in the version are
+// used, in the order of AllFeatures. See FeatureVectorSubset.
+//
+// A nil FeatureSet uses all features. It is encoded in JSON as the list of the
+// names of its features, so it can be recorded with the model.
+type FeatureSet []FeatureId
+
+// NewFeatureSet returns the FeatureSet with the given features, sorted and
+// without repetitions.
+func NewFeatureSet(ids ...FeatureId) FeatureSet {
+	fs := make(FeatureSet, 0, len(ids))
+	for _, id := range ids {
+		if id < 0 || id >= F_NUM_FEATURES {
+			continue
+		}
+		if !fs.Enabled(id) {
+			fs = append(fs, id)
+		}
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i] < fs[j] })
+	return fs
+}
+
+// featureIdByName returns the FeatureId with the given name in AllFeatures.
+func featureIdByName(name string) (FeatureId, error) {
+	for ii := range AllFeatures {
+		if AllFeatures[ii].Name == name {
+			return AllFeatures[ii].FId, nil
+		}
+	}
+	return F_NUM_FEATURES, fmt.Errorf("Unknown feature %q", name)
+}
+
+// ParseFeatureSet parses a comma-separated list of names of AllFeatures, e.g.
+// "NumOffboard,OppNumOffboard". If the names are prefixed by "-" the features
+// are disabled instead, starting from all of them, e.g. "-MovesToDraw". An empty
+// spec returns nil, that is, all features.
+func ParseFeatureSet(spec string) (FeatureSet, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	names := strings.Split(spec, ",")
+	disable := strings.HasPrefix(names[0], "-")
+	selected := make(map[FeatureId]bool)
+	for _, name := range names {
+		if strings.HasPrefix(name, "-") != disable {
+			return nil, fmt.Errorf("Failed to parse feature set %q: can't mix enabled and disabled features", spec)
+		}
+		id, err := featureIdByName(strings.TrimPrefix(name, "-"))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse feature set %q: %v", spec, err)
+		}
+		selected[id] = true
+	}
+	ids := make([]FeatureId, 0, len(AllFeatures))
+	for ii := range AllFeatures {
+		if selected[AllFeatures[ii].FId] != disable {
+			ids = append(ids, AllFeatures[ii].FId)
+		}
+	}
+	return NewFeatureSet(ids...), nil
+}
+
+// Enabled returns whether the feature is in the set.
+func (fs FeatureSet) Enabled(id FeatureId) bool {
+	if fs == nil {
+		return true
+	}
+	for _, setId := range fs {
+		if setId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Dim returns the dimension of FeatureVectorSubset for the given version.
+func (fs FeatureSet) Dim(version int) int {
+	dim := version
+	dense := denseVersion(version)
+	for ii := range AllFeatures {
+		featDef := &AllFeatures[ii]
+		if featDef.Version <= dense && !fs.Enabled(featDef.FId) {
+			dim -= featDef.Dim
+		}
+	}
+	return dim
+}
+
+// Names returns the names of the features in the set, or nil for all features.
+func (fs FeatureSet) Names() []string {
+	if fs == nil {
+		return nil
+	}
+	names := make([]string, len(fs))
+	for ii, id := range fs {
+		names[ii] = AllFeatures[id].Name
+	}
+	return names
+}
+
+func (fs FeatureSet) String() string {
+	if fs == nil {
+		return "all"
+	}
+	return strings.Join(fs.Names(), ",")
+}
+
+// MarshalJSON encodes the set as the list of the names of its features.
+func (fs FeatureSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fs.Names())
+}
+
+// UnmarshalJSON decodes the list of the names of the features, see MarshalJSON.
+func (fs *FeatureSet) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	if names == nil {
+		*fs = nil
+		return nil
+	}
+	ids := make([]FeatureId, len(names))
+	for ii, name := range names {
+		id, err := featureIdByName(name)
+		if err != nil {
+			return fmt.Errorf("Failed to decode feature set: %v", err)
+		}
+		ids[ii] = id
+	}
+	*fs = NewFeatureSet(ids...)
+	return nil
+}
+
+// FeatureVectorSubset is like FeatureVector, but it only includes the features
+// of fs, so its dimension is fs.Dim(version). The hashed features, for the
+// version of the registered FeatureHasher, are always included. If fs is nil it
+// is the same as FeatureVector.
+func FeatureVectorSubset(b *Board, version int, fs FeatureSet) []float32 {
+	f := FeatureVector(b, version)
+	if fs == nil {
+		return f
+	}
+	subset := make([]float32, 0, fs.Dim(version))
+	dense := denseVersion(version)
+	idx := 0
+	for ii := range AllFeatures {
+		featDef := &AllFeatures[ii]
+		if featDef.Version > dense {
+			continue
+		}
+		if fs.Enabled(featDef.FId) {
+			subset = append(subset, f[idx:idx+featDef.Dim]...)
+		}
+		idx += featDef.Dim
+	}
+	return append(subset, f[idx:]...)
+}
@@ -0,0 +1,112 @@
+package ai_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestFeatureSet(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	board := NewBoard()
+	for ii := 0; ii < 12 && !board.IsFinished(); ii++ {
+		board = board.Act(board.Derived.Actions[rng.Intn(len(board.Derived.Actions))])
+	}
+
+	// Disable a feature in the middle of the vector.
+	fs, err := ai.ParseFeatureSet("-MovesToDraw")
+	if err != nil {
+		t.Fatalf("Failed to parse feature set: %v", err)
+	}
+	if fs.Enabled(ai.F_MOVES_TO_DRAW) || !fs.Enabled(ai.F_NUM_SINGLE) {
+		t.Errorf("Feature set %s should only disable MovesToDraw", fs)
+	}
+	for _, version := range []int{41, ai.AllFeaturesDim} {
+		full := ai.FeatureVector(board, version)
+		subset := ai.FeatureVectorSubset(board, version, fs)
+		if len(subset) != version-1 || fs.Dim(version) != version-1 {
+			t.Fatalf("Version %d: got %d features (Dim()=%d), wanted %d", version, len(subset),
+				fs.Dim(version), version-1)
+		}
+		idx := ai.AllFeatures[ai.F_MOVES_TO_DRAW].VecIndex
+		want := append(append([]float32(nil), full[:idx]...), full[idx+1:]...)
+		if !reflect.DeepEqual(subset, want) {
+			t.Errorf("Version %d: got features %v, wanted %v", version, subset, want)
+		}
+	}
+	if got := ai.FeatureVectorSubset(board, ai.AllFeaturesDim, nil); !reflect.DeepEqual(got,
+		ai.FeatureVector(board, ai.AllFeaturesDim)) {
+		t.Errorf("nil feature set should use all features")
+	}
+
+	// JSON round-trip, as in the checkpoint metadata.
+	data, err := json.Marshal(fs)
+	if err != nil {
+		t.Fatalf("Failed to encode feature set: %v", err)
+	}
+	if strings.Contains(string(data), "MovesToDraw") || !strings.Contains(string(data), `"NumSingle"`) {
+		t.Errorf("Unexpected encoding of feature set: %s", data)
+	}
+	var decoded ai.FeatureSet
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode feature set: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, fs) {
+		t.Errorf("Decoded feature set %s, wanted %s", decoded, fs)
+	}
+
+	// Round-trip of a PureGoScorer using the subset.
+	mlp := newReferenceMLP(rng, fs.Dim(ai.AllFeaturesDim), []int{8, 4})
+	pure := mlp.toPureGo(ai.AllFeaturesDim)
+	pure.Features = fs
+	if err = pure.Validate(); err != nil {
+		t.Fatalf("Invalid PureGoScorer: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "hive_feature_set_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "model.gob")
+	if err = pure.SaveFile(file); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded, err := ai.LoadPureGoScorer(file)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Features, fs) {
+		t.Errorf("Loaded features %s, wanted %s", loaded.Features, fs)
+	}
+	want := ai.SigmoidTo10(float32(mlp.eval(ai.FeatureVectorSubset(board, ai.AllFeaturesDim, fs))))
+	if got, _ := loaded.Score(board); math.Abs(float64(got-want)) > 1e-4 {
+		t.Errorf("Loaded scorer got %g, wanted %g", got, want)
+	}
+}
+
+func TestParseFeatureSet(t *testing.T) {
+	fs, err := ai.ParseFeatureSet("NumSingle,NumOffboard")
+	if err != nil {
+		t.Fatalf("Failed to parse feature set: %v", err)
+	}
+	if want := (ai.FeatureSet{ai.F_NUM_OFFBOARD, ai.F_NUM_SINGLE}); !reflect.DeepEqual(fs, want) {
+		t.Errorf("Got feature set %v, wanted %v", fs, want)
+	}
+	if fs, err = ai.ParseFeatureSet(""); err != nil || fs != nil {
+		t.Errorf("Empty feature set should be nil, got %v (%v)", fs, err)
+	}
+	for _, spec := range []string{"NoSuchFeature", "NumSingle,-NumOffboard"} {
+		if _, err = ai.ParseFeatureSet(spec); err == nil {
+			t.Errorf("ParseFeatureSet(%q) should have failed", spec)
+		}
+	}
+}
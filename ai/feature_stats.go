@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"log"
+	"math"
+)
+
+// MIN_FEATURE_SCALE is the smallest scale of FeatureStats: features that (almost)
+// don't vary in the dataset are only centered, not scaled.
+const MIN_FEATURE_SCALE = 1e-6
+
+// FeatureStats holds the mean and scale (standard deviation) of each feature,
+// fitted from a dataset, to normalize the features to (f - Mean) / Scale. The
+// features have very different ranges (e.g. counts of pieces vs moves to draw),
+// and models train better with normalized inputs.
+//
+// A nil FeatureStats disables the normalization.
+type FeatureStats struct {
+	Mean  []float32 `json:"mean"`
+	Scale []float32 `json:"scale"`
+}
+
+// FitFeatureStats returns the FeatureStats of the given features, all of the same
+// version (dimension).
+func FitFeatureStats(features [][]float32) *FeatureStats {
+	if len(features) == 0 {
+		log.Panicf("No features to fit FeatureStats")
+	}
+	dim := len(features[0])
+	sum := make([]float64, dim)
+	sumSq := make([]float64, dim)
+	for _, f := range features {
+		if len(f) != dim {
+			log.Panicf("Features of different dimensions (%d and %d) to fit FeatureStats", dim, len(f))
+		}
+		for ii, value := range f {
+			sum[ii] += float64(value)
+			sumSq[ii] += float64(value) * float64(value)
+		}
+	}
+	stats := &FeatureStats{Mean: make([]float32, dim), Scale: make([]float32, dim)}
+	n := float64(len(features))
+	for ii := range sum {
+		mean := sum[ii] / n
+		stddev := math.Sqrt(math.Max(sumSq[ii]/n-mean*mean, 0))
+		if stddev < MIN_FEATURE_SCALE {
+			stddev = 1
+		}
+		stats.Mean[ii] = float32(mean)
+		stats.Scale[ii] = float32(stddev)
+	}
+	return stats
+}
+
+// Version returns the version of the features the stats were fitted for.
+func (s *FeatureStats) Version() int {
+	return len(s.Mean)
+}
+
+// NormalizeFeatures returns the normalized copy of the features f, of the given
+// version. If s is nil it returns f unchanged.
+func (s *FeatureStats) NormalizeFeatures(f []float32, version int) []float32 {
+	if s == nil {
+		return f
+	}
+	if version != s.Version() || len(f) != version {
+		log.Panicf("FeatureStats fitted for version %d, but got %d features of version %d",
+			s.Version(), len(f), version)
+	}
+	normalized := make([]float32, len(f))
+	for ii, value := range f {
+		normalized[ii] = (value - s.Mean[ii]) / s.Scale[ii]
+	}
+	return normalized
+}
@@ -0,0 +1,74 @@
+package ai_test
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// randomGameFeatures returns the features of the boards of a random game.
+func randomGameFeatures(rng *rand.Rand, numMoves int) (features [][]float32) {
+	board := NewBoard()
+	for ii := 0; ii < numMoves && !board.IsFinished(); ii++ {
+		features = append(features, ai.FeatureVector(board, ai.AllFeaturesDim))
+		board = board.Act(board.Derived.Actions[rng.Intn(len(board.Derived.Actions))])
+	}
+	return
+}
+
+func TestFeatureStats(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	raw := randomGameFeatures(rng, 40)
+	stats := ai.FitFeatureStats(raw)
+	if stats.Version() != ai.AllFeaturesDim {
+		t.Fatalf("FeatureStats version %d, wanted %d", stats.Version(), ai.AllFeaturesDim)
+	}
+
+	// Stats stored in the model metadata (JSON) normalize the same way.
+	data, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("Failed to encode FeatureStats: %v", err)
+	}
+	var stored *ai.FeatureStats
+	if err = json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("Failed to decode FeatureStats: %v", err)
+	}
+	normalized := make([][]float32, len(raw))
+	for ii, f := range raw {
+		normalized[ii] = stats.NormalizeFeatures(f, ai.AllFeaturesDim)
+		if got := stored.NormalizeFeatures(f, ai.AllFeaturesDim); !reflect.DeepEqual(got, normalized[ii]) {
+			t.Errorf("Board #%d: stored stats normalized to %v, wanted %v", ii, got, normalized[ii])
+		}
+	}
+
+	// Normalized features have mean 0 and scale 1 (or are constant): normalizing
+	// them again with their own stats doesn't change them.
+	renormStats := ai.FitFeatureStats(normalized)
+	for ii := range renormStats.Mean {
+		if math.Abs(float64(renormStats.Mean[ii])) > 1e-4 || math.Abs(float64(renormStats.Scale[ii])-1) > 1e-3 {
+			t.Errorf("Feature #%d normalized has mean %g and scale %g, wanted 0 and 1", ii,
+				renormStats.Mean[ii], renormStats.Scale[ii])
+		}
+	}
+	for ii, f := range normalized {
+		renormalized := renormStats.NormalizeFeatures(f, ai.AllFeaturesDim)
+		for jj := range f {
+			if math.Abs(float64(renormalized[jj]-f[jj])) > 1e-3 {
+				t.Errorf("Board #%d, feature #%d: normalized twice to %g, wanted %g", ii, jj, renormalized[jj], f[jj])
+			}
+		}
+	}
+
+	// Disabled (nil) normalization returns the raw features.
+	var disabled *ai.FeatureStats
+	for ii, f := range raw {
+		if got := disabled.NormalizeFeatures(f, ai.AllFeaturesDim); !reflect.DeepEqual(got, f) {
+			t.Errorf("Board #%d: disabled normalization changed the features to %v", ii, got)
+		}
+	}
+}
@@ -3,6 +3,10 @@ package ai
 import (
 	"fmt"
 	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	. "github.com/janpfeifer/hiveGo/state"
 )
@@ -38,7 +42,9 @@ const (
 	F_NUM_THREATENING_MOVES
 	F_OPP_NUM_THREATENING_MOVES
 
-	// Number of moves till a draw due to running out of moves.
+	// Number of moves till a draw due to running out of moves, that is, till
+	// Board.MaxMoves. A shorter self-play move cap (see SelfPlayCapReached) is not
+	// reflected here.
 	F_MOVES_TO_DRAW
 
 	// Number of pieces that are "leaves" (only one neighbor)
@@ -49,6 +55,27 @@ const (
 	// Whether there is an opponent BEETLE on top of QUEEN.
 	F_QUEEN_COVERED
 
+	// Number of pieces of the current player that can move minus the number of
+	// the opponent's pieces that can move, normalized by the total, so it ranges
+	// from -1 to 1.
+	F_MOBILITY_ADVANTAGE
+
+	// Whether the current player can place a piece, per piece type: 0 if the
+	// pieces are all on the board, or if there is no valid position to place them
+	// (or it's not allowed, e.g. the queen must be placed first).
+	F_CAN_PLACE
+
+	// Offset of the queen from the centroid of the hive (over occupied positions),
+	// normalized by the hive's radius: distance, x and y, for the current player
+	// and then the opponent. All 0 if the queen is not on the board. It tells
+	// whether the queen is near the edge or buried in the middle of the hive.
+	F_QUEEN_OFFSET
+
+	// Number of the opponent's pieces pinned by the current player: pieces under
+	// a stack topped by a piece of the current player (a beetle), so they can't
+	// move until it leaves.
+	F_OPP_PIECES_PINNED_BY_US
+
 	// Last entry.
 	F_NUM_FEATURES
 )
@@ -87,6 +114,10 @@ var (
 		{F_MOVES_TO_DRAW, "MovesToDraw", 1, 0, fNumToDraw, 0},
 		{F_NUM_SINGLE, "NumSingle", 2, 0, fNumSingle, 0},
 		{F_QUEEN_COVERED, "QueenIsCovered", 2, 0, fQueenIsCovered, 41},
+		{F_MOBILITY_ADVANTAGE, "MobilityAdvantage", 1, 0, fMobilityAdvantage, 42},
+		{F_CAN_PLACE, "CanPlace", int(NUM_PIECE_TYPES), 0, fCanPlace, 47},
+		{F_QUEEN_OFFSET, "QueenOffset", 6, 0, fQueenOffset, 53},
+		{F_OPP_PIECES_PINNED_BY_US, "OppPiecesPinnedByUs", 1, 0, fOppPiecesPinnedByUs, 54},
 	}
 
 	// AllFeaturesDim is the dimension of all features concatenated, set during package
@@ -105,6 +136,76 @@ func init() {
 		AllFeatures[ii].VecIndex = AllFeaturesDim
 		AllFeaturesDim += AllFeatures[ii].Dim
 	}
+	if err := checkFeatureVersions(); err != nil {
+		log.Fatalf("ai.AllFeatures versions are inconsistent: %v", err)
+	}
+}
+
+// FeatureVersions returns the versions of the features supported by FeatureVector,
+// in increasing order: the dimension of the features with Version 0 (the
+// original features), followed by the distinct Version of the features added
+// later. The last one is AllFeaturesDim.
+func FeatureVersions() (versions []int) {
+	baseDim := 0
+	for ii := range AllFeatures {
+		if AllFeatures[ii].Version == 0 {
+			baseDim += AllFeatures[ii].Dim
+		}
+	}
+	versions = []int{baseDim}
+	for ii := range AllFeatures {
+		version := AllFeatures[ii].Version
+		if version > 0 && !intInSlice(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return
+}
+
+func intInSlice(slice []int, value int) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFeatureVersions verifies that for every version in FeatureVersions, the
+// features selected by FeatureVector add up to exactly the version, and that the
+// features of the latest version span AllFeaturesDim contiguously. Otherwise a
+// misplaced FeatureDef.Version would silently produce wrong vectors for models
+// of intermediate versions.
+func checkFeatureVersions() error {
+	vecIndex := 0
+	for ii := range AllFeatures {
+		def := &AllFeatures[ii]
+		if def.VecIndex != vecIndex {
+			return fmt.Errorf("feature %s starts at index %d, wanted %d", def.Name, def.VecIndex, vecIndex)
+		}
+		vecIndex += def.Dim
+		if def.Version < 0 || def.Version > AllFeaturesDim {
+			return fmt.Errorf("feature %s has version %d, outside of [0, %d]", def.Name, def.Version, AllFeaturesDim)
+		}
+	}
+	versions := FeatureVersions()
+	for _, version := range versions {
+		dim := 0
+		for jj := range AllFeatures {
+			if AllFeatures[jj].Version <= version {
+				dim += AllFeatures[jj].Dim
+			}
+		}
+		if dim != version {
+			return fmt.Errorf("features of version %d add up to %d dimensions, version should be the total "+
+				"number of features when they were created", version, dim)
+		}
+	}
+	if last := versions[len(versions)-1]; last != AllFeaturesDim {
+		return fmt.Errorf("latest version is %d, but there are %d features (AllFeaturesDim)", last, AllFeaturesDim)
+	}
+	return nil
 }
 
 // LabeledExample can be used for training.
@@ -113,19 +214,51 @@ type LabeledExample struct {
 	Label    float32
 
 	ActionsFeatures [][]float32 // Optional
-	ActionLabels    [][]float32
+	ActionLabels    []float32   // Optional: one label per action.
+
+	// BoardHash is the Board.CanonicalHash of the board the example was
+	// generated from, or 0 if not known.
+	BoardHash uint64
+
+	// Outcome of the game for the player to move in the board (see
+	// GameRecord.OutcomeFor), or OUTCOME_UNKNOWN.
+	Outcome Outcome
 }
 
 func MakeLabeledExample(board *Board, label float32, version int) LabeledExample {
 	return LabeledExample{
-		FeatureVector(board, version), label, nil, nil}
+		FeatureVector(board, version), label, nil, nil, board.CanonicalHash(), OUTCOME_UNKNOWN}
+}
+
+// GameLabeledExamples returns the examples of the boards of the game where an
+// action was taken, labeled with labels (one per board, e.g. the scores of the
+// match or TDLambdaLabels) and the game's ActionsLabels, if any. The Outcome of
+// each example is the outcome of the game for the board's NextPlayer.
+func GameLabeledExamples(game GameRecord, labels []float32, version int) []LabeledExample {
+	examples := make([]LabeledExample, 0, len(game.Actions))
+	for ii := range game.Actions {
+		board := game.Boards[ii]
+		example := MakeLabeledExample(board, labels[ii], version)
+		if ii < len(game.ActionsLabels) {
+			example.ActionLabels = game.ActionsLabels[ii]
+		}
+		example.Outcome = game.OutcomeFor(board.NextPlayer)
+		examples = append(examples, example)
+	}
+	return examples
 }
 
 // FeatureVector calculates the feature vector, of length AllFeaturesDim, for the given
 // board.
 // Models created at different times may use different subsets of features. This is
 // specified by providing the number of features expected by the model.
+//
+// If a FeatureHasher is registered and version is its Version, the hashed
+// features are appended to the dense features of its BaseVersion.
 func FeatureVector(b *Board, version int) (f []float32) {
+	if hashed := hashedFeatures(b, version); hashed != nil {
+		return append(FeatureVector(b, featureHasher.BaseVersion), hashed...)
+	}
 	if version > AllFeaturesDim {
 		log.Panicf("Requested %d features, but only know about %d", version, AllFeaturesDim)
 	}
@@ -152,17 +285,62 @@ func FeatureVector(b *Board, version int) (f []float32) {
 	return
 }
 
+// ProfileFeatures times each of the feature setters used by the given version,
+// across the given boards, and returns the total time spent on each feature. It
+// helps decide where to optimize, and whether a feature is worth its cost.
+func ProfileFeatures(boards []*Board, version int) map[FeatureId]time.Duration {
+	if version > AllFeaturesDim {
+		log.Panicf("Requested %d features, but only know about %d", version, AllFeaturesDim)
+	}
+	timings := make(map[FeatureId]time.Duration)
+	for ii := range AllFeatures {
+		if AllFeatures[ii].Version <= version {
+			timings[AllFeatures[ii].FId] = 0
+		}
+	}
+	f := make([]float32, AllFeaturesDim)
+	for _, b := range boards {
+		for ii := range AllFeatures {
+			featDef := &AllFeatures[ii]
+			if featDef.Version <= version {
+				start := time.Now()
+				featDef.Setter(b, featDef, f)
+				timings[featDef.FId] += time.Since(start)
+			}
+		}
+	}
+	return timings
+}
+
 func PrettyPrintFeatures(f []float32) {
+	fmt.Print(FormatFeatures(f, AllFeaturesDim))
+}
+
+// FormatFeatures formats the feature vector of the given version, one feature per
+// line, with its name.
+func FormatFeatures(f []float32, version int) string {
+	var sb strings.Builder
+	dense := denseVersion(version)
+	idx := 0
 	for ii := range AllFeatures {
 		def := &AllFeatures[ii]
-		fmt.Printf("\t%s: ", def.Name)
+		if def.Version > dense {
+			continue
+		}
+		fmt.Fprintf(&sb, "\t%s: ", def.Name)
+		if idx+def.Dim > len(f) {
+			sb.WriteString("<missing>\n")
+			continue
+		}
 		if def.Dim == 1 {
-			fmt.Printf("%.2f", f[def.VecIndex])
+			fmt.Fprintf(&sb, "%.2f", f[idx])
 		} else {
-			fmt.Printf("%v", f[def.VecIndex:def.VecIndex+def.Dim])
+			fmt.Fprintf(&sb, "%v", f[idx:idx+def.Dim])
 		}
-		fmt.Println()
+		sb.WriteString("\n")
+		idx += def.Dim
 	}
+	return sb.String()
 }
 
 func fNumOffBoard(b *Board, def *FeatureDef, f []float32) {
@@ -229,10 +407,13 @@ func fNumThreateningMoves(b *Board, def *FeatureDef, f []float32) {
 	idx := def.VecIndex
 	player := b.NextPlayer
 	opponent := b.OpponentPlayer()
+	// The check never matches, so OppNumThreateningMoves is computed for
+	// b.NextPlayer too, and no feature reads the placements of the opponent (see
+	// Board.PlacementCells). Fixing it would change the values of existing
+	// feature versions.
 	if def.FId == F_OPP_NUM_CAN_MOVE {
 		player, opponent = opponent, player
 	}
-	actions := b.Derived.PlayersActions[player]
 	f[idx] = 0
 	f[idx+1] = 0
 	if b.Available(opponent, QUEEN) > 0 {
@@ -240,39 +421,64 @@ func fNumThreateningMoves(b *Board, def *FeatureDef, f []float32) {
 		return
 	}
 
-	// Add
-	freeOppQueenNeighbors := b.Derived.QueenPos[opponent].Neighbours()
-	usedPieces := make(map[Pos]bool)
-	usedPositions := make([]Pos, 0, len(freeOppQueenNeighbors))
-	canPlaceAroundQueen := false
-	for _, action := range actions {
-		if !posInSlice(freeOppQueenNeighbors, action.TargetPos) ||
-			posInSlice(freeOppQueenNeighbors, action.SourcePos) {
+	// Number of pieces that can reach around opponent's queen, and number of
+	// positions around it that can be reached.
+	queenNeighbours := b.Derived.QueenPos[opponent].NeighboursArray()
+	sources, reached, canPlace := reachers(b, queenNeighbours[:], player, true)
+	f[idx] = float32(len(sources))
+	f[idx+1] = float32(len(reached))
+	if canPlace {
+		// Placement can happen when there is a bettle on top of the
+		// opponent Queen. In this case any of the available pieces for
+		// placement can be put around the Queen.
+		f[idx] += float32(TOTAL_PIECES_PER_PLAYER - b.Derived.NumPiecesOnBoard[player])
+	}
+}
+
+// reachers returns the distinct positions of the pieces of player that can move to
+// any of the targets, excluding pieces already on one of the targets, and the
+// targets reached by those moves. canPlace is set if a piece can be placed on any of
+// the targets.
+//
+// With original set, placements are ignored if Pos{0, 0} (their unset SourcePos)
+// is one of the targets, as the NumThreateningMoves features always did: it keeps
+// their values, which trained models depend on, for all the feature versions.
+func reachers(b *Board, targets []Pos, player uint8, original bool) (sources, reached []Pos, canPlace bool) {
+	for _, action := range b.Derived.PlayersActions[player] {
+		if !posInSlice(targets, action.TargetPos) {
 			continue
 		}
-		if action.Move {
-			if !usedPieces[action.SourcePos] {
-				// Number of pieces that can reach around opponent's queen.
-				usedPieces[action.SourcePos] = true
-				f[idx]++
-			}
-		} else {
-			// Placement can happen when there is a bettle on top of the
-			// opponent Queen.
-			canPlaceAroundQueen = true
+		if original && !action.Move && posInSlice(targets, action.SourcePos) {
+			continue
+		}
+		if !action.Move {
+			canPlace = true
 			continue
 		}
-		if !posInSlice(usedPositions, action.TargetPos) {
-			// Number of positions around opponent's queen that can be reached.
-			usedPositions = append(usedPositions, action.TargetPos)
-			f[idx+1]++
+		if posInSlice(targets, action.SourcePos) {
+			continue
+		}
+		if !posInSlice(sources, action.SourcePos) {
+			sources = append(sources, action.SourcePos)
+		}
+		if !posInSlice(reached, action.TargetPos) {
+			reached = append(reached, action.TargetPos)
 		}
 	}
-	if canPlaceAroundQueen {
-		// In this case any of the available pieces for placement can
-		// be put around the Queen.
-		f[idx] += float32(TOTAL_PIECES_PER_PLAYER - b.Derived.NumPiecesOnBoard[player])
+	return
+}
+
+// CountReachers returns the number of distinct pieces of player that have a legal
+// action landing on target: the pieces on the board that can move there, plus, if
+// target is a valid placement position, all the pieces of player not yet placed.
+// It generalizes the NumThreateningMoves feature, for any key position.
+func CountReachers(b *Board, target Pos, player uint8) int {
+	sources, _, canPlace := reachers(b, []Pos{target}, player, false)
+	count := len(sources)
+	if canPlace {
+		count += TOTAL_PIECES_PER_PLAYER - int(b.Derived.NumPiecesOnBoard[player])
 	}
+	return count
 }
 
 func fNumToDraw(b *Board, def *FeatureDef, f []float32) {
@@ -305,3 +511,102 @@ func fQueenIsCovered(b *Board, def *FeatureDef, f []float32) {
 		player, opponent = opponent, player
 	}
 }
+
+// numPiecesCanMove returns the number of pieces of the player that can move.
+func numPiecesCanMove(b *Board, player uint8) int {
+	posVisited := make(map[Pos]bool)
+	for _, action := range b.Derived.PlayersActions[player] {
+		if action.Move {
+			posVisited[action.SourcePos] = true
+		}
+	}
+	return len(posVisited)
+}
+
+func fMobilityAdvantage(b *Board, def *FeatureDef, f []float32) {
+	idx := def.VecIndex
+	own := numPiecesCanMove(b, b.NextPlayer)
+	opp := numPiecesCanMove(b, b.OpponentPlayer())
+	if own+opp == 0 {
+		f[idx] = 0
+		return
+	}
+	f[idx] = float32(own-opp) / float32(own+opp)
+}
+
+func fCanPlace(b *Board, def *FeatureDef, f []float32) {
+	idx := def.VecIndex
+	for _, piece := range Pieces {
+		f[idx+int(piece)-1] = 0
+	}
+	for _, action := range b.Derived.Actions {
+		if !action.Move && !action.IsSkipAction() {
+			f[idx+int(action.Piece)-1] = 1
+		}
+	}
+}
+
+// HiveCentroid returns the centroid, in cartesian coordinates (see Pos.Cartesian),
+// of the occupied positions, and the radius of the hive: the largest distance
+// from the centroid to an occupied position.
+func HiveCentroid(b *Board) (cx, cy, radius float64) {
+	poss := b.OccupiedPositions()
+	if len(poss) == 0 {
+		return
+	}
+	// Sum in a fixed order, so the rounding, and the features, don't change with
+	// the order of the map of positions.
+	PosSort(poss)
+	for _, pos := range poss {
+		x, y := pos.Cartesian()
+		cx += x
+		cy += y
+	}
+	cx /= float64(len(poss))
+	cy /= float64(len(poss))
+	for _, pos := range poss {
+		x, y := pos.Cartesian()
+		radius = math.Max(radius, math.Hypot(x-cx, y-cy))
+	}
+	return
+}
+
+func fQueenOffset(b *Board, def *FeatureDef, f []float32) {
+	idx := def.VecIndex
+	cx, cy, radius := HiveCentroid(b)
+	player := b.NextPlayer
+	opponent := b.OpponentPlayer()
+	for ii := 0; ii < 2; ii++ {
+		f[idx+3*ii], f[idx+3*ii+1], f[idx+3*ii+2] = 0, 0, 0
+		if radius > 0 && b.Available(player, QUEEN) == 0 {
+			x, y := b.Derived.QueenPos[player].Cartesian()
+			dx, dy := (x-cx)/radius, (y-cy)/radius
+			f[idx+3*ii] = float32(math.Hypot(dx, dy))
+			f[idx+3*ii+1] = float32(dx)
+			f[idx+3*ii+2] = float32(dy)
+		}
+		// Invert players selection.
+		player, opponent = opponent, player
+	}
+}
+
+// numPiecesPinnedBy returns the number of pieces of the opponent of player that
+// are under a stack topped by a piece of player.
+func numPiecesPinnedBy(b *Board, player uint8) (count int) {
+	for _, pos := range b.OccupiedPositions() {
+		stack := b.StackAt(pos)
+		if topPlayer, _ := stack.Top(); topPlayer != player {
+			continue
+		}
+		for stackPos := uint8(1); stackPos < stack.CountPieces(); stackPos++ {
+			if piecePlayer, _ := stack.PieceAt(stackPos); piecePlayer != player {
+				count++
+			}
+		}
+	}
+	return
+}
+
+func fOppPiecesPinnedByUs(b *Board, def *FeatureDef, f []float32) {
+	f[def.VecIndex] = float32(numPiecesPinnedBy(b, b.NextPlayer))
+}
@@ -0,0 +1,332 @@
+package ai_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestProfileFeatures(t *testing.T) {
+	boards := symmetryTestBoards()
+	timings := ai.ProfileFeatures(boards, ai.AllFeaturesDim)
+	if len(timings) != len(ai.AllFeatures) {
+		t.Errorf("Got timings for %d features, wanted %d", len(timings), len(ai.AllFeatures))
+	}
+	for ii := range ai.AllFeatures {
+		if _, found := timings[ai.AllFeatures[ii].FId]; !found {
+			t.Errorf("Missing timing for feature %s", ai.AllFeatures[ii].Name)
+		}
+	}
+
+	// Older versions don't use the features created later.
+	const version = 39
+	timings = ai.ProfileFeatures(boards, version)
+	for ii := range ai.AllFeatures {
+		def := &ai.AllFeatures[ii]
+		if _, found := timings[def.FId]; found != (def.Version <= version) {
+			t.Errorf("Version %d: feature %s (version %d) timing present=%v", version, def.Name, def.Version, found)
+		}
+	}
+	if _, found := timings[ai.F_QUEEN_COVERED]; found {
+		t.Errorf("Version %d: disabled feature QueenIsCovered should not be profiled", version)
+	}
+}
+
+func TestMobilityAdvantage(t *testing.T) {
+	// Pieces in a line: player 0 has two ants free to move at the ends, while
+	// player 1's queen, in the middle, can't move without breaking the hive.
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, 1}, 1, QUEEN)
+	b.StackPiece(Pos{0, 2}, 0, ANT)
+	b.StackPiece(Pos{0, -1}, 0, ANT)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(1, QUEEN, 0)
+	b.SetAvailable(0, ANT, 1)
+	b.BuildDerived()
+
+	idx := ai.AllFeatures[ai.F_MOBILITY_ADVANTAGE].VecIndex
+	f := ai.FeatureVector(b, ai.AllFeaturesDim)
+	if f[idx] <= 0 {
+		t.Errorf("Player 0 has more mobile pieces, but got MobilityAdvantage=%g", f[idx])
+	}
+
+	// From the perspective of player 1 the advantage is reversed.
+	b.NextPlayer = 1
+	b.BuildDerived()
+	if fOpp := ai.FeatureVector(b, ai.AllFeaturesDim); fOpp[idx] != -f[idx] {
+		t.Errorf("Player 1 MobilityAdvantage=%g, wanted %g", fOpp[idx], -f[idx])
+	}
+}
+
+func TestCanPlace(t *testing.T) {
+	idx := ai.AllFeatures[ai.F_CAN_PLACE].VecIndex
+	f := ai.FeatureVector(NewBoard(), ai.AllFeaturesDim)
+	for _, piece := range Pieces {
+		if f[idx+int(piece)-1] != 1 {
+			t.Errorf("Initial board: %s should be placeable", PieceNames[piece])
+		}
+	}
+
+	// Player 1's only piece is covered by player 0's beetle: it has pieces
+	// offboard, but nowhere to place them.
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, 1}, 1, ANT)
+	b.StackPiece(Pos{0, 1}, 0, BEETLE)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(0, BEETLE, 1)
+	b.SetAvailable(1, ANT, 2)
+	b.NextPlayer = 1
+	b.MoveNumber = 4
+	b.BuildDerived()
+	f = ai.FeatureVector(b, ai.AllFeaturesDim)
+	if offboard := f[ai.AllFeatures[ai.F_NUM_OFFBOARD].VecIndex+int(ANT)-1]; offboard != 2 {
+		t.Fatalf("Player 1 should have 2 ants offboard, got %g", offboard)
+	}
+	for _, piece := range Pieces {
+		if f[idx+int(piece)-1] != 0 {
+			t.Errorf("Boxed in player: %s should not be placeable", PieceNames[piece])
+		}
+	}
+}
+
+func TestQueenOffset(t *testing.T) {
+	// Symmetric hive around the origin, with player 0's queen in the center and
+	// player 1's queen in the edge.
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, -1}, 1, QUEEN)
+	b.StackPiece(Pos{0, 1}, 0, ANT)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(1, QUEEN, 0)
+	b.SetAvailable(0, ANT, 2)
+	b.MoveNumber = 4
+	b.BuildDerived()
+
+	cx, cy, radius := ai.HiveCentroid(b)
+	if math.Abs(cx) > 1e-6 || math.Abs(cy) > 1e-6 || math.Abs(radius-1) > 1e-6 {
+		t.Errorf("Got centroid (%g, %g) with radius %g, wanted (0, 0) with radius 1", cx, cy, radius)
+	}
+
+	idx := ai.AllFeatures[ai.F_QUEEN_OFFSET].VecIndex
+	f := ai.FeatureVector(b, ai.AllFeaturesDim)
+	center, edge := f[idx], f[idx+3]
+	if center > 1e-6 || math.Abs(float64(edge)-1) > 1e-6 {
+		t.Errorf("Got QueenOffset distances center=%g, edge=%g, wanted 0 and 1", center, edge)
+	}
+	if dy := f[idx+5]; dy >= 0 {
+		t.Errorf("Opponent's queen is above the centroid, but got dy=%g", dy)
+	}
+
+	// From the perspective of player 1 the players are swapped.
+	b.NextPlayer = 1
+	b.BuildDerived()
+	if fOpp := ai.FeatureVector(b, ai.AllFeaturesDim); fOpp[idx] != edge || fOpp[idx+3] != center {
+		t.Errorf("Player 1 QueenOffset distances=(%g, %g), wanted (%g, %g)", fOpp[idx], fOpp[idx+3], edge, center)
+	}
+
+	// No queen on the board: all zeros.
+	f = ai.FeatureVector(NewBoard(), ai.AllFeaturesDim)
+	for ii := 0; ii < ai.AllFeatures[ai.F_QUEEN_OFFSET].Dim; ii++ {
+		if f[idx+ii] != 0 {
+			t.Errorf("Empty board: QueenOffset[%d]=%g, wanted 0", ii, f[idx+ii])
+		}
+	}
+}
+
+func TestOppPiecesPinnedByUs(t *testing.T) {
+	// Player 0's beetle on top of player 1's ant, pinning it.
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, 1}, 1, QUEEN)
+	b.StackPiece(Pos{0, 2}, 1, ANT)
+	b.StackPiece(Pos{0, 2}, 0, BEETLE)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(0, BEETLE, 1)
+	b.SetAvailable(1, QUEEN, 0)
+	b.SetAvailable(1, ANT, 2)
+	b.MoveNumber = 5
+	b.BuildDerived()
+	for _, action := range b.Derived.PlayersActions[1] {
+		if action.Move && action.SourcePos == (Pos{0, 2}) {
+			t.Fatalf("Pinned ant can move: %s", action)
+		}
+	}
+
+	idx := ai.AllFeatures[ai.F_OPP_PIECES_PINNED_BY_US].VecIndex
+	if f := ai.FeatureVector(b, ai.AllFeaturesDim); f[idx] != 1 {
+		t.Errorf("Got OppPiecesPinnedByUs=%g, wanted 1", f[idx])
+	}
+
+	// Player 1 pins nothing.
+	b.NextPlayer = 1
+	b.BuildDerived()
+	if f := ai.FeatureVector(b, ai.AllFeaturesDim); f[idx] != 0 {
+		t.Errorf("Player 1 got OppPiecesPinnedByUs=%g, wanted 0", f[idx])
+	}
+
+	// Not available to older models.
+	if f := ai.FeatureVector(b, 53); len(f) != 53 {
+		t.Errorf("Features of version 53 have dimension %d", len(f))
+	}
+}
+
+func TestCountReachers(t *testing.T) {
+	// Player 1's queen surrounded by its own pieces, except for (0, -1), which
+	// player 0's ant can reach.
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 1, QUEEN)
+	b.StackPiece(Pos{1, -1}, 1, ANT)
+	b.StackPiece(Pos{1, 0}, 1, ANT)
+	b.StackPiece(Pos{0, 1}, 1, ANT)
+	b.StackPiece(Pos{-1, 0}, 1, SPIDER)
+	b.StackPiece(Pos{-1, -1}, 1, SPIDER)
+	b.StackPiece(Pos{0, 2}, 0, QUEEN)
+	b.StackPiece(Pos{0, 3}, 0, ANT)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(0, ANT, 2)
+	b.SetAvailable(1, QUEEN, 0)
+	b.SetAvailable(1, ANT, 0)
+	b.SetAvailable(1, SPIDER, 0)
+	b.MoveNumber = 8
+	b.BuildDerived()
+
+	count := ai.CountReachers(b, Pos{0, -1}, 0)
+	if count == 0 {
+		t.Errorf("CountReachers(%s)=0, wanted player 0's ant to reach it", Pos{0, -1})
+	}
+	f := ai.FeatureVector(b, ai.AllFeaturesDim)
+	if want := int(f[ai.AllFeatures[ai.F_NUM_THREATENING_MOVES].VecIndex]); count != want {
+		t.Errorf("CountReachers(%s)=%d, but NumThreateningMoves counts %d pieces", Pos{0, -1}, count, want)
+	}
+
+	// Placement positions count all the pieces not yet placed.
+	if got := ai.CountReachers(b, Pos{0, 4}, 0); got != TOTAL_PIECES_PER_PLAYER-2 {
+		t.Errorf("CountReachers(%s)=%d, wanted %d", Pos{0, 4}, got, TOTAL_PIECES_PER_PLAYER-2)
+	}
+}
+
+func TestNumThreateningMovesPlacements(t *testing.T) {
+	// Player 0's beetle covers player 1's queen, at (1, 0), so player 0 can place
+	// pieces around it. Since (0, 0) is one of the queen's neighbours, the
+	// NumThreateningMoves features ignore those placements, as they always did,
+	// but CountReachers counts them.
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{1, 0}, 1, QUEEN)
+	b.StackPiece(Pos{1, 0}, 0, BEETLE)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(0, BEETLE, 1)
+	b.SetAvailable(1, QUEEN, 0)
+	b.MoveNumber = 5
+	b.BuildDerived()
+
+	target := Pos{2, 0}
+	if !b.Derived.PlacementPositions[0][target] {
+		t.Fatalf("Player 0 should be able to place at %s", target)
+	}
+	notPlaced := TOTAL_PIECES_PER_PLAYER - 2
+	if got := ai.CountReachers(b, target, 0); got < notPlaced {
+		t.Errorf("CountReachers(%s)=%d, wanted at least the %d pieces not placed", target, got, notPlaced)
+	}
+	f := ai.FeatureVector(b, ai.AllFeaturesDim)
+	if got := int(f[ai.AllFeatures[ai.F_NUM_THREATENING_MOVES].VecIndex]); got >= notPlaced {
+		t.Errorf("NumThreateningMoves=%d, wanted the placements around the queen ignored", got)
+	}
+}
+
+// TestFeaturesIgnoreOpponentPlacements checks that no feature depends on where the
+// opponent of the next player could place pieces: the rule for those placements
+// was fixed (see Board.PlacementCells) without a new features version.
+func TestFeaturesIgnoreOpponentPlacements(t *testing.T) {
+	// Player 0's beetle covers player 1's queen, so player 0, the opponent, can
+	// place pieces around it.
+	covered := NewBoard()
+	covered.StackPiece(Pos{0, 0}, 0, QUEEN)
+	covered.StackPiece(Pos{1, 0}, 0, ANT)
+	covered.StackPiece(Pos{2, 0}, 1, QUEEN)
+	covered.StackPiece(Pos{2, 0}, 0, BEETLE)
+	covered.SetAvailable(0, QUEEN, 0)
+	covered.SetAvailable(0, ANT, 2)
+	covered.SetAvailable(0, BEETLE, 1)
+	covered.SetAvailable(1, QUEEN, 0)
+	covered.NextPlayer, covered.MoveNumber = 1, 6
+	covered.BuildDerived()
+
+	boards := append(ai.RandomBoards(50, 40, rand.New(rand.NewSource(1))), covered)
+	for ii, b := range boards {
+		want := ai.FeatureVector(b, ai.AllFeaturesDim)
+		opponent := b.OpponentPlayer()
+		derived := *b.Derived
+		derived.PlayersActions[opponent] = nil
+		for _, action := range b.Derived.PlayersActions[opponent] {
+			if action.Move {
+				derived.PlayersActions[opponent] = append(derived.PlayersActions[opponent], action)
+			}
+		}
+		derived.PlacementPositions[opponent] = nil
+		derived.PlacementCells[opponent] = nil
+		withoutPlacements := *b
+		withoutPlacements.Derived = &derived
+		if got := ai.FeatureVector(&withoutPlacements, ai.AllFeaturesDim); !reflect.DeepEqual(got, want) {
+			t.Errorf("Board #%d: features changed without the placements of the opponent: got %v, wanted %v",
+				ii, got, want)
+		}
+	}
+}
+
+// BenchmarkFullGameFeatures measures a full-game feature pass: it replays a game,
+// which builds the derived information of each board, and computes the features
+// of each board.
+func BenchmarkFullGameFeatures(bench *testing.B) {
+	rnd := rand.New(rand.NewSource(42))
+	var actions []Action
+	board := NewBoard()
+	board.BuildDerived()
+	for !board.IsFinished() && len(board.Derived.Actions) > 0 {
+		// Sort the actions, whose order depend on map iteration, so the game
+		// is the same in every run.
+		notations := make([]string, len(board.Derived.Actions))
+		for ii, action := range board.Derived.Actions {
+			notations[ii] = action.Notation()
+		}
+		sort.Strings(notations)
+		action, _ := ParseAction(notations[rnd.Intn(len(notations))])
+		actions = append(actions, action)
+		board = board.Act(action)
+	}
+
+	bench.ReportAllocs()
+	bench.ResetTimer()
+	for ii := 0; ii < bench.N; ii++ {
+		board = NewBoard()
+		board.BuildDerived()
+		ai.FeatureVector(board, ai.AllFeaturesDim)
+		for _, action := range actions {
+			board = board.Act(action)
+			ai.FeatureVector(board, ai.AllFeaturesDim)
+		}
+	}
+}
+
+func TestFeatureVersions(t *testing.T) {
+	versions := ai.FeatureVersions()
+	if len(versions) == 0 || versions[len(versions)-1] != ai.AllFeaturesDim {
+		t.Fatalf("FeatureVersions()=%v, wanted it to end with AllFeaturesDim=%d", versions, ai.AllFeaturesDim)
+	}
+	b := NewBoard()
+	for ii, version := range versions {
+		if ii > 0 && version <= versions[ii-1] {
+			t.Errorf("FeatureVersions()=%v not in increasing order", versions)
+		}
+		if f := ai.FeatureVector(b, version); len(f) != version {
+			t.Errorf("FeatureVector for version %d has %d features", version, len(f))
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package ai
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// GameRecord holds a game (match), as generated by self-play: the boards and the
+// actions that led from one to the next.
+type GameRecord struct {
+	// Boards of the game, starting with the initial one. There is one more board
+	// than there are actions.
+	Boards []*Board
+
+	// Actions taken at each board.
+	Actions []Action
+
+	// ActionsLabels for each action taken (optional): a probability distribution
+	// over the actions of the board, e.g. one-hot-encoding of the action taken, or
+	// MCTS visit counts (see VisitCountPolicy).
+	ActionsLabels [][]float32
+
+	// Capped is set if the game was interrupted by a self-play move cap (see
+	// SelfPlayCapReached) before it was finished. It is then considered a draw,
+	// even though the final board is not finished.
+	Capped bool
+
+	// Resigned is set if the player to move in the final board resigned (see
+	// players.Resign), so the game was won by its opponent, even though the
+	// final board is not finished.
+	Resigned bool
+
+	// Adjudicated is set if the game was declared a draw early, because neither
+	// player was making progress (see players.Adjudicate), even though the final
+	// board is not finished.
+	Adjudicated bool
+
+	// Seed of the random number generator of the game (see Board.WithSeed), to
+	// replay it in isolation, or 0 if the game used the global one.
+	Seed int64
+}
+
+// NewGameRecord creates a GameRecord by replaying the actions starting from the
+// initial board.
+func NewGameRecord(initial *Board, actions []Action) GameRecord {
+	game := GameRecord{Boards: make([]*Board, 1, len(actions)+1), Actions: actions}
+	game.Boards[0] = initial
+	board := initial
+	for _, action := range actions {
+		board = board.Act(action)
+		game.Boards = append(game.Boards, board)
+	}
+	return game
+}
+
+// FinalBoard returns the last board of the game.
+func (game *GameRecord) FinalBoard() *Board { return game.Boards[len(game.Boards)-1] }
+
+// Draw returns whether the game ended in a draw, including games interrupted by a
+// self-play move cap or adjudicated a draw.
+func (game *GameRecord) Draw() bool {
+	return game.Capped || game.Adjudicated || game.FinalBoard().Draw()
+}
+
+// Winner returns the winner of the game, including games that ended by
+// resignation. Only valid if the game is not a draw.
+func (game *GameRecord) Winner() uint8 {
+	if game.Resigned {
+		return game.FinalBoard().OpponentPlayer()
+	}
+	return game.FinalBoard().Winner()
+}
+
+// OutcomeFor returns the outcome of the game for the given player.
+func (game *GameRecord) OutcomeFor(player uint8) Outcome {
+	if game.Draw() {
+		return OUTCOME_DRAW
+	}
+	if !game.Resigned && !game.FinalBoard().IsFinished() {
+		return OUTCOME_UNKNOWN
+	}
+	if game.Winner() == player {
+		return OUTCOME_WIN
+	}
+	return OUTCOME_LOSS
+}
+
+// SelfPlayCapReached returns whether a self-play game reached its move cap,
+// maxMoves, which works like Board.MaxMoves: the game is a draw after move maxMoves
+// is played. A maxMoves <= 0 means there is no cap.
+//
+// Unlike Board.MaxMoves, the cap is not seen by the players: the F_MOVES_TO_DRAW
+// feature still counts the moves to Board.MaxMoves.
+func SelfPlayCapReached(b *Board, maxMoves int) bool {
+	return maxMoves > 0 && b.MoveNumber > maxMoves && !b.IsFinished()
+}
+
+// CompactGameRecord is a compact version of a GameRecord, better suited for large
+// archives of games: since each board differs from the previous one by only one
+// action, only the initial board and the actions are stored, and the intermediate
+// boards are reconstructed on demand.
+type CompactGameRecord struct {
+	Initial       *Board
+	Actions       []Action
+	ActionsLabels [][]float32
+	Capped        bool
+	Resigned      bool
+	Seed          int64
+}
+
+// Compact returns the compact version of the game. Adjudicated games are stored as
+// Capped: both are draws interrupted before the end of the game.
+func (game *GameRecord) Compact() CompactGameRecord {
+	return CompactGameRecord{Initial: game.Boards[0], Actions: game.Actions, ActionsLabels: game.ActionsLabels,
+		Capped: game.Capped || game.Adjudicated, Resigned: game.Resigned, Seed: game.Seed}
+}
+
+// Boards returns an iterator over the boards of the game, starting with the
+// initial one, reconstructed by acting each action in turn. The iterator returns
+// false when there are no more boards.
+func (c *CompactGameRecord) Boards() func() (*Board, bool) {
+	var board *Board
+	next := 0
+	return func() (*Board, bool) {
+		if next > len(c.Actions) {
+			return nil, false
+		}
+		if next == 0 {
+			board = c.Initial
+		} else {
+			board = board.Act(c.Actions[next-1])
+		}
+		next++
+		return board, true
+	}
+}
+
+// Expand reconstructs the full GameRecord, with all the boards materialized.
+func (c *CompactGameRecord) Expand() GameRecord {
+	game := GameRecord{Boards: make([]*Board, 0, len(c.Actions)+1), Actions: c.Actions, ActionsLabels: c.ActionsLabels,
+		Capped: c.Capped, Resigned: c.Resigned, Seed: c.Seed}
+	nextBoard := c.Boards()
+	for board, ok := nextBoard(); ok; board, ok = nextBoard() {
+		game.Boards = append(game.Boards, board)
+	}
+	return game
+}
+
+// compactBoard is the encodable version of the initial board of a game.
+type compactBoard struct {
+	MoveNumber, MaxMoves int
+	NextPlayer           uint8
+	NoQueenFirstMove     bool
+	Available            [NUM_PLAYERS]Availability
+	Positions            []Pos
+	Stacks               []EncodedStack
+}
+
+func newCompactBoard(b *Board) (cb compactBoard) {
+	cb.MoveNumber, cb.MaxMoves, cb.NextPlayer = b.MoveNumber, b.MaxMoves, b.NextPlayer
+	cb.NoQueenFirstMove = b.NoQueenFirstMove
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for ii, piece := range Pieces {
+			cb.Available[player][ii] = b.Available(player, piece)
+		}
+	}
+	cb.Positions = b.OccupiedPositions()
+	for _, pos := range cb.Positions {
+		cb.Stacks = append(cb.Stacks, b.StackAt(pos))
+	}
+	return
+}
+
+func (cb *compactBoard) board() *Board {
+	b := NewBoard()
+	b.MoveNumber, b.MaxMoves, b.NextPlayer = cb.MoveNumber, cb.MaxMoves, cb.NextPlayer
+	b.NoQueenFirstMove = cb.NoQueenFirstMove
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for ii, piece := range Pieces {
+			b.SetAvailable(player, piece, cb.Available[player][ii])
+		}
+	}
+	for ii, pos := range cb.Positions {
+		// Stack pieces from the bottom up.
+		stack := cb.Stacks[ii]
+		for stackPos := int(stack.CountPieces()) - 1; stackPos >= 0; stackPos-- {
+			player, piece := stack.PieceAt(uint8(stackPos))
+			b.StackPiece(pos, player, piece)
+		}
+	}
+	b.BuildDerived()
+	return b
+}
+
+// Encode the compact game record.
+func (c *CompactGameRecord) Encode(enc *gob.Encoder) error {
+	if err := enc.Encode(newCompactBoard(c.Initial)); err != nil {
+		return fmt.Errorf("Failed to encode game's initial board: %v", err)
+	}
+	if err := enc.Encode(c.Actions); err != nil {
+		return fmt.Errorf("Failed to encode game's actions: %v", err)
+	}
+	if err := enc.Encode(c.ActionsLabels); err != nil {
+		return fmt.Errorf("Failed to encode game's actions labels: %v", err)
+	}
+	if err := enc.Encode(c.Capped); err != nil {
+		return fmt.Errorf("Failed to encode whether game was capped: %v", err)
+	}
+	if err := enc.Encode(c.Resigned); err != nil {
+		return fmt.Errorf("Failed to encode whether game was resigned: %v", err)
+	}
+	if err := enc.Encode(c.Seed); err != nil {
+		return fmt.Errorf("Failed to encode game's seed: %v", err)
+	}
+	return nil
+}
+
+// DecodeCompactGameRecord decodes a game record encoded with CompactGameRecord.Encode.
+func DecodeCompactGameRecord(dec *gob.Decoder) (c CompactGameRecord, err error) {
+	var cb compactBoard
+	if err = dec.Decode(&cb); err != nil {
+		err = fmt.Errorf("Failed to decode game's initial board: %v", err)
+		return
+	}
+	c.Initial = cb.board()
+	if err = dec.Decode(&c.Actions); err != nil {
+		err = fmt.Errorf("Failed to decode game's actions: %v", err)
+		return
+	}
+	if err = dec.Decode(&c.ActionsLabels); err != nil {
+		err = fmt.Errorf("Failed to decode game's actions labels: %v", err)
+		return
+	}
+	if err = dec.Decode(&c.Capped); err != nil {
+		err = fmt.Errorf("Failed to decode whether game was capped: %v", err)
+		return
+	}
+	if err = dec.Decode(&c.Resigned); err != nil {
+		err = fmt.Errorf("Failed to decode whether game was resigned: %v", err)
+		return
+	}
+	if err = dec.Decode(&c.Seed); err != nil {
+		err = fmt.Errorf("Failed to decode game's seed: %v", err)
+	}
+	return
+}
+
+// TDLambdaLabels returns value targets for each of the boards of the game
+// (including the final one), each from the perspective of the board's NextPlayer,
+// computed with TD(lambda): the target of a board is a blend of the scorer's
+// evaluation of the next board, and the target of the next board, weighted by
+// lambda:
+//
+//   target[t] = -[(1-lambda) * score(board[t+1]) + lambda * target[t+1]]
+//
+// Where the sign accounts for the change of player. Finished boards are scored with
+// EndGameScore, and the target of the final board is its score -- 0 if the game was
+// capped or adjudicated, since it is considered a draw, and -10 (a loss) if its player resigned.
+//
+// With lambda=1 all targets are the final outcome of the game, and with lambda=0
+// they are the one-step bootstrap from the next board's score.
+func TDLambdaLabels(game GameRecord, scorer Scorer, lambda float32) []float32 {
+	boardScore := func(b *Board) float32 {
+		if isEnd, score := EndGameScore(b); isEnd {
+			return score
+		}
+		score, _ := scorer.Score(b)
+		return score
+	}
+
+	labels := make([]float32, len(game.Boards))
+	last := len(game.Boards) - 1
+	if game.Capped || game.Adjudicated {
+		labels[last] = 0
+	} else if game.Resigned {
+		labels[last] = -10
+	} else {
+		labels[last] = boardScore(game.Boards[last])
+	}
+	nextScore := labels[last]
+	for ii := last - 1; ii >= 0; ii-- {
+		labels[ii] = -((1-lambda)*nextScore + lambda*labels[ii+1])
+		if ii > 0 && lambda < 1 {
+			nextScore = boardScore(game.Boards[ii])
+		}
+	}
+	return labels
+}
@@ -0,0 +1,142 @@
+package ai_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// moveNumberScorer scores boards with their move number, so values are easy to track.
+type moveNumberScorer struct{}
+
+func (moveNumberScorer) Score(b *Board) (float32, []float32) { return float32(b.MoveNumber), nil }
+func (moveNumberScorer) Version() int                        { return 0 }
+
+// mateGame returns a short scripted game: both players pass a couple of times, and
+// then player 1 surrounds player 0's queen.
+func mateGame() ai.GameRecord {
+	b := NewBoard()
+	for _, p := range []struct {
+		pos    Pos
+		player uint8
+		piece  Piece
+	}{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{2, 1}, 0, SPIDER},
+		{Pos{-2, 2}, 1, GRASSHOPPER},
+		{Pos{1, 1}, 0, SPIDER},
+		{Pos{-1, 2}, 1, SPIDER},
+		{Pos{2, 0}, 0, ANT},
+		{Pos{1, -1}, 0, ANT},
+	} {
+		b.StackPiece(p.pos, p.player, p.piece)
+		b.SetAvailable(p.player, p.piece, b.Available(p.player, p.piece)-1)
+	}
+	b.BuildDerived()
+	mate := Action{Move: true, Piece: GRASSHOPPER, SourcePos: Pos{-2, 2}, TargetPos: Pos{0, 1}}
+	return ai.NewGameRecord(b, []Action{SKIP_ACTION, SKIP_ACTION, SKIP_ACTION, mate})
+}
+
+func TestTDLambdaLabels(t *testing.T) {
+	game := mateGame()
+	final := game.FinalBoard()
+	if !final.IsFinished() || final.Winner() != 1 || final.NextPlayer != 0 {
+		t.Fatalf("Scripted game should have finished with player 1 winning")
+	}
+
+	// lambda=1: final outcome, from the perspective of each board's player.
+	got := ai.TDLambdaLabels(game, moveNumberScorer{}, 1)
+	want := []float32{-10, 10, -10, 10, -10}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lambda=1: got %v, wanted %v", got, want)
+	}
+
+	// lambda=0: one-step bootstrap from the next board's score.
+	got = ai.TDLambdaLabels(game, moveNumberScorer{}, 0)
+	want = make([]float32, len(game.Boards))
+	for ii := range game.Boards[:len(game.Boards)-1] {
+		score, _ := moveNumberScorer{}.Score(game.Boards[ii+1])
+		if ii+1 == len(game.Boards)-1 {
+			_, score = ai.EndGameScore(final)
+		}
+		want[ii] = -score
+	}
+	_, want[len(want)-1] = ai.EndGameScore(final)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lambda=0: got %v, wanted %v", got, want)
+	}
+}
+
+// sameBoard checks that the boards have the same pieces at the same positions, and
+// the same state.
+func sameBoard(b1, b2 *Board) bool {
+	if b1.MoveNumber != b2.MoveNumber || b1.NextPlayer != b2.NextPlayer {
+		return false
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			if b1.Available(player, piece) != b2.Available(player, piece) {
+				return false
+			}
+		}
+	}
+	positions := b1.OccupiedPositions()
+	if len(positions) != len(b2.OccupiedPositions()) {
+		return false
+	}
+	for _, pos := range positions {
+		if b1.StackAt(pos) != b2.StackAt(pos) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompactGameRecord(t *testing.T) {
+	game := mateGame()
+	game.ActionsLabels = [][]float32{nil, nil, nil, {0.5, 0.5}}
+	game.Seed = 1234
+	compact := game.Compact()
+
+	var buf bytes.Buffer
+	if err := compact.Encode(gob.NewEncoder(&buf)); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	decoded, err := ai.DecodeCompactGameRecord(gob.NewDecoder(&buf))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	nextBoard := decoded.Boards()
+	count := 0
+	for board, ok := nextBoard(); ok; board, ok = nextBoard() {
+		if count >= len(game.Boards) {
+			t.Fatalf("Iterator returned more than %d boards", len(game.Boards))
+		}
+		if !sameBoard(board, game.Boards[count]) {
+			t.Errorf("Reconstructed board %d differs from the materialized one", count)
+		}
+		count++
+	}
+	if count != len(game.Boards) {
+		t.Errorf("Iterator returned %d boards, wanted %d", count, len(game.Boards))
+	}
+
+	expanded := decoded.Expand()
+	if len(expanded.Boards) != len(game.Boards) || !expanded.FinalBoard().IsFinished() {
+		t.Errorf("Expanded game has %d boards, wanted %d, finished game", len(expanded.Boards), len(game.Boards))
+	}
+	if !reflect.DeepEqual(expanded.ActionsLabels, game.ActionsLabels) {
+		t.Errorf("Expanded game actions labels %v, wanted %v", expanded.ActionsLabels, game.ActionsLabels)
+	}
+	if expanded.Seed != game.Seed {
+		t.Errorf("Expanded game seed %d, wanted %d", expanded.Seed, game.Seed)
+	}
+}
@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"github.com/golang/glog"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// LearnConfig configures LearnFromGames.
+type LearnConfig struct {
+	// LearningRate and Steps are passed to LearnerScorer.Learn.
+	LearningRate float32
+	Steps        int
+
+	// UseTDLambda labels the boards with TDLambdaLabels, bootstrapped from the
+	// learner's own scores, with the given TDLambda. Otherwise the boards are
+	// labeled with the outcome of the game for their NextPlayer: 10 for a win,
+	// -10 for a loss and 0 for a draw.
+	UseTDLambda bool
+	TDLambda    float32
+
+	// OneHot labels the actions with the one-hot encoding of the action taken,
+	// even if the game has ActionsLabels (e.g. MCTS visit counts). Games without
+	// ActionsLabels always use the one-hot encoding.
+	OneHot bool
+
+	// BatchSize is the number of boards per call to Learn, e.g. the same as
+	// --tf_batch_size. If 0 all boards are learned in one call.
+	BatchSize int
+}
+
+// GameExamples returns the boards of the game where an action was taken, labeled
+// as configured by cfg (see LearnConfig). scorer is only used with TD(lambda).
+//
+// Games with an unknown outcome (not finished, capped, resigned or adjudicated)
+// can only be labeled with TD(lambda): otherwise no examples are returned.
+func GameExamples(game GameRecord, scorer Scorer, cfg LearnConfig) (
+	boards []*Board, boardLabels []float32, actionsLabels [][]float32) {
+	var labels []float32
+	if cfg.UseTDLambda {
+		labels = TDLambdaLabels(game, scorer, cfg.TDLambda)
+	} else {
+		labels = make([]float32, len(game.Actions))
+		for ii := range labels {
+			switch game.OutcomeFor(game.Boards[ii].NextPlayer) {
+			case OUTCOME_WIN:
+				labels[ii] = 10
+			case OUTCOME_LOSS:
+				labels[ii] = -10
+			case OUTCOME_DRAW:
+				labels[ii] = 0
+			default:
+				glog.Warningf("Game with unknown outcome can't be labeled without TD(lambda), skipped")
+				return nil, nil, nil
+			}
+		}
+	}
+
+	for ii, action := range game.Actions {
+		board := game.Boards[ii]
+		var actionLabels []float32
+		if !cfg.OneHot && ii < len(game.ActionsLabels) && len(game.ActionsLabels[ii]) == board.NumActions() {
+			actionLabels = game.ActionsLabels[ii]
+		} else if !action.IsSkipAction() {
+			actionLabels = OneHotEncoding(board.NumActions(), board.FindAction(action))
+		}
+		boards = append(boards, board)
+		boardLabels = append(boardLabels, labels[ii])
+		actionsLabels = append(actionsLabels, actionLabels)
+	}
+	return
+}
+
+// LearnFromGames trains the learner with the boards of the games, labeled as
+// configured by cfg (see GameExamples), in batches of cfg.BatchSize boards. It
+// returns the loss averaged over the boards, or 0 if there was nothing to learn.
+func LearnFromGames(learner LearnerScorer, games []GameRecord, cfg LearnConfig) float32 {
+	var boards []*Board
+	var boardLabels []float32
+	var actionsLabels [][]float32
+	for _, game := range games {
+		gameBoards, gameBoardLabels, gameActionsLabels := GameExamples(game, learner, cfg)
+		boards = append(boards, gameBoards...)
+		boardLabels = append(boardLabels, gameBoardLabels...)
+		actionsLabels = append(actionsLabels, gameActionsLabels...)
+	}
+	if len(boards) == 0 {
+		return 0
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(boards)
+	}
+	var sumLoss float32
+	for start := 0; start < len(boards); start += batchSize {
+		end := start + batchSize
+		if end > len(boards) {
+			end = len(boards)
+		}
+		loss := learner.Learn(boards[start:end], boardLabels[start:end], actionsLabels[start:end],
+			cfg.LearningRate, cfg.Steps)
+		sumLoss += loss * float32(end-start)
+	}
+	glog.V(1).Infof("Learned %d boards from %d games", len(boards), len(games))
+	return sumLoss / float32(len(boards))
+}
@@ -0,0 +1,114 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// recordingLearner records the examples of each call to Learn, and returns the
+// number of boards as loss.
+type recordingLearner struct {
+	ai.BatchScorer
+	boards        [][]*Board
+	boardLabels   [][]float32
+	actionsLabels [][][]float32
+}
+
+func (l *recordingLearner) Learn(boards []*Board, boardLabels []float32, actionsLabels [][]float32,
+	learningRate float32, steps int) (loss float32) {
+	l.boards = append(l.boards, boards)
+	l.boardLabels = append(l.boardLabels, boardLabels)
+	l.actionsLabels = append(l.actionsLabels, actionsLabels)
+	return float32(len(boards))
+}
+
+func (l *recordingLearner) Save()          {}
+func (l *recordingLearner) String() string { return "recordingLearner" }
+
+// scriptedGame plays numMoves moves, always taking the first action, and the
+// player to move next resigns.
+func scriptedGame(numMoves int) ai.GameRecord {
+	board := NewBoard()
+	var actions []Action
+	for ii := 0; ii < numMoves; ii++ {
+		actions = append(actions, board.Derived.Actions[0])
+		board = board.Act(board.Derived.Actions[0])
+	}
+	game := ai.NewGameRecord(NewBoard(), actions)
+	game.Resigned = true
+	return game
+}
+
+func TestLearnFromGames(t *testing.T) {
+	games := []ai.GameRecord{scriptedGame(6), scriptedGame(6)}
+	winner := games[0].Winner()
+	// MCTS-like labels for the first board of the second game.
+	initialActions := games[1].Boards[0].NumActions()
+	games[1].ActionsLabels = make([][]float32, len(games[1].Actions))
+	games[1].ActionsLabels[0] = make([]float32, initialActions)
+	for ii := range games[1].ActionsLabels[0] {
+		games[1].ActionsLabels[0][ii] = 1 / float32(initialActions)
+	}
+
+	learner := &recordingLearner{BatchScorer: ai.TrainedBest}
+	loss := ai.LearnFromGames(learner, games, ai.LearnConfig{LearningRate: 1e-3, BatchSize: 5})
+	if len(learner.boards) != 3 || len(learner.boards[0]) != 5 || len(learner.boards[2]) != 2 {
+		t.Fatalf("Got %d batches, wanted batches of 5, 5 and 2 boards", len(learner.boards))
+	}
+	if want := float32(5*5+5*5+2*2) / 12; loss != want {
+		t.Errorf("Got loss %g, wanted the average %g", loss, want)
+	}
+
+	var boards []*Board
+	var boardLabels []float32
+	var actionsLabels [][]float32
+	for ii := range learner.boards {
+		boards = append(boards, learner.boards[ii]...)
+		boardLabels = append(boardLabels, learner.boardLabels[ii]...)
+		actionsLabels = append(actionsLabels, learner.actionsLabels[ii]...)
+	}
+	for ii, board := range boards {
+		game, move := games[ii/6], ii%6
+		if board != game.Boards[move] {
+			t.Errorf("Example #%d is not the board of move %d", ii, move)
+		}
+		wantLabel := float32(-10)
+		if board.NextPlayer == winner {
+			wantLabel = 10
+		}
+		if boardLabels[ii] != wantLabel {
+			t.Errorf("Example #%d: got board label %g, wanted %g", ii, boardLabels[ii], wantLabel)
+		}
+		if len(actionsLabels[ii]) != board.NumActions() {
+			t.Fatalf("Example #%d: got %d actions labels for %d actions", ii, len(actionsLabels[ii]),
+				board.NumActions())
+		}
+		taken := board.FindAction(game.Actions[move])
+		if ii == 6 {
+			// Visit counts are used as given.
+			if actionsLabels[ii][taken] != 1/float32(initialActions) {
+				t.Errorf("Example #%d: visit counts labels not used, got %v", ii, actionsLabels[ii])
+			}
+		} else if actionsLabels[ii][taken] != 1 {
+			t.Errorf("Example #%d: action taken %s not one-hot encoded, got %v", ii, game.Actions[move],
+				actionsLabels[ii])
+		}
+	}
+
+	// With TD(1) the labels are the outcome, from the final board.
+	_, tdLabels, _ := ai.GameExamples(games[0], learner, ai.LearnConfig{UseTDLambda: true, TDLambda: 1})
+	for ii := range tdLabels {
+		if tdLabels[ii] != boardLabels[ii] {
+			t.Errorf("Board #%d: got TD(1) label %g, wanted %g", ii, tdLabels[ii], boardLabels[ii])
+		}
+	}
+
+	// Unfinished games can't be labeled with the outcome.
+	unfinished := scriptedGame(4)
+	unfinished.Resigned = false
+	if boards, _, _ := ai.GameExamples(unfinished, learner, ai.LearnConfig{}); len(boards) != 0 {
+		t.Errorf("Got %d examples for an unfinished game, wanted none", len(boards))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -93,6 +94,58 @@ func (w LinearScorer) String() string {
 	return strings.Join(parts, "")
 }
 
+// FeatureContribution is the contribution of one feature to the score of a
+// board by a LinearScorer, see Explain.
+type FeatureContribution struct {
+	// Name of the feature, with the index within the feature if it has more
+	// than one dimension, e.g. "NumOffboard[3]".
+	Name string
+
+	Value, Weight float32
+
+	// Contribution is Value * Weight.
+	Contribution float32
+}
+
+// Explain returns the contribution of each feature to the score of the board,
+// sorted by decreasing magnitude. The contributions plus the bias (the last
+// weight) add up to UnlimitedScore of the board features: Score only further
+// limits it with SigmoidTo10.
+//
+// Models of older versions only use some of the features, see FeatureVector,
+// and the hashed features, if any (see FeatureHasher), are named "Hashed[i]".
+func (w LinearScorer) Explain(b *Board) (contributions []FeatureContribution) {
+	features := FeatureVector(b, w.Version())
+	contributions = make([]FeatureContribution, 0, len(features))
+	add := func(name string, idx int) {
+		contributions = append(contributions, FeatureContribution{
+			Name: name, Value: features[idx], Weight: w[idx], Contribution: features[idx] * w[idx]})
+	}
+	dense := denseVersion(w.Version())
+	idx := 0
+	for _, fDef := range AllFeatures {
+		if fDef.Version > dense {
+			continue
+		}
+		for ii := 0; ii < fDef.Dim && idx < len(features); ii++ {
+			name := fDef.Name
+			if fDef.Dim > 1 {
+				name = fmt.Sprintf("%s[%d]", fDef.Name, ii)
+			}
+			add(name, idx)
+			idx++
+		}
+	}
+	for ii := 0; idx < len(features); ii++ {
+		add(fmt.Sprintf("Hashed[%d]", ii), idx)
+		idx++
+	}
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return math.Abs(float64(contributions[i].Contribution)) > math.Abs(float64(contributions[j].Contribution))
+	})
+	return
+}
+
 var (
 	cacheLinearScorers = map[string]LinearScorer{}
 	muLinearModels     sync.Mutex
@@ -100,6 +153,14 @@ var (
 
 func (w LinearScorer) Learn(boards []*Board, boardLabels []float32,
 	actionsLabels [][]float32, learningRate float32, steps int) (loss float32) {
+	loss, _ = w.LearnWithExamplesLosses(boards, boardLabels, actionsLabels, nil, learningRate, steps)
+	return
+}
+
+// LearnWithExamplesLosses implements ai.ExamplesLossesLearner.
+func (w LinearScorer) LearnWithExamplesLosses(boards []*Board, boardLabels []float32,
+	actionsLabels [][]float32, weights []float32, learningRate float32, steps int) (
+	loss float32, examplesLosses []float32) {
 	// Bulid features.
 	boardFeatures := make([][]float32, len(boards))
 	for boardIdx, board := range boards {
@@ -107,6 +168,7 @@ func (w LinearScorer) Learn(boards []*Board, boardLabels []float32,
 	}
 
 	var totalLoss float32
+	examplesLosses = make([]float32, len(boards))
 	for step := 0; step < steps || step == 0; step++ {
 		grad := make([]float32, len(w))
 		totalLoss = 0
@@ -117,8 +179,13 @@ func (w LinearScorer) Learn(boards []*Board, boardLabels []float32,
 			score := w.UnlimitedScore(features)
 			loss := boardLabels[boardIdx] - score
 			loss = loss * loss
-			totalLoss += loss
-			c := learningRate * 2 * (boardLabels[boardIdx] - score)
+			examplesLosses[boardIdx] = loss
+			weight := float32(1)
+			if weights != nil {
+				weight = weights[boardIdx]
+			}
+			totalLoss += weight * loss
+			c := weight * learningRate * 2 * (boardLabels[boardIdx] - score)
 			for ii, feature := range features {
 				grad[ii] += c * feature
 			}
@@ -138,7 +205,7 @@ func (w LinearScorer) Learn(boards []*Board, boardLabels []float32,
 			}
 		}
 	}
-	return totalLoss
+	return totalLoss, examplesLosses
 }
 
 func length(vec []float32) float32 {
@@ -211,12 +278,14 @@ func NewLinearScorerFromFile(file string) (w LinearScorer) {
 
 	_, err := os.Stat(file)
 	if os.IsNotExist(err) {
-		// Make fresh copy of TrainedBest
+		// Make fresh copy of TrainedBest: features created after TrainedBest start
+		// with weight 0, and the bias is kept last.
 		w = make(LinearScorer, AllFeaturesDim+1)
 		if TrainedBest.Version() != AllFeaturesDim {
-			glog.Errorf("New model with %d features initialized with current best with %d, it may not make much sense ?", w.Version(), TrainedBest.Version())
+			glog.Warningf("New model with %d features initialized with current best with %d features", w.Version(), TrainedBest.Version())
 		}
-		copy(w, TrainedBest)
+		copy(w, TrainedBest[:TrainedBest.Version()])
+		w[AllFeaturesDim] = TrainedBest[TrainedBest.Version()]
 		glog.V(1).Infof("New model has %d features", w.Version())
 		return
 	}
@@ -367,5 +436,48 @@ var (
 		-0.7409,
 	}
 
-	TrainedBest = TrainedV3
+	TrainedV4 = LinearScorer{
+		// Pieces order: ANT, BEETLE, GRASSHOPPER, QUEEN, SPIDER
+		// NumOffboard -> 5
+		-0.1891, 0.0648, -0.0803, -1.8169, -0.0319,
+
+		// OppNumOffboard -> 5
+		0.2967, 0.0625, 0.2306, 2.2038, 0.1646,
+
+		// NumSurroundingQueen -> 1
+		-2.4521,
+
+		// OppNumSurroundingQueen -> 1
+		2.7604,
+
+		// NumCanMove -> 10
+		0.0065, 0.4391, 0.5519, -0.4833, -0.0156, 0.1361, 0.9591, -0.1592, 0.2405, 0.0343,
+
+		// OppNumCanMove -> 10
+		0.2158, -0.7518, -0.4865, 0.3333, 0.1677, -0.2764, -0.0134, -0.2725, 0.0145, 0.0184,
+
+		// NumThreateningMoves -> 2
+		0.0087, 0.0714,
+
+		// OppNumThreateningMoves -> 2
+		0.1979, 0.0486,
+
+		// MovesToDraw -> 1
+		-0.0074,
+
+		// NumSingle -> 2
+		-0.2442, 0.3755,
+
+		// QueenIsCovered -> 2
+		0, 0, // -10, 10,
+
+		// MobilityAdvantage -> 1
+		// Not trained yet: set by hand to favor the more mobile player.
+		0.5,
+
+		// Bias -> 1
+		-0.7409,
+	}
+
+	TrainedBest = TrainedV4
 )
@@ -0,0 +1,71 @@
+package ai_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestExplain(t *testing.T) {
+	board := NewBoard()
+	for ii := 0; ii < 6; ii++ {
+		board = board.Act(board.Derived.Actions[0])
+	}
+
+	w := ai.TrainedBest
+	contributions := w.Explain(board)
+	if len(contributions) != w.Version() {
+		t.Fatalf("Got %d contributions, wanted one per feature (%d)", len(contributions), w.Version())
+	}
+	sum := w[w.Version()] // Bias.
+	for ii, c := range contributions {
+		if c.Contribution != c.Value*c.Weight {
+			t.Errorf("%s: contribution %g != value %g * weight %g", c.Name, c.Contribution, c.Value, c.Weight)
+		}
+		if ii > 0 && math.Abs(float64(c.Contribution)) > math.Abs(float64(contributions[ii-1].Contribution)) {
+			t.Errorf("Contributions not sorted by magnitude: %s=%g after %s=%g", c.Name, c.Contribution,
+				contributions[ii-1].Name, contributions[ii-1].Contribution)
+		}
+		sum += c.Contribution
+	}
+	want := w.UnlimitedScore(ai.FeatureVector(board, w.Version()))
+	if math.Abs(float64(sum-want)) > 1e-4 {
+		t.Errorf("Contributions plus bias add up to %g, wanted score %g", sum, want)
+	}
+	if score, _ := w.Score(board); score != ai.SigmoidTo10(want) {
+		t.Errorf("Score()=%g, wanted %g", score, ai.SigmoidTo10(want))
+	}
+}
+
+func TestExplainOldVersion(t *testing.T) {
+	board := NewBoard()
+	for ii := 0; ii < 6; ii++ {
+		board = board.Act(board.Derived.Actions[0])
+	}
+
+	// The original features, without OppNumThreateningMoves, which was added
+	// later in the middle of the feature vector.
+	version := ai.FeatureVersions()[0]
+	w := make(ai.LinearScorer, version+1)
+	for ii := range w {
+		w[ii] = float32(ii + 1)
+	}
+	found := false
+	for _, c := range w.Explain(board) {
+		if strings.HasPrefix(c.Name, "OppNumThreateningMoves") {
+			t.Errorf("Version %d doesn't have %s", version, c.Name)
+		}
+		if c.Name == "MovesToDraw" {
+			found = true
+			if want := float32(board.MaxMoves - board.MoveNumber + 1); c.Value != want {
+				t.Errorf("MovesToDraw has value %g, wanted %g", c.Value, want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("MovesToDraw missing from the contributions of version %d", version)
+	}
+}
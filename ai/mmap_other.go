@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package ai
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the first size bytes of the file, where memory-mapping is not
+// supported.
+func mmapFile(file *os.File, size int) (data []byte, unmap func() error, err error) {
+	data = make([]byte, size)
+	if _, err = io.ReadFull(file, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package ai
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of the file for reading.
+func mmapFile(file *os.File, size int) (data []byte, unmap func() error, err error) {
+	data, err = syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,113 @@
+package players
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CURRICULUM_PARAMS are the parameters of NewAIPlayer that a Curriculum can
+// change: the ones that control the strength (and cost) of the search.
+var CURRICULUM_PARAMS = map[string]bool{
+	"max_depth":     true,
+	"max_nodes":     true,
+	"max_traverses": true,
+	"max_time":      true,
+	"randomness":    true,
+}
+
+// CurriculumStage configures the search of the players from a given progress
+// on, measured in games played or training steps.
+type CurriculumStage struct {
+	// Start is the progress where the stage starts.
+	Start int
+
+	// Params are added to (or override) the configuration of the players, see
+	// NewAIPlayer. E.g.: "max_depth=2,max_nodes=5000".
+	Params string
+}
+
+// Curriculum ramps up the strength of the players in self-play: early in
+// training the model is weak and deep searches are mostly wasted compute, so
+// the players search shallower (or with fewer traverses) and get stronger as
+// the training progresses.
+//
+// It is safe for concurrent use.
+type Curriculum struct {
+	// Stages sorted by Start. Before the first stage the players are used
+	// unchanged.
+	Stages []CurriculumStage
+
+	mu      sync.Mutex
+	players map[curriculumKey]*SearcherScorerPlayer
+}
+
+type curriculumKey struct {
+	base  *SearcherScorerPlayer
+	stage int
+}
+
+// ParseCurriculum parses the specification of a Curriculum: a ';' separated list
+// of stages, each "<start>:<params>", with increasing starts, where params are
+// the ones in CURRICULUM_PARAMS, as in NewAIPlayer. E.g.:
+//
+//	"0:max_depth=1;1000:max_depth=2;5000:max_depth=3,max_nodes=20000"
+func ParseCurriculum(spec string) (*Curriculum, error) {
+	c := &Curriculum{}
+	for _, part := range strings.Split(spec, ";") {
+		subparts := strings.SplitN(part, ":", 2)
+		if len(subparts) != 2 {
+			return nil, fmt.Errorf("Failed to parse curriculum stage '%s', want '<start>:<params>'", part)
+		}
+		start, err := strconv.Atoi(subparts[0])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("Failed to parse start of curriculum stage '%s': %v", part, err)
+		}
+		if len(c.Stages) > 0 && start <= c.Stages[len(c.Stages)-1].Start {
+			return nil, fmt.Errorf("Curriculum stage '%s' doesn't start after the previous one", part)
+		}
+		for key := range parseConfig(subparts[1]) {
+			if !CURRICULUM_PARAMS[key] {
+				return nil, fmt.Errorf("Parameter '%s' of curriculum stage '%s' is not a search parameter", key, part)
+			}
+		}
+		c.Stages = append(c.Stages, CurriculumStage{Start: start, Params: subparts[1]})
+	}
+	return c, nil
+}
+
+// Stage returns the index of the stage for the given progress, or -1 if it is
+// before the first stage.
+func (c *Curriculum) Stage(progress int) int {
+	stage := -1
+	for ii, s := range c.Stages {
+		if progress < s.Start {
+			break
+		}
+		stage = ii
+	}
+	return stage
+}
+
+// Player returns the base player configured for the stage of the given progress
+// (see SearcherScorerPlayer.WithSearchParams). Players are created once per base
+// player and stage.
+func (c *Curriculum) Player(base *SearcherScorerPlayer, progress int) *SearcherScorerPlayer {
+	stage := c.Stage(progress)
+	if stage < 0 {
+		return base
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := curriculumKey{base, stage}
+	if player, ok := c.players[key]; ok {
+		return player
+	}
+	if c.players == nil {
+		c.players = make(map[curriculumKey]*SearcherScorerPlayer)
+	}
+	player := base.WithSearchParams(c.Stages[stage].Params)
+	c.players[key] = player
+	return player
+}
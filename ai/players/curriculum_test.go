@@ -0,0 +1,95 @@
+package players_test
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// countingScorer counts the boards scored.
+type countingScorer struct {
+	ai.BatchScorer
+	count int64
+}
+
+func (s *countingScorer) Score(b *Board) (float32, []float32) {
+	atomic.AddInt64(&s.count, 1)
+	return s.BatchScorer.Score(b)
+}
+
+func (s *countingScorer) BatchScore(boards []*Board) ([]float32, [][]float32) {
+	atomic.AddInt64(&s.count, int64(len(boards)))
+	return s.BatchScorer.BatchScore(boards)
+}
+
+func TestParseCurriculum(t *testing.T) {
+	c, err := ParseCurriculum("10:max_depth=1;100:max_depth=2;1000:max_depth=3,max_nodes=5000")
+	if err != nil {
+		t.Fatalf("ParseCurriculum failed: %v", err)
+	}
+	for _, tc := range []struct{ progress, stage int }{
+		{0, -1}, {9, -1}, {10, 0}, {99, 0}, {100, 1}, {1000, 2}, {1000000, 2},
+	} {
+		if got := c.Stage(tc.progress); got != tc.stage {
+			t.Errorf("Stage(%d)=%d, wanted %d", tc.progress, got, tc.stage)
+		}
+	}
+	if c.Stages[2].Params != "max_depth=3,max_nodes=5000" {
+		t.Errorf("Got params %q for the last stage", c.Stages[2].Params)
+	}
+
+	for _, spec := range []string{
+		"",
+		"max_depth=1",
+		"x:max_depth=1",
+		"0:max_depth=1;0:max_depth=2",
+		"10:max_depth=2;5:max_depth=1",
+		"0:model=foo",
+	} {
+		if _, err := ParseCurriculum(spec); err == nil {
+			t.Errorf("ParseCurriculum(%q) should have failed", spec)
+		}
+	}
+}
+
+func TestCurriculumDepth(t *testing.T) {
+	c, err := ParseCurriculum("0:max_depth=1;10:max_depth=2;20:max_depth=3")
+	if err != nil {
+		t.Fatalf("ParseCurriculum failed: %v", err)
+	}
+	base := NewAIPlayer("ab,max_depth=1", false)
+	scorer := &countingScorer{BatchScorer: base.Scorer}
+	base.Scorer = scorer
+
+	// Board after a few moves, so no action is forced.
+	rng := rand.New(rand.NewSource(3))
+	board := NewBoard()
+	for ii := 0; ii < 6; ii++ {
+		board = board.Act(board.Derived.Actions[rng.Intn(len(board.Derived.Actions))])
+	}
+
+	// The deeper the search, the more boards are scored.
+	previous := int64(0)
+	for _, progress := range []int{5, 15, 25} {
+		player := c.Player(base, progress)
+		if player.Scorer != base.Scorer {
+			t.Fatalf("Progress %d: player doesn't share the scorer of the base player", progress)
+		}
+		if again := c.Player(base, progress+1); again != player {
+			t.Errorf("Progress %d: player of the same stage was created again", progress)
+		}
+		atomic.StoreInt64(&scorer.count, 0)
+		player.Play(board)
+		count := atomic.LoadInt64(&scorer.count)
+		t.Logf("Progress %d (%s): %d boards scored", progress, player, count)
+		if count <= previous {
+			t.Errorf("Progress %d: %d boards scored, wanted more than the previous stage (%d)",
+				progress, count, previous)
+		}
+		previous = count
+	}
+}
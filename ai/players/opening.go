@@ -0,0 +1,106 @@
+package players
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// LoadOpenings reads openings, one per line, each given by its actions in the
+// notation of Action.Notation separated by spaces, e.g. "G@0,0 A@0,1 Q@0,-1".
+// Empty lines and lines starting with "#" are ignored. The actions are not
+// checked against any board, see PlayOpening.
+func LoadOpenings(r io.Reader) (openings [][]Action, err error) {
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var opening []Action
+		for _, notation := range strings.Fields(line) {
+			action, err := ParseAction(notation)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse opening in line %d: %v", lineNum, err)
+			}
+			opening = append(opening, action)
+		}
+		openings = append(openings, opening)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read openings: %v", err)
+	}
+	return
+}
+
+// PlayOpening plays the opening actions starting from the initial board, and
+// returns the record of the game so far, with the one-hot encoding of the
+// actions as labels. It returns an error if an action is not legal, or if the
+// game finishes within the opening.
+func PlayOpening(initial *Board, opening []Action) (game ai.GameRecord, err error) {
+	board := initial
+	game.Boards = []*Board{board}
+	for ii, action := range opening {
+		if board.IsFinished() {
+			return game, fmt.Errorf("Game finished before opening action #%d (%s)", ii, action)
+		}
+		var actionLabels []float32
+		if action.IsSkipAction() {
+			if board.NumActions() != 0 {
+				return game, fmt.Errorf("Opening action #%d passes, but there are %d actions available",
+					ii, board.NumActions())
+			}
+		} else {
+			idx := -1
+			for jj, boardAction := range board.Derived.Actions {
+				if action.Equal(boardAction) {
+					idx = jj
+					break
+				}
+			}
+			if idx < 0 {
+				return game, fmt.Errorf("Opening action #%d (%s) is not legal", ii, action)
+			}
+			action = board.Derived.Actions[idx]
+			actionLabels = ai.OneHotEncoding(board.NumActions(), idx)
+		}
+		board = board.Act(action)
+		game.Actions = append(game.Actions, action)
+		game.Boards = append(game.Boards, board)
+		game.ActionsLabels = append(game.ActionsLabels, actionLabels)
+	}
+	if board.IsFinished() {
+		return game, fmt.Errorf("Game finished within the opening")
+	}
+	return
+}
+
+// SelfPlayFromOpening is like SelfPlay, but the players only take over after the
+// opening actions are played (see PlayOpening). The returned game includes the
+// opening, whose actions are scored 0: openings are presumed to be balanced.
+//
+// Playing each opening twice, with the players swapped, compares them without
+// the variance of the openings they would choose.
+func SelfPlayFromOpening(initial *Board, opening []Action, players [NUM_PLAYERS]Player, maxMoves int,
+	resign *Resign, adjudicate *Adjudicate, onAction func(action Action, board *Board, score float32) bool) (
+	game ai.GameRecord, scores []float32, err error) {
+	game, err = PlayOpening(initial, opening)
+	if err != nil {
+		return
+	}
+	scores = make([]float32, len(game.Actions))
+	rest, restScores := SelfPlay(game.FinalBoard(), players, maxMoves, resign, adjudicate, onAction)
+	game.Boards = append(game.Boards, rest.Boards[1:]...)
+	game.Actions = append(game.Actions, rest.Actions...)
+	game.ActionsLabels = append(game.ActionsLabels, rest.ActionsLabels...)
+	game.Capped, game.Resigned, game.Adjudicated = rest.Capped, rest.Resigned, rest.Adjudicated
+	game.Seed = rest.Seed
+	scores = append(scores, restScores...)
+	return
+}
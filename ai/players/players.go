@@ -2,9 +2,14 @@
 package players
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -15,6 +20,28 @@ import (
 
 var _ = log.Printf
 
+var flag_logScores = flag.String("log_scores", "",
+	"If set, every board scored by the AI players, with its score and most probable actions, is appended "+
+		"to the given file as one line of JSON (see ai.ScoreLogRecord). It is high-volume, meant for debugging.")
+
+var (
+	scoreLogOnce sync.Once
+	scoreLog     io.Writer
+)
+
+// scoreLogWriter returns the file given by --log_scores, opened once and shared
+// by all players.
+func scoreLogWriter() io.Writer {
+	scoreLogOnce.Do(func() {
+		file, err := os.OpenFile(*flag_logScores, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Panicf("Failed to open --log_scores=%s: %v", *flag_logScores, err)
+		}
+		scoreLog = file
+	})
+	return scoreLog
+}
+
 // Player is anything that is able to play the game.
 type Player interface {
 	// Play returns the action chosen, the next board position and the associated score predicted.
@@ -29,15 +56,86 @@ type SearcherScorerPlayer struct {
 	Learner      ai.LearnerScorer
 	ModelFile    string
 	Parallelized bool
+
+	// Config used to create the player with NewAIPlayer.
+	Config string
+
+	// LabelSmoothing is the epsilon used to smooth the actions labels returned by
+	// Play, see ai.SmoothLabels.
+	LabelSmoothing float32
+
+	// TreeFile, if set, is where the tree of the search of move TreeMove (or of
+	// every move, overwriting it, if TreeMove < 0) is written as a Graphviz DOT
+	// graph, limited by TreeRecorder. Only for searchers that implement
+	// search.TreeSearcher.
+	TreeFile     string
+	TreeMove     int
+	TreeRecorder *search.TreeRecorder
+
+	// treeMu serializes the searches that record the tree, if the player is
+	// used concurrently.
+	treeMu sync.Mutex
+}
+
+// String identifies the player by its configuration.
+func (p *SearcherScorerPlayer) String() string {
+	if p.Config == "" {
+		return "AI player (default configuration)"
+	}
+	return fmt.Sprintf("AI player (%s)", p.Config)
 }
 
 // Play implements the Player interface: it chooses an action given a Board.
+// If the outcome of the move is already decided (immediate win, or only one move
+// that doesn't lose), the search is skipped.
 func (p *SearcherScorerPlayer) Play(b *Board) (action Action, board *Board, score float32, actionsLabels []float32) {
-	action, board, score, actionsLabels = p.Searcher.Search(b)
-	glog.V(1).Infof("Move #%d: AI playing %v, score=%.3f", board.MoveNumber-1, action, score)
+	var found bool
+	action, board, score, actionsLabels, found = search.ForcedAction(b, p.Scorer)
+	if found {
+		glog.V(1).Infof("Move #%d: AI playing forced %v, score=%.3f", b.MoveNumber, action, score)
+	} else if treeSearcher, ok := p.Searcher.(search.TreeSearcher); ok && p.dumpTree(b) {
+		p.treeMu.Lock()
+		action, board, score, actionsLabels = treeSearcher.SearchWithTree(b, p.TreeRecorder)
+		p.writeTree(b)
+		p.treeMu.Unlock()
+		glog.V(1).Infof("Move #%d: AI playing %v, score=%.3f", board.MoveNumber-1, action, score)
+	} else {
+		action, board, score, actionsLabels = p.Searcher.Search(b)
+		glog.V(1).Infof("Move #%d: AI playing %v, score=%.3f", board.MoveNumber-1, action, score)
+	}
+	actionsLabels = ai.SmoothLabels(actionsLabels, p.LabelSmoothing)
+	if recorder, ok := p.Scorer.(*ai.CalibrationRecorder); ok {
+		recorder.RecordMove(b, score)
+	}
 	return
 }
 
+// dumpTree returns whether the tree of the search of the board should be written
+// to TreeFile.
+func (p *SearcherScorerPlayer) dumpTree(b *Board) bool {
+	return p.TreeFile != "" && (p.TreeMove < 0 || p.TreeMove == b.MoveNumber)
+}
+
+// writeTree writes the tree recorded by the search of the board to TreeFile.
+// Failures are only logged: it's a debugging aid.
+func (p *SearcherScorerPlayer) writeTree(b *Board) {
+	f, err := os.Create(p.TreeFile)
+	if err != nil {
+		glog.Errorf("Failed to create dump_tree=%s: %v", p.TreeFile, err)
+		return
+	}
+	if err = p.TreeRecorder.WriteDOT(f); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		glog.Errorf("Failed to write dump_tree=%s: %v", p.TreeFile, err)
+		return
+	}
+	glog.Infof("Search tree of move #%d written to %s", b.MoveNumber, p.TreeFile)
+}
+
 // External model registration functions.
 type PlayerModuleInitFn func() (data interface{})
 type PlayerParameterFn func(data interface{}, key, value string)
@@ -80,6 +178,40 @@ func RegisterPlayerParameter(module, key string, initFn PlayerModuleInitFn, para
 //         distributed according to a softmax of the scores of each move, divided by this value.
 //         So lower values (closer to 0) means less randomness, higher value means more randomness,
 //         hence more exploration.
+//       * mcts_temperature: Temperature used to convert MCTS visit counts to the actions labels
+//         used for training. 1 (default) makes them proportional to the visits, values close to
+//         0 approach the one-hot encoding of the most visited action.
+//       * label_smoothing: Epsilon of probability mass of the actions labels (used for
+//         training) moved to the actions not chosen, e.g. 0.03, see ai.SmoothLabels.
+//         Must be below ai.MAX_LABEL_SMOOTHING, so the action chosen keeps the largest
+//         label. Defaults to 0.
+//       * handicap: Integer >= 0 that weakens the AI, for more enjoyable games against humans.
+//         Each level reduces the search (depth for ab, traverses for mcts) and adds randomness
+//         to the choice of move. See ApplyHandicap.
+//       * max_nodes: Budget of nodes (boards scored) of each alpha-beta-prunning search: it
+//         deepens iteratively up to max_depth, and the deepest search completed within the
+//         budget is used. Unlike max_time, the move chosen doesn't depend on the hardware.
+//         Not supported by mcts, see max_traverses.
+//       * tie_break: Policy to choose among the actions with the same score in alpha-beta-prunning:
+//         "first" (default), "random" or "prefer_development", see search.TieBreak.
+//       * tie_break_seed: Seed of the "random" tie_break policy, for reproducible games.
+//         Defaults to a seed based on the time.
+//       * calibrate: Records the scores of the moves played, to pair them with the outcomes of
+//         the games and calibrate ai.ValueToWinProb, see ai.CalibrationRecorder.
+//       * pure_go: File with an ai.PureGoScorer, exported from a TensorFlow model with
+//         trainer --export_pure_go. It scores boards without TensorFlow, but it can't learn.
+//       * tablebase: Number of plies solved exactly near the end of the game, see
+//         search.Tablebase. Defaults to 0, which disables it.
+//       * repetition_penalty: Penalty subtracted from the score of the moves that return
+//         to a position already seen in the game, to avoid self-play games looping until
+//         the max number of moves. See search.NewRepetitionSearcher. Defaults to 0, which
+//         disables it: it shouldn't be used in ranked play.
+//       * dump_tree: File where the tree searched for a move is written as a Graphviz DOT
+//         graph, to debug the choice of the move. See search.TreeRecorder.
+//       * dump_tree_move: Move number whose tree is written by dump_tree. Defaults to every
+//         move, each overwriting the file.
+//       * dump_tree_depth, dump_tree_breadth: Limits of the tree written by dump_tree: levels
+//         below the root, and children per node. Default to 2 and 10.
 //
 func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 	// Initialize external modules data.
@@ -89,20 +221,7 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 	}
 
 	// Break config in parts.
-	params := make(map[string]string)
-	parts := strings.Split(config, ",")
-	if len(parts) > 1 || parts[0] != "" {
-		for _, part := range parts {
-			subparts := strings.Split(part, "=")
-			if len(subparts) == 1 {
-				params[subparts[0]] = ""
-			} else if len(subparts) == 2 {
-				params[subparts[0]] = subparts[1]
-			} else {
-				log.Panicf("In AI configuration: cannot parse '%s'", part)
-			}
-		}
-	}
+	params := parseConfig(config)
 
 	// External modules parsing.
 	paramsLeft := make(map[string]string)
@@ -117,7 +236,7 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 	params = paramsLeft
 
 	// Shared parameters.
-	player := &SearcherScorerPlayer{Parallelized: parallelized}
+	player := &SearcherScorerPlayer{Parallelized: parallelized, Config: config}
 	if value, ok := params["model"]; ok {
 		player.ModelFile = value
 		delete(params, "model")
@@ -129,14 +248,91 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 		finalFn(data, player)
 	}
 
+	// Pure Go scorer, exported from a TensorFlow model.
+	if value, ok := params["pure_go"]; ok {
+		delete(params, "pure_go")
+		if player.Scorer != nil {
+			log.Panicf("pure_go cannot be used along with another model (e.g. tf)")
+		}
+		pure, err := ai.LoadPureGoScorer(value)
+		if err != nil {
+			log.Panicf("Invalid pure_go model: %v", err)
+		}
+		player.Scorer = pure
+	}
+
 	// Default scorer.
 	if player.Scorer == nil {
 		player.Learner = ai.NewLinearScorerFromFile(player.ModelFile)
 		player.Scorer = player.Learner
 	}
+	if *flag_logScores != "" {
+		player.Scorer = ai.NewScoreLogger(player.Scorer, scoreLogWriter())
+	}
+	if _, ok := params["calibrate"]; ok {
+		delete(params, "calibrate")
+		player.Scorer = ai.NewCalibrationRecorder(player.Scorer)
+	}
+	configureSearcher(player, params)
+	return player
+}
 
-	// Configure searcher.
+// parseConfig breaks the configuration string of NewAIPlayer in its parameters.
+// If a parameter is repeated, the last value is used.
+func parseConfig(config string) map[string]string {
+	params := make(map[string]string)
+	parts := strings.Split(config, ",")
+	if len(parts) > 1 || parts[0] != "" {
+		for _, part := range parts {
+			subparts := strings.Split(part, "=")
+			if len(subparts) == 1 {
+				params[subparts[0]] = ""
+			} else if len(subparts) == 2 {
+				params[subparts[0]] = subparts[1]
+			} else {
+				log.Panicf("In AI configuration: cannot parse '%s'", part)
+			}
+		}
+	}
+	return params
+}
+
+// WithSearchParams returns a copy of the player with the searcher rebuilt from its
+// Config, with the given parameters (e.g. "max_depth=2,max_nodes=1000") added or
+// overridden. The scorer and learner are shared with p, so no model is loaded.
+func (p *SearcherScorerPlayer) WithSearchParams(overrides string) *SearcherScorerPlayer {
+	config := overrides
+	if p.Config != "" {
+		config = p.Config + "," + overrides
+	}
+	params := parseConfig(config)
+	for key := range params {
+		if _, ok := keywordToModule[key]; ok {
+			delete(params, key)
+		}
+	}
+	for _, key := range []string{"model", "pure_go", "calibrate"} {
+		delete(params, key)
+	}
+	player := &SearcherScorerPlayer{
+		Scorer:       p.Scorer,
+		Learner:      p.Learner,
+		ModelFile:    p.ModelFile,
+		Parallelized: p.Parallelized,
+		Config:       config,
+	}
+	configureSearcher(player, params)
+	return player
+}
+
+// configureSearcher creates the searcher of the player (and sets its search
+// related fields) from the parameters left after the scorer was configured. It
+// panics if any parameter is not known.
+func configureSearcher(player *SearcherScorerPlayer, params map[string]string) {
+	// Configure searcher: newSearcher creates it for the given scorer, see
+	// search.NewRepetitionSearcher.
 	var searcher search.Searcher
+	var newSearcher func(scorer ai.BatchScorer) search.Searcher
 	var err error
 
 	// Shared search algorithm parameters
@@ -146,6 +342,7 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 	maxScore := float32(10.0)
 	randomness := 0.0
 	cPuct := float32(3.0) // Specialized for Alpha0-MCTS.
+	temperature := 1.0    // Specialized for Alpha0-MCTS.
 
 	if value, ok := params["max_depth"]; ok {
 		delete(params, "max_depth")
@@ -176,6 +373,14 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 			log.Panicf("Invalid AI value '%s' for max_traverse: %s", value, err)
 		}
 	}
+	maxNodes := 0
+	if value, ok := params["max_nodes"]; ok {
+		delete(params, "max_nodes")
+		maxNodes, err = strconv.Atoi(value)
+		if err != nil || maxNodes <= 0 {
+			log.Panicf("Invalid AI value '%s' for max_nodes: %s", value, err)
+		}
+	}
 	if value, ok := params["max_score"]; ok {
 		delete(params, "max_score")
 		v64, err := strconv.ParseFloat(value, 64)
@@ -192,37 +397,158 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 		}
 		cPuct = float32(v64)
 	}
+	if value, ok := params["mcts_temperature"]; ok {
+		delete(params, "mcts_temperature")
+		temperature, err = strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0.0 {
+			log.Panicf("Invalid mcts_temperature value '%s': %s", value, err)
+		}
+	}
+
+	if value, ok := params["label_smoothing"]; ok {
+		delete(params, "label_smoothing")
+		v64, err := strconv.ParseFloat(value, 64)
+		if err != nil || v64 < 0.0 || v64 >= ai.MAX_LABEL_SMOOTHING {
+			log.Panicf("Invalid label_smoothing value '%s', it must be in [0, %g): %v", value,
+				ai.MAX_LABEL_SMOOTHING, err)
+		}
+		player.LabelSmoothing = float32(v64)
+	}
+
+	player.TreeFile, player.TreeMove = "", -1
+	treeDepth, treeBreadth := 2, 10
+	if value, ok := params["dump_tree"]; ok {
+		delete(params, "dump_tree")
+		if value == "" {
+			log.Panicf("dump_tree requires a file name")
+		}
+		player.TreeFile = value
+	}
+	if value, ok := params["dump_tree_move"]; ok {
+		delete(params, "dump_tree_move")
+		player.TreeMove, err = strconv.Atoi(value)
+		if err != nil || player.TreeMove < 0 {
+			log.Panicf("Invalid dump_tree_move value '%s': %v", value, err)
+		}
+	}
+	if value, ok := params["dump_tree_depth"]; ok {
+		delete(params, "dump_tree_depth")
+		treeDepth, err = strconv.Atoi(value)
+		if err != nil || treeDepth < 1 {
+			log.Panicf("Invalid dump_tree_depth value '%s': %v", value, err)
+		}
+	}
+	if value, ok := params["dump_tree_breadth"]; ok {
+		delete(params, "dump_tree_breadth")
+		treeBreadth, err = strconv.Atoi(value)
+		if err != nil || treeBreadth < 1 {
+			log.Panicf("Invalid dump_tree_breadth value '%s': %v", value, err)
+		}
+	}
+	if player.TreeFile != "" {
+		player.TreeRecorder = search.NewTreeRecorder(treeDepth, treeBreadth)
+	}
+
+	handicap := 0
+	if value, ok := params["handicap"]; ok {
+		delete(params, "handicap")
+		handicap, err = strconv.Atoi(value)
+		if err != nil || handicap < 0 {
+			log.Panicf("Invalid handicap value '%s': %s", value, err)
+		}
+	}
+
+	tieBreak := search.TIE_BREAK_FIRST
+	if value, ok := params["tie_break"]; ok {
+		delete(params, "tie_break")
+		tieBreak, err = search.ParseTieBreak(value)
+		if err != nil {
+			log.Panicf("Invalid tie_break value '%s': %v", value, err)
+		}
+	}
+	tieBreakSeed := time.Now().UnixNano()
+	if value, ok := params["tie_break_seed"]; ok {
+		delete(params, "tie_break_seed")
+		tieBreakSeed, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Panicf("Invalid tie_break_seed value '%s': %v", value, err)
+		}
+	}
+
+	// Endgame tablebase: number of plies solved exactly near the end of the game.
+	tablebasePlies := 0
+	if value, ok := params["tablebase"]; ok {
+		delete(params, "tablebase")
+		tablebasePlies, err = strconv.Atoi(value)
+		if err != nil || tablebasePlies < 0 {
+			log.Panicf("Invalid tablebase value '%s': %s", value, err)
+		}
+	}
+
+	repetitionPenalty := float32(0)
+	if value, ok := params["repetition_penalty"]; ok {
+		delete(params, "repetition_penalty")
+		v64, err := strconv.ParseFloat(value, 64)
+		if err != nil || v64 < 0.0 {
+			log.Panicf("Invalid repetition_penalty value '%s': %v", value, err)
+		}
+		repetitionPenalty = float32(v64)
+	}
 
 	if _, ok := params["mcts"]; ok {
 		delete(params, "mcts")
+		if maxNodes > 0 {
+			log.Panicf("max_nodes is not supported by mcts, use max_traverses instead")
+		}
+		if tieBreak != search.TIE_BREAK_FIRST {
+			log.Panicf("tie_break is not supported by mcts")
+		}
 		if maxDepth < 0 {
 			maxDepth = 8
 		}
 		if maxTime == 0 {
 			maxTime = 5 * time.Second
 		}
-		searcher = search.NewMonteCarloTreeSearcher(
-			player.Scorer, maxDepth, maxTime, maxTraverses, maxScore,
-			cPuct, randomness, player.Parallelized)
+		if handicap > 0 {
+			maxTraverses = maxTraverses/(1+handicap) + 1
+			_, randomness = ApplyHandicap(handicap, maxDepth, randomness)
+		}
+		newSearcher = func(scorer ai.BatchScorer) search.Searcher {
+			return search.NewMonteCarloTreeSearcher(
+				scorer, maxDepth, maxTime, maxTraverses, maxScore,
+				cPuct, randomness, temperature, player.Parallelized)
+		}
 	}
 	if _, ok := params["ab"]; ok {
 		delete(params, "ab")
 		// Since it is default, no need to do anything.
-		searcher = nil
+		newSearcher = nil
 	}
-	if searcher == nil {
+	if newSearcher == nil {
 		if maxDepth < 0 {
 			maxDepth = 3
 		}
+		maxDepth, randomness = ApplyHandicap(handicap, maxDepth, randomness)
 
-		if randomness <= 0 {
-			searcher = search.NewAlphaBetaSearcher(maxDepth, player.Parallelized, player.Scorer)
-		} else {
+		tieBreaker := search.NewTieBreaker(tieBreak, tieBreakSeed)
+		newSearcher = func(scorer ai.BatchScorer) search.Searcher {
+			if randomness <= 0 {
+				return search.NewAlphaBetaSearcherWithTieBreak(maxDepth, maxNodes, player.Parallelized, scorer,
+					tieBreaker)
+			}
 			// Randomized searcher.
-			searcher = search.NewAlphaBetaSearcher(maxDepth, false, player.Scorer)
-			searcher = search.NewRandomizedSearcher(searcher, player.Scorer, randomness)
+			searcher := search.NewAlphaBetaSearcherWithTieBreak(maxDepth, maxNodes, false, scorer, tieBreaker)
+			return search.NewRandomizedSearcher(searcher, scorer, randomness)
 		}
 	}
+	if repetitionPenalty > 0 {
+		searcher = search.NewRepetitionSearcher(newSearcher, player.Scorer, repetitionPenalty)
+	} else {
+		searcher = newSearcher(player.Scorer)
+	}
+	if tablebasePlies > 0 {
+		searcher = search.NewTablebaseSearcher(searcher, search.NewTablebase(tablebasePlies))
+	}
 
 	// Check that all parameters were processed.
 	if len(params) > 0 {
@@ -232,6 +558,23 @@ func NewAIPlayer(config string, parallelized bool) *SearcherScorerPlayer {
 		panic("Cannot continue")
 	}
 	player.Searcher = searcher
+}
 
-	return player
+// HANDICAP_RANDOMNESS is the randomness added to the choice of move per level of
+// handicap. Scores range from -10 to 10.
+const HANDICAP_RANDOMNESS = 0.25
+
+// ApplyHandicap weakens the search parameters: each two levels of handicap reduce
+// the depth by one (but never below 1), and each level adds HANDICAP_RANDOMNESS to
+// the randomness of the choice of move.
+func ApplyHandicap(handicap, maxDepth int, randomness float64) (int, float64) {
+	if handicap <= 0 {
+		return maxDepth, randomness
+	}
+	maxDepth -= (handicap + 1) / 2
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+	randomness += HANDICAP_RANDOMNESS * float64(handicap)
+	return maxDepth, randomness
 }
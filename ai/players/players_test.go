@@ -0,0 +1,664 @@
+package players_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+type PieceLayout struct {
+	pos    Pos
+	player uint8
+	piece  Piece
+}
+
+func buildBoard(layout []PieceLayout) (b *Board) {
+	b = NewBoard()
+	for _, p := range layout {
+		b.StackPiece(p.pos, p.player, p.piece)
+		b.SetAvailable(p.player, p.piece, b.Available(p.player, p.piece)-1)
+	}
+	return
+}
+
+// failingSearcher fails the test if a search is attempted.
+type failingSearcher struct {
+	t *testing.T
+}
+
+func (s failingSearcher) Search(b *Board) (Action, *Board, float32, []float32) {
+	s.t.Fatalf("Search should not have been called for move #%d", b.MoveNumber)
+	return Action{}, nil, 0, nil
+}
+
+func (s failingSearcher) ScoreMatch(b *Board, actions []Action, want []*Board) ([]float32, [][]float32) {
+	s.t.Fatalf("ScoreMatch should not have been called")
+	return nil, nil
+}
+
+func TestPlayMateInOne(t *testing.T) {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{2, 1}, 0, SPIDER},
+		{Pos{-2, 2}, 1, GRASSHOPPER},
+		{Pos{1, 1}, 0, SPIDER},
+		{Pos{-1, 2}, 1, SPIDER},
+		{Pos{2, 0}, 0, ANT},
+		{Pos{1, -1}, 0, ANT},
+	})
+	board.NextPlayer = 1
+	board.BuildDerived()
+
+	player := &SearcherScorerPlayer{Searcher: failingSearcher{t}, Scorer: ai.TrainedBest}
+	action, newBoard, score, _ := player.Play(board)
+	want := Action{Move: true, Piece: GRASSHOPPER, SourcePos: Pos{-2, 2}, TargetPos: Pos{0, 1}}
+	if !reflect.DeepEqual(want, action) {
+		t.Errorf("Wanted %s, got %s -> score=%.2f", want, action, score)
+	}
+	if !newBoard.IsFinished() || newBoard.Winner() != 1 {
+		t.Errorf("Expected player 1 to win after %s", action)
+	}
+	if score <= 0 {
+		t.Errorf("Expected positive score for the mating move, got %.2f", score)
+	}
+}
+
+func TestPlayRecordsCalibration(t *testing.T) {
+	start := NewBoard()
+	board := start
+	recorder := ai.NewCalibrationRecorder(ai.BatchScorerWrapper{Scorer: ai.TrainedBest})
+	player := NewAIPlayer("ab,max_depth=1", false)
+	player.Scorer = recorder
+	var actions []Action
+	for ii := 0; ii < 4; ii++ {
+		var action Action
+		action, board, _, _ = player.Play(board)
+		actions = append(actions, action)
+	}
+	game := ai.NewGameRecord(start, actions)
+	game.Resigned = true
+	recorder.GameFinished(&game)
+	count := 0
+	for _, bin := range recorder.Histogram() {
+		count += bin.Count
+	}
+	if count != len(actions) {
+		t.Errorf("Recorded %d scores, wanted one per move played (%d)", count, len(actions))
+	}
+}
+
+func TestNewAIPlayerDistinctConfigs(t *testing.T) {
+	p0 := NewAIPlayer("ab,max_depth=1", false)
+	p1 := NewAIPlayer("mcts,max_traverses=10", false)
+	if p0 == p1 {
+		t.Fatalf("Different configurations should create different players")
+	}
+	if p0.String() == p1.String() {
+		t.Errorf("Players with different configurations have the same description %q", p0.String())
+	}
+	if reflect.TypeOf(p0.Searcher) == reflect.TypeOf(p1.Searcher) {
+		t.Errorf("Players should use different searchers, got %T for both", p0.Searcher)
+	}
+}
+
+func TestLabelSmoothing(t *testing.T) {
+	player := NewAIPlayer("ab,max_depth=1,label_smoothing=0.03", false)
+	if player.LabelSmoothing != 0.03 {
+		t.Fatalf("Expected LabelSmoothing=0.03, got %g", player.LabelSmoothing)
+	}
+	board := NewBoard()
+	action, _, _, labels := player.Play(board)
+	if len(labels) != board.NumActions() {
+		t.Fatalf("Got %d actions labels, wanted %d", len(labels), board.NumActions())
+	}
+	for ii, label := range labels {
+		if label <= 0 || (board.Derived.Actions[ii] == action) != (label > 0.9) {
+			t.Errorf("Action %s has label %g, wanted smoothed one-hot labels for %s",
+				board.Derived.Actions[ii], label, action)
+		}
+	}
+
+	// With 2 actions, label_smoothing=0.5 would leave the action taken with no
+	// more mass than the other one.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("label_smoothing=0.5 should be rejected")
+			}
+		}()
+		NewAIPlayer("ab,max_depth=1,label_smoothing=0.5", false)
+	}()
+}
+
+func TestApplyHandicap(t *testing.T) {
+	if depth, randomness := ApplyHandicap(0, 3, 0); depth != 3 || randomness != 0 {
+		t.Errorf("No handicap changed parameters to depth=%d, randomness=%g", depth, randomness)
+	}
+	if depth, randomness := ApplyHandicap(3, 3, 0.1); depth != 1 || randomness != 0.1+3*HANDICAP_RANDOMNESS {
+		t.Errorf("handicap=3: got depth=%d, randomness=%g", depth, randomness)
+	}
+	if depth, _ := ApplyHandicap(10, 3, 0); depth != 1 {
+		t.Errorf("handicap=10: got depth=%d, wanted at least 1", depth)
+	}
+}
+
+// playMatch plays a match, the way the trainer does, and returns the winner, or
+// -1 for a draw.
+func playMatch(players [2]Player, maxMoves int, seed int64) int {
+	board := NewBoard().WithSeed(seed)
+	board.MaxMoves = maxMoves
+	for !board.IsFinished() {
+		if len(board.Derived.Actions) == 0 {
+			board = board.Act(SKIP_ACTION)
+			continue
+		}
+		_, board, _, _ = players[board.NextPlayer].Play(board)
+	}
+	if board.Draw() {
+		return -1
+	}
+	return int(board.Winner())
+}
+
+// matchResults plays numMatches matches of the strong player against the
+// opponent, alternating who starts, and returns the number of matches the strong
+// player won and lost. Draws count as neither.
+func matchResults(strong, opponent Player, numMatches, maxMoves int) (wins, losses int) {
+	for ii := 0; ii < numMatches; ii++ {
+		players := [2]Player{strong, opponent}
+		strongIdx := 0
+		if ii%2 == 1 {
+			players[0], players[1] = opponent, strong
+			strongIdx = 1
+		}
+		switch playMatch(players, maxMoves, int64(ii+1)) {
+		case -1:
+		case strongIdx:
+			wins++
+		default:
+			losses++
+		}
+	}
+	return
+}
+
+func TestHandicapLowersWinRate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping matches in short mode")
+	}
+	// The matches are seeded (see playMatch), and the players draw their randomness
+	// from the board, so the result is reproducible. Depth 1 and short matches keep
+	// the test fast, so the handicap is large enough for most moves to be random.
+	const numMatches, maxMoves = 4, 30
+	wins, losses := matchResults(NewAIPlayer("ab,max_depth=1", false),
+		NewAIPlayer("ab,max_depth=1,handicap=20", false), numMatches, maxMoves)
+	t.Logf("Against handicap=20: %d wins, %d losses, %d draws", wins, losses, numMatches-wins-losses)
+	if wins <= losses {
+		t.Errorf("Handicap didn't weaken the player: %d wins and %d losses against handicap=20", wins, losses)
+	}
+}
+
+func TestSelfPlayAbandon(t *testing.T) {
+	const numActions = 3
+	player := NewAIPlayer("ab,max_depth=1", false)
+	var boards []*Board
+	game, scores := SelfPlay(NewBoard(), [NUM_PLAYERS]Player{player, player}, 0, nil, nil,
+		func(action Action, board *Board, score float32) bool {
+			boards = append(boards, board)
+			return len(boards) < numActions
+		})
+	if len(game.Actions) != numActions || len(scores) != numActions || game.FinalBoard() != boards[numActions-1] {
+		t.Fatalf("Self-play should have been abandoned after %d actions, got %d actions and %d scores",
+			numActions, len(game.Actions), len(scores))
+	}
+	if game.FinalBoard().IsFinished() || game.Capped {
+		t.Errorf("Abandoned game should be unfinished and not capped")
+	}
+}
+
+func TestSelfPlayMaxMoves(t *testing.T) {
+	const maxMoves, selfPlayMaxMoves = 100, 10
+	initial := NewBoard()
+	initial.MaxMoves = maxMoves
+	player := NewAIPlayer("ab,max_depth=1", false)
+	game, scores := SelfPlay(initial, [NUM_PLAYERS]Player{player, player}, selfPlayMaxMoves, nil, nil, nil)
+
+	if len(game.Actions) != selfPlayMaxMoves || len(scores) != selfPlayMaxMoves {
+		t.Fatalf("Self-play should have stopped after %d moves, got %d actions and %d scores",
+			selfPlayMaxMoves, len(game.Actions), len(scores))
+	}
+	final := game.FinalBoard()
+	if !game.Capped || !game.Draw() || final.IsFinished() {
+		t.Errorf("Capped game should be a draw with an unfinished board: Capped=%v, Draw()=%v, IsFinished()=%v",
+			game.Capped, game.Draw(), final.IsFinished())
+	}
+	if final.MaxMoves != maxMoves {
+		t.Errorf("Board.MaxMoves changed to %d, wanted %d", final.MaxMoves, maxMoves)
+	}
+	features := ai.FeatureVector(final, ai.AllFeaturesDim)
+	wantMovesToDraw := float32(maxMoves - selfPlayMaxMoves)
+	if got := features[ai.AllFeatures[ai.F_MOVES_TO_DRAW].VecIndex]; got != wantMovesToDraw {
+		t.Errorf("MovesToDraw=%g, wanted %g (based on Board.MaxMoves)", got, wantMovesToDraw)
+	}
+	if labels := ai.TDLambdaLabels(game, ai.TrainedBest, 1); labels[len(labels)-1] != 0 {
+		t.Errorf("Capped game final label should be 0 (draw), got %g", labels[len(labels)-1])
+	}
+}
+
+// scriptedPlayer plays the first action, and predicts a fixed score for each
+// player.
+type scriptedPlayer struct {
+	scores [NUM_PLAYERS]float32
+}
+
+func (p scriptedPlayer) Play(b *Board) (Action, *Board, float32, []float32) {
+	action := b.Derived.Actions[0]
+	return action, b.Act(action), p.scores[b.NextPlayer], ai.OneHotEncoding(b.NumActions(), 0)
+}
+
+func TestSelfPlayBothStuck(t *testing.T) {
+	// No pieces left to place, and the only piece on the board, player 0's
+	// queen, can't move.
+	initial := NewBoard()
+	initial.StackPiece(Pos{0, 0}, 0, QUEEN)
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			initial.SetAvailable(player, piece, 0)
+		}
+	}
+	initial.MoveNumber = 20
+	initial.BuildDerived()
+
+	player := NewAIPlayer("ab,max_depth=1", false)
+	game, _ := SelfPlay(initial, [NUM_PLAYERS]Player{player, player}, 0, nil, nil, nil)
+	if len(game.Actions) != 1 || !game.Actions[0].IsSkipAction() {
+		t.Errorf("Expected a single forced skip, got actions %v", game.Actions)
+	}
+	if final := game.FinalBoard(); !final.IsFinished() || !game.Draw() {
+		t.Errorf("Expected game to end in a draw: IsFinished()=%v, Draw()=%v", final.IsFinished(), game.Draw())
+	}
+}
+
+func TestSelfPlayResign(t *testing.T) {
+	const resignMoves, selfPlayMaxMoves = 3, 10
+	player := scriptedPlayer{scores: [NUM_PLAYERS]float32{-9, 9}}
+	players := [NUM_PLAYERS]Player{player, player}
+
+	// Player 0 resigns at its 4th move.
+	resign := &Resign{Threshold: -8, Moves: resignMoves, CheckFraction: 0}
+	game, scores := SelfPlay(NewBoard(), players, selfPlayMaxMoves, resign, nil, nil)
+	if !game.Resigned || game.Capped || game.Draw() || game.Winner() != 1 {
+		t.Errorf("Expected player 0 to resign: Resigned=%v, Capped=%v, Draw()=%v, Winner()=%d",
+			game.Resigned, game.Capped, game.Draw(), game.Winner())
+	}
+	if len(game.Actions) != 2*resignMoves || len(scores) != 2*resignMoves {
+		t.Errorf("Expected resignation after %d actions, got %d actions and %d scores",
+			2*resignMoves, len(game.Actions), len(scores))
+	}
+	if labels := ai.TDLambdaLabels(game, ai.TrainedBest, 1); labels[len(labels)-1] != -10 {
+		t.Errorf("Resigned game final label should be -10 (a loss), got %g", labels[len(labels)-1])
+	}
+
+	// Scores above the threshold don't resign.
+	resign = &Resign{Threshold: -10, Moves: resignMoves}
+	if game, _ = SelfPlay(NewBoard(), players, selfPlayMaxMoves, resign, nil, nil); game.Resigned || !game.Capped {
+		t.Errorf("Game with scores above threshold should be played to the cap: Resigned=%v, Capped=%v",
+			game.Resigned, game.Capped)
+	}
+
+	// A fraction of the games is played to the end: since they are capped (a draw)
+	// all resignations would be false.
+	const numGames, checkFraction = 500, 0.2
+	resign = &Resign{Threshold: -8, Moves: resignMoves, CheckFraction: checkFraction, Rand: rand.New(rand.NewSource(42))}
+	numPlayedToEnd := 0
+	for ii := 0; ii < numGames; ii++ {
+		game, _ = SelfPlay(NewBoard(), players, selfPlayMaxMoves, resign, nil, nil)
+		if !game.Resigned {
+			numPlayedToEnd++
+			if !game.Capped {
+				t.Fatalf("Game not resigned should have been capped")
+			}
+		}
+	}
+	if got := float64(numPlayedToEnd) / numGames; math.Abs(got-checkFraction) > 0.05 {
+		t.Errorf("%.3f of games played to the end, wanted %g", got, checkFraction)
+	}
+	rate, numChecked := resign.FalseResignationRate()
+	if numChecked != numPlayedToEnd || rate != 1 {
+		t.Errorf("FalseResignationRate()=(%g, %d), wanted (1, %d)", rate, numChecked, numPlayedToEnd)
+	}
+}
+
+func TestScriptedPlayer(t *testing.T) {
+	// Player 0 opens with a scripted grasshopper and spider, then both players
+	// play the first legal action, until the game ends by repetition.
+	var script []Action
+	for _, notation := range []string{"G@0,0", "S@0,1"} {
+		action, err := ParseAction(notation)
+		if err != nil {
+			t.Fatalf("Failed to parse action %q: %v", notation, err)
+		}
+		script = append(script, action)
+	}
+	play := func() (ai.GameRecord, *ScriptedPlayer) {
+		p0, p1 := NewScriptedPlayer(script...), NewScriptedPlayer()
+		p1.Score = 3
+		game, scores := SelfPlay(NewBoard(), [NUM_PLAYERS]Player{p0, p1}, 200, nil, nil, nil)
+		if scores[1] != 3 {
+			t.Errorf("Expected player 1 to predict score 3, got %g", scores[1])
+		}
+		return game, p0
+	}
+	game, p0 := play()
+	if p0.Remaining() != 0 || !game.Actions[0].Equal(script[0]) || !game.Actions[2].Equal(script[1]) {
+		t.Errorf("Scripted actions not played: %d remaining, actions played %v", p0.Remaining(), game.Actions[:3])
+	}
+	if !game.FinalBoard().IsFinished() || game.Capped {
+		t.Errorf("Expected game to finish before the cap, got %d actions, Capped=%v", len(game.Actions), game.Capped)
+	}
+
+	// Playing again gives the same game.
+	game2, _ := play()
+	if len(game2.Actions) != len(game.Actions) {
+		t.Fatalf("Replayed game has %d actions, wanted %d", len(game2.Actions), len(game.Actions))
+	}
+	for ii, action := range game.Actions {
+		if !action.Equal(game2.Actions[ii]) {
+			t.Errorf("Action #%d differs in replayed game: %s != %s", ii, game2.Actions[ii], action)
+		}
+	}
+}
+
+func TestSelfPlayFromOpening(t *testing.T) {
+	openings, err := LoadOpenings(strings.NewReader("# Comment.\nG@0,0 A@0,1\n\n"))
+	if err != nil {
+		t.Fatalf("Failed to load openings: %v", err)
+	}
+	if len(openings) != 1 || len(openings[0]) != 2 {
+		t.Fatalf("Expected one opening with 2 actions, got %v", openings)
+	}
+	opening := openings[0]
+	if _, err := LoadOpenings(strings.NewReader("G@0,0 X@0,1\n")); err == nil {
+		t.Errorf("Expected error for invalid piece in opening")
+	}
+	if _, err := PlayOpening(NewBoard(), opening[1:]); err == nil {
+		t.Errorf("Expected error for illegal opening action")
+	}
+
+	// Engine A plays the last legal action, engine B the first. They play the
+	// opening with both colors, and diverge after it.
+	var games [2]ai.GameRecord
+	for ii := range games {
+		matchPlayers := [NUM_PLAYERS]Player{lastActionPlayer{}, NewScriptedPlayer()}
+		if ii == 1 {
+			matchPlayers[0], matchPlayers[1] = matchPlayers[1], matchPlayers[0]
+		}
+		var scores []float32
+		games[ii], scores, err = SelfPlayFromOpening(NewBoard(), opening, matchPlayers, 20, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to play from opening: %v", err)
+		}
+		if len(scores) != len(games[ii].Actions) || len(games[ii].Boards) != len(games[ii].Actions)+1 ||
+			len(games[ii].ActionsLabels) != len(games[ii].Actions) {
+			t.Errorf("Game #%d has %d boards, %d actions, %d labels and %d scores", ii,
+				len(games[ii].Boards), len(games[ii].Actions), len(games[ii].ActionsLabels), len(scores))
+		}
+		if len(games[ii].Actions) <= len(opening) {
+			t.Fatalf("Game #%d has no actions after the opening: %v", ii, games[ii].Actions)
+		}
+		for jj, action := range opening {
+			if !games[ii].Actions[jj].Equal(action) {
+				t.Errorf("Game #%d action #%d is %s, wanted opening action %s", ii, jj, games[ii].Actions[jj], action)
+			}
+		}
+	}
+	next := len(opening)
+	if games[0].Actions[next].Equal(games[1].Actions[next]) {
+		t.Errorf("Expected games to diverge after the opening, both played %s", games[0].Actions[next])
+	}
+}
+
+// lastActionPlayer plays the last legal action, in the order of Action.String.
+type lastActionPlayer struct{}
+
+func (lastActionPlayer) Play(b *Board) (action Action, board *Board, score float32, actionsLabels []float32) {
+	if b.NumActions() == 0 {
+		return SKIP_ACTION, b.Act(SKIP_ACTION), 0, nil
+	}
+	idx := 0
+	for ii, action := range b.Derived.Actions {
+		if action.String() > b.Derived.Actions[idx].String() {
+			idx = ii
+		}
+	}
+	action = b.Derived.Actions[idx]
+	return action, b.Act(action), 0, ai.OneHotEncoding(b.NumActions(), idx)
+}
+
+func TestSelfPlayAdjudicate(t *testing.T) {
+	// Both players play the first legal action with an even score, until the game
+	// repeats positions.
+	play := func(adjudicate *Adjudicate, score float32) ai.GameRecord {
+		p0, p1 := NewScriptedPlayer(), NewScriptedPlayer()
+		p0.Score, p1.Score = score, -score
+		game, scores := SelfPlay(NewBoard(), [NUM_PLAYERS]Player{p0, p1}, 200, nil, adjudicate, nil)
+		if game.Adjudicated && !adjudicate.Adjudicated(&game, scores) {
+			t.Errorf("Replaying the adjudication of the game failed")
+		}
+		return game
+	}
+	full := play(&Adjudicate{}, 0)
+	if full.Adjudicated || !full.FinalBoard().IsFinished() || !full.Draw() {
+		t.Fatalf("Expected game to end in a draw by repetition, got %d actions, Adjudicated=%v",
+			len(full.Actions), full.Adjudicated)
+	}
+
+	adjudicate := &Adjudicate{Threshold: 0.5, Moves: 4, Repetitions: 1}
+	game := play(adjudicate, 0)
+	if !game.Adjudicated || !game.Draw() || game.FinalBoard().IsFinished() || len(game.Actions) >= len(full.Actions) {
+		t.Errorf("Expected game to be adjudicated a draw before the repetitions end it, got %d actions "+
+			"(%d without adjudication), Adjudicated=%v", len(game.Actions), len(full.Actions), game.Adjudicated)
+	}
+	compact := game.Compact()
+	if game.OutcomeFor(0) != ai.OUTCOME_DRAW || !compact.Capped {
+		t.Errorf("Adjudicated game should be a draw, and stored as capped")
+	}
+
+	// Scores far from even are never adjudicated.
+	if game := play(adjudicate, 3); game.Adjudicated || len(game.Actions) != len(full.Actions) {
+		t.Errorf("Expected game with uneven scores not to be adjudicated, got %d actions, Adjudicated=%v",
+			len(game.Actions), game.Adjudicated)
+	}
+
+	// Control games are played to the end, and accounted in the false draw rate.
+	adjudicate.CheckFraction = 1
+	if game := play(adjudicate, 0); game.Adjudicated || len(game.Actions) != len(full.Actions) {
+		t.Errorf("Expected control game to be played to the end, got %d actions, Adjudicated=%v",
+			len(game.Actions), game.Adjudicated)
+	}
+	if rate, numChecked := adjudicate.FalseDrawRate(); rate != 0 || numChecked != 1 {
+		t.Errorf("Expected no false draws in 1 checked game, got rate=%g in %d games", rate, numChecked)
+	}
+}
+
+// funcScorer scores boards with a function, for the next player.
+type funcScorer func(b *Board) float32
+
+func (f funcScorer) Score(b *Board) (score float32, actionProbs []float32) { return f(b), nil }
+
+func (f funcScorer) Version() int { return 0 }
+
+func TestTakeback(t *testing.T) {
+	// Player 0 (human) and player 1 (AI) place a piece each, then player 0
+	// places a second one.
+	tree := NewGameTree(NewBoard(), true)
+	for _, notation := range []string{"G@0,0", "A@0,1", "Q@0,-1"} {
+		action, err := ParseAction(notation)
+		if err != nil {
+			t.Fatalf("Failed to parse action %q: %v", notation, err)
+		}
+		board := tree.Current.Board
+		tree.Act(board.Derived.Actions[board.FindActionDeep(action)])
+	}
+	current := tree.Current.Board
+
+	// Taking back player 0's last move only undoes it, since player 1 hasn't
+	// replied yet, while taking back player 1's last move undoes player 0's reply
+	// too.
+	if undos := TakebackUndos(tree, 0); undos != 1 {
+		t.Errorf("Expected 1 action undone for player 0's takeback, got %d", undos)
+	}
+	if undos := TakebackUndos(tree, 1); undos != 2 {
+		t.Errorf("Expected 2 actions undone for player 1's takeback, got %d", undos)
+	}
+	rolledBack := tree.Current.Parent.Board
+
+	// The AI is winning (+5) with 3 pieces on the board, and even otherwise.
+	scorer := funcScorer(func(b *Board) float32 {
+		if b.NumPiecesOnBoard() == 3 {
+			return 5
+		}
+		return 0
+	})
+	if !(TakebackPolicy{MaxScoreLoss: 10}).Accept(scorer, 1, current, rolledBack) {
+		t.Errorf("Expected AI to accept takeback losing less than MaxScoreLoss")
+	}
+	if (TakebackPolicy{MaxScoreLoss: 1}).Accept(scorer, 1, current, rolledBack) {
+		t.Errorf("Expected AI to reject takeback losing its advantage")
+	}
+	if !(TakebackPolicy{}).Accept(funcScorer(func(*Board) float32 { return 0 }), 1, current, rolledBack) {
+		t.Errorf("Expected AI to accept takeback that doesn't change its score")
+	}
+
+	// A request made before the AI's reply is stale.
+	requestedAt := current.MoveNumber
+	reply := current.Derived.Actions[0]
+	tree.Act(reply)
+	if err := ApplyTakeback(tree, 0, requestedAt); err == nil {
+		t.Errorf("Expected stale takeback to fail")
+	}
+	if tree.Current.Board.MoveNumber != requestedAt+1 {
+		t.Errorf("Stale takeback changed the game")
+	}
+
+	// Accepted takeback after the reply undoes both moves.
+	if err := ApplyTakeback(tree, 0, tree.Current.Board.MoveNumber); err != nil {
+		t.Fatalf("Failed to apply takeback: %v", err)
+	}
+	if tree.Current.Board != rolledBack {
+		t.Errorf("Takeback rolled back to move %d, wanted %d", tree.Current.Board.MoveNumber, rolledBack.MoveNumber)
+	}
+	if err := ApplyTakeback(NewGameTree(NewBoard(), true), 0, 1); err == nil {
+		t.Errorf("Expected takeback without moves to fail")
+	}
+}
+
+func TestRandomFirstPlayer(t *testing.T) {
+	const numMatches = 1000
+	swaps := func(seed int64) (swapped []bool, count int) {
+		for matchNum := 0; matchNum < numMatches; matchNum++ {
+			swapped = append(swapped, RandomFirstPlayer(seed, matchNum))
+			if swapped[matchNum] {
+				count++
+			}
+		}
+		return
+	}
+	swapped, count := swaps(42)
+	if count < numMatches*45/100 || count > numMatches*55/100 {
+		t.Errorf("Players swapped in %d of %d matches, wanted roughly half", count, numMatches)
+	}
+	again, _ := swaps(42)
+	if !reflect.DeepEqual(swapped, again) {
+		t.Errorf("First players with the same seed are not reproducible")
+	}
+	if other, _ := swaps(43); reflect.DeepEqual(swapped, other) {
+		t.Errorf("First players with different seeds are the same")
+	}
+}
+
+func TestSelfPlayReplaySeed(t *testing.T) {
+	const selfPlayMaxMoves = 12
+	// Randomized players, so the game depends on the random number generator.
+	p0 := NewAIPlayer("ab,max_depth=1,randomness=1", false)
+	p1 := NewAIPlayer("ab,max_depth=1,randomness=2", false)
+	play := func(seed int64) ai.GameRecord {
+		game, _ := SelfPlay(NewBoard().WithSeed(seed), [NUM_PLAYERS]Player{p0, p1}, selfPlayMaxMoves,
+			nil, nil, nil)
+		return game
+	}
+
+	seed := GameSeed(42, 7)
+	if seed == 0 || seed == GameSeed(42, 8) {
+		t.Fatalf("GameSeed(42, 7)=%d should be non-zero and different from other matches", seed)
+	}
+	game := play(seed)
+	if game.Seed != seed {
+		t.Fatalf("Game recorded seed %d, wanted %d", game.Seed, seed)
+	}
+
+	// Replaying from the recorded seed, after other games consumed the global
+	// random number generator, reproduces the game.
+	for ii := 0; ii < 3; ii++ {
+		rand.Int63()
+		SelfPlay(NewBoard(), [NUM_PLAYERS]Player{p0, p1}, 4, nil, nil, nil)
+	}
+	replay := play(game.Seed)
+	if !reflect.DeepEqual(replay.Actions, game.Actions) {
+		t.Errorf("Replay of game with seed %d differs:\n%v\nwanted:\n%v", seed, replay.Actions, game.Actions)
+	}
+	if other := play(seed + 1); reflect.DeepEqual(other.Actions, game.Actions) {
+		t.Errorf("Games with different seeds are the same")
+	}
+
+	// Games from an opening also record the seed.
+	game, _, err := SelfPlayFromOpening(NewBoard().WithSeed(seed), []Action{{Piece: ANT, TargetPos: Pos{0, 0}}},
+		[NUM_PLAYERS]Player{p0, p1}, 4, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("SelfPlayFromOpening failed: %v", err)
+	}
+	if game.Seed != seed {
+		t.Errorf("Game from opening recorded seed %d, wanted %d", game.Seed, seed)
+	}
+}
+
+// slowPlayer waits for delay before playing the first action.
+type slowPlayer struct {
+	delay time.Duration
+}
+
+func (p slowPlayer) Play(b *Board) (Action, *Board, float32, []float32) {
+	time.Sleep(p.delay)
+	action := b.Derived.Actions[0]
+	return action, b.Act(action), 0, nil
+}
+
+func TestPlayTimed(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	b := NewBoard()
+	b = b.Act(b.Derived.Actions[0])
+	action, board, _, _, timing := PlayTimed(slowPlayer{delay}, b)
+	if action != b.Derived.Actions[0] || board == nil {
+		t.Errorf("PlayTimed returned %s, wanted the action of the player %s", action, b.Derived.Actions[0])
+	}
+	if timing.MoveNumber != b.MoveNumber || timing.Player != b.NextPlayer {
+		t.Errorf("Timing of move %d of player %d, wanted move %d of player %d", timing.MoveNumber,
+			timing.Player, b.MoveNumber, b.NextPlayer)
+	}
+	if timing.Elapsed < delay || timing.Elapsed > 20*delay {
+		t.Errorf("Measured %s for a player that takes %s", timing.Elapsed, delay)
+	}
+	if !timing.Slow(delay/2) || timing.Slow(20*delay) || timing.Slow(0) {
+		t.Errorf("Wrong Slow() for %s", timing)
+	}
+}
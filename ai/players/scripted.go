@@ -0,0 +1,55 @@
+package players
+
+import (
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// ScriptedPlayer plays a pre-programmed sequence of actions, and once they are
+// exhausted, the first legal action (in the order of Action.String, so it doesn't
+// depend on the shuffling of Derived.Actions). It always predicts the same Score.
+//
+// It implements the Player interface with no AI behind it, for fast and
+// deterministic tests of the game flow.
+type ScriptedPlayer struct {
+	// Actions to play, in order. They must be legal in the positions they are
+	// played, otherwise Play panics.
+	Actions []Action
+
+	// Score predicted for every action played.
+	Score float32
+
+	// next is the index of the next action in Actions to play.
+	next int
+}
+
+// NewScriptedPlayer creates a ScriptedPlayer that plays the given actions.
+func NewScriptedPlayer(actions ...Action) *ScriptedPlayer {
+	return &ScriptedPlayer{Actions: actions}
+}
+
+// Play implements Player. The actions labels are the one-hot encoding of the
+// action played.
+func (p *ScriptedPlayer) Play(b *Board) (action Action, board *Board, score float32, actionsLabels []float32) {
+	if b.NumActions() == 0 {
+		return SKIP_ACTION, b.Act(SKIP_ACTION), p.Score, nil
+	}
+	var idx int
+	if p.next < len(p.Actions) {
+		idx = b.FindActionDeep(p.Actions[p.next])
+		p.next++
+	} else {
+		for ii, action := range b.Derived.Actions {
+			if action.String() < b.Derived.Actions[idx].String() {
+				idx = ii
+			}
+		}
+	}
+	action = b.Derived.Actions[idx]
+	return action, b.Act(action), p.Score, ai.OneHotEncoding(b.NumActions(), idx)
+}
+
+// Remaining returns the number of scripted actions not yet played.
+func (p *ScriptedPlayer) Remaining() int {
+	return len(p.Actions) - p.next
+}
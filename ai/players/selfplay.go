@@ -0,0 +1,335 @@
+package players
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// RandomFirstPlayer returns whether the players of the given match, in a series
+// of self-play matches seeded with seed, are swapped, that is, whether the
+// second player moves first. It is random, so the data is not biased towards
+// either player moving first, but it depends only on seed and matchNum, so the
+// assignment is reproducible regardless of the order the matches are played.
+//
+// The labels of the games don't depend on it: scores and actions labels are
+// from the perspective of the player to move in each board.
+func RandomFirstPlayer(seed int64, matchNum int) (swapped bool) {
+	return splitMix64(seed, matchNum)&1 == 1
+}
+
+// GameSeed returns the seed of the random number generator of the given match
+// (see Board.WithSeed), in a series of self-play matches seeded with seed. It is
+// never 0, and it depends only on seed and matchNum.
+func GameSeed(seed int64, matchNum int) int64 {
+	// Different stream than RandomFirstPlayer.
+	gameSeed := int64(splitMix64(^seed, matchNum) >> 1)
+	if gameSeed == 0 {
+		gameSeed = 1
+	}
+	return gameSeed
+}
+
+// splitMix64 returns the SplitMix64 finalizer of the pair (seed, matchNum).
+func splitMix64(seed int64, matchNum int) uint64 {
+	x := uint64(seed) + uint64(matchNum+1)*0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	x ^= x >> 31
+	return x
+}
+
+// Resign configures resignation in SelfPlay: playing lost positions to the end
+// wastes compute, and skews the data towards endgames. A player resigns when the
+// scores it predicted for its last Moves actions were all below Threshold.
+//
+// To measure how often players resign games they wouldn't have lost, a fraction
+// of the games (CheckFraction) is played to the end regardless, and the games
+// where a player would have resigned are accounted in FalseResignationRate.
+//
+// It is safe for concurrent use by multiple SelfPlay calls.
+type Resign struct {
+	// Threshold below which a score is considered lost, e.g. -8.
+	Threshold float32
+
+	// Moves is the number of consecutive actions of the player with score below
+	// Threshold before it resigns. If 0, players never resign.
+	Moves int
+
+	// CheckFraction is the fraction of games played to the end, e.g. 0.1.
+	CheckFraction float64
+
+	// Rand is used to select the games played to the end. If nil, the global
+	// random number generator is used.
+	Rand *rand.Rand
+
+	mu                   sync.Mutex
+	numChecked, numFalse int
+}
+
+// playToEnd returns whether a game should be played to the end, to check the
+// false resignation rate.
+func (r *Resign) playToEnd() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Rand != nil {
+		return r.Rand.Float64() < r.CheckFraction
+	}
+	return rand.Float64() < r.CheckFraction
+}
+
+// record accounts for a game played to the end, where player would have
+// resigned.
+func (r *Resign) record(game *ai.GameRecord, player uint8) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.numChecked++
+	if game.Draw() || game.Winner() == player {
+		r.numFalse++
+	}
+}
+
+// FalseResignationRate returns the fraction of the games played to the end (see
+// CheckFraction) where a player would have resigned but didn't lose, and the
+// number of such games.
+func (r *Resign) FalseResignationRate() (rate float64, numChecked int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.numChecked == 0 {
+		return 0, 0
+	}
+	return float64(r.numFalse) / float64(r.numChecked), r.numChecked
+}
+
+// Adjudicate configures draw adjudication in SelfPlay: games that reach positions
+// neither player can make progress in would otherwise be played until the move
+// cap, wasting moves. A game is adjudicated a draw once the scores predicted for
+// the last Moves actions (of both players) were all within [-Threshold,
+// Threshold], and the current position (see Board.CanonicalHash) was seen at
+// least Repetitions times before in the game.
+//
+// To check that adjudication doesn't cut decisive games, a fraction of the games
+// (CheckFraction) is played to the end regardless, and the games that would have
+// been adjudicated but were won by a player are accounted in FalseDrawRate.
+//
+// It is safe for concurrent use by multiple SelfPlay calls.
+type Adjudicate struct {
+	// Threshold is the absolute value below which a score is considered even,
+	// e.g. 0.5.
+	Threshold float32
+
+	// Moves is the number of consecutive actions with even scores needed. If 0,
+	// games are never adjudicated.
+	Moves int
+
+	// Repetitions is the number of times the position must have been seen
+	// before. Values below 1 are taken as 1.
+	Repetitions int
+
+	// CheckFraction is the fraction of games played to the end, e.g. 0.1.
+	CheckFraction float64
+
+	// Rand is used to select the games played to the end. If nil, the global
+	// random number generator is used.
+	Rand *rand.Rand
+
+	mu                      sync.Mutex
+	numChecked, numDecisive int
+}
+
+// playToEnd returns whether a game should be played to the end, to check the
+// false draw rate.
+func (a *Adjudicate) playToEnd() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.Rand != nil {
+		return a.Rand.Float64() < a.CheckFraction
+	}
+	return rand.Float64() < a.CheckFraction
+}
+
+// record accounts for a game played to the end, that would have been
+// adjudicated a draw.
+func (a *Adjudicate) record(game *ai.GameRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.numChecked++
+	if !game.Draw() {
+		a.numDecisive++
+	}
+}
+
+// FalseDrawRate returns the fraction of the games played to the end (see
+// CheckFraction) that would have been adjudicated a draw but were won by a
+// player, and the number of such games.
+func (a *Adjudicate) FalseDrawRate() (rate float64, numChecked int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.numChecked == 0 {
+		return 0, 0
+	}
+	return float64(a.numDecisive) / float64(a.numChecked), a.numChecked
+}
+
+// Adjudicated returns whether the game, with the given scores for each action
+// (as returned by SelfPlay), would be adjudicated a draw at its final board.
+// It's used to tell adjudicated games apart when loading them.
+func (a *Adjudicate) Adjudicated(game *ai.GameRecord, scores []float32) bool {
+	if a.Moves <= 0 || len(scores) < len(game.Actions) {
+		return false
+	}
+	tracker := a.newTracker(game.Boards[0])
+	draw := false
+	for ii, board := range game.Boards[1:] {
+		draw = tracker.update(board, scores[ii])
+	}
+	return draw
+}
+
+// adjudicateTracker tracks the progress of one game, for Adjudicate.
+type adjudicateTracker struct {
+	adjudicate *Adjudicate
+	seen       map[uint64]int
+	evenScores int
+}
+
+func (a *Adjudicate) newTracker(initial *Board) *adjudicateTracker {
+	return &adjudicateTracker{adjudicate: a, seen: map[uint64]int{initial.CanonicalHash(): 1}}
+}
+
+// update accounts for the board reached by an action, and the score predicted
+// for it, and returns whether the game should be adjudicated a draw.
+func (t *adjudicateTracker) update(board *Board, score float32) bool {
+	if score >= -t.adjudicate.Threshold && score <= t.adjudicate.Threshold {
+		t.evenScores++
+	} else {
+		t.evenScores = 0
+	}
+	hash := board.CanonicalHash()
+	repetitions := t.seen[hash]
+	t.seen[hash]++
+	minRepetitions := t.adjudicate.Repetitions
+	if minRepetitions < 1 {
+		minRepetitions = 1
+	}
+	return t.evenScores >= t.adjudicate.Moves && repetitions >= minRepetitions
+}
+
+// SelfPlay plays a match between the given players, starting from the initial
+// board, and returns the record of the game along with the score predicted by the
+// player for each action taken. If a player has no available actions, a
+// SKIP_ACTION is played for it, and its score is the inverse of the opponent's
+// next score. If the opponent can't move either, the game ends in a draw (see
+// Board.Draw).
+//
+// maxMoves, if > 0, is the self-play move cap: once the board reaches it the game
+// is interrupted and considered a draw (see GameRecord.Capped). This is
+// independent of Board.MaxMoves, which is left untouched: it is the draw horizon
+// seen by the players, and it is what the F_MOVES_TO_DRAW feature reflects. So
+// self-play can be cut shorter than interactive play, without changing the
+// features the models see.
+//
+// resign, if not nil, configures when players resign (see GameRecord.Resigned).
+//
+// adjudicate, if not nil, configures when games are adjudicated a draw (see
+// GameRecord.Adjudicated).
+//
+// onAction, if not nil, is called after each action, with the resulting board and
+// the score predicted by the player that took the action (0 for SKIP_ACTION). If
+// it returns false the game is abandoned, and returned as played so far.
+//
+// If initial has its own random number generator (see Board.WithSeed), its seed
+// is recorded in GameRecord.Seed: playing again from the initial board with the
+// same seed and players reproduces the game, as long as the players only use
+// the randomness of the boards (e.g. not tie_break=random) and search
+// sequentially.
+func SelfPlay(initial *Board, players [NUM_PLAYERS]Player, maxMoves int, resign *Resign, adjudicate *Adjudicate,
+	onAction func(action Action, board *Board, score float32) bool) (game ai.GameRecord, scores []float32) {
+	board := initial
+	game.Boards = []*Board{board}
+	game.Seed = initial.Seed()
+	lastWasSkip := false
+
+	// Resignation: number of consecutive low scores of each player, and the player
+	// that would have resigned, if the game is played to the end.
+	resignEnabled := resign != nil && resign.Moves > 0
+	playToEnd := resignEnabled && resign.playToEnd()
+	var lowScores [NUM_PLAYERS]int
+	wouldResign := -1
+
+	// Adjudication: whether the game would have been adjudicated a draw, if it is
+	// played to the end.
+	adjudicateEnabled := adjudicate != nil && adjudicate.Moves > 0
+	adjudicateToEnd := adjudicateEnabled && adjudicate.playToEnd()
+	var tracker *adjudicateTracker
+	if adjudicateEnabled {
+		tracker = adjudicate.newTracker(board)
+	}
+	adjudicateDraw, wouldAdjudicate := false, false
+
+	for !board.IsFinished() {
+		if ai.SelfPlayCapReached(board, maxMoves) {
+			game.Capped = true
+			break
+		}
+		if resignEnabled && lowScores[board.NextPlayer] >= resign.Moves {
+			if !playToEnd {
+				game.Resigned = true
+				break
+			}
+			if wouldResign < 0 {
+				wouldResign = int(board.NextPlayer)
+			}
+		}
+		if adjudicateDraw {
+			if !adjudicateToEnd {
+				game.Adjudicated = true
+				break
+			}
+			wouldAdjudicate = true
+		}
+		var action Action
+		score := float32(0)
+		var actionLabels []float32
+		if len(board.Derived.Actions) == 0 {
+			// Auto-play skip move.
+			action = SKIP_ACTION
+			board = board.Act(action)
+			lastWasSkip = true
+		} else {
+			player := board.NextPlayer
+			action, board, score, actionLabels = players[player].Play(board)
+			if lastWasSkip {
+				// Use inverse of this score for previous "NOOP" move.
+				scores[len(scores)-1] = -score
+				lastWasSkip = false
+			}
+			if resignEnabled {
+				if score < resign.Threshold {
+					lowScores[player]++
+				} else {
+					lowScores[player] = 0
+				}
+			}
+		}
+		game.Actions = append(game.Actions, action)
+		game.Boards = append(game.Boards, board)
+		game.ActionsLabels = append(game.ActionsLabels, actionLabels)
+		scores = append(scores, score)
+		if adjudicateEnabled {
+			adjudicateDraw = tracker.update(board, score)
+		}
+		if onAction != nil && !onAction(action, board, score) {
+			break
+		}
+	}
+	if wouldResign >= 0 {
+		resign.record(&game, uint8(wouldResign))
+	}
+	if wouldAdjudicate {
+		adjudicate.record(&game)
+	}
+	return
+}
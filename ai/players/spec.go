@@ -0,0 +1,48 @@
+package players
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParsePlayerSpec parses the specification of a player given to the UIs (e.g. by
+// --p0 and --p1): "hotseat" for a human player, "ai" for an AI player with the
+// defaultConfig, or "ai:<config>" for an AI player with its own configuration,
+// see NewAIPlayer.
+func ParsePlayerSpec(spec, defaultConfig string) (isAI bool, config string, err error) {
+	switch {
+	case spec == "hotseat":
+		return false, "", nil
+	case spec == "ai":
+		return true, defaultConfig, nil
+	case strings.HasPrefix(spec, "ai:"):
+		return true, spec[len("ai:"):], nil
+	}
+	return false, "", fmt.Errorf("Unknown player type %q, it should be hotseat, ai or ai:<config>", spec)
+}
+
+// NewAIPlayerWithError is like NewAIPlayer, but it returns an error instead of
+// panicking if the configuration is invalid, or its model can't be loaded.
+func NewAIPlayerWithError(config string, parallelized bool) (player *SearcherScorerPlayer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			player, err = nil, fmt.Errorf("Invalid AI configuration %q: %v", config, r)
+		}
+	}()
+	return NewAIPlayer(config, parallelized), nil
+}
+
+// NewPlayerFromSpec creates the player of the specification, see ParsePlayerSpec.
+// It returns nil for human players, and validates the configuration of AI players
+// by creating them, as the trainer does.
+func NewPlayerFromSpec(spec, defaultConfig string, parallelized bool) (Player, error) {
+	isAI, config, err := ParsePlayerSpec(spec, defaultConfig)
+	if err != nil || !isAI {
+		return nil, err
+	}
+	player, err := NewAIPlayerWithError(config, parallelized)
+	if err != nil {
+		return nil, err
+	}
+	return player, nil
+}
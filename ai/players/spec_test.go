@@ -0,0 +1,50 @@
+package players_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/ai/players"
+)
+
+func TestParsePlayerSpec(t *testing.T) {
+	for _, test := range []struct {
+		spec, wantConfig string
+		wantAI, wantErr  bool
+	}{
+		{"hotseat", "", false, false},
+		{"ai", "ab,max_depth=1", true, false},
+		{"ai:mcts,max_traverses=10", "mcts,max_traverses=10", true, false},
+		{"ai:", "", true, false},
+		{"online", "", false, true},
+	} {
+		isAI, config, err := ParsePlayerSpec(test.spec, "ab,max_depth=1")
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParsePlayerSpec(%q): got error %v, wanted error: %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if isAI != test.wantAI || config != test.wantConfig {
+			t.Errorf("ParsePlayerSpec(%q) = %v, %q, wanted %v, %q", test.spec, isAI, config,
+				test.wantAI, test.wantConfig)
+		}
+	}
+}
+
+func TestNewPlayerFromSpec(t *testing.T) {
+	if player, err := NewPlayerFromSpec("hotseat", "", false); player != nil || err != nil {
+		t.Errorf("Got %v, %v for hotseat, wanted no player and no error", player, err)
+	}
+	player, err := NewPlayerFromSpec("ai:ab,max_depth=1", "", false)
+	if err != nil {
+		t.Fatalf("Failed to create AI player: %v", err)
+	}
+	if aiPlayer, ok := player.(*SearcherScorerPlayer); !ok || aiPlayer.Config != "ab,max_depth=1" {
+		t.Errorf("Got player %v, wanted an AI player configured with ab,max_depth=1", player)
+	}
+
+	// The whole configuration is validated, not only the syntax of the spec.
+	for _, spec := range []string{"ai:ab,no_such_param=1", "ai:ab,max_depth=1=2", "robot"} {
+		if _, err := NewPlayerFromSpec(spec, "", false); err == nil {
+			t.Errorf("NewPlayerFromSpec(%q) should have failed", spec)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package players
+
+import (
+	"fmt"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// Takebacks: a player may ask to take back its last move, and if the opponent
+// accepts, the game rolls back (see GameTree.Undo) to the position before it,
+// along with the opponent's reply, if any. The request refers to the move number
+// of the board when it was made: if a move is played before it is answered,
+// the request is stale and can't be applied.
+//
+// There is no network play protocol yet to carry the requests: these are the
+// parts that don't depend on it.
+
+// TakebackPolicy decides whether an AI accepts a takeback requested by its
+// opponent: it accepts if it doesn't lose (much of) its advantage by doing so.
+type TakebackPolicy struct {
+	// MaxScoreLoss is how much lower the score of the AI can be in the position
+	// after the takeback, compared to the current one, for it to accept. 0 only
+	// accepts takebacks that don't make it worse off, and a negative value
+	// rejects all.
+	MaxScoreLoss float32
+}
+
+// Accept returns whether the AI playing as player accepts the takeback of the
+// game from current to rolledBack, scoring both positions with scorer.
+func (p TakebackPolicy) Accept(scorer ai.Scorer, player uint8, current, rolledBack *Board) bool {
+	if p.MaxScoreLoss < 0 {
+		return false
+	}
+	return scoreFor(scorer, player, rolledBack) >= scoreFor(scorer, player, current)-p.MaxScoreLoss
+}
+
+// scoreFor returns the score of the board from the perspective of the given player.
+func scoreFor(scorer ai.Scorer, player uint8, b *Board) (score float32) {
+	if isEnd, endScore := ai.EndGameScore(b); isEnd {
+		score = endScore
+	} else {
+		score, _ = scorer.Score(b)
+	}
+	if b.NextPlayer != player {
+		score = -score
+	}
+	return
+}
+
+// TakebackUndos returns how many actions have to be undone to take back the last
+// move of requester: its own move, and the opponent's reply if it was already
+// played. It returns 0 if requester has no move to take back.
+func TakebackUndos(tree *GameTree, requester uint8) int {
+	undos := 0
+	for node := tree.Current; node.Parent != nil; node = node.Parent {
+		undos++
+		if node.Parent.Board.NextPlayer == requester {
+			return undos
+		}
+	}
+	return 0
+}
+
+// ApplyTakeback rolls the game back to the position before the last move of
+// requester, for a takeback requested at the given move number. It returns an
+// error, leaving the game untouched, if the request is stale (a move was played
+// since), or if there is no move to take back.
+func ApplyTakeback(tree *GameTree, requester uint8, moveNumber int) error {
+	if current := tree.Current.Board.MoveNumber; current != moveNumber {
+		return fmt.Errorf("Takeback requested at move %d is stale, game is at move %d", moveNumber, current)
+	}
+	undos := TakebackUndos(tree, requester)
+	if undos == 0 {
+		return fmt.Errorf("Player %d has no move to take back", requester)
+	}
+	for ii := 0; ii < undos; ii++ {
+		tree.Undo()
+	}
+	return nil
+}
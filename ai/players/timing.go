@@ -0,0 +1,41 @@
+package players
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// MoveTiming is how long a player took to choose a move, e.g. to find which moves
+// of a sluggish AI were slow.
+type MoveTiming struct {
+	// MoveNumber and Player of the board where the move was chosen.
+	MoveNumber int
+	Player     uint8
+
+	// Elapsed is the wall time of the call to Player.Play, so it includes the time
+	// waiting for the scorer, e.g. for a GPU shared with other processes.
+	Elapsed time.Duration
+}
+
+// Slow returns whether the move took longer than threshold. A threshold <= 0
+// disables it.
+func (mt MoveTiming) Slow(threshold time.Duration) bool {
+	return threshold > 0 && mt.Elapsed > threshold
+}
+
+func (mt MoveTiming) String() string {
+	return fmt.Sprintf("move %d of player %d took %s", mt.MoveNumber, mt.Player,
+		mt.Elapsed.Round(time.Millisecond))
+}
+
+// PlayTimed calls player.Play, and also returns how long it took.
+func PlayTimed(player Player, b *Board) (action Action, board *Board, score float32, actionsLabels []float32,
+	timing MoveTiming) {
+	timing = MoveTiming{MoveNumber: b.MoveNumber, Player: b.NextPlayer}
+	start := time.Now()
+	action, board, score, actionsLabels = player.Play(b)
+	timing.Elapsed = time.Since(start)
+	return
+}
@@ -3,6 +3,8 @@
 // Each action is represented by:
 //
 //   Move: 0/1 if the action is a move (and not a new placement).
+//   Owner: (since version ACTION_OWNER_MIN_VERSION) +1 if the piece moved is of
+//     the player moving, -1 if it is an opponent's piece, 0 for placements.
 //   Source Position: (if move, otherwise 0)
 //     Radius-2 of board area around piece leaving.
 //   Target Position:
@@ -73,17 +75,52 @@ type PositionFeatures struct {
 	Sections [6][]float32
 }
 
+// ACTION_OWNER_MIN_VERSION is the first version of the features with
+// ActionFeatures.Owner.
+const ACTION_OWNER_MIN_VERSION = 54
+
 type ActionFeatures struct {
-	Move                           float32
+	// Move is 1 if the action is a move, 0 if it is a placement.
+	Move float32
+
+	// Owner of the piece moved, relative to the player moving: +1 for its own
+	// pieces, -1 for the opponent's (not possible with the current pieces, but it
+	// is with e.g. the pillbug), and 0 for placements. Only set for versions >=
+	// ACTION_OWNER_MIN_VERSION.
+	Owner float32
+
 	SourceFeatures, TargetFeatures PositionFeatures
 }
 
+// ActionContextDim returns the number of static/context features of each action,
+// see ActionFeatures.Context, for the given version.
+func ActionContextDim(version int) int {
+	if version >= ACTION_OWNER_MIN_VERSION {
+		return 2
+	}
+	return 1
+}
+
+// Context returns the static/context features of the action for the given
+// version, with ActionContextDim(version) values: Move and, for newer versions,
+// Owner.
+func (af *ActionFeatures) Context(version int) []float32 {
+	if version >= ACTION_OWNER_MIN_VERSION {
+		return []float32{af.Move, af.Owner}
+	}
+	return []float32{af.Move}
+}
+
 // ActionFeatures build the features for one action. We do this one at a time so that
 // they can be accumulated directly into a tensor (or whatever is the backend machine
 // learning)
 func NewActionFeatures(b *Board, action Action, policyVersion int) (af ActionFeatures) {
 	if action.Move {
 		af.Move = 1
+		if policyVersion >= ACTION_OWNER_MIN_VERSION {
+			_, player, _ := b.StackAt(action.SourcePos).PopPiece()
+			af.Owner = playerToValue(b, player)
+		}
 		af.SourceFeatures.neighbourhoodFeatures(b, action, policyVersion, action.SourcePos, false)
 	} else {
 		af.Move = 0
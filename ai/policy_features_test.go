@@ -62,7 +62,7 @@ func TestPolicyFeatures(t *testing.T) {
 	b.StackPiece(Pos{0, 1}, 0, BEETLE)
 	b.StackPiece(Pos{-1, -1}, 0, GRASSHOPPER)
 	b.BuildDerived()
-	action := Action{true, GRASSHOPPER, Pos{-1, -1}, Pos{1, 0}}
+	action := Action{Move: true, Piece: GRASSHOPPER, SourcePos: Pos{-1, -1}, TargetPos: Pos{1, 0}}
 	printBoard(b, action)
 
 	actionFeatures := ai.NewActionFeatures(b, action, 0)
@@ -154,3 +154,41 @@ func debugNeighboursForPos(ui *ascii_ui.UI, base Pos) {
 		ui.Print(b)
 	}
 }
+
+func TestActionContext(t *testing.T) {
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, 1}, 1, QUEEN)
+	b.StackPiece(Pos{-1, -1}, 0, GRASSHOPPER)
+	b.BuildDerived()
+	move := Action{Move: true, Piece: GRASSHOPPER, SourcePos: Pos{-1, -1}, TargetPos: Pos{1, 0}}
+	placement := Action{Piece: ANT, TargetPos: Pos{1, 0}}
+
+	// Older versions only have the Move flag.
+	for _, action := range []Action{move, placement} {
+		af := ai.NewActionFeatures(b, action, ai.ACTION_OWNER_MIN_VERSION-1)
+		if got := af.Context(ai.ACTION_OWNER_MIN_VERSION - 1); len(got) != 1 || af.Owner != 0 {
+			t.Errorf("Action %s: got context %v (Owner=%g) for old version, wanted only Move", action, got, af.Owner)
+		}
+	}
+
+	version := ai.AllFeaturesDim
+	moveContext := ai.NewActionFeatures(b, move, version)
+	placementContext := ai.NewActionFeatures(b, placement, version)
+	if want := []float32{1, 1}; !reflect.DeepEqual(moveContext.Context(version), want) {
+		t.Errorf("Move %s: got context %v, wanted %v", move, moveContext.Context(version), want)
+	}
+	if want := []float32{0, 0}; !reflect.DeepEqual(placementContext.Context(version), want) {
+		t.Errorf("Placement %s: got context %v, wanted %v", placement, placementContext.Context(version), want)
+	}
+	if dim := ai.ActionContextDim(version); dim != len(moveContext.Context(version)) {
+		t.Errorf("ActionContextDim(%d)=%d, but context has %d values", version, dim,
+			len(moveContext.Context(version)))
+	}
+
+	// Opponent's piece (e.g. moved by a pillbug).
+	b.NextPlayer = 1
+	if af := ai.NewActionFeatures(b, move, version); af.Owner != -1 {
+		t.Errorf("Moving opponent's piece: got Owner=%g, wanted -1", af.Owner)
+	}
+}
@@ -0,0 +1,97 @@
+package ai
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Progress is a report of how far a long running job (playing matches, training
+// steps, ...) has advanced.
+type Progress struct {
+	// Done is the number of units (matches, steps, ...) completed, out of Total.
+	// Total is 0 if unknown.
+	Done, Total int
+
+	// Elapsed is the time since the job started.
+	Elapsed time.Duration
+
+	// Rate is the number of units completed per second.
+	Rate float64
+
+	// ETA is the estimated time to complete the job, or 0 if Total is unknown.
+	ETA time.Duration
+}
+
+// String implements fmt.Stringer.
+func (p Progress) String() string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("%d done in %s (%.2f/s)", p.Done, p.Elapsed.Round(time.Second), p.Rate)
+	}
+	return fmt.Sprintf("%d/%d done in %s (%.2f/s), ETA %s", p.Done, p.Total,
+		p.Elapsed.Round(time.Second), p.Rate, p.ETA.Round(time.Second))
+}
+
+// ProgressFn is called with the progress of a job, see ProgressTracker.
+type ProgressFn func(p Progress)
+
+// ProgressTracker counts the units completed by a job, and calls its ProgressFn
+// every Every units, and when Total is reached. It is safe for concurrent use.
+type ProgressTracker struct {
+	Total, Every int
+	Fn           ProgressFn
+
+	mu    sync.Mutex
+	start time.Time
+	done  int
+}
+
+// NewProgressTracker creates a ProgressTracker for a job of total units (0 if
+// unknown) starting now. If every <= 0 fn is only called when total is reached.
+func NewProgressTracker(total, every int, fn ProgressFn) *ProgressTracker {
+	return &ProgressTracker{Total: total, Every: every, Fn: fn, start: time.Now()}
+}
+
+// Add records n more units completed, and calls Fn if due.
+func (pt *ProgressTracker) Add(n int) {
+	pt.mu.Lock()
+	previous := pt.done
+	pt.done += n
+	p := Progress{Done: pt.done, Total: pt.Total, Elapsed: time.Since(pt.start)}
+	pt.mu.Unlock()
+
+	due := pt.Total > 0 && previous < pt.Total && p.Done >= pt.Total
+	if pt.Every > 0 && p.Done/pt.Every > previous/pt.Every {
+		due = true
+	}
+	if !due || pt.Fn == nil {
+		return
+	}
+	if p.Elapsed > 0 {
+		p.Rate = float64(p.Done) / p.Elapsed.Seconds()
+	}
+	if p.Total > 0 && p.Rate > 0 && p.Done < p.Total {
+		p.ETA = time.Duration(float64(p.Total-p.Done) / p.Rate * float64(time.Second))
+	}
+	pt.Fn(p)
+}
+
+// LogProgress returns a ProgressFn that logs the progress of the named job with
+// glog, at most once per interval, except for its completion which is always
+// logged. If interval is 0, it logs every time it is called.
+func LogProgress(name string, interval time.Duration) ProgressFn {
+	var mu sync.Mutex
+	var last time.Time
+	return func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now()
+		if (p.Total <= 0 || p.Done < p.Total) && now.Sub(last) < interval {
+			return
+		}
+		last = now
+		glog.Infof("%s: %s", name, p)
+	}
+}
@@ -0,0 +1,49 @@
+package ai_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+func TestProgressTracker(t *testing.T) {
+	var reports []ai.Progress
+	pt := ai.NewProgressTracker(5, 2, func(p ai.Progress) { reports = append(reports, p) })
+	for ii := 0; ii < 5; ii++ {
+		pt.Add(1)
+	}
+	// Called at 2, 4 and at the end.
+	if len(reports) != 3 {
+		t.Fatalf("Progress reported %d times, wanted 3: %v", len(reports), reports)
+	}
+	for ii, want := range []int{2, 4, 5} {
+		if reports[ii].Done != want || reports[ii].Total != 5 {
+			t.Errorf("Report #%d: %s, wanted %d/5 done", ii, reports[ii], want)
+		}
+	}
+	if last := reports[2]; last.ETA != 0 {
+		t.Errorf("Completed job should have no ETA, got %s", last.ETA)
+	}
+
+	// Concurrent use, with unknown total.
+	var mu sync.Mutex
+	count := 0
+	pt = ai.NewProgressTracker(0, 10, func(p ai.Progress) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+	})
+	var wg sync.WaitGroup
+	for ii := 0; ii < 100; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pt.Add(1)
+		}()
+	}
+	wg.Wait()
+	if count != 10 {
+		t.Errorf("Progress of 100 units reported %d times, wanted every 10 units", count)
+	}
+}
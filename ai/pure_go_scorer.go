@@ -0,0 +1,165 @@
+package ai
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// MLPLayer is a dense layer of a PureGoScorer: outputs = inputs * Kernel + Bias,
+// followed by the activation.
+type MLPLayer struct {
+	// Kernel is the row-major [InputDim][OutputDim] matrix of weights, and Bias
+	// has OutputDim values.
+	InputDim, OutputDim int
+	Kernel, Bias        []float32
+
+	// LeakyReLU applies the leaky ReLU activation, with slope LeakyAlpha for
+	// negative values, as the TensorFlow model. Otherwise the layer is linear.
+	LeakyReLU  bool
+	LeakyAlpha float32
+
+	// SkipInput concatenates the features of the network (not the inputs of the
+	// layer) to the outputs, as the skip connections of the TensorFlow model.
+	SkipInput bool
+}
+
+// PureGoScorer is a small MLP (multi-layer perceptron) that predicts the value
+// of the boards from FeatureVector, in pure Go. It is typically distilled from
+// a TensorFlow model (see tensorflow.Scorer.ExportPureGo), trading accuracy for
+// no native dependencies. It doesn't predict the policy.
+//
+// It implements BatchScorer, and it is safe for concurrent use.
+type PureGoScorer struct {
+	// FeaturesVersion is the version of FeatureVector used as input.
+	FeaturesVersion int
+
+	// Features is the subset of the features used as input, see
+	// FeatureVectorSubset. If nil all features of FeaturesVersion are used.
+	Features FeatureSet
+
+	// FeatureStats normalizes the features, as the model it was exported from.
+	// It can be nil.
+	FeatureStats *FeatureStats
+
+	// Layers are applied in order: the last one must have one output, the value
+	// of the board, which is limited by SigmoidTo10.
+	Layers []MLPLayer
+}
+
+// Validate checks that the dimensions of the layers match.
+func (s *PureGoScorer) Validate() error {
+	if len(s.Layers) == 0 {
+		return fmt.Errorf("PureGoScorer has no layers")
+	}
+	inputDim := s.InputDim()
+	dim := inputDim
+	for ii, layer := range s.Layers {
+		if layer.InputDim != dim {
+			return fmt.Errorf("Layer #%d has input dimension %d, wanted %d", ii, layer.InputDim, dim)
+		}
+		if len(layer.Kernel) != layer.InputDim*layer.OutputDim || len(layer.Bias) != layer.OutputDim {
+			return fmt.Errorf("Layer #%d has kernel of size %d and bias of size %d, wanted %dx%d and %d",
+				ii, len(layer.Kernel), len(layer.Bias), layer.InputDim, layer.OutputDim, layer.OutputDim)
+		}
+		dim = layer.OutputDim
+		if layer.SkipInput {
+			dim += inputDim
+		}
+	}
+	if dim != 1 {
+		return fmt.Errorf("Last layer has %d outputs, wanted 1", dim)
+	}
+	return nil
+}
+
+// InputDim returns the dimension of the features used as input.
+func (s *PureGoScorer) InputDim() int {
+	return s.Features.Dim(s.FeaturesVersion)
+}
+
+// ScoreFeatures returns the value predicted for the given (normalized) features,
+// before SigmoidTo10.
+func (s *PureGoScorer) ScoreFeatures(features []float32) float32 {
+	inputs := features
+	for _, layer := range s.Layers {
+		outputs := make([]float32, layer.OutputDim, layer.OutputDim+len(features))
+		copy(outputs, layer.Bias)
+		for ii, input := range inputs {
+			if input == 0 {
+				continue
+			}
+			row := layer.Kernel[ii*layer.OutputDim : (ii+1)*layer.OutputDim]
+			for jj, weight := range row {
+				outputs[jj] += input * weight
+			}
+		}
+		if layer.LeakyReLU {
+			for jj, output := range outputs {
+				if output < 0 {
+					outputs[jj] = output * layer.LeakyAlpha
+				}
+			}
+		}
+		if layer.SkipInput {
+			outputs = append(outputs, features...)
+		}
+		inputs = outputs
+	}
+	return inputs[0]
+}
+
+// Score implements Scorer.
+func (s *PureGoScorer) Score(b *Board) (score float32, actionProbs []float32) {
+	features := s.FeatureStats.NormalizeFeatures(FeatureVectorSubset(b, s.FeaturesVersion, s.Features),
+		s.InputDim())
+	return SigmoidTo10(s.ScoreFeatures(features)), nil
+}
+
+// BatchScore implements BatchScorer.
+func (s *PureGoScorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32) {
+	scores = make([]float32, len(boards))
+	for ii, board := range boards {
+		scores[ii], _ = s.Score(board)
+	}
+	return
+}
+
+// Version implements Scorer.
+func (s *PureGoScorer) Version() int { return s.FeaturesVersion }
+
+func (s *PureGoScorer) String() string {
+	return fmt.Sprintf("PureGoScorer(%d features, %d layers)", s.FeaturesVersion, len(s.Layers))
+}
+
+// SaveFile saves the scorer to the file, with encoding/gob.
+func (s *PureGoScorer) SaveFile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %v", file, err)
+	}
+	if err = gob.NewEncoder(f).Encode(s); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to encode PureGoScorer to %s: %v", file, err)
+	}
+	return f.Close()
+}
+
+// LoadPureGoScorer loads a scorer saved with PureGoScorer.SaveFile.
+func LoadPureGoScorer(file string) (*PureGoScorer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s: %v", file, err)
+	}
+	defer f.Close()
+	s := &PureGoScorer{}
+	if err = gob.NewDecoder(f).Decode(s); err != nil {
+		return nil, fmt.Errorf("Failed to decode PureGoScorer from %s: %v", file, err)
+	}
+	if err = s.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid PureGoScorer in %s: %v", file, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,144 @@
+package ai_test
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// referenceMLP is a straightforward float64 implementation of an MLP with skip
+// connections, as built by build_model.py, to compare to ai.PureGoScorer.
+type referenceMLP struct {
+	kernels [][][]float64 // [layer][input][output]
+	biases  [][]float64
+	hidden  int // Number of hidden layers, with leaky ReLU and skip connections.
+}
+
+func newReferenceMLP(rng *rand.Rand, inputDim int, hiddenDims []int) *referenceMLP {
+	mlp := &referenceMLP{hidden: len(hiddenDims)}
+	dim := inputDim
+	for _, outputDim := range append(hiddenDims, 1) {
+		kernel := make([][]float64, dim)
+		for ii := range kernel {
+			kernel[ii] = make([]float64, outputDim)
+			for jj := range kernel[ii] {
+				kernel[ii][jj] = rng.NormFloat64() * 0.3
+			}
+		}
+		bias := make([]float64, outputDim)
+		for jj := range bias {
+			bias[jj] = rng.NormFloat64() * 0.1
+		}
+		mlp.kernels = append(mlp.kernels, kernel)
+		mlp.biases = append(mlp.biases, bias)
+		dim = outputDim + inputDim
+	}
+	return mlp
+}
+
+func (mlp *referenceMLP) eval(features []float32) float64 {
+	x := make([]float64, len(features))
+	for ii, f := range features {
+		x[ii] = float64(f)
+	}
+	inputs := x
+	for layer, kernel := range mlp.kernels {
+		outputs := append([]float64(nil), mlp.biases[layer]...)
+		for jj := range outputs {
+			for ii := range inputs {
+				outputs[jj] += inputs[ii] * kernel[ii][jj]
+			}
+		}
+		if layer < mlp.hidden {
+			for jj, v := range outputs {
+				if v < 0 {
+					outputs[jj] = 0.2 * v
+				}
+			}
+			outputs = append(outputs, x...)
+		}
+		inputs = outputs
+	}
+	return inputs[0]
+}
+
+// toPureGo converts the reference MLP to an ai.PureGoScorer.
+func (mlp *referenceMLP) toPureGo(version int) *ai.PureGoScorer {
+	pure := &ai.PureGoScorer{FeaturesVersion: version}
+	for layer, kernel := range mlp.kernels {
+		outputDim := len(mlp.biases[layer])
+		l := ai.MLPLayer{InputDim: len(kernel), OutputDim: outputDim, LeakyAlpha: 0.2}
+		for _, row := range kernel {
+			for _, w := range row {
+				l.Kernel = append(l.Kernel, float32(w))
+			}
+		}
+		for _, b := range mlp.biases[layer] {
+			l.Bias = append(l.Bias, float32(b))
+		}
+		l.LeakyReLU = layer < mlp.hidden
+		l.SkipInput = layer < mlp.hidden
+		pure.Layers = append(pure.Layers, l)
+	}
+	return pure
+}
+
+func TestPureGoScorer(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	mlp := newReferenceMLP(rng, ai.AllFeaturesDim, []int{16, 8, 4})
+	pure := mlp.toPureGo(ai.AllFeaturesDim)
+	if err := pure.Validate(); err != nil {
+		t.Fatalf("Invalid PureGoScorer: %v", err)
+	}
+
+	// Boards of a random game.
+	var boards []*Board
+	board := NewBoard()
+	for ii := 0; ii < 20 && !board.IsFinished(); ii++ {
+		boards = append(boards, board)
+		board = board.Act(board.Derived.Actions[rng.Intn(len(board.Derived.Actions))])
+	}
+	scores, _ := pure.BatchScore(boards)
+	for ii, board := range boards {
+		features := ai.FeatureVector(board, ai.AllFeaturesDim)
+		want := mlp.eval(features)
+		if got := pure.ScoreFeatures(features); math.Abs(float64(got)-want) > 1e-4*math.Max(1, math.Abs(want)) {
+			t.Errorf("Board #%d: got %g, wanted %g", ii, got, want)
+		}
+		if want := ai.SigmoidTo10(float32(want)); math.Abs(float64(scores[ii]-want)) > 1e-4 {
+			t.Errorf("Board #%d: got score %g, wanted %g", ii, scores[ii], want)
+		}
+	}
+
+	// Save and load.
+	dir, err := ioutil.TempDir("", "hive_pure_go_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "model.gob")
+	if err = pure.SaveFile(file); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded, err := ai.LoadPureGoScorer(file)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	for ii, board := range boards {
+		if got, _ := loaded.Score(board); got != scores[ii] {
+			t.Errorf("Board #%d: loaded scorer got %g, wanted %g", ii, got, scores[ii])
+		}
+	}
+
+	// Mismatched dimensions.
+	pure.Layers[1].InputDim--
+	if err = pure.Validate(); err == nil {
+		t.Errorf("Validate should have failed with mismatched input dimension")
+	}
+}
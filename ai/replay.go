@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// REPLAY_MIN_PRIORITY is added to all priorities, so examples with 0 loss still
+// get sampled once in a while.
+const REPLAY_MIN_PRIORITY = 1e-3
+
+// ReplayBuffer holds training examples and samples them proportionally to their
+// priority (prioritized experience replay), so examples with larger loss are
+// trained on more often. The bias this introduces is compensated with
+// importance-sampling weights applied to the loss.
+type ReplayBuffer struct {
+	Boards        []*Board
+	BoardLabels   []float32
+	ActionsLabels [][]float32
+
+	// Alpha controls how much prioritization is used: 0 means uniform sampling,
+	// 1 means sampling proportional to priority.
+	Alpha float64
+
+	// Beta controls the importance-sampling correction: 0 means no correction,
+	// 1 fully compensates for the non-uniform sampling.
+	Beta float64
+
+	priorities  []float64
+	maxPriority float64
+}
+
+// NewReplayBuffer creates an empty ReplayBuffer. See ReplayBuffer for the
+// meaning of alpha and beta.
+func NewReplayBuffer(alpha, beta float64) *ReplayBuffer {
+	return &ReplayBuffer{Alpha: alpha, Beta: beta, maxPriority: 1.0}
+}
+
+// Len returns the number of examples in the buffer.
+func (rb *ReplayBuffer) Len() int { return len(rb.Boards) }
+
+// Add appends an example with the given priority, usually its last seen loss.
+// If priority is negative (unknown), the largest priority seen so far is used, so
+// that the new example is likely to be sampled soon. It returns the index of the
+// example.
+func (rb *ReplayBuffer) Add(board *Board, boardLabel float32, actionsLabels []float32, priority float32) int {
+	rb.Boards = append(rb.Boards, board)
+	rb.BoardLabels = append(rb.BoardLabels, boardLabel)
+	rb.ActionsLabels = append(rb.ActionsLabels, actionsLabels)
+	if priority < 0 {
+		rb.priorities = append(rb.priorities, rb.maxPriority)
+	} else {
+		rb.priorities = append(rb.priorities, 0)
+		rb.setPriority(len(rb.priorities)-1, priority)
+	}
+	return len(rb.Boards) - 1
+}
+
+// Priority returns the priority of the example with the given index.
+func (rb *ReplayBuffer) Priority(idx int) float64 { return rb.priorities[idx] }
+
+func (rb *ReplayBuffer) setPriority(idx int, loss float32) {
+	priority := float64(loss) + REPLAY_MIN_PRIORITY
+	rb.priorities[idx] = priority
+	if priority > rb.maxPriority {
+		rb.maxPriority = priority
+	}
+}
+
+// UpdatePriorities sets the priorities of the given examples to their new losses.
+func (rb *ReplayBuffer) UpdatePriorities(indices []int, losses []float32) {
+	if len(indices) != len(losses) {
+		log.Panicf("UpdatePriorities: %d indices but %d losses", len(indices), len(losses))
+	}
+	for ii, idx := range indices {
+		rb.setPriority(idx, losses[ii])
+	}
+}
+
+// Sample returns n indices of examples, sampled (with replacement) with probability
+// P(i) = priority_i^Alpha / sum_k(priority_k^Alpha), and their importance-sampling
+// weights, (N * P(i))^-Beta, normalized such that the largest weight is 1.
+func (rb *ReplayBuffer) Sample(n int, rng *rand.Rand) (indices []int, weights []float32) {
+	if rb.Len() == 0 {
+		log.Panicf("Sample called on empty ReplayBuffer")
+	}
+	cumulative := make([]float64, rb.Len())
+	total := 0.0
+	for ii, priority := range rb.priorities {
+		total += math.Pow(priority, rb.Alpha)
+		cumulative[ii] = total
+	}
+
+	indices = make([]int, n)
+	weights = make([]float32, n)
+	maxWeight := 0.0
+	weights64 := make([]float64, n)
+	for ii := range indices {
+		idx := sort.SearchFloat64s(cumulative, rng.Float64()*total)
+		if idx >= len(cumulative) {
+			idx = len(cumulative) - 1
+		}
+		indices[ii] = idx
+		prob := math.Pow(rb.priorities[idx], rb.Alpha) / total
+		weights64[ii] = math.Pow(float64(rb.Len())*prob, -rb.Beta)
+		if weights64[ii] > maxWeight {
+			maxWeight = weights64[ii]
+		}
+	}
+	for ii, weight := range weights64 {
+		weights[ii] = float32(weight / maxWeight)
+	}
+	return
+}
+
+// Learn samples a batch of batchSize examples, trains the learner on them weighted
+// by their importance-sampling weights, and updates their priorities with the
+// resulting losses. It returns the loss reported by the learner.
+func (rb *ReplayBuffer) Learn(learner ExamplesLossesLearner, batchSize int, learningRate float32,
+	steps int, rng *rand.Rand) float32 {
+	indices, weights := rb.Sample(batchSize, rng)
+	boards := make([]*Board, batchSize)
+	boardLabels := make([]float32, batchSize)
+	actionsLabels := make([][]float32, batchSize)
+	for ii, idx := range indices {
+		boards[ii] = rb.Boards[idx]
+		boardLabels[ii] = rb.BoardLabels[idx]
+		actionsLabels[ii] = rb.ActionsLabels[idx]
+	}
+	loss, losses := learner.LearnWithExamplesLosses(boards, boardLabels, actionsLabels, weights,
+		learningRate, steps)
+	rb.UpdatePriorities(indices, losses)
+	return loss
+}
@@ -0,0 +1,61 @@
+package ai_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestReplayBufferSample(t *testing.T) {
+	rb := ai.NewReplayBuffer(1.0, 1.0)
+	losses := []float32{1, 1, 8}
+	for _, loss := range losses {
+		rb.Add(NewBoard(), 0, nil, loss)
+	}
+
+	rng := rand.New(rand.NewSource(42))
+	const numSamples = 10000
+	counts := make([]int, rb.Len())
+	indices, weights := rb.Sample(numSamples, rng)
+	for ii, idx := range indices {
+		counts[idx]++
+		wantWeight := float32(1)
+		if idx == 2 {
+			wantWeight = float32(rb.Priority(0) / rb.Priority(2))
+		}
+		if math.Abs(float64(weights[ii]-wantWeight)) > 1e-5 {
+			t.Fatalf("Sample #%d (idx=%d): got weight %g, wanted %g", ii, idx, weights[ii], wantWeight)
+		}
+	}
+	if frac := float64(counts[2]) / numSamples; math.Abs(frac-0.8) > 0.02 {
+		t.Errorf("High priority example sampled %.3f of the times, wanted ~0.8 (counts=%v)", frac, counts)
+	}
+
+	// After updating priorities, the first example becomes the most likely.
+	rb.UpdatePriorities([]int{0, 2}, []float32{8, 1})
+	counts = make([]int, rb.Len())
+	indices, _ = rb.Sample(numSamples, rng)
+	for _, idx := range indices {
+		counts[idx]++
+	}
+	if counts[0] < 4*counts[2] {
+		t.Errorf("Updated priorities not reflected in sampling: counts=%v", counts)
+	}
+}
+
+func TestReplayBufferUniformWeights(t *testing.T) {
+	// With Alpha=0 sampling is uniform, and all weights should be 1.
+	rb := ai.NewReplayBuffer(0, 1.0)
+	for _, loss := range []float32{0.1, 5, 100} {
+		rb.Add(NewBoard(), 0, nil, loss)
+	}
+	_, weights := rb.Sample(100, rand.New(rand.NewSource(1)))
+	for ii, weight := range weights {
+		if math.Abs(float64(weight-1)) > 1e-5 {
+			t.Fatalf("Sample #%d: got weight %g, wanted 1", ii, weight)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ai
+
+import (
+	"encoding/json"
+	"math"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// ScoreGuard protects the search from scores of a misbehaving model: a single
+// NaN or infinite score would otherwise corrupt the search of a whole game.
+//
+// A nil ScoreGuard doesn't change any scores.
+type ScoreGuard struct {
+	// Limit is the absolute value scores are clamped to, e.g. 10 to match the
+	// scores of EndGameScore. If 0, finite scores are not clamped.
+	Limit float32
+
+	// Neutral is the score that replaces NaN scores.
+	Neutral float32
+
+	// numInvalid is the number of NaN or infinite scores replaced, accessed atomically.
+	numInvalid int64
+}
+
+// NewScoreGuard creates a ScoreGuard, see its fields.
+func NewScoreGuard(limit, neutral float32) *ScoreGuard {
+	return &ScoreGuard{Limit: limit, Neutral: neutral}
+}
+
+// Guard replaces, in place, NaN scores with g.Neutral, and clamps the others to
+// [-g.Limit, g.Limit]. Infinite scores are clamped to the limit, or replaced with
+// g.Neutral if there is no limit. NaN and infinite scores are logged with their
+// board, if boards is given (it can be nil).
+func (g *ScoreGuard) Guard(scores []float32, boards []*Board) {
+	if g == nil {
+		return
+	}
+	for ii, score := range scores {
+		isNaN, isInf := math.IsNaN(float64(score)), math.IsInf(float64(score), 0)
+		if isNaN || isInf {
+			atomic.AddInt64(&g.numInvalid, 1)
+			board := "not available"
+			if boards != nil {
+				data, err := json.Marshal(boards[ii])
+				if err != nil {
+					board = err.Error()
+				} else {
+					board = string(data)
+				}
+			}
+			glog.Errorf("Model returned score %g for board #%d, replacing it. Board: %s", score, ii, board)
+		}
+		switch {
+		case isNaN || (isInf && g.Limit <= 0):
+			scores[ii] = g.Neutral
+		case g.Limit > 0 && score > g.Limit:
+			scores[ii] = g.Limit
+		case g.Limit > 0 && score < -g.Limit:
+			scores[ii] = -g.Limit
+		}
+	}
+}
+
+// NumInvalid returns the number of NaN or infinite scores replaced so far.
+func (g *ScoreGuard) NumInvalid() int64 {
+	if g == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&g.numInvalid)
+}
@@ -0,0 +1,59 @@
+package ai_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// fixedScorer returns the given scores, in order, for the boards of a batch.
+type fixedScorer []float32
+
+func (s fixedScorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32) {
+	scores = append([]float32(nil), s[:len(boards)]...)
+	return scores, make([][]float32, len(boards))
+}
+
+func TestScoreGuard(t *testing.T) {
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	scorer := fixedScorer{nan, inf, -inf, 25, -3}
+	boards := symmetryTestBoards()
+	for len(boards) < len(scorer) {
+		boards = append(boards, NewBoard())
+	}
+	boards = boards[:len(scorer)]
+
+	guard := ai.NewScoreGuard(10, 0.5)
+	scores, _ := scorer.BatchScore(boards)
+	guard.Guard(scores, boards)
+	want := []float32{0.5, 10, -10, 10, -3}
+	for ii := range want {
+		if scores[ii] != want[ii] {
+			t.Errorf("Score #%d (%g): got %g, wanted %g", ii, scorer[ii], scores[ii], want[ii])
+		}
+	}
+	if got := guard.NumInvalid(); got != 3 {
+		t.Errorf("Got %d invalid scores logged, wanted 3", got)
+	}
+
+	// Without limit only NaN and infinite scores are replaced, and boards are optional.
+	guard = ai.NewScoreGuard(0, 0)
+	scores, _ = scorer.BatchScore(boards)
+	guard.Guard(scores, nil)
+	want = []float32{0, 0, 0, 25, -3}
+	for ii := range want {
+		if scores[ii] != want[ii] {
+			t.Errorf("Score #%d (%g) with no limit: got %g, wanted %g", ii, scorer[ii], scores[ii], want[ii])
+		}
+	}
+
+	// A nil guard doesn't change the scores.
+	var nilGuard *ai.ScoreGuard
+	scores = []float32{nan, 25}
+	nilGuard.Guard(scores, nil)
+	if !math.IsNaN(float64(scores[0])) || scores[1] != 25 {
+		t.Errorf("Nil ScoreGuard changed the scores to %v", scores)
+	}
+}
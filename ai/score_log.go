@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// SCORE_LOG_TOP_ACTIONS is the number of most probable actions included in each
+// ScoreLogRecord.
+const SCORE_LOG_TOP_ACTIONS = 5
+
+// ScoreLogRecord is what ScoreLogger writes, as one line of JSON, for each board
+// scored.
+type ScoreLogRecord struct {
+	Board      *Board       `json:"board"`
+	Score      float32      `json:"score"`
+	TopActions []ActionProb `json:"top_actions,omitempty"`
+}
+
+// ActionProb is an action, in the notation of Action.Notation, and its probability.
+type ActionProb struct {
+	Action string  `json:"action"`
+	Prob   float32 `json:"prob"`
+}
+
+// ScoreLogger is a BatchScorer that logs every board scored, its score and its
+// most probable actions, to help debug the choices of a model. It writes a lot,
+// so it's meant to be enabled only when debugging.
+//
+// It is safe for concurrent use if the wrapped scorer is.
+type ScoreLogger struct {
+	BatchScorer
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewScoreLogger returns scorer wrapped by a ScoreLogger that appends its
+// records to w.
+func NewScoreLogger(scorer BatchScorer, w io.Writer) *ScoreLogger {
+	return &ScoreLogger{BatchScorer: scorer, enc: json.NewEncoder(w)}
+}
+
+// Score implements Scorer.
+func (sl *ScoreLogger) Score(board *Board) (score float32, actionProbs []float32) {
+	score, actionProbs = sl.BatchScorer.Score(board)
+	sl.log(board, score, actionProbs)
+	return
+}
+
+// BatchScore implements BatchScorer.
+func (sl *ScoreLogger) BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32) {
+	scores, actionProbsBatch = sl.BatchScorer.BatchScore(boards)
+	for ii, board := range boards {
+		var actionProbs []float32
+		if ii < len(actionProbsBatch) {
+			actionProbs = actionProbsBatch[ii]
+		}
+		sl.log(board, scores[ii], actionProbs)
+	}
+	return
+}
+
+// log writes the record of one board. Failures to write are logged, but don't
+// interrupt the scoring.
+func (sl *ScoreLogger) log(board *Board, score float32, actionProbs []float32) {
+	record := ScoreLogRecord{Board: board, Score: score}
+	if len(actionProbs) == len(board.Derived.Actions) {
+		for ii, action := range board.Derived.Actions {
+			record.TopActions = append(record.TopActions, ActionProb{action.Notation(), actionProbs[ii]})
+		}
+		sort.SliceStable(record.TopActions, func(i, j int) bool {
+			return record.TopActions[i].Prob > record.TopActions[j].Prob
+		})
+		if len(record.TopActions) > SCORE_LOG_TOP_ACTIONS {
+			record.TopActions = record.TopActions[:SCORE_LOG_TOP_ACTIONS]
+		}
+	}
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if err := sl.enc.Encode(&record); err != nil {
+		glog.Errorf("Failed to log score of board at move %d: %v", board.MoveNumber, err)
+	}
+}
@@ -0,0 +1,64 @@
+package ai_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestScoreLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := ai.NewScoreLogger(ai.TrainedBest, &buf)
+	boards := symmetryTestBoards()
+	score, actionProbs := logger.Score(boards[2])
+	scores, _ := logger.BatchScore(boards[:2])
+
+	dec := json.NewDecoder(&buf)
+	var records []ai.ScoreLogRecord
+	for dec.More() {
+		var record ai.ScoreLogRecord
+		if err := dec.Decode(&record); err != nil {
+			t.Fatalf("Failed to parse score log record #%d: %v", len(records), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Got %d score log records, wanted 3", len(records))
+	}
+
+	record := records[0]
+	if record.Score != score {
+		t.Errorf("Logged score %g, wanted %g", record.Score, score)
+	}
+	if record.Board.CanonicalHash() != boards[2].CanonicalHash() || record.Board.NextPlayer != boards[2].NextPlayer {
+		t.Errorf("Logged board differs from the one scored:\n%s", record.Board.RenderASCII())
+	}
+	if len(actionProbs) > 0 && len(record.TopActions) == 0 {
+		t.Errorf("Top actions not logged")
+	}
+	if len(record.TopActions) > ai.SCORE_LOG_TOP_ACTIONS {
+		t.Errorf("Logged %d top actions, wanted at most %d", len(record.TopActions), ai.SCORE_LOG_TOP_ACTIONS)
+	}
+	for ii, actionProb := range record.TopActions {
+		action, err := ParseAction(actionProb.Action)
+		if err != nil {
+			t.Errorf("Failed to parse logged action %q: %v", actionProb.Action, err)
+			continue
+		}
+		if idx := boards[2].FindActionDeep(action); actionProbs[idx] != actionProb.Prob {
+			t.Errorf("Logged action %s with probability %g, not the one scored", action, actionProb.Prob)
+		}
+		if ii > 0 && actionProb.Prob > record.TopActions[ii-1].Prob {
+			t.Errorf("Logged top actions not sorted by probability: %v", record.TopActions)
+		}
+	}
+	for ii, score := range scores {
+		if records[ii+1].Score != score || records[ii+1].Board.MoveNumber != boards[ii].MoveNumber {
+			t.Errorf("Batch record #%d has score %g at move %d, wanted %g at move %d", ii,
+				records[ii+1].Score, records[ii+1].Board.MoveNumber, score, boards[ii].MoveNumber)
+		}
+	}
+}
@@ -36,26 +36,57 @@ func printBoard(b *Board) {
 //    bestScore: score of taking betAction
 func AlphaBeta(board *Board, scorer ai.BatchScorer, maxDepth int, parallelize bool) (
 	bestAction Action, bestBoard *Board, bestScore float32) {
+	return alphaBeta(board, scorer, maxDepth, parallelize, nil, nil, nil)
+}
+
+// nodeBudget limits the number of nodes (boards scored) visited by a search: once
+// exhausted, the search is aborted before going any deeper, and its result must be
+// discarded. A nil nodeBudget is unlimited.
+type nodeBudget struct {
+	maxNodes, visited int
+	aborted           bool
+}
+
+func (nb *nodeBudget) visit(numNodes int) {
+	if nb != nil {
+		nb.visited += numNodes
+	}
+}
+
+func (nb *nodeBudget) exhausted() bool {
+	return nb != nil && nb.visited >= nb.maxNodes
+}
+
+// alphaBeta is like AlphaBeta, with an optional budget of nodes, TieBreaker for
+// the actions with the same score, and cursor to record the tree searched.
+func alphaBeta(board *Board, scorer ai.BatchScorer, maxDepth int, parallelize bool, budget *nodeBudget,
+	tb *TieBreaker, tc *treeCursor) (bestAction Action, bestBoard *Board, bestScore float32) {
 	alpha := float32(-math.MaxFloat32)
 	beta := float32(-math.MaxFloat32)
 	if parallelize {
 		// TODO: move to a parallelized version.
-		bestAction, bestBoard, bestScore = alphaBetaRecursive(board, scorer, maxDepth, alpha, beta)
+		bestAction, bestBoard, bestScore = alphaBetaRecursive(board, scorer, maxDepth, alpha, beta, budget, tb, tc)
 	} else {
-		bestAction, bestBoard, bestScore = alphaBetaRecursive(board, scorer, maxDepth, alpha, beta)
+		bestAction, bestBoard, bestScore = alphaBetaRecursive(board, scorer, maxDepth, alpha, beta, budget, tb, tc)
 	}
+	tc.setScore(bestScore)
 	return
 }
 
-func alphaBetaRecursive(board *Board, scorer ai.BatchScorer, maxDepth int, alpha, beta float32) (
-	bestAction Action, bestBoard *Board, bestScore float32) {
+func alphaBetaRecursive(board *Board, scorer ai.BatchScorer, maxDepth int, alpha, beta float32, budget *nodeBudget,
+	tb *TieBreaker, tc *treeCursor) (bestAction Action, bestBoard *Board, bestScore float32) {
+	if tc != nil {
+		defer func() { tc.markBest(bestAction) }()
+	}
 
 	// If there are no valid actions, create the "pass" action
 	actions, newBoards, scores := ScoredActions(board, scorer)
+	budget.visit(len(actions))
 	if len(actions) == 1 && newBoards[0].IsFinished() {
+		tc.child(actions[0]).setScore(scores[0])
 		return actions[0], newBoards[0], scores[0]
 	}
-	SortActionsBoardsScores(actions, newBoards, scores)
+	sortActionsBoardsScores(board, actions, newBoards, scores, tb)
 
 	// The score to beat is the current "alpha" (best live score for current player)
 	bestScore = alpha
@@ -66,11 +97,22 @@ func alphaBetaRecursive(board *Board, scorer ai.BatchScorer, maxDepth int, alpha
 			// Wait for an "idle" signal before each search.
 			<-IdleChan
 		}
+		if maxDepth > 1 && !newBoards[ii].IsFinished() && budget.exhausted() {
+			// The scores of the remaining actions would be shallower than the ones
+			// already searched, so the search is aborted.
+			budget.aborted = true
+			return
+		}
+		child := tc.child(actions[ii])
 		if maxDepth > 1 && !newBoards[ii].IsFinished() {
 			// Runs alphaBeta for opponent player, so the alpha/beta are reversed.
-			_, _, score := alphaBetaRecursive(newBoards[ii], scorer, maxDepth-1, beta, bestScore)
+			_, _, score := alphaBetaRecursive(newBoards[ii], scorer, maxDepth-1, beta, bestScore, budget, tb, child)
+			if budget != nil && budget.aborted {
+				return
+			}
 			scores[ii] = -score
 		}
+		child.setScore(scores[ii])
 
 		// Update best score.
 		if scores[ii] > bestScore {
@@ -106,7 +148,7 @@ func alphaBetaParallelized(board *Board, scorer ai.BatchScorer, maxDepth int, al
 	for ii := range actions {
 		if maxDepth > 1 && !newBoards[ii].IsFinished() {
 			// Runs alphaBeta for opponent player, so the alpha/beta are reversed.
-			_, _, score := alphaBetaRecursive(newBoards[ii], scorer, maxDepth-1, beta, bestScore)
+			_, _, score := alphaBetaRecursive(newBoards[ii], scorer, maxDepth-1, beta, bestScore, nil, nil, nil)
 			scores[ii] = -score
 		}
 
@@ -128,15 +170,53 @@ func alphaBetaParallelized(board *Board, scorer ai.BatchScorer, maxDepth int, al
 }
 
 type alphaBetaSearcher struct {
-	maxDepth     int
-	parallelized bool
+	maxDepth, maxNodes int
+	parallelized       bool
+	tieBreaker         *TieBreaker
 
 	scorer ai.BatchScorer
 }
 
+// alphaBeta runs AlphaBeta with the searcher's configuration. If rec is not nil,
+// the tree searched is recorded.
+func (ab *alphaBetaSearcher) alphaBeta(b *Board, rec *TreeRecorder) (bestAction Action, bestBoard *Board,
+	bestScore float32) {
+	if ab.maxNodes <= 0 {
+		return alphaBeta(b, ab.scorer, ab.maxDepth, ab.parallelized, nil, ab.tieBreaker, newTreeCursor(rec))
+	}
+
+	// Iterative deepening within the budget of nodes: the result of the deepest
+	// search completed is used, so the scores compared are all of the same depth.
+	// The search of depth 1 is never aborted.
+	budget := &nodeBudget{maxNodes: ab.maxNodes}
+	var root *TreeNode
+	for depth := 1; depth <= ab.maxDepth; depth++ {
+		action, board, score := alphaBeta(b, ab.scorer, depth, ab.parallelized, budget, ab.tieBreaker,
+			newTreeCursor(rec))
+		if budget.aborted {
+			glog.V(2).Infof("Budget of %d nodes exhausted at depth %d", ab.maxNodes, depth)
+			break
+		}
+		bestAction, bestBoard, bestScore = action, board, score
+		if rec != nil {
+			root = rec.Root
+		}
+	}
+	if rec != nil {
+		rec.Root = root
+	}
+	return
+}
+
 // Search implements the Searcher interface.
 func (ab *alphaBetaSearcher) Search(b *Board) (action Action, board *Board, score float32, actionsLabels []float32) {
-	action, board, score = AlphaBeta(b, ab.scorer, ab.maxDepth, ab.parallelized)
+	return ab.SearchWithTree(b, nil)
+}
+
+// SearchWithTree implements the TreeSearcher interface.
+func (ab *alphaBetaSearcher) SearchWithTree(b *Board, rec *TreeRecorder) (action Action, board *Board, score float32,
+	actionsLabels []float32) {
+	action, board, score = ab.alphaBeta(b, rec)
 	actionsLabels = make([]float32, len(b.Derived.Actions))
 	if !action.IsSkipAction() {
 		actionsLabels[b.FindAction(action)] = 1
@@ -145,8 +225,21 @@ func (ab *alphaBetaSearcher) Search(b *Board) (action Action, board *Board, scor
 }
 
 // NewAlphaBetaSearcher returns a Searcher that implements AlphaBetaPruning.
-func NewAlphaBetaSearcher(maxDepth int, parallelized bool, scorer ai.BatchScorer) Searcher {
-	return &alphaBetaSearcher{maxDepth: maxDepth, parallelized: parallelized, scorer: scorer}
+//
+// If maxNodes > 0, each search uses iterative deepening up to maxDepth, until
+// that many nodes (boards scored) were visited, and returns the best action of the
+// deepest search completed. Unlike a time limit, the result doesn't depend on the
+// hardware.
+func NewAlphaBetaSearcher(maxDepth, maxNodes int, parallelized bool, scorer ai.BatchScorer) Searcher {
+	return NewAlphaBetaSearcherWithTieBreak(maxDepth, maxNodes, parallelized, scorer, nil)
+}
+
+// NewAlphaBetaSearcherWithTieBreak is like NewAlphaBetaSearcher, but the actions
+// with the same score are ordered by the given TieBreaker: the first one is taken.
+func NewAlphaBetaSearcherWithTieBreak(maxDepth, maxNodes int, parallelized bool, scorer ai.BatchScorer,
+	tb *TieBreaker) Searcher {
+	return &alphaBetaSearcher{maxDepth: maxDepth, maxNodes: maxNodes, parallelized: parallelized, scorer: scorer,
+		tieBreaker: tb}
 }
 
 // ScoreMatch will score the board at each board position, starting from the current one,
@@ -156,7 +249,7 @@ func (ab *alphaBetaSearcher) ScoreMatch(b *Board, actions []Action, want []*Boar
 	scores = make([]float32, 0, len(actions)+1)
 	actionsLabels = make([][]float32, 0, len(actions))
 	for _, action := range actions {
-		bestAction, newBoard, score := AlphaBeta(b, ab.scorer, ab.maxDepth, ab.parallelized)
+		bestAction, newBoard, score := ab.alphaBeta(b, nil)
 		scores = append(scores, score)
 		if len(b.Derived.Actions) > 0 {
 			// AlphaBetaPrunning policy is binary, effectively being one-hot-encoding.
@@ -187,7 +280,7 @@ func (ab *alphaBetaSearcher) ScoreMatch(b *Board, actions []Action, want []*Boar
 	if isEnd, score := ai.EndGameScore(b); isEnd {
 		scores = append(scores, score)
 	} else {
-		_, _, score = AlphaBeta(b, ab.scorer, ab.maxDepth, ab.parallelized)
+		_, _, score = ab.alphaBeta(b, nil)
 		scores = append(scores, score)
 	}
 	return
@@ -71,3 +71,85 @@ func TestEndGameMove(t *testing.T) {
 		t.Errorf("Wanted %s, got %s -> score=%.2f\n", want, action, score)
 	}
 }
+
+// countingScorer counts the boards scored.
+type countingScorer struct {
+	ai.BatchScorer
+	count int
+}
+
+func (s *countingScorer) Score(b *Board) (float32, []float32) {
+	s.count++
+	return s.BatchScorer.Score(b)
+}
+
+func (s *countingScorer) BatchScore(boards []*Board) ([]float32, [][]float32) {
+	s.count += len(boards)
+	return s.BatchScorer.BatchScore(boards)
+}
+
+func TestAlphaBetaMaxNodes(t *testing.T) {
+	layout := []PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{2, 1}, 0, SPIDER},
+		{Pos{-2, 2}, 1, GRASSHOPPER},
+	}
+	const maxNodes = 2000
+	var firstAction Action
+	for run := 0; run < 3; run++ {
+		// Building the board again reshuffles its actions.
+		board := buildBoard(layout)
+		board.BuildDerived()
+		counter := &countingScorer{BatchScorer: scorer}
+		action, _, _, _ := NewAlphaBetaSearcher(4, maxNodes, false, counter).Search(board)
+		if run == 0 {
+			firstAction = action
+			// The budget is only checked before going deeper, so the last node
+			// expanded at each level may go over it.
+			if counter.count > 2*maxNodes {
+				t.Errorf("Search with budget of %d nodes scored %d boards", maxNodes, counter.count)
+			}
+		} else if !action.Equal(firstAction) {
+			t.Errorf("Run %d chose %s, but first run chose %s with the same budget of nodes", run, action, firstAction)
+		}
+	}
+}
+
+func TestAlphaBetaMaxNodesDeepestCompleted(t *testing.T) {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+	})
+	board.BuildDerived()
+	const maxDepth = 3
+	var fullScores [maxDepth + 1]float32
+	for depth := 1; depth <= maxDepth; depth++ {
+		_, _, fullScores[depth], _ = NewAlphaBetaSearcher(depth, 0, false, scorer).Search(board)
+	}
+
+	// With a budget, the result is the one of a complete search of some depth,
+	// never a mix of deep and shallow scores.
+	for _, maxNodes := range []int{1, 100, 500, 2000, 1 << 30} {
+		_, _, score, _ := NewAlphaBetaSearcher(maxDepth, maxNodes, false, scorer).Search(board)
+		found := false
+		for depth := 1; depth <= maxDepth; depth++ {
+			found = found || score == fullScores[depth]
+		}
+		if !found {
+			t.Errorf("Budget of %d nodes got score %g, not one of the complete searches %v", maxNodes, score,
+				fullScores[1:])
+		}
+	}
+	if _, _, score, _ := NewAlphaBetaSearcher(maxDepth, 1, false, scorer).Search(board); score != fullScores[1] {
+		t.Errorf("Budget of 1 node got score %g, wanted the one of depth 1, %g", score, fullScores[1])
+	}
+	if _, _, score, _ := NewAlphaBetaSearcher(maxDepth, 1<<30, false, scorer).Search(board); score != fullScores[maxDepth] {
+		t.Errorf("Unlimited budget got score %g, wanted the one of depth %d, %g", score, maxDepth,
+			fullScores[maxDepth])
+	}
+}
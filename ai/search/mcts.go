@@ -42,6 +42,9 @@ type mctsSearcher struct {
 	// only on the first level of the MCTS traversal.
 	randomness float32
 
+	// Temperature used to convert the visit counts to action labels, see ai.VisitCountPolicy.
+	temperature float64
+
 	// If to explore paths in parallel. Not yet supported.
 	parallelized bool
 
@@ -58,7 +61,7 @@ type matchStats struct {
 func NewMonteCarloTreeSearcher(
 	scorer ai.BatchScorer,
 	maxDepth int, maxTime time.Duration, maxTraverses int, maxAbsScore float32,
-	cPuct float32, randomness float64, parallelized bool) Searcher {
+	cPuct float32, randomness, temperature float64, parallelized bool) Searcher {
 	if parallelized {
 		glog.Error("MCTS does not yet support parallelized run.")
 		parallelized = false
@@ -70,6 +73,7 @@ func NewMonteCarloTreeSearcher(
 		maxAbsScore:  maxAbsScore,
 		cPuct:        cPuct,
 		randomness:   float32(randomness),
+		temperature:  temperature,
 
 		scorer:       scorer,
 		parallelized: parallelized,
@@ -140,8 +144,12 @@ func newCacheNode(mcts *mctsSearcher, stats *matchStats, b *Board, root bool) *c
 	}
 	cn.score, cn.actionsProbs = mcts.scorer.Score(b)
 	if root && mcts.randomness > 0 {
+		normFloat64 := rand.NormFloat64
+		if rng := b.Rand(); rng != nil {
+			normFloat64 = rng.NormFloat64
+		}
 		for ii := range cn.actionsProbs {
-			cn.actionsProbs[ii] += float32(rand.NormFloat64()) * mcts.randomness
+			cn.actionsProbs[ii] += float32(normFloat64()) * mcts.randomness
 		}
 	}
 	return cn
@@ -253,9 +261,9 @@ func (cn *cacheNode) FindBestScore(mcts *mctsSearcher) (bestIdx int, bestScore f
 
 	// If nothing was visited, simply return the current estimated score
 	// and the action with largest probability.
-	actionsLabels = make([]float32, len(cn.actions))
 	if cn.totalCount == 0 {
 		glog.Errorf("MCTS.FindBestNode() called with no visits having been made.")
+		actionsLabels = make([]float32, len(cn.actions))
 		bestScore = cn.score
 		bestIdx = 0
 		bestProb := cn.actionsProbs[0]
@@ -274,15 +282,14 @@ func (cn *cacheNode) FindBestScore(mcts *mctsSearcher) (bestIdx int, bestScore f
 	// Q(s,a) estimation. Final score is given by mean of the sumMCScores.
 	bestIdx = -1
 	bestCount := -1
-	totalCount := float32(cn.totalCount)
 	for ii := 0; ii < len(cn.actions); ii++ {
 		if cn.count[ii] > bestCount || (cn.count[ii] == bestCount && cn.Q[ii] > bestScore) {
 			bestIdx = ii
 			bestCount = cn.count[ii]
 			bestScore = cn.Q[ii]
 		}
-		actionsLabels[ii] = float32(cn.count[ii]) / totalCount
 	}
+	actionsLabels = ai.VisitCountPolicy(cn.count, mcts.temperature)
 	bestScore = cn.sumMCScores[bestIdx] / float32(cn.count[bestIdx])
 	return
 }
@@ -434,7 +441,13 @@ func (mcts *mctsSearcher) measuredRunOnCN(stats *matchStats, cn *cacheNode) {
 // Search implements the Searcher interface.
 func (mcts *mctsSearcher) Search(b *Board) (
 	action Action, board *Board, score float32, actionsLabels []float32) {
-	return mcts.searchWithStats(nil, b)
+	return mcts.searchWithStats(nil, b, nil)
+}
+
+// SearchWithTree implements the TreeSearcher interface.
+func (mcts *mctsSearcher) SearchWithTree(b *Board, rec *TreeRecorder) (
+	action Action, board *Board, score float32, actionsLabels []float32) {
+	return mcts.searchWithStats(nil, b, rec)
 }
 
 type sortableProbsActions struct {
@@ -473,7 +486,7 @@ func logTopActionProbs(probs []float32, actions []Action, scores []float32) {
 	}
 }
 
-func (mcts *mctsSearcher) searchWithStats(stats *matchStats, b *Board) (
+func (mcts *mctsSearcher) searchWithStats(stats *matchStats, b *Board, rec *TreeRecorder) (
 	action Action, board *Board, score float32, actionsLabels []float32) {
 	cn := newCacheNode(mcts, stats, b, true)
 	if glog.V(1) {
@@ -488,6 +501,10 @@ func (mcts *mctsSearcher) searchWithStats(stats *matchStats, b *Board) (
 
 	var actionIdx int
 	actionIdx, score, actionsLabels = cn.FindBestScore(mcts)
+	if tc := newTreeCursor(rec); tc != nil {
+		tc.setScore(score)
+		tc.recordMCTS(cn, actionIdx)
+	}
 	board = nil
 	if actionIdx >= 0 {
 		action = cn.actions[actionIdx]
@@ -0,0 +1,77 @@
+package search
+
+import (
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// gamePositions returns the Board.CanonicalHash of the positions of the game so
+// far, following Board.Previous from b (included).
+func gamePositions(b *Board) map[uint64]bool {
+	seen := make(map[uint64]bool)
+	for ; b != nil; b = b.Previous {
+		seen[b.CanonicalHash()] = true
+	}
+	return seen
+}
+
+// repetitionScorer adds the penalty to the score of the boards of positions
+// already seen in the game: their next player is the opponent of the one that
+// returned to the position.
+type repetitionScorer struct {
+	ai.BatchScorer
+	seen    map[uint64]bool
+	penalty float32
+}
+
+func (rs *repetitionScorer) Score(b *Board) (float32, []float32) {
+	score, actionProbs := rs.BatchScorer.Score(b)
+	if rs.seen[b.CanonicalHash()] {
+		score += rs.penalty
+	}
+	return score, actionProbs
+}
+
+func (rs *repetitionScorer) BatchScore(boards []*Board) ([]float32, [][]float32) {
+	scores, actionProbsBatch := rs.BatchScorer.BatchScore(boards)
+	for ii, b := range boards {
+		if rs.seen[b.CanonicalHash()] {
+			scores[ii] += rs.penalty
+		}
+	}
+	return scores, actionProbsBatch
+}
+
+type repetitionSearcher struct {
+	newSearcher func(scorer ai.BatchScorer) Searcher
+	searcher    Searcher
+	scorer      ai.BatchScorer
+	penalty     float32
+}
+
+// Search implements the Searcher interface.
+func (rs *repetitionSearcher) Search(b *Board) (Action, *Board, float32, []float32) {
+	scorer := &repetitionScorer{BatchScorer: rs.scorer, seen: gamePositions(b), penalty: rs.penalty}
+	return rs.newSearcher(scorer).Search(b)
+}
+
+// ScoreMatch implements the Searcher interface, without the penalty: it only
+// affects the choice of the actions.
+func (rs *repetitionSearcher) ScoreMatch(b *Board, actions []Action, want []*Board) (
+	scores []float32, actionsLabels [][]float32) {
+	return rs.searcher.ScoreMatch(b, actions, want)
+}
+
+// NewRepetitionSearcher returns a Searcher that discourages returning to a
+// position (see Board.CanonicalHash) already seen in the game, e.g. beetles
+// shuffling back and forth until Board.MaxMoves in self-play.
+//
+// For each search, newSearcher creates the searcher with a scorer that adds
+// penalty to the score of the boards of the positions seen in the game, so it's
+// subtracted from the score of the player that returns to them. So all actions
+// are compared in the same search, and the search costs the same.
+func NewRepetitionSearcher(newSearcher func(scorer ai.BatchScorer) Searcher, scorer ai.BatchScorer,
+	penalty float32) Searcher {
+	return &repetitionSearcher{newSearcher: newSearcher, searcher: newSearcher(scorer), scorer: scorer,
+		penalty: penalty}
+}
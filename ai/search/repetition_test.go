@@ -0,0 +1,119 @@
+package search_test
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// repeatScorer scores the boards with the given Board.CanonicalHash as lost for
+// their next player, so the previous player is attracted to them.
+type repeatScorer struct {
+	ai.BatchScorer
+	hash uint64
+}
+
+func (s repeatScorer) Score(b *Board) (float32, []float32) {
+	if b.CanonicalHash() == s.hash {
+		return -1, nil
+	}
+	return 0, nil
+}
+
+func (s repeatScorer) BatchScore(boards []*Board) ([]float32, [][]float32) {
+	scores := make([]float32, len(boards))
+	for ii, b := range boards {
+		scores[ii], _ = s.Score(b)
+	}
+	return scores, nil
+}
+
+// countingSearcher counts the calls to Search.
+type countingSearcher struct {
+	Searcher
+	searches int
+}
+
+func (s *countingSearcher) Search(b *Board) (Action, *Board, float32, []float32) {
+	s.searches++
+	return s.Searcher.Search(b)
+}
+
+// findRepetition plays a game until it finds a sequence of 3 moves after which
+// the next player can return to the position before them. It returns that
+// position and the board after the 3 moves.
+func findRepetition(t *testing.T) (start, board *Board) {
+	// The actions are sorted, so the game doesn't depend on their order.
+	rng := rand.New(rand.NewSource(3))
+	start = NewBoard()
+	for ii := 0; ii < 10; ii++ {
+		actions := append([]Action(nil), start.Derived.Actions...)
+		sort.Slice(actions, func(i, j int) bool { return actions[i].Encode() < actions[j].Encode() })
+		start = start.Act(actions[rng.Intn(len(actions))])
+	}
+	startHash := start.CanonicalHash()
+	for _, a1 := range start.Derived.Actions {
+		if !a1.Move {
+			continue
+		}
+		b1 := start.Act(a1)
+		for _, a2 := range b1.Derived.Actions {
+			if !a2.Move {
+				continue
+			}
+			b2 := b1.Act(a2)
+			for _, a3 := range b2.Derived.Actions {
+				if !a3.Move || a3.Piece != a1.Piece {
+					continue
+				}
+				b3 := b2.Act(a3)
+				for _, a4 := range b3.Derived.Actions {
+					if b4 := b3.Act(a4); !b4.IsFinished() && b4.CanonicalHash() == startHash {
+						return start, b3
+					}
+				}
+			}
+		}
+	}
+	t.Fatalf("No repetition found in the game")
+	return
+}
+
+func TestRepetitionSearcher(t *testing.T) {
+	start, board := findRepetition(t)
+	scorer := repeatScorer{scorer, start.CanonicalHash()}
+	searcher := NewAlphaBetaSearcher(1, 0, false, scorer)
+
+	// Without penalty the searcher returns to the start position.
+	action, newBoard, _, _ := searcher.Search(board)
+	if newBoard.CanonicalHash() != start.CanonicalHash() {
+		t.Fatalf("Action %s doesn't return to the start position", action)
+	}
+
+	// With the penalty it makes progress instead, in a single search.
+	counting := &countingSearcher{}
+	searcher = NewRepetitionSearcher(func(scorer ai.BatchScorer) Searcher {
+		counting.Searcher = NewAlphaBetaSearcher(1, 0, false, scorer)
+		return counting
+	}, scorer, 2)
+	action, newBoard, score, actionsLabels := searcher.Search(board)
+	if counting.searches != 1 {
+		t.Errorf("Searched %d times, wanted 1", counting.searches)
+	}
+	hash := newBoard.CanonicalHash()
+	for b := board; b != nil; b = b.Previous {
+		if b.CanonicalHash() == hash {
+			t.Fatalf("Action %s repeats a position of the game", action)
+		}
+	}
+	if score != 0 {
+		t.Errorf("Got score %g for %s, wanted 0", score, action)
+	}
+	if idx := board.FindAction(action); actionsLabels[idx] != 1 {
+		t.Errorf("Actions labels %v don't select the action %s", actionsLabels, action)
+	}
+}
@@ -95,8 +95,78 @@ func ScoredActions(b *Board, scorer ai.BatchScorer) ([]Action, []*Board, []float
 	return actions, newBoards, scores
 }
 
+// ForcedAction checks with a one-ply scan whether the outcome of the next move
+// is already decided, in which case there is no need to search deeper. It returns
+// found=true if:
+//
+//   * b is already finished: action is a skip, and board is b itself.
+//   * There is an action that leads to b.NextPlayer winning, which is returned.
+//   * All actions but one lead to b.NextPlayer losing, so the one that avoids losing
+//     is returned. In this case the scorer is used to score the resulting board.
+//   * All actions lose: the first action is returned.
+//
+// The score returned is for b.NextPlayer.
+//
+// An action changes at most two positions (its source and its target), so it
+// can only surround a queen that has already 5 neighbours. Otherwise, unless
+// there is only one action, the scan is skipped: the searchers expand the
+// actions again anyway.
+func ForcedAction(b *Board, scorer ai.BatchScorer) (
+	action Action, board *Board, score float32, actionsLabels []float32, found bool) {
+	if isEnd, endScore := ai.EndGameScore(b); isEnd {
+		return SKIP_ACTION, b, endScore, nil, true
+	}
+	actions := b.Derived.Actions
+	if len(actions) == 0 {
+		return
+	}
+	if len(actions) > 1 && b.Derived.NumSurroundingQueen[0] < 5 && b.Derived.NumSurroundingQueen[1] < 5 {
+		return
+	}
+
+	nonLosingIdx, numNonLosing := -1, 0
+	var nonLosingBoard *Board
+	for ii, action := range actions {
+		newBoard := b.Act(action)
+		isEnd, endScore := ai.EndGameScore(newBoard)
+		endScore = -endScore // Score for b.NextPlayer, not newBoard.NextPlayer
+		if isEnd && endScore > 0 {
+			return action, newBoard, endScore, ai.OneHotEncoding(len(actions), ii), true
+		}
+		if !isEnd || endScore == 0 {
+			numNonLosing++
+			nonLosingIdx, nonLosingBoard = ii, newBoard
+		}
+	}
+
+	if numNonLosing == 0 {
+		board = b.Act(actions[0])
+		_, score = ai.EndGameScore(board)
+		return actions[0], board, -score, ai.OneHotEncoding(len(actions), 0), true
+	}
+	if numNonLosing == 1 {
+		if isEnd, endScore := ai.EndGameScore(nonLosingBoard); isEnd {
+			score = -endScore
+		} else {
+			score, _ = scorer.Score(nonLosingBoard)
+			score = -score
+		}
+		return actions[nonLosingIdx], nonLosingBoard, score,
+			ai.OneHotEncoding(len(actions), nonLosingIdx), true
+	}
+	return
+}
+
+// SortActionsBoardsScores sorts the actions, and their boards and scores, by
+// decreasing score. Ties are broken with TIE_BREAK_FIRST.
 func SortActionsBoardsScores(actions []Action, boards []*Board, scores []float32) {
-	s := &ScoresToSort{actions, boards, scores}
+	sortActionsBoardsScores(nil, actions, boards, scores, nil)
+}
+
+// sortActionsBoardsScores is like SortActionsBoardsScores, but breaks ties with
+// the given TieBreaker. b is the board where the actions are taken.
+func sortActionsBoardsScores(b *Board, actions []Action, boards []*Board, scores []float32, tb *TieBreaker) {
+	s := &ScoresToSort{actions, boards, scores, tb.keys(b, actions)}
 	sort.Sort(s)
 }
 
@@ -105,15 +175,26 @@ type ScoresToSort struct {
 	actions []Action
 	boards  []*Board
 	scores  []float32
+
+	// keys order actions with the same score, see TieBreaker.
+	keys []int64
 }
 
 func (s *ScoresToSort) Swap(i, j int) {
 	s.actions[i], s.actions[j] = s.actions[j], s.actions[i]
 	s.boards[i], s.boards[j] = s.boards[j], s.boards[i]
 	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
 }
 func (s *ScoresToSort) Len() int           { return len(s.scores) }
-func (s *ScoresToSort) Less(i, j int) bool { return s.scores[i] > s.scores[j] }
+func (s *ScoresToSort) Less(i, j int) bool {
+	if s.scores[i] != s.scores[j] {
+		return s.scores[i] > s.scores[j]
+	}
+	// Ties are broken by the keys, so the order doesn't depend on the
+	// shuffling of Derived.Actions.
+	return s.keys[i] < s.keys[j]
+}
 
 type randomizedSearcher struct {
 	searcher   Searcher
@@ -164,7 +245,12 @@ func (rs *randomizedSearcher) Search(b *Board) (Action, *Board, float32, []float
 	}
 
 	// Select from probabilities.
-	chance := rand.Float64()
+	var chance float64
+	if rng := b.Rand(); rng != nil {
+		chance = rng.Float64()
+	} else {
+		chance = rand.Float64()
+	}
 	// log.Printf("chance=%f, scores=%v, probabilities=%v", chance, scores, probabilities)
 	for ii, value := range probabilities {
 		if chance <= value {
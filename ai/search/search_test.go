@@ -0,0 +1,77 @@
+package search_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// forcedByScan returns whether the next move of b is forced, scanning all its
+// actions as documented in ForcedAction.
+func forcedByScan(b *Board) bool {
+	if b.IsFinished() {
+		return true
+	}
+	numNonLosing := 0
+	for _, action := range b.Derived.Actions {
+		isEnd, endScore := ai.EndGameScore(b.Act(action))
+		if isEnd && endScore < 0 {
+			// Win for b.NextPlayer.
+			return true
+		}
+		if !isEnd || endScore == 0 {
+			numNonLosing++
+		}
+	}
+	return len(b.Derived.Actions) > 0 && numNonLosing <= 1
+}
+
+// randomAction returns a random action of b, preferring the ones next to a queen,
+// so the games get to surround them.
+func randomAction(b *Board, rng *rand.Rand) Action {
+	if len(b.Derived.Actions) == 0 {
+		return SKIP_ACTION
+	}
+	var nextToQueen []Action
+	for _, action := range b.Derived.Actions {
+		for player := uint8(0); player < NUM_PLAYERS; player++ {
+			if b.Available(player, QUEEN) == 0 && action.TargetPos.Distance(b.Derived.QueenPos[player]) == 1 {
+				nextToQueen = append(nextToQueen, action)
+				break
+			}
+		}
+	}
+	if len(nextToQueen) > 0 && rng.Intn(4) > 0 {
+		return nextToQueen[rng.Intn(len(nextToQueen))]
+	}
+	return b.Derived.Actions[rng.Intn(len(b.Derived.Actions))]
+}
+
+func TestForcedAction(t *testing.T) {
+	// Random games, until the queens are surrounded by 5 pieces a few times.
+	rng := rand.New(rand.NewSource(7))
+	numForced, numAlmostSurrounded := 0, 0
+	for game := 0; game < 200 && numAlmostSurrounded < 20; game++ {
+		board := NewBoard().WithSeed(int64(game))
+		for !board.IsFinished() {
+			if board.Derived.NumSurroundingQueen[0] >= 5 || board.Derived.NumSurroundingQueen[1] >= 5 {
+				numAlmostSurrounded++
+			}
+			_, _, _, _, found := ForcedAction(board, scorer)
+			if want := forcedByScan(board); found != want {
+				t.Fatalf("Move #%d of game %d: ForcedAction found=%v, wanted %v", board.MoveNumber, game, found, want)
+			}
+			if found {
+				numForced++
+			}
+			board = board.Act(randomAction(board, rng))
+		}
+	}
+	t.Logf("%d boards with a queen surrounded by 5 pieces, %d forced moves", numAlmostSurrounded, numForced)
+	if numForced == 0 {
+		t.Errorf("No forced move found in the random games")
+	}
+}
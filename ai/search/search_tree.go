@@ -0,0 +1,187 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// TreeNode is a node of the tree explored by a search, see TreeRecorder.
+type TreeNode struct {
+	// Action that leads to the node from its parent. Not set for the root.
+	Action Action
+
+	// Score of the node for the player that took Action (for the root, the
+	// score of the action chosen), as estimated by the search.
+	Score float32
+
+	// Visits is the number of MCTS traversals through the node. Always 0 for
+	// alpha-beta pruning.
+	Visits int
+
+	// Best is set if Action was the best choice of the parent's player.
+	Best bool
+
+	// Children explored, in the order they were searched. Alpha-beta pruning
+	// doesn't record the children pruned.
+	Children []*TreeNode
+}
+
+// TreeRecorder records the tree explored by the search of one move (see
+// TreeSearcher), to inspect why an action was chosen. The tree can be huge, so
+// it's limited to MaxDepth levels below the root, and MaxChildren children per
+// node: the first ones searched for alpha-beta pruning, the most visited ones
+// for MCTS.
+//
+// It is not safe for concurrent use: it should only be used with sequential
+// searches.
+type TreeRecorder struct {
+	MaxDepth, MaxChildren int
+
+	// Root of the tree recorded by the last search.
+	Root *TreeNode
+}
+
+// NewTreeRecorder creates a TreeRecorder with the given limits.
+func NewTreeRecorder(maxDepth, maxChildren int) *TreeRecorder {
+	return &TreeRecorder{MaxDepth: maxDepth, MaxChildren: maxChildren}
+}
+
+// TreeSearcher is a Searcher that can record the tree it explores.
+type TreeSearcher interface {
+	Searcher
+
+	// SearchWithTree is like Search, but also records the tree explored in rec,
+	// replacing rec.Root.
+	SearchWithTree(b *Board, rec *TreeRecorder) (action Action, board *Board, score float32, actionsLabels []float32)
+}
+
+// treeCursor is the position of a search in the tree being recorded. A nil
+// treeCursor records nothing.
+type treeCursor struct {
+	rec   *TreeRecorder
+	node  *TreeNode
+	depth int
+}
+
+// newTreeCursor starts recording a new tree in rec, if it is not nil.
+func newTreeCursor(rec *TreeRecorder) *treeCursor {
+	if rec == nil {
+		return nil
+	}
+	rec.Root = &TreeNode{}
+	return &treeCursor{rec: rec, node: rec.Root}
+}
+
+// child records a new child of the node, reached with the given action, and
+// returns its cursor. It returns nil if the child is beyond the limits.
+func (tc *treeCursor) child(action Action) *treeCursor {
+	if tc == nil || tc.depth >= tc.rec.MaxDepth || len(tc.node.Children) >= tc.rec.MaxChildren {
+		return nil
+	}
+	node := &TreeNode{Action: action}
+	tc.node.Children = append(tc.node.Children, node)
+	return &treeCursor{rec: tc.rec, node: node, depth: tc.depth + 1}
+}
+
+// setScore sets the score of the node.
+func (tc *treeCursor) setScore(score float32) {
+	if tc != nil {
+		tc.node.Score = score
+	}
+}
+
+// markBest marks the child with the given action as the best.
+func (tc *treeCursor) markBest(action Action) {
+	if tc == nil {
+		return
+	}
+	for _, child := range tc.node.Children {
+		child.Best = child.Action == action
+	}
+}
+
+// recordMCTS records the tree of cacheNodes explored by MCTS, starting at cn.
+func (tc *treeCursor) recordMCTS(cn *cacheNode, bestIdx int) {
+	if tc == nil || len(cn.actions) == 0 {
+		return
+	}
+	indices := make([]int, 0, len(cn.actions))
+	for ii := range cn.actions {
+		if cn.count[ii] > 0 {
+			indices = append(indices, ii)
+		}
+	}
+	sort.SliceStable(indices, func(i, j int) bool { return cn.count[indices[i]] > cn.count[indices[j]] })
+	for _, ii := range indices {
+		child := tc.child(cn.actions[ii])
+		if child == nil {
+			break
+		}
+		child.node.Visits = cn.count[ii]
+		child.node.Score = cn.sumMCScores[ii] / float32(cn.count[ii])
+		child.node.Best = ii == bestIdx
+		if cn.cacheNodes[ii] != nil {
+			// Inner nodes: the most visited action is the best.
+			child.recordMCTS(cn.cacheNodes[ii], mostVisited(cn.cacheNodes[ii]))
+		}
+	}
+}
+
+// mostVisited returns the index of the most visited action of cn, or -1 if none
+// was visited.
+func mostVisited(cn *cacheNode) int {
+	best := -1
+	for ii, count := range cn.count {
+		if count > 0 && (best < 0 || count > cn.count[best]) {
+			best = ii
+		}
+	}
+	return best
+}
+
+// WriteDOT writes the tree recorded as a Graphviz DOT graph, e.g. to render with
+// `dot -Tsvg`. The best choices are highlighted.
+func (rec *TreeRecorder) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString("digraph search {\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	if rec.Root != nil {
+		nextId := 0
+		var writeNode func(node *TreeNode, label string) int
+		writeNode = func(node *TreeNode, label string) int {
+			id := nextId
+			nextId++
+			if node.Visits > 0 {
+				label = fmt.Sprintf("%s\\nvisits=%d", label, node.Visits)
+			}
+			style := ""
+			if node.Best {
+				style = ", style=bold, color=blue"
+			}
+			fmt.Fprintf(&sb, "  n%d [label=\"%s\"%s];\n", id, label, style)
+			for _, child := range node.Children {
+				childId := writeNode(child, fmt.Sprintf("%s\\nscore=%.3f", dotEscape(child.Action.String()),
+					child.Score))
+				edgeStyle := ""
+				if child.Best {
+					edgeStyle = " [style=bold, color=blue]"
+				}
+				fmt.Fprintf(&sb, "  n%d -> n%d%s;\n", id, childId, edgeStyle)
+			}
+			return id
+		}
+		writeNode(rec.Root, fmt.Sprintf("root\\nscore=%.3f", rec.Root.Score))
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// dotEscape escapes the quotes and backslashes of a DOT label.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
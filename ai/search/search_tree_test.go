@@ -0,0 +1,179 @@
+package search_test
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+var (
+	dotNodeRE = regexp.MustCompile(`^  n(\d+) \[label="[^"]*"(, style=bold, color=blue)?\];$`)
+	dotEdgeRE = regexp.MustCompile(`^  n(\d+) -> n(\d+)( \[style=bold, color=blue\])?;$`)
+)
+
+// checkDOT checks that the DOT graph is well-formed: all its lines are nodes or
+// edges between nodes declared before, and it has the given number of nodes.
+func checkDOT(t *testing.T, dot string, numNodes int) {
+	lines := strings.Split(strings.TrimSuffix(dot, "\n"), "\n")
+	if len(lines) < 3 || lines[0] != "digraph search {" || lines[len(lines)-1] != "}" {
+		t.Fatalf("Malformed DOT graph:\n%s", dot)
+	}
+	nodes := make(map[string]bool)
+	for _, line := range lines[2 : len(lines)-1] {
+		if m := dotNodeRE.FindStringSubmatch(line); m != nil {
+			nodes[m[1]] = true
+		} else if m := dotEdgeRE.FindStringSubmatch(line); m != nil {
+			if !nodes[m[1]] || !nodes[m[2]] {
+				t.Errorf("Edge between undeclared nodes: %q", line)
+			}
+		} else {
+			t.Errorf("Malformed DOT line: %q", line)
+		}
+	}
+	if len(nodes) != numNodes {
+		t.Errorf("DOT graph has %d nodes, wanted %d", len(nodes), numNodes)
+	}
+}
+
+func countNodes(node *TreeNode) int {
+	count := 1
+	for _, child := range node.Children {
+		count += countNodes(child)
+	}
+	return count
+}
+
+func treeTestBoard() *Board {
+	rng := rand.New(rand.NewSource(11))
+	board := NewBoard()
+	for ii := 0; ii < 6; ii++ {
+		board = board.Act(board.Derived.Actions[rng.Intn(len(board.Derived.Actions))])
+	}
+	return board
+}
+
+func TestSearchTreeAlphaBeta(t *testing.T) {
+	const maxDepth, maxChildren = 2, 4
+	board := treeTestBoard()
+	searcher := NewAlphaBetaSearcher(3, 0, false, scorer).(TreeSearcher)
+	rec := NewTreeRecorder(maxDepth, maxChildren)
+	action, _, score, _ := searcher.SearchWithTree(board, rec)
+
+	// The tree doesn't change the search.
+	if wantAction, _, wantScore, _ := searcher.Search(board); action != wantAction || score != wantScore {
+		t.Errorf("SearchWithTree chose %s (score %g), Search chose %s (score %g)", action, score,
+			wantAction, wantScore)
+	}
+
+	root := rec.Root
+	if root == nil || len(root.Children) != maxChildren || root.Score != score {
+		t.Fatalf("Got root %+v, wanted %d children and score %g", root, maxChildren, score)
+	}
+	numBest := 0
+	for _, child := range root.Children {
+		if len(child.Children) == 0 || len(child.Children) > maxChildren {
+			t.Errorf("Child %s has %d children, wanted between 1 and %d", child.Action, len(child.Children),
+				maxChildren)
+		}
+		for _, grandChild := range child.Children {
+			if len(grandChild.Children) != 0 {
+				t.Errorf("Tree deeper than %d levels", maxDepth)
+			}
+		}
+		if child.Best {
+			numBest++
+		}
+	}
+	// The best action may be beyond the children recorded.
+	if numBest > 1 {
+		t.Errorf("Got %d best children of the root, wanted at most 1", numBest)
+	}
+
+	var sb strings.Builder
+	if err := rec.WriteDOT(&sb); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	dot := sb.String()
+	checkDOT(t, dot, countNodes(root))
+	if !strings.Contains(dot, `n0 [label="root\nscore=`) {
+		t.Errorf("DOT graph doesn't have the root:\n%s", dot)
+	}
+	for _, child := range root.Children {
+		if !strings.Contains(dot, child.Action.String()) {
+			t.Errorf("DOT graph doesn't have the child %s of the root", child.Action)
+		}
+	}
+	if !strings.Contains(dot, "n0 -> n1") {
+		t.Errorf("DOT graph doesn't have the edge to the first child:\n%s", dot)
+	}
+}
+
+// uniformPolicyScorer adds a uniform policy to the scores of scorer, as needed
+// by MCTS.
+type uniformPolicyScorer struct {
+	ai.BatchScorer
+}
+
+func (s uniformPolicyScorer) Score(b *Board) (float32, []float32) {
+	score, _ := s.BatchScorer.Score(b)
+	return score, uniformPolicy(b)
+}
+
+func (s uniformPolicyScorer) BatchScore(boards []*Board) ([]float32, [][]float32) {
+	scores, _ := s.BatchScorer.BatchScore(boards)
+	policies := make([][]float32, len(boards))
+	for ii, b := range boards {
+		policies[ii] = uniformPolicy(b)
+	}
+	return scores, policies
+}
+
+func uniformPolicy(b *Board) []float32 {
+	policy := make([]float32, b.NumActions())
+	for ii := range policy {
+		policy[ii] = 1 / float32(len(policy))
+	}
+	return policy
+}
+
+func TestSearchTreeMCTS(t *testing.T) {
+	board := treeTestBoard()
+	searcher := NewMonteCarloTreeSearcher(uniformPolicyScorer{scorer}, 4, time.Minute, 50, 10, 3, 0, 1,
+		false).(TreeSearcher)
+	rec := NewTreeRecorder(3, 5)
+	action, _, _, _ := searcher.SearchWithTree(board, rec)
+	root := rec.Root
+	if root == nil || len(root.Children) == 0 || len(root.Children) > 5 {
+		t.Fatalf("Got root %+v, wanted between 1 and 5 children", root)
+	}
+	foundBest := false
+	for ii, child := range root.Children {
+		if child.Visits == 0 || (ii > 0 && child.Visits > root.Children[ii-1].Visits) {
+			t.Errorf("Children not sorted by visits: child #%d has %d visits", ii, child.Visits)
+		}
+		if child.Best {
+			foundBest = true
+			if child.Action != action {
+				t.Errorf("Best child is %s, but %s was chosen", child.Action, action)
+			}
+		}
+	}
+	if !foundBest {
+		t.Errorf("Chosen action %s not marked as best", action)
+	}
+
+	var sb strings.Builder
+	if err := rec.WriteDOT(&sb); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	checkDOT(t, sb.String(), countNodes(root))
+	if !strings.Contains(sb.String(), `\nvisits=`) {
+		t.Errorf("DOT graph doesn't have the visits:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,252 @@
+package search
+
+import (
+	"sync"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// Tablebase holds the exact results (forced win or loss, and in how many plies)
+// of positions near the end of the game, solved by exhaustive search up to
+// MaxPlies plies. Since Hive positions can't be enumerated backwards from the
+// finished ones, the table is filled on demand, from the positions probed (see
+// Probe), and reused across searches.
+//
+// Only positions where a queen has at most (MaxPlies+1)/2 free neighbour cells
+// are solved: a player fills at most one cell around the queen per move, so the
+// others are unlikely to finish within MaxPlies plies. This bounds the cost, that
+// otherwise grows exponentially with MaxPlies.
+//
+// Draws are not solved: they depend on the history of the match (repetitions
+// and Board.MaxMoves), which is not part of the key of the table, the
+// Board.CanonicalHash.
+//
+// It is safe for concurrent use.
+type Tablebase struct {
+	// MaxPlies is the maximum number of plies (actions of either player) searched.
+	MaxPlies int
+
+	mu           sync.Mutex
+	wins, losses map[uint64]tablebaseEntry
+}
+
+// tablebaseEntry is the number of plies to the forced win (or loss) of the next
+// player of a position, if plies >= 0. Otherwise, depth is the number of plies
+// searched without finding it.
+type tablebaseEntry struct {
+	plies, depth int
+}
+
+// NewTablebase creates an empty Tablebase that searches up to maxPlies plies.
+func NewTablebase(maxPlies int) *Tablebase {
+	return &Tablebase{
+		MaxPlies: maxPlies,
+		wins:     make(map[uint64]tablebaseEntry),
+		losses:   make(map[uint64]tablebaseEntry),
+	}
+}
+
+// Len returns the number of positions searched, solved or not.
+func (tb *Tablebase) Len() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return len(tb.wins) + len(tb.losses)
+}
+
+// Candidate returns whether the position is near enough the end of the game to
+// be solved, measured by the free neighbour cells of the queens.
+func (tb *Tablebase) Candidate(b *Board) bool {
+	maxFree := uint8((tb.MaxPlies + 1) / 2)
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		if b.Available(player, QUEEN) == 0 && 6-b.Derived.NumSurroundingQueen[player] <= maxFree {
+			return true
+		}
+	}
+	return false
+}
+
+// Probe returns whether b.NextPlayer has a forced win (ai.OUTCOME_WIN) or loss
+// (ai.OUTCOME_LOSS), the number of plies until the end of the game with best
+// play from both sides, and the best action: the fastest win or the slowest
+// loss. It returns found=false if the board is not a Candidate, or if neither
+// is forced within MaxPlies plies.
+func (tb *Tablebase) Probe(b *Board) (action Action, outcome ai.Outcome, plies int, found bool) {
+	if b.IsFinished() || !tb.Candidate(b) {
+		return
+	}
+	if plies, action = tb.winIn(b, tb.MaxPlies); plies >= 0 {
+		return action, ai.OUTCOME_WIN, plies, true
+	}
+	if plies, action = tb.lossIn(b, tb.MaxPlies); plies >= 0 {
+		return action, ai.OUTCOME_LOSS, plies, true
+	}
+	return
+}
+
+// boardActions returns the actions of the board, or the skip action if there
+// are none.
+func boardActions(b *Board) []Action {
+	if len(b.Derived.Actions) == 0 {
+		return []Action{SKIP_ACTION}
+	}
+	return b.Derived.Actions
+}
+
+// lookup returns the number of plies to the forced win (or loss) of the next
+// player stored in the table, or -1 if it isn't within depth plies. It returns
+// found=false if the board wasn't searched that deep.
+func (tb *Tablebase) lookup(table map[uint64]tablebaseEntry, hash uint64, depth int) (plies int, found bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	entry, ok := table[hash]
+	switch {
+	case !ok:
+		return -1, false
+	case entry.plies >= 0:
+		if entry.plies > depth {
+			return -1, true
+		}
+		return entry.plies, true
+	}
+	return -1, entry.depth >= depth
+}
+
+// store records the result of a search up to depth plies.
+func (tb *Tablebase) store(table map[uint64]tablebaseEntry, hash uint64, plies, depth int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	table[hash] = tablebaseEntry{plies: plies, depth: depth}
+}
+
+// winIn returns the number of plies of the fastest forced win of b.NextPlayer,
+// within depth plies, and the action that starts it. It returns plies=-1 if
+// there is none.
+func (tb *Tablebase) winIn(b *Board, depth int) (plies int, action Action) {
+	if b.IsFinished() {
+		if !b.Draw() && b.Winner() == b.NextPlayer {
+			return 0, SKIP_ACTION
+		}
+		return -1, SKIP_ACTION
+	}
+	hash := b.CanonicalHash()
+	minPlies := 1
+	if plies, found := tb.lookup(tb.wins, hash, depth); found {
+		if plies < 0 {
+			return -1, SKIP_ACTION
+		}
+		// Only the action needs to be searched again: actions are not kept,
+		// since the table is shared among symmetric boards.
+		minPlies = plies
+	}
+	// Wins are searched in increasing number of plies, so the first one found
+	// is the fastest.
+	actions := boardActions(b)
+	for maxPlies := minPlies; maxPlies <= depth; maxPlies++ {
+		for _, action := range actions {
+			if maxPlies == 1 && !mayFinish(b, action) {
+				// Saves playing the action just to find out the game goes on.
+				continue
+			}
+			if lossPlies, _ := tb.lossIn(b.Act(action), maxPlies-1); lossPlies >= 0 {
+				tb.store(tb.wins, hash, lossPlies+1, depth)
+				return lossPlies + 1, action
+			}
+		}
+	}
+	tb.store(tb.wins, hash, -1, depth)
+	return -1, SKIP_ACTION
+}
+
+// lossIn returns the number of plies of the slowest forced loss of b.NextPlayer,
+// within depth plies, and the action that delays it the most. It returns
+// plies=-1 if some action avoids losing within depth plies.
+func (tb *Tablebase) lossIn(b *Board, depth int) (plies int, action Action) {
+	if b.IsFinished() {
+		if !b.Draw() && b.Winner() != b.NextPlayer {
+			return 0, SKIP_ACTION
+		}
+		return -1, SKIP_ACTION
+	}
+	if depth <= 0 {
+		return -1, SKIP_ACTION
+	}
+	hash := b.CanonicalHash()
+	if plies, found := tb.lookup(tb.losses, hash, depth); found && plies < 0 {
+		return -1, SKIP_ACTION
+	}
+	actions := boardActions(b)
+	if depth == 1 {
+		// Only if all actions finish the game (losing it).
+		for _, childAction := range actions {
+			if !mayFinish(b, childAction) {
+				tb.store(tb.losses, hash, -1, depth)
+				return -1, SKIP_ACTION
+			}
+		}
+	}
+	plies, action = -1, SKIP_ACTION
+	for _, childAction := range actions {
+		winPlies, _ := tb.winIn(b.Act(childAction), depth-1)
+		if winPlies < 0 {
+			// The opponent can't force a win after this action.
+			tb.store(tb.losses, hash, -1, depth)
+			return -1, SKIP_ACTION
+		}
+		if winPlies+1 > plies {
+			plies, action = winPlies+1, childAction
+		}
+	}
+	tb.store(tb.losses, hash, plies, depth)
+	return
+}
+
+// mayFinish returns whether the action may finish the game: only if it fills a
+// cell around a queen, moves a queen, or reaches Board.MaxMoves.
+func mayFinish(b *Board, action Action) bool {
+	if action.IsSkipAction() || action.Piece == QUEEN || b.MoveNumber >= b.MaxMoves {
+		return true
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		if b.Available(player, QUEEN) != 0 {
+			continue
+		}
+		for _, pos := range b.Derived.QueenPos[player].Neighbours() {
+			if pos == action.TargetPos {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type tablebaseSearcher struct {
+	searcher  Searcher
+	tablebase *Tablebase
+}
+
+// Search implements the Searcher interface.
+func (ts *tablebaseSearcher) Search(b *Board) (action Action, board *Board, score float32, actionsLabels []float32) {
+	action, outcome, _, found := ts.tablebase.Probe(b)
+	if !found || action.IsSkipAction() {
+		return ts.searcher.Search(b)
+	}
+	score = 10
+	if outcome == ai.OUTCOME_LOSS {
+		score = -10
+	}
+	actionIdx := b.FindAction(action)
+	return action, b.Act(action), score, ai.OneHotEncoding(b.NumActions(), actionIdx)
+}
+
+// ScoreMatch implements the Searcher interface, using the wrapped searcher.
+func (ts *tablebaseSearcher) ScoreMatch(b *Board, actions []Action, want []*Board) (
+	scores []float32, actionsLabels [][]float32) {
+	return ts.searcher.ScoreMatch(b, actions, want)
+}
+
+// NewTablebaseSearcher returns a Searcher that plays the exact results of the
+// tablebase, for the positions it solves, and otherwise uses searcher.
+func NewTablebaseSearcher(searcher Searcher, tablebase *Tablebase) Searcher {
+	return &tablebaseSearcher{searcher: searcher, tablebase: tablebase}
+}
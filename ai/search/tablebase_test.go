@@ -0,0 +1,66 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestTablebaseMateIn2(t *testing.T) {
+	// Position from a random game: player 0 moves one of its ants to (4, 0), and
+	// whatever player 1 does, the next move surrounds its queen.
+	board := buildBoard([]PieceLayout{
+		{Pos{2, -1}, 1, ANT},
+		{Pos{2, -1}, 0, BEETLE},
+		{Pos{0, 3}, 0, SPIDER},
+		{Pos{1, 2}, 0, GRASSHOPPER},
+		{Pos{1, 2}, 0, BEETLE},
+		{Pos{-1, 3}, 0, SPIDER},
+		{Pos{0, 1}, 0, ANT},
+		{Pos{1, -3}, 1, GRASSHOPPER},
+		{Pos{6, -2}, 0, GRASSHOPPER},
+		{Pos{2, 0}, 1, SPIDER},
+		{Pos{4, -1}, 1, SPIDER},
+		{Pos{0, 2}, 0, QUEEN},
+		{Pos{5, -2}, 1, BEETLE},
+		{Pos{2, -2}, 1, GRASSHOPPER},
+		{Pos{1, 0}, 1, ANT},
+		{Pos{3, -1}, 1, QUEEN},
+		{Pos{-1, 2}, 0, ANT},
+		{Pos{-1, 1}, 0, ANT},
+		{Pos{3, 0}, 1, GRASSHOPPER},
+		{Pos{3, 0}, 1, BEETLE},
+		{Pos{3, -3}, 1, ANT},
+		{Pos{2, 2}, 0, GRASSHOPPER},
+	})
+	board.NextPlayer = 0
+	board.BuildDerived()
+
+	tb := NewTablebase(3)
+	if !tb.Candidate(board) {
+		t.Fatalf("Board should be a candidate for the tablebase")
+	}
+	action, outcome, plies, found := tb.Probe(board)
+	// Either of the ants at (-1, 1) and (-1, 2) works.
+	wantTarget := Pos{4, 0}
+	if !found || outcome != ai.OUTCOME_WIN || plies != 3 || !action.Move || action.Piece != ANT ||
+		action.TargetPos != wantTarget {
+		printBoard(board)
+		t.Fatalf("Probe()=(%s, %v, %d, %v), wanted (ant to %v, %v, 3, true)", action, outcome, plies, found,
+			wantTarget, ai.OUTCOME_WIN)
+	}
+
+	// For the defender, any action loses in 2 plies.
+	defender := board.Act(action)
+	if _, outcome, plies, found = tb.Probe(defender); !found || outcome != ai.OUTCOME_LOSS || plies != 2 {
+		t.Errorf("Probe() for the defender=(%v, %d, %v), wanted (%v, 2, true)", outcome, plies, found,
+			ai.OUTCOME_LOSS)
+	}
+
+	// There is no mate in 1.
+	if _, _, _, found = NewTablebase(1).Probe(board); found {
+		t.Errorf("Tablebase with 1 ply found a result, but mate is in 3 plies")
+	}
+}
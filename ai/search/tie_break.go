@@ -0,0 +1,109 @@
+package search
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// TieBreak is the policy to order actions with the same score: since searchers
+// take the first best action, it selects among tied actions.
+type TieBreak uint8
+
+const (
+	// TIE_BREAK_FIRST orders tied actions by their encoding (Action.Encode), so
+	// always the same one is taken.
+	TIE_BREAK_FIRST TieBreak = iota
+
+	// TIE_BREAK_RANDOM orders tied actions randomly, from a seeded random source.
+	TIE_BREAK_RANDOM
+
+	// TIE_BREAK_PREFER_DEVELOPMENT favours placing new pieces, and then moving
+	// pieces closer to the opponent's queen.
+	TIE_BREAK_PREFER_DEVELOPMENT
+)
+
+var tieBreakNames = []string{"first", "random", "prefer_development"}
+
+func (tb TieBreak) String() string {
+	if int(tb) < len(tieBreakNames) {
+		return tieBreakNames[tb]
+	}
+	return fmt.Sprintf("TieBreak(%d)", tb)
+}
+
+// ParseTieBreak parses the name of a TieBreak policy: "first", "random" or
+// "prefer_development".
+func ParseTieBreak(name string) (TieBreak, error) {
+	for ii, tbName := range tieBreakNames {
+		if name == tbName {
+			return TieBreak(ii), nil
+		}
+	}
+	return TIE_BREAK_FIRST, fmt.Errorf("Unknown tie-break policy %q, valid values are %v", name, tieBreakNames)
+}
+
+// TieBreaker orders actions with the same score, following its policy. It is
+// safe for concurrent use. A nil TieBreaker uses TIE_BREAK_FIRST.
+type TieBreaker struct {
+	Policy TieBreak
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewTieBreaker creates a TieBreaker with the given policy. seed is only used by
+// TIE_BREAK_RANDOM: with the same seed the same sequence of searches takes the
+// same actions.
+func NewTieBreaker(policy TieBreak, seed int64) *TieBreaker {
+	return &TieBreaker{Policy: policy, rng: rand.New(rand.NewSource(seed))}
+}
+
+// keys returns the keys to order the actions of b with the same score: lower
+// keys first.
+func (tb *TieBreaker) keys(b *Board, actions []Action) []int64 {
+	keys := make([]int64, len(actions))
+	policy := TIE_BREAK_FIRST
+	if tb != nil {
+		policy = tb.Policy
+	}
+	switch policy {
+	case TIE_BREAK_RANDOM:
+		// Keys are a hash of the actions with a random salt, so they don't depend
+		// on the order of the actions (shuffled by BuildDerived).
+		tb.mu.Lock()
+		salt := uint64(tb.rng.Int63())
+		tb.mu.Unlock()
+		for ii, action := range actions {
+			keys[ii] = int64(mix64(salt^uint64(action.Encode())) >> 1)
+		}
+	case TIE_BREAK_PREFER_DEVELOPMENT:
+		opponent := b.OpponentPlayer()
+		opponentQueen, hasQueen := b.Derived.QueenPos[opponent], b.Available(opponent, QUEEN) == 0
+		for ii, action := range actions {
+			development := int64(0)
+			if action.Move {
+				development = 1
+				if hasQueen {
+					development += int64(action.TargetPos.Distance(opponentQueen))
+				}
+			}
+			keys[ii] = development<<32 | int64(action.Encode())
+		}
+	default:
+		for ii, action := range actions {
+			keys[ii] = int64(action.Encode())
+		}
+	}
+	return keys
+}
+
+// mix64 is the SplitMix64 finalizer, a hash of x.
+func mix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,106 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// constantScorer scores every board with 0, so all actions are tied.
+type constantScorer struct{}
+
+func (constantScorer) Score(b *Board) (float32, []float32) { return 0, nil }
+func (constantScorer) Version() int                        { return 0 }
+
+func tieBreakTestBoard() *Board {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+	})
+	board.BuildDerived()
+	return board
+}
+
+func TestTieBreak(t *testing.T) {
+	tied := ai.BatchScorerWrapper{Scorer: constantScorer{}}
+	board := tieBreakTestBoard()
+
+	// "first" is the same as without a TieBreaker: the action with the lowest encoding.
+	want := board.Derived.Actions[0]
+	for _, action := range board.Derived.Actions {
+		if action.Encode() < want.Encode() {
+			want = action
+		}
+	}
+	first, _, _, _ := NewAlphaBetaSearcher(1, 0, false, tied).Search(board)
+	firstTB, _, _, _ := NewAlphaBetaSearcherWithTieBreak(1, 0, false, tied,
+		NewTieBreaker(TIE_BREAK_FIRST, 0)).Search(board)
+	if first != want || firstTB != want {
+		t.Errorf("Tie-break \"first\" chose %s, and no tie-break %s, wanted %s", firstTB, first, want)
+	}
+
+	// "random" with a fixed seed: the same sequence of choices, and not always the same.
+	choices := func(seed int64) (actions []Action) {
+		searcher := NewAlphaBetaSearcherWithTieBreak(1, 0, false, tied, NewTieBreaker(TIE_BREAK_RANDOM, seed))
+		for ii := 0; ii < 10; ii++ {
+			// Building the board again reshuffles its actions.
+			action, _, _, _ := searcher.Search(tieBreakTestBoard())
+			actions = append(actions, action)
+		}
+		return
+	}
+	choices1, choices2 := choices(42), choices(42)
+	distinct := make(map[Action]bool)
+	for ii := range choices1 {
+		if choices1[ii] != choices2[ii] {
+			t.Errorf("Tie-break \"random\" with the same seed chose %s and %s in search #%d",
+				choices1[ii], choices2[ii], ii)
+		}
+		distinct[choices1[ii]] = true
+	}
+	if len(distinct) < 2 {
+		t.Errorf("Tie-break \"random\" always chose %s", choices1[0])
+	}
+
+	// "prefer_development" places a new piece.
+	action, _, _, _ := NewAlphaBetaSearcherWithTieBreak(1, 0, false, tied,
+		NewTieBreaker(TIE_BREAK_PREFER_DEVELOPMENT, 0)).Search(board)
+	if action.Move {
+		t.Errorf("Tie-break \"prefer_development\" chose move %s instead of a placement", action)
+	}
+
+	for _, name := range []string{"first", "random", "prefer_development"} {
+		if tb, err := ParseTieBreak(name); err != nil || tb.String() != name {
+			t.Errorf("ParseTieBreak(%q) returned %s, %v", name, tb, err)
+		}
+	}
+	if _, err := ParseTieBreak("last"); err == nil {
+		t.Errorf("ParseTieBreak accepted an unknown policy")
+	}
+}
+
+func TestTieBreakNearRecenterLimit(t *testing.T) {
+	// The hive is not recentered yet, and placements target x=RECENTER_LIMIT+1.
+	board := buildBoard([]PieceLayout{
+		{Pos{RECENTER_LIMIT - 2, 0}, 0, QUEEN},
+		{Pos{RECENTER_LIMIT - 1, 0}, 1, QUEEN},
+		{Pos{RECENTER_LIMIT, 0}, 0, ANT},
+	})
+	board.NextPlayer, board.MoveNumber = 1, 4
+	board.BuildDerived()
+	if board.Translation != (Pos{}) {
+		t.Fatalf("Board shouldn't be recentered, got translation %s", board.Translation)
+	}
+	tied := ai.BatchScorerWrapper{Scorer: constantScorer{}}
+	for _, policy := range []TieBreak{TIE_BREAK_FIRST, TIE_BREAK_RANDOM, TIE_BREAK_PREFER_DEVELOPMENT} {
+		action, newBoard, _, _ := NewAlphaBetaSearcherWithTieBreak(2, 0, false, tied,
+			NewTieBreaker(policy, 0)).Search(board)
+		if newBoard == nil || !board.IsValid(action) {
+			t.Errorf("Tie-break %s: invalid action %s", policy, action)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package serving
+
+// Messages of the Predict method of TensorFlow Serving's PredictionService
+// (tensorflow_serving/apis/predict.proto), with the few fields used here. They
+// are encoded in the protobuf wire format with protowire, so this package doesn't
+// depend on the generated TensorFlow and TensorFlow Serving protos.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// PREDICT_METHOD is the full name of the Predict method of TensorFlow Serving.
+const PREDICT_METHOD = "/tensorflow.serving.PredictionService/Predict"
+
+// dataType values of tensorflow.DataType (tensorflow/core/framework/types.proto).
+type dataType int32
+
+const (
+	DT_FLOAT dataType = 1
+	DT_INT64 dataType = 9
+)
+
+// tensorProto is a tensorflow.TensorProto (tensorflow/core/framework/tensor.proto)
+// of floats or int64s.
+type tensorProto struct {
+	dtype    dataType
+	shape    []int64
+	floatVal []float32
+	int64Val []int64
+}
+
+// predictRequest is a tensorflow.serving.PredictRequest.
+type predictRequest struct {
+	modelName, signatureName string
+	inputs                   map[string]*tensorProto
+	outputFilter             []string
+}
+
+// predictResponse is a tensorflow.serving.PredictResponse.
+type predictResponse struct {
+	outputs map[string]*tensorProto
+}
+
+// wireMessage is a message encoded by predictCodec.
+type wireMessage interface {
+	marshalWire() []byte
+	unmarshalWire(data []byte) error
+}
+
+// predictCodec is the gRPC codec of the messages of the Predict method.
+type predictCodec struct{}
+
+func (predictCodec) Name() string { return "proto" }
+
+func (predictCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a message of the Predict method", v)
+	}
+	return m.marshalWire(), nil
+}
+
+func (predictCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("%T is not a message of the Predict method", v)
+	}
+	return m.unmarshalWire(data)
+}
+
+// Encoding of the fields.
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// appendTensors appends the map<string, TensorProto> field.
+func appendTensors(b []byte, num protowire.Number, tensors map[string]*tensorProto) []byte {
+	for name, tensor := range tensors {
+		entry := appendString(nil, 1, name)
+		entry = appendMessage(entry, 2, tensor.marshalWire())
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
+
+// Decoding of the fields.
+
+// consumeFields calls field for each field of the message, with the encoded value.
+func consumeFields(data []byte, field func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := field(num, typ, data[:n]); err != nil {
+			return fmt.Errorf("field %d: %v", num, err)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func bytesValue(typ protowire.Type, value []byte) ([]byte, error) {
+	if typ != protowire.BytesType {
+		return nil, fmt.Errorf("wire type %d is not length delimited", typ)
+	}
+	v, _ := protowire.ConsumeBytes(value)
+	return v, nil
+}
+
+func intValue(typ protowire.Type, value []byte) (int64, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("wire type %d is not an integer", typ)
+	}
+	v, _ := protowire.ConsumeVarint(value)
+	return int64(v), nil
+}
+
+// appendIntsValue appends the integers of a repeated field, packed or not.
+func appendIntsValue(values []int64, typ protowire.Type, value []byte) ([]int64, error) {
+	if typ == protowire.VarintType {
+		v, _ := protowire.ConsumeVarint(value)
+		return append(values, int64(v)), nil
+	}
+	packed, err := bytesValue(typ, value)
+	if err != nil {
+		return nil, err
+	}
+	for len(packed) > 0 {
+		v, n := protowire.ConsumeVarint(packed)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, int64(v))
+		packed = packed[n:]
+	}
+	return values, nil
+}
+
+// appendFloatsValue appends the floats of a repeated field, packed or not.
+func appendFloatsValue(values []float32, typ protowire.Type, value []byte) ([]float32, error) {
+	if typ == protowire.Fixed32Type {
+		v, _ := protowire.ConsumeFixed32(value)
+		return append(values, math.Float32frombits(v)), nil
+	}
+	packed, err := bytesValue(typ, value)
+	if err != nil {
+		return nil, err
+	}
+	return appendFloatsContent(values, packed)
+}
+
+// appendFloatsContent appends the little-endian floats in content.
+func appendFloatsContent(values []float32, content []byte) ([]float32, error) {
+	if len(content)%4 != 0 {
+		return nil, fmt.Errorf("%d bytes of floats", len(content))
+	}
+	for ; len(content) > 0; content = content[4:] {
+		values = append(values, math.Float32frombits(binary.LittleEndian.Uint32(content)))
+	}
+	return values, nil
+}
+
+// consumeTensors decodes an entry of a map<string, TensorProto> field into tensors.
+func consumeTensors(tensors map[string]*tensorProto, typ protowire.Type, value []byte) error {
+	entry, err := bytesValue(typ, value)
+	if err != nil {
+		return err
+	}
+	var name string
+	tensor := &tensorProto{}
+	err = consumeFields(entry, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch num {
+		case 1:
+			v, err := bytesValue(typ, value)
+			name = string(v)
+			return err
+		case 2:
+			v, err := bytesValue(typ, value)
+			if err != nil {
+				return err
+			}
+			return tensor.unmarshalWire(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tensors[name] = tensor
+	return nil
+}
+
+// Messages.
+
+// size returns the number of elements of the tensor, given by its shape.
+func (t *tensorProto) size() int64 {
+	size := int64(1)
+	for _, dim := range t.shape {
+		size *= dim
+	}
+	return size
+}
+
+func (t *tensorProto) marshalWire() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.dtype))
+	var shape []byte
+	for _, dim := range t.shape {
+		var d []byte
+		if dim != 0 {
+			d = protowire.AppendTag(d, 1, protowire.VarintType)
+			d = protowire.AppendVarint(d, uint64(dim))
+		}
+		shape = appendMessage(shape, 2, d)
+	}
+	b = appendMessage(b, 2, shape)
+	if len(t.floatVal) > 0 {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(4*len(t.floatVal)))
+		for _, v := range t.floatVal {
+			b = protowire.AppendFixed32(b, math.Float32bits(v))
+		}
+	}
+	if len(t.int64Val) > 0 {
+		var packed []byte
+		for _, v := range t.int64Val {
+			packed = protowire.AppendVarint(packed, uint64(v))
+		}
+		b = appendMessage(b, 10, packed)
+	}
+	return b
+}
+
+func (t *tensorProto) unmarshalWire(data []byte) error {
+	*t = tensorProto{}
+	var content []byte
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) (err error) {
+		switch num {
+		case 1:
+			var v int64
+			v, err = intValue(typ, value)
+			t.dtype = dataType(v)
+		case 2:
+			var shape []byte
+			if shape, err = bytesValue(typ, value); err == nil {
+				err = consumeFields(shape, func(num protowire.Number, typ protowire.Type, value []byte) error {
+					if num != 2 {
+						return nil
+					}
+					d, err := bytesValue(typ, value)
+					if err != nil {
+						return err
+					}
+					var size int64
+					err = consumeFields(d, func(num protowire.Number, typ protowire.Type, value []byte) (err error) {
+						if num == 1 {
+							size, err = intValue(typ, value)
+						}
+						return
+					})
+					t.shape = append(t.shape, size)
+					return err
+				})
+			}
+		case 4:
+			content, err = bytesValue(typ, value)
+		case 5:
+			t.floatVal, err = appendFloatsValue(t.floatVal, typ, value)
+		case 10:
+			t.int64Val, err = appendIntsValue(t.int64Val, typ, value)
+		}
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid TensorProto: %v", err)
+	}
+	if content != nil {
+		if t.dtype != DT_FLOAT {
+			return fmt.Errorf("Invalid TensorProto: tensor_content of type %d not supported", t.dtype)
+		}
+		if t.floatVal, err = appendFloatsContent(t.floatVal, content); err != nil {
+			return fmt.Errorf("Invalid TensorProto: %v", err)
+		}
+	}
+	return nil
+}
+
+func (req *predictRequest) marshalWire() []byte {
+	spec := appendString(nil, 1, req.modelName)
+	spec = appendString(spec, 3, req.signatureName)
+	b := appendMessage(nil, 1, spec)
+	b = appendTensors(b, 2, req.inputs)
+	for _, output := range req.outputFilter {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, output)
+	}
+	return b
+}
+
+func (req *predictRequest) unmarshalWire(data []byte) error {
+	*req = predictRequest{inputs: make(map[string]*tensorProto)}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch num {
+		case 1:
+			spec, err := bytesValue(typ, value)
+			if err != nil {
+				return err
+			}
+			return consumeFields(spec, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				v, err := bytesValue(typ, value)
+				if num == 1 {
+					req.modelName = string(v)
+				} else if num == 3 {
+					req.signatureName = string(v)
+				} else {
+					return nil
+				}
+				return err
+			})
+		case 2:
+			return consumeTensors(req.inputs, typ, value)
+		case 3:
+			v, err := bytesValue(typ, value)
+			req.outputFilter = append(req.outputFilter, string(v))
+			return err
+		}
+		return nil
+	})
+}
+
+func (resp *predictResponse) marshalWire() []byte {
+	return appendTensors(nil, 1, resp.outputs)
+}
+
+func (resp *predictResponse) unmarshalWire(data []byte) error {
+	*resp = predictResponse{outputs: make(map[string]*tensorProto)}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num == 1 {
+			return consumeTensors(resp.outputs, typ, value)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,223 @@
+// Package serving implements a scorer that evaluates the boards with a model served
+// by TensorFlow Serving, so the engine doesn't need the TensorFlow C library.
+//
+// It calls the gRPC Predict method of TensorFlow Serving. The model's serving
+// signature must use the names of the tensors of the graph (see ai/tensorflow)
+// as the names of its inputs and outputs.
+//
+// Importing this package registers the "serving=host:port/model" AI player
+// parameter, where host:port is the gRPC address of TensorFlow Serving.
+// Optionally "serving_version" sets the version of the features (the number of
+// board features) used by the model, it defaults to ai.AllFeaturesDim.
+package serving
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// REQUEST_TIMEOUT is the timeout of each Predict request.
+const REQUEST_TIMEOUT = 30 * time.Second
+
+// ServingScorer implements ai.BatchScorer by calling the Predict method of a
+// TensorFlow Serving endpoint. It is safe for concurrent use.
+type ServingScorer struct {
+	// Address is the gRPC address of TensorFlow Serving, e.g. "localhost:8500".
+	Address string
+
+	// Model is the name of the model served.
+	Model string
+
+	// Conn is the connection to TensorFlow Serving.
+	Conn *grpc.ClientConn
+
+	// ActionFeaturesCache is optional, see tensorflow.Scorer.ActionFeaturesCache.
+	ActionFeaturesCache *ai.ActionFeaturesCache
+
+	version int
+}
+
+// New creates a ServingScorer for the model served in address ("host:port/model"),
+// that uses the given version of the features. The connection is established
+// lazily, so New doesn't fail if TensorFlow Serving is not reachable.
+func New(address string, version int) (*ServingScorer, error) {
+	parts := strings.SplitN(address, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid TensorFlow Serving address %q, it should be host:port/model", address)
+	}
+	if version <= 0 {
+		return nil, fmt.Errorf("Invalid features version %d", version)
+	}
+	conn, err := grpc.Dial(parts[0], grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to TensorFlow Serving in %s: %v", parts[0], err)
+	}
+	return &ServingScorer{
+		Address: parts[0],
+		Model:   parts[1],
+		Conn:    conn,
+		version: version,
+	}, nil
+}
+
+// Close closes the connection to TensorFlow Serving.
+func (s *ServingScorer) Close() error {
+	return s.Conn.Close()
+}
+
+// String identifies the model served.
+func (s *ServingScorer) String() string {
+	return fmt.Sprintf("TensorFlow Serving model %q in %s", s.Model, s.Address)
+}
+
+// Version implements ai.Scorer.
+func (s *ServingScorer) Version() int { return s.version }
+
+// Score implements ai.Scorer.
+func (s *ServingScorer) Score(b *Board) (score float32, actionProbs []float32) {
+	scores, actionProbsBatch := s.BatchScore([]*Board{b})
+	return scores[0], actionProbsBatch[0]
+}
+
+// BatchScore implements ai.BatchScorer. It panics if the request fails.
+func (s *ServingScorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32) {
+	scores, actionProbsBatch, err := s.Predict(boards)
+	if err != nil {
+		log.Panicf("%s: %v", s, err)
+	}
+	return
+}
+
+// Predict is like BatchScore, but returns an error if the request fails.
+func (s *ServingScorer) Predict(boards []*Board) (scores []float32, actionProbsBatch [][]float32, err error) {
+	if len(boards) == 0 {
+		return nil, nil, fmt.Errorf("Received empty list of boards to score")
+	}
+	req := &predictRequest{
+		modelName:    s.Model,
+		inputs:       s.inputs(boards),
+		outputFilter: []string{"board_predictions", "actions_predictions"},
+	}
+	var resp predictResponse
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if err = s.Conn.Invoke(ctx, PREDICT_METHOD, req, &resp, grpc.ForceCodec(predictCodec{})); err != nil {
+		return nil, nil, fmt.Errorf("Failed Predict request: %v", err)
+	}
+
+	boardPredictions, actionsPredictions := resp.outputs["board_predictions"], resp.outputs["actions_predictions"]
+	if boardPredictions == nil || actionsPredictions == nil {
+		return nil, nil, fmt.Errorf("Predict response is missing board_predictions or actions_predictions")
+	}
+	scores = boardPredictions.floatVal
+	if len(scores) != len(boards) {
+		return nil, nil, fmt.Errorf("Expected %d scores (=number of boards given), got %d", len(boards), len(scores))
+	}
+	totalNumActions := 0
+	for _, board := range boards {
+		totalNumActions += board.NumActions()
+	}
+	allActionsProbs := actionsPredictions.floatVal
+	if totalNumActions > 0 && len(allActionsProbs) != totalNumActions {
+		return nil, nil, fmt.Errorf("Total probabilities returned was %d, wanted %d",
+			len(allActionsProbs), totalNumActions)
+	}
+	actionProbsBatch = make([][]float32, len(boards))
+	for ii, board := range boards {
+		if numActions := board.NumActions(); numActions > 0 {
+			actionProbsBatch[ii] = allActionsProbs[:numActions]
+			allActionsProbs = allActionsProbs[numActions:]
+		}
+	}
+	return
+}
+
+// inputs returns the features of the boards, keyed by the names of the input
+// tensors of the model.
+func (s *ServingScorer) inputs(boards []*Board) map[string]*tensorProto {
+	numBoards, numActions := int64(len(boards)), int64(0)
+	contextDim := int64(ai.ActionContextDim(s.version))
+	centerDim := int64(ai.FEATURES_PER_POSITION)
+	sectionDim := int64(ai.POSITIONS_PER_SECTION * ai.FEATURES_PER_POSITION)
+	var boardFeatures, actionsFeatures, actionsSourceCenter, actionsSourceNeighbourhood,
+		actionsTargetCenter, actionsTargetNeighbourhood []float32
+	actionsBoardIndices := []int64{}
+	for boardIdx, board := range boards {
+		boardFeatures = append(boardFeatures, ai.FeatureVector(board, s.version)...)
+		for _, af := range s.ActionFeaturesCache.BoardActionsFeatures(board, s.version) {
+			numActions++
+			actionsBoardIndices = append(actionsBoardIndices, int64(boardIdx))
+			actionsFeatures = append(actionsFeatures, af.Context(s.version)...)
+			actionsSourceCenter = append(actionsSourceCenter, af.SourceFeatures.Center...)
+			actionsTargetCenter = append(actionsTargetCenter, af.TargetFeatures.Center...)
+			for section := 0; section < 6; section++ {
+				actionsSourceNeighbourhood = append(actionsSourceNeighbourhood, af.SourceFeatures.Sections[section]...)
+				actionsTargetNeighbourhood = append(actionsTargetNeighbourhood, af.TargetFeatures.Sections[section]...)
+			}
+		}
+	}
+	floats := func(values []float32, shape ...int64) *tensorProto {
+		return &tensorProto{dtype: DT_FLOAT, shape: shape, floatVal: values}
+	}
+	return map[string]*tensorProto{
+		"board_features":               floats(boardFeatures, numBoards, int64(s.version)),
+		"actions_board_indices":        {dtype: DT_INT64, shape: []int64{numActions}, int64Val: actionsBoardIndices},
+		"actions_features":             floats(actionsFeatures, numActions, contextDim),
+		"actions_source_center":        floats(actionsSourceCenter, numActions, centerDim),
+		"actions_source_neighbourhood": floats(actionsSourceNeighbourhood, numActions, 6, sectionDim),
+		"actions_target_center":        floats(actionsTargetCenter, numActions, centerDim),
+		"actions_target_neighbourhood": floats(actionsTargetNeighbourhood, numActions, 6, sectionDim),
+	}
+}
+
+// Data used for parsing of player options.
+type ParsingData struct {
+	Address string
+	Version int
+}
+
+func NewParsingData() (data interface{}) {
+	return &ParsingData{Version: ai.AllFeaturesDim}
+}
+
+func ParseParam(data interface{}, key, value string) {
+	d := data.(*ParsingData)
+	if key == "serving" {
+		d.Address = value
+	} else if key == "serving_version" {
+		var err error
+		d.Version, err = strconv.Atoi(value)
+		if err != nil {
+			log.Panicf("Invalid parameter serving_version=%s: %v", value, err)
+		}
+	} else {
+		log.Panicf("Unknown parameter '%s=%s' passed to serving module.", key, value)
+	}
+}
+
+func FinalizeParsing(data interface{}, player *players.SearcherScorerPlayer) {
+	d := data.(*ParsingData)
+	if d.Address == "" {
+		return
+	}
+	s, err := New(d.Address, d.Version)
+	if err != nil {
+		log.Panicf("Invalid parameter serving=%s: %v", d.Address, err)
+	}
+	player.Scorer = s
+}
+
+func init() {
+	players.RegisterPlayerParameter("serving", "serving", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("serving", "serving_version", NewParsingData, ParseParam, FinalizeParsing)
+}
@@ -0,0 +1,156 @@
+package serving
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakePredictionService is a fake TensorFlow Serving PredictionService for model
+// "hive", that predicts for each board its index, and for each action its index
+// within the board.
+type fakePredictionService struct {
+	t *testing.T
+}
+
+func (f *fakePredictionService) predict(req *predictRequest) (*predictResponse, error) {
+	if req.modelName != "hive" {
+		return nil, fmt.Errorf("Servable not found for request: %s", req.modelName)
+	}
+	boardFeatures, actionsBoardIndices := req.inputs["board_features"], req.inputs["actions_board_indices"]
+	if boardFeatures.dtype != DT_FLOAT || len(boardFeatures.shape) != 2 ||
+		boardFeatures.shape[1] != int64(ai.AllFeaturesDim) || int64(len(boardFeatures.floatVal)) != boardFeatures.size() {
+		f.t.Errorf("Got board_features of type %d, shape %v and %d values, wanted %d features per board",
+			boardFeatures.dtype, boardFeatures.shape, len(boardFeatures.floatVal), ai.AllFeaturesDim)
+	}
+	for name, tensor := range req.inputs {
+		if tensor.shape[0] != int64(len(actionsBoardIndices.int64Val)) && name != "board_features" {
+			f.t.Errorf("Input %s has shape %v, wanted %d actions", name, tensor.shape, len(actionsBoardIndices.int64Val))
+		}
+	}
+	boardPredictions := []float32{}
+	for ii := int64(0); ii < boardFeatures.shape[0]; ii++ {
+		boardPredictions = append(boardPredictions, float32(ii))
+	}
+	actionsPredictions := []float32{}
+	for ii, boardIdx := range actionsBoardIndices.int64Val {
+		if ii == 0 || boardIdx != actionsBoardIndices.int64Val[ii-1] {
+			actionsPredictions = append(actionsPredictions, 0)
+		} else {
+			actionsPredictions = append(actionsPredictions, actionsPredictions[ii-1]+1)
+		}
+	}
+	return &predictResponse{outputs: map[string]*tensorProto{
+		"board_predictions":   {dtype: DT_FLOAT, shape: []int64{int64(len(boardPredictions))}, floatVal: boardPredictions},
+		"actions_predictions": {dtype: DT_FLOAT, shape: []int64{int64(len(actionsPredictions))}, floatVal: actionsPredictions},
+	}}, nil
+}
+
+// fakeServing starts a gRPC server with a fakePredictionService, and returns its
+// address.
+func fakeServing(t *testing.T) (server *grpc.Server, address string) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server = grpc.NewServer(grpc.ForceServerCodec(predictCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "tensorflow.serving.PredictionService",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Predict",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &predictRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(*fakePredictionService).predict(req)
+			},
+		}},
+	}, &fakePredictionService{t})
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func TestServingScorer(t *testing.T) {
+	server, address := fakeServing(t)
+	defer server.Stop()
+
+	s, err := New(address+"/hive", ai.AllFeaturesDim)
+	if err != nil {
+		t.Fatalf("Failed to create ServingScorer: %v", err)
+	}
+	board := NewBoard()
+	next := board.Act(board.Derived.Actions[0])
+	scores, actionProbsBatch := s.BatchScore([]*Board{board, next})
+	if !reflect.DeepEqual(scores, []float32{0, 1}) {
+		t.Errorf("Got scores %v, wanted [0 1]", scores)
+	}
+	for ii, b := range []*Board{board, next} {
+		if len(actionProbsBatch[ii]) != b.NumActions() {
+			t.Fatalf("Got %d probabilities for board %d, wanted %d", len(actionProbsBatch[ii]), ii, b.NumActions())
+		}
+		for jj, prob := range actionProbsBatch[ii] {
+			if prob != float32(jj) {
+				t.Errorf("Board %d action %d: got probability %g, wanted %d", ii, jj, prob, jj)
+			}
+		}
+	}
+
+	// Errors are returned by Predict.
+	s.Close()
+	s, _ = New(address+"/unknown", ai.AllFeaturesDim)
+	defer s.Close()
+	if _, _, err = s.Predict([]*Board{board}); err == nil {
+		t.Errorf("Expected error for unknown model")
+	}
+	if _, err = New("no_model", ai.AllFeaturesDim); err == nil {
+		t.Errorf("Expected error for address without model")
+	}
+
+	// Player configuration.
+	player := players.NewAIPlayer(fmt.Sprintf("ab,max_depth=1,serving=%s/hive", address), false)
+	if _, ok := player.Scorer.(*ServingScorer); !ok {
+		t.Errorf("Expected player to use a ServingScorer, got %T", player.Scorer)
+	}
+}
+
+func TestPredictWire(t *testing.T) {
+	req := &predictRequest{
+		modelName: "hive",
+		inputs: map[string]*tensorProto{
+			"floats": {dtype: DT_FLOAT, shape: []int64{2, 0, 3}, floatVal: []float32{}},
+			"ints":   {dtype: DT_INT64, shape: []int64{3}, int64Val: []int64{0, 5, 1 << 40}},
+		},
+		outputFilter: []string{"a", "b"},
+	}
+	got := &predictRequest{}
+	if err := got.unmarshalWire(req.marshalWire()); err != nil {
+		t.Fatalf("Failed to unmarshal PredictRequest: %v", err)
+	}
+	req.inputs["floats"].floatVal = nil
+	if !reflect.DeepEqual(got, req) {
+		t.Errorf("Got %+v after the round trip, wanted %+v", got, req)
+	}
+
+	// TensorFlow Serving may return the values in tensor_content.
+	tensor := &tensorProto{dtype: DT_FLOAT, shape: []int64{2}}
+	data := tensor.marshalWire()
+	data = protowire.AppendTag(data, 4, protowire.BytesType)
+	data = protowire.AppendBytes(data, []byte{0, 0, 0x80, 0x3f, 0, 0, 0, 0xc0})
+	if err := tensor.unmarshalWire(data); err != nil {
+		t.Fatalf("Failed to unmarshal TensorProto: %v", err)
+	}
+	if !reflect.DeepEqual(tensor.floatVal, []float32{1, -2}) {
+		t.Errorf("Got values %v from tensor_content, wanted [1 -2]", tensor.floatVal)
+	}
+}
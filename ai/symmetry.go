@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// SymmetryTolerance is the maximum absolute difference of scores (and of action
+// probabilities) accepted by CheckSymmetryInvariance.
+var SymmetryTolerance = float32(1e-4)
+
+// CheckSymmetryInvariance scores each board and its symmetric transforms (each of
+// the rotations, optionally mirrored), and returns an error listing all deviations
+// of the board score, or of the probability of the corresponding actions, larger
+// than SymmetryTolerance.
+//
+// It works both as a check on the board transforms and as a diagnostic of how well a
+// model learned the symmetries of the game.
+func CheckSymmetryInvariance(scorer Scorer, boards []*Board) error {
+	var deviations []string
+	for boardIdx, b := range boards {
+		score, actionProbs := scorer.Score(b)
+		for steps := 0; steps < NUM_ROTATIONS; steps++ {
+			for _, mirror := range []bool{false, true} {
+				if steps == 0 && !mirror {
+					continue
+				}
+				transformed := b.Rotate(steps)
+				if mirror {
+					transformed = transformed.Mirror()
+				}
+				name := fmt.Sprintf("board #%d (move %d) rotated %d, mirrored=%v",
+					boardIdx, b.MoveNumber, steps, mirror)
+				tScore, tActionProbs := scorer.Score(transformed)
+				if diff := math.Abs(float64(tScore - score)); diff > float64(SymmetryTolerance) {
+					deviations = append(deviations, fmt.Sprintf(
+						"%s: score %g, original score %g", name, tScore, score))
+				}
+				if len(tActionProbs) != len(actionProbs) {
+					deviations = append(deviations, fmt.Sprintf(
+						"%s: %d action probabilities, original had %d", name, len(tActionProbs), len(actionProbs)))
+					continue
+				}
+				if len(actionProbs) == 0 {
+					continue
+				}
+				for ii, action := range b.Derived.Actions {
+					tAction := action.Rotate(steps)
+					if mirror {
+						tAction = tAction.Mirror()
+					}
+					jj := findAction(transformed.Derived.Actions, tAction)
+					if jj < 0 {
+						deviations = append(deviations, fmt.Sprintf(
+							"%s: transformed action %s (from %s) is not valid", name, tAction, action))
+						continue
+					}
+					if diff := math.Abs(float64(tActionProbs[jj] - actionProbs[ii])); diff > float64(SymmetryTolerance) {
+						deviations = append(deviations, fmt.Sprintf(
+							"%s: probability of %s is %g, original %s had %g",
+							name, tAction, tActionProbs[jj], action, actionProbs[ii]))
+					}
+				}
+			}
+		}
+	}
+	if len(deviations) > 0 {
+		return fmt.Errorf("%d symmetry deviations found:\n\t%s",
+			len(deviations), strings.Join(deviations, "\n\t"))
+	}
+	return nil
+}
+
+// findAction returns the index of the action in actions, or -1 if not found.
+func findAction(actions []Action, action Action) int {
+	for ii, action2 := range actions {
+		if action.Equal(action2) {
+			return ii
+		}
+	}
+	return -1
+}
@@ -0,0 +1,48 @@
+package ai_test
+
+import (
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func symmetryTestBoards() []*Board {
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, 1}, 1, QUEEN)
+	b.StackPiece(Pos{1, 0}, 0, ANT)
+	b.StackPiece(Pos{-1, 1}, 1, SPIDER)
+	b.StackPiece(Pos{0, -1}, 0, BEETLE)
+	b.SetAvailable(0, QUEEN, 0)
+	b.SetAvailable(1, QUEEN, 0)
+	b.SetAvailable(0, ANT, 2)
+	b.SetAvailable(1, SPIDER, 1)
+	b.SetAvailable(0, BEETLE, 1)
+	b.NextPlayer = 1
+	b.BuildDerived()
+	return []*Board{NewBoard(), NewBoard().Act(Action{Piece: SPIDER}), b}
+}
+
+// xScorer scores boards by the position of the pieces, so it is not invariant.
+type xScorer struct{}
+
+func (xScorer) Score(b *Board) (float32, []float32) {
+	score := float32(0)
+	for _, pos := range b.OccupiedPositions() {
+		score += float32(pos.X())
+	}
+	return score, nil
+}
+
+func (xScorer) Version() int { return 0 }
+
+func TestCheckSymmetryInvariance(t *testing.T) {
+	boards := symmetryTestBoards()
+	if err := ai.CheckSymmetryInvariance(ai.TrainedBest, boards); err != nil {
+		t.Errorf("Linear scorer should be invariant to symmetries: %v", err)
+	}
+	if err := ai.CheckSymmetryInvariance(xScorer{}, boards); err == nil {
+		t.Errorf("Position based scorer should have been flagged as not invariant")
+	}
+}
@@ -0,0 +1,56 @@
+package tensorflow
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestAutoBatchFailure(t *testing.T) {
+	s := New("tf_model", 1, true)
+	// Inject a failing session: running a closed session returns an error, and
+	// scoring panics.
+	if err := s.sessionPool[0].Close(); err != nil {
+		t.Fatalf("Failed to close session: %v", err)
+	}
+
+	board := NewBoard()
+	board.BuildDerived()
+	errs := make(chan error)
+	go func() {
+		_, _, err := s.scoreAutoBatch(board)
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("Expected error from scoring with a failing session")
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Auto-batch request hanged after scoring failure")
+	}
+}
+
+func TestAutoBatchMaxActions(t *testing.T) {
+	s := &Scorer{autoBatchSize: 100, MaxBatchActions: 500}
+	// numRequestsToFlush returns how many requests, with numActions actions each,
+	// are batched before the batch is scored.
+	numRequestsToFlush := func(numActions int) int {
+		ab := s.newAutoBatch()
+		for !s.autoBatchFull(ab) {
+			ab.Append(&AutoBatchRequest{actionsFeatures: make([][]float32, numActions)})
+		}
+		return ab.Len()
+	}
+	if got := numRequestsToFlush(150); got != 4 {
+		t.Errorf("Batch of boards with 150 actions flushed with %d boards, wanted 4", got)
+	}
+	if got := numRequestsToFlush(2); got != 100 {
+		t.Errorf("Batch of boards with 2 actions flushed with %d boards, wanted the batch size 100", got)
+	}
+	s.MaxBatchActions = 0
+	if got := numRequestsToFlush(150); got != 100 {
+		t.Errorf("Batch without actions cap flushed with %d boards, wanted the batch size 100", got)
+	}
+}
@@ -1,8 +1,22 @@
 #!/usr/bin/python3
 # This will build an empty base model, with training ops that can be executed from Go.
+#
+# Export contract: the same graph is used by Go for training and for inference, so
+# everything feeding board_predictions and actions_predictions must be built in
+# inference mode: batch normalization using the moving averages (training=False),
+# and no dropout. See ValidateGraph in validate.go, which warns when loading a graph
+# that breaks it. The exception is MC-dropout (--mc_dropout_rate), only enabled when
+# the mc_dropout placeholder is fed True, to estimate the uncertainty of the value.
 import tensorflow as tf
 
 tf.app.flags.DEFINE_string("output", "", "Where to save the graph definition.")
+tf.app.flags.DEFINE_float("mc_dropout_rate", 0.0,
+                          "If > 0, adds dropout to the value head, enabled by feeding mc_dropout=True. "
+                          "See Scorer.ScoreWithUncertainty.")
+tf.app.flags.DEFINE_integer("board_features_dim", 0,
+                            "If > 0, dimension of the board features, for models using a subset of "
+                            "the features: see ai.FeatureSet.Dim and trainer --features. "
+                            "Defaults to BOARD_FEATURES_DIM.")
 FLAGS = tf.app.flags.FLAGS
 
 
@@ -11,10 +25,10 @@ FLAGS = tf.app.flags.FLAGS
 MODEL_DTYPE=tf.float32
 
 # Dimension of the input features.
-BOARD_FEATURES_DIM = 41  # Should match ai.AllFeaturesDim
+BOARD_FEATURES_DIM = 54  # Should match ai.AllFeaturesDim
 
 # These should match the same in policy_features.go
-ACTION_FEATURES_DIM = 1  # Static/context features.
+ACTION_FEATURES_DIM = 2  # Static/context features: should match ai.ActionContextDim(BOARD_FEATURES_DIM)
 NUM_SECTIONS = 6  # Sections of neighbourhood.
 POSITIONS_PER_SECTION = 3  # Num of board positions per section.
 FEATURES_PER_POSITION = 16  # Num of features per position.
@@ -106,7 +120,7 @@ def BuildBoardEmbeddings(board_features, initializer, l2_regularizer):
     return logits
 
 
-def BuildBoardModel(board_embeddings, board_labels, initializer, l2_regularizer):
+def BuildBoardModel(board_embeddings, board_labels, board_weights, initializer, l2_regularizer):
     with tf.name_scope("BuildBoardModel"):
         with tf.variable_scope("board_kernel"):
             board_values = tf.layers.dense(board_embeddings, 1, activation=None,
@@ -116,10 +130,13 @@ def BuildBoardModel(board_embeddings, board_labels, initializer, l2_regularizer)
         board_predictions = SigmoidTo10(board_values)
         board_labels = tf.cast(board_labels, MODEL_DTYPE)
         reshaped_labels = tf.reshape(board_labels, [-1, 1])
-        board_losses = tf.losses.mean_squared_error(reshaped_labels, board_values,
+        reshaped_weights = tf.reshape(tf.cast(board_weights, MODEL_DTYPE), [-1, 1])
+        board_losses = tf.losses.mean_squared_error(reshaped_labels, board_values, weights=reshaped_weights,
                                                     reduction=tf.losses.Reduction.SUM_BY_NONZERO_WEIGHTS)
         board_losses= tf.cast(board_losses, MODEL_DTYPE)
-        return (board_predictions, board_losses)
+        # Unweighted loss of each board, e.g. for prioritized replay.
+        board_examples_losses = tf.reshape(tf.squared_difference(reshaped_labels, board_values), [-1])
+        return (board_predictions, board_losses, board_examples_losses)
 
 
 def BuildNeighbourhoodEmbeddings(actions_features, center, neighbourhood, initializer, l2_regularizer):
@@ -146,7 +163,7 @@ def BuildActionsModel(board_embeddings,
                            actions_board_indices, actions_features,
                            actions_source_center, actions_source_neighbourhood,
                            actions_target_center, actions_target_neighbourhood,
-                           actions_labels, initializer, l2_regularizer):
+                           actions_labels, board_weights, initializer, l2_regularizer):
     with tf.name_scope("BuildActionsModel"):
         actions_features = tf.cast(actions_features, MODEL_DTYPE, name="cast_actions_features")
         actions_source_center = tf.cast(actions_source_center, MODEL_DTYPE, name="cast_actions_source_center")
@@ -187,8 +204,14 @@ def BuildActionsModel(board_embeddings,
                                              kernel_initializer=initializer, kernel_regularizer=l2_regularizer)
         log_soft_max = SparseLogSoftMax(tf.reshape(actions_logits,[-1]), actions_board_indices)
         actions_predictions = tf.exp(log_soft_max)
-        actions_loss = tf.reduce_sum(SparseCrossEntropyLoss(log_soft_max, actions_labels))
-        return (actions_predictions, actions_loss)
+        # Each action is weighted as its board.
+        actions_weights = tf.gather(tf.cast(board_weights, MODEL_DTYPE), actions_board_indices)
+        cross_entropy = SparseCrossEntropyLoss(log_soft_max, actions_labels)
+        actions_loss = tf.reduce_sum(actions_weights * cross_entropy)
+        # Unweighted loss of the actions of each board, e.g. for prioritized replay.
+        actions_examples_losses = tf.unsorted_segment_sum(cross_entropy, actions_board_indices,
+                                                          tf.shape(board_embeddings, out_type=tf.int64)[0])
+        return (actions_predictions, actions_loss, actions_examples_losses)
 
 # Saves graph and returns a SaverDef that can be used to save checkpoints.
 def SaveGraph(output_path):
@@ -223,21 +246,30 @@ def main(argv=None):  # pylint: disable=unused-argument
     learning_rate = tf.placeholder(tf.float32, shape=(), name='learning_rate')
     l2_regularization = tf.placeholder(tf.float32, shape=(), name='l2_regularization')
     l2_regularizer = BuildRegularizer(l2_regularization)
-    board_features = tf.placeholder(tf.float32, shape=[None, BOARD_FEATURES_DIM], name='board_features')
+    board_features_dim = FLAGS.board_features_dim or BOARD_FEATURES_DIM
+    board_features = tf.placeholder(tf.float32, shape=[None, board_features_dim], name='board_features')
     board_labels = tf.placeholder(tf.float32, shape=[None], name='board_labels')
+    # Optional weights of the loss of each board (and its actions), defaults to 1.
+    board_weights = tf.placeholder_with_default(tf.ones_like(board_labels), shape=[None], name='board_weights')
     print('Board inputs:')
-    input_names = [x.name for x in (learning_rate, board_features, board_labels)]
+    input_names = [x.name for x in (learning_rate, board_features, board_labels, board_weights)]
     print('\t{}\n'.format("\t".join(input_names)))
 
     # Build board logits and model.
     board_embeddings = BuildBoardEmbeddings(board_features, initializer, l2_regularizer)
-    board_predictions, board_losses = BuildBoardModel(board_embeddings, board_labels, initializer, l2_regularizer)
+    value_embeddings = board_embeddings
+    if FLAGS.mc_dropout_rate > 0:
+        mc_dropout = tf.placeholder_with_default(False, shape=[], name='mc_dropout')
+        value_embeddings = tf.layers.dropout(board_embeddings, rate=FLAGS.mc_dropout_rate, training=mc_dropout)
+    board_predictions, board_losses, board_examples_losses = BuildBoardModel(
+        value_embeddings, board_labels, board_weights, initializer, l2_regularizer)
     total_losses = board_losses
     board_predictions = tf.identity(
         tf.cast(tf.reshape(board_predictions, [-1]), tf.float32), name='board_predictions')
     board_losses = tf.identity(tf.cast(board_losses, tf.float32), name='board_losses')
+    board_examples_losses = tf.identity(tf.cast(board_examples_losses, tf.float32), name='board_examples_losses')
     print('Board outputs:')
-    print('\t{}\t{}\n'.format(board_predictions.name, board_losses.name))
+    print('\t{}\t{}\t{}\n'.format(board_predictions.name, board_losses.name, board_examples_losses.name))
 
     # Build per action inputs.
     # All inputs are sparse, since the number of actions is variable.
@@ -265,28 +297,50 @@ def main(argv=None):  # pylint: disable=unused-argument
     print('\t{}\n'.format('\n\t'.join(input_names)))
 
     # Build actions model.
-    actions_predictions, actions_losses = BuildActionsModel(
+    actions_predictions, actions_losses, actions_examples_losses = BuildActionsModel(
         board_embeddings, actions_board_indices, actions_features,
         actions_source_center, actions_source_neighbourhood,
         actions_target_center, actions_target_neighbourhood,
-        actions_labels, initializer, l2_regularizer)
+        actions_labels, board_weights, initializer, l2_regularizer)
     total_losses += actions_losses
     actions_predictions = tf.identity(
         tf.cast(tf.reshape(actions_predictions, [-1]), tf.float32), name='actions_predictions')
     actions_losses = tf.identity(tf.cast(actions_losses, tf.float32), name='actions_losses')
+    actions_examples_losses = tf.identity(tf.cast(actions_examples_losses, tf.float32),
+                                          name='actions_examples_losses')
     print('Actions outputs:')
     print('\t{}'.format(actions_predictions.name))
     print('\t{}'.format(actions_losses.name))
+    print('\t{}'.format(actions_examples_losses.name))
 
     # Build optimizer and train opt.
     global_step = tf.train.create_global_step()
     # optimizer = tf.train.AdamOptimizer(learning_rate=learning_rate)
     optimizer = tf.train.GradientDescentOptimizer(learning_rate=learning_rate)
     train_op = optimizer.minimize(total_losses, global_step=global_step, name='train')
+
+    # Separate train ops for value and policy heads: the policy one doesn't touch the
+    # board embeddings, so the value predictions are not affected.
+    train_value_op = optimizer.minimize(board_losses, global_step=global_step, name='train_value')
+    policy_variables = []
+    for scope in ('source_pos', 'target_pos', 'actions_kernel'):
+        policy_variables += tf.get_collection(tf.GraphKeys.TRAINABLE_VARIABLES, scope=scope)
+    train_policy_op = optimizer.minimize(actions_losses, global_step=global_step, var_list=policy_variables,
+                                         name='train_policy')
+
+    # Diagnostics: global norms of the gradients of the total loss and of the weights.
+    trainable_variables = tf.trainable_variables()
+    gradients = [g for g in tf.gradients(total_losses, trainable_variables) if g is not None]
+    gradient_norm = tf.identity(tf.cast(tf.global_norm(gradients), tf.float32), name='gradient_norm')
+    weight_norm = tf.identity(tf.cast(tf.global_norm(trainable_variables), tf.float32), name='weight_norm')
     init = tf.global_variables_initializer()
     print('Training:')
     print('\tInitialize variables:\t', init.name)
     print('\tTrain one step:\t', train_op.name)
+    print('\tTrain value only:\t', train_value_op.name)
+    print('\tTrain policy only:\t', train_policy_op.name)
+    print('\tGradient norm:\t', gradient_norm.name)
+    print('\tWeight norm:\t', weight_norm.name)
 
     # Mean loss: more stable across batches of different sizes.
     mean_loss = total_losses / tf.cast(tf.shape(board_features)[0], dtype=MODEL_DTYPE)
@@ -0,0 +1,391 @@
+package tensorflow
+
+// Checkpoint stores: where checkpoints are shared, e.g. among the machines of a
+// distributed training, see Scorer.Store.
+//
+// Readers may download a checkpoint while it's being saved, so each checkpoint
+// is uploaded with its own version, "<name>.checkpoint-<version><suffix>", and
+// then published by writing the version to "<name>.checkpoint.latest" (see
+// CHECKPOINT_LATEST_SUFFIX), which readers read first. The files of a version
+// are never changed once published.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// CHECKPOINT_SUFFIXES are the suffixes of the files of a checkpoint, appended to
+// "<name>.checkpoint-<version>" in a CheckpointStore.
+var CHECKPOINT_SUFFIXES = []string{".index", ".data-00000-of-00001", ".meta.json"}
+
+// CHECKPOINT_LATEST_SUFFIX is appended to "<name>.checkpoint" for the file that
+// publishes the latest version of a checkpoint in a CheckpointStore. It holds
+// the latest version in its first line, and the previous one in the second.
+const CHECKPOINT_LATEST_SUFFIX = ".latest"
+
+// CHECKPOINT_DOWNLOAD_ATTEMPTS is the number of times a checkpoint download is
+// attempted, if it fails because a newer version was published meanwhile (and
+// the version being downloaded was removed).
+const CHECKPOINT_DOWNLOAD_ATTEMPTS = 3
+
+// CheckpointStore stores the files of checkpoints, by name.
+type CheckpointStore interface {
+	// Create returns a writer to the file with the given name, replacing it if it
+	// exists. The file is only complete once the writer is closed with no errors.
+	Create(name string) (io.WriteCloser, error)
+
+	// Open returns a reader of the file with the given name.
+	Open(name string) (io.ReadCloser, error)
+
+	// Remove removes the file with the given name.
+	Remove(name string) error
+}
+
+// NewCheckpointStore creates a CheckpointStore for the given location:
+//
+//   - gs://bucket/path: Google Cloud Storage, using the gsutil command.
+//   - s3://bucket/path: Amazon S3, using the aws command.
+//   - Anything else is a local directory.
+func NewCheckpointStore(location string) (CheckpointStore, error) {
+	switch {
+	case strings.HasPrefix(location, "gs://"):
+		return &commandCheckpointStore{
+			prefix:   strings.TrimSuffix(location, "/") + "/",
+			upload:   []string{"gsutil", "-q", "cp", "-", "%s"},
+			download: []string{"gsutil", "-q", "cat", "%s"},
+			remove:   []string{"gsutil", "-q", "rm", "%s"},
+		}, nil
+	case strings.HasPrefix(location, "s3://"):
+		return &commandCheckpointStore{
+			prefix:   strings.TrimSuffix(location, "/") + "/",
+			upload:   []string{"aws", "s3", "cp", "--quiet", "-", "%s"},
+			download: []string{"aws", "s3", "cp", "--quiet", "%s", "-"},
+			remove:   []string{"aws", "s3", "rm", "--quiet", "%s"},
+		}, nil
+	case strings.Contains(location, "://"):
+		return nil, fmt.Errorf("Unsupported checkpoint store %q", location)
+	}
+	if err := os.MkdirAll(location, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create checkpoint store directory %s: %v", location, err)
+	}
+	return LocalCheckpointStore(location), nil
+}
+
+// LocalCheckpointStore is a CheckpointStore in a local directory.
+type LocalCheckpointStore string
+
+// Create implements CheckpointStore. The file is written to a temporary file,
+// and renamed once closed, so readers never see a partial file.
+func (dir LocalCheckpointStore) Create(name string) (io.WriteCloser, error) {
+	path := filepath.Join(string(dir), name)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create %s: %v", path, err)
+	}
+	return &renameOnClose{File: file, path: path}, nil
+}
+
+// Open implements CheckpointStore.
+func (dir LocalCheckpointStore) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(dir), name))
+}
+
+// Remove implements CheckpointStore.
+func (dir LocalCheckpointStore) Remove(name string) error {
+	return os.Remove(filepath.Join(string(dir), name))
+}
+
+// renameOnClose renames the file to path once closed.
+type renameOnClose struct {
+	*os.File
+	path string
+}
+
+func (f *renameOnClose) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.File.Name(), f.path)
+}
+
+// commandCheckpointStore is a CheckpointStore that streams the files to and from
+// external commands, e.g. gsutil. The "%s" in the arguments of the commands is
+// replaced by the URL of the file.
+type commandCheckpointStore struct {
+	prefix                   string
+	upload, download, remove []string
+}
+
+// command returns the command for the given template and file name. The
+// standard error is captured to report failures.
+func (cs *commandCheckpointStore) command(template []string, name string) (*exec.Cmd, *bytes.Buffer) {
+	args := make([]string, len(template))
+	for ii, arg := range template {
+		if arg == "%s" {
+			arg = cs.prefix + name
+		}
+		args[ii] = arg
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	return cmd, stderr
+}
+
+// commandStream is the stdin or stdout of a running command: closing it waits
+// for the command to finish.
+type commandStream struct {
+	io.Reader
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (s *commandStream) Close() error {
+	if s.WriteCloser != nil {
+		if err := s.WriteCloser.Close(); err != nil {
+			return err
+		}
+	}
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("Failed to run %v: %v: %s", s.cmd.Args, err, s.stderr)
+	}
+	return nil
+}
+
+// Create implements CheckpointStore.
+func (cs *commandCheckpointStore) Create(name string) (io.WriteCloser, error) {
+	cmd, stderr := cs.command(cs.upload, name)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to upload %s%s: %v", cs.prefix, name, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to upload %s%s: %v", cs.prefix, name, err)
+	}
+	return &commandStream{WriteCloser: stdin, cmd: cmd, stderr: stderr}, nil
+}
+
+// Open implements CheckpointStore.
+func (cs *commandCheckpointStore) Open(name string) (io.ReadCloser, error) {
+	cmd, stderr := cs.command(cs.download, name)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download %s%s: %v", cs.prefix, name, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to download %s%s: %v", cs.prefix, name, err)
+	}
+	return &commandStream{Reader: stdout, cmd: cmd, stderr: stderr}, nil
+}
+
+// Remove implements CheckpointStore.
+func (cs *commandCheckpointStore) Remove(name string) error {
+	cmd, stderr := cs.command(cs.remove, name)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to run %v: %v: %s", cmd.Args, err, stderr)
+	}
+	return nil
+}
+
+// StoreName returns the name of the model's checkpoint in s.Store: the base
+// name of s.Basename.
+func (s *Scorer) StoreName() string {
+	return filepath.Base(s.Basename)
+}
+
+// SaveTo saves the model's checkpoint to the store, with the given name. The
+// local checkpoint files are not changed.
+func (s *Scorer) SaveTo(store CheckpointStore, name string) error {
+	dir, err := ioutil.TempDir("", "hive_tf_checkpoint")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary directory for checkpoint: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	checkpointBase := filepath.Join(dir, "model.checkpoint")
+	if err = s.writeCheckpoint(checkpointBase); err != nil {
+		return err
+	}
+	return uploadCheckpoint(store, name, checkpointBase)
+}
+
+// RestoreFrom restores the model from the checkpoint with the given name in the
+// store. Since TensorFlow can only restore checkpoints from files, they are
+// downloaded to a temporary directory first.
+func (s *Scorer) RestoreFrom(store CheckpointStore, name string) error {
+	checkpointBase, cleanup, err := downloadCheckpointToTemp(store, name)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	if err = s.restoreFrom(checkpointBase); err != nil {
+		return err
+	}
+	return s.loadCheckpointMeta(checkpointBase + ".meta.json")
+}
+
+// downloadCheckpointToTemp downloads the checkpoint with the given name in the
+// store to a temporary directory, and returns its base name. cleanup removes
+// the temporary directory.
+func downloadCheckpointToTemp(store CheckpointStore, name string) (checkpointBase string, cleanup func(), err error) {
+	dir, err := ioutil.TempDir("", "hive_tf_checkpoint")
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to create temporary directory for checkpoint: %v", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	checkpointBase = filepath.Join(dir, "model.checkpoint")
+	if err = downloadCheckpoint(store, name, checkpointBase); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return checkpointBase, cleanup, nil
+}
+
+// uploadCheckpoint copies the files of the local checkpoint checkpointBase to the
+// store, as a new version, and publishes it once all its files are uploaded. The
+// version published before the previous one is removed, the previous one is kept
+// for the readers that may be downloading it.
+func uploadCheckpoint(store CheckpointStore, name, checkpointBase string) error {
+	latest, previous, _ := readLatestCheckpoint(store, name)
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for _, suffix := range CHECKPOINT_SUFFIXES {
+		storeFile := checkpointVersionName(name, version) + suffix
+		src, err := os.Open(checkpointBase + suffix)
+		if err != nil {
+			return fmt.Errorf("Failed to upload %s to checkpoint store: %v", storeFile, err)
+		}
+		err = copyToStore(store, storeFile, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to upload %s to checkpoint store: %v", storeFile, err)
+		}
+	}
+	latestFile := name + ".checkpoint" + CHECKPOINT_LATEST_SUFFIX
+	if err := copyToStore(store, latestFile, strings.NewReader(version+"\n"+latest+"\n")); err != nil {
+		return fmt.Errorf("Failed to publish %s in checkpoint store: %v", latestFile, err)
+	}
+	if previous != "" {
+		for _, suffix := range CHECKPOINT_SUFFIXES {
+			if err := store.Remove(checkpointVersionName(name, previous) + suffix); err != nil {
+				glog.Warningf("Failed to remove old checkpoint from store: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkpointVersionName returns the name of the files of the given version of
+// the checkpoint in a store, without the suffix. If version is empty, it's the
+// name used before checkpoints were versioned.
+func checkpointVersionName(name, version string) string {
+	if version == "" {
+		return name + ".checkpoint"
+	}
+	return name + ".checkpoint-" + version
+}
+
+// readLatestCheckpoint returns the latest and the previous versions of the
+// checkpoint in the store, see CHECKPOINT_LATEST_SUFFIX. They are empty if
+// there is no version.
+func readLatestCheckpoint(store CheckpointStore, name string) (latest, previous string, err error) {
+	src, err := store.Open(name + ".checkpoint" + CHECKPOINT_LATEST_SUFFIX)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := ioutil.ReadAll(src)
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(string(data), "\n")
+	latest = strings.TrimSpace(lines[0])
+	if len(lines) > 1 {
+		previous = strings.TrimSpace(lines[1])
+	}
+	return
+}
+
+// copyToStore streams src to the file with the given name in the store.
+func copyToStore(store CheckpointStore, name string, src io.Reader) error {
+	dst, err := store.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// downloadCheckpoint copies the files of the latest version of the checkpoint
+// from the store to the local checkpointBase. Checkpoints that were uploaded
+// before they were versioned (with no CHECKPOINT_LATEST_SUFFIX file) are also
+// supported.
+func downloadCheckpoint(store CheckpointStore, name, checkpointBase string) error {
+	var err error
+	for attempt := 0; attempt < CHECKPOINT_DOWNLOAD_ATTEMPTS; attempt++ {
+		latest, _, latestErr := readLatestCheckpoint(store, name)
+		if latestErr != nil {
+			// Try the name used before checkpoints were versioned.
+			if err = downloadCheckpointVersion(store, name, "", checkpointBase); err != nil {
+				err = fmt.Errorf("%v (and failed to read the latest version: %v)", err, latestErr)
+			}
+			return err
+		}
+		if err = downloadCheckpointVersion(store, name, latest, checkpointBase); err == nil {
+			return nil
+		}
+		if newLatest, _, _ := readLatestCheckpoint(store, name); newLatest == latest {
+			return err
+		}
+		glog.Warningf("%v: a new version of the checkpoint was published, trying again", err)
+	}
+	return err
+}
+
+// downloadCheckpointVersion copies the files of the given version of the
+// checkpoint from the store to the local checkpointBase.
+func downloadCheckpointVersion(store CheckpointStore, name, version, checkpointBase string) error {
+	for _, suffix := range CHECKPOINT_SUFFIXES {
+		storeFile := checkpointVersionName(name, version) + suffix
+		if err := copyFromStore(store, storeFile, checkpointBase+suffix); err != nil {
+			return fmt.Errorf("Failed to download %s from checkpoint store: %v", storeFile, err)
+		}
+	}
+	return nil
+}
+
+// copyFromStore streams the file with the given name in the store to the local
+// file dstPath.
+func copyFromStore(store CheckpointStore, name, dstPath string) error {
+	src, err := store.Open(name)
+	if err != nil {
+		return err
+	}
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package tensorflow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFakeCheckpoint writes files with the given content for each of the
+// CHECKPOINT_SUFFIXES of checkpointBase.
+func writeFakeCheckpoint(t *testing.T, checkpointBase, content string) {
+	for _, suffix := range CHECKPOINT_SUFFIXES {
+		if err := ioutil.WriteFile(checkpointBase+suffix, []byte(content+suffix), 0644); err != nil {
+			t.Fatalf("Failed to write %s%s: %v", checkpointBase, suffix, err)
+		}
+	}
+}
+
+// checkFakeCheckpoint checks that the checkpoint downloaded from the store to
+// checkpointBase has the given content.
+func checkFakeCheckpoint(t *testing.T, store CheckpointStore, checkpointBase, content string) {
+	if err := downloadCheckpoint(store, "model", checkpointBase); err != nil {
+		t.Fatalf("Failed to download checkpoint: %v", err)
+	}
+	for _, suffix := range CHECKPOINT_SUFFIXES {
+		data, err := ioutil.ReadFile(checkpointBase + suffix)
+		if err != nil || string(data) != content+suffix {
+			t.Errorf("Downloaded %s%s has %q (err=%v), wanted %q", checkpointBase, suffix, data, err, content+suffix)
+		}
+	}
+}
+
+func TestCheckpointStoreVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_tf_store_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	storeDir, localDir := filepath.Join(dir, "store"), filepath.Join(dir, "local")
+	store, err := NewCheckpointStore(storeDir)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err = os.Mkdir(localDir, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", localDir, err)
+	}
+	src, dst := filepath.Join(localDir, "src.checkpoint"), filepath.Join(localDir, "dst.checkpoint")
+
+	// Checkpoints uploaded before they were versioned.
+	writeFakeCheckpoint(t, filepath.Join(storeDir, "model.checkpoint"), "legacy")
+	checkFakeCheckpoint(t, store, dst, "legacy")
+
+	// Only the latest version is downloaded, and only the last two are kept.
+	for _, content := range []string{"v1", "v2", "v3"} {
+		writeFakeCheckpoint(t, src, content)
+		if err = uploadCheckpoint(store, "model", src); err != nil {
+			t.Fatalf("Failed to upload %s: %v", content, err)
+		}
+		checkFakeCheckpoint(t, store, dst, content)
+	}
+	latest, previous, err := readLatestCheckpoint(store, "model")
+	if err != nil || latest == "" || previous == "" || latest == previous {
+		t.Fatalf("Invalid latest checkpoint versions %q and %q, err=%v", latest, previous, err)
+	}
+	indexes, _ := filepath.Glob(filepath.Join(storeDir, "model.checkpoint-*.index"))
+	if len(indexes) != 2 {
+		t.Errorf("Got checkpoints %v in store, wanted the last 2 versions", indexes)
+	}
+
+	// A version that is uploaded but not published is not seen by the readers.
+	writeFakeCheckpoint(t, filepath.Join(storeDir, checkpointVersionName("model", "unpublished")), "v4")
+	checkFakeCheckpoint(t, store, dst, "v3")
+}
@@ -0,0 +1,59 @@
+package tensorflow
+
+import (
+	"fmt"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+// LEAKY_RELU_ALPHA is the slope for negative values of tf.nn.leaky_relu, the
+// activation used by build_model.py.
+const LEAKY_RELU_ALPHA = 0.2
+
+// ExportPureGo exports the value head of the model (the board_kernel variables
+// built by build_model.py) to an ai.PureGoScorer, that can score boards without
+// TensorFlow. The policy head is not exported.
+func (s *Scorer) ExportPureGo() (*ai.PureGoScorer, error) {
+	variables, err := s.DumpVariables()
+	if err != nil {
+		return nil, err
+	}
+	pure := &ai.PureGoScorer{FeaturesVersion: s.version, Features: s.features, FeatureStats: s.FeatureStats}
+	inputDim := s.inputDim
+	addLayer := func(name string, leakyReLU, skipInput bool) error {
+		kernel, bias := variables["board_kernel/"+name+"/kernel"], variables["board_kernel/"+name+"/bias"]
+		if kernel == nil || bias == nil {
+			return fmt.Errorf("Variables of layer board_kernel/%s not found in %s", name, s)
+		}
+		layer := ai.MLPLayer{
+			InputDim: inputDim, OutputDim: len(bias),
+			Kernel: kernel, Bias: bias,
+			LeakyReLU: leakyReLU, LeakyAlpha: LEAKY_RELU_ALPHA,
+			SkipInput: skipInput,
+		}
+		pure.Layers = append(pure.Layers, layer)
+		inputDim = layer.OutputDim
+		if skipInput {
+			inputDim += s.inputDim
+		}
+		return nil
+	}
+
+	// Hidden layers and embedding, all with skip connections, and the final
+	// linear layer: see buildSkipFFNN and BuildBoardModel in build_model.py.
+	for ii := 0; variables[fmt.Sprintf("board_kernel/hidden_%d/kernel", ii)] != nil; ii++ {
+		if err = addLayer(fmt.Sprintf("hidden_%d", ii), true, true); err != nil {
+			return nil, err
+		}
+	}
+	if err = addLayer("embedding", true, true); err != nil {
+		return nil, err
+	}
+	if err = addLayer("linear_layer", false, false); err != nil {
+		return nil, err
+	}
+	if err = pure.Validate(); err != nil {
+		return nil, fmt.Errorf("Failed to export %s: %v", s, err)
+	}
+	return pure, nil
+}
@@ -0,0 +1,324 @@
+package tensorflow
+
+// Scoring and learning gRPC service, so self-play workers can use a model held by
+// a central learner (parameter server). The service and its messages are defined
+// in scorer_service.proto: the messages are encoded in the protobuf wire format
+// by service_wire.go, so any gRPC client generated from the .proto can use it.
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	. "github.com/janpfeifer/hiveGo/state"
+	"google.golang.org/grpc"
+)
+
+// SCORER_SERVICE_NAME is the full name of the service in scorer_service.proto.
+const SCORER_SERVICE_NAME = "hive.ScorerService"
+
+// FlatFeatures holds the features of a batch of boards, as they are fed to the
+// model. Version is the version of the features (see ai.FeatureVector).
+type FlatFeatures struct {
+	Version                    int
+	NumActions                 []int
+	BoardFeatures              [][]float32
+	ActionsBoardIndices        []int64
+	ActionsFeatures            [][]float32
+	ActionsSourceCenter        [][]float32
+	ActionsSourceNeighbourhood [][6][]float32
+	ActionsTargetCenter        [][]float32
+	ActionsTargetNeighbourhood [][6][]float32
+}
+
+// NewFlatFeatures builds the features of the boards for the given version.
+// cache is optional.
+func NewFlatFeatures(boards []*Board, version int, cache *ai.ActionFeaturesCache) FlatFeatures {
+	fc := buildFlatFeatures(boards, version, nil, cache)
+	return FlatFeatures{
+		Version:                    version,
+		NumActions:                 fc.numActions,
+		BoardFeatures:              fc.boardFeatures,
+		ActionsBoardIndices:        fc.actionsBoardIndices,
+		ActionsFeatures:            fc.actionsFeatures,
+		ActionsSourceCenter:        fc.actionsSourceCenter,
+		ActionsSourceNeighbourhood: fc.actionsSourceNeighbourhood,
+		ActionsTargetCenter:        fc.actionsTargetCenter,
+		ActionsTargetNeighbourhood: fc.actionsTargetNeighbourhood,
+	}
+}
+
+// collection converts the features back to the internal representation, and
+// checks that they are consistent.
+func (ff *FlatFeatures) collection() (*flatFeaturesCollection, error) {
+	fc := &flatFeaturesCollection{
+		numActions:                 ff.NumActions,
+		boardFeatures:              ff.BoardFeatures,
+		actionsBoardIndices:        ff.ActionsBoardIndices,
+		actionsFeatures:            ff.ActionsFeatures,
+		actionsSourceCenter:        ff.ActionsSourceCenter,
+		actionsSourceNeighbourhood: ff.ActionsSourceNeighbourhood,
+		actionsTargetCenter:        ff.ActionsTargetCenter,
+		actionsTargetNeighbourhood: ff.ActionsTargetNeighbourhood,
+	}
+	if len(fc.numActions) == 0 {
+		return nil, fmt.Errorf("Received empty list of boards")
+	}
+	if len(fc.boardFeatures) != len(fc.numActions) {
+		return nil, fmt.Errorf("Got features for %d boards, but number of actions for %d boards",
+			len(fc.boardFeatures), len(fc.numActions))
+	}
+	for _, numActions := range fc.numActions {
+		fc.totalNumActions += numActions
+	}
+	for _, l := range []int{len(fc.actionsBoardIndices), len(fc.actionsFeatures), len(fc.actionsSourceCenter),
+		len(fc.actionsSourceNeighbourhood), len(fc.actionsTargetCenter), len(fc.actionsTargetNeighbourhood)} {
+		if l != fc.totalNumActions {
+			return nil, fmt.Errorf("Got features for %d actions, wanted %d", l, fc.totalNumActions)
+		}
+	}
+	return fc, nil
+}
+
+// ScoreRequest is the request of ScorerService.BatchScore.
+type ScoreRequest struct {
+	Features FlatFeatures
+}
+
+// ScoreResponse is the response of ScorerService.BatchScore. ActionProbs are the
+// probabilities of the actions of all boards, concatenated.
+type ScoreResponse struct {
+	Scores      []float32
+	ActionProbs []float32
+}
+
+// LearnRequest is the request of ScorerService.Learn. ActionsLabels are the
+// labels of the actions of all boards, concatenated, or empty if only the value
+// head is trained (see TrainTarget).
+type LearnRequest struct {
+	Features      FlatFeatures
+	BoardLabels   []float32
+	ActionsLabels []float32
+	LearningRate  float32
+	Steps         int
+}
+
+// LearnResponse is the response of ScorerService.Learn.
+type LearnResponse struct {
+	Loss LossBreakdown
+}
+
+// ScorerService serves the BatchScore and Learn methods of a Scorer. It is safe
+// for concurrent use as the Scorer is, but Learn requires a Scorer with a session
+// pool of size 1.
+type ScorerService struct {
+	Scorer *Scorer
+}
+
+// scorerServer is the interface of the implementations of the ScorerService,
+// the HandlerType of scorerServiceDesc.
+type scorerServer interface {
+	BatchScore(req *ScoreRequest, resp *ScoreResponse) error
+	Learn(req *LearnRequest, resp *LearnResponse) error
+}
+
+// scorerServiceDesc describes the ScorerService of scorer_service.proto, as
+// protoc-gen-go-grpc would generate it.
+var scorerServiceDesc = grpc.ServiceDesc{
+	ServiceName: SCORER_SERVICE_NAME,
+	HandlerType: (*scorerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "BatchScore",
+			Handler: unaryHandler("BatchScore", func() wireMessage { return &ScoreRequest{} },
+				func(srv scorerServer, req wireMessage) (wireMessage, error) {
+					resp := &ScoreResponse{}
+					return resp, srv.BatchScore(req.(*ScoreRequest), resp)
+				}),
+		},
+		{
+			MethodName: "Learn",
+			Handler: unaryHandler("Learn", func() wireMessage { return &LearnRequest{} },
+				func(srv scorerServer, req wireMessage) (wireMessage, error) {
+					resp := &LearnResponse{}
+					return resp, srv.Learn(req.(*LearnRequest), resp)
+				}),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "scorer_service.proto",
+}
+
+// unaryHandler returns the gRPC handler of the method, that decodes the request
+// created by newReq, and calls the method with call.
+func unaryHandler(method string, newReq func() wireMessage,
+	call func(srv scorerServer, req wireMessage) (wireMessage, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+		interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(scorerServer), req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + SCORER_SERVICE_NAME + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(scorerServer), req.(wireMessage))
+		})
+	}
+}
+
+// NewScorerServer returns a gRPC server with a ScorerService for the scorer. The
+// server encodes the messages with the codec of the ScorerService, so it can't
+// serve other services.
+func NewScorerServer(scorer *Scorer, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(append(opts, grpc.ForceServerCodec(wireCodec{}))...)
+	server.RegisterService(&scorerServiceDesc, &ScorerService{scorer})
+	return server
+}
+
+// checkFeatures converts the features, and checks they match the scorer's version.
+func (svc *ScorerService) checkFeatures(ff *FlatFeatures) (*flatFeaturesCollection, error) {
+	if ff.Version != svc.Scorer.Version() {
+		return nil, fmt.Errorf("Features version %d requested, but model uses version %d",
+			ff.Version, svc.Scorer.Version())
+	}
+	if fs := svc.Scorer.Features(); fs != nil {
+		return nil, fmt.Errorf("Model uses a subset of the features (%s), not supported by the ScorerService", fs)
+	}
+	if svc.Scorer.linearBlendWeight() != 0 && !svc.Scorer.featuresMatchLinear() {
+		return nil, fmt.Errorf("Blending the linear model (version %d) into a model of version %d needs "+
+			"the boards, not supported by the ScorerService", ai.TrainedBest.Version(), svc.Scorer.Version())
+	}
+	return ff.collection()
+}
+
+// BatchScore scores the boards whose features are given.
+func (svc *ScorerService) BatchScore(req *ScoreRequest, resp *ScoreResponse) (err error) {
+	fc, err := svc.checkFeatures(&req.Features)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Failed to score: %v", r)
+		}
+	}()
+	var actionProbsBatch [][]float32
+	resp.Scores, actionProbsBatch = svc.Scorer.scoreFlatFeatures(fc, nil)
+	resp.ActionProbs = make([]float32, 0, fc.totalNumActions)
+	for _, actionProbs := range actionProbsBatch {
+		resp.ActionProbs = append(resp.ActionProbs, actionProbs...)
+	}
+	return nil
+}
+
+// Learn trains the model with the boards whose features are given.
+func (svc *ScorerService) Learn(req *LearnRequest, resp *LearnResponse) (err error) {
+	fc, err := svc.checkFeatures(&req.Features)
+	if err != nil {
+		return err
+	}
+	if len(req.BoardLabels) != len(fc.numActions) {
+		return fmt.Errorf("Got %d board labels for %d boards", len(req.BoardLabels), len(fc.numActions))
+	}
+	if len(req.ActionsLabels) != 0 && len(req.ActionsLabels) != fc.totalNumActions {
+		return fmt.Errorf("Got %d actions labels for %d actions", len(req.ActionsLabels), fc.totalNumActions)
+	}
+	actionsLabels := make([][]float32, len(fc.numActions))
+	if len(req.ActionsLabels) > 0 {
+		actionsLabels = splitByActions(req.ActionsLabels, fc.numActions)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Failed to learn: %v", r)
+		}
+	}()
+	resp.Loss = svc.Scorer.learnFlatFeatures(fc, req.BoardLabels, actionsLabels, nil, req.LearningRate,
+		req.Steps, nil)
+	return nil
+}
+
+// splitByActions splits values of the actions of all boards, concatenated, into
+// the values of each board. Boards without actions get nil.
+func splitByActions(values []float32, numActions []int) [][]float32 {
+	split := make([][]float32, len(numActions))
+	for ii, n := range numActions {
+		if n > 0 {
+			split[ii] = values[:n]
+			values = values[n:]
+		}
+	}
+	return split
+}
+
+// RemoteScorer implements ai.BatchScorer and Learn by calling a ScorerService:
+// the features are built locally, and sent to the service for evaluation.
+type RemoteScorer struct {
+	Conn grpc.ClientConnInterface
+
+	// ActionFeaturesCache is optional, see Scorer.ActionFeaturesCache.
+	ActionFeaturesCache *ai.ActionFeaturesCache
+
+	version int
+}
+
+// NewRemoteScorer creates a RemoteScorer that uses the features version of the
+// model served.
+func NewRemoteScorer(conn grpc.ClientConnInterface, version int) *RemoteScorer {
+	return &RemoteScorer{Conn: conn, version: version}
+}
+
+// Version implements ai.Scorer.
+func (r *RemoteScorer) Version() int { return r.version }
+
+// Score implements ai.Scorer.
+func (r *RemoteScorer) Score(b *Board) (score float32, actionProbs []float32) {
+	scores, actionProbsBatch := r.BatchScore([]*Board{b})
+	return scores[0], actionProbsBatch[0]
+}
+
+// call invokes the method of the ScorerService.
+func (r *RemoteScorer) call(method string, req, resp wireMessage) error {
+	return r.Conn.Invoke(context.Background(), "/"+SCORER_SERVICE_NAME+"/"+method, req, resp,
+		grpc.ForceCodec(wireCodec{}))
+}
+
+// BatchScore implements ai.BatchScorer. It panics if the call fails.
+func (r *RemoteScorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32) {
+	req := &ScoreRequest{Features: NewFlatFeatures(boards, r.version, r.ActionFeaturesCache)}
+	var resp ScoreResponse
+	if err := r.call("BatchScore", req, &resp); err != nil {
+		log.Panicf("Remote BatchScore failed: %v", err)
+	}
+	totalNumActions := 0
+	for _, n := range req.Features.NumActions {
+		totalNumActions += n
+	}
+	if len(resp.Scores) != len(boards) || len(resp.ActionProbs) != totalNumActions {
+		log.Panicf("Remote BatchScore returned %d scores and %d probabilities, wanted %d and %d",
+			len(resp.Scores), len(resp.ActionProbs), len(boards), totalNumActions)
+	}
+	return resp.Scores, splitByActions(resp.ActionProbs, req.Features.NumActions)
+}
+
+// Learn trains the remote model, and returns the losses.
+func (r *RemoteScorer) Learn(boards []*Board, boardLabels []float32, actionsLabels [][]float32,
+	learningRate float32, steps int) (LossBreakdown, error) {
+	req := &LearnRequest{
+		Features:     NewFlatFeatures(boards, r.version, r.ActionFeaturesCache),
+		BoardLabels:  boardLabels,
+		LearningRate: learningRate,
+		Steps:        steps,
+	}
+	for _, labels := range actionsLabels {
+		req.ActionsLabels = append(req.ActionsLabels, labels...)
+	}
+	var resp LearnResponse
+	if err := r.call("Learn", req, &resp); err != nil {
+		return resp.Loss, fmt.Errorf("Remote Learn failed: %v", err)
+	}
+	return resp.Loss, nil
+}
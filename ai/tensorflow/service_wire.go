@@ -0,0 +1,404 @@
+package tensorflow
+
+// Protobuf wire format of the messages of scorer_service.proto. They are encoded
+// with protowire, instead of code generated by protoc, so the service works
+// directly with the Go structs of service.go.
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// wireMessage is a message of the ScorerService, that encodes itself in the
+// protobuf wire format.
+type wireMessage interface {
+	marshalWire() []byte
+	unmarshalWire(data []byte) error
+}
+
+// wireCodec is the gRPC codec of the messages of the ScorerService. It's named
+// "proto" since the messages are protobuf encoded, see scorer_service.proto.
+type wireCodec struct{}
+
+func (wireCodec) Name() string { return "proto" }
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a message of the ScorerService", v)
+	}
+	return m.marshalWire(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("%T is not a message of the ScorerService", v)
+	}
+	return m.unmarshalWire(data)
+}
+
+// Encoding of the fields. Fields with the default value are omitted, as in
+// proto3, and repeated scalars are packed.
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendFloat(b []byte, num protowire.Number, v float32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, math.Float32bits(v))
+}
+
+func appendInts(b []byte, num protowire.Number, values []int64) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, uint64(v))
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+func appendFloats(b []byte, num protowire.Number, values []float32) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(4*len(values)))
+	for _, v := range values {
+		b = protowire.AppendFixed32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, m wireMessage) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.marshalWire())
+}
+
+// flatten returns the row-major values of the matrix.
+func flatten(matrix [][]float32) (values []float32) {
+	for _, row := range matrix {
+		values = append(values, row...)
+	}
+	return
+}
+
+// flattenNeighbourhoods returns the row-major values of the [rows, 6, dim] tensor.
+func flattenNeighbourhoods(neighbourhoods [][6][]float32) (values []float32) {
+	for _, sections := range neighbourhoods {
+		for _, section := range sections {
+			values = append(values, section...)
+		}
+	}
+	return
+}
+
+// Decoding of the fields.
+
+// consumeFields calls field for each field of the message, with the encoded value.
+func consumeFields(data []byte, field func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := field(num, typ, data[:n]); err != nil {
+			return fmt.Errorf("field %d: %v", num, err)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func intValue(typ protowire.Type, value []byte) (int64, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("wire type %d is not an integer", typ)
+	}
+	v, _ := protowire.ConsumeVarint(value)
+	return int64(v), nil
+}
+
+func floatValue(typ protowire.Type, value []byte) (float32, error) {
+	if typ != protowire.Fixed32Type {
+		return 0, fmt.Errorf("wire type %d is not a float", typ)
+	}
+	v, _ := protowire.ConsumeFixed32(value)
+	return math.Float32frombits(v), nil
+}
+
+func messageValue(typ protowire.Type, value []byte) ([]byte, error) {
+	if typ != protowire.BytesType {
+		return nil, fmt.Errorf("wire type %d is not a message", typ)
+	}
+	v, _ := protowire.ConsumeBytes(value)
+	return v, nil
+}
+
+// appendIntsValue appends the integers of a repeated field, packed or not.
+func appendIntsValue(values []int64, typ protowire.Type, value []byte) ([]int64, error) {
+	if typ == protowire.VarintType {
+		v, _ := protowire.ConsumeVarint(value)
+		return append(values, int64(v)), nil
+	}
+	packed, err := messageValue(typ, value)
+	if err != nil {
+		return nil, err
+	}
+	for len(packed) > 0 {
+		v, n := protowire.ConsumeVarint(packed)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		values = append(values, int64(v))
+		packed = packed[n:]
+	}
+	return values, nil
+}
+
+// appendFloatsValue appends the floats of a repeated field, packed or not.
+func appendFloatsValue(values []float32, typ protowire.Type, value []byte) ([]float32, error) {
+	if typ == protowire.Fixed32Type {
+		v, _ := protowire.ConsumeFixed32(value)
+		return append(values, math.Float32frombits(v)), nil
+	}
+	packed, err := messageValue(typ, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(packed)%4 != 0 {
+		return nil, fmt.Errorf("packed floats of %d bytes", len(packed))
+	}
+	for ; len(packed) > 0; packed = packed[4:] {
+		v, _ := protowire.ConsumeFixed32(packed)
+		values = append(values, math.Float32frombits(v))
+	}
+	return values, nil
+}
+
+// reshape splits the row-major values of a matrix into the given number of rows.
+func reshape(values []float32, numRows int) ([][]float32, error) {
+	if numRows == 0 || len(values)%numRows != 0 {
+		if numRows == 0 && len(values) == 0 {
+			return [][]float32{}, nil
+		}
+		return nil, fmt.Errorf("%d values can't be split into %d rows", len(values), numRows)
+	}
+	dim := len(values) / numRows
+	matrix := make([][]float32, numRows)
+	for ii := range matrix {
+		matrix[ii] = values[ii*dim : (ii+1)*dim]
+	}
+	return matrix, nil
+}
+
+// reshapeNeighbourhoods is like reshape, for a [numRows, 6, dim] tensor.
+func reshapeNeighbourhoods(values []float32, numRows int) ([][6][]float32, error) {
+	sections, err := reshape(values, 6*numRows)
+	if err != nil {
+		return nil, err
+	}
+	neighbourhoods := make([][6][]float32, numRows)
+	for ii := range neighbourhoods {
+		copy(neighbourhoods[ii][:], sections[6*ii:6*(ii+1)])
+	}
+	return neighbourhoods, nil
+}
+
+// Messages.
+
+func (ff *FlatFeatures) marshalWire() []byte {
+	numActions := make([]int64, len(ff.NumActions))
+	for ii, n := range ff.NumActions {
+		numActions[ii] = int64(n)
+	}
+	var b []byte
+	b = appendInt(b, 1, int64(ff.Version))
+	b = appendInts(b, 2, numActions)
+	b = appendFloats(b, 3, flatten(ff.BoardFeatures))
+	b = appendInts(b, 4, ff.ActionsBoardIndices)
+	b = appendFloats(b, 5, flatten(ff.ActionsFeatures))
+	b = appendFloats(b, 6, flatten(ff.ActionsSourceCenter))
+	b = appendFloats(b, 7, flattenNeighbourhoods(ff.ActionsSourceNeighbourhood))
+	b = appendFloats(b, 8, flatten(ff.ActionsTargetCenter))
+	b = appendFloats(b, 9, flattenNeighbourhoods(ff.ActionsTargetNeighbourhood))
+	return b
+}
+
+func (ff *FlatFeatures) unmarshalWire(data []byte) error {
+	*ff = FlatFeatures{ActionsBoardIndices: []int64{}}
+	var numActions []int64
+	var boardFeatures, actionsFeatures, sourceCenter, sourceNeighbourhood, targetCenter,
+		targetNeighbourhood []float32
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) (err error) {
+		switch num {
+		case 1:
+			var v int64
+			v, err = intValue(typ, value)
+			ff.Version = int(v)
+		case 2:
+			numActions, err = appendIntsValue(numActions, typ, value)
+		case 3:
+			boardFeatures, err = appendFloatsValue(boardFeatures, typ, value)
+		case 4:
+			ff.ActionsBoardIndices, err = appendIntsValue(ff.ActionsBoardIndices, typ, value)
+		case 5:
+			actionsFeatures, err = appendFloatsValue(actionsFeatures, typ, value)
+		case 6:
+			sourceCenter, err = appendFloatsValue(sourceCenter, typ, value)
+		case 7:
+			sourceNeighbourhood, err = appendFloatsValue(sourceNeighbourhood, typ, value)
+		case 8:
+			targetCenter, err = appendFloatsValue(targetCenter, typ, value)
+		case 9:
+			targetNeighbourhood, err = appendFloatsValue(targetNeighbourhood, typ, value)
+		}
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid FlatFeatures: %v", err)
+	}
+
+	ff.NumActions = make([]int, len(numActions))
+	totalNumActions := 0
+	for ii, n := range numActions {
+		if n < 0 {
+			return fmt.Errorf("Invalid FlatFeatures: board %d has %d actions", ii, n)
+		}
+		ff.NumActions[ii] = int(n)
+		totalNumActions += int(n)
+	}
+	for _, m := range []struct {
+		matrix *[][]float32
+		values []float32
+		rows   int
+	}{
+		{&ff.BoardFeatures, boardFeatures, len(numActions)},
+		{&ff.ActionsFeatures, actionsFeatures, totalNumActions},
+		{&ff.ActionsSourceCenter, sourceCenter, totalNumActions},
+		{&ff.ActionsTargetCenter, targetCenter, totalNumActions},
+	} {
+		if *m.matrix, err = reshape(m.values, m.rows); err != nil {
+			return fmt.Errorf("Invalid FlatFeatures: %v", err)
+		}
+	}
+	if ff.ActionsSourceNeighbourhood, err = reshapeNeighbourhoods(sourceNeighbourhood, totalNumActions); err != nil {
+		return fmt.Errorf("Invalid FlatFeatures: %v", err)
+	}
+	if ff.ActionsTargetNeighbourhood, err = reshapeNeighbourhoods(targetNeighbourhood, totalNumActions); err != nil {
+		return fmt.Errorf("Invalid FlatFeatures: %v", err)
+	}
+	return nil
+}
+
+func (req *ScoreRequest) marshalWire() []byte {
+	return appendMessage(nil, 1, &req.Features)
+}
+
+func (req *ScoreRequest) unmarshalWire(data []byte) error {
+	*req = ScoreRequest{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		features, err := messageValue(typ, value)
+		if err != nil {
+			return err
+		}
+		return req.Features.unmarshalWire(features)
+	})
+}
+
+func (resp *ScoreResponse) marshalWire() []byte {
+	b := appendFloats(nil, 1, resp.Scores)
+	return appendFloats(b, 2, resp.ActionProbs)
+}
+
+func (resp *ScoreResponse) unmarshalWire(data []byte) error {
+	*resp = ScoreResponse{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) (err error) {
+		switch num {
+		case 1:
+			resp.Scores, err = appendFloatsValue(resp.Scores, typ, value)
+		case 2:
+			resp.ActionProbs, err = appendFloatsValue(resp.ActionProbs, typ, value)
+		}
+		return
+	})
+}
+
+func (req *LearnRequest) marshalWire() []byte {
+	b := appendMessage(nil, 1, &req.Features)
+	b = appendFloats(b, 2, req.BoardLabels)
+	b = appendFloats(b, 3, req.ActionsLabels)
+	b = appendFloat(b, 4, req.LearningRate)
+	return appendInt(b, 5, int64(req.Steps))
+}
+
+func (req *LearnRequest) unmarshalWire(data []byte) error {
+	*req = LearnRequest{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) (err error) {
+		switch num {
+		case 1:
+			var features []byte
+			if features, err = messageValue(typ, value); err == nil {
+				err = req.Features.unmarshalWire(features)
+			}
+		case 2:
+			req.BoardLabels, err = appendFloatsValue(req.BoardLabels, typ, value)
+		case 3:
+			req.ActionsLabels, err = appendFloatsValue(req.ActionsLabels, typ, value)
+		case 4:
+			req.LearningRate, err = floatValue(typ, value)
+		case 5:
+			var v int64
+			v, err = intValue(typ, value)
+			req.Steps = int(v)
+		}
+		return
+	})
+}
+
+func (resp *LearnResponse) marshalWire() []byte {
+	b := appendFloat(nil, 1, resp.Loss.Total)
+	b = appendFloat(b, 2, resp.Loss.Value)
+	b = appendFloat(b, 3, resp.Loss.Policy)
+	b = appendFloat(b, 4, resp.Loss.GradientNorm)
+	return appendFloat(b, 5, resp.Loss.WeightNorm)
+}
+
+func (resp *LearnResponse) unmarshalWire(data []byte) error {
+	*resp = LearnResponse{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, value []byte) (err error) {
+		switch num {
+		case 1:
+			resp.Loss.Total, err = floatValue(typ, value)
+		case 2:
+			resp.Loss.Value, err = floatValue(typ, value)
+		case 3:
+			resp.Loss.Policy, err = floatValue(typ, value)
+		case 4:
+			resp.Loss.GradientNorm, err = floatValue(typ, value)
+		case 5:
+			resp.Loss.WeightNorm, err = floatValue(typ, value)
+		}
+		return
+	})
+}
@@ -0,0 +1,77 @@
+package tensorflow
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	features := FlatFeatures{
+		Version:             3,
+		NumActions:          []int{2, 0, 1},
+		BoardFeatures:       [][]float32{{1, 2}, {3, 4}, {5, 6}},
+		ActionsBoardIndices: []int64{0, 0, 2},
+		ActionsFeatures:     [][]float32{{1}, {2}, {3}},
+		ActionsSourceCenter: [][]float32{{1, -1}, {2, -2}, {3, -3}},
+		ActionsTargetCenter: [][]float32{{4, -4}, {5, -5}, {6, -6}},
+	}
+	for ii := 0; ii < 3; ii++ {
+		var source, target [6][]float32
+		for section := range source {
+			source[section] = []float32{float32(ii), float32(section)}
+			target[section] = []float32{float32(section), float32(ii)}
+		}
+		features.ActionsSourceNeighbourhood = append(features.ActionsSourceNeighbourhood, source)
+		features.ActionsTargetNeighbourhood = append(features.ActionsTargetNeighbourhood, target)
+	}
+
+	for _, test := range []struct{ msg, got wireMessage }{
+		{&ScoreRequest{Features: features}, &ScoreRequest{}},
+		{&ScoreResponse{Scores: []float32{0.5, -1, 0}, ActionProbs: []float32{0.25, 0.75, 1}}, &ScoreResponse{}},
+		{&LearnRequest{Features: features, BoardLabels: []float32{1, 0, -1},
+			ActionsLabels: []float32{0, 1, 1}, LearningRate: 0.01, Steps: 5}, &LearnRequest{}},
+		{&LearnResponse{Loss: LossBreakdown{Total: 3, Value: 1, Policy: 2, GradientNorm: 0.5, WeightNorm: 10}},
+			&LearnResponse{}},
+	} {
+		data, err := wireCodec{}.Marshal(test.msg)
+		if err != nil {
+			t.Fatalf("Failed to marshal %T: %v", test.msg, err)
+		}
+		if err := (wireCodec{}).Unmarshal(data, test.got); err != nil {
+			t.Fatalf("Failed to unmarshal %T: %v", test.msg, err)
+		}
+		if !reflect.DeepEqual(test.got, test.msg) {
+			t.Errorf("Got %+v after the round trip, wanted %+v", test.got, test.msg)
+		}
+	}
+}
+
+func TestWireUnpackedFields(t *testing.T) {
+	// Encoders may send repeated scalars unpacked.
+	var data []byte
+	for _, score := range []float32{1, 2} {
+		data = protowire.AppendTag(data, 1, protowire.Fixed32Type)
+		data = protowire.AppendFixed32(data, math.Float32bits(score))
+	}
+	var resp ScoreResponse
+	if err := resp.unmarshalWire(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Scores, []float32{1, 2}) {
+		t.Errorf("Got scores %v, wanted [1 2]", resp.Scores)
+	}
+}
+
+func TestWireInvalidFeatures(t *testing.T) {
+	// 3 board features can't be split into 2 boards.
+	var data []byte
+	data = appendInts(data, 2, []int64{0, 0})
+	data = appendFloats(data, 3, []float32{1, 2, 3})
+	var ff FlatFeatures
+	if err := ff.unmarshalWire(data); err == nil {
+		t.Errorf("Unmarshalling inconsistent features should have failed")
+	}
+}
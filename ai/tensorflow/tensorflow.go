@@ -31,16 +31,22 @@ package tensorflow
 //      You can convert other protos as needed -- yes, unfortunately I only need config.proto
 //      but had to manually track the dependencies ... :(
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	tfconfig "github.com/tensorflow/tensorflow/tensorflow/go/core/protobuf"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/janpfeifer/hiveGo/ai"
@@ -52,29 +58,134 @@ import (
 // Set this to true to force to use CPU, even when GPU is avaialble.
 var CpuOnly = false
 
+// Set this to true to make TensorFlow use deterministic ops, so that scoring the
+// same boards gives bitwise identical results across runs. It must be set before
+// the sessions are created, and applies to the whole process: the environment
+// variables TensorFlow reads are process-wide, so it is not a player parameter.
+// It is set with the trainer's --tf_deterministic flag.
+//
+// The cost in performance is significant: GPU kernels fall back to slower
+// deterministic implementations (mostly reductions and cuDNN convolutions and
+// their gradients), and each session uses only one intra-op thread, which on CPU
+// can make scoring a few times slower. Results are also only reproducible for
+// the same batch composition, so auto-batching should be disabled.
+var Deterministic = false
+
+// deterministicOnce sets the environment variables for Deterministic only once.
+var deterministicOnce sync.Once
+
 const (
 	INTER_OP_PARALLELISM       = 4
 	INTRA_OP_PARALLELISM       = 4
 	GPU_MEMORY_FRACTION_TO_USE = 0.3
 )
 
-var flag_useLinear = flag.Bool("tf_use_linear", false, "Use linear model to score, effectively doing distillation.")
+var flag_useLinear = flag.Bool("tf_use_linear", false, "Use linear model to score, effectively doing distillation. "+
+	"Default for Scorer.UseLinear, it can be set per player with the tf_use_linear parameter.")
+var flag_linearBlend = flag.Float64("tf_linear_blend", 0,
+	"Blends the linear model score into the TF score, with the given weight w: (1-w)*tfScore + w*linearScore. "+
+		"A weight of 1 is the same as --tf_use_linear. Default for Scorer.LinearBlend, it can be set per "+
+		"player with the tf_linear_blend parameter.")
+var flag_maxConcurrentRuns = flag.Int("tf_max_concurrent_runs", 0,
+	"If > 0, maximum number of evaluations of a TensorFlow model (session runs to score boards) running "+
+		"at the same time, across its session pool. If 0, the size of the session pool is used. It can be "+
+		"set per player with the tf_max_concurrent_runs parameter, see Scorer.SetMaxConcurrentRuns.")
+
+var flag_maxBatchActions = flag.Int("tf_max_batch_actions", 0,
+	"If > 0, auto-batches are also scored once the total number of actions of their boards reaches it, "+
+		"to bound the memory used by boards with many actions. Default for Scorer.MaxBatchActions, it "+
+		"can be set per player with the tf_max_batch_actions parameter.")
+var flag_scoreLimit = flag.Float64("tf_score_limit", 10,
+	"Scores of the model are clamped to [-limit, limit], and infinite scores to the limit. 0 disables the clamping. "+
+		"Default for Scorer.ScoreGuard.")
+var flag_nanScore = flag.Float64("tf_nan_score", 0,
+	"Score that replaces NaN scores returned by the model, which are logged along with their board. "+
+		"Default for Scorer.ScoreGuard.")
+var flag_checkpointStore = flag.String("tf_checkpoint_store", "",
+	"If set, checkpoints are also saved to, and restored from, this store: a local directory, gs://bucket/path "+
+		"(uses gsutil) or s3://bucket/path (uses aws). Models not found in the store are loaded from the local files. "+
+		"Default for Scorer.Store.")
 var flag_learnBatchSize = flag.Int("tf_batch_size", 0,
 	"Batch size when learning: this is the number of boards, not actions. There is usually 100/1 ratio of "+
 		"actions per board. Examples are shuffled before being batched. 0 means no batching.")
 
+// TrainTarget selects which heads of the model are trained by Learn.
+type TrainTarget int
+
+const (
+	TRAIN_BOTH   TrainTarget = iota // Board value and actions policy.
+	TRAIN_VALUE                     // Board value only.
+	TRAIN_POLICY                    // Actions policy only.
+)
+
+var trainTargetNames = map[string]TrainTarget{
+	"both":   TRAIN_BOTH,
+	"value":  TRAIN_VALUE,
+	"policy": TRAIN_POLICY,
+}
+
+func (t TrainTarget) String() string {
+	for name, target := range trainTargetNames {
+		if target == t {
+			return name
+		}
+	}
+	return fmt.Sprintf("TrainTarget(%d)", int(t))
+}
+
+// ParseTrainTarget converts "value", "policy" or "both" to the corresponding TrainTarget.
+func ParseTrainTarget(value string) (TrainTarget, error) {
+	if target, ok := trainTargetNames[value]; ok {
+		return target, nil
+	}
+	return TRAIN_BOTH, fmt.Errorf("Unknown train target %q, valid values are value, policy or both", value)
+}
+
+// Scorer is a TensorFlow model, implementing ai.LearnerScorer.
+//
+// Score and BatchScore can be called concurrently from many goroutines. Learn
+// (and its variants), Save, Restore, Reload and Init can also be called at any time,
+// but they hold learnMu exclusively, so they wait for the scoring in progress
+// and scoring waits for them. The exported configuration fields should be set
+// before the Scorer is used.
 type Scorer struct {
 	Basename    string
 	graph       *tf.Graph
 	sessionPool []*tf.Session
 	sessionTurn int // Rotate among the sessions from the pool.
-	mu          sync.Mutex
+	forceCPU    bool
+
+	// mu protects sessionPool, sessionTurn, autoBatchSize and runSem. sessionPool
+	// is only replaced while also holding learnMu, see restoreFrom.
+	mu sync.Mutex
+
+	// runSem bounds the number of concurrent scoring runs, see
+	// SetMaxConcurrentRuns. runsInFlight and peakRuns are accessed atomically.
+	runSem                 chan struct{}
+	runsInFlight, peakRuns int64
+
+	// learnMu is held (for reading) while running the sessions to score, and
+	// exclusively while running them to change the variables.
+	learnMu sync.RWMutex
+
+	warnTrainOpOnce, warnWeightsOnce sync.Once
+
+	// globalStep counts the calls to Learn over the life of the model, and is
+	// saved with the checkpoint. Accessed atomically.
+	globalStep int64
 
 	// Auto-batching waits for some requests to arrive before actually calling tensorflow.
 	// The idea being to make better CPU/GPU utilization.
 	autoBatchSize int
 	autoBatchChan chan *AutoBatchRequest
 
+	// MaxBatchActions, if > 0, makes auto-batches be scored as soon as the total
+	// number of actions of their boards reaches it, even if they have fewer than
+	// the auto-batch size boards. The memory used by a batch grows with its
+	// actions, and boards have from 1 to ~200 actions. Defaults to
+	// --tf_max_batch_actions.
+	MaxBatchActions int
+
 	BoardFeatures, BoardLabels    tf.Output
 	BoardPredictions, BoardLosses tf.Output
 
@@ -86,24 +197,99 @@ type Scorer struct {
 	LearningRate, CheckpointFile, TotalLoss tf.Output
 	InitOp, TrainOp, SaveOp, RestoreOp      *tf.Operation
 
-	version int // Uses the number of input features used.
+	// Optional train ops that only train the value or the policy heads. Older
+	// graphs may not have them, in which case TrainOp is used instead.
+	TrainValueOp, TrainPolicyOp *tf.Operation
+
+	// Optional diagnostics tensors, nil if the graph doesn't export them.
+	GradientNorm, WeightNorm *tf.Output
+
+	// Optional weights of the loss of each board, see LearnWeighted. Nil if the
+	// graph doesn't support them.
+	BoardWeights *tf.Output
+
+	// Optional unweighted losses of each board, of the value and policy heads, see
+	// LearnWithExamplesLosses. Nil if the graph doesn't export them.
+	BoardExamplesLosses, ActionsExamplesLosses *tf.Output
+
+	// Optional boolean placeholder that enables dropout at inference, see
+	// ScoreWithUncertainty. Nil if the graph doesn't support it.
+	MCDropout *tf.Output
+
+	// TrainTarget selects which heads are trained by Learn. Defaults to TRAIN_BOTH.
+	TrainTarget TrainTarget
+
+	// OnLearnStep, if not nil, is called after each training step of Learn (and
+	// its variants), e.g. to report the progress of a long training.
+	OnLearnStep func()
+
+	// UseLinear rescores the boards with the linear model (ai.TrainedBest),
+	// and LinearBlend is the weight of the linear model score blended into the
+	// TF score. UseLinear is the same as a LinearBlend of 1. They default to
+	// --tf_use_linear and --tf_linear_blend.
+	UseLinear   bool
+	LinearBlend float32
+
+	// ActionFeaturesCache is optional, and saves recomputing the features of
+	// actions of boards seen before, typically during search.
+	ActionFeaturesCache *ai.ActionFeaturesCache
+
+	// ScoreGuard replaces NaN scores and clamps the others, so a misbehaving
+	// model doesn't corrupt the search. Defaults to --tf_score_limit and
+	// --tf_nan_score. If nil, scores are used as returned by the model.
+	ScoreGuard *ai.ScoreGuard
+
+	// FeatureStats, if not nil, normalizes the board features fed to the model.
+	// It is saved with the checkpoint metadata, and it should only be set (e.g.
+	// with FitFeatureStats) for a new model, since the model is trained on the
+	// normalized features. Models saved without it are not normalized.
+	FeatureStats *ai.FeatureStats
+
+	// Store, if not nil, is where checkpoints are shared, e.g. among the workers
+	// of a distributed training: Save also uploads to it, and Restore downloads
+	// from it. Defaults to --tf_checkpoint_store.
+	Store CheckpointStore
+
+	// version of the features used: the number of input features, unless a
+	// subset of the features is used (see SetFeatures).
+	version  int
+	inputDim int // Dimension of the board features input of the model.
+	features ai.FeatureSet
 }
 
 // Data used for parsing of player options.
 type ParsingData struct {
 	UseTensorFlow, ForceCPU bool
 	SessionPoolSize         int
+	TrainTarget             TrainTarget
+	ActionFeaturesCacheSize int
+	UseLinear               bool
+	LinearBlend             float64
+	MaxBatchActions         int
+	MaxConcurrentRuns       int
 }
 
 func NewParsingData() (data interface{}) {
-	return &ParsingData{SessionPoolSize: 1}
+	return &ParsingData{SessionPoolSize: 1, UseLinear: *flag_useLinear, LinearBlend: *flag_linearBlend,
+		MaxBatchActions: *flag_maxBatchActions, MaxConcurrentRuns: *flag_maxConcurrentRuns}
 }
 
 func FinalizeParsing(data interface{}, player *players.SearcherScorerPlayer) {
 	d := data.(*ParsingData)
 	if d.UseTensorFlow {
-		player.Learner = New(player.ModelFile, d.SessionPoolSize, d.ForceCPU)
-		player.Scorer = player.Learner
+		s := New(player.ModelFile, d.SessionPoolSize, d.ForceCPU)
+		s.TrainTarget = d.TrainTarget
+		s.UseLinear = d.UseLinear
+		s.LinearBlend = float32(d.LinearBlend)
+		s.MaxBatchActions = d.MaxBatchActions
+		if d.MaxConcurrentRuns > 0 {
+			s.SetMaxConcurrentRuns(d.MaxConcurrentRuns)
+		}
+		if d.ActionFeaturesCacheSize > 0 {
+			s.ActionFeaturesCache = ai.NewActionFeaturesCache(d.ActionFeaturesCacheSize)
+		}
+		player.Learner = s
+		player.Scorer = s
 	}
 }
 
@@ -122,6 +308,45 @@ func ParseParam(data interface{}, key, value string) {
 		if d.SessionPoolSize < 1 {
 			log.Panicf("Invalid parameter tf_session_pool_size=%s, it must be > 0", value)
 		}
+	} else if key == "tf_action_features_cache" {
+		var err error
+		d.ActionFeaturesCacheSize, err = strconv.Atoi(value)
+		if err != nil || d.ActionFeaturesCacheSize < 0 {
+			log.Panicf("Invalid parameter tf_action_features_cache=%s: %v", value, err)
+		}
+	} else if key == "tf_use_linear" {
+		d.UseLinear = true
+		if value != "" {
+			var err error
+			d.UseLinear, err = strconv.ParseBool(value)
+			if err != nil {
+				log.Panicf("Invalid parameter tf_use_linear=%s: %v", value, err)
+			}
+		}
+	} else if key == "tf_linear_blend" {
+		var err error
+		d.LinearBlend, err = strconv.ParseFloat(value, 64)
+		if err != nil || d.LinearBlend < 0 || d.LinearBlend > 1 {
+			log.Panicf("Invalid parameter tf_linear_blend=%s, it must be a weight between 0 and 1: %v", value, err)
+		}
+	} else if key == "tf_max_batch_actions" {
+		var err error
+		d.MaxBatchActions, err = strconv.Atoi(value)
+		if err != nil || d.MaxBatchActions < 0 {
+			log.Panicf("Invalid parameter tf_max_batch_actions=%s: %v", value, err)
+		}
+	} else if key == "tf_max_concurrent_runs" {
+		var err error
+		d.MaxConcurrentRuns, err = strconv.Atoi(value)
+		if err != nil || d.MaxConcurrentRuns < 1 {
+			log.Panicf("Invalid parameter tf_max_concurrent_runs=%s, it must be > 0: %v", value, err)
+		}
+	} else if key == "tf_train_target" {
+		var err error
+		d.TrainTarget, err = ParseTrainTarget(value)
+		if err != nil {
+			log.Panicf("Invalid parameter tf_train_target=%s: %v", value, err)
+		}
 	} else {
 		log.Panicf("Unknown parameter '%s=%s' passed to tensorflow module.", key, value)
 	}
@@ -131,6 +356,12 @@ func init() {
 	players.RegisterPlayerParameter("tf", "tf", NewParsingData, ParseParam, FinalizeParsing)
 	players.RegisterPlayerParameter("tf", "tf_cpu", NewParsingData, ParseParam, FinalizeParsing)
 	players.RegisterPlayerParameter("tf", "tf_session_pool_size", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("tf", "tf_train_target", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("tf", "tf_action_features_cache", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("tf", "tf_use_linear", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("tf", "tf_linear_blend", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("tf", "tf_max_batch_actions", NewParsingData, ParseParam, FinalizeParsing)
+	players.RegisterPlayerParameter("tf", "tf_max_concurrent_runs", NewParsingData, ParseParam, FinalizeParsing)
 }
 
 var dataTypeMap = map[tf.DataType]string{
@@ -159,17 +390,90 @@ func New(basename string, sessionPoolSize int, forceCPU bool) *Scorer {
 	if err != nil {
 		log.Panicf("Failed to read %q: %v", graphDefFilename, err)
 	}
+	absBasename, err := filepath.Abs(basename)
+	if err != nil {
+		log.Panicf("Unknown absolute path for %s: %v", basename, err)
+	}
+	s := newScorer(graphDef, graphDefFilename, absBasename, sessionPoolSize, forceCPU)
+	if *flag_checkpointStore != "" {
+		s.Store, err = NewCheckpointStore(*flag_checkpointStore)
+		if err != nil {
+			log.Panicf("Failed to open checkpoint store: %v", err)
+		}
+		glog.Infof("Loading model %s from %s", s.StoreName(), *flag_checkpointStore)
+		if err = s.RestoreFrom(s.Store, s.StoreName()); err == nil {
+			go s.autoBatchDispatcher()
+			return s
+		}
+		glog.Warningf("Failed to load model from checkpoint store, using local files: %v", err)
+	}
 
-	// Create the one graph and sessions we will use all time.
-	graph := tf.NewGraph()
+	// Either restore or initialize the network.
+	cpIndex, _ := s.CheckpointFiles()
+	if _, err := os.Stat(cpIndex); err == nil {
+		glog.Infof("Loading model from %s", s.CheckpointBase())
+		err = s.restoreLocal()
+		if err != nil {
+			log.Panicf("Failed to load checkpoint from file %s: %v", s.CheckpointBase(), err)
+		}
+	} else if os.IsNotExist(err) {
+		glog.Infof("Initializing model randomly, since %s not found", s.CheckpointBase())
+		err = s.Init()
+		if err != nil {
+			log.Panicf("Failed to initialize model: %v", err)
+		}
+	} else {
+		log.Panicf("Cannot checkpoint file %s: %v", s.CheckpointBase(), err)
+	}
 
-	if err = graph.Import(graphDef, ""); err != nil {
-		log.Fatal("Invalid GraphDef? read from %s: %v", graphDefFilename, err)
+	go s.autoBatchDispatcher()
+	return s
+}
+
+// NewFromGraphDef creates a new Scorer from a model's graph and checkpoint given
+// as bytes, e.g. embedded in the binary or loaded from a remote storage. The
+// checkpoint is given by the contents of its index and data files. If they are
+// empty the model is initialized randomly.
+//
+// Since TensorFlow can only restore checkpoints from files, they are written to a
+// temporary directory, removed after restoring. The Scorer has no Basename, so to
+// Save it one must set it first.
+func NewFromGraphDef(graphDef, checkpointIndex, checkpointData []byte, sessionPoolSize int, forceCPU bool) *Scorer {
+	s := newScorer(graphDef, "bytes", "", sessionPoolSize, forceCPU)
+	if len(checkpointIndex) == 0 {
+		glog.Infof("Initializing model randomly, since no checkpoint was given")
+		if err := s.Init(); err != nil {
+			log.Panicf("Failed to initialize model: %v", err)
+		}
+	} else {
+		dir, err := ioutil.TempDir("", "hive_tf_checkpoint")
+		if err != nil {
+			log.Panicf("Failed to create temporary directory for checkpoint: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		checkpointBase := filepath.Join(dir, "model.checkpoint")
+		if err = ioutil.WriteFile(checkpointBase+".index", checkpointIndex, 0600); err != nil {
+			log.Panicf("Failed to write checkpoint index to %s: %v", dir, err)
+		}
+		if err = ioutil.WriteFile(checkpointBase+".data-00000-of-00001", checkpointData, 0600); err != nil {
+			log.Panicf("Failed to write checkpoint data to %s: %v", dir, err)
+		}
+		if err = s.restoreFrom(checkpointBase); err != nil {
+			log.Panicf("Failed to load checkpoint from bytes: %v", err)
+		}
 	}
+	go s.autoBatchDispatcher()
+	return s
+}
 
-	absBasename, err := filepath.Abs(basename)
-	if err != nil {
-		log.Panicf("Unknown absolute path for %s: %v", basename, err)
+// newScorer imports the graph and creates the sessions. The model still needs to be
+// restored or initialized. source is only used for error messages.
+func newScorer(graphDef []byte, source, absBasename string, sessionPoolSize int, forceCPU bool) *Scorer {
+	// Create the one graph and sessions we will use all time.
+	graph := tf.NewGraph()
+
+	if err := graph.Import(graphDef, ""); err != nil {
+		log.Panicf("Invalid GraphDef? read from %s: %v", source, err)
 	}
 
 	t0 := func(tensorName string) (to tf.Output) {
@@ -182,13 +486,27 @@ func New(basename string, sessionPoolSize int, forceCPU bool) *Scorer {
 	op := func(tensorName string) *tf.Operation {
 		return graph.Operation(tensorName)
 	}
+	optionalT0 := func(tensorName string) *tf.Output {
+		op := graph.Operation(tensorName)
+		if op == nil {
+			glog.V(1).Infof("Optional tensor [%s] not in graph", tensorName)
+			return nil
+		}
+		output := op.Output(0)
+		return &output
+	}
 
 	s := &Scorer{
 		Basename:      absBasename,
 		graph:         graph,
 		sessionPool:   createSessionPool(graph, sessionPoolSize, forceCPU),
+		forceCPU:      forceCPU,
+		runSem:        make(chan struct{}, sessionPoolSize),
 		autoBatchSize: 1,
 		autoBatchChan: make(chan *AutoBatchRequest),
+		UseLinear:     *flag_useLinear,
+		LinearBlend:   float32(*flag_linearBlend),
+		ScoreGuard:    ai.NewScoreGuard(float32(*flag_scoreLimit), float32(*flag_nanScore)),
 
 		// Board tensors.
 		BoardFeatures:    t0("board_features"),
@@ -217,40 +535,46 @@ func New(basename string, sessionPoolSize int, forceCPU bool) *Scorer {
 		TrainOp:   op("train"),
 		SaveOp:    op("save/control_dependency"),
 		RestoreOp: op("save/restore_all"),
+
+		// Optional ops.
+		TrainValueOp:  op("train_value"),
+		TrainPolicyOp: op("train_policy"),
+		GradientNorm:  optionalT0("gradient_norm"),
+		WeightNorm:    optionalT0("weight_norm"),
+		BoardWeights:  optionalT0("board_weights"),
+		MCDropout:     optionalT0(MC_DROPOUT_TENSOR),
+
+		BoardExamplesLosses:   optionalT0("board_examples_losses"),
+		ActionsExamplesLosses: optionalT0("actions_examples_losses"),
 	}
 
 	// Notice there must be a bug in the library that prevents it from taking
 	// tf.int32.
 	glog.V(2).Infof("ActionsBoardIndices: type=%s", dataType(s.ActionsBoardIndices))
 
-	// Set version to the size of the input.
-	s.version = int(s.BoardFeatures.Shape().Size(1))
-	glog.V(1).Infof("TensorFlow model's version=%d", s.version)
-
-	// Either restore or initialize the network.
-	cpIndex, _ := s.CheckpointFiles()
-	if _, err := os.Stat(cpIndex); err == nil {
-		glog.Infof("Loading model from %s", s.CheckpointBase())
-		err = s.Restore()
-		if err != nil {
-			log.Panicf("Failed to load checkpoint from file %s: %v", s.CheckpointBase(), err)
-		}
-	} else if os.IsNotExist(err) {
-		glog.Infof("Initializing model randomly, since %s not found", s.CheckpointBase())
-		err = s.Init()
-		if err != nil {
-			log.Panicf("Failed to initialize model: %v", err)
-		}
-	} else {
-		log.Panicf("Cannot checkpoint file %s: %v", s.CheckpointBase(), err)
+	for _, warning := range ValidateGraph(graph, s.BoardPredictions, s.ActionsPredictions) {
+		glog.Warningf("Model from %s: %s", source, warning)
 	}
 
-	go s.autoBatchDispatcher()
+	// Set version to the size of the input.
+	s.inputDim = int(s.BoardFeatures.Shape().Size(1))
+	s.version = s.inputDim
+	glog.V(1).Infof("TensorFlow model's version=%d", s.version)
 	return s
 }
 
 func createSessionPool(graph *tf.Graph, size int, forceCPU bool) (sessions []*tf.Session) {
 	gpuMemFractionLeft := GPU_MEMORY_FRACTION_TO_USE
+	intraOpParallelism := int32(INTRA_OP_PARALLELISM)
+	if Deterministic {
+		// Environment variables are read by TensorFlow when the kernels are created.
+		deterministicOnce.Do(func() {
+			glog.Infof("TensorFlow using deterministic ops for the whole process: this is slower.")
+			os.Setenv("TF_DETERMINISTIC_OPS", "1")
+			os.Setenv("TF_CUDNN_DETERMINISTIC", "1")
+		})
+		intraOpParallelism = 1
+	}
 	for ii := 0; ii < size; ii++ {
 		sessionOptions := &tf.SessionOptions{}
 		var config tfconfig.ConfigProto
@@ -266,7 +590,7 @@ func createSessionPool(graph *tf.Graph, size int, forceCPU bool) (sessions []*tf
 			gpuMemFractionLeft -= config.GpuOptions.PerProcessGpuMemoryFraction
 		}
 		config.InterOpParallelismThreads = INTER_OP_PARALLELISM
-		config.IntraOpParallelismThreads = INTRA_OP_PARALLELISM
+		config.IntraOpParallelismThreads = intraOpParallelism
 		data, err := proto.Marshal(&config)
 		if err != nil {
 			log.Panicf("Failed to serialize tf.ConfigProto: %v", err)
@@ -301,33 +625,174 @@ func (s *Scorer) CheckpointBase() string {
 	return fmt.Sprintf("%s.checkpoint", s.Basename)
 }
 
+// checkpointMeta is saved along with the checkpoint, in CheckpointMetaFile.
+type checkpointMeta struct {
+	GlobalStep int64 `json:"global_step"`
+
+	// FeatureStats used to normalize the board features, see Scorer.FeatureStats.
+	FeatureStats *ai.FeatureStats `json:"feature_stats,omitempty"`
+
+	// Features is the subset of the features of FeaturesVersion used, see
+	// Scorer.SetFeatures. If nil all features are used.
+	Features        ai.FeatureSet `json:"features,omitempty"`
+	FeaturesVersion int           `json:"features_version,omitempty"`
+}
+
+// CheckpointMetaFile returns the name of the file with the metadata of the
+// checkpoint, saved along with it.
+func (s *Scorer) CheckpointMetaFile() string {
+	return fmt.Sprintf("%s.checkpoint.meta.json", s.Basename)
+}
+
+// GlobalStep returns the number of calls to Learn (or LearnWithBreakdown) that
+// produced the current model, including those before it was last saved. It
+// identifies the generation of the model.
+func (s *Scorer) GlobalStep() int {
+	return int(atomic.LoadInt64(&s.globalStep))
+}
+
+// readCheckpointMeta reads the metadata file of a checkpoint. found is false if
+// the file doesn't exist, for checkpoints saved before the metadata existed.
+func readCheckpointMeta(metaFile string) (meta checkpointMeta, found bool, err error) {
+	data, err := ioutil.ReadFile(metaFile)
+	if os.IsNotExist(err) {
+		return meta, false, nil
+	}
+	if err != nil {
+		return meta, false, fmt.Errorf("Failed to read checkpoint metadata: %v", err)
+	}
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return meta, false, fmt.Errorf("Failed to parse checkpoint metadata in %s: %v", metaFile, err)
+	}
+	return meta, true, nil
+}
+
+// loadCheckpointMeta reads the metadata saved with the checkpoint. Checkpoints
+// saved before the metadata existed start with GlobalStep 0.
+func (s *Scorer) loadCheckpointMeta(metaFile string) error {
+	meta, found, err := readCheckpointMeta(metaFile)
+	if err != nil {
+		return err
+	}
+	if !found {
+		glog.Warningf("No checkpoint metadata in %s, starting with global step 0", metaFile)
+	}
+	atomic.StoreInt64(&s.globalStep, meta.GlobalStep)
+	if meta.Features != nil {
+		if err = s.SetFeatures(meta.Features, meta.FeaturesVersion); err != nil {
+			return fmt.Errorf("Failed to use the features in %s: %v", metaFile, err)
+		}
+	}
+	if meta.FeatureStats != nil && meta.FeatureStats.Version() != s.inputDim {
+		return fmt.Errorf("Feature stats in %s are for %d features, but model uses %d",
+			metaFile, meta.FeatureStats.Version(), s.inputDim)
+	}
+	s.FeatureStats = meta.FeatureStats
+	return nil
+}
+
 func (s *Scorer) CheckpointFiles() (string, string) {
 	return fmt.Sprintf("%s.checkpoint.index", s.Basename), fmt.Sprintf("%s.checkpoint.data-00000-of-00001", s.Basename)
 
 }
 
+// Restore restores the model from s.Store if set, or from its local checkpoint
+// files otherwise.
 func (s *Scorer) Restore() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for _, sess := range s.sessionPool {
-		t, err := tf.NewTensor(s.CheckpointBase())
+	if s.Store != nil {
+		return s.RestoreFrom(s.Store, s.StoreName())
+	}
+	return s.restoreLocal()
+}
+
+// Reload restores the model from its latest checkpoint (from s.Store if set, or
+// from the local checkpoint files), e.g. one saved since by a trainer in another
+// process, so a long-running server picks it up without restarting. Like
+// Restore, it waits for the scoring in progress, which finishes with the
+// previous weights, and the scoring after it uses the new ones.
+//
+// The feature normalization (FeatureStats) is fixed for the life of a model, so
+// if the new checkpoint normalizes features differently it's not reloaded and an
+// error is returned. Nothing changes if it fails.
+func (s *Scorer) Reload() error {
+	checkpointBase, metaFile := s.CheckpointBase(), s.CheckpointMetaFile()
+	if s.Store != nil {
+		var cleanup func()
+		var err error
+		checkpointBase, cleanup, err = downloadCheckpointToTemp(s.Store, s.StoreName())
 		if err != nil {
-			log.Panicf("Failed to create tensor: %v", err)
-		}
-		feeds := map[tf.Output]*tf.Tensor{
-			s.CheckpointFile: t,
+			return fmt.Errorf("Failed to reload %s: %v", s, err)
 		}
-		_, err = sess.Run(feeds, nil, []*tf.Operation{s.RestoreOp})
-		if err != nil {
-			return err
+		defer cleanup()
+		metaFile = checkpointBase + ".meta.json"
+	}
+	meta, _, err := readCheckpointMeta(metaFile)
+	if err != nil {
+		return fmt.Errorf("Failed to reload %s: %v", s, err)
+	}
+	if !reflect.DeepEqual(meta.FeatureStats, s.FeatureStats) {
+		return fmt.Errorf("Failed to reload %s: new checkpoint has a different feature normalization", s)
+	}
+	if !reflect.DeepEqual(meta.Features, s.features) {
+		return fmt.Errorf("Failed to reload %s: new checkpoint uses different features", s)
+	}
+	if err = s.restoreFrom(checkpointBase); err != nil {
+		return fmt.Errorf("Failed to reload %s: %v", s, err)
+	}
+	atomic.StoreInt64(&s.globalStep, meta.GlobalStep)
+	glog.Infof("Reloaded %s, global step %d", s, meta.GlobalStep)
+	return nil
+}
+
+// restoreLocal restores the model from its local checkpoint files.
+func (s *Scorer) restoreLocal() error {
+	if err := s.restoreFrom(s.CheckpointBase()); err != nil {
+		return err
+	}
+	return s.loadCheckpointMeta(s.CheckpointMetaFile())
+}
+
+// restoreFrom restores the model from the given checkpoint base name. It's
+// restored into a new pool of sessions, which replaces the current one only once
+// all of its sessions are restored: if it fails, the model is left untouched.
+func (s *Scorer) restoreFrom(checkpointBase string) error {
+	t, err := tf.NewTensor(checkpointBase)
+	if err != nil {
+		log.Panicf("Failed to create tensor: %v", err)
+	}
+	feeds := map[tf.Output]*tf.Tensor{
+		s.CheckpointFile: t,
+	}
+	sessions := createSessionPool(s.graph, len(s.sessionPool), s.forceCPU)
+	for ii, sess := range sessions {
+		if _, err = sess.Run(feeds, nil, []*tf.Operation{s.RestoreOp}); err != nil {
+			closeSessions(sessions)
+			return fmt.Errorf("Failed to restore session %d of %d from %s: %v", ii+1, len(sessions), checkpointBase, err)
 		}
 	}
+
+	s.learnMu.Lock()
+	s.mu.Lock()
+	previous := s.sessionPool
+	s.sessionPool, s.sessionTurn = sessions, 0
+	s.mu.Unlock()
+	s.learnMu.Unlock()
+	closeSessions(previous)
 	return nil
 }
 
+// closeSessions closes the given sessions, logging the errors.
+func closeSessions(sessions []*tf.Session) {
+	for _, sess := range sessions {
+		if err := sess.Close(); err != nil {
+			glog.Errorf("Failed to close TensorFlow session: %v", err)
+		}
+	}
+}
+
 func (s *Scorer) Init() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.learnMu.Lock()
+	defer s.learnMu.Unlock()
 	for _, sess := range s.sessionPool {
 		_, err := sess.Run(nil, nil, []*tf.Operation{s.InitOp})
 		if err != nil {
@@ -341,16 +806,152 @@ func (s *Scorer) Version() int {
 	return s.version
 }
 
+// Features returns the subset of the features used by the model, or nil if it
+// uses all the features of its version.
+func (s *Scorer) Features() ai.FeatureSet {
+	return s.features
+}
+
+// SetFeatures sets the subset of the features of the given version that the
+// model uses, see ai.FeatureVectorSubset. The model must have been built with
+// fs.Dim(version) input features (see build_model.py --board_features_dim). It
+// is saved with the checkpoint metadata, and it should only be set for a new
+// model, since the model is trained on those features.
+func (s *Scorer) SetFeatures(fs ai.FeatureSet, version int) error {
+	if dim := fs.Dim(version); dim != s.inputDim {
+		return fmt.Errorf("Features %s of version %d have dimension %d, but model has %d input features",
+			fs, version, dim, s.inputDim)
+	}
+	s.features, s.version = fs, version
+	return nil
+}
+
+// FeatureVector returns the (not normalized) features of the board used by the
+// model.
+func (s *Scorer) FeatureVector(b *Board) []float32 {
+	return ai.FeatureVectorSubset(b, s.version, s.features)
+}
+
 func (s *Scorer) Score(b *Board) (score float32, actionProbs []float32) {
-	if s.autoBatchSize > 0 {
+	if s.batchSize() > 0 {
 		// Use auto-batching
-		return s.scoreAutoBatch(b)
+		var err error
+		score, actionProbs, err = s.scoreAutoBatch(b)
+		if err != nil {
+			log.Panicf("Auto-batch scoring failed: %v", err)
+		}
+		return
 	}
 	boards := []*Board{b}
 	scores, actionProbsBatch := s.BatchScore(boards)
 	return scores[0], actionProbsBatch[0]
 }
 
+// ScoreWithTemperature is like Score, but the actions probabilities are tempered
+// with the given temperature (see ai.TemperedPolicy), e.g. to control the
+// sharpness of the MCTS priors. The score is not changed, and with temperature=1
+// it is the same as Score.
+func (s *Scorer) ScoreWithTemperature(b *Board, temperature float32) (score float32, actionProbs []float32) {
+	score, actionProbs = s.Score(b)
+	return score, ai.TemperedPolicy(actionProbs, float64(temperature))
+}
+
+const (
+	// WARMUP_WINDOW is the number of scores over which Warmup averages latencies.
+	WARMUP_WINDOW = 5
+
+	// WARMUP_TOLERANCE is the relative change of the average latency between
+	// windows under which Warmup considers it stable.
+	WARMUP_TOLERANCE = 0.1
+
+	// WARMUP_MAX_MOVES is the maximum number of random moves of the boards scored by Warmup.
+	WARMUP_MAX_MOVES = 60
+)
+
+// Warmup scores up to n random legal boards, one at a time, so TensorFlow
+// allocates its resources and compiles its kernels, and the caches are populated,
+// before real traffic arrives. It returns earlier if the average latency over
+// WARMUP_WINDOW scores stabilizes (changes less than WARMUP_TOLERANCE). It
+// returns the latency of the first (cold) score and the average latency of the
+// last window.
+func (s *Scorer) Warmup(n int) (cold, warm time.Duration) {
+	if n <= 0 {
+		return
+	}
+	boards := ai.RandomBoards(n, WARMUP_MAX_MOVES, rand.New(rand.NewSource(1)))
+	var windowSum, previousWindow time.Duration
+	numInWindow := 0
+	for ii, board := range boards {
+		start := time.Now()
+		s.Score(board)
+		elapsed := time.Since(start)
+		if ii == 0 {
+			cold, warm = elapsed, elapsed
+			continue
+		}
+		windowSum += elapsed
+		numInWindow++
+		if numInWindow < WARMUP_WINDOW {
+			continue
+		}
+		warm = windowSum / WARMUP_WINDOW
+		if previousWindow > 0 && math.Abs(float64(warm-previousWindow)) < WARMUP_TOLERANCE*float64(previousWindow) {
+			glog.V(1).Infof("%s warmed up after %d boards: cold latency %s, warm latency %s", s, ii+1, cold, warm)
+			return
+		}
+		previousWindow, windowSum, numInWindow = warm, 0, 0
+	}
+	glog.V(1).Infof("%s warmed up with %d boards: cold latency %s, warm latency %s", s, len(boards), cold, warm)
+	return
+}
+
+// ScoreWithUncertainty estimates the uncertainty of the model on the board with
+// MC-dropout: it scores the board samples times with dropout enabled, and returns
+// the mean and standard deviation of the scores. If the graph has no dropout
+// (see MCDropout) or samples < 2, it returns the score of the board and a
+// standard deviation of 0.
+func (s *Scorer) ScoreWithUncertainty(b *Board, samples int) (mean float32, stddev float32) {
+	if s.MCDropout == nil || samples < 2 {
+		mean, _ = s.Score(b)
+		return mean, 0
+	}
+
+	// Dropout is sampled independently for each board of the batch.
+	boards := make([]*Board, samples)
+	for ii := range boards {
+		boards[ii] = b
+	}
+	fc := s.buildFeatures(boards)
+	feeds := s.buildFeeds(fc)
+	feeds[*s.MCDropout] = mustTensor(true)
+	results, err := s.runScoring(feeds, []tf.Output{s.BoardPredictions})
+	if err != nil {
+		log.Panicf("Prediction failed: %v", err)
+	}
+	scores := results[0].Value().([]float32)
+	if len(scores) != samples {
+		log.Panicf("Expected %d scores (=number of samples), got %d", samples, len(scores))
+	}
+	if w := s.linearBlendWeight(); w != 0 {
+		for ii := range scores {
+			scores[ii] = s.blendLinearScore(scores[ii], b, fc.boardFeatures[0], w)
+		}
+	}
+	s.ScoreGuard.Guard(scores, nil)
+	var sum, sumSquares float64
+	for _, score := range scores {
+		sum += float64(score)
+		sumSquares += float64(score) * float64(score)
+	}
+	meanF64 := sum / float64(samples)
+	variance := sumSquares/float64(samples) - meanF64*meanF64
+	if variance < 0 {
+		// Rounding errors.
+		variance = 0
+	}
+	return float32(meanF64), float32(math.Sqrt(variance))
+}
+
 // Quick utility to create a tensor out of value. Dies if there is an error.
 func mustTensor(value interface{}) *tf.Tensor {
 	tensor, err := tf.NewTensor(value)
@@ -365,28 +966,39 @@ func mustTensor(value interface{}) *tf.Tensor {
 type flatFeaturesCollection struct {
 	boardFeatures              [][]float32
 	actionsBoardIndices        []int64 // Go tensorflow implementation is broken for int32.
-	actionsFeatures            [][1]float32
+	actionsFeatures            [][]float32
 	actionsSourceCenter        [][]float32
 	actionsSourceNeighbourhood [][6][]float32
 	actionsTargetCenter        [][]float32
 	actionsTargetNeighbourhood [][6][]float32
 	totalNumActions            int
 
+	// Number of actions of each board.
+	numActions []int
+
 	// Labels
 	boardLabels   []float32
 	actionsLabels []float32
 }
 
 func (s *Scorer) buildFeatures(boards []*Board) (fc *flatFeaturesCollection) {
-	fc = &flatFeaturesCollection{}
-	for _, board := range boards {
-		fc.totalNumActions += board.NumActions()
+	return buildFlatFeatures(boards, s.version, s.features, s.ActionFeaturesCache)
+}
+
+// buildFlatFeatures builds the features of the boards for the given version and
+// subset (nil for all) of the features. cache is optional.
+func buildFlatFeatures(boards []*Board, version int, features ai.FeatureSet, cache *ai.ActionFeaturesCache) (
+	fc *flatFeaturesCollection) {
+	fc = &flatFeaturesCollection{numActions: make([]int, len(boards))}
+	for ii, board := range boards {
+		fc.numActions[ii] = board.NumActions()
+		fc.totalNumActions += fc.numActions[ii]
 	}
 
 	// Initialize Go objects, that need to be copied to tensors.
 	fc.boardFeatures = make([][]float32, len(boards))
 	fc.actionsBoardIndices = make([]int64, 0, fc.totalNumActions) // Go tensorflow implementation is broken for int32.
-	fc.actionsFeatures = make([][1]float32, 0, fc.totalNumActions)
+	fc.actionsFeatures = make([][]float32, 0, fc.totalNumActions)
 	fc.actionsSourceCenter = make([][]float32, 0, fc.totalNumActions)
 	fc.actionsSourceNeighbourhood = make([][6][]float32, 0, fc.totalNumActions)
 	fc.actionsTargetCenter = make([][]float32, 0, fc.totalNumActions)
@@ -394,11 +1006,10 @@ func (s *Scorer) buildFeatures(boards []*Board) (fc *flatFeaturesCollection) {
 
 	// Generate features in Go slices.
 	for boardIdx, board := range boards {
-		fc.boardFeatures[boardIdx] = ai.FeatureVector(board, s.version)
-		for _, action := range board.Derived.Actions {
-			af := ai.NewActionFeatures(board, action, s.version)
+		fc.boardFeatures[boardIdx] = ai.FeatureVectorSubset(board, version, features)
+		for _, af := range cache.BoardActionsFeatures(board, version) {
 			fc.actionsBoardIndices = append(fc.actionsBoardIndices, int64(boardIdx))
-			fc.actionsFeatures = append(fc.actionsFeatures, [1]float32{af.Move})
+			fc.actionsFeatures = append(fc.actionsFeatures, af.Context(version))
 			fc.actionsSourceCenter = append(fc.actionsSourceCenter, af.SourceFeatures.Center)
 			fc.actionsSourceNeighbourhood = append(fc.actionsSourceNeighbourhood,
 				af.SourceFeatures.Sections)
@@ -415,7 +1026,7 @@ func (s *Scorer) buildFeatures(boards []*Board) (fc *flatFeaturesCollection) {
 func (s *Scorer) buildFeeds(fc *flatFeaturesCollection) (feeds map[tf.Output]*tf.Tensor) {
 	// Convert Go slices to tensors.
 	return map[tf.Output]*tf.Tensor{
-		s.BoardFeatures:              mustTensor(fc.boardFeatures),
+		s.BoardFeatures:              mustTensor(s.normalizeBoardFeatures(fc.boardFeatures)),
 		s.ActionsBoardIndices:        mustTensor(fc.actionsBoardIndices),
 		s.ActionsFeatures:            mustTensor(fc.actionsFeatures),
 		s.ActionsSourceCenter:        mustTensor(fc.actionsSourceCenter),
@@ -425,13 +1036,73 @@ func (s *Scorer) buildFeeds(fc *flatFeaturesCollection) (feeds map[tf.Output]*tf
 	}
 }
 
+// normalizeBoardFeatures returns the board features normalized with
+// s.FeatureStats, to be fed to the model. The features are kept raw elsewhere,
+// since the linear model (see LinearBlend) and the ScorerService clients use
+// them unnormalized.
+func (s *Scorer) normalizeBoardFeatures(boardFeatures [][]float32) [][]float32 {
+	if s.FeatureStats == nil {
+		return boardFeatures
+	}
+	normalized := make([][]float32, len(boardFeatures))
+	for ii, f := range boardFeatures {
+		normalized[ii] = s.FeatureStats.NormalizeFeatures(f, s.inputDim)
+	}
+	return normalized
+}
+
+// linearBlendWeight returns the weight of the linear model score blended into
+// the TF score: LinearBlend, or 1 if UseLinear is set.
+func (s *Scorer) linearBlendWeight() float32 {
+	if s.UseLinear {
+		return 1
+	}
+	return s.LinearBlend
+}
+
+// featuresMatchLinear returns whether the board features of the model are those
+// of the linear model (ai.TrainedBest), so they can be reused to score with it.
+func (s *Scorer) featuresMatchLinear() bool {
+	return s.version == ai.TrainedBest.Version() && s.features == nil
+}
+
+// blendLinearScore returns (1-w)*tfScore + w*linearScore, where linearScore is
+// the score of the linear model (ai.TrainedBest) for the board. The board
+// features of the model are reused if they match the linear model's ones,
+// otherwise the features of the linear model's version are built from the board.
+func (s *Scorer) blendLinearScore(tfScore float32, board *Board, boardFeatures []float32, w float32) float32 {
+	var linearScore float32
+	if s.featuresMatchLinear() {
+		linearScore = ai.TrainedBest.ScoreFeatures(boardFeatures)
+	} else {
+		if board == nil {
+			log.Panicf("Model features (version %d) don't match the linear model's (version %d), "+
+				"and no board given to blend the linear score", s.version, ai.TrainedBest.Version())
+		}
+		linearScore, _ = ai.TrainedBest.Score(board)
+	}
+	if w == 1 {
+		return linearScore
+	}
+	return (1-w)*tfScore + w*linearScore
+}
+
 func (s *Scorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch [][]float32) {
 	if len(boards) == 0 {
 		log.Panicf("Received empty list of boards to score.")
 	}
 
+	return s.scoreFlatFeatures(s.buildFeatures(boards), boards)
+}
+
+// scoreFlatFeatures is the implementation of BatchScore, once the features of the
+// boards are built. boards are used to log invalid scores and to blend the linear
+// model score, and can be nil if the features match the linear model's ones.
+func (s *Scorer) scoreFlatFeatures(fc *flatFeaturesCollection, boards []*Board) (
+	scores []float32, actionProbsBatch [][]float32) {
+	numBoards := len(fc.numActions)
+
 	// Build feeds to TF model.
-	fc := s.buildFeatures(boards)
 	feeds := s.buildFeeds(fc)
 	fetches := []tf.Output{s.BoardPredictions}
 	if fc.totalNumActions > 0 {
@@ -446,26 +1117,30 @@ func (s *Scorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch
 		}
 	}
 
-	sess := s.NextSession()
-	results, err := sess.Run(feeds, fetches, nil)
+	results, err := s.runScoring(feeds, fetches)
 	if err != nil {
 		log.Panicf("Prediction failed: %v", err)
 	}
 
 	// Copy over resulting tensors.
 	scores = results[0].Value().([]float32)
-	if len(scores) != len(boards) {
+	if len(scores) != numBoards {
 		log.Panicf("Expected %d scores (=number of boards given), got %d",
-			len(boards), len(scores))
+			numBoards, len(scores))
 	}
-	if *flag_useLinear {
-		glog.V(2).Infof("Rescoring with linear model.")
+	if w := s.linearBlendWeight(); w != 0 {
+		glog.V(2).Infof("Rescoring with linear model (weight %g).", w)
 		for ii := 0; ii < len(scores); ii++ {
-			scores[ii] = ai.TrainedBest.ScoreFeatures(fc.boardFeatures[ii])
+			var board *Board
+			if boards != nil {
+				board = boards[ii]
+			}
+			scores[ii] = s.blendLinearScore(scores[ii], board, fc.boardFeatures[ii], w)
 		}
 	}
+	s.ScoreGuard.Guard(scores, boards)
 
-	actionProbsBatch = make([][]float32, len(boards))
+	actionProbsBatch = make([][]float32, numBoards)
 	if fc.totalNumActions > 0 {
 		allActionsProbs := results[1].Value().([]float32)
 		if len(allActionsProbs) != fc.totalNumActions {
@@ -474,71 +1149,320 @@ func (s *Scorer) BatchScore(boards []*Board) (scores []float32, actionProbsBatch
 		}
 		if len(allActionsProbs) != fc.totalNumActions {
 			log.Panicf("Expected %d actions (from %d boards), got %d",
-				fc.totalNumActions, len(boards), len(allActionsProbs))
+				fc.totalNumActions, numBoards, len(allActionsProbs))
 		}
-		for boardIdx, board := range boards {
-			actionProbsBatch[boardIdx] = allActionsProbs[:board.NumActions()]
-			allActionsProbs = allActionsProbs[len(board.Derived.Actions):]
-			if len(actionProbsBatch[boardIdx]) != board.NumActions() {
+		for boardIdx, numActions := range fc.numActions {
+			actionProbsBatch[boardIdx] = allActionsProbs[:numActions]
+			allActionsProbs = allActionsProbs[numActions:]
+			if len(actionProbsBatch[boardIdx]) != numActions {
 				log.Panicf("Got %d probabilities for %d actions!?", len(actionProbsBatch[boardIdx]),
-					board.NumActions())
+					numActions)
 			}
 		}
 	}
 	return
 }
 
-func (s *Scorer) learnOneBatch(batch *flatFeaturesCollection)
+// SetMaxConcurrentRuns sets the maximum number of scoring runs of the sessions
+// (in BatchScore, auto-batching, etc.) at the same time, across the session pool,
+// to bound the load on the hardware regardless of the parallelism of the search.
+// It defaults to --tf_max_concurrent_runs, or the size of the session pool. Runs
+// already waiting keep the previous limit.
+func (s *Scorer) SetMaxConcurrentRuns(n int) {
+	if n < 1 {
+		log.Panicf("Invalid maximum of concurrent runs %d, it must be > 0", n)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runSem = make(chan struct{}, n)
+}
+
+// PeakConcurrentRuns returns the maximum number of scoring runs of the sessions
+// seen at the same time, see SetMaxConcurrentRuns.
+func (s *Scorer) PeakConcurrentRuns() int {
+	return int(atomic.LoadInt64(&s.peakRuns))
+}
+
+// runScoring runs the next session of the pool, to fetch values that don't
+// change the variables of the model. It can run concurrently with other
+// scoring (up to SetMaxConcurrentRuns), but not with learning.
+func (s *Scorer) runScoring(feeds map[tf.Output]*tf.Tensor, fetches []tf.Output) ([]*tf.Tensor, error) {
+	s.mu.Lock()
+	sem := s.runSem
+	s.mu.Unlock()
+	sem <- struct{}{}
+	defer func() { <-sem }()
+
+	inFlight := atomic.AddInt64(&s.runsInFlight, 1)
+	defer atomic.AddInt64(&s.runsInFlight, -1)
+	for peak := atomic.LoadInt64(&s.peakRuns); inFlight > peak; peak = atomic.LoadInt64(&s.peakRuns) {
+		if atomic.CompareAndSwapInt64(&s.peakRuns, peak, inFlight) {
+			break
+		}
+	}
+
+	s.learnMu.RLock()
+	defer s.learnMu.RUnlock()
+	return s.NextSession().Run(feeds, fetches, nil)
+}
+
+// trainOp returns the train op for the current TrainTarget, and whether it is the
+// combined TrainOp, which requires both value and policy labels.
+func (s *Scorer) trainOp() (op *tf.Operation, combined bool) {
+	switch s.TrainTarget {
+	case TRAIN_VALUE:
+		op = s.TrainValueOp
+	case TRAIN_POLICY:
+		op = s.TrainPolicyOp
+	}
+	if op != nil {
+		return op, false
+	}
+	if s.TrainTarget != TRAIN_BOTH {
+		s.warnTrainOpOnce.Do(func() {
+			glog.Warningf("Model %s has no train op for target %s, training value and policy together instead",
+				s.Basename, s.TrainTarget)
+		})
+	}
+	return s.TrainOp, true
+}
 
 func (s *Scorer) Learn(boards []*Board, boardLabels []float32, actionsLabels [][]float32, learningRate float32, steps int) (loss float32) {
-	if len(s.sessionPool) > 1 {
-		log.Panicf("SessionPool doesn't support saving. You probably should use sessionPoolSize=1 in this case.")
+	return s.LearnWithBreakdown(boards, boardLabels, actionsLabels, learningRate, steps).Total
+}
+
+// LossBreakdown holds the losses after a call to LearnWithBreakdown, along with
+// diagnostics of the training. Losses are normalized by the number of boards.
+// Values that are not available (the head is not being trained, or the graph
+// doesn't export them) are set to -1.
+type LossBreakdown struct {
+	Total, Value, Policy float32
+
+	// GradientNorm is the global norm of the gradients of the total loss, at the
+	// last training step. Spikes usually indicate a learning rate too high.
+	GradientNorm float32
+
+	// WeightNorm is the global norm of all trainable variables, after training.
+	WeightNorm float32
+}
+
+func (lb LossBreakdown) String() string {
+	return fmt.Sprintf("loss=%.4f (value=%.4f, policy=%.4f), gradient norm=%.4g, weight norm=%.4g",
+		lb.Total, lb.Value, lb.Policy, lb.GradientNorm, lb.WeightNorm)
+}
+
+// LearnWithBreakdown is like Learn, but returns the losses of each head and
+// the gradient and weight norms.
+func (s *Scorer) LearnWithBreakdown(boards []*Board, boardLabels []float32, actionsLabels [][]float32, learningRate float32, steps int) (lb LossBreakdown) {
+	return s.LearnWeighted(boards, boardLabels, actionsLabels, nil, learningRate, steps)
+}
+
+// LearnWeighted is like LearnWithBreakdown, but the loss of each board (and of
+// its actions) is multiplied by the corresponding weight, e.g. to weight
+// differently examples from different sources. weights can be nil, meaning all
+// weights are 1.
+//
+// If the graph doesn't support weights (no board_weights tensor), they are
+// ignored with a warning.
+func (s *Scorer) LearnWeighted(boards []*Board, boardLabels []float32, actionsLabels [][]float32, weights []float32,
+	learningRate float32, steps int) (lb LossBreakdown) {
+	if len(boards) == 0 {
+		log.Panicf("Received empty list of boards to learn.")
 	}
-	fc := s.buildFeatures(boards)
-	fc.boardLabels = boardLabels
-	fc.actionsLabels = actionsLabels
+	if weights != nil && len(weights) != len(boards) {
+		log.Panicf("Received %d weights for %d boards", len(weights), len(boards))
+	}
+	return s.learnFlatFeatures(s.buildFeatures(boards), boardLabels, actionsLabels, weights, learningRate, steps,
+		nil)
+}
 
-	feeds := s.buildFeeds(fc)
+// HasExamplesLosses returns whether the graph exports the losses of each board,
+// required by LearnWithExamplesLosses. Graphs built by older versions of
+// build_model.py don't.
+func (s *Scorer) HasExamplesLosses() bool {
+	return s.BoardExamplesLosses != nil && s.ActionsExamplesLosses != nil
+}
+
+// LearnWithExamplesLosses implements ai.ExamplesLossesLearner, e.g. for
+// prioritized replay. The loss of each board is the (unweighted) loss of the
+// heads trained (see TrainTarget), after training. It panics if the graph
+// doesn't support it, see HasExamplesLosses.
+func (s *Scorer) LearnWithExamplesLosses(boards []*Board, boardLabels []float32, actionsLabels [][]float32,
+	weights []float32, learningRate float32, steps int) (loss float32, examplesLosses []float32) {
+	if !s.HasExamplesLosses() {
+		log.Panicf("Model %s doesn't export the losses of each board, rebuild its graph with build_model.py",
+			s.Basename)
+	}
 	if len(boards) == 0 {
 		log.Panicf("Received empty list of boards to learn.")
 	}
+	if weights != nil && len(weights) != len(boards) {
+		log.Panicf("Received %d weights for %d boards", len(weights), len(boards))
+	}
+	examplesLosses = make([]float32, len(boards))
+	lb := s.learnFlatFeatures(s.buildFeatures(boards), boardLabels, actionsLabels, weights, learningRate, steps,
+		examplesLosses)
+	return lb.Total, examplesLosses
+}
 
-	// Feed also the labels.
-	actionsSparseLabels := make([]float32, 0, fc.totalNumActions)
-	for ii, labels := range actionsLabels {
-		if len(labels) > 0 {
-			if len(labels) != boards[ii].NumActions() {
-				log.Panicf("%d actionsLabeles given to board, but there are %d actions", len(labels), boards[ii].NumActions())
-			}
-			actionsSparseLabels = append(actionsSparseLabels, labels...)
+// Loss returns the losses of the model on the given boards and labels, without
+// training it. E.g. to evaluate the model on a validation set. Unlike Learn, it
+// works with a pool of sessions.
+func (s *Scorer) Loss(boards []*Board, boardLabels []float32, actionsLabels [][]float32) LossBreakdown {
+	if len(boards) == 0 {
+		log.Panicf("Received empty list of boards to evaluate.")
+	}
+	return s.learnFlatFeatures(s.buildFeatures(boards), boardLabels, actionsLabels, nil, 0, 0, nil)
+}
+
+// learnFlatFeatures is the implementation of LearnWeighted, once the features
+// of the boards are built. With steps == 0 it only evaluates the losses. If
+// examplesLosses is not nil, it is filled with the loss of each board, see
+// LearnWithExamplesLosses.
+func (s *Scorer) learnFlatFeatures(fc *flatFeaturesCollection, boardLabels []float32, actionsLabels [][]float32,
+	weights []float32, learningRate float32, steps int, examplesLosses []float32) (lb LossBreakdown) {
+	// Training would only change the variables of one of the sessions. Evaluating
+	// the losses can use any of them, since they hold the same variables.
+	var sess *tf.Session
+	if steps > 0 {
+		if len(s.sessionPool) > 1 {
+			log.Panicf("SessionPool doesn't support learning. You probably should use sessionPoolSize=1 in this case.")
 		}
+		sess = s.sessionPool[0]
+	} else {
+		sess = s.NextSession()
+	}
+	numBoards := len(fc.numActions)
+	fc.boardLabels = boardLabels
+	feeds := s.buildFeeds(fc)
+	s.learnMu.Lock()
+	defer s.learnMu.Unlock()
+	if steps > 0 {
+		defer atomic.AddInt64(&s.globalStep, 1)
 	}
-	if len(actionsSparseLabels) != fc.totalNumActions {
-		log.Panicf("Expected %d actions labels in total, got %d", fc.totalNumActions, len(actionsSparseLabels))
+
+	// Feed only the labels used by the train op.
+	trainOp, combined := s.trainOp()
+	feedValue := combined || s.TrainTarget != TRAIN_POLICY
+	feedPolicy := combined || s.TrainTarget != TRAIN_VALUE
+	if feedValue {
+		feeds[s.BoardLabels] = mustTensor(boardLabels)
+	}
+	if feedPolicy {
+		actionsSparseLabels := make([]float32, 0, fc.totalNumActions)
+		for ii, labels := range actionsLabels {
+			if len(labels) > 0 {
+				if len(labels) != fc.numActions[ii] {
+					log.Panicf("%d actionsLabeles given to board, but there are %d actions", len(labels), fc.numActions[ii])
+				}
+				actionsSparseLabels = append(actionsSparseLabels, labels...)
+			}
+		}
+		if len(actionsSparseLabels) != fc.totalNumActions {
+			log.Panicf("Expected %d actions labels in total, got %d", fc.totalNumActions, len(actionsSparseLabels))
+		}
+		feeds[s.ActionsLabels] = mustTensor(actionsSparseLabels)
 	}
-	feeds[s.BoardLabels] = mustTensor(boardLabels)
-	feeds[s.ActionsLabels] = mustTensor(actionsSparseLabels)
 	feeds[s.LearningRate] = mustTensor(learningRate)
+	if weights != nil {
+		if s.BoardWeights != nil {
+			feeds[*s.BoardWeights] = mustTensor(weights)
+		} else {
+			s.warnWeightsOnce.Do(func() {
+				glog.Warningf("Model %s has no board_weights tensor, examples weights are ignored", s.Basename)
+			})
+		}
+	}
 
-	// Loop over steps.
+	// Loop over steps. The gradient norm (of the total loss, so it requires all
+	// labels) is fetched along with the last step.
+	lb = LossBreakdown{Total: -1, Value: -1, Policy: -1, GradientNorm: -1, WeightNorm: -1}
+	var gradientFetches []tf.Output
+	if s.GradientNorm != nil && feedValue && feedPolicy {
+		gradientFetches = []tf.Output{*s.GradientNorm}
+	}
 	for step := 0; step < steps; step++ {
-		if _, err := s.sessionPool[0].Run(feeds, nil, []*tf.Operation{s.TrainOp}); err != nil {
+		var fetches []tf.Output
+		if step == steps-1 {
+			fetches = gradientFetches
+		}
+		results, err := sess.Run(feeds, fetches, []*tf.Operation{trainOp})
+		if err != nil {
 			log.Panicf("TensorFlow trainOp failed: %v", err)
 		}
+		if len(fetches) > 0 {
+			lb.GradientNorm = results[0].Value().(float32)
+		}
+		if s.OnLearnStep != nil {
+			s.OnLearnStep()
+		}
 	}
 
-	fetches := []tf.Output{s.TotalLoss}
-	results, err := s.sessionPool[0].Run(feeds, fetches, nil)
+	// Fetch the losses of what was trained, and the weight norm. Board and actions
+	// losses are summed over the batch, so they are normalized as mean_loss is.
+	var fetches []tf.Output
+	var targets []*float32
+	if feedValue && feedPolicy {
+		fetches = append(fetches, s.TotalLoss)
+		targets = append(targets, &lb.Total)
+	}
+	if feedValue {
+		fetches = append(fetches, s.BoardLosses)
+		targets = append(targets, &lb.Value)
+	}
+	if feedPolicy {
+		fetches = append(fetches, s.ActionsLosses)
+		targets = append(targets, &lb.Policy)
+	}
+	if s.WeightNorm != nil {
+		fetches = append(fetches, *s.WeightNorm)
+		targets = append(targets, &lb.WeightNorm)
+	}
+	var examplesFetches []tf.Output
+	if examplesLosses != nil {
+		if feedValue {
+			examplesFetches = append(examplesFetches, *s.BoardExamplesLosses)
+		}
+		if feedPolicy {
+			examplesFetches = append(examplesFetches, *s.ActionsExamplesLosses)
+		}
+	}
+	results, err := sess.Run(feeds, append(fetches, examplesFetches...), nil)
 	if err != nil {
 		log.Panicf("Loss evaluation failed: %v", err)
 	}
-	return results[0].Value().(float32)
+	for ii, target := range targets {
+		*target = results[ii].Value().(float32)
+	}
+	for _, result := range results[len(targets):] {
+		for ii, loss := range result.Value().([]float32) {
+			examplesLosses[ii] += loss
+		}
+	}
+	if feedValue {
+		lb.Value /= float32(numBoards)
+	}
+	if feedPolicy {
+		lb.Policy /= float32(numBoards)
+	}
+	if lb.Total < 0 {
+		// Only one head trained.
+		if feedValue {
+			lb.Total = lb.Value
+		} else {
+			lb.Total = lb.Policy
+		}
+	}
+	return
 }
 
 func (s *Scorer) Save() {
 	if len(s.sessionPool) > 1 {
 		log.Panicf("SessionPool doesn't support saving. You probably should use sessionPoolSize=1 in this case.")
 	}
+	if s.Basename == "" {
+		log.Panicf("Model has no Basename to save to: set it before saving a model created from bytes.")
+	}
 
 	// Backup previous checkpoint.
 	index, data := s.CheckpointFiles()
@@ -550,20 +1474,105 @@ func (s *Scorer) Save() {
 			glog.Errorf("Failed to backup %s to %s~: %v", data, data, err)
 		}
 	}
+	metaFile := s.CheckpointMetaFile()
+	if _, err := os.Stat(metaFile); err == nil {
+		if err := os.Rename(metaFile, metaFile+"~"); err != nil {
+			glog.Errorf("Failed to backup %s to %s~: %v", metaFile, metaFile, err)
+		}
+	}
+
+	if err := s.writeCheckpoint(s.CheckpointBase()); err != nil {
+		log.Panicf("%v", err)
+	}
+	if s.Store != nil {
+		if err := uploadCheckpoint(s.Store, s.StoreName(), s.CheckpointBase()); err != nil {
+			log.Panicf("%v", err)
+		}
+	}
+}
 
-	t, err := tf.NewTensor(s.CheckpointBase())
+// writeCheckpoint saves the model, and its metadata, to the given checkpoint
+// base name.
+func (s *Scorer) writeCheckpoint(checkpointBase string) error {
+	t, err := tf.NewTensor(checkpointBase)
 	if err != nil {
 		log.Panicf("Failed to create tensor: %v", err)
 	}
 	feeds := map[tf.Output]*tf.Tensor{s.CheckpointFile: t}
-	if _, err := s.sessionPool[0].Run(feeds, nil, []*tf.Operation{s.SaveOp}); err != nil {
-		log.Panicf("Failed to checkpoint (save) file to %s: %v", s.CheckpointBase(), err)
+	s.learnMu.Lock()
+	_, err = s.sessionPool[0].Run(feeds, nil, []*tf.Operation{s.SaveOp})
+	s.learnMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("Failed to checkpoint (save) file to %s: %v", checkpointBase, err)
+	}
+	meta := checkpointMeta{GlobalStep: int64(s.GlobalStep()), FeatureStats: s.FeatureStats}
+	if s.features != nil {
+		meta.Features, meta.FeaturesVersion = s.features, s.version
 	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("Failed to encode checkpoint metadata: %v", err)
+	}
+	if err = ioutil.WriteFile(checkpointBase+".meta.json", metaJSON, 0644); err != nil {
+		return fmt.Errorf("Failed to write checkpoint metadata to %s.meta.json: %v", checkpointBase, err)
+	}
+	return nil
+}
+
+// DumpVariables fetches the current values of the model's variables, flattened
+// and keyed by the variables names. It allows inspecting the learned weights,
+// e.g. for dead or exploding layers, without a round-trip to Python. It is
+// expensive, since all the weights are copied out of the session.
+//
+// Only float32 variables are returned, which excludes the global step.
+func (s *Scorer) DumpVariables() (map[string][]float32, error) {
+	var names []string
+	var fetches []tf.Output
+	for _, op := range s.graph.Operations() {
+		if op.Type() != "VariableV2" && op.Type() != "Variable" {
+			continue
+		}
+		output := op.Output(0)
+		if output.DataType() != tf.Float {
+			continue
+		}
+		names = append(names, op.Name())
+		fetches = append(fetches, output)
+	}
+	if len(fetches) == 0 {
+		return nil, fmt.Errorf("No variables found in %s", s)
+	}
+	results, err := s.runScoring(nil, fetches)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch variables values: %v", err)
+	}
+	values := make(map[string][]float32, len(names))
+	for ii, name := range names {
+		values[name] = flattenFloat32(results[ii].Value())
+	}
+	return values, nil
+}
+
+// flattenFloat32 flattens the (multi-dimensional) slice of float32 returned by
+// tf.Tensor.Value.
+func flattenFloat32(value interface{}) (flat []float32) {
+	switch v := value.(type) {
+	case float32:
+		return []float32{v}
+	case []float32:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	for ii := 0; ii < rv.Len(); ii++ {
+		flat = append(flat, flattenFloat32(rv.Index(ii).Interface())...)
+	}
+	return
 }
 
 type AutoBatchRequest struct {
+	board                      *Board // Used to log invalid scores, and to blend the linear model score.
 	boardFeatures              []float32
-	actionsFeatures            [][1]float32
+	actionsFeatures            [][]float32
 	actionsSourceCenter        [][]float32
 	actionsSourceNeighbourhood [][6][]float32
 	actionsTargetCenter        [][]float32
@@ -575,17 +1584,18 @@ type AutoBatchRequest struct {
 	// Results
 	score        float32
 	actionsProbs []float32
+	err          error // Set if scoring failed.
 }
 
 func (s *Scorer) newAutoBatchRequest(b *Board) (req *AutoBatchRequest) {
 	req = &AutoBatchRequest{
-		boardFeatures: ai.FeatureVector(b, s.version),
+		board:         b,
+		boardFeatures: s.FeatureVector(b),
 		done:          make(chan bool),
 		actionsProbs:  make([]float32, 0, b.NumActions()),
 	}
-	for _, action := range b.Derived.Actions {
-		af := ai.NewActionFeatures(b, action, s.version)
-		req.actionsFeatures = append(req.actionsFeatures, [1]float32{af.Move})
+	for _, af := range s.ActionFeaturesCache.BoardActionsFeatures(b, s.version) {
+		req.actionsFeatures = append(req.actionsFeatures, af.Context(s.version))
 		req.actionsSourceCenter = append(req.actionsSourceCenter, af.SourceFeatures.Center)
 		req.actionsSourceNeighbourhood = append(req.actionsSourceNeighbourhood,
 			af.SourceFeatures.Sections)
@@ -598,13 +1608,13 @@ func (s *Scorer) newAutoBatchRequest(b *Board) (req *AutoBatchRequest) {
 
 func (req *AutoBatchRequest) LenActions() int { return len(req.actionsFeatures) }
 
-func (s *Scorer) scoreAutoBatch(b *Board) (score float32, actionsProbs []float32) {
+func (s *Scorer) scoreAutoBatch(b *Board) (score float32, actionsProbs []float32, err error) {
 	// Send request and wait for it to be processed.
 	req := s.newAutoBatchRequest(b)
 	glog.V(3).Info("Sending request", s)
 	s.autoBatchChan <- req
 	<-req.done
-	return req.score, req.actionsProbs
+	return req.score, req.actionsProbs, req.err
 }
 
 // Special request that indicates update on batch size.
@@ -614,16 +1624,25 @@ func (s *Scorer) SetBatchSize(batchSize int) {
 	if batchSize < 1 {
 		batchSize = 1
 	}
+	s.mu.Lock()
 	s.autoBatchSize = batchSize
+	s.mu.Unlock()
 	s.autoBatchChan <- onBatchSizeUpdate
 }
 
+// batchSize returns the auto-batch size, see SetBatchSize.
+func (s *Scorer) batchSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.autoBatchSize
+}
+
 type AutoBatch struct {
 	requests []*AutoBatchRequest
 
 	boardFeatures              [][]float32
 	actionsBoardIndices        []int64
-	actionsFeatures            [][1]float32
+	actionsFeatures            [][]float32
 	actionsSourceCenter        [][]float32
 	actionsSourceNeighbourhood [][6][]float32
 	actionsTargetCenter        [][]float32
@@ -633,11 +1652,15 @@ type AutoBatch struct {
 const MAX_ACTIONS_PER_BOARD = 200
 
 func (s *Scorer) newAutoBatch() *AutoBatch {
-	maxActions := s.autoBatchSize * MAX_ACTIONS_PER_BOARD
+	batchSize := s.batchSize()
+	maxActions := batchSize * MAX_ACTIONS_PER_BOARD
+	if s.MaxBatchActions > 0 && s.MaxBatchActions+MAX_ACTIONS_PER_BOARD < maxActions {
+		maxActions = s.MaxBatchActions + MAX_ACTIONS_PER_BOARD
+	}
 	return &AutoBatch{
-		boardFeatures:              make([][]float32, 0, s.autoBatchSize),
+		boardFeatures:              make([][]float32, 0, batchSize),
 		actionsBoardIndices:        make([]int64, 0, maxActions), // Go tensorflow implementation is broken for int32.
-		actionsFeatures:            make([][1]float32, 0, maxActions),
+		actionsFeatures:            make([][]float32, 0, maxActions),
 		actionsSourceCenter:        make([][]float32, 0, maxActions),
 		actionsSourceNeighbourhood: make([][6][]float32, 0, maxActions),
 		actionsTargetCenter:        make([][]float32, 0, maxActions),
@@ -663,10 +1686,32 @@ func (ab *AutoBatch) Len() int { return len(ab.requests) }
 
 func (ab *AutoBatch) LenActions() int { return len(ab.actionsBoardIndices) }
 
+// autoBatchFull returns whether the auto-batch should be scored: when it has the
+// auto-batch size boards, or MaxBatchActions actions.
+func (s *Scorer) autoBatchFull(ab *AutoBatch) bool {
+	return ab.Len() >= s.batchSize() || (s.MaxBatchActions > 0 && ab.LenActions() >= s.MaxBatchActions)
+}
+
 func (s *Scorer) autoBatchScoreAndDeliver(ab *AutoBatch) {
+	// If scoring fails (panics), deliver the error to all requests, instead of
+	// leaving them waiting forever.
+	delivered := false
+	defer func() {
+		if delivered {
+			return
+		}
+		r := recover()
+		err := fmt.Errorf("Scoring batch of %d boards failed: %v", ab.Len(), r)
+		glog.Errorf("%v", err)
+		for _, req := range ab.requests {
+			req.err = err
+			close(req.done)
+		}
+	}()
+
 	// Convert Go slices to tensors.
 	feeds := map[tf.Output]*tf.Tensor{
-		s.BoardFeatures:              mustTensor(ab.boardFeatures),
+		s.BoardFeatures:              mustTensor(s.normalizeBoardFeatures(ab.boardFeatures)),
 		s.ActionsBoardIndices:        mustTensor(ab.actionsBoardIndices),
 		s.ActionsFeatures:            mustTensor(ab.actionsFeatures),
 		s.ActionsSourceCenter:        mustTensor(ab.actionsSourceCenter),
@@ -686,8 +1731,7 @@ func (s *Scorer) autoBatchScoreAndDeliver(ab *AutoBatch) {
 		}
 	}
 
-	sess := s.NextSession()
-	results, err := sess.Run(feeds, fetches, nil)
+	results, err := s.runScoring(feeds, fetches)
 	if err != nil {
 		log.Panicf("Prediction failed: %v", err)
 	}
@@ -701,10 +1745,21 @@ func (s *Scorer) autoBatchScoreAndDeliver(ab *AutoBatch) {
 	for ii, score := range scores {
 		ab.requests[ii].score = score
 	}
-	if *flag_useLinear {
-		glog.V(3).Infof("Rescoring with linear model.")
+	if w := s.linearBlendWeight(); w != 0 {
+		glog.V(3).Infof("Rescoring with linear model (weight %g).", w)
 		for ii := 0; ii < ab.Len(); ii++ {
-			ab.requests[ii].score = ai.TrainedBest.ScoreFeatures(ab.boardFeatures[ii])
+			ab.requests[ii].score = s.blendLinearScore(ab.requests[ii].score, ab.requests[ii].board,
+				ab.boardFeatures[ii], w)
+		}
+	}
+	if s.ScoreGuard != nil {
+		boards := make([]*Board, ab.Len())
+		for ii, req := range ab.requests {
+			scores[ii], boards[ii] = req.score, req.board
+		}
+		s.ScoreGuard.Guard(scores, boards)
+		for ii, req := range ab.requests {
+			req.score = scores[ii]
 		}
 	}
 
@@ -722,6 +1777,7 @@ func (s *Scorer) autoBatchScoreAndDeliver(ab *AutoBatch) {
 	}
 
 	// Signal that request has been fulfilled.
+	delivered = true
 	for _, req := range ab.requests {
 		close(req.done)
 	}
@@ -738,9 +1794,9 @@ func (s *Scorer) autoBatchDispatcher() {
 			ab.Append(req)
 			glog.V(3).Info("Received scoring request.")
 		} else {
-			glog.V(1).Infof("[%s] batch size changed to %d", s, s.autoBatchSize)
+			glog.V(1).Infof("[%s] batch size changed to %d", s, s.batchSize())
 		}
-		if ab != nil && ab.Len() >= s.autoBatchSize {
+		if ab != nil && s.autoBatchFull(ab) {
 			go s.autoBatchScoreAndDeliver(ab)
 			ab = nil
 		}
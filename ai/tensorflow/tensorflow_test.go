@@ -0,0 +1,892 @@
+package tensorflow_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/search"
+	"github.com/janpfeifer/hiveGo/ai/tensorflow"
+	. "github.com/janpfeifer/hiveGo/state"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// TestMain builds the test model, tf_model, with build_model.py into a temporary
+// directory, and runs the tests from there, so the model always matches the
+// current features (ai.AllFeaturesDim) and the tensors the Scorer expects.
+func TestMain(m *testing.M) {
+	buildModel, err := filepath.Abs("build_model.py")
+	if err != nil {
+		log.Fatalf("Failed to find build_model.py: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "hive_tf_model")
+	if err != nil {
+		log.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	cmd := exec.Command("python3", buildModel, "--output="+path.Join(dir, "tf_model.pb"))
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err = cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		log.Fatalf("Failed to build the test model with %s (it requires TensorFlow for Python): %v",
+			buildModel, err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		os.RemoveAll(dir)
+		log.Fatalf("Failed to change to %s: %v", dir, err)
+	}
+
+	// Checkpoint of the randomly initialized model, for the tests that load one.
+	tensorflow.New("tf_model", 1, true).Save()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testBoard returns a board a few moves into a game, so there are pieces to move.
+func testBoard() *Board {
+	board := NewBoard()
+	board.BuildDerived()
+	for ii := 0; ii < 4; ii++ {
+		board = board.Act(board.Derived.Actions[0])
+	}
+	return board
+}
+
+func TestTrainPolicyOnly(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if s.TrainPolicyOp == nil {
+		t.Skip("Model graph has no train_policy op, rebuild it with build_model.py")
+	}
+	s.TrainTarget = tensorflow.TRAIN_POLICY
+
+	board := testBoard()
+	valueBefore, probsBefore := s.BatchScore([]*Board{board})
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	s.Learn([]*Board{board}, []float32{-valueBefore[0]}, [][]float32{labels}, 0.01, 10)
+
+	valueAfter, probsAfter := s.BatchScore([]*Board{board})
+	if valueAfter[0] != valueBefore[0] {
+		t.Errorf("Policy only training changed value prediction from %g to %g", valueBefore[0], valueAfter[0])
+	}
+	if probsAfter[0][0] <= probsBefore[0][0] {
+		t.Errorf("Policy only training didn't increase the probability of the labeled action: %g -> %g",
+			probsBefore[0][0], probsAfter[0][0])
+	}
+}
+
+func TestLearnWithBreakdown(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if s.GradientNorm == nil || s.WeightNorm == nil {
+		t.Skip("Model graph has no gradient_norm/weight_norm tensors, rebuild it with build_model.py")
+	}
+	board := testBoard()
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	lb := s.LearnWithBreakdown([]*Board{board}, []float32{1}, [][]float32{labels}, 0.01, 1)
+	for name, value := range map[string]float32{
+		"Total": lb.Total, "Value": lb.Value, "Policy": lb.Policy,
+		"GradientNorm": lb.GradientNorm, "WeightNorm": lb.WeightNorm,
+	} {
+		if value < 0 {
+			t.Errorf("LossBreakdown.%s=%g, wanted it populated and non-negative", name, value)
+		}
+	}
+	if lb.WeightNorm == 0 {
+		t.Errorf("LossBreakdown.WeightNorm=0 for an initialized model")
+	}
+}
+
+func TestLearnWeighted(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if s.BoardWeights == nil || s.GradientNorm == nil {
+		t.Skip("Model graph has no board_weights/gradient_norm tensors, rebuild it with build_model.py")
+	}
+	boards := []*Board{testBoard()}
+	labels := make([]float32, boards[0].NumActions())
+	labels[0] = 1
+
+	// With learning rate 0 the model is not changed, and the gradient is linear
+	// on the weight.
+	baseline := s.LearnWeighted(boards, []float32{1}, [][]float32{labels}, nil, 0, 1)
+	doubled := s.LearnWeighted(boards, []float32{1}, [][]float32{labels}, []float32{2}, 0, 1)
+	if ratio := doubled.GradientNorm / baseline.GradientNorm; ratio < 1.99 || ratio > 2.01 {
+		t.Errorf("Doubling the weight changed the gradient norm from %g to %g, wanted it doubled",
+			baseline.GradientNorm, doubled.GradientNorm)
+	}
+	if ratio := doubled.Total / baseline.Total; ratio < 1.99 || ratio > 2.01 {
+		t.Errorf("Doubling the weight changed the loss from %g to %g, wanted it doubled",
+			baseline.Total, doubled.Total)
+	}
+}
+
+func TestLearnWithExamplesLosses(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if !s.HasExamplesLosses() {
+		t.Skip("Model graph has no board_examples_losses/actions_examples_losses tensors, rebuild it with build_model.py")
+	}
+	var _ ai.ExamplesLossesLearner = s
+	board := testBoard()
+	boards := []*Board{board, board}
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+
+	// The second board has the same value label and no policy labels to learn,
+	// so its loss is the value loss only.
+	_, losses := s.LearnWithExamplesLosses(boards, []float32{1, 1},
+		[][]float32{labels, make([]float32, board.NumActions())}, nil, 0, 1)
+	if len(losses) != len(boards) {
+		t.Fatalf("Got %d examples losses for %d boards", len(losses), len(boards))
+	}
+	if losses[0] <= losses[1] || losses[1] < 0 {
+		t.Errorf("Examples losses %v: the first board should have also a policy loss", losses)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	tensorflow.Deterministic = true
+	defer func() { tensorflow.Deterministic = false }()
+
+	board := testBoard()
+	var scores []float32
+	var probs [][]float32
+	for ii := 0; ii < 2; ii++ {
+		// A new scorer (and sessions) each time, to emulate separate runs.
+		s := tensorflow.New("tf_model", 1, true)
+		batchScores, batchProbs := s.BatchScore([]*Board{board})
+		scores = append(scores, batchScores[0])
+		probs = append(probs, batchProbs[0])
+	}
+	if scores[0] != scores[1] {
+		t.Errorf("Deterministic scores differ: %g != %g", scores[0], scores[1])
+	}
+	if !reflect.DeepEqual(probs[0], probs[1]) {
+		t.Errorf("Deterministic actions probabilities differ: %v != %v", probs[0], probs[1])
+	}
+}
+
+func TestDumpVariables(t *testing.T) {
+	// Copy only the graph, so the model is freshly initialized.
+	dir, err := ioutil.TempDir("", "hive_tf_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	graphDef, err := ioutil.ReadFile("tf_model.pb")
+	if err != nil {
+		t.Fatalf("Failed to read graph: %v", err)
+	}
+	basename := path.Join(dir, "model")
+	if err = ioutil.WriteFile(basename+".pb", graphDef, 0644); err != nil {
+		t.Fatalf("Failed to write graph: %v", err)
+	}
+
+	s := tensorflow.New(basename, 1, true)
+	variables, err := s.DumpVariables()
+	if err != nil {
+		t.Fatalf("DumpVariables failed: %v", err)
+	}
+	if len(variables) == 0 {
+		t.Fatalf("DumpVariables returned no variables")
+	}
+	for name, values := range variables {
+		if len(values) == 0 {
+			t.Errorf("Variable %s has no values", name)
+		}
+	}
+}
+
+func TestNewFromGraphDef(t *testing.T) {
+	var contents [3][]byte
+	for ii, filename := range []string{"tf_model.pb", "tf_model.checkpoint.index",
+		"tf_model.checkpoint.data-00000-of-00001"} {
+		var err error
+		if contents[ii], err = ioutil.ReadFile(filename); err != nil {
+			t.Fatalf("Failed to read %s: %v", filename, err)
+		}
+	}
+	fromBytes := tensorflow.NewFromGraphDef(contents[0], contents[1], contents[2], 1, true)
+	fromFiles := tensorflow.New("tf_model", 1, true)
+	if fromBytes.Version() != fromFiles.Version() {
+		t.Errorf("Version from bytes is %d, wanted %d", fromBytes.Version(), fromFiles.Version())
+	}
+
+	board := testBoard()
+	gotScores, gotProbs := fromBytes.BatchScore([]*Board{board})
+	wantScores, wantProbs := fromFiles.BatchScore([]*Board{board})
+	if !reflect.DeepEqual(gotScores, wantScores) || !reflect.DeepEqual(gotProbs, wantProbs) {
+		t.Errorf("Model loaded from bytes scores %v, %v, wanted %v, %v", gotScores, gotProbs, wantScores, wantProbs)
+	}
+}
+
+func TestScorerService(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	server := tensorflow.NewScorerServer(s)
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufconn", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatalf("Failed to connect to the service: %v", err)
+	}
+	defer conn.Close()
+
+	boards := []*Board{NewBoard(), testBoard()}
+	remote := tensorflow.NewRemoteScorer(conn, s.Version())
+	gotScores, gotProbs := remote.BatchScore(boards)
+	wantScores, wantProbs := s.BatchScore(boards)
+	if !reflect.DeepEqual(gotScores, wantScores) || !reflect.DeepEqual(gotProbs, wantProbs) {
+		t.Errorf("Remote scores %v, %v differ from local ones %v, %v", gotScores, gotProbs, wantScores, wantProbs)
+	}
+
+	// Features version mismatch.
+	wrongVersion := tensorflow.NewRemoteScorer(conn, s.Version()-1)
+	if _, err := wrongVersion.Learn(boards, []float32{0, 1}, nil, 0.01, 0); err == nil {
+		t.Errorf("Request with the wrong features version should have failed")
+	}
+}
+
+func TestGlobalStep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_tf_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	graphDef, err := ioutil.ReadFile("tf_model.pb")
+	if err != nil {
+		t.Fatalf("Failed to read graph: %v", err)
+	}
+	basename := path.Join(dir, "model")
+	if err = ioutil.WriteFile(basename+".pb", graphDef, 0644); err != nil {
+		t.Fatalf("Failed to write graph: %v", err)
+	}
+
+	s := tensorflow.New(basename, 1, true)
+	if s.GlobalStep() != 0 {
+		t.Errorf("Fresh model has global step %d, wanted 0", s.GlobalStep())
+	}
+	board := testBoard()
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	for ii := 0; ii < 2; ii++ {
+		s.Learn([]*Board{board}, []float32{1}, [][]float32{labels}, 0.01, 3)
+	}
+	if s.GlobalStep() != 2 {
+		t.Errorf("After 2 calls to Learn got global step %d, wanted 2", s.GlobalStep())
+	}
+	s.Save()
+
+	loaded := tensorflow.New(basename, 1, true)
+	if loaded.GlobalStep() != 2 {
+		t.Errorf("Loaded model has global step %d, wanted 2", loaded.GlobalStep())
+	}
+	loaded.Learn([]*Board{board}, []float32{1}, [][]float32{labels}, 0.01, 1)
+	if loaded.GlobalStep() != 3 {
+		t.Errorf("Loaded model after Learn has global step %d, wanted 3", loaded.GlobalStep())
+	}
+}
+
+func TestOnLearnStep(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	globalStep := s.GlobalStep()
+	numSteps := 0
+	s.OnLearnStep = func() { numSteps++ }
+	board := testBoard()
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	s.Learn([]*Board{board}, []float32{1}, [][]float32{labels}, 0.01, 5)
+	if numSteps != 5 {
+		t.Errorf("OnLearnStep called %d times, wanted once per step (5)", numSteps)
+	}
+	if s.GlobalStep() != globalStep+1 {
+		t.Errorf("Global step went from %d to %d, wanted one more for the call to Learn", globalStep, s.GlobalStep())
+	}
+	s.Loss([]*Board{board}, []float32{1}, [][]float32{labels})
+	if numSteps != 5 {
+		t.Errorf("OnLearnStep called by Loss, which doesn't train")
+	}
+}
+
+// copyModel copies tf_model, graph and checkpoint, to dir/name, with the given
+// global step saved in its metadata.
+func copyModel(t *testing.T, dir, name string, step int) {
+	for _, suffix := range []string{".pb", ".checkpoint.index", ".checkpoint.data-00000-of-00001"} {
+		data, err := ioutil.ReadFile("tf_model" + suffix)
+		if err != nil {
+			t.Fatalf("Failed to read tf_model%s: %v", suffix, err)
+		}
+		if err = ioutil.WriteFile(path.Join(dir, name+suffix), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s%s: %v", name, suffix, err)
+		}
+	}
+	meta := []byte(fmt.Sprintf(`{"global_step": %d}`, step))
+	if err := ioutil.WriteFile(path.Join(dir, name+".checkpoint.meta.json"), meta, 0644); err != nil {
+		t.Fatalf("Failed to write metadata of %s: %v", name, err)
+	}
+}
+
+func TestModelZoo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_zoo_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	copyModel(t, dir, "model_a", 10)
+	copyModel(t, dir, "model_b", 20)
+	// Checkpoint of another training run, at the same step.
+	copyModel(t, dir, "model_c", 20)
+
+	// Scripted validation losses: model_b is the best.
+	losses := map[string]float32{"model_a": 0.7, "model_b": 0.3, "model_c": 0.5}
+	numEvaluations := 0
+	zoo := tensorflow.NewModelZoo(dir, func(checkpoint tensorflow.ZooCheckpoint) (float32, error) {
+		numEvaluations++
+		return losses[path.Base(checkpoint.Basename)], nil
+	})
+	for ii := 0; ii < 2; ii++ {
+		best, loss, err := zoo.Best()
+		if err != nil {
+			t.Fatalf("Failed to select best checkpoint: %v", err)
+		}
+		if best.Basename != path.Join(dir, "model_b") || best.GlobalStep != 20 || loss != 0.3 {
+			t.Errorf("Selected checkpoint %+v with loss %g, wanted model_b (step 20) with loss 0.3", best, loss)
+		}
+	}
+	if numEvaluations != 3 {
+		t.Errorf("Got %d evaluations, wanted 3: results should be cached by checkpoint", numEvaluations)
+	}
+
+	s, err := zoo.LoadBest(1, true)
+	if err != nil {
+		t.Fatalf("Failed to load best checkpoint: %v", err)
+	}
+	if s.GlobalStep() != 20 {
+		t.Errorf("Loaded checkpoint with global step %d, wanted 20", s.GlobalStep())
+	}
+}
+
+func TestLossSessionPool(t *testing.T) {
+	single := tensorflow.New("tf_model", 1, true)
+	pool := tensorflow.New("tf_model", 2, true)
+	board := testBoard()
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	want := single.Loss([]*Board{board}, []float32{1}, [][]float32{labels})
+	// Twice, to use both sessions of the pool.
+	for ii := 0; ii < 2; ii++ {
+		if got := pool.Loss([]*Board{board}, []float32{1}, [][]float32{labels}); got != want {
+			t.Errorf("Loss with a session pool is %s, wanted %s", got, want)
+		}
+	}
+}
+
+func TestLinearBlend(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if s.Version() != ai.AllFeaturesDim || s.Version() == ai.TrainedBest.Version() {
+		t.Fatalf("Test model should use all the features (%d), more than the linear model (%d), got %d",
+			ai.AllFeaturesDim, ai.TrainedBest.Version(), s.Version())
+	}
+	board := testBoard()
+	score := func() float32 {
+		scores, _ := s.BatchScore([]*Board{board})
+		return scores[0]
+	}
+	tfScore := score()
+
+	s.UseLinear = true
+	linearScore := score()
+	s.UseLinear = false
+	if want, _ := ai.TrainedBest.Score(board); linearScore != want {
+		t.Errorf("UseLinear score is %g, wanted the linear model score %g", linearScore, want)
+	}
+
+	for _, blend := range []float32{0, 1, 0.3} {
+		s.LinearBlend = blend
+		want := (1-blend)*tfScore + blend*linearScore
+		if got := score(); math.Abs(float64(got-want)) > 1e-4 {
+			t.Errorf("LinearBlend=%g: got score %g, wanted %g", blend, got, want)
+		}
+	}
+
+	// Auto-batching blends the same way.
+	s.SetBatchSize(1)
+	if got, _ := s.Score(board); math.Abs(float64(got-(0.7*tfScore+0.3*linearScore))) > 1e-4 {
+		t.Errorf("LinearBlend=0.3 with auto-batching: got score %g, wanted %g", got, 0.7*tfScore+0.3*linearScore)
+	}
+}
+
+func TestUseLinearPerScorer(t *testing.T) {
+	// Two scorers in the same process, only one rescoring with the linear model.
+	tfScorer := tensorflow.New("tf_model", 1, true)
+	linearScorer := tensorflow.New("tf_model", 1, true)
+	linearScorer.UseLinear = true
+
+	board := testBoard()
+	tfScores, _ := tfScorer.BatchScore([]*Board{board})
+	linearScores, _ := linearScorer.BatchScore([]*Board{board})
+	if tfScores[0] == linearScores[0] {
+		t.Errorf("Scorers with different UseLinear gave the same score %g", tfScores[0])
+	}
+	if want, _ := ai.TrainedBest.Score(board); linearScores[0] != want {
+		t.Errorf("UseLinear score is %g, wanted the linear model score %g", linearScores[0], want)
+	}
+}
+
+// TestConcurrentScoring hammers a scorer from many goroutines, scoring with and
+// without auto-batching, while it learns. Run it with -race.
+func TestConcurrentScoring(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	s.SetBatchSize(4)
+	globalStep := s.GlobalStep()
+	board := testBoard()
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+
+	const numGoroutines, numScores = 16, 20
+	var wg sync.WaitGroup
+	errs := make(chan string, numGoroutines*numScores)
+	for ii := 0; ii < numGoroutines; ii++ {
+		wg.Add(1)
+		go func(ii int) {
+			defer wg.Done()
+			for jj := 0; jj < numScores; jj++ {
+				var score float32
+				var probs []float32
+				if (ii+jj)%2 == 0 {
+					score, probs = s.Score(board)
+				} else {
+					scores, probsBatch := s.BatchScore([]*Board{board, board})
+					score, probs = scores[1], probsBatch[1]
+				}
+				if math.IsNaN(float64(score)) || len(probs) != board.NumActions() {
+					errs <- fmt.Sprintf("got score %g and %d probabilities, wanted %d", score, len(probs),
+						board.NumActions())
+				}
+			}
+		}(ii)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ii := 0; ii < 5; ii++ {
+			s.Learn([]*Board{board}, []float32{1}, [][]float32{labels}, 0.01, 1)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Concurrent scoring: %s", err)
+	}
+	if s.GlobalStep() != globalStep+5 {
+		t.Errorf("Expected 5 learning steps, global step went from %d to %d", globalStep, s.GlobalStep())
+	}
+}
+
+func TestScoreWithUncertainty(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if s.MCDropout != nil {
+		t.Skip("Model graph has MC-dropout, test requires a deterministic graph")
+	}
+	board := testBoard()
+	score, _ := s.Score(board)
+	mean, stddev := s.ScoreWithUncertainty(board, 8)
+	if mean != score || stddev != 0 {
+		t.Errorf("Deterministic graph: got mean=%g, stddev=%g, wanted score %g and stddev 0", mean, stddev, score)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	cold, warm := s.Warmup(20)
+	if cold <= 0 || warm <= 0 {
+		t.Errorf("Expected positive latencies, got cold=%s, warm=%s", cold, warm)
+	}
+	// Loosely: warm scoring shouldn't be slower than the cold one.
+	if warm > 2*cold {
+		t.Errorf("Warm latency %s much higher than the cold one %s", warm, cold)
+	}
+	for _, board := range ai.RandomBoards(5, 20, rand.New(rand.NewSource(2))) {
+		if _, probs := s.Score(board); len(probs) != board.NumActions() {
+			t.Errorf("Got %d probabilities for %d actions after warm up", len(probs), board.NumActions())
+		}
+	}
+}
+
+func TestScoreGuard(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	board := testBoard()
+	scores, _ := s.BatchScore([]*Board{board})
+	limit := float32(math.Abs(float64(scores[0])) / 2)
+	if limit == 0 {
+		t.Skip("Model scores test board with 0, nothing to clamp")
+	}
+
+	// Clamped with and without auto-batching.
+	s.ScoreGuard = ai.NewScoreGuard(limit, 0)
+	scores, _ = s.BatchScore([]*Board{board})
+	s.SetBatchSize(1)
+	score, _ := s.Score(board)
+	for _, got := range []float32{scores[0], score} {
+		if got != limit && got != -limit {
+			t.Errorf("Score %g not clamped to the limit %g", got, limit)
+		}
+	}
+}
+
+func TestScoreGuardNaN(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	board := testBoard()
+
+	// Normalizing the features with a NaN mean makes the model score NaN.
+	stats := ai.FitFeatureStats([][]float32{s.FeatureVector(board)})
+	for ii := range stats.Mean {
+		stats.Mean[ii] = float32(math.NaN())
+	}
+	s.FeatureStats = stats
+	const neutral = 0.25
+	s.ScoreGuard = nil
+	if scores, _ := s.BatchScore([]*Board{board}); !math.IsNaN(float64(scores[0])) {
+		t.Fatalf("Model with NaN feature normalization scored %g, wanted NaN", scores[0])
+	}
+
+	// NaN scores are replaced by the neutral score, with and without auto-batching.
+	s.ScoreGuard = ai.NewScoreGuard(10, neutral)
+	scores, _ := s.BatchScore([]*Board{board})
+	score, _ := s.Score(board)
+	for _, got := range []float32{scores[0], score} {
+		if got != neutral {
+			t.Errorf("NaN score replaced by %g, wanted %g", got, neutral)
+		}
+	}
+	if got := s.ScoreGuard.NumInvalid(); got != 2 {
+		t.Errorf("ScoreGuard counted %d invalid scores, wanted 2", got)
+	}
+
+	// The search sees the neutral score for every board.
+	action, newBoard, score, _ := search.NewAlphaBetaSearcher(1, 0, false, s).Search(board)
+	if newBoard == nil || board.FindAction(action) < 0 || score != -neutral {
+		t.Errorf("Search with NaN scores chose %s with score %g, wanted a valid action with score %g",
+			action, score, -neutral)
+	}
+
+	// Training notices the model collapsed, since all boards get the same score.
+	monitor := ai.NewCollapseMonitor([]*Board{board, newBoard}, 2, 0.01)
+	if stddev, collapsed := monitor.Check(s); !collapsed {
+		t.Errorf("Model scoring NaN not detected as collapsed, standard deviation of its scores is %g", stddev)
+	}
+}
+
+// memoryStore is an in-memory tensorflow.CheckpointStore.
+type memoryStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// memoryFile is a file being written to a memoryStore, stored once closed.
+type memoryFile struct {
+	bytes.Buffer
+	store *memoryStore
+	name  string
+}
+
+func (f *memoryFile) Close() error {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	f.store.files[f.name] = f.Bytes()
+	return nil
+}
+
+func (ms *memoryStore) Create(name string) (io.WriteCloser, error) {
+	return &memoryFile{store: ms, name: name}, nil
+}
+
+func (ms *memoryStore) Open(name string) (io.ReadCloser, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	data, found := ms.files[name]
+	if !found {
+		return nil, fmt.Errorf("File %s not found", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (ms *memoryStore) Remove(name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, found := ms.files[name]; !found {
+		return fmt.Errorf("File %s not found", name)
+	}
+	delete(ms.files, name)
+	return nil
+}
+
+// latestCheckpoint returns the name of the files of the latest version of the
+// checkpoint in the store, without the suffix.
+func (ms *memoryStore) latestCheckpoint(t *testing.T, name string) string {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	data, found := ms.files[name+".checkpoint"+tensorflow.CHECKPOINT_LATEST_SUFFIX]
+	if !found {
+		t.Fatalf("Checkpoint %s not published in the store", name)
+	}
+	return name + ".checkpoint-" + strings.Split(string(data), "\n")[0]
+}
+
+func TestCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_tf_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	copyModel(t, dir, "saver", 0)
+	copyModel(t, dir, "worker", 0)
+
+	// Train and save the model to the store only.
+	store := &memoryStore{files: make(map[string][]byte)}
+	s := tensorflow.New(path.Join(dir, "saver"), 1, true)
+	board := testBoard()
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	s.Learn([]*Board{board}, []float32{1}, [][]float32{labels}, 0.1, 5)
+	if err = s.SaveTo(store, "shared"); err != nil {
+		t.Fatalf("Failed to save to checkpoint store: %v", err)
+	}
+	latest := store.latestCheckpoint(t, "shared")
+	for _, suffix := range tensorflow.CHECKPOINT_SUFFIXES {
+		if _, found := store.files[latest+suffix]; !found {
+			t.Errorf("Checkpoint file %s%s not saved to store", latest, suffix)
+		}
+	}
+	if _, err = os.Stat(path.Join(dir, "saver.checkpoint.meta.json")); !os.IsNotExist(err) {
+		t.Errorf("SaveTo should not change the local checkpoint files, got %v", err)
+	}
+
+	// A worker with the original model pulls the trained one.
+	worker := tensorflow.New(path.Join(dir, "worker"), 1, true)
+	if err = worker.RestoreFrom(store, "missing"); err == nil {
+		t.Errorf("Restoring a missing checkpoint should have failed")
+	}
+	worker.Store = store
+	if err = worker.Restore(); err == nil {
+		t.Errorf("Restoring from store with the worker's name (no checkpoint) should have failed")
+	}
+	if err = worker.RestoreFrom(store, "shared"); err != nil {
+		t.Fatalf("Failed to restore from checkpoint store: %v", err)
+	}
+	if worker.GlobalStep() != 1 {
+		t.Errorf("Restored model has global step %d, wanted 1", worker.GlobalStep())
+	}
+	want, _ := s.Score(board)
+	got, _ := worker.Score(board)
+	if got != want {
+		t.Errorf("Restored model scores %g, wanted %g", got, want)
+	}
+
+	// Save with a Store also uploads the checkpoint, with the model's name.
+	worker.Save()
+	if _, found := store.files[store.latestCheckpoint(t, "worker")+".index"]; !found {
+		t.Errorf("Save didn't upload the checkpoint to the store")
+	}
+}
+
+func TestExportPureGo(t *testing.T) {
+	s := tensorflow.New("tf_model", 1, true)
+	if s.MCDropout != nil {
+		t.Skip("Model graph has MC-dropout, test requires a deterministic graph")
+	}
+	pure, err := s.ExportPureGo()
+	if err != nil {
+		t.Fatalf("Failed to export model: %v", err)
+	}
+	board := testBoard()
+	boards := []*Board{NewBoard(), board}
+	for _, action := range board.Derived.Actions {
+		boards = append(boards, board.Act(action))
+	}
+	want, _ := s.BatchScore(boards)
+	got, _ := pure.BatchScore(boards)
+	for ii := range boards {
+		if math.Abs(float64(got[ii]-want[ii])) > 1e-3 {
+			t.Errorf("Board #%d: pure Go scorer got %g, wanted %g", ii, got[ii], want[ii])
+		}
+	}
+}
+
+func TestFeatureStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_tf_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	copyModel(t, dir, "model", 0)
+	basename := path.Join(dir, "model")
+	s := tensorflow.New(basename, 1, true)
+	if s.FeatureStats != nil {
+		t.Fatalf("Existing model should not normalize features")
+	}
+	board := testBoard()
+	raw, _ := s.Score(board)
+
+	// Normalization changes the scores, and it's saved with the model.
+	boards := []*Board{NewBoard(), board}
+	for _, action := range board.Derived.Actions {
+		boards = append(boards, board.Act(action))
+	}
+	features := make([][]float32, len(boards))
+	for ii, b := range boards {
+		features[ii] = ai.FeatureVector(b, s.Version())
+	}
+	s.FeatureStats = ai.FitFeatureStats(features)
+	normalized, _ := s.Score(board)
+	if normalized == raw {
+		t.Errorf("Normalized features got the same score %g as raw features", raw)
+	}
+	s.Save()
+	loaded := tensorflow.New(basename, 1, true)
+	if !reflect.DeepEqual(loaded.FeatureStats, s.FeatureStats) {
+		t.Errorf("Loaded FeatureStats %v, wanted %v", loaded.FeatureStats, s.FeatureStats)
+	}
+	if got, _ := loaded.Score(board); got != normalized {
+		t.Errorf("Loaded model scores %g, wanted %g", got, normalized)
+	}
+
+	// Disabling it reproduces the raw features scores.
+	loaded.FeatureStats = nil
+	if got, _ := loaded.Score(board); got != raw {
+		t.Errorf("Model with normalization disabled scores %g, wanted %g", got, raw)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hive_tf_test")
+	if err != nil {
+		t.Fatalf("Failed to create temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	copyModel(t, dir, "model", 0)
+	basename := path.Join(dir, "model")
+	server := tensorflow.New(basename, 2, true)
+	board := testBoard()
+	before, _ := server.Score(board)
+
+	// A trainer, e.g. in another process, saves a new checkpoint.
+	trainer := tensorflow.New(basename, 1, true)
+	labels := make([]float32, board.NumActions())
+	labels[0] = 1
+	trainer.Learn([]*Board{board}, []float32{-before}, [][]float32{labels}, 0.1, 5)
+	trainer.Save()
+	want, _ := trainer.Score(board)
+	if want == before {
+		t.Fatalf("Training didn't change the score %g", before)
+	}
+	if got, _ := server.Score(board); got != before {
+		t.Fatalf("Score changed to %g before reloading", got)
+	}
+
+	// Reload while scoring concurrently.
+	var wg sync.WaitGroup
+	stop := make(chan bool)
+	for ii := 0; ii < 4; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					if score, _ := server.Score(board); score != before && score != want {
+						t.Errorf("Got score %g while reloading, wanted %g or %g", score, before, want)
+					}
+				}
+			}
+		}()
+	}
+	if err = server.Reload(); err != nil {
+		t.Errorf("Failed to reload: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+	if got, _ := server.Score(board); got != want {
+		t.Errorf("After Reload got score %g, wanted %g", got, want)
+	}
+	if server.GlobalStep() != 1 {
+		t.Errorf("After Reload got global step %d, wanted 1", server.GlobalStep())
+	}
+
+	// Checkpoints with a different feature normalization are not reloaded.
+	trainer.FeatureStats = ai.FitFeatureStats([][]float32{ai.FeatureVector(board, trainer.Version())})
+	trainer.Save()
+	if err = server.Reload(); err == nil {
+		t.Errorf("Reload of a checkpoint with different feature normalization should have failed")
+	}
+	if got, _ := server.Score(board); got != want {
+		t.Errorf("After failed Reload got score %g, wanted %g", got, want)
+	}
+
+	// A truncated checkpoint fails to restore, and the sessions are left untouched.
+	trainer.FeatureStats = server.FeatureStats
+	trainer.Learn([]*Board{board}, []float32{-want}, [][]float32{labels}, 0.1, 5)
+	trainer.Save()
+	dataFile := basename + ".checkpoint.data-00000-of-00001"
+	data, err := ioutil.ReadFile(dataFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", dataFile, err)
+	}
+	if err = ioutil.WriteFile(dataFile, data[:len(data)/2], 0644); err != nil {
+		t.Fatalf("Failed to truncate %s: %v", dataFile, err)
+	}
+	if err = server.Reload(); err == nil {
+		t.Errorf("Reload of a truncated checkpoint should have failed")
+	}
+	for ii := 0; ii < 2; ii++ {
+		// Each score uses the next session of the pool.
+		if got, _ := server.Score(board); got != want {
+			t.Errorf("After failed Reload of truncated checkpoint got score %g, wanted %g", got, want)
+		}
+	}
+}
+
+func TestMaxConcurrentRuns(t *testing.T) {
+	const poolSize, maxRuns = 4, 2
+	s := tensorflow.New("tf_model", poolSize, true)
+	s.SetMaxConcurrentRuns(maxRuns)
+	board := testBoard()
+
+	const numGoroutines, numScores = 16, 10
+	var wg sync.WaitGroup
+	for ii := 0; ii < numGoroutines; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jj := 0; jj < numScores; jj++ {
+				s.BatchScore([]*Board{board, board})
+			}
+		}()
+	}
+	wg.Wait()
+	if peak := s.PeakConcurrentRuns(); peak < 1 || peak > maxRuns {
+		t.Errorf("Got %d evaluations running at the same time, wanted between 1 and %d", peak, maxRuns)
+	}
+}
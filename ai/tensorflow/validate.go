@@ -0,0 +1,115 @@
+package tensorflow
+
+import (
+	"fmt"
+	"sort"
+
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// Export contract of the models loaded by New: the same graph is used for
+// training (the train ops) and for inference (board_predictions and
+// actions_predictions), and nothing is fed to tell them apart. So every op
+// feeding the predictions must behave at inference time as it does when
+// scoring a single board:
+//
+//   - Batch normalization must be built in inference mode, using the moving
+//     averages (is_training=False for tf.nn.fused_batch_norm, training=False for
+//     tf.layers.batch_normalization), with the moving averages updated by the
+//     train ops only. Otherwise scores depend on the other boards of the batch,
+//     and a batch of one board is normalized to zero.
+//   - No dropout or other random ops, otherwise scores are not deterministic.
+//     The exception is MC-dropout, enabled only when the boolean placeholder
+//     mc_dropout is fed true (see Scorer.ScoreWithUncertainty): random ops are
+//     not reported in graphs that have it.
+//
+// ValidateGraph checks the parts of the contract it can recognize, and New
+// logs a warning for each violation found. Non-fused batch normalization in
+// training mode (tf.nn.moments over the batch) is made of ordinary ops, and is
+// not detected.
+
+// MC_DROPOUT_TENSOR is the name of the optional boolean placeholder that enables
+// dropout at inference, see Scorer.ScoreWithUncertainty.
+const MC_DROPOUT_TENSOR = "mc_dropout"
+
+// trainingOnlyOpTypes are ops that should not feed the predictions, mapped to
+// the reason.
+var trainingOnlyOpTypes = map[string]string{
+	"RandomUniform":        "random op (dropout?)",
+	"RandomUniformInt":     "random op (dropout?)",
+	"RandomStandardNormal": "random op (dropout?)",
+	"TruncatedNormal":      "random op (dropout?)",
+}
+
+// fusedBatchNormOpTypes are batch normalization ops with an is_training
+// attribute.
+var fusedBatchNormOpTypes = map[string]bool{
+	"FusedBatchNorm":   true,
+	"FusedBatchNormV2": true,
+	"FusedBatchNormV3": true,
+}
+
+// trainingOnlyReason returns why the op should not be used for inference, or ""
+// if it is fine.
+func trainingOnlyReason(op *tf.Operation) string {
+	if reason, found := trainingOnlyOpTypes[op.Type()]; found {
+		return reason
+	}
+	if fusedBatchNormOpTypes[op.Type()] {
+		isTraining, err := op.Attr("is_training")
+		if err != nil {
+			return ""
+		}
+		if value, ok := isTraining.(bool); ok && value {
+			return "batch normalization with is_training=true"
+		}
+	}
+	return ""
+}
+
+// reaches returns whether any of the targets can be reached from the outputs of
+// op.
+func reaches(op *tf.Operation, targets map[string]bool) bool {
+	visited := map[string]bool{op.Name(): true}
+	queue := []*tf.Operation{op}
+	for len(queue) > 0 {
+		op, queue = queue[0], queue[1:]
+		if targets[op.Name()] {
+			return true
+		}
+		for ii := 0; ii < op.NumOutputs(); ii++ {
+			for _, consumer := range op.Output(ii).Consumers() {
+				if !visited[consumer.Op.Name()] {
+					visited[consumer.Op.Name()] = true
+					queue = append(queue, consumer.Op)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ValidateGraph returns a description of each training-only op (see the export
+// contract above) in the graph that feeds any of the given predictions, sorted
+// by op name. It returns nil if none is found.
+func ValidateGraph(graph *tf.Graph, predictions ...tf.Output) (warnings []string) {
+	targets := make(map[string]bool, len(predictions))
+	for _, output := range predictions {
+		targets[output.Op.Name()] = true
+	}
+	mcDropout := graph.Operation(MC_DROPOUT_TENSOR) != nil
+	for _, op := range graph.Operations() {
+		op := op
+		reason := trainingOnlyReason(&op)
+		if reason == "" || !reaches(&op, targets) {
+			continue
+		}
+		if _, random := trainingOnlyOpTypes[op.Type()]; random && mcDropout {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("training-only op %q (%s, %s) feeds the predictions",
+			op.Name(), op.Type(), reason))
+	}
+	sort.Strings(warnings)
+	return
+}
@@ -0,0 +1,83 @@
+package tensorflow_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai/tensorflow"
+	tf "github.com/tensorflow/tensorflow/tensorflow/go"
+)
+
+// addOp adds an operation to the graph and returns its first output.
+func addOp(t *testing.T, graph *tf.Graph, spec tf.OpSpec) tf.Output {
+	op, err := graph.AddOperation(spec)
+	if err != nil {
+		t.Fatalf("Failed to add op %q: %v", spec.Name, err)
+	}
+	return op.Output(0)
+}
+
+// addBatchNorm adds a fused batch normalization of x, with the given name and
+// mode.
+func addBatchNorm(t *testing.T, graph *tf.Graph, name string, x tf.Output, isTraining bool) tf.Output {
+	param := func(paramName string) tf.Output {
+		value, err := tf.NewTensor([]float32{1})
+		if err != nil {
+			t.Fatalf("Failed to create tensor: %v", err)
+		}
+		return addOp(t, graph, tf.OpSpec{Type: "Const", Name: name + "/" + paramName,
+			Attrs: map[string]interface{}{"dtype": tf.Float, "value": value}})
+	}
+	return addOp(t, graph, tf.OpSpec{
+		Type: "FusedBatchNorm", Name: name,
+		Input: []tf.Input{x, param("scale"), param("offset"), param("mean"), param("variance")},
+		Attrs: map[string]interface{}{"is_training": isTraining},
+	})
+}
+
+func TestValidateGraph(t *testing.T) {
+	graph := tf.NewGraph()
+	x := addOp(t, graph, tf.OpSpec{Type: "Placeholder", Name: "board_features",
+		Attrs: map[string]interface{}{"dtype": tf.Float}})
+	inference := addBatchNorm(t, graph, "inference_bn", x, false)
+	training := addBatchNorm(t, graph, "training_bn", inference, true)
+	predictions := addOp(t, graph, tf.OpSpec{Type: "Identity", Name: "board_predictions",
+		Input: []tf.Input{training}})
+
+	// A training-mode op not feeding the predictions is fine.
+	addBatchNorm(t, graph, "unused_bn", x, true)
+
+	warnings := tensorflow.ValidateGraph(graph, predictions)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"training_bn"`) {
+		t.Errorf("Expected one warning about training_bn, got %q", warnings)
+	}
+
+	// Predictions computed before the training-mode op are fine.
+	if warnings := tensorflow.ValidateGraph(graph, inference); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for inference_bn, got %q", warnings)
+	}
+}
+
+func TestValidateGraphMCDropout(t *testing.T) {
+	newGraph := func(mcDropout bool) (*tf.Graph, tf.Output) {
+		graph := tf.NewGraph()
+		shape := addOp(t, graph, tf.OpSpec{Type: "Placeholder", Name: "shape",
+			Attrs: map[string]interface{}{"dtype": tf.Int32}})
+		random := addOp(t, graph, tf.OpSpec{Type: "RandomUniform", Name: "dropout/random",
+			Input: []tf.Input{shape}, Attrs: map[string]interface{}{"dtype": tf.Float}})
+		if mcDropout {
+			addOp(t, graph, tf.OpSpec{Type: "Placeholder", Name: tensorflow.MC_DROPOUT_TENSOR,
+				Attrs: map[string]interface{}{"dtype": tf.Bool}})
+		}
+		return graph, addOp(t, graph, tf.OpSpec{Type: "Identity", Name: "board_predictions",
+			Input: []tf.Input{random}})
+	}
+
+	// Random ops are reported, unless the graph supports MC-dropout.
+	if graph, predictions := newGraph(false); len(tensorflow.ValidateGraph(graph, predictions)) != 1 {
+		t.Errorf("Expected a warning about the random op, got %q", tensorflow.ValidateGraph(graph, predictions))
+	}
+	if graph, predictions := newGraph(true); len(tensorflow.ValidateGraph(graph, predictions)) != 0 {
+		t.Errorf("Expected no warnings with MC-dropout, got %q", tensorflow.ValidateGraph(graph, predictions))
+	}
+}
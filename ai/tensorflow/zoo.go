@@ -0,0 +1,140 @@
+package tensorflow
+
+// Model zoo: selects the strongest among the checkpoints accumulated in a
+// directory, so it can be used for play.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// ZooCheckpoint is a checkpoint found in a ModelZoo directory. The model is
+// loaded with New(Basename, ...).
+type ZooCheckpoint struct {
+	Basename string
+
+	// GlobalStep saved with the checkpoint, or -1 if the checkpoint has no
+	// metadata.
+	GlobalStep int
+}
+
+// ZooEvaluator returns the validation loss of the given checkpoint: the lower the
+// better. It can be based on the loss over a validation set (see ValidationLoss),
+// or on the results of matches against a reference player.
+type ZooEvaluator func(checkpoint ZooCheckpoint) (loss float32, err error)
+
+// ModelZoo evaluates the checkpoints in a directory, and picks the best one. The
+// evaluations are cached by the checkpoint's basename and global step, so
+// checkpoints are not re-evaluated as new ones are added, but they are if they
+// are overwritten by a later save. It is safe for concurrent use.
+type ModelZoo struct {
+	Dir      string
+	Evaluate ZooEvaluator
+
+	mu    sync.Mutex
+	cache map[ZooCheckpoint]float32
+}
+
+// NewModelZoo creates a ModelZoo for the checkpoints in dir.
+func NewModelZoo(dir string, evaluate ZooEvaluator) *ModelZoo {
+	return &ModelZoo{Dir: dir, Evaluate: evaluate, cache: make(map[ZooCheckpoint]float32)}
+}
+
+// Checkpoints lists the checkpoints in the directory, that is, models with both
+// graph (`basename`.pb) and checkpoint saved. They are sorted by basename.
+func (z *ModelZoo) Checkpoints() ([]ZooCheckpoint, error) {
+	const indexSuffix = ".checkpoint.index"
+	indexFiles, err := filepath.Glob(filepath.Join(z.Dir, "*"+indexSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list checkpoints in %s: %v", z.Dir, err)
+	}
+	sort.Strings(indexFiles)
+	var checkpoints []ZooCheckpoint
+	for _, indexFile := range indexFiles {
+		basename := strings.TrimSuffix(indexFile, indexSuffix)
+		if !fileExists(basename + ".pb") {
+			glog.Warningf("Checkpoint %s has no graph %s.pb, skipping it", indexFile, basename)
+			continue
+		}
+		meta, found, err := readCheckpointMeta(basename + ".checkpoint.meta.json")
+		if err != nil {
+			return nil, err
+		}
+		step := int(meta.GlobalStep)
+		if !found {
+			step = -1
+		}
+		checkpoints = append(checkpoints, ZooCheckpoint{Basename: basename, GlobalStep: step})
+	}
+	return checkpoints, nil
+}
+
+// Best evaluates the checkpoints not yet evaluated, and returns the one with the
+// lowest loss.
+func (z *ModelZoo) Best() (best ZooCheckpoint, loss float32, err error) {
+	checkpoints, err := z.Checkpoints()
+	if err != nil {
+		return
+	}
+	if len(checkpoints) == 0 {
+		err = fmt.Errorf("No checkpoints found in %s", z.Dir)
+		return
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	found := false
+	for _, checkpoint := range checkpoints {
+		cpLoss, cached := z.cache[checkpoint]
+		if !cached || checkpoint.GlobalStep < 0 {
+			cpLoss, err = z.Evaluate(checkpoint)
+			if err != nil {
+				err = fmt.Errorf("Failed to evaluate checkpoint %s: %v", checkpoint.Basename, err)
+				return
+			}
+			if checkpoint.GlobalStep >= 0 {
+				z.cache[checkpoint] = cpLoss
+			}
+			glog.V(1).Infof("Checkpoint %s (step %d): loss=%g", checkpoint.Basename, checkpoint.GlobalStep, cpLoss)
+		}
+		if !found || cpLoss < loss {
+			best, loss, found = checkpoint, cpLoss, true
+		}
+	}
+	return
+}
+
+// LoadBest loads the best checkpoint, see Best.
+func (z *ModelZoo) LoadBest(sessionPoolSize int, forceCPU bool) (*Scorer, error) {
+	best, loss, err := z.Best()
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("Loading best checkpoint %s (step %d, loss=%g)", best.Basename, best.GlobalStep, loss)
+	return New(best.Basename, sessionPoolSize, forceCPU), nil
+}
+
+// ValidationLoss returns a ZooEvaluator that loads each checkpoint and returns its
+// total loss (see Scorer.Loss) on the given validation set.
+func ValidationLoss(boards []*Board, boardLabels []float32, actionsLabels [][]float32) ZooEvaluator {
+	return func(checkpoint ZooCheckpoint) (loss float32, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("Failed to evaluate: %v", r)
+			}
+		}()
+		s := New(checkpoint.Basename, 1, true)
+		return s.Loss(boards, boardLabels, actionsLabels).Total, nil
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
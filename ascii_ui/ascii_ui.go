@@ -50,6 +50,18 @@ func NewUI(color bool, clearScreen bool) *UI {
 }
 
 func (ui *UI) Run(board *Board) (*Board, error) {
+	return ui.RunWithPlayers(board, [NUM_PLAYERS]Player{nil, nil}, true)
+}
+
+// Player chooses the actions of a player that is not playing from the terminal,
+// e.g. an AI (see ai/players).
+type Player func(board *Board) Action
+
+// RunWithPlayers is like Run, but the actions of the players given are chosen by
+// them, instead of read from the terminal. Nil players play from the terminal.
+// If showPlayers is false, the boards are only printed for the players playing
+// from the terminal, and at the end.
+func (ui *UI) RunWithPlayers(board *Board, players [NUM_PLAYERS]Player, showPlayers bool) (*Board, error) {
 	for true {
 		if len(board.Derived.Actions) == 0 {
 			// Nothing to play, skip (by playing SKIP_ACTION)
@@ -60,9 +72,25 @@ func (ui *UI) Run(board *Board) (*Board, error) {
 			board = board.Act(SKIP_ACTION)
 		}
 		if board.IsFinished() {
+			if !showPlayers {
+				ui.Print(board)
+			}
 			ui.PrintWinner(board)
 			return board, nil
 		}
+		if player := players[board.NextPlayer]; player != nil {
+			if showPlayers {
+				ui.Print(board)
+			}
+			action := player(board)
+			if showPlayers {
+				fmt.Println()
+				ui.printPlayer(board)
+				fmt.Printf(" plays %s\n", action)
+			}
+			board = board.Act(action)
+			continue
+		}
 		for true {
 			ui.Print(board)
 			action, err := ui.ReadCommand(board)
@@ -368,7 +396,7 @@ func (ui *UI) printActions(b *Board) {
 
 func (ui *UI) printPlacementActions(b *Board) {
 	d := b.Derived
-	if len(d.PlacementPositions) == 0 {
+	if len(b.PlacementCells(b.NextPlayer)) == 0 {
 		return
 	}
 
@@ -0,0 +1,100 @@
+// bench measures the scoring throughput (boards/second) of a TensorFlow model,
+// across a sweep of batch sizes and session pool sizes.
+//
+// It uses Scorer.BatchScore, so features building, feeding and the evaluation of
+// the model are exercised exactly as they are during play. It can be used to size
+// hardware, and as a guard against performance regressions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/tensorflow"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+var (
+	flag_model      = flag.String("model", "", "Base name of the TensorFlow model to benchmark.")
+	flag_numBoards  = flag.Int("num_boards", 1000, "Number of random boards scored for each configuration.")
+	flag_maxMoves   = flag.Int("max_moves", 60, "Random boards are generated with up to this number of random moves.")
+	flag_batchSizes = flag.String("batch_sizes", "1,8,32,128", "Comma-separated list of batch sizes to benchmark.")
+	flag_poolSizes  = flag.String("pool_sizes", "1,2", "Comma-separated list of session pool sizes to benchmark.")
+	flag_seed       = flag.Int64("seed", 1, "Random seed used to generate the boards.")
+)
+
+func init() {
+	flag.BoolVar(&tensorflow.CpuOnly, "cpu", false, "Force to use CPU, even if GPU is available")
+}
+
+// parseSizes parses a comma-separated list of positive integers.
+func parseSizes(name, value string) (sizes []int) {
+	for _, part := range strings.Split(value, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || size < 1 {
+			log.Fatalf("Invalid --%s=%q: values must be positive integers", name, value)
+		}
+		sizes = append(sizes, size)
+	}
+	return
+}
+
+// benchmark scores all boards in batches of batchSize, with poolSize goroutines
+// so all sessions are kept busy, and returns the throughput in boards/second.
+func benchmark(scorer *tensorflow.Scorer, boards []*Board, batchSize, poolSize int) float64 {
+	batches := make(chan []*Board, poolSize)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for ii := 0; ii < poolSize; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				scorer.BatchScore(batch)
+			}
+		}()
+	}
+	for from := 0; from < len(boards); from += batchSize {
+		to := from + batchSize
+		if to > len(boards) {
+			to = len(boards)
+		}
+		batches <- boards[from:to]
+	}
+	close(batches)
+	wg.Wait()
+	return float64(len(boards)) / time.Since(start).Seconds()
+}
+
+func main() {
+	flag.Parse()
+	if *flag_model == "" {
+		log.Fatal("Please set --model to the base name of the TensorFlow model.")
+	}
+	if *flag_numBoards < 1 {
+		log.Fatalf("Invalid --num_boards=%d", *flag_numBoards)
+	}
+	batchSizes := parseSizes("batch_sizes", *flag_batchSizes)
+	poolSizes := parseSizes("pool_sizes", *flag_poolSizes)
+
+	boards := ai.RandomBoards(*flag_numBoards, *flag_maxMoves, rand.New(rand.NewSource(*flag_seed)))
+	glog.Infof("Generated %d random boards", len(boards))
+
+	fmt.Printf("%10s %10s %14s\n", "pool_size", "batch_size", "boards/second")
+	for _, poolSize := range poolSizes {
+		scorer := tensorflow.New(*flag_model, poolSize, tensorflow.CpuOnly)
+		// Warm up: the first calls include TensorFlow's lazy initialization.
+		scorer.BatchScore(boards[:1])
+		for _, batchSize := range batchSizes {
+			fmt.Printf("%10d %10d %14.1f\n", poolSize, batchSize, benchmark(scorer, boards, batchSize, poolSize))
+		}
+	}
+}
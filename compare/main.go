@@ -0,0 +1,94 @@
+// compare replays a saved match and scores every position with two models, to
+// find where a newly trained model disagrees with the previous one.
+//
+// For each move it outputs the score each model gives to the board, the
+// difference, and the action each model would have chosen (see ai.BestMove), in
+// CSV or JSON format. E.g.:
+//
+//	compare --matches=games.bin --match_idx=3 --old=tf,model=old --new=tf,model=new
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	"github.com/janpfeifer/hiveGo/ai/tensorflow"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+var (
+	flag_matches  = flag.String("matches", "", "File with saved matches, e.g. by the trainer with --save_matches.")
+	flag_matchIdx = flag.Int("match_idx", 0, "Index of the match to compare in the file.")
+	flag_old      = flag.String("old", "", "AI configuration of the old model, e.g. \"tf,model=old\".")
+	flag_new      = flag.String("new", "", "AI configuration of the new model, e.g. \"tf,model=new\".")
+	flag_format   = flag.String("format", "csv", "Output format: csv or json.")
+	flag_output   = flag.String("output", "", "Output file. If empty, the comparison is written to stdout.")
+)
+
+func init() {
+	flag.BoolVar(&tensorflow.CpuOnly, "cpu", false, "Force to use CPU, even if GPU is available")
+}
+
+// loadMatch reads the match with the given index from the file.
+func loadMatch(filename string, matchIdx int) ai.GameRecord {
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Fatalf("Cannot open '%s' for reading: %v", filename, err)
+	}
+	defer file.Close()
+	dec := gob.NewDecoder(file)
+	for ii := 0; ; ii++ {
+		initial, actions, _, err := LoadMatch(dec)
+		if err == io.EOF {
+			log.Fatalf("File '%s' has only %d matches, can't read --match_idx=%d", filename, ii, matchIdx)
+		}
+		if err != nil {
+			log.Fatalf("Failed to read match #%d from '%s': %v", ii, filename, err)
+		}
+		if ii == matchIdx {
+			initial.BuildDerived()
+			return ai.NewGameRecord(initial, actions)
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *flag_matches == "" || *flag_old == "" || *flag_new == "" {
+		log.Fatal("Please set --matches, --old and --new")
+	}
+	if *flag_format != "csv" && *flag_format != "json" {
+		log.Fatalf("Invalid --format=%q, it must be csv or json", *flag_format)
+	}
+	game := loadMatch(*flag_matches, *flag_matchIdx)
+	oldScorer := players.NewAIPlayer(*flag_old, false).Scorer
+	newScorer := players.NewAIPlayer(*flag_new, false).Scorer
+	comparisons := ai.CompareScorers(game, oldScorer, newScorer)
+
+	var w io.Writer = os.Stdout
+	if *flag_output != "" {
+		file, err := os.Create(*flag_output)
+		if err != nil {
+			log.Fatalf("Failed to create '%s': %v", *flag_output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	var err error
+	if *flag_format == "csv" {
+		err = ai.WriteComparisonsCSV(w, comparisons)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(comparisons)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write comparison: %v", err)
+	}
+}
@@ -57,10 +57,10 @@ func loadImageResources() {
 
 // Parameters used to draw the main board.
 type drawingParams struct {
-	width, height       float64
-	face                float64
-	xc, yc              float64
-	hexWidth, hexHeight float64
+	width, height float64
+	face          float64
+	xc, yc        float64
+	layout        HexLayout
 }
 
 func newDrawingParams(da *gtk.DrawingArea) (dp *drawingParams) {
@@ -71,31 +71,19 @@ func newDrawingParams(da *gtk.DrawingArea) (dp *drawingParams) {
 		face:   standardFace * zoomFactor,
 	}
 	dp.xc, dp.yc = dp.width/2.0+shiftX, dp.height/2.0+shiftY
-	dp.hexWidth = 1.5 * dp.face
-	dp.hexHeight = 2. * hexTriangleHeight(dp.face)
+	dp.layout = HexLayout{Face: dp.face}
 	return
 }
 
 func (dp *drawingParams) posToXY(pos Pos, stackCount int) (x, y float64) {
-	x = dp.xc + float64(pos.X())*dp.hexWidth
-	y = dp.yc + float64(pos.Y())*dp.hexHeight
-	if pos.X()%2 != 0 {
-		y += hexTriangleHeight(dp.face)
-	}
-	x += float64(stackCount) * 3.0 * zoomFactor
-	y -= float64(stackCount) * 3.0 * zoomFactor
+	x, y = dp.layout.PosToXY(pos)
+	x += dp.xc + float64(stackCount)*3.0*zoomFactor
+	y += dp.yc - float64(stackCount)*3.0*zoomFactor
 	return
 }
 
 func (dp *drawingParams) XYToPos(x, y float64) Pos {
-	x -= dp.xc
-	y -= dp.yc
-	posX := int8(math.Round(x / dp.hexWidth))
-	if posX%2 != 0 {
-		y -= hexTriangleHeight(dp.face)
-	}
-	posY := int8(math.Round(y / dp.hexHeight))
-	return Pos{posX, posY}
+	return dp.layout.XYToPos(x-dp.xc, y-dp.yc)
 }
 
 func drawMainBoard(da *gtk.DrawingArea, cr *cairo.Context) {
@@ -138,6 +126,16 @@ func drawMainBoard(da *gtk.DrawingArea, cr *cairo.Context) {
 
 	}
 
+	// Draw policy heatmap.
+	if showHeatmap && !finished {
+		drawHeatmap(da, cr, dp)
+	}
+
+	// Draw pieces contributions to the score.
+	if showContributions {
+		drawContributions(da, cr, dp)
+	}
+
 	// Draw placement candidates.
 	if selectedOffBoardPiece != NO_PIECE {
 		drawPlacementPositions(da, cr, dp)
@@ -151,6 +149,70 @@ func drawMainBoard(da *gtk.DrawingArea, cr *cairo.Context) {
 	cr.Clip()
 }
 
+// drawHeatmap fills the target positions of the actions with a color intensity
+// proportional to the probabilities given by the policy of the AI.
+func drawHeatmap(da *gtk.DrawingArea, cr *cairo.Context, dp *drawingParams) {
+	cr.Save()
+	defer cr.Restore()
+
+	boardHeatmap := policyHeatmap()
+	maxValue := boardHeatmap.Max()
+	if maxValue <= 0 {
+		return
+	}
+	for pos, value := range boardHeatmap {
+		fillBoardHexagon(cr, dp, pos, 0.878, 0.125, 0.125, SVG_HEATMAP_MAX_OPACITY*float64(value/maxValue))
+	}
+}
+
+// drawContributions fills the positions of the pieces with a color intensity
+// proportional to their contribution to the score of the board (see
+// ai.PieceContributions): green for the pieces helping the next player, and red
+// for the ones hurting it.
+func drawContributions(da *gtk.DrawingArea, cr *cairo.Context, dp *drawingParams) {
+	cr.Save()
+	defer cr.Restore()
+
+	boardContributions := pieceContributions()
+	maxValue := float32(0)
+	for _, value := range boardContributions {
+		if value < 0 {
+			value = -value
+		}
+		if value > maxValue {
+			maxValue = value
+		}
+	}
+	if maxValue <= 0 {
+		return
+	}
+	for pos, value := range boardContributions {
+		if value >= 0 {
+			fillBoardHexagon(cr, dp, pos, 0.125, 0.678, 0.125, SVG_HEATMAP_MAX_OPACITY*float64(value/maxValue))
+		} else {
+			fillBoardHexagon(cr, dp, pos, 0.878, 0.125, 0.125, SVG_HEATMAP_MAX_OPACITY*float64(-value/maxValue))
+		}
+	}
+}
+
+// fillBoardHexagon fills the hexagon of the given board position (the top of its
+// stack) with the given color.
+func fillBoardHexagon(cr *cairo.Context, dp *drawingParams, pos Pos, r, g, b, alpha float64) {
+	count := int(board.CountAt(pos))
+	if count > 0 {
+		count--
+	}
+	x, y := dp.posToXY(pos, count)
+	corners := dp.layout.Corners(x, y)
+	cr.MoveTo(corners[0][0], corners[0][1])
+	for _, corner := range corners[1:] {
+		cr.LineTo(corner[0], corner[1])
+	}
+	cr.ClosePath()
+	cr.SetSourceRGBA(r, g, b, alpha)
+	cr.Fill()
+}
+
 func drawPlacementPositions(da *gtk.DrawingArea, cr *cairo.Context, dp *drawingParams) {
 	posMap := placementPositions()
 	for pos := range posMap {
@@ -235,7 +297,7 @@ func offBoardPositionToPiece(da *gtk.DrawingArea, x, y float64) (piece Piece) {
 
 // hexTriangleHeight returns the height of the triangles that make up for an hexagon, given the face lenght.
 func hexTriangleHeight(face float64) float64 {
-	return 0.866 * face // sqrt(3)/2 * face
+	return HexLayout{Face: face}.TriangleHeight()
 }
 
 func drawBackground(da *gtk.DrawingArea, cr *cairo.Context, r, g, b float64, fill bool, lineWidth float64) {
@@ -256,16 +318,12 @@ func drawBackground(da *gtk.DrawingArea, cr *cairo.Context, r, g, b float64, fil
 
 // drawHexagon will draw it with the given face length centered at xc, yc.
 func drawHexagon(da *gtk.DrawingArea, cr *cairo.Context, face, xc, yc float64) {
-	height := hexTriangleHeight(face)
-
-	// Start on left corner and move clockwise.
-	cr.MoveTo(xc-face, yc)
-	cr.LineTo(xc-face/2.0, yc-height)
-	cr.LineTo(xc+face/2.0, yc-height)
-	cr.LineTo(xc+face, yc)
-	cr.LineTo(xc+face/2.0, yc+height)
-	cr.LineTo(xc-face/2.0, yc+height)
-	cr.LineTo(xc-face, yc)
+	corners := HexLayout{Face: face}.Corners(xc, yc)
+	cr.MoveTo(corners[0][0], corners[0][1])
+	for _, corner := range corners[1:] {
+		cr.LineTo(corner[0], corner[1])
+	}
+	cr.LineTo(corners[0][0], corners[0][1])
 	cr.Stroke()
 }
 
@@ -8,11 +8,14 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
+	"github.com/janpfeifer/hiveGo/ai"
 	"github.com/janpfeifer/hiveGo/ai/players"
+	_ "github.com/janpfeifer/hiveGo/ai/serving"
 	"github.com/janpfeifer/hiveGo/ai/tensorflow"
 	. "github.com/janpfeifer/hiveGo/state"
 )
@@ -21,12 +24,15 @@ var _ = fmt.Printf
 
 var (
 	flag_players = [2]*string{
-		flag.String("p0", "hotseat", "First player: hotseat, ai"),
-		flag.String("p1", "hotseat", "Second player: hotseat, ai"),
+		flag.String("p0", "hotseat", "First player: hotseat, ai or ai:<config>, where <config> is "+
+			"the AI configuration for this player, e.g. ai:ab,max_depth=2,model=modelA"),
+		flag.String("p1", "hotseat", "Second player: hotseat, ai or ai:<config>, see --p0."),
 	}
-	flag_aiConfig = flag.String("ai", "", "Configuration string for the AI.")
+	flag_aiConfig = flag.String("ai", "", "Configuration string for the AI players given simply as \"ai\".")
 	flag_maxMoves = flag.Int(
 		"max_moves", 200, "Max moves before game is assumed to be a draw.")
+	flag_noQueenFirstMove = flag.Bool("no_queen_first_move", false,
+		"Tournament rule: players can't place the queen as their first piece.")
 
 	// TODO: find directory automatically basaed on GOPATH.
 	flag_resources = flag.String("resources", "", "Directory with resources. "+
@@ -35,8 +41,19 @@ var (
 	// Save match at end.
 	flag_saveMatch = flag.String("save", "", "File name where to save match. Matches are appendeded to given file.")
 
-	// Sequence of boards that make up for the game. Used for undo-ing actions.
-	gameSeq []*Board
+	flag_exportSVG = flag.String("export_svg", "hive_board.svg",
+		"File name where to export an image of the board (with the policy heatmap, if shown) in SVG format, with ctrl+E.")
+
+	flag_variations = flag.Bool("variations", false,
+		"Keep the moves undone as variations of the game, instead of discarding them when a different "+
+			"move is played. Use ctrl+Left/ctrl+Right to switch between variations.")
+
+	flag_slowMove = flag.Duration("slow_move", 10*time.Second, "AI moves that take longer than this are "+
+		"reported in the status bar. The time of every AI move is logged. Set to 0 to disable.")
+
+	// Tree of boards that make up for the game. Used for undo-ing actions and
+	// navigating the variations.
+	game *GameTree
 )
 
 func init() {
@@ -45,6 +62,10 @@ func init() {
 
 const APP_ID = "com.github.janpfeifer.hiveGo.gnome-hive"
 
+// MAX_DIFFICULTY is the AI at full strength, each level below adds one level of
+// handicap.
+const MAX_DIFFICULTY = 5
+
 // Board in use. It will always be set.
 var (
 	initial, board *Board
@@ -52,10 +73,40 @@ var (
 	scores         []float32
 	started        bool // Starts as false, and set to true once a game is running.
 
+	// difficulty of the AI players, from 0 to MAX_DIFFICULTY, selected in the UI.
+	// Lower difficulties are implemented with the "handicap" AI parameter.
+	difficulty = MAX_DIFFICULTY
+
+	// seatsSwapped indicates that the player configured by --p0 plays second, and
+	// the one configured by --p1 plays first.
+	seatsSwapped bool
+
 	// Hints for the UI.
 	finished  bool
 	aiPlayers = [2]players.Player{nil, nil}
 	nextIsAI  bool
+
+	// configuredPlayers are the AI players configured by --p0 and --p1 (indexed
+	// by flag, not by seat), without handicap. Created when first needed.
+	configuredPlayers [2]*players.SearcherScorerPlayer
+
+	// showHeatmap overlays the policy of the AI on the board, toggled in the UI.
+	showHeatmap bool
+
+	// heatmapScorer is used for the heatmap when no AI is playing. It's created
+	// from --ai when first needed.
+	heatmapScorer ai.Scorer
+
+	// Heatmap of heatmapBoard, cached since the board is redrawn often.
+	heatmap      Heatmap
+	heatmapBoard *Board
+
+	// showContributions overlays the contribution of each piece to the score of
+	// the board, toggled in the UI. It's computed on demand, and cached for
+	// contributionsBoard.
+	showContributions  bool
+	contributions      Heatmap
+	contributionsBoard *Board
 )
 
 func findResourcesDir() {
@@ -92,16 +143,92 @@ func openForAppending(filename string) io.WriteCloser {
 	return file
 }
 
+// seatFlag returns the index of the flag (--p0 or --p1) configuring the player
+// seated at the given position, taking into account if seats were swapped.
+func seatFlag(player int) int {
+	if seatsSwapped {
+		return 1 - player
+	}
+	return player
+}
+
+// playerConfig parses the flag (--p0 or --p1) of the player seated in the given
+// position, and returns whether it is an AI player and its configuration. Plain
+// "ai" uses the configuration given by --ai.
+func playerConfig(player int) (isAI bool, config string) {
+	isAI, config, err := players.ParsePlayerSpec(*flag_players[seatFlag(player)], *flag_aiConfig)
+	if err != nil {
+		log.Fatalf("Invalid --p%d: %v", seatFlag(player), err)
+	}
+	return
+}
+
+// seatsDescription describes who plays each seat, e.g. "AI vs Hotseat".
+func seatsDescription() string {
+	var parts [2]string
+	for ii := 0; ii < 2; ii++ {
+		parts[ii] = "Hotseat"
+		if isAI, _ := playerConfig(ii); isAI {
+			parts[ii] = "AI"
+		}
+	}
+	return fmt.Sprintf("%s (first) vs %s", parts[0], parts[1])
+}
+
+// swapSides swaps the seats of the players configured by --p0 and --p1 before a
+// game starts, so e.g. the AI can make the first move. The next game started will
+// use the new seats.
+func swapSides() {
+	if started && !finished {
+		log.Printf("Can't swap sides during a game")
+		return
+	}
+	seatsSwapped = !seatsSwapped
+	aiPlayers[0], aiPlayers[1] = aiPlayers[1], aiPlayers[0]
+	glog.Infof("Seats: %s", seatsDescription())
+	updateSubtitle()
+}
+
+// newAIPlayer returns the AI player seated in the given position, with the
+// handicap of the difficulty selected. The player configured by the flag is
+// created once, which validates its configuration, and the handicap only
+// rebuilds its searcher.
+func newAIPlayer(player int) players.Player {
+	idx := seatFlag(player)
+	if configuredPlayers[idx] == nil {
+		_, config := playerConfig(player)
+		var err error
+		configuredPlayers[idx], err = players.NewAIPlayerWithError(config, true)
+		if err != nil {
+			log.Fatalf("Invalid AI configuration for --p%d=%s: %v", idx, *flag_players[idx], err)
+		}
+	}
+	aiPlayer := configuredPlayers[idx]
+	if difficulty < MAX_DIFFICULTY {
+		aiPlayer = aiPlayer.WithSearchParams(fmt.Sprintf("handicap=%d", MAX_DIFFICULTY-difficulty))
+	}
+	glog.Infof("Player %d: %s", player, aiPlayer)
+	return aiPlayer
+}
+
 func main() {
 	flag.Parse()
 	if *flag_maxMoves <= 0 {
 		log.Fatalf("Invalid --max_moves=%d", *flag_maxMoves)
 	}
+	for ii := 0; ii < 2; ii++ {
+		// Validate the players configuration before starting the UI, by creating
+		// the AI players.
+		if isAI, _ := playerConfig(ii); isAI {
+			newAIPlayer(ii)
+		}
+	}
 	findResourcesDir()
 
 	// Build initial board: it is used only for drawing available pieces,
 	board = NewBoard()
 	board.MaxMoves = *flag_maxMoves
+	board.NoQueenFirstMove = *flag_noQueenFirstMove
 	board.BuildDerived()
 
 	// Creates and runs main window.
@@ -115,22 +242,20 @@ func newGame() {
 	// Create board.
 	board = NewBoard()
 	board.MaxMoves = *flag_maxMoves
+	board.NoQueenFirstMove = *flag_noQueenFirstMove
 	board.BuildDerived()
 	initial = board
 	actions = nil
 	scores = nil
-	gameSeq := make([]*Board, 0, *flag_maxMoves)
-	gameSeq = append(gameSeq, board)
+	game = NewGameTree(board, *flag_variations)
+	puzzle = nil
+	updateSubtitle()
 
 	// Create players:
 	for ii := 0; ii < 2; ii++ {
-		switch {
-		case *flag_players[ii] == "hotseat":
-			continue
-		case *flag_players[ii] == "ai":
-			aiPlayers[ii] = players.NewAIPlayer(*flag_aiConfig, true)
-		default:
-			log.Fatalf("Unknown player type --p%d=%s", ii, *flag_players[ii])
+		aiPlayers[ii] = nil
+		if isAI, _ := playerConfig(ii); isAI {
+			aiPlayers[ii] = newAIPlayer(ii)
 		}
 	}
 
@@ -143,25 +268,44 @@ func newGame() {
 
 	// AI starts playing ?
 	if aiPlayers[board.NextPlayer] != nil {
-		action, _, _, _ := aiPlayers[board.NextPlayer].Play(board)
-		executeAction(action)
+		action, _, score, actionProbs := aiPlayers[board.NextPlayer].Play(board)
+		executeActionWithEval(action, NewMoveEval(board, score, actionProbs))
+	}
+}
+
+// humanAction executes the action chosen by the human in the UI, or checks it
+// against the solution if playing a puzzle.
+func humanAction(action Action) {
+	if puzzle != nil {
+		puzzleAction(action)
+		return
 	}
+	executeAction(action)
 }
 
 func executeAction(action Action) {
+	executeActionWithEval(action, MoveEval{})
+}
+
+// executeActionWithEval executes the action, along with the evaluation of the
+// board by the AI that chose it, saved with the match for game review.
+func executeActionWithEval(action Action, eval MoveEval) {
 	glog.Infof("Player %d played %s", board.NextPlayer, action)
-	board = board.Act(action)
+	previous := board
+	board = game.Act(action)
+	if eval.Evaluated {
+		game.Current.Eval = eval
+	}
+	if glog.V(1) {
+		glog.Infof("Board changes:\n%s", DiffBoards(previous, board))
+	}
 	actions = append(actions, action)
-	scores = append(scores, 0)
-	gameSeq = append(gameSeq, board)
+	scores = append(scores, eval.Score)
 	finished = board.IsFinished()
 	if !finished && len(board.Derived.Actions) == 0 {
-		// Player has no available moves, skip.
+		// Player has no available moves, skip. If the opponent can't move
+		// either, the board after the skip is finished, in a draw.
 		log.Printf("No action available, automatic action.")
-		if action.IsSkipAction() {
-			// Two skip actions in a row.
-			log.Fatal("No moves avaialble to either players !?")
-		}
 		// Recurse to a skip action.
 		executeAction(SKIP_ACTION)
 		return
@@ -172,7 +316,7 @@ func executeAction(action Action) {
 		log.Printf("Saving match to %s", *flag_saveMatch)
 		file := openForAppending(*flag_saveMatch)
 		enc := gob.NewEncoder(file)
-		if err := SaveMatch(enc, initial.MaxMoves, actions, scores); err != nil {
+		if err := SaveMatchWithEvals(enc, initial.MaxMoves, actions, scores, game.Evals()); err != nil {
 			log.Printf("Failed to save match to %s: %v", *flag_saveMatch, err)
 		}
 		file.Close()
@@ -182,14 +326,135 @@ func executeAction(action Action) {
 func undoAction() {
 	// Can't undo until it's human turn. TODO: add support for interrupting
 	// AI.
-	if nextIsAI || finished || len(gameSeq) < 2 {
+	if nextIsAI || finished || puzzle != nil || game == nil || game.Current.Parent == nil || game.Current.Parent.Parent == nil {
 		return
 	}
-	gameSeq = gameSeq[0 : len(gameSeq)-2]
-	board = gameSeq[len(gameSeq)-1]
+	game.Undo()
+	game.Undo()
+	followGameTree()
+}
+
+// redoAction redoes the actions undone, up to the next turn of the same
+// player.
+func redoAction() {
+	if nextIsAI || puzzle != nil || game == nil {
+		return
+	}
+	if game.Redo() {
+		game.Redo()
+		followGameTree()
+	}
+}
+
+// switchVariation moves to the next (delta=1) or previous (delta=-1) variation
+// of the game, see GameTree.SwitchVariation. Only with --variations.
+func switchVariation(delta int) {
+	if nextIsAI || game == nil {
+		return
+	}
+	if game.SwitchVariation(delta) {
+		glog.Infof("Switched to variation: %v", game.Actions())
+		followGameTree()
+	}
+}
+
+// followGameTree updates the game after moving in the game tree.
+func followGameTree() {
+	board = game.Current.Board
+	actions = game.Actions()
+	scores = make([]float32, len(actions))
+	for ii, eval := range game.Evals() {
+		scores[ii] = eval.Score
+	}
+	finished = board.IsFinished()
 	followAction()
 }
 
+// toggleHeatmap shows or hides the policy heatmap.
+func toggleHeatmap() {
+	showHeatmap = !showHeatmap
+	glog.Infof("Policy heatmap shown: %v", showHeatmap)
+	mainWindow.QueueDraw()
+}
+
+// policyScorer returns the scorer of the first AI player, or if no AI is
+// playing, the one configured by --ai.
+func policyScorer() ai.Scorer {
+	for _, player := range aiPlayers {
+		if aiPlayer, ok := player.(*players.SearcherScorerPlayer); ok {
+			return aiPlayer.Scorer
+		}
+	}
+	if heatmapScorer == nil {
+		heatmapScorer = players.NewAIPlayer(*flag_aiConfig, false).Scorer
+	}
+	return heatmapScorer
+}
+
+// policyHeatmap returns the probabilities of the actions of the current board,
+// aggregated by target position (see ActionsHeatmap).
+func policyHeatmap() Heatmap {
+	if heatmapBoard == board {
+		return heatmap
+	}
+	_, actionProbs := policyScorer().Score(board)
+	if actionProbs == nil && board.NumActions() > 0 {
+		glog.Warningf("Scorer %v has no policy, heatmap is empty", policyScorer())
+	}
+	heatmap = ActionsHeatmap(board, actionProbs)
+	heatmapBoard = board
+	return heatmap
+}
+
+// toggleContributions shows or hides the pieces contributions to the score.
+func toggleContributions() {
+	showContributions = !showContributions
+	glog.Infof("Pieces contributions shown: %v", showContributions)
+	mainWindow.QueueDraw()
+}
+
+// pieceContributions returns the contribution of each piece of the current board
+// to its score, given by the policy scorer (see ai.PieceContributions).
+func pieceContributions() Heatmap {
+	if contributionsBoard == board {
+		return contributions
+	}
+	var score float32
+	score, contributions = ai.PieceContributions(board, policyScorer())
+	contributionsBoard = board
+	if glog.V(1) {
+		glog.V(1).Infof("Score %.2f for player %d, pieces contributions:", score, board.NextPlayer)
+		for pos, value := range contributions {
+			player, piece, _ := board.PieceAt(pos)
+			glog.V(1).Infof("  player %d %s at %v: %+.2f", player, PieceNames[piece], pos, value)
+		}
+	}
+	return contributions
+}
+
+// exportSVG saves an image of the board to --export_svg, with the policy heatmap
+// if it is being shown.
+func exportSVG() {
+	if !started {
+		return
+	}
+	var boardHeatmap Heatmap
+	if showHeatmap {
+		boardHeatmap = policyHeatmap()
+	}
+	file, err := os.Create(*flag_exportSVG)
+	if err != nil {
+		log.Printf("Failed to create %s: %v", *flag_exportSVG, err)
+		return
+	}
+	defer file.Close()
+	if err = ExportSVGWithHeatmap(board, file, boardHeatmap); err != nil {
+		log.Printf("Failed to export board to %s: %v", *flag_exportSVG, err)
+		return
+	}
+	log.Printf("Board exported to %s", *flag_exportSVG)
+}
+
 // Setting that come after executing an action.
 func followAction() {
 	selectedOffBoardPiece = NO_PIECE
@@ -197,10 +462,26 @@ func followAction() {
 	nextIsAI = !finished && aiPlayers[board.NextPlayer] != nil
 	if nextIsAI {
 		// Start AI thinking on a separate thread.
+		b := board
 		go func() {
-			action, _, _, _ := aiPlayers[board.NextPlayer].Play(board)
-			glib.IdleAdd(func() { executeAction(action) })
+			action, _, score, actionProbs, timing := players.PlayTimed(aiPlayers[b.NextPlayer], b)
+			glog.Infof("AI %s", timing)
+			eval := NewMoveEval(b, score, actionProbs)
+			glib.IdleAdd(func() {
+				showMoveTiming(timing)
+				executeActionWithEval(action, eval)
+			})
 		}()
 	}
 	mainWindow.QueueDraw()
 }
+
+// showMoveTiming warns in the status bar if the AI move was slow, see --slow_move.
+func showMoveTiming(timing players.MoveTiming) {
+	if timing.Slow(*flag_slowMove) {
+		log.Printf("Slow AI move: %s", timing)
+		setStatus(fmt.Sprintf("Slow AI move: %s (more than %s)", timing, *flag_slowMove))
+	} else {
+		setStatus("")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/golang/glog"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+var (
+	flag_puzzles = flag.String("puzzles", "",
+		"File with puzzles, one per line, see state.LoadPuzzles. Use ctrl+U to play the next puzzle.")
+
+	// Puzzles loaded from --puzzles, and the one being played, if any.
+	puzzles     []*Puzzle
+	puzzleIdx   = -1
+	puzzle      *Puzzle
+	puzzleStep  int
+	puzzleBoard *Board // Board of the current puzzleStep.
+)
+
+// loadPuzzles reads the puzzles from --puzzles, the first time it's called.
+func loadPuzzles() {
+	if puzzles != nil || *flag_puzzles == "" {
+		return
+	}
+	file, err := os.Open(*flag_puzzles)
+	if err != nil {
+		log.Printf("Failed to open puzzles file %s: %v", *flag_puzzles, err)
+		return
+	}
+	defer file.Close()
+	puzzles, err = LoadPuzzles(file)
+	if err != nil {
+		log.Printf("Failed to load puzzles from %s: %v", *flag_puzzles, err)
+		puzzles = nil
+		return
+	}
+	glog.Infof("Loaded %d puzzles from %s", len(puzzles), *flag_puzzles)
+}
+
+// nextPuzzle starts the next puzzle from --puzzles, cycling back to the first one
+// after the last. The human plays the side to move, and the replies of the
+// opponent are taken from the solution.
+func nextPuzzle() {
+	if nextIsAI {
+		return
+	}
+	loadPuzzles()
+	if len(puzzles) == 0 {
+		log.Printf("No puzzles available, use --puzzles to load them")
+		return
+	}
+	puzzleIdx = (puzzleIdx + 1) % len(puzzles)
+	puzzle = puzzles[puzzleIdx]
+	puzzleStep = 0
+
+	board = puzzle.Board
+	puzzleBoard = board
+	initial = board
+	actions = nil
+	scores = nil
+	game = NewGameTree(board, false)
+	for ii := range aiPlayers {
+		aiPlayers[ii] = nil
+	}
+
+	started = true
+	finished = false
+	zoomFactor = 1.
+	shiftX, shiftY = 0., 0.
+	puzzleFeedback(fmt.Sprintf("Puzzle %d/%d: %s -- player %d to play", puzzleIdx+1, len(puzzles),
+		puzzle.Name, board.NextPlayer))
+	followAction()
+}
+
+// puzzleAction checks the action of the human against the solution of the
+// puzzle, giving feedback. Wrong actions are not played, so the human can try
+// again. Correct ones are played, followed by the reply of the opponent.
+func puzzleAction(action Action) {
+	result, reply, err := puzzle.Check(puzzleStep, puzzleBoard, action)
+	if err != nil {
+		log.Printf("Puzzle: %v", err)
+		return
+	}
+	switch result {
+	case PUZZLE_WRONG:
+		puzzleFeedback(fmt.Sprintf("%s: %s is not the solution, try again", puzzle.Name, action.Notation()))
+		selectedOffBoardPiece = NO_PIECE
+		hasSelectedPiece = false
+		mainWindow.QueueDraw()
+	case PUZZLE_SOLVED:
+		puzzleFeedback(fmt.Sprintf("%s: solved! ctrl+U for the next puzzle", puzzle.Name))
+		executeAction(action)
+		finished = true
+		puzzle = nil
+	case PUZZLE_CORRECT:
+		puzzleFeedback(fmt.Sprintf("%s: correct, opponent replied %s", puzzle.Name, reply.Notation()))
+		executeAction(action)
+		executeAction(reply)
+		puzzleStep += 2
+		puzzleBoard = board
+	}
+}
+
+// puzzleFeedback shows the message in the header.
+func puzzleFeedback(msg string) {
+	glog.Info(msg)
+	headerBar.SetSubtitle(msg)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/golang/glog"
 	"github.com/gotk3/gotk3/cairo"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
@@ -15,9 +16,14 @@ var _ = fmt.Printf
 
 var (
 	mainWindow      *gtk.Window
+	headerBar       *gtk.HeaderBar
 	mainDrawing     *gtk.DrawingArea
 	offBoardDrawing [2]*gtk.DrawingArea
 	cairoCtx        *cairo.Context
+
+	// Status bar, used e.g. to report slow AI moves.
+	statusBar     *gtk.Statusbar
+	statusContext uint
 )
 
 var (
@@ -194,6 +200,12 @@ func createMainWindow() {
 	box.PackStart(offBoardDrawing[0], false, true, 0)
 	box.PackStart(mainDrawing, true, true, 0)
 	box.PackStart(offBoardDrawing[1], false, true, 0)
+	statusBar, err = gtk.StatusbarNew()
+	if err != nil {
+		log.Fatal("Unable to create status bar:", err)
+	}
+	statusContext = statusBar.GetContextId("moves")
+	box.PackStart(statusBar, false, true, 0)
 	win.Add(box)
 
 	// Set the default window size.
@@ -206,9 +218,10 @@ func createHeaderWithMenu(win *gtk.Window) {
 	if err != nil {
 		log.Fatal("Could not create header bar:", err)
 	}
+	headerBar = header
 	header.SetShowCloseButton(true)
 	header.SetTitle("gnome-hive")
-	header.SetSubtitle("Hive implementation in Go")
+	updateSubtitle()
 
 	// Create a menu button.
 	mbtn, err := gtk.MenuButtonNew()
@@ -222,8 +235,36 @@ func createHeaderWithMenu(win *gtk.Window) {
 	menu.Append("New Game - ctrl+N", "win.new_game")
 	menu.Append("Quit - ctrl+Q", "win.quit")
 	menu.Append("Undo - ctrl+Z", "win.undo")
+	menu.Append("Redo - ctrl+Y", "win.redo")
+	menu.Append("Previous Variation - ctrl+Left", "win.previous_variation")
+	menu.Append("Next Variation - ctrl+Right", "win.next_variation")
+	menu.Append("Next Puzzle - ctrl+U", "win.next_puzzle")
+	menu.Append("Swap Sides (before game) - ctrl+S", "win.swap_sides")
+	menu.Append("Show/Hide Policy Heatmap - ctrl+H", "win.heatmap")
+	menu.Append("Show/Hide Pieces Contributions - ctrl+P", "win.contributions")
+	menu.Append("Export SVG - ctrl+E", "win.export_svg")
 	mbtn.SetMenuModel(&menu.MenuModel)
 	header.PackStart(mbtn)
+
+	// Difficulty slider: it takes effect in the next game.
+	difficultyScale, err := gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, 0, MAX_DIFFICULTY, 1)
+	if err != nil {
+		log.Fatal("Could not create difficulty slider:", err)
+	}
+	difficultyScale.SetValue(float64(difficulty))
+	difficultyScale.SetDigits(0)
+	difficultyScale.SetSizeRequest(120, -1)
+	difficultyScale.SetTooltipText("AI difficulty, used from the next game")
+	difficultyScale.Connect("value-changed", func() {
+		difficulty = int(difficultyScale.GetValue())
+		glog.Infof("AI difficulty set to %d (out of %d)", difficulty, MAX_DIFFICULTY)
+	})
+	header.PackEnd(difficultyScale)
+	difficultyLabel, err := gtk.LabelNew("Difficulty:")
+	if err != nil {
+		log.Fatal("Could not create difficulty label:", err)
+	}
+	header.PackEnd(difficultyLabel)
 	win.SetTitlebar(header)
 
 	// Register actions.
@@ -240,13 +281,75 @@ func createHeaderWithMenu(win *gtk.Window) {
 		undoAction()
 	})
 
+	aRedo := glib.SimpleActionNew("redo", nil)
+	aRedo.Connect("activate", func() {
+		redoAction()
+	})
+
+	aPreviousVariation := glib.SimpleActionNew("previous_variation", nil)
+	aPreviousVariation.Connect("activate", func() {
+		switchVariation(-1)
+	})
+
+	aNextVariation := glib.SimpleActionNew("next_variation", nil)
+	aNextVariation.Connect("activate", func() {
+		switchVariation(1)
+	})
+
+	aNextPuzzle := glib.SimpleActionNew("next_puzzle", nil)
+	aNextPuzzle.Connect("activate", func() {
+		nextPuzzle()
+	})
+
+	aSwapSides := glib.SimpleActionNew("swap_sides", nil)
+	aSwapSides.Connect("activate", func() {
+		swapSides()
+	})
+
+	aHeatmap := glib.SimpleActionNew("heatmap", nil)
+	aHeatmap.Connect("activate", func() {
+		toggleHeatmap()
+	})
+
+	aContributions := glib.SimpleActionNew("contributions", nil)
+	aContributions.Connect("activate", func() {
+		toggleContributions()
+	})
+
+	aExportSVG := glib.SimpleActionNew("export_svg", nil)
+	aExportSVG.Connect("activate", func() {
+		exportSVG()
+	})
+
 	actG := glib.SimpleActionGroupNew()
 	actG.AddAction(aQuit)
 	actG.AddAction(aNewGame)
 	actG.AddAction(aUndo)
+	actG.AddAction(aRedo)
+	actG.AddAction(aPreviousVariation)
+	actG.AddAction(aNextVariation)
+	actG.AddAction(aNextPuzzle)
+	actG.AddAction(aSwapSides)
+	actG.AddAction(aHeatmap)
+	actG.AddAction(aContributions)
+	actG.AddAction(aExportSVG)
 	win.InsertActionGroup("win", actG)
 }
 
+// setStatus shows the message in the status bar, replacing the previous one. An
+// empty message clears it.
+func setStatus(msg string) {
+	statusBar.Pop(statusContext)
+	if msg != "" {
+		statusBar.Push(statusContext, msg)
+	}
+}
+
+// updateSubtitle shows who is playing each seat in the header.
+func updateSubtitle() {
+	headerBar.SetSubtitle(fmt.Sprintf("Hive implementation in Go - %s", seatsDescription()))
+}
+
 func createAccelGroup(win *gtk.Window) {
 	accelG, err := gtk.AccelGroupNew()
 	if err != nil {
@@ -262,6 +365,38 @@ func createAccelGroup(win *gtk.Window) {
 	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
 		undoAction()
 	})
+	key, mods = gtk.AcceleratorParse("<Control>Y")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		redoAction()
+	})
+	key, mods = gtk.AcceleratorParse("<Control>Left")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		switchVariation(-1)
+	})
+	key, mods = gtk.AcceleratorParse("<Control>Right")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		switchVariation(1)
+	})
+	key, mods = gtk.AcceleratorParse("<Control>U")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		nextPuzzle()
+	})
+	key, mods = gtk.AcceleratorParse("<Control>S")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		swapSides()
+	})
+	key, mods = gtk.AcceleratorParse("<Control>H")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		toggleHeatmap()
+	})
+	key, mods = gtk.AcceleratorParse("<Control>P")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		toggleContributions()
+	})
+	key, mods = gtk.AcceleratorParse("<Control>E")
+	accelG.Connect(key, mods, gtk.ACCEL_VISIBLE, func() {
+		exportSVG()
+	})
 	win.AddAccelGroup(accelG)
 }
 
@@ -276,7 +411,7 @@ func mainBoardClick(da *gtk.DrawingArea, x, y float64) {
 			// Placement action selected, execute it.
 			for _, action := range board.Derived.Actions {
 				if !action.Move && action.Piece == selectedOffBoardPiece && action.TargetPos == pos {
-					executeAction(action)
+					humanAction(action)
 					return
 				}
 			}
@@ -292,7 +427,7 @@ func mainBoardClick(da *gtk.DrawingArea, x, y float64) {
 		for _, action := range board.Derived.Actions {
 			if action.Move && action.SourcePos == selectedPiecePos {
 				if action.TargetPos == pos {
-					executeAction(action)
+					humanAction(action)
 					return
 				}
 			}
@@ -316,7 +451,11 @@ func placementPositions() (posMap map[Pos]bool) {
 	posMap = make(map[Pos]bool)
 	for _, action := range board.Derived.Actions {
 		if !action.Move {
-			posMap[action.TargetPos] = true
+			// Player can place pieces: all placement cells are valid.
+			for _, pos := range board.PlacementCells(board.NextPlayer) {
+				posMap[pos] = true
+			}
+			return
 		}
 	}
 	return
@@ -0,0 +1,53 @@
+// inspect prints a summary of a dataset file (see ai.ExampleWriter): the number of
+// examples, their features version and the distribution of their labels and
+// outcomes. With --show=N it also pretty-prints the first N examples. E.g.:
+//
+//	inspect --dataset=train.examples --show=3
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/janpfeifer/hiveGo/ai"
+)
+
+var (
+	flag_dataset = flag.String("dataset", "", "Dataset file to inspect.")
+	flag_show    = flag.Int("show", 0, "Number of examples to pretty-print, from the start of the dataset.")
+)
+
+func main() {
+	flag.Parse()
+	if *flag_dataset == "" {
+		log.Fatalf("Please set --dataset")
+	}
+	file, err := os.Open(*flag_dataset)
+	if err != nil {
+		log.Fatalf("Failed to open dataset %q: %v", *flag_dataset, err)
+	}
+	defer file.Close()
+	reader, err := ai.NewExampleReader(file)
+	if err != nil {
+		log.Fatalf("Failed to read dataset %q: %v", *flag_dataset, err)
+	}
+
+	summary, err := ai.SummarizeDataset(reader, func(idx int, example *ai.LabeledExample) {
+		if idx >= *flag_show {
+			return
+		}
+		fmt.Printf("Example #%d: label=%.3f, outcome=%s, board hash=%016x\n",
+			idx, example.Label, example.Outcome, example.BoardHash)
+		fmt.Print(ai.FormatFeatures(example.Features, reader.FeaturesVersion))
+		if len(example.ActionsFeatures) > 0 {
+			fmt.Printf("\t%d actions, labels: %v\n", len(example.ActionsFeatures), example.ActionLabels)
+		}
+		fmt.Println()
+	})
+	if err != nil {
+		log.Fatalf("Failed to read dataset %q: %v", *flag_dataset, err)
+	}
+	fmt.Print(summary)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 
-	// TensorFlow is included so it shows up as an option for scorers.
+	"github.com/janpfeifer/hiveGo/ai/players"
+	// TensorFlow and TensorFlow Serving are included so they show up as options for scorers.
+	_ "github.com/janpfeifer/hiveGo/ai/serving"
 	_ "github.com/janpfeifer/hiveGo/ai/tensorflow"
 	"github.com/janpfeifer/hiveGo/ascii_ui"
 	. "github.com/janpfeifer/hiveGo/state"
@@ -14,9 +16,11 @@ import (
 var _ = fmt.Printf
 
 var flag_players = [2]*string{
-	flag.String("p0", "ai", "First player: hotseat, online, ai"),
-	flag.String("p1", "ai", "First player: hotseat, online, ai"),
+	flag.String("p0", "ai", "First player: hotseat, ai or ai:<config>, where <config> is "+
+		"the AI configuration for this player, e.g. ai:ab,max_depth=2,model=modelA"),
+	flag.String("p1", "ai", "Second player: hotseat, ai or ai:<config>, see --p0."),
 }
+var flag_aiConfig = flag.String("ai", "", "Configuration string for the AI players given simply as \"ai\".")
 var flag_aiUI = flag.Bool("ai_ui", true, "Shows UI even for ai vs ai game.")
 var flag_maxMoves = flag.Int(
 	"max_moves", 200, "Max moves before game is assumed to be a draw.")
@@ -27,11 +31,29 @@ func main() {
 		log.Fatalf("Invalid --max_moves=%d", *flag_maxMoves)
 	}
 
+	// Create the players, which validates their configuration.
+	var uiPlayers [NUM_PLAYERS]ascii_ui.Player
+	numAIPlayers := 0
+	for ii := range uiPlayers {
+		player, err := players.NewPlayerFromSpec(*flag_players[ii], *flag_aiConfig, true)
+		if err != nil {
+			log.Fatalf("Invalid --p%d: %v", ii, err)
+		}
+		if player != nil {
+			log.Printf("Player %d: %s", ii, player)
+			uiPlayers[ii] = func(b *Board) Action {
+				action, _, _, _ := player.Play(b)
+				return action
+			}
+			numAIPlayers++
+		}
+	}
+
 	board := NewBoard()
 	board.MaxMoves = *flag_maxMoves
 
 	ui := ascii_ui.NewUI(true, false)
-	_, err := ui.Run(board)
+	_, err := ui.RunWithPlayers(board, uiPlayers, *flag_aiUI || numAIPlayers < NUM_PLAYERS)
 	if err != nil {
 		log.Fatalf("Failed to run match: %v", err)
 	}
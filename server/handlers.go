@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	"github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// MAX_REQUEST_SIZE is the max size in bytes of the body of a request.
+const MAX_REQUEST_SIZE = 1 << 20
+
+// scoredAction is an action along with its score, from the perspective of the
+// player taking it.
+type scoredAction struct {
+	Action Action  `json:"action"`
+	Score  float32 `json:"score"`
+}
+
+// bestMoveResponse is the response to POST /bestmove.
+type bestMoveResponse struct {
+	Action Action  `json:"action"`
+	Score  float32 `json:"score"`
+	Board  *Board  `json:"board"`
+
+	// Analysis, only if requested, has each of the available actions, scored
+	// by the scorer after one move, without search. If there are winning
+	// actions, only those are included.
+	Analysis []scoredAction `json:"analysis,omitempty"`
+}
+
+// scoreResponse is the response to POST /score.
+type scoreResponse struct {
+	Score float32 `json:"score"`
+
+	// WinProb is the probability of winning of the next player, see ai.ValueToWinProb.
+	WinProb float32 `json:"win_prob"`
+
+	// Actions available and their probabilities, for scorers that support it.
+	Actions     []Action  `json:"actions,omitempty"`
+	ActionProbs []float32 `json:"action_probs,omitempty"`
+}
+
+// reloader is a model that can be reloaded from its latest checkpoint, see POST /reload.
+type reloader interface {
+	Reload() error
+	String() string
+}
+
+// reloadResponse is the response to POST /reload.
+type reloadResponse struct {
+	Model string `json:"model"`
+}
+
+// moveMessage is streamed to the spectators of GET /watch for each move.
+type moveMessage struct {
+	Type       string `json:"type"` // Always "move".
+	MoveNumber int    `json:"move_number"`
+	Player     uint8  `json:"player"`
+	Move       string `json:"move"` // See Action.Notation.
+
+	// Score predicted by the player that moved.
+	Score float32 `json:"score"`
+}
+
+// resultMessage is the last message streamed to the spectators of GET /watch.
+type resultMessage struct {
+	Type     string `json:"type"` // Always "result".
+	NumMoves int    `json:"num_moves"`
+
+	// Winner is the player that won, or -1 for a draw.
+	Winner int `json:"winner"`
+}
+
+// newHandler returns the handler of the HTTP API, using the given player. The
+// POST endpoints take a board in JSON (see Board.MarshalJSON) as the body of
+// the request, and return JSON:
+//
+//   * POST /bestmove: returns the action chosen by the player, its score and the
+//     resulting board. With the query parameter analysis=1 it also returns the
+//     score of each of the available actions.
+//   * POST /score: returns the score of the board for the next player, its
+//     probability of winning, and the probabilities of each action if the
+//     scorer supports it.
+//   * POST /reload: reloads the model of the player from its latest checkpoint,
+//     so a newly trained model is served without restarting. Only for models
+//     that support it (see tensorflow.Scorer.Reload), it takes no body.
+//   * GET /watch: WebSocket endpoint that plays a game of the player against
+//     itself (with at most maxMoves moves), streaming a moveMessage for each
+//     move, and a resultMessage when the game finishes. The game is abandoned
+//     when the spectator disconnects. At most maxWatchers games are played at
+//     the same time, further spectators are rejected with 503 (Service
+//     Unavailable).
+func newHandler(player *players.SearcherScorerPlayer, maxMoves, maxWatchers int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bestmove", func(w http.ResponseWriter, r *http.Request) {
+		board, ok := readBoard(w, r)
+		if !ok {
+			return
+		}
+		if board.IsFinished() {
+			http.Error(w, "Game is already finished", http.StatusBadRequest)
+			return
+		}
+		var resp bestMoveResponse
+		if len(board.Derived.Actions) == 0 {
+			resp.Action = SKIP_ACTION
+			resp.Board = board.Act(SKIP_ACTION)
+		} else {
+			resp.Action, resp.Board, resp.Score, _ = player.Play(board)
+		}
+		if v := r.URL.Query().Get("analysis"); v != "" && v != "0" && v != "false" {
+			actions, _, scores := search.ScoredActions(board, player.Scorer)
+			for ii, action := range actions {
+				resp.Analysis = append(resp.Analysis, scoredAction{action, scores[ii]})
+			}
+		}
+		glog.V(1).Infof("POST /bestmove: move #%d, playing %s, score=%.3f", board.MoveNumber, resp.Action, resp.Score)
+		writeJSON(w, resp)
+	})
+	mux.HandleFunc("/score", func(w http.ResponseWriter, r *http.Request) {
+		board, ok := readBoard(w, r)
+		if !ok {
+			return
+		}
+		var resp scoreResponse
+		var actionProbs []float32
+		resp.Score, actionProbs = player.Scorer.Score(board)
+		resp.WinProb = ai.ValueToWinProb(resp.Score)
+		if len(actionProbs) > 0 {
+			resp.Actions, resp.ActionProbs = board.Derived.Actions, actionProbs
+		}
+		glog.V(1).Infof("POST /score: move #%d, score=%.3f", board.MoveNumber, resp.Score)
+		writeJSON(w, resp)
+	})
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		model, ok := player.Learner.(reloader)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Model of %s doesn't support reloading", player), http.StatusNotImplemented)
+			return
+		}
+		if err := model.Reload(); err != nil {
+			glog.Errorf("POST /reload: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		glog.Infof("POST /reload: reloaded %s", model)
+		writeJSON(w, reloadResponse{Model: model.String()})
+	})
+	watchers := make(chan struct{}, maxWatchers)
+	mux.HandleFunc("/watch", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case watchers <- struct{}{}:
+			defer func() { <-watchers }()
+		default:
+			glog.Warningf("GET /watch: rejected spectator %s, already %d watching", r.RemoteAddr, maxWatchers)
+			http.Error(w, "Too many spectators", http.StatusServiceUnavailable)
+			return
+		}
+		ws, err := upgradeWebsocket(w, r)
+		if err != nil {
+			glog.Errorf("GET /watch: %v", err)
+			return
+		}
+		defer ws.Close()
+		glog.V(1).Infof("GET /watch: spectator %s connected", r.RemoteAddr)
+
+		var writeErr error
+		send := func(msg interface{}) {
+			var data []byte
+			if data, writeErr = json.Marshal(msg); writeErr == nil {
+				writeErr = ws.WriteText(data)
+			}
+			if writeErr != nil {
+				glog.Warningf("GET /watch: failed to stream to %s: %v", r.RemoteAddr, writeErr)
+			}
+		}
+		// Once the spectator is gone the game is abandoned, but the move being
+		// searched is not interrupted.
+		gone := func() bool {
+			if writeErr != nil {
+				return true
+			}
+			select {
+			case <-ws.Closed():
+				glog.V(1).Infof("GET /watch: spectator %s disconnected", r.RemoteAddr)
+				return true
+			case <-r.Context().Done():
+				return true
+			default:
+				return false
+			}
+		}
+		if gone() {
+			return
+		}
+		board := NewBoard()
+		board.MaxMoves = maxMoves
+		board.BuildDerived()
+		game, _ := players.SelfPlay(board, [NUM_PLAYERS]players.Player{player, player}, 0, nil, nil,
+			func(action Action, board *Board, score float32) bool {
+				send(moveMessage{"move", board.MoveNumber - 1, board.OpponentPlayer(), action.Notation(), score})
+				return !gone()
+			})
+		board = game.FinalBoard()
+		if !board.IsFinished() || gone() {
+			return
+		}
+		result := resultMessage{Type: "result", NumMoves: len(game.Actions), Winner: -1}
+		if !board.Draw() {
+			result.Winner = int(board.Winner())
+		}
+		send(result)
+	})
+	return mux
+}
+
+// readBoard reads the board from the body of a POST request. If it fails, it
+// writes the error to w and returns false.
+func readBoard(w http.ResponseWriter, r *http.Request) (*Board, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	board := &Board{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_REQUEST_SIZE))
+	if err := dec.Decode(board); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid board: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return board, true
+}
+
+// writeJSON writes the response encoded in JSON.
+func writeJSON(w http.ResponseWriter, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		glog.Errorf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// post sends the board to the given endpoint, and decodes the response in resp.
+func post(t *testing.T, url string, board *Board, resp interface{}) {
+	data, err := json.Marshal(board)
+	if err != nil {
+		t.Fatalf("Failed to encode board: %v", err)
+	}
+	r, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", url, err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s returned %s", url, r.Status)
+	}
+	if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+		t.Fatalf("Failed to decode response of POST %s: %v", url, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := httptest.NewServer(newHandler(players.NewAIPlayer("ab,max_depth=1", false), 20, 1))
+	defer srv.Close()
+
+	board := NewBoard()
+	board = board.Act(Action{Piece: ANT, TargetPos: Pos{0, 0}})
+	board = board.Act(Action{Piece: QUEEN, TargetPos: Pos{0, 1}})
+
+	var bestMove bestMoveResponse
+	post(t, srv.URL+"/bestmove?analysis=1", board, &bestMove)
+	if board.FindAction(bestMove.Action) < 0 {
+		t.Errorf("POST /bestmove returned an invalid action %s", bestMove.Action)
+	}
+	if bestMove.Board == nil || bestMove.Board.MoveNumber != board.MoveNumber+1 {
+		t.Errorf("POST /bestmove returned the wrong board")
+	}
+	if len(bestMove.Analysis) != board.NumActions() {
+		t.Errorf("POST /bestmove returned analysis for %d actions, wanted %d", len(bestMove.Analysis), board.NumActions())
+	}
+
+	var score scoreResponse
+	post(t, srv.URL+"/score", board, &score)
+	if score.Score < -10 || score.Score > 10 {
+		t.Errorf("POST /score returned out of range score %g", score.Score)
+	}
+	if score.WinProb != ai.ValueToWinProb(score.Score) {
+		t.Errorf("POST /score returned win probability %g for score %g", score.WinProb, score.Score)
+	}
+
+	// Invalid requests.
+	if r, err := http.Get(srv.URL + "/bestmove"); err != nil || r.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /bestmove should not be allowed")
+	}
+	if r, err := http.Post(srv.URL+"/score", "application/json", bytes.NewReader([]byte("{"))); err != nil ||
+		r.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /score of an invalid board should fail")
+	}
+}
+
+// reloadingScorer is a linear scorer that counts the calls to Reload.
+type reloadingScorer struct {
+	ai.LinearScorer
+	numReloads int
+}
+
+func (s *reloadingScorer) Reload() error {
+	s.numReloads++
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	player := players.NewAIPlayer("ab,max_depth=1", false)
+	srv := httptest.NewServer(newHandler(player, 20, 1))
+	defer srv.Close()
+
+	// Linear models can't be reloaded.
+	if r, err := http.Post(srv.URL+"/reload", "", nil); err != nil || r.StatusCode != http.StatusNotImplemented {
+		t.Errorf("POST /reload of a linear model should not be implemented")
+	}
+
+	scorer := &reloadingScorer{LinearScorer: ai.TrainedBest}
+	player.Learner = scorer
+	if r, err := http.Get(srv.URL + "/reload"); err != nil || r.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /reload should not be allowed")
+	}
+	var resp reloadResponse
+	r, err := http.Post(srv.URL+"/reload", "", nil)
+	if err != nil || r.StatusCode != http.StatusOK {
+		t.Fatalf("POST /reload failed: %v, %v", err, r)
+	}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response of POST /reload: %v", err)
+	}
+	if scorer.numReloads != 1 || resp.Model == "" {
+		t.Errorf("POST /reload reloaded the model %d times, responded %+v", scorer.numReloads, resp)
+	}
+}
@@ -0,0 +1,52 @@
+// server exposes the AI over HTTP, with a JSON API, so it can be integrated in
+// web frontends. See newHandler for the endpoints.
+//
+// A single AI player (and its scorer) is shared by all requests: searchers
+// don't keep state between searches, and the TensorFlow scorer spreads the
+// concurrent requests over its pool of sessions.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/players"
+	_ "github.com/janpfeifer/hiveGo/ai/serving"
+	"github.com/janpfeifer/hiveGo/ai/tensorflow"
+)
+
+var _ = fmt.Printf
+
+var (
+	flag_address  = flag.String("address", ":8080", "Address where to listen for HTTP requests.")
+	flag_aiConfig = flag.String("ai", "", "Configuration string for the AI player, see players.NewAIPlayer.")
+	flag_parallel = flag.Bool("parallelized", true, "Parallelize the search of each request.")
+	flag_maxMoves = flag.Int(
+		"max_moves", 200, "Max moves before the games streamed to spectators are assumed to be a draw.")
+	flag_maxWatchers = flag.Int("max_watchers", 4,
+		"Max number of games streamed to spectators at the same time, each one takes a search per move.")
+	flag_valueScale = flag.Float64("value_scale", ai.DEFAULT_VALUE_SCALE,
+		"Scale to convert scores to win probabilities, see ai.CalibrateValueScale.")
+	flag_warmup = flag.Int("warmup", 100,
+		"Number of random boards scored at startup to warm up a TensorFlow model, see tensorflow.Scorer.Warmup.")
+)
+
+func init() {
+	flag.BoolVar(&tensorflow.CpuOnly, "cpu", false, "Force to use CPU, even if GPU is available")
+}
+
+func main() {
+	flag.Parse()
+	ai.ValueScale = float32(*flag_valueScale)
+	player := players.NewAIPlayer(*flag_aiConfig, *flag_parallel)
+	if scorer, ok := player.Learner.(*tensorflow.Scorer); ok && *flag_warmup > 0 {
+		cold, warm := scorer.Warmup(*flag_warmup)
+		glog.Infof("Warmed up %s: cold latency %s, warm latency %s", scorer, cold, warm)
+	}
+	glog.Infof("Serving %s at %s", player, *flag_address)
+	log.Fatal(http.ListenAndServe(*flag_address, newHandler(player, *flag_maxMoves, *flag_maxWatchers)))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Minimal server side implementation of the WebSocket protocol (RFC 6455),
+// enough to stream messages to the clients: it only sends text frames, and
+// ignores whatever the client sends, except for the close frame.
+
+// WEBSOCKET_GUID is used to compute the Sec-WebSocket-Accept header of the handshake.
+const WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frames opcodes.
+const (
+	WS_OPCODE_TEXT  = 0x1
+	WS_OPCODE_CLOSE = 0x8
+)
+
+type websocketConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	// closed is closed once the client closes the connection, see readLoop.
+	closed chan struct{}
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value for the given key.
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + WEBSOCKET_GUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains returns whether the comma-separated list of tokens of the
+// header contains the given token, case-insensitive.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebsocket handles the WebSocket handshake, and takes over the connection.
+// If it fails, the error is returned to the client with the given status code.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "Expected WebSocket handshake", http.StatusBadRequest)
+		return nil, fmt.Errorf("Not a WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("Unsupported WebSocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("Connection doesn't support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to hijack connection: %v", err)
+	}
+	ws := &websocketConn{conn, rw, make(chan struct{})}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Failed to write WebSocket handshake: %v", err)
+	}
+	go ws.readLoop()
+	return ws, nil
+}
+
+// readLoop discards the frames sent by the client, until it sends a close frame
+// or the connection fails, and then closes ws.closed.
+func (ws *websocketConn) readLoop() {
+	defer close(ws.closed)
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(ws.rw, header); err != nil {
+			return
+		}
+		if header[0]&0x0F == WS_OPCODE_CLOSE {
+			return
+		}
+		length := int64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = int64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(ws.rw, ext); err != nil {
+				return
+			}
+			length = int64(binary.BigEndian.Uint64(ext) & 0x7FFFFFFFFFFFFFFF)
+		}
+		if header[1]&0x80 != 0 {
+			// Masking key of the client frames.
+			length += 4
+		}
+		if _, err := io.CopyN(ioutil.Discard, ws.rw, length); err != nil {
+			return
+		}
+	}
+}
+
+// Closed returns a channel that is closed once the client closes the connection.
+func (ws *websocketConn) Closed() <-chan struct{} {
+	return ws.closed
+}
+
+// writeFrame writes one unfragmented frame (server frames are not masked).
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+// WriteText sends a text message.
+func (ws *websocketConn) WriteText(msg []byte) error {
+	return ws.writeFrame(WS_OPCODE_TEXT, msg)
+}
+
+// Close sends a close frame and closes the connection.
+func (ws *websocketConn) Close() error {
+	ws.writeFrame(WS_OPCODE_CLOSE, nil)
+	return ws.conn.Close()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/janpfeifer/hiveGo/ai/players"
+	"github.com/janpfeifer/hiveGo/ai/search"
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// dialWebsocket connects to the WebSocket endpoint at path of the test server.
+func dialWebsocket(t *testing.T, srv *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", srv.URL, err)
+	}
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to send handshake: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	// Value from the example in RFC 6455.
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Invalid handshake response: %s, %v", resp.Status, resp.Header)
+	}
+	return conn, reader
+}
+
+// readFrame reads one unmasked and unfragmented frame.
+func readFrame(reader *bufio.Reader) (opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return
+	}
+	opcode = header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(reader, ext); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(reader, ext); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	return
+}
+
+func TestWatch(t *testing.T) {
+	const maxMoves = 20
+	srv := httptest.NewServer(newHandler(players.NewAIPlayer("ab,max_depth=1", false), maxMoves, 1))
+	defer srv.Close()
+	conn, reader := dialWebsocket(t, srv, "/watch")
+	defer conn.Close()
+
+	board := NewBoard()
+	var result *resultMessage
+	for result == nil {
+		opcode, payload, err := readFrame(reader)
+		if err != nil {
+			t.Fatalf("Failed to read message after %d moves: %v", board.MoveNumber-1, err)
+		}
+		if opcode != WS_OPCODE_TEXT {
+			t.Fatalf("Unexpected frame with opcode %d before the result", opcode)
+		}
+		var msgType struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(payload, &msgType); err != nil {
+			t.Fatalf("Failed to decode message %s: %v", payload, err)
+		}
+		switch msgType.Type {
+		case "move":
+			var move moveMessage
+			json.Unmarshal(payload, &move)
+			action, err := ParseAction(move.Move)
+			if err != nil {
+				t.Fatalf("Failed to parse move %s: %v", payload, err)
+			}
+			if move.MoveNumber != board.MoveNumber || move.Player != board.NextPlayer {
+				t.Errorf("Got move %s, wanted move #%d by player %d", payload, board.MoveNumber, board.NextPlayer)
+			}
+			if !action.IsSkipAction() && board.FindAction(action) < 0 {
+				t.Fatalf("Invalid move %s", payload)
+			}
+			board = board.Act(action)
+		case "result":
+			result = &resultMessage{}
+			json.Unmarshal(payload, result)
+		default:
+			t.Fatalf("Unknown message %s", payload)
+		}
+	}
+	if result.NumMoves != board.MoveNumber-1 || result.NumMoves > maxMoves {
+		t.Errorf("Result after %d moves, but %d moves were streamed (max %d)", result.NumMoves, board.MoveNumber-1, maxMoves)
+	}
+	if opcode, _, err := readFrame(reader); err != nil || opcode != WS_OPCODE_CLOSE {
+		t.Errorf("Expected close frame after the result, got opcode %d, err=%v", opcode, err)
+	}
+}
+
+// gatedSearcher counts the searches, and blocks them until gate is closed.
+type gatedSearcher struct {
+	search.Searcher
+	searches int32
+	started  chan bool
+	gate     chan bool
+}
+
+func (s *gatedSearcher) Search(b *Board) (Action, *Board, float32, []float32) {
+	atomic.AddInt32(&s.searches, 1)
+	select {
+	case s.started <- true:
+	default:
+	}
+	<-s.gate
+	return s.Searcher.Search(b)
+}
+
+func TestWatchDisconnect(t *testing.T) {
+	player := players.NewAIPlayer("ab,max_depth=1", false)
+	searcher := &gatedSearcher{Searcher: player.Searcher, started: make(chan bool, 1), gate: make(chan bool)}
+	player.Searcher = searcher
+	srv := httptest.NewServer(newHandler(player, 100, 1))
+	defer srv.Close()
+	conn, _ := dialWebsocket(t, srv, "/watch")
+	<-searcher.started
+
+	// Only one spectator at a time.
+	if r, err := http.Get(srv.URL + "/watch"); err != nil || r.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET /watch with too many spectators should be unavailable, got %v, err=%v", r, err)
+	}
+
+	// Once the spectator disconnects, the game is abandoned after the move being searched.
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	close(searcher.gate)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		r, err := http.Get(srv.URL + "/watch")
+		if err != nil {
+			t.Fatalf("GET /watch failed: %v", err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusServiceUnavailable {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("Game not abandoned after the spectator disconnected, %d searches so far",
+				atomic.LoadInt32(&searcher.searches))
+		}
+	}
+	if searches := atomic.LoadInt32(&searcher.searches); searches != 1 {
+		t.Errorf("Game went on for %d searches after the spectator disconnected", searches)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sort"
 )
 
 var _ = fmt.Printf
@@ -34,6 +35,7 @@ type Derived struct {
 	NumPiecesOnBoard    [NUM_PLAYERS]uint8
 	NumSurroundingQueen [NUM_PLAYERS]uint8
 	PlacementPositions  [NUM_PLAYERS]map[Pos]bool
+	PlacementCells      [NUM_PLAYERS][]Pos // PlacementPositions sorted, see Board.PlacementCells.
 	Wins                [NUM_PLAYERS]bool  // If both players win, it is a draw.
 	QueenPos            [NUM_PLAYERS]Pos   // Only valid if queen is actually in the board.
 	Singles             [NUM_PLAYERS]uint8 // Count pieces that are at the tip (only one neighbour)
@@ -50,9 +52,10 @@ type Derived struct {
 // ignored, since it's a placement of a new piece action (as opposed to a move)
 type Action struct {
 	// If not Move, it's a placement action.
-	Move                 bool
-	Piece                Piece
-	SourcePos, TargetPos Pos
+	Move      bool  `json:"move"`
+	Piece     Piece `json:"piece"`
+	SourcePos Pos   `json:"source_pos"`
+	TargetPos Pos   `json:"target_pos"`
 }
 
 var SKIP_ACTION = Action{Piece: NO_PIECE}
@@ -111,22 +114,36 @@ func (b *Board) BuildDerived() {
 	for p := uint8(0); p < NUM_PLAYERS; p++ {
 		derived.NumPiecesOnBoard[p] = TOTAL_PIECES_PER_PLAYER - b.available[p].Count()
 		derived.PlacementPositions[p] = b.placementPositions(p)
+		derived.PlacementCells[p] = sortedPositions(derived.PlacementPositions[p])
 	}
 
 	derived.RemovablePieces = b.removable()
 	for p := uint8(0); p < NUM_PLAYERS; p++ {
 		derived.PlayersActions[p] = b.ValidActions(p)
-		shuffleActions(derived.PlayersActions[p])
+		shuffleActions(b.rng, derived.PlayersActions[p])
 	}
 
 	derived.Actions = derived.PlayersActions[b.NextPlayer]
 	derived.Wins, derived.NumSurroundingQueen, derived.QueenPos = b.endGame()
+	if b.bothStuck() {
+		// Neither player can move, so the game ends in a draw.
+		derived.Wins = [NUM_PLAYERS]bool{true, true}
+	}
 	derived.Singles = b.ListSingles()
 }
 
-func shuffleActions(actions []Action) {
+// shuffleActions shuffles the actions with rng, or with the global random number
+// generator if rng is nil. With rng the actions are sorted first, since their
+// order depends on the iteration over the board's map: so the shuffle is
+// reproducible from the seed, see WithSeed.
+func shuffleActions(rng *rand.Rand, actions []Action) {
+	intn := rand.Intn
+	if rng != nil {
+		intn = rng.Intn
+		sort.Slice(actions, func(i, j int) bool { return actionLess(actions[i], actions[j]) })
+	}
 	for ii := range actions {
-		jj := rand.Intn(len(actions))
+		jj := intn(len(actions))
 		actions[ii], actions[jj] = actions[jj], actions[ii]
 	}
 }
@@ -140,6 +157,21 @@ func (b *Board) ValidActions(player uint8) (actions []Action) {
 	return
 }
 
+// actionLess orders actions by their fields, for any coordinates (unlike
+// Action.Encode).
+func actionLess(a, b Action) bool {
+	if a.Move != b.Move {
+		return !a.Move
+	}
+	if a.Piece != b.Piece {
+		return a.Piece < b.Piece
+	}
+	if a.SourcePos != b.SourcePos {
+		return PosSlice{a.SourcePos, b.SourcePos}.Less(0, 1)
+	}
+	return PosSlice{a.TargetPos, b.TargetPos}.Less(0, 1)
+}
+
 // FindAction finds the index to the given action. It assumes the action is the exact same slice,
 // that is, it is a shallow comparison.
 func (b *Board) FindAction(action Action) int {
@@ -191,33 +223,73 @@ func (b *Board) placementPositions(player uint8) (placements map[Pos]bool) {
 		}
 	}
 
-	// Filter those down to only those that have no opponent neighbours.
+	// Filter those down to only those that have no opponent neighbours: the
+	// opponent of player, who may not be the b.NextPlayer.
+	opponent := 1 - player
 	for pos, _ := range candidates {
-		if len(b.OpponentNeighbours(pos)) == 0 {
+		if len(b.PlayerNeighbours(opponent, pos)) == 0 {
 			placements[pos] = true
 		}
 	}
 	return
 }
 
+// sortedPositions returns the positions of the map sorted (see PosSort).
+func sortedPositions(posMap map[Pos]bool) []Pos {
+	poss := make([]Pos, 0, len(posMap))
+	for pos := range posMap {
+		poss = append(poss, pos)
+	}
+	PosSort(poss)
+	return poss
+}
+
+// PlacementCells returns the empty cells where player can place a new piece,
+// sorted (see PosSort): the ones next to its pieces and not next to the
+// opponent's. Except for the first piece of the game, placed at (0, 0), and the
+// second, placed anywhere next to the first.
+//
+// They are computed once by BuildDerived, and shouldn't be modified. Whether
+// the player has pieces left to place (or must place the queen) is not
+// considered, see Derived.PlayersActions for that.
+func (b *Board) PlacementCells(player uint8) []Pos {
+	return b.Derived.PlacementCells[player]
+}
+
 // addPlacementActions adds valid placement actions to the given
 // actions slice.
 func (b *Board) addPlacementActions(player uint8, actions []Action) []Action {
+	pieces := b.placeablePieces(player)
+	for _, pos := range b.PlacementCells(player) {
+		for _, piece := range pieces {
+			actions = append(actions, Action{Move: false, Piece: piece, TargetPos: pos})
+		}
+	}
+	return actions
+}
+
+// placeablePieces returns the pieces the player can place on any of the
+// placement positions.
+func (b *Board) placeablePieces(player uint8) (pieces []Piece) {
 	derived := b.Derived
+	// The queen must be placed by the player's 4th move, and before that the player
+	// can't move pieces either (see addMoveActions), so 3 pieces on the board means
+	// it's the 4th move.
 	mustPlaceQueen := b.Available(player, QUEEN) > 0 && derived.NumPiecesOnBoard[player] >= 3
-
-	for pos, _ := range derived.PlacementPositions[player] {
-		if mustPlaceQueen {
-			actions = append(actions, Action{Move: false, Piece: QUEEN, TargetPos: pos})
-		} else {
-			for _, piece := range Pieces {
-				if b.Available(player, piece) > 0 {
-					actions = append(actions, Action{Move: false, Piece: piece, TargetPos: pos})
-				}
-			}
+	if mustPlaceQueen {
+		return []Piece{QUEEN}
+	}
+	noQueen := b.NoQueenFirstMove && derived.NumPiecesOnBoard[player] == 0
+	pieces = make([]Piece, 0, NUM_PIECE_TYPES)
+	for _, piece := range Pieces {
+		if piece == QUEEN && noQueen {
+			continue
+		}
+		if b.Available(player, piece) > 0 {
+			pieces = append(pieces, piece)
 		}
 	}
-	return actions
+	return
 }
 
 // IsRemovable determines whether a piece on specified position is
@@ -257,7 +329,10 @@ func (b *Board) IsRemovable(pos Pos) bool {
 	for len(queue) > 0 {
 		newQueue := []Pos{}
 		for _, visiting := range queue {
-			for _, nPos := range b.OccupiedNeighbours(visiting) {
+			for _, nPos := range visiting.NeighboursArray() {
+				if !b.HasPiece(nPos) {
+					continue
+				}
 				// Skip neighbours already visited.
 				if _, visited := visitedMap[nPos]; visited {
 					continue
@@ -287,9 +362,20 @@ func (b *Board) IsRemovable(pos Pos) bool {
 
 // addMoveActions add valid move actions to the given actions slice
 func (b *Board) addMoveActions(player uint8, actions []Action) []Action {
+	b.forEachMove(player, func(srcPos Pos, piece Piece, tgtPoss []Pos) {
+		for _, tgtPos := range tgtPoss {
+			actions = append(actions, Action{Move: true, Piece: piece, SourcePos: srcPos, TargetPos: tgtPos})
+		}
+	})
+	return actions
+}
+
+// forEachMove calls fn with the target positions of each of the pieces of the
+// player that can move.
+func (b *Board) forEachMove(player uint8, fn func(srcPos Pos, piece Piece, tgtPoss []Pos)) {
 	if b.Available(player, QUEEN) != 0 {
 		// Queen not yet in the game, can't move.
-		return actions
+		return
 	}
 
 	d := b.Derived
@@ -317,13 +403,10 @@ func (b *Board) addMoveActions(player uint8, actions []Action) []Action {
 		case piece == BEETLE:
 			tgtPoss = b.beetleMoves(srcPos)
 		}
-
-		// Collect target positions into actions.
-		for _, tgtPos := range tgtPoss {
-			actions = append(actions, Action{Move: true, Piece: piece, SourcePos: srcPos, TargetPos: tgtPos})
+		if len(tgtPoss) > 0 {
+			fn(srcPos, piece, tgtPoss)
 		}
 	}
-	return actions
 }
 
 // Act takes the given action for the b.NextPlayer player and returns a new board (with
@@ -334,8 +417,19 @@ func (b *Board) addMoveActions(player uint8, actions []Action) []Action {
 //
 // If Piece = NO_PIECE, it's assumed to be a pass-action.
 //
+// If the hive drifts beyond RECENTER_LIMIT, the new board is translated back to
+// the origin, and the translation is stored in newB.Translation: UIs that keep
+// track of the positions of the pieces must then redraw them.
+//
 // It also updates the derived information by calling `BuildDerived()`.
 func (b *Board) Act(action Action) (newB *Board) {
+	newB = b.apply(action)
+	newB.BuildDerived()
+	return
+}
+
+// apply returns a copy of the board after the action, without Derived.
+func (b *Board) apply(action Action) (newB *Board) {
 	newB = b.Copy()
 	if action.Piece != NO_PIECE {
 		if !action.Move {
@@ -348,9 +442,9 @@ func (b *Board) Act(action Action) (newB *Board) {
 			newB.StackPiece(action.TargetPos, player, piece)
 		}
 	}
+	newB.recenter()
 	newB.NextPlayer = 1 - newB.NextPlayer
 	newB.MoveNumber++
-	newB.BuildDerived()
 	return
 }
 
@@ -364,6 +458,29 @@ func (b *Board) IsValid(action Action) bool {
 	return false
 }
 
+// ActChecked is like Act, but returns an error if the action is not valid for
+// b.NextPlayer. The skip action is valid only if there are no other actions.
+func (b *Board) ActChecked(action Action) (*Board, error) {
+	if err := b.checkAction(action); err != nil {
+		return nil, err
+	}
+	return b.Act(action), nil
+}
+
+// checkAction returns an error if the action is not valid for b.NextPlayer, see
+// ActChecked.
+func (b *Board) checkAction(action Action) error {
+	if action.IsSkipAction() {
+		if len(b.Derived.Actions) > 0 {
+			return fmt.Errorf("Player %d can't pass, there are %d actions available",
+				b.NextPlayer, len(b.Derived.Actions))
+		}
+	} else if !b.IsValid(action) {
+		return fmt.Errorf("Invalid action %s for player %d", action.Notation(), b.NextPlayer)
+	}
+	return nil
+}
+
 // endGame checks for end games and will return true for each of the players if they
 // managed to sorround the opponents queen. Returns also the number of pieces surrounding
 // each queen.
@@ -378,7 +495,7 @@ func (b *Board) endGame() (wins [NUM_PLAYERS]bool, surrounding [NUM_PLAYERS]uint
 		if isQueen, player := stack.HasQueen(); isQueen {
 			// Convert player to "NextPlayer"/"Opponent"
 			queenPos[player] = pos
-			surrounding[player] = uint8(len(b.OccupiedNeighbours(pos)))
+			surrounding[player] = uint8(b.NumOccupiedNeighbours(pos))
 			if surrounding[player] == 6 {
 				// If player's queen is sorrounded, other player wins (or draws).
 				wins[1-player] = true
@@ -388,10 +505,42 @@ func (b *Board) endGame() (wins [NUM_PLAYERS]bool, surrounding [NUM_PLAYERS]uint
 	return
 }
 
+// bothStuck returns whether the next player has no available actions, and the
+// previous player also had none: that is, after a forced skip (SKIP_ACTION) the
+// other player has to skip as well. It's a rare but legitimate end of game.
+func (b *Board) bothStuck() bool {
+	return len(b.Derived.Actions) == 0 && b.Previous != nil && b.Previous.Derived != nil &&
+		len(b.Previous.Derived.Actions) == 0
+}
+
+// NumActions returns the number of actions of b.NextPlayer. It is O(1): the
+// actions of both players are already built by BuildDerived. See also
+// NumPlayerActions.
 func (b *Board) NumActions() int {
 	return len(b.Derived.Actions)
 }
 
+// NumPlayerActions returns the number of actions of the given player, from the
+// actions built by BuildDerived.
+func (b *Board) NumPlayerActions(player uint8) int {
+	return len(b.Derived.PlayersActions[player])
+}
+
+// CountActions counts the actions of the given player without materializing
+// them: it's always the same as len(b.ValidActions(player)). It only requires
+// the placement positions and the removable pieces of Derived.
+//
+// It takes about half the time of ValidActions (see BenchmarkCountActions), but
+// once BuildDerived is called NumActions and NumPlayerActions are much cheaper,
+// so this is only useful if the actions are not built.
+func (b *Board) CountActions(player uint8) (count int) {
+	count = len(b.Derived.PlacementPositions[player]) * len(b.placeablePieces(player))
+	b.forEachMove(player, func(_ Pos, _ Piece, tgtPoss []Pos) {
+		count += len(tgtPoss)
+	})
+	return
+}
+
 func (b *Board) IsFinished() bool {
 	return b.Derived.Repeats >= 2 || b.Derived.Wins[0] || b.Derived.Wins[1]
 }
@@ -410,7 +559,7 @@ func (b *Board) Winner() uint8 {
 
 func (b *Board) ListSingles() (singles [2]uint8) {
 	for pos, stack := range b.board {
-		if len(b.OccupiedNeighbours(pos)) == 1 {
+		if b.NumOccupiedNeighbours(pos) == 1 {
 			player, _ := stack.Top()
 			singles[player]++
 		}
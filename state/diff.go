@@ -0,0 +1,110 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// diffPiece is a piece that was added to or removed from a position.
+type diffPiece struct {
+	pos    Pos
+	player uint8
+	piece  Piece
+
+	// Piece under it, NO_PIECE if it is on the ground.
+	underPlayer uint8
+	under       Piece
+}
+
+func (p diffPiece) String() string {
+	return fmt.Sprintf("player %d's %s", p.player, PieceNames[p.piece])
+}
+
+// where describes the position of the piece.
+func (p diffPiece) where() string {
+	if p.under == NO_PIECE {
+		return p.pos.String()
+	}
+	return fmt.Sprintf("%s on top of player %d's %s", p.pos, p.underPlayer, PieceNames[p.under])
+}
+
+// stackDiff returns the pieces removed from stack a and added to stack b, both at
+// pos: the pieces above the bottom ones they have in common.
+func stackDiff(pos Pos, a, b EncodedStack) (removed, added []diffPiece) {
+	countA, countB := a.CountPieces(), b.CountPieces()
+	common := uint8(0)
+	for common < countA && common < countB &&
+		a>>((countA-1-common)<<3)&0xFF == b>>((countB-1-common)<<3)&0xFF {
+		common++
+	}
+	removed = stackPiecesFrom(pos, a, countA, common)
+	added = stackPiecesFrom(pos, b, countB, common)
+	return
+}
+
+// stackPiecesFrom lists the pieces of the stack from the given level (0 is the
+// ground) up.
+func stackPiecesFrom(pos Pos, stack EncodedStack, count, level uint8) (pieces []diffPiece) {
+	for ; level < count; level++ {
+		p := diffPiece{pos: pos}
+		p.player, p.piece = stack.PieceAt(count - 1 - level)
+		if level > 0 {
+			p.underPlayer, p.under = stack.PieceAt(count - level)
+		}
+		pieces = append(pieces, p)
+	}
+	return
+}
+
+// DiffBoards describes the pieces moved, added and removed from board a to board
+// b, one per line, followed by the changes of next player and move number. It is
+// meant for debugging, e.g. in test failure messages. It returns "no differences"
+// if there are none.
+func DiffBoards(a, b *Board) string {
+	positions := a.OccupiedPositions()
+	for _, pos := range b.OccupiedPositions() {
+		if !a.HasPiece(pos) {
+			positions = append(positions, pos)
+		}
+	}
+	PosSort(positions)
+	var removed, added []diffPiece
+	for _, pos := range positions {
+		posRemoved, posAdded := stackDiff(pos, a.StackAt(pos), b.StackAt(pos))
+		removed = append(removed, posRemoved...)
+		added = append(added, posAdded...)
+	}
+
+	// Pieces of the same player and type removed and added are reported as moves.
+	var lines []string
+	for _, r := range removed {
+		moved := false
+		for ii, ad := range added {
+			if ad.player == r.player && ad.piece == r.piece {
+				lines = append(lines, fmt.Sprintf("moved %s from %s to %s", r, r.where(), ad.where()))
+				added = append(added[:ii], added[ii+1:]...)
+				moved = true
+				break
+			}
+		}
+		if !moved {
+			lines = append(lines, fmt.Sprintf("removed %s from %s", r, r.where()))
+		}
+	}
+	for _, ad := range added {
+		lines = append(lines, fmt.Sprintf("added %s at %s", ad, ad.where()))
+	}
+	sort.Strings(lines)
+
+	if a.NextPlayer != b.NextPlayer {
+		lines = append(lines, fmt.Sprintf("next player: %d -> %d", a.NextPlayer, b.NextPlayer))
+	}
+	if a.MoveNumber != b.MoveNumber {
+		lines = append(lines, fmt.Sprintf("move number: %d -> %d", a.MoveNumber, b.MoveNumber))
+	}
+	if len(lines) == 0 {
+		return "no differences"
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,46 @@
+package state_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestDiffBoards(t *testing.T) {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, QUEEN},
+		{Pos{0, 1}, 1, QUEEN},
+		{Pos{0, -1}, 0, BEETLE},
+	})
+	board.MoveNumber = 4
+	board.BuildDerived()
+	if got := DiffBoards(board, board); got != "no differences" {
+		t.Errorf("Diff of board with itself: got %q", got)
+	}
+
+	// Beetle climbs on top of the queen.
+	climbed := board.Act(Action{Move: true, Piece: BEETLE, SourcePos: Pos{0, -1}, TargetPos: Pos{0, 0}})
+	want := "moved player 0's Beetle from (0, -1) to (0, 0) on top of player 0's Queen\n" +
+		"next player: 0 -> 1\n" +
+		"move number: 4 -> 5"
+	if got := DiffBoards(board, climbed); got != want {
+		t.Errorf("Beetle climb: got diff\n%s\nwanted\n%s", got, want)
+	}
+
+	// Reversed, the beetle climbs down.
+	want = "moved player 0's Beetle from (0, 0) on top of player 0's Queen to (0, -1)\n" +
+		"next player: 1 -> 0\n" +
+		"move number: 5 -> 4"
+	if got := DiffBoards(climbed, board); got != want {
+		t.Errorf("Beetle climbing down: got diff\n%s\nwanted\n%s", got, want)
+	}
+
+	// Placement.
+	placed := climbed.Act(Action{Piece: ANT, TargetPos: Pos{0, 2}})
+	want = "added player 1's Ant at (0, 2)\n" +
+		"next player: 1 -> 0\n" +
+		"move number: 5 -> 6"
+	if got := DiffBoards(climbed, placed); got != want {
+		t.Errorf("Placement: got diff\n%s\nwanted\n%s", got, want)
+	}
+}
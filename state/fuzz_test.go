@@ -0,0 +1,123 @@
+package state_test
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// FUZZ_MAX_ACTIONS is the maximum number of actions played in each fuzzed game.
+const FUZZ_MAX_ACTIONS = 300
+
+// FuzzActRandomGames plays random legal games, given by the seed and the draw
+// horizon (Board.MaxMoves), and checks the invariants of the board after each
+// action. Run it with:
+//
+//	go test ./state -run=^$ -fuzz=FuzzActRandomGames
+func FuzzActRandomGames(f *testing.F) {
+	for seed := int64(0); seed < 8; seed++ {
+		f.Add(seed, uint8(100))
+	}
+	f.Add(int64(42), uint8(10))
+	f.Fuzz(func(t *testing.T, seed int64, maxMoves uint8) {
+		rng := rand.New(rand.NewSource(seed))
+		board := NewBoard()
+		board.MaxMoves = int(maxMoves)
+		board.BuildDerived()
+		checkBoardInvariants(t, board)
+		for ii := 0; ii < FUZZ_MAX_ACTIONS && !board.IsFinished(); ii++ {
+			action := SKIP_ACTION
+			if actions := sortedActions(board); len(actions) > 0 {
+				action = actions[rng.Intn(len(actions))]
+			}
+			newBoard := board.Act(action)
+			if newBoard.MoveNumber != board.MoveNumber+1 {
+				t.Fatalf("Action #%d (%s): MoveNumber went from %d to %d", ii, action,
+					board.MoveNumber, newBoard.MoveNumber)
+			}
+			if newBoard.NextPlayer != board.OpponentPlayer() {
+				t.Fatalf("Action #%d (%s): NextPlayer is still %d", ii, action, newBoard.NextPlayer)
+			}
+			board = newBoard
+			checkBoardInvariants(t, board)
+			if t.Failed() {
+				t.Fatalf("Invariants broken after action #%d (%s), seed=%d, maxMoves=%d:\n%s",
+					ii, action, seed, maxMoves, board.RenderASCII())
+			}
+		}
+	})
+}
+
+// sortedActions returns the actions of the board sorted by their encoding, so the
+// random games don't depend on the shuffling of Derived.Actions.
+func sortedActions(b *Board) []Action {
+	actions := append([]Action(nil), b.Derived.Actions...)
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Encode() < actions[j].Encode() })
+	return actions
+}
+
+// checkBoardInvariants reports an error for each invariant the board breaks.
+func checkBoardInvariants(t *testing.T, b *Board) {
+	t.Helper()
+	if err := b.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// Pieces are conserved: on the board or available.
+	var onBoard [NUM_PLAYERS][NUM_PIECE_TYPES]int
+	positions := b.OccupiedPositions()
+	for _, pos := range positions {
+		stack := b.StackAt(pos)
+		for idx := uint8(0); idx < stack.CountPieces(); idx++ {
+			player, piece := stack.PieceAt(idx)
+			onBoard[player][piece-1]++
+		}
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			if total := onBoard[player][piece-1] + int(b.Available(player, piece)); total != int(INITIAL_AVAILABILITY[piece-1]) {
+				t.Errorf("Player %d has %d %s (%d on board), wanted %d", player, total, piece,
+					onBoard[player][piece-1], INITIAL_AVAILABILITY[piece-1])
+			}
+		}
+	}
+
+	// The hive is connected.
+	if len(positions) > 0 {
+		reached := map[Pos]bool{positions[0]: true}
+		queue := []Pos{positions[0]}
+		for len(queue) > 0 {
+			pos := queue[0]
+			queue = queue[1:]
+			for _, neighbour := range b.OccupiedNeighbours(pos) {
+				if !reached[neighbour] {
+					reached[neighbour] = true
+					queue = append(queue, neighbour)
+				}
+			}
+		}
+		if len(reached) != len(positions) {
+			t.Errorf("Hive is disconnected: %d of %d positions reachable", len(reached), len(positions))
+		}
+	}
+
+	// End of game is consistent with the board.
+	var surrounded [NUM_PLAYERS]bool
+	for _, pos := range positions {
+		if isQueen, player := b.StackAt(pos).HasQueen(); isQueen {
+			surrounded[player] = b.NumOccupiedNeighbours(pos) == 6
+		}
+	}
+	drawn := b.Derived.Repeats >= 2 || b.MoveNumber > b.MaxMoves ||
+		(surrounded[0] && surrounded[1]) || (b.NumActions() == 0 && b.Previous != nil && b.Previous.NumActions() == 0)
+	finished := drawn || surrounded[0] || surrounded[1]
+	if b.IsFinished() != finished || b.Draw() != drawn {
+		t.Errorf("IsFinished()=%v and Draw()=%v, wanted %v and %v (surrounded queens=%v, repeats=%d, move=%d of %d)",
+			b.IsFinished(), b.Draw(), finished, drawn, surrounded, b.Derived.Repeats, b.MoveNumber, b.MaxMoves)
+	}
+	if finished && !drawn && b.Winner() == 0 != surrounded[1] {
+		t.Errorf("Winner()=%d, but surrounded queens are %v", b.Winner(), surrounded)
+	}
+}
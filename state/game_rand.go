@@ -0,0 +1,55 @@
+package state
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// WithSeed returns a copy of the board (sharing its Previous boards) that, along
+// with all the boards that follow it, uses its own random number generator
+// seeded with seed, instead of the global one: e.g. to shuffle Derived.Actions
+// and, through Rand, for the randomness of the searchers. So a game played from
+// it can be replayed exactly from the same seed, in isolation from other games.
+//
+// The generator is safe for concurrent use, but the game is only reproducible if
+// its boards are acted on sequentially, e.g. without parallelized searches.
+func (b *Board) WithSeed(seed int64) *Board {
+	newB := &Board{}
+	*newB = *b
+	newB.seed = seed
+	newB.rng = rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+	newB.BuildDerived()
+	return newB
+}
+
+// Seed returns the seed of the random number generator of the game, see WithSeed,
+// or 0 if it doesn't have one.
+func (b *Board) Seed() int64 { return b.seed }
+
+// Rand returns the random number generator of the game, see WithSeed, or nil if it
+// doesn't have one and the global one should be used.
+func (b *Board) Rand() *rand.Rand { return b.rng }
+
+// lockedSource makes a rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
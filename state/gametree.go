@@ -0,0 +1,132 @@
+package state
+
+// GameTree holds the boards of a game, with its variations: when an action is
+// undone and a different one is taken, the new line becomes a variation of the
+// old one, instead of replacing it -- unless KeepVariations is false.
+//
+// It's used by the UIs to navigate a game for analysis.
+type GameTree struct {
+	Root, Current *GameNode
+
+	// KeepVariations retains the lines undone. If false, taking an action
+	// different from the one undone discards the old line.
+	KeepVariations bool
+}
+
+// GameNode is a position in the GameTree.
+type GameNode struct {
+	Board *Board
+
+	// Action that led to Board from Parent. Not set for the Root.
+	Action Action
+	Parent *GameNode
+
+	// Eval is the optional evaluation of the Parent board by the AI that chose
+	// Action, see MoveEval.
+	Eval MoveEval
+
+	// Children are the variations following this position, in the order they
+	// were played.
+	Children []*GameNode
+
+	// selected is the index of the child last visited, followed by Redo.
+	selected int
+}
+
+// NewGameTree creates a GameTree starting at the initial board.
+func NewGameTree(initial *Board, keepVariations bool) *GameTree {
+	root := &GameNode{Board: initial}
+	return &GameTree{Root: root, Current: root, KeepVariations: keepVariations}
+}
+
+// Act takes the action from the current position, and returns the new current
+// board. If the action was already taken from the current position (it was
+// undone), the variation is reused.
+func (t *GameTree) Act(action Action) *Board {
+	node := t.Current
+	for ii, child := range node.Children {
+		if child.Action.Equal(action) {
+			node.selected = ii
+			t.Current = child
+			return child.Board
+		}
+	}
+	child := &GameNode{Board: node.Board.Act(action), Action: action, Parent: node}
+	if !t.KeepVariations {
+		node.Children = nil
+	}
+	node.Children = append(node.Children, child)
+	node.selected = len(node.Children) - 1
+	t.Current = child
+	return child.Board
+}
+
+// Undo moves back to the previous position. It returns false if the current
+// position is already the initial one.
+func (t *GameTree) Undo() bool {
+	if t.Current.Parent == nil {
+		return false
+	}
+	t.Current = t.Current.Parent
+	return true
+}
+
+// Redo moves forward to the position last visited from the current one. It
+// returns false if there is no position after the current one.
+func (t *GameTree) Redo() bool {
+	node := t.Current
+	if len(node.Children) == 0 {
+		return false
+	}
+	t.Current = node.Children[node.selected]
+	return true
+}
+
+// SwitchVariation moves to another variation: at the last position of the
+// current line that has variations, it selects the variation delta positions
+// after (or before, if negative) the current one, and follows it up to its end
+// (see Redo). It returns false if the current line has no variations.
+func (t *GameTree) SwitchVariation(delta int) bool {
+	node := t.Current
+	for node.Parent != nil && len(node.Parent.Children) < 2 {
+		node = node.Parent
+	}
+	parent := node.Parent
+	if parent == nil {
+		return false
+	}
+	numVariations := len(parent.Children)
+	parent.selected = ((parent.selected+delta)%numVariations + numVariations) % numVariations
+	t.Current = parent
+	for t.Redo() {
+	}
+	return true
+}
+
+// Evals returns the evaluations (GameNode.Eval) of the actions from the initial
+// position up to the current one, or nil if none was evaluated.
+func (t *GameTree) Evals() (evals []MoveEval) {
+	evaluated := false
+	for node := t.Current; node.Parent != nil; node = node.Parent {
+		evals = append(evals, node.Eval)
+		evaluated = evaluated || node.Eval.Evaluated
+	}
+	if !evaluated {
+		return nil
+	}
+	for ii, jj := 0, len(evals)-1; ii < jj; ii, jj = ii+1, jj-1 {
+		evals[ii], evals[jj] = evals[jj], evals[ii]
+	}
+	return
+}
+
+// Actions returns the actions from the initial position up to the current one.
+func (t *GameTree) Actions() (actions []Action) {
+	for node := t.Current; node.Parent != nil; node = node.Parent {
+		actions = append(actions, node.Action)
+	}
+	for ii, jj := 0, len(actions)-1; ii < jj; ii, jj = ii+1, jj-1 {
+		actions[ii], actions[jj] = actions[jj], actions[ii]
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package state_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestGameTree(t *testing.T) {
+	initial := NewBoard()
+	placeAnt := Action{Piece: ANT, TargetPos: Pos{0, 0}}
+	placeQueen := Action{Piece: QUEEN, TargetPos: Pos{0, 0}}
+	placeSpider := Action{Piece: SPIDER, TargetPos: Pos{0, 0}}
+	reply := Action{Piece: ANT, TargetPos: Pos{0, 1}}
+
+	tree := NewGameTree(initial, true)
+	tree.Act(placeAnt)
+	tree.Act(reply)
+	if got := tree.Actions(); !reflect.DeepEqual(got, []Action{placeAnt, reply}) {
+		t.Errorf("Actions()=%v, wanted %v", got, []Action{placeAnt, reply})
+	}
+
+	// Undo and play a different move: creates a variation.
+	if !tree.Undo() || !tree.Undo() || tree.Undo() {
+		t.Fatalf("Expected to undo exactly 2 actions")
+	}
+	if tree.Current.Board != initial {
+		t.Errorf("Undo should go back to the initial board")
+	}
+	board := tree.Act(placeQueen)
+	if len(tree.Root.Children) != 2 {
+		t.Fatalf("Expected 2 variations, got %d", len(tree.Root.Children))
+	}
+	if player, piece, _ := board.PieceAt(Pos{0, 0}); player != 0 || piece != QUEEN {
+		t.Errorf("Expected queen of player 0 in (0, 0), got piece %s of player %d", piece, player)
+	}
+
+	// Switching variations follows the other line to its end.
+	if !tree.SwitchVariation(1) {
+		t.Fatalf("SwitchVariation failed")
+	}
+	if got := tree.Actions(); !reflect.DeepEqual(got, []Action{placeAnt, reply}) {
+		t.Errorf("After SwitchVariation(1) Actions()=%v, wanted %v", got, []Action{placeAnt, reply})
+	}
+	if !tree.SwitchVariation(-1) {
+		t.Fatalf("SwitchVariation failed")
+	}
+	if got := tree.Actions(); !reflect.DeepEqual(got, []Action{placeQueen}) {
+		t.Errorf("After SwitchVariation(-1) Actions()=%v, wanted %v", got, []Action{placeQueen})
+	}
+
+	// Taking an action already taken reuses the variation, and Redo follows
+	// the variation last visited.
+	tree.Undo()
+	tree.Act(placeAnt)
+	if len(tree.Root.Children) != 2 {
+		t.Errorf("Replaying an action shouldn't create a variation, got %d variations", len(tree.Root.Children))
+	}
+	if !tree.Redo() || tree.Current.Action != reply || tree.Redo() {
+		t.Errorf("Redo should follow the reply %s up to the end of the line", reply)
+	}
+
+	// Without KeepVariations the line undone is discarded.
+	tree = NewGameTree(initial, false)
+	tree.Act(placeAnt)
+	tree.Undo()
+	tree.Act(placeSpider)
+	if len(tree.Root.Children) != 1 || tree.SwitchVariation(1) {
+		t.Errorf("Without KeepVariations expected a single line, got %d variations", len(tree.Root.Children))
+	}
+}
@@ -0,0 +1,33 @@
+package state
+
+// Heatmap maps positions on the board to a value, e.g. the probability of the
+// actions targeting each position. See ActionsHeatmap.
+type Heatmap map[Pos]float32
+
+// ActionsHeatmap aggregates a value per action of the board, typically the action
+// probabilities returned by a policy, by the target position of the actions: the
+// values of the actions moving or placing pieces on the same position are summed.
+// The skip action, if present, has no target position and is ignored.
+func ActionsHeatmap(b *Board, actionValues []float32) Heatmap {
+	heatmap := make(Heatmap)
+	for ii, action := range b.Derived.Actions {
+		if ii >= len(actionValues) {
+			break
+		}
+		if action.IsSkipAction() {
+			continue
+		}
+		heatmap[action.TargetPos] += actionValues[ii]
+	}
+	return heatmap
+}
+
+// Max returns the largest value of the heatmap, or 0 if it is empty.
+func (h Heatmap) Max() (max float32) {
+	for _, value := range h {
+		if value > max {
+			max = value
+		}
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalJSON encodes the piece as its letter, see PieceLetters.
+func (p Piece) MarshalJSON() ([]byte, error) {
+	if p >= LAST_PIECE_TYPE {
+		return nil, fmt.Errorf("Invalid piece %d", p)
+	}
+	return json.Marshal(PieceLetters[p])
+}
+
+// UnmarshalJSON decodes a piece encoded as its letter, see PieceLetters.
+func (p *Piece) UnmarshalJSON(data []byte) error {
+	var letter string
+	if err := json.Unmarshal(data, &letter); err != nil {
+		return fmt.Errorf("Failed to decode piece: %v", err)
+	}
+	if letter == PieceLetters[NO_PIECE] {
+		*p = NO_PIECE
+		return nil
+	}
+	piece, ok := LetterToPiece[letter]
+	if !ok {
+		return fmt.Errorf("Unknown piece %q", letter)
+	}
+	*p = piece
+	return nil
+}
+
+// jsonPiece is a piece on the board, as encoded in JSON.
+type jsonPiece struct {
+	Pos    Pos   `json:"pos"`
+	Player uint8 `json:"player"`
+	Piece  Piece `json:"piece"`
+}
+
+// jsonBoard is the JSON representation of a Board.
+type jsonBoard struct {
+	MoveNumber       int   `json:"move_number"`
+	MaxMoves         int   `json:"max_moves"`
+	NextPlayer       uint8 `json:"next_player"`
+	NoQueenFirstMove bool  `json:"no_queen_first_move,omitempty"`
+
+	// Available pieces (off-board) of each player, indexed by the piece letter.
+	Available [NUM_PLAYERS]map[string]uint8 `json:"available"`
+
+	// Pieces on the board. Stacked pieces are listed from the bottom up.
+	Pieces []jsonPiece `json:"pieces"`
+}
+
+// MarshalJSON encodes the current position of the board (not its history) in
+// JSON, for instance:
+//
+//   {"move_number":3,"max_moves":100,"next_player":0,
+//    "available":[{"A":3,"B":2,"G":3,"Q":0,"S":2},{"A":2,"B":2,"G":3,"Q":1,"S":2}],
+//    "pieces":[{"pos":[0,0],"player":0,"piece":"Q"},{"pos":[0,1],"player":1,"piece":"A"}]}
+func (b *Board) MarshalJSON() ([]byte, error) {
+	jb := jsonBoard{
+		MoveNumber:       b.MoveNumber,
+		MaxMoves:         b.MaxMoves,
+		NextPlayer:       b.NextPlayer,
+		NoQueenFirstMove: b.NoQueenFirstMove,
+		Pieces:           []jsonPiece{},
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		jb.Available[player] = make(map[string]uint8)
+		for _, piece := range Pieces {
+			jb.Available[player][PieceLetters[piece]] = b.Available(player, piece)
+		}
+	}
+	positions := b.OccupiedPositions()
+	PosSort(positions)
+	for _, pos := range positions {
+		stack := b.StackAt(pos)
+		for stackPos := int(stack.CountPieces()) - 1; stackPos >= 0; stackPos-- {
+			player, piece := stack.PieceAt(uint8(stackPos))
+			jb.Pieces = append(jb.Pieces, jsonPiece{pos, player, piece})
+		}
+	}
+	return json.Marshal(jb)
+}
+
+// UnmarshalJSON decodes a board encoded with MarshalJSON, and builds its derived
+// information. The decoded board has no history (Previous is nil).
+//
+// Fields missing take the values of NewBoard, except the available pieces of a
+// player, which if missing are the initial ones minus the ones the player has on
+// the board. It returns an error if the board is not valid, see NewBoardWithSetup.
+func (b *Board) UnmarshalJSON(data []byte) error {
+	var jb jsonBoard
+	if err := json.Unmarshal(data, &jb); err != nil {
+		return fmt.Errorf("Failed to decode board: %v", err)
+	}
+	setup := BoardSetup{
+		NextPlayer:       jb.NextPlayer,
+		MoveNumber:       jb.MoveNumber,
+		MaxMoves:         jb.MaxMoves,
+		NoQueenFirstMove: jb.NoQueenFirstMove,
+	}
+	for _, p := range jb.Pieces {
+		if p.Piece == NO_PIECE {
+			return fmt.Errorf("Missing piece for player %d at %s", p.Player, p.Pos)
+		}
+		setup.Pieces = append(setup.Pieces, PlacedPiece{p.Pos, p.Player, p.Piece})
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		if jb.Available[player] == nil {
+			continue
+		}
+		available := INITIAL_AVAILABILITY
+		for letter, count := range jb.Available[player] {
+			piece, ok := LetterToPiece[letter]
+			if !ok {
+				return fmt.Errorf("Unknown piece %q in available pieces of player %d", letter, player)
+			}
+			available[piece-1] = count
+		}
+		setup.Available[player] = &available
+	}
+	newB, err := NewBoardWithSetup(setup)
+	if err != nil {
+		return err
+	}
+	*b = *newB
+	return nil
+}
@@ -0,0 +1,67 @@
+package state_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestBoardJSON(t *testing.T) {
+	b := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, QUEEN},
+		{Pos{0, 1}, 1, ANT},
+		{Pos{0, 1}, 0, BEETLE},
+		{Pos{1, 0}, 1, QUEEN},
+	})
+	b.MoveNumber, b.MaxMoves, b.NextPlayer = 5, 50, 1
+	b.BuildDerived()
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("Failed to encode board: %v", err)
+	}
+	var decoded Board
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode board %s: %v", data, err)
+	}
+	if decoded.MoveNumber != b.MoveNumber || decoded.MaxMoves != b.MaxMoves || decoded.NextPlayer != b.NextPlayer {
+		t.Errorf("Decoded board state differs: %s", data)
+	}
+	for _, pos := range b.OccupiedPositions() {
+		if decoded.StackAt(pos) != b.StackAt(pos) {
+			t.Errorf("Decoded board has a different stack at %s: %s", pos, data)
+		}
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			if decoded.Available(player, piece) != b.Available(player, piece) {
+				t.Errorf("Decoded board has %d %s available for player %d, wanted %d",
+					decoded.Available(player, piece), piece, player, b.Available(player, piece))
+			}
+		}
+	}
+	if decoded.NumActions() != b.NumActions() {
+		t.Errorf("Decoded board has %d actions, wanted %d", decoded.NumActions(), b.NumActions())
+	}
+
+	// Available pieces can be omitted.
+	var minimal Board
+	if err := json.Unmarshal([]byte(`{"pieces":[{"pos":[0,0],"player":0,"piece":"G"}],"next_player":1}`), &minimal); err != nil {
+		t.Fatalf("Failed to decode board: %v", err)
+	}
+	if minimal.Available(0, GRASSHOPPER) != 2 || minimal.Available(1, GRASSHOPPER) != 3 || minimal.MaxMoves != NewBoard().MaxMoves {
+		t.Errorf("Missing fields of the decoded board not set to their defaults")
+	}
+
+	// Invalid boards.
+	for _, data := range []string{
+		`{"pieces":[{"pos":[0,0],"player":2,"piece":"G"}]}`,
+		`{"pieces":[{"pos":[0,0],"player":0,"piece":"X"}]}`,
+		`{"pieces":[{"pos":[0,0],"player":0,"piece":"Q"},{"pos":[1,0],"player":0,"piece":"Q"}]}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &minimal); err == nil {
+			t.Errorf("Invalid board %s decoded with no errors", data)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package state
+
+import "math"
+
+// HexLayout is the geometry used to draw the board: flat topped hexagons with
+// sides of length Face, where odd columns are shifted half a hexagon down (see
+// Pos.Neighbours). Position (0, 0) is centered at the origin, and y grows
+// downwards, as in most drawing libraries.
+//
+// It's shared by the GUI and the image exporters (see ExportSVG), so they
+// draw positions the same way.
+type HexLayout struct {
+	Face float64
+}
+
+// TriangleHeight is the height of each of the 6 equilateral triangles that form
+// the hexagon: the distance from the center to the middle of the top side.
+func (l HexLayout) TriangleHeight() float64 {
+	return math.Sqrt(3) / 2 * l.Face
+}
+
+// ColumnWidth is the horizontal distance between the centers of neighbouring
+// columns.
+func (l HexLayout) ColumnWidth() float64 {
+	return 1.5 * l.Face
+}
+
+// RowHeight is the vertical distance between the centers of positions in the
+// same column.
+func (l HexLayout) RowHeight() float64 {
+	return 2 * l.TriangleHeight()
+}
+
+// PosToXY returns the center of the hexagon of the position.
+func (l HexLayout) PosToXY(pos Pos) (x, y float64) {
+	x = float64(pos.X()) * l.ColumnWidth()
+	y = float64(pos.Y()) * l.RowHeight()
+	if pos.X()%2 != 0 {
+		y += l.TriangleHeight()
+	}
+	return
+}
+
+// XYToPos returns the position whose hexagon is approximately at x, y.
+func (l HexLayout) XYToPos(x, y float64) Pos {
+	posX := int8(math.Round(x / l.ColumnWidth()))
+	if posX%2 != 0 {
+		y -= l.TriangleHeight()
+	}
+	posY := int8(math.Round(y / l.RowHeight()))
+	return Pos{posX, posY}
+}
+
+// Corners returns the corners of the hexagon centered at xc, yc, starting on the
+// left corner and moving clockwise.
+func (l HexLayout) Corners(xc, yc float64) [6][2]float64 {
+	face, height := l.Face, l.TriangleHeight()
+	return [6][2]float64{
+		{xc - face, yc},
+		{xc - face/2.0, yc - height},
+		{xc + face/2.0, yc - height},
+		{xc + face, yc},
+		{xc + face/2.0, yc + height},
+		{xc - face/2.0, yc + height},
+	}
+}
@@ -0,0 +1,125 @@
+package state
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// SKIP_NOTATION is the notation of the SKIP_ACTION.
+const SKIP_NOTATION = "pass"
+
+// Notation returns a compact representation of the action, that can be parsed back
+// with ParseAction. The piece is given by its letter, and positions as "x,y":
+//
+//   * Placement: "A@0,1" places an ant at position (0, 1).
+//   * Move: "Q0,0>1,0" moves the queen from (0, 0) to (1, 0).
+//   * Skip action: "pass".
+func (a Action) Notation() string {
+	if a.IsSkipAction() {
+		return SKIP_NOTATION
+	}
+	if a.Move {
+		return fmt.Sprintf("%s%d,%d>%d,%d", PieceLetters[a.Piece],
+			a.SourcePos.X(), a.SourcePos.Y(), a.TargetPos.X(), a.TargetPos.Y())
+	}
+	return fmt.Sprintf("%s@%d,%d", PieceLetters[a.Piece], a.TargetPos.X(), a.TargetPos.Y())
+}
+
+// ParseAction parses an action in the notation returned by Action.Notation. It
+// doesn't check that the action is valid for any board.
+func ParseAction(notation string) (action Action, err error) {
+	notation = strings.TrimSpace(notation)
+	if notation == SKIP_NOTATION {
+		return SKIP_ACTION, nil
+	}
+	if len(notation) < 2 {
+		return action, fmt.Errorf("Invalid action %q", notation)
+	}
+	piece, ok := LetterToPiece[notation[:1]]
+	if !ok {
+		return action, fmt.Errorf("Invalid piece in action %q", notation)
+	}
+	action.Piece = piece
+	if notation[1] == '@' {
+		action.TargetPos, err = parsePos(notation[2:])
+	} else {
+		parts := strings.Split(notation[1:], ">")
+		if len(parts) != 2 {
+			return action, fmt.Errorf("Invalid action %q", notation)
+		}
+		action.Move = true
+		if action.SourcePos, err = parsePos(parts[0]); err == nil {
+			action.TargetPos, err = parsePos(parts[1])
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("Invalid position in action %q: %v", notation, err)
+	}
+	return
+}
+
+// parsePos parses a position given as "x,y".
+func parsePos(s string) (pos Pos, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return pos, fmt.Errorf("position %q should be x,y", s)
+	}
+	for ii, part := range parts {
+		var v int64
+		v, err = strconv.ParseInt(part, 10, 8)
+		if err != nil {
+			return
+		}
+		pos[ii] = int8(v)
+	}
+	return
+}
+
+// Layout of the encoded action, see Action.Encode: the piece, the move flag and
+// then the coordinates of the positions, each with ENCODED_POS_BITS bits.
+const (
+	ENCODED_PIECE_BITS = 3
+	ENCODED_POS_BITS   = 7
+
+	// Range of the coordinates that can be encoded.
+	MIN_ENCODED_COORD = -(1 << (ENCODED_POS_BITS - 1))
+	MAX_ENCODED_COORD = (1 << (ENCODED_POS_BITS - 1)) - 1
+)
+
+// Encode packs the action into an integer, e.g. to use as a key of search
+// tables. DecodeAction(a.Encode()) == a for any action whose coordinates are in
+// the range [MIN_ENCODED_COORD, MAX_ENCODED_COORD], which includes the actions of
+// any board, since they are recentered at RECENTER_LIMIT. It panics for
+// coordinates outside that range. The source position of placements is zero, as
+// created by the move generation.
+func (a Action) Encode() (code uint32) {
+	code = uint32(a.Piece)
+	if a.Move {
+		code |= 1 << ENCODED_PIECE_BITS
+	}
+	shift := uint(ENCODED_PIECE_BITS + 1)
+	for _, coord := range [4]int8{a.SourcePos[0], a.SourcePos[1], a.TargetPos[0], a.TargetPos[1]} {
+		if coord < MIN_ENCODED_COORD || coord > MAX_ENCODED_COORD {
+			log.Panicf("Can't encode action %s: coordinate %d out of range", a, coord)
+		}
+		code |= (uint32(coord) & (1<<ENCODED_POS_BITS - 1)) << shift
+		shift += ENCODED_POS_BITS
+	}
+	return
+}
+
+// DecodeAction decodes an action encoded with Action.Encode.
+func DecodeAction(code uint32) (a Action) {
+	a.Piece = Piece(code & (1<<ENCODED_PIECE_BITS - 1))
+	a.Move = code&(1<<ENCODED_PIECE_BITS) != 0
+	shift := uint(ENCODED_PIECE_BITS + 1)
+	for _, coord := range [4]*int8{&a.SourcePos[0], &a.SourcePos[1], &a.TargetPos[0], &a.TargetPos[1]} {
+		// Shift left then right (arithmetic) to extend the sign.
+		value := int32(code>>shift&(1<<ENCODED_POS_BITS-1)) << (32 - ENCODED_POS_BITS)
+		*coord = int8(value >> (32 - ENCODED_POS_BITS))
+		shift += ENCODED_POS_BITS
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package state_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestNotation(t *testing.T) {
+	for _, test := range []struct {
+		action   Action
+		notation string
+	}{
+		{SKIP_ACTION, "pass"},
+		{Action{Piece: ANT, TargetPos: Pos{0, -1}}, "A@0,-1"},
+		{Action{Move: true, Piece: QUEEN, SourcePos: Pos{-2, 3}, TargetPos: Pos{-1, 3}}, "Q-2,3>-1,3"},
+	} {
+		if got := test.action.Notation(); got != test.notation {
+			t.Errorf("%s: got notation %q, wanted %q", test.action, got, test.notation)
+		}
+		action, err := ParseAction(test.notation)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", test.notation, err)
+		} else if action != test.action {
+			t.Errorf("Parsed %q into %s, wanted %s", test.notation, action, test.action)
+		}
+	}
+
+	for _, notation := range []string{"", "X@0,0", "A@0", "A0,0", "A0,0>1", "A@200,0"} {
+		if _, err := ParseAction(notation); err == nil {
+			t.Errorf("Invalid notation %q parsed with no errors", notation)
+		}
+	}
+}
+
+func TestActionEncode(t *testing.T) {
+	// Actions of boards along a game, plus edge cases.
+	actions := []Action{SKIP_ACTION,
+		{Move: true, Piece: SPIDER, SourcePos: Pos{MIN_ENCODED_COORD, MAX_ENCODED_COORD},
+			TargetPos: Pos{MAX_ENCODED_COORD, MIN_ENCODED_COORD}}}
+	board := NewBoard()
+	for ii := 0; ii < 30 && !board.IsFinished(); ii++ {
+		codes := make(map[uint32]Action)
+		for _, action := range board.Derived.Actions {
+			if other, found := codes[action.Encode()]; found {
+				t.Errorf("Move #%d: actions %s and %s have the same code", board.MoveNumber, action, other)
+			}
+			codes[action.Encode()] = action
+		}
+		actions = append(actions, board.Derived.Actions...)
+		if len(board.Derived.Actions) == 0 {
+			board = board.Act(SKIP_ACTION)
+			continue
+		}
+		board = board.Act(board.Derived.Actions[ii%len(board.Derived.Actions)])
+	}
+	// Boards at RECENTER_LIMIT, not recentered yet, have actions one position beyond it.
+	for _, edge := range []Pos{{RECENTER_LIMIT, 0}, {-RECENTER_LIMIT, 0}, {0, RECENTER_LIMIT}, {0, -RECENTER_LIMIT}} {
+		inner := Pos{edge[0] - edge[0]/RECENTER_LIMIT, edge[1] - edge[1]/RECENTER_LIMIT}
+		for player := uint8(0); player < NUM_PLAYERS; player++ {
+			board := buildBoard([]PieceLayout{{edge, player, QUEEN}, {inner, 1 - player, QUEEN}})
+			board.NextPlayer, board.MoveNumber = player, 3
+			board.BuildDerived()
+			if board.Translation != (Pos{}) {
+				t.Fatalf("Board with a queen at %s shouldn't be recentered", edge)
+			}
+			actions = append(actions, board.Derived.Actions...)
+		}
+	}
+	for _, action := range actions {
+		if got := DecodeAction(action.Encode()); got != action {
+			t.Errorf("Action %s encoded as %#x decoded to %s", action, action.Encode(), got)
+		}
+	}
+}
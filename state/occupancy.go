@@ -0,0 +1,82 @@
+package state
+
+// OCCUPANCY_GRID_BITS is the log2 of the side of the occupancy grid.
+const OCCUPANCY_GRID_BITS = 5
+
+// OCCUPANCY_GRID_SIZE is the side of the occupancy grid: it's larger than the
+// span of any connected hive (at most 2*TOTAL_PIECES_PER_PLAYER pieces).
+const OCCUPANCY_GRID_SIZE = 1 << OCCUPANCY_GRID_BITS
+
+// occupancy is a bitset of the occupied positions of the Board, so HasPiece and
+// neighbour queries don't need to hash the position into the board map.
+//
+// Positions are mapped to a OCCUPANCY_GRID_SIZE x OCCUPANCY_GRID_SIZE grid that
+// wraps around, and a bounding box of the positions ever occupied rules out
+// the positions outside it. While the bounding box fits in the grid, different
+// positions in it never share a cell, and the bitset is exact. Otherwise (only
+// possible for disconnected hives, e.g. when setting up arbitrary boards) the
+// occupancy is aliased, and the bitset is only used to rule out empty positions,
+// with the board map deciding the rest.
+type occupancy struct {
+	bits                   [OCCUPANCY_GRID_SIZE]uint32
+	minX, maxX, minY, maxY int8
+	used, aliased          bool
+}
+
+// cell returns the row and bit mask of the position in the grid.
+func (o *occupancy) cell(pos Pos) (row int, mask uint32) {
+	return int(uint8(pos[1]) & (OCCUPANCY_GRID_SIZE - 1)), 1 << (uint8(pos[0]) & (OCCUPANCY_GRID_SIZE - 1))
+}
+
+// mayHave returns false if the position is certainly empty. Otherwise the
+// position is occupied, unless the occupancy is aliased.
+func (o *occupancy) mayHave(pos Pos) bool {
+	if !o.used || pos[0] < o.minX || pos[0] > o.maxX || pos[1] < o.minY || pos[1] > o.maxY {
+		return false
+	}
+	row, mask := o.cell(pos)
+	return o.bits[row]&mask != 0
+}
+
+// set marks the position as occupied.
+func (o *occupancy) set(pos Pos) {
+	if !o.used {
+		o.minX, o.maxX, o.minY, o.maxY = pos[0], pos[0], pos[1], pos[1]
+		o.used = true
+	} else {
+		if pos[0] < o.minX {
+			o.minX = pos[0]
+		} else if pos[0] > o.maxX {
+			o.maxX = pos[0]
+		}
+		if pos[1] < o.minY {
+			o.minY = pos[1]
+		} else if pos[1] > o.maxY {
+			o.maxY = pos[1]
+		}
+		if int(o.maxX)-int(o.minX) >= OCCUPANCY_GRID_SIZE || int(o.maxY)-int(o.minY) >= OCCUPANCY_GRID_SIZE {
+			o.aliased = true
+		}
+	}
+	row, mask := o.cell(pos)
+	o.bits[row] |= mask
+}
+
+// clear marks the position as empty. When aliased other positions may share the
+// cell, so it is left as is. The bounding box is not shrunk.
+func (o *occupancy) clear(pos Pos) {
+	if o.aliased {
+		return
+	}
+	row, mask := o.cell(pos)
+	o.bits[row] &^= mask
+}
+
+// rebuildOccupancy recreates the occupancy from the board map. Needed when the
+// map is changed directly.
+func (b *Board) rebuildOccupancy() {
+	b.occupied = occupancy{}
+	for pos := range b.board {
+		b.occupied.set(pos)
+	}
+}
@@ -0,0 +1,62 @@
+package state_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestOccupancy(t *testing.T) {
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	b.StackPiece(Pos{0, 0}, 1, BEETLE)
+	b.StackPiece(Pos{-1, 0}, 1, QUEEN)
+	for _, pos := range []Pos{{0, 0}, {-1, 0}} {
+		if !b.HasPiece(pos) {
+			t.Errorf("Position %s should be occupied", pos)
+		}
+	}
+	for _, pos := range []Pos{{1, 0}, {0, 1}, {-1, -1}, {OCCUPANCY_GRID_SIZE, 0}} {
+		if b.HasPiece(pos) {
+			t.Errorf("Position %s should be empty", pos)
+		}
+	}
+	if got := b.NumOccupiedNeighbours(Pos{0, 1}); got != 2 {
+		t.Errorf("Got %d occupied neighbours of (0, 1), wanted 2", got)
+	}
+
+	// Popping the beetle leaves the queen, popping the queen empties the position.
+	b2 := b.Copy()
+	b2.PopPiece(Pos{0, 0})
+	if !b2.HasPiece(Pos{0, 0}) {
+		t.Errorf("Position (0, 0) should still have the queen")
+	}
+	b2.PopPiece(Pos{0, 0})
+	if b2.HasPiece(Pos{0, 0}) || b2.CountAt(Pos{0, 0}) != 0 {
+		t.Errorf("Position (0, 0) should be empty")
+	}
+	if !b.HasPiece(Pos{0, 0}) {
+		t.Errorf("Changes to the copy should not affect the original board")
+	}
+}
+
+func TestOccupancyAliasing(t *testing.T) {
+	// Positions that share the same cell in the occupancy grid.
+	pos1, pos2 := Pos{1, 2}, Pos{1 + OCCUPANCY_GRID_SIZE, 2 - OCCUPANCY_GRID_SIZE}
+	b := NewBoard()
+	b.StackPiece(pos1, 0, ANT)
+	if b.HasPiece(pos2) {
+		t.Errorf("Position %s should be empty", pos2)
+	}
+	b.StackPiece(pos2, 1, ANT)
+	b.PopPiece(pos1)
+	if b.HasPiece(pos1) {
+		t.Errorf("Position %s should be empty", pos1)
+	}
+	if !b.HasPiece(pos2) {
+		t.Errorf("Position %s should be occupied", pos2)
+	}
+	if player, piece, _ := b.PieceAt(pos2); player != 1 || piece != ANT {
+		t.Errorf("Got player %d, piece %s at %s, wanted player 1's ant", player, piece, pos2)
+	}
+}
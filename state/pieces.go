@@ -22,8 +22,8 @@ func (b *Board) EmptyAndConnectedNeighbours(srcPos, originalPos Pos, invalid map
 	poss = make([]Pos, 0, NUM_NEIGHBOURS)
 
 	// Initialize neighbours and occupied predicate (assuming the piece will leave originalPos).
-	neighbours := srcPos.Neighbours()
-	occupied := make([]bool, NUM_NEIGHBOURS)
+	neighbours := srcPos.NeighboursArray()
+	var occupied [NUM_NEIGHBOURS]bool
 	for ii := 0; ii < NUM_NEIGHBOURS; ii++ {
 		occupied[ii] = b.HasPiece(neighbours[ii]) && neighbours[ii] != originalPos
 	}
@@ -108,7 +108,7 @@ func (b *Board) grasshopperMoves(srcPos Pos) (poss []Pos) {
 
 func (b *Board) grasshopperNextFree(srcPos Pos, direction int) (steps int, tgtPos Pos) {
 	steps = 0
-	for tgtPos = srcPos; b.HasPiece(tgtPos); tgtPos = tgtPos.Neighbours()[direction] {
+	for tgtPos = srcPos; b.HasPiece(tgtPos); tgtPos = tgtPos.NeighboursArray()[direction] {
 		steps++
 	}
 	return
@@ -0,0 +1,67 @@
+package state
+
+// PositionSummary is a small summary of a board, e.g. to show the consequences of
+// a candidate action in a UI. See Board.Preview.
+type PositionSummary struct {
+	// NumSurroundingQueen is the number of pieces around the queen of each player,
+	// 0 if the queen is not on the board.
+	NumSurroundingQueen [NUM_PLAYERS]uint8
+
+	// NumActions is the number of actions of each player.
+	NumActions [NUM_PLAYERS]int
+}
+
+// Preview returns the board after the action of b.NextPlayer, and its summary,
+// if the action is legal (see ActChecked). Otherwise next is nil and the summary
+// is empty. b is not changed.
+//
+// If only the summary is needed, PreviewSummary is cheaper.
+func (b *Board) Preview(action Action) (next *Board, legal bool, summary PositionSummary) {
+	if b.checkAction(action) != nil {
+		return nil, false, summary
+	}
+	next = b.Act(action)
+	return next, true, next.Summary()
+}
+
+// PreviewSummary is like Preview, but only returns the summary of the board after
+// the action: it doesn't run BuildDerived on it, only what is needed to count
+// the actions (see CountActions).
+func (b *Board) PreviewSummary(action Action) (legal bool, summary PositionSummary) {
+	if b.checkAction(action) != nil {
+		return false, summary
+	}
+	next := b.apply(action)
+	next.Derived = &Derived{}
+	for p := uint8(0); p < NUM_PLAYERS; p++ {
+		next.Derived.NumPiecesOnBoard[p] = TOTAL_PIECES_PER_PLAYER - next.available[p].Count()
+		next.Derived.PlacementPositions[p] = next.placementPositions(p)
+	}
+	next.Derived.RemovablePieces = next.removable()
+	for p := uint8(0); p < NUM_PLAYERS; p++ {
+		summary.NumActions[p] = next.CountActions(p)
+	}
+	summary.NumSurroundingQueen = next.queensSurroundings()
+	return true, summary
+}
+
+// Summary returns the PositionSummary of the board, which must have Derived built.
+func (b *Board) Summary() (summary PositionSummary) {
+	for p := uint8(0); p < NUM_PLAYERS; p++ {
+		summary.NumActions[p] = b.NumPlayerActions(p)
+	}
+	summary.NumSurroundingQueen = b.queensSurroundings()
+	return
+}
+
+// queensSurroundings returns the number of pieces around the queen of each
+// player. Unlike Derived.NumSurroundingQueen, it's also set after the game ended
+// by reaching MaxMoves.
+func (b *Board) queensSurroundings() (surrounding [NUM_PLAYERS]uint8) {
+	for pos, stack := range b.board {
+		if isQueen, player := stack.HasQueen(); isQueen {
+			surrounding[player] = uint8(b.NumOccupiedNeighbours(pos))
+		}
+	}
+	return
+}
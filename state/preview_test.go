@@ -0,0 +1,55 @@
+package state_test
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestPreview(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	b := NewBoard()
+	for move := 0; move < 30 && !b.IsFinished(); move++ {
+		hash, moveNumber := b.Derived.Hash, b.MoveNumber
+		for _, action := range b.Derived.Actions {
+			next, legal, summary := b.Preview(action)
+			if !legal || next == nil {
+				t.Fatalf("Move %d: legal action %s previewed as illegal", move, action)
+			}
+			if want := b.Act(action); next.Derived.Hash != want.Derived.Hash {
+				t.Errorf("Move %d: Preview(%s) differs from Act", move, action)
+			}
+			for p := uint8(0); p < NUM_PLAYERS; p++ {
+				if summary.NumActions[p] != len(next.Derived.PlayersActions[p]) {
+					t.Errorf("Move %d: Preview(%s) player %d has %d actions, wanted %d", move, action, p,
+						summary.NumActions[p], len(next.Derived.PlayersActions[p]))
+				}
+				if summary.NumSurroundingQueen[p] != next.Derived.NumSurroundingQueen[p] {
+					t.Errorf("Move %d: Preview(%s) player %d queen surrounded by %d, wanted %d", move, action, p,
+						summary.NumSurroundingQueen[p], next.Derived.NumSurroundingQueen[p])
+				}
+			}
+			if legal, onlySummary := b.PreviewSummary(action); !legal || onlySummary != summary {
+				t.Errorf("Move %d: PreviewSummary(%s)=%v, wanted %v", move, action, onlySummary, summary)
+			}
+		}
+		if b.Derived.Hash != hash || b.MoveNumber != moveNumber {
+			t.Fatalf("Move %d: Preview changed the board", move)
+		}
+		b = b.Act(b.Derived.Actions[rng.Intn(len(b.Derived.Actions))])
+	}
+
+	// Illegal actions: moving from an empty position, and passing with actions available.
+	for _, action := range []Action{
+		{Move: true, Piece: ANT, SourcePos: Pos{20, 20}, TargetPos: Pos{21, 20}},
+		SKIP_ACTION,
+	} {
+		if next, legal, summary := b.Preview(action); legal || next != nil || summary != (PositionSummary{}) {
+			t.Errorf("Illegal action %s previewed as legal=%v, next=%v, summary=%v", action, legal, next, summary)
+		}
+		if legal, _ := b.PreviewSummary(action); legal {
+			t.Errorf("Illegal action %s summarized as legal", action)
+		}
+	}
+}
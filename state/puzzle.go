@@ -0,0 +1,123 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Puzzle is a position with a known solution, for the player to find.
+type Puzzle struct {
+	Name  string
+	Board *Board
+
+	// Solution is the line of actions that solves the puzzle: the moves of
+	// the player to solve (Board.NextPlayer) alternated with the replies of
+	// the opponent. For a mate-in-N it has 2N-1 actions.
+	Solution []Action
+}
+
+// PuzzleResult is the outcome of checking a move of a puzzle, see Puzzle.Check.
+type PuzzleResult uint8
+
+const (
+	PUZZLE_WRONG PuzzleResult = iota
+	PUZZLE_CORRECT
+	PUZZLE_SOLVED
+)
+
+func (r PuzzleResult) String() string {
+	switch r {
+	case PUZZLE_WRONG:
+		return "wrong"
+	case PUZZLE_CORRECT:
+		return "correct"
+	case PUZZLE_SOLVED:
+		return "solved"
+	}
+	return fmt.Sprintf("PuzzleResult(%d)", r)
+}
+
+// jsonPuzzle is the JSON representation of a Puzzle, with the solution in
+// notation (see Action.Notation).
+type jsonPuzzle struct {
+	Name     string   `json:"name,omitempty"`
+	Board    *Board   `json:"board"`
+	Solution []string `json:"solution"`
+}
+
+// Check checks the action taken by the player at the given step of the solution
+// (0 for the first move, 2 for the second, ...), on the board b of that step.
+//
+// An action is correct if it is the one in the solution, or if it wins the
+// game right away: alternative mates are also accepted. It returns
+// PUZZLE_SOLVED if the action wins or completes the solution, in which case
+// there is no reply. Otherwise, for a correct action, it returns the reply of
+// the opponent from the solution. It returns an error if the action is not
+// valid on the board, see Board.ActChecked.
+func (p *Puzzle) Check(step int, b *Board, action Action) (result PuzzleResult, reply Action, err error) {
+	if step < 0 || step >= len(p.Solution) || step%2 != 0 {
+		return PUZZLE_WRONG, reply, fmt.Errorf("Invalid step %d for puzzle with %d actions in the solution",
+			step, len(p.Solution))
+	}
+	newB, err := b.ActChecked(action)
+	if err != nil {
+		return PUZZLE_WRONG, reply, err
+	}
+	if newB.IsFinished() && !newB.Draw() && newB.Winner() == b.NextPlayer {
+		return PUZZLE_SOLVED, reply, nil
+	}
+	if action != p.Solution[step] {
+		return PUZZLE_WRONG, reply, nil
+	}
+	if step+1 >= len(p.Solution) {
+		return PUZZLE_SOLVED, reply, nil
+	}
+	return PUZZLE_CORRECT, p.Solution[step+1], nil
+}
+
+// LoadPuzzles reads puzzles in JSON, one per line, for instance:
+//
+//   {"name":"Mate in one","board":{...},"solution":["A0,0>2,-1"]}
+//
+// Where the board is in the format of Board.MarshalJSON and the solution in
+// the notation of Action.Notation. Empty lines and lines starting with "#" are
+// ignored. It returns an error if the solution is not valid for the board.
+func LoadPuzzles(r io.Reader) (puzzles []*Puzzle, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var jp jsonPuzzle
+		if err = json.Unmarshal([]byte(line), &jp); err != nil {
+			return nil, fmt.Errorf("Failed to decode puzzle in line %d: %v", lineNum, err)
+		}
+		if jp.Board == nil || len(jp.Solution) == 0 {
+			return nil, fmt.Errorf("Puzzle in line %d has no board or solution", lineNum)
+		}
+		puzzle := &Puzzle{Name: jp.Name, Board: jp.Board}
+		b := jp.Board
+		for _, notation := range jp.Solution {
+			action, err := ParseAction(notation)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse solution of puzzle in line %d: %v", lineNum, err)
+			}
+			if b, err = b.ActChecked(action); err != nil {
+				return nil, fmt.Errorf("Invalid solution of puzzle in line %d: %v", lineNum, err)
+			}
+			puzzle.Solution = append(puzzle.Solution, action)
+		}
+		puzzles = append(puzzles, puzzle)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read puzzles: %v", err)
+	}
+	return
+}
@@ -0,0 +1,68 @@
+package state_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// MATE_IN_ONE_PUZZLE: the ant of player 0 surrounds the queen of player 1.
+const MATE_IN_ONE_PUZZLE = "# Puzzles fixture.\n" +
+	`{"name":"Mate in one","board":{"move_number":20,"max_moves":1000,"next_player":0,"pieces":[` +
+	`{"pos":[0,-1],"player":0,"piece":"Q"},{"pos":[1,-1],"player":1,"piece":"G"},` +
+	`{"pos":[-1,0],"player":1,"piece":"S"},{"pos":[0,0],"player":1,"piece":"Q"},` +
+	`{"pos":[1,0],"player":1,"piece":"G"},{"pos":[0,1],"player":0,"piece":"S"},` +
+	`{"pos":[1,1],"player":0,"piece":"A"}]},"solution":["A1,1>-1,-1"]}` + "\n\n"
+
+func TestPuzzle(t *testing.T) {
+	puzzles, err := LoadPuzzles(strings.NewReader(MATE_IN_ONE_PUZZLE))
+	if err != nil {
+		t.Fatalf("Failed to load puzzles: %v", err)
+	}
+	if len(puzzles) != 1 {
+		t.Fatalf("Want 1 puzzle, got %d", len(puzzles))
+	}
+	puzzle := puzzles[0]
+	b := puzzle.Board
+	if puzzle.Name != "Mate in one" || len(puzzle.Solution) != 1 {
+		t.Fatalf("Unexpected puzzle %q with solution %v", puzzle.Name, puzzle.Solution)
+	}
+
+	// Solution.
+	result, _, err := puzzle.Check(0, b, puzzle.Solution[0])
+	if err != nil || result != PUZZLE_SOLVED {
+		t.Errorf("Solution %s should solve the puzzle, got %s, %v", puzzle.Solution[0], result, err)
+	}
+
+	// Any other valid action is wrong.
+	var other Action
+	for _, action := range b.Derived.Actions {
+		if action != puzzle.Solution[0] {
+			other = action
+			break
+		}
+	}
+	if result, _, err = puzzle.Check(0, b, other); err != nil || result != PUZZLE_WRONG {
+		t.Errorf("Action %s should be wrong, got %s, %v", other, result, err)
+	}
+
+	// Invalid actions return an error.
+	invalid := Action{Move: true, Piece: QUEEN, SourcePos: Pos{0, -1}, TargetPos: Pos{5, 5}}
+	if _, _, err = puzzle.Check(0, b, invalid); err == nil {
+		t.Errorf("Invalid action %s accepted with no errors", invalid)
+	}
+
+	// A longer line: a correct move that doesn't win returns the reply of the opponent.
+	reply := b.Act(other).Derived.Actions[0]
+	line := &Puzzle{Board: b, Solution: []Action{other, reply, puzzle.Solution[0]}}
+	if result, gotReply, err := line.Check(0, b, other); err != nil || result != PUZZLE_CORRECT || gotReply != reply {
+		t.Errorf("Action %s should be correct with reply %s, got %s, %s, %v", other, reply, result, gotReply, err)
+	}
+
+	// Solutions not valid for the board are rejected.
+	invalidPuzzle := strings.Replace(MATE_IN_ONE_PUZZLE, "A1,1>-1,-1", "A1,1>5,5", 1)
+	if _, err = LoadPuzzles(strings.NewReader(invalidPuzzle)); err == nil {
+		t.Errorf("Puzzle with invalid solution loaded with no errors")
+	}
+}
@@ -0,0 +1,78 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RENDER_CELL_WIDTH is the number of characters per column in RenderASCII.
+const RENDER_CELL_WIDTH = 3
+
+// RenderASCII returns a compact text drawing of the board, for tests, logs and
+// headless debugging. The first line has the move number and next player, the
+// second the x coordinates of the columns. Then each row of the board takes two
+// lines, since odd columns are shifted half a position down (see
+// Pos.Neighbours): even columns are drawn in the first line, prefixed with the y
+// coordinate of the row, and odd columns in the second.
+//
+// Pieces are drawn with their letter, upper case for player 0 and lower case for
+// player 1, followed by the number of pieces in the stack if there is more than
+// one. Empty positions in the rendered area are drawn with a ".". For instance:
+//
+//	Move #6, next player 1
+//	     -1  0  1
+//	  0      Q
+//	      s    B2
+//	  1      q
+//	      .     .
+func (b *Board) RenderASCII() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Move #%d, next player %d\n", b.MoveNumber, b.NextPlayer)
+	if b.NumPiecesOnBoard() == 0 {
+		sb.WriteString("(empty board)\n")
+		return sb.String()
+	}
+	minX, maxX, minY, maxY := b.UsedLimits()
+	var lines []string
+	line := strings.Repeat(" ", RENDER_CELL_WIDTH+1)
+	for x := minX; x <= maxX; x++ {
+		line += fmt.Sprintf("%*d", RENDER_CELL_WIDTH, x)
+	}
+	lines = append(lines, line)
+	for y := minY; y <= maxY; y++ {
+		for odd := int8(0); odd < 2; odd++ {
+			if odd == 0 {
+				line = fmt.Sprintf("%*d ", RENDER_CELL_WIDTH, y)
+			} else {
+				line = strings.Repeat(" ", RENDER_CELL_WIDTH+1)
+			}
+			for x := minX; x <= maxX; x++ {
+				if x&1 != odd {
+					line += strings.Repeat(" ", RENDER_CELL_WIDTH)
+				} else {
+					line += fmt.Sprintf("%*s", RENDER_CELL_WIDTH, b.renderCell(Pos{x, y}))
+				}
+			}
+			lines = append(lines, strings.TrimRight(line, " "))
+		}
+	}
+	sb.WriteString(strings.TrimRight(strings.Join(lines, "\n"), "\n"))
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// renderCell returns the text of one position in RenderASCII.
+func (b *Board) renderCell(pos Pos) string {
+	if !b.HasPiece(pos) {
+		return "."
+	}
+	player, piece, stacked := b.PieceAt(pos)
+	s := PieceLetters[piece]
+	if player == 1 {
+		s = strings.ToLower(s)
+	}
+	if stacked {
+		s += fmt.Sprint(b.CountAt(pos))
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package state_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestRenderASCII(t *testing.T) {
+	board := NewBoard()
+	if got, want := board.RenderASCII(), "Move #1, next player 0\n(empty board)\n"; got != want {
+		t.Errorf("Empty board: got\n%s\nwanted\n%s", got, want)
+	}
+
+	board = buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, QUEEN},
+		{Pos{1, 0}, 1, ANT},
+		{Pos{1, 0}, 0, BEETLE},
+		{Pos{0, 1}, 1, QUEEN},
+		{Pos{-1, 0}, 1, SPIDER},
+	})
+	board.MoveNumber = 6
+	board.NextPlayer = 1
+	board.BuildDerived()
+	want := "Move #6, next player 1\n" +
+		"     -1  0  1\n" +
+		"  0      Q\n" +
+		"      s    B2\n" +
+		"  1      q\n" +
+		"      .     ."
+	if got := board.RenderASCII(); got != want+"\n" {
+		t.Errorf("Got rendering\n%s\nwanted\n%s", got, want)
+	}
+
+	// Vertical line, with a stack of 3 at the top.
+	board = buildBoard([]PieceLayout{
+		{Pos{2, -1}, 1, GRASSHOPPER},
+		{Pos{2, -1}, 0, BEETLE},
+		{Pos{2, -1}, 1, BEETLE},
+		{Pos{2, 0}, 0, QUEEN},
+		{Pos{2, 1}, 1, QUEEN},
+	})
+	board.MoveNumber = 8
+	board.BuildDerived()
+	want = "Move #8, next player 0\n" +
+		"      2\n" +
+		" -1  b3\n" +
+		"\n" +
+		"  0   Q\n" +
+		"\n" +
+		"  1   q\n"
+	if got := board.RenderASCII(); got != want {
+		t.Errorf("Got rendering\n%s\nwanted\n%s", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package state
+
+import "fmt"
+
+// PlacedPiece is a piece of a player at a position of the board, used to
+// describe a BoardSetup.
+type PlacedPiece struct {
+	Pos    Pos
+	Player uint8
+	Piece  Piece
+}
+
+// BoardSetup describes a starting position of the board, for instance for puzzles.
+// See NewBoardWithSetup.
+type BoardSetup struct {
+	// Pieces on the board. Stacked pieces are listed from the bottom up.
+	Pieces []PlacedPiece
+
+	// Available (off-board) pieces of each player. If nil, the player has the
+	// initial pieces (INITIAL_AVAILABILITY) minus the ones it has on the board.
+	Available [NUM_PLAYERS]*Availability
+
+	NextPlayer uint8
+
+	// MoveNumber and MaxMoves take the values of NewBoard if 0.
+	MoveNumber, MaxMoves int
+
+	NoQueenFirstMove bool
+}
+
+// NewBoardWithSetup creates a new board with the given setup, and builds its
+// derived information. It generalizes NewBoard, which is equivalent to
+// NewBoardWithSetup(BoardSetup{}).
+//
+// It returns an error if the setup is not valid, see Board.Validate.
+func NewBoardWithSetup(setup BoardSetup) (*Board, error) {
+	if setup.NextPlayer >= NUM_PLAYERS {
+		return nil, fmt.Errorf("Invalid next player %d", setup.NextPlayer)
+	}
+	b := NewBoard()
+	b.NextPlayer = setup.NextPlayer
+	if setup.MoveNumber != 0 {
+		b.MoveNumber = setup.MoveNumber
+	}
+	if setup.MaxMoves != 0 {
+		b.MaxMoves = setup.MaxMoves
+	}
+	b.NoQueenFirstMove = setup.NoQueenFirstMove
+
+	for _, p := range setup.Pieces {
+		if p.Player >= NUM_PLAYERS {
+			return nil, fmt.Errorf("Invalid player %d for piece at %s", p.Player, p.Pos)
+		}
+		if p.Piece == NO_PIECE || p.Piece >= LAST_PIECE_TYPE {
+			return nil, fmt.Errorf("Invalid piece %d for player %d at %s", p.Piece, p.Player, p.Pos)
+		}
+		if b.StackAt(p.Pos).CountPieces() >= 8 {
+			return nil, fmt.Errorf("Too many pieces stacked at %s", p.Pos)
+		}
+		b.StackPiece(p.Pos, p.Player, p.Piece)
+		if setup.Available[p.Player] == nil {
+			available := b.Available(p.Player, p.Piece)
+			if available == 0 {
+				return nil, fmt.Errorf("Too many pieces %s of player %d on the board", p.Piece, p.Player)
+			}
+			b.SetAvailable(p.Player, p.Piece, available-1)
+		}
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		if setup.Available[player] != nil {
+			b.available[player] = *setup.Available[player]
+		}
+	}
+
+	b.BuildDerived()
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
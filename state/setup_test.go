@@ -0,0 +1,80 @@
+package state_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestNewBoardWithSetup(t *testing.T) {
+	if _, err := NewBoardWithSetup(BoardSetup{}); err != nil {
+		t.Fatalf("Failed to create default board: %v", err)
+	}
+
+	// Puzzle: both queens on the board, and player 0 has only a spider left.
+	queen0, queen1 := Pos{0, 0}, Pos{1, 0}
+	b, err := NewBoardWithSetup(BoardSetup{
+		Pieces: []PlacedPiece{
+			{queen0, 0, QUEEN},
+			{queen1, 1, QUEEN},
+		},
+		Available:  [NUM_PLAYERS]*Availability{{0, 0, 0, 0, 1}, nil},
+		MoveNumber: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create board with setup: %v", err)
+	}
+	if b.MoveNumber != 3 || b.NextPlayer != 0 {
+		t.Errorf("Want MoveNumber=3, NextPlayer=0, got %d and %d", b.MoveNumber, b.NextPlayer)
+	}
+	if got := b.Available(1, ANT); got != 3 {
+		t.Errorf("Player 1 should have the initial 3 ants available, got %d", got)
+	}
+
+	// Expected: spider placements next to queen0 but not touching queen1, and
+	// queen0 moves to the cells next to both queens.
+	want := make(map[Action]bool)
+	for _, pos := range queen0.Neighbours() {
+		touchesOpponent := false
+		for _, neighbour := range pos.Neighbours() {
+			if neighbour == queen1 {
+				touchesOpponent = true
+			}
+		}
+		if pos == queen1 {
+			continue
+		} else if touchesOpponent {
+			want[Action{Move: true, Piece: QUEEN, SourcePos: queen0, TargetPos: pos}] = true
+		} else {
+			want[Action{Move: false, Piece: SPIDER, TargetPos: pos}] = true
+		}
+	}
+	got := make(map[Action]bool)
+	for _, action := range b.Derived.Actions {
+		got[action] = true
+	}
+	if len(got) != len(want) {
+		t.Errorf("Want %d actions, got %d: %v", len(want), len(got), b.Derived.Actions)
+	}
+	for action := range want {
+		if !got[action] {
+			t.Errorf("Missing action %s, got %v", action, b.Derived.Actions)
+		}
+	}
+
+	// Invalid setups.
+	for name, setup := range map[string]BoardSetup{
+		"two queens": {Pieces: []PlacedPiece{{Pos{0, 0}, 0, QUEEN}, {Pos{1, 0}, 0, QUEEN}}},
+		"over-count": {
+			Pieces:    []PlacedPiece{{Pos{0, 0}, 0, QUEEN}},
+			Available: [NUM_PLAYERS]*Availability{&INITIAL_AVAILABILITY, nil},
+		},
+		"disconnected":   {Pieces: []PlacedPiece{{Pos{0, 0}, 0, QUEEN}, {Pos{3, 3}, 1, QUEEN}}},
+		"invalid piece":  {Pieces: []PlacedPiece{{Pos{0, 0}, 0, NO_PIECE}}},
+		"invalid player": {NextPlayer: NUM_PLAYERS},
+	} {
+		if _, err := NewBoardWithSetup(setup); err == nil {
+			t.Errorf("Invalid setup %q created with no errors", name)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package state
 import (
 	"encoding/gob"
 	"fmt"
+	"math"
+	"math/rand"
 	"sort"
 )
 
@@ -44,6 +46,18 @@ const TOTAL_PIECES_PER_PLAYER = 11
 // Pos packages x, y position.
 type Pos [2]int8
 
+// RECENTER_LIMIT is the largest absolute coordinate of a piece before the board
+// is translated back to the origin (see Board.Act): the Hive board is unbounded,
+// but Pos coordinates are int8, and a hive that drifts far (e.g. pieces walking
+// in a line) would otherwise wrap around. It leaves room for the positions to be
+// rotated around the origin (see Pos.Rotate) without overflowing, and it's low
+// enough that the actions of any board, which reach one position beyond the
+// pieces, can be encoded (see Action.Encode).
+const RECENTER_LIMIT = 62
+
+// Fails to compile if the actions of a board can be out of the range of Action.Encode.
+const _ = uint(MAX_ENCODED_COORD-RECENTER_LIMIT-1) + uint(-MIN_ENCODED_COORD-RECENTER_LIMIT-1)
+
 // Array with counts of pieces for A, B, G, Q, S respectively
 type Availability [5]uint8
 
@@ -52,15 +66,28 @@ type Availability [5]uint8
 type Board struct {
 	available            [NUM_PLAYERS]Availability
 	board                map[Pos]EncodedStack
+	occupied             occupancy
 	MoveNumber, MaxMoves int
 	NextPlayer           uint8
 
+	// NoQueenFirstMove is an optional rule (used in tournaments) that forbids
+	// placing the queen as a player's first piece. Defaults to false.
+	NoQueenFirstMove bool
+
 	// Previous is a link to the Board at the previous position, or nil if
 	// this is the initial Board.
 	Previous *Board
 
+	// Translation applied by Act to the positions of the Previous board, when
+	// the hive drifted beyond RECENTER_LIMIT. Usually zero.
+	Translation Pos
+
 	// Derived information is regenerated after each move.
 	Derived *Derived
+
+	// Random number generator of the game, and its seed, see WithSeed.
+	rng  *rand.Rand
+	seed int64
 }
 
 func (p Piece) String() string {
@@ -202,9 +229,13 @@ func (b *Board) Copy() *Board {
 	*newB = *b
 	newB.Derived = nil
 	newB.Previous = b
+	newB.Translation = Pos{}
 	newB.board = make(map[Pos]EncodedStack)
+	// The occupancy is rebuilt, so its bounding box follows the hive as it moves.
+	newB.occupied = occupancy{}
 	for pos, stack := range b.board {
 		newB.board[pos] = stack
+		newB.occupied.set(pos)
 	}
 	return newB
 }
@@ -226,19 +257,28 @@ func (b *Board) SetAvailable(player uint8, piece Piece, value uint8) {
 
 // HasPiece returns whether there is a piece on the given location of the board.
 func (b *Board) HasPiece(pos Pos) bool {
+	if !b.occupied.mayHave(pos) {
+		return false
+	}
+	if !b.occupied.aliased {
+		return true
+	}
 	stack, ok := b.board[pos]
 	return ok && stack.HasPiece()
 }
 
 // PieceAt returns the piece at the top of the stack on the given position.
 func (b *Board) PieceAt(pos Pos) (player uint8, piece Piece, stacked bool) {
-	stack, _ := b.board[pos]
+	stack := b.StackAt(pos)
 	player, piece = stack.PieceAt(0)
 	stacked = ((stack & 0x7F00) != 0)
 	return
 }
 
 func (b *Board) CountAt(pos Pos) uint8 {
+	if !b.occupied.mayHave(pos) {
+		return 0
+	}
 	if stack, ok := b.board[pos]; ok {
 		return stack.CountPieces()
 	}
@@ -248,6 +288,9 @@ func (b *Board) CountAt(pos Pos) uint8 {
 // StackAt returns the EncodedStack at given position at the board. It will return
 // an empty stack if there is no position there.
 func (b *Board) StackAt(pos Pos) (stack EncodedStack) {
+	if !b.occupied.mayHave(pos) {
+		return
+	}
 	stack, _ = b.board[pos]
 	return
 }
@@ -258,6 +301,7 @@ func (b *Board) StackPiece(pos Pos, player uint8, piece Piece) {
 	stack, _ := b.board[pos]
 	stack = stack.StackPiece(player, piece)
 	b.board[pos] = stack
+	b.occupied.set(pos)
 }
 
 // PopPiece pops the piece at the given location, and returns it.
@@ -268,6 +312,7 @@ func (b *Board) PopPiece(pos Pos) (player uint8, piece Piece) {
 		b.board[pos] = stack
 	} else {
 		delete(b.board, pos)
+		b.occupied.clear(pos)
 	}
 	return
 }
@@ -302,6 +347,26 @@ func (b *Board) UsedLimits() (min_x, max_x, min_y, max_y int8) {
 	return
 }
 
+// recenter translates the pieces so the hive is centered around the origin, if
+// any of them is beyond RECENTER_LIMIT, and sets Translation. The translation in
+// x is even, so the offset coordinates keep the same neighbours (see Neighbours).
+// It must be called before BuildDerived.
+func (b *Board) recenter() {
+	minX, maxX, minY, maxY := b.UsedLimits()
+	if minX >= -RECENTER_LIMIT && maxX <= RECENTER_LIMIT && minY >= -RECENTER_LIMIT && maxY <= RECENTER_LIMIT {
+		return
+	}
+	dx := -((int(minX) + int(maxX)) / 2) &^ 1
+	dy := -((int(minY) + int(maxY)) / 2)
+	b.Translation = Pos{int8(dx), int8(dy)}
+	board := b.board
+	b.board = make(map[Pos]EncodedStack, len(board))
+	for pos, stack := range board {
+		b.board[Pos{pos[0] + b.Translation[0], pos[1] + b.Translation[1]}] = stack
+	}
+	b.rebuildOccupancy()
+}
+
 // OccupiedPositions returns all the positions used.
 func (b *Board) OccupiedPositions() (poss []Pos) {
 	poss = make([]Pos, 0, len(b.board))
@@ -319,18 +384,59 @@ func (b *Board) OccupiedPositions() (poss []Pos) {
 //
 // Also the neighbours are listed in a clockwise manner.
 func (pos Pos) Neighbours() []Pos {
+	neighbours := pos.NeighboursArray()
+	return neighbours[:]
+}
+
+// NeighboursArray is like Neighbours, but returns an array, so it doesn't
+// allocate. Prefer it in hot loops.
+func (pos Pos) NeighboursArray() [NUM_NEIGHBOURS]Pos {
 	x, y := pos[0], pos[1]
 	if x%2 == 0 {
-		return []Pos{
+		return [NUM_NEIGHBOURS]Pos{
 			{x, y - 1}, {x + 1, y - 1}, {x + 1, y},
 			{x, y + 1}, {x - 1, y}, {x - 1, y - 1}}
 	} else {
-		return []Pos{
+		return [NUM_NEIGHBOURS]Pos{
 			{x, y - 1}, {x + 1, y}, {x + 1, y + 1},
 			{x, y + 1}, {x - 1, y + 1}, {x - 1, y}}
 	}
 }
 
+// Distance returns the number of steps between the two positions, ignoring the
+// pieces on the board.
+func (pos Pos) Distance(other Pos) int {
+	// Convert to axial coordinates (q, r), where q = x and r = y - floor(x/2).
+	axial := func(p Pos) (q, r int) {
+		q = int(p[0])
+		r = int(p[1]) - (q-(q&1))/2
+		return
+	}
+	q1, r1 := axial(pos)
+	q2, r2 := axial(other)
+	dq, dr := q1-q2, r1-r2
+	return (abs(dq) + abs(dr) + abs(dq+dr)) / 2
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Cartesian converts the position to cartesian coordinates, where the distance
+// between the centers of neighbouring positions is 1.
+func (pos Pos) Cartesian() (x, y float64) {
+	x = float64(pos.X()) * math.Sqrt(3) / 2
+	y = float64(pos.Y())
+	if pos.X()&1 != 0 {
+		// Odd columns are shifted half a position down, see Neighbours.
+		y += 0.5
+	}
+	return
+}
+
 // FilterPositions filters the given positions according to the given filter.
 // It destroys the contents of the provided slice and reuses the allocated space
 // for the returned slice.
@@ -361,6 +467,17 @@ func (b *Board) EmptyNeighbours(pos Pos) (poss []Pos) {
 	return
 }
 
+// NumOccupiedNeighbours returns the number of occupied neighbour positions. Same
+// as len(b.OccupiedNeighbours(pos)), but without allocating.
+func (b *Board) NumOccupiedNeighbours(pos Pos) (count int) {
+	for _, nPos := range pos.NeighboursArray() {
+		if b.HasPiece(nPos) {
+			count++
+		}
+	}
+	return
+}
+
 func (b *Board) PlayerNeighbours(player uint8, pos Pos) (poss []Pos) {
 	poss = pos.Neighbours()
 	poss = FilterPositions(poss, func(p Pos) bool {
@@ -382,10 +499,107 @@ func (b *Board) OpponentNeighbours(pos Pos) (poss []Pos) {
 	return b.PlayerNeighbours(b.OpponentPlayer(), pos)
 }
 
+// MOVE_EVAL_TOP_ACTIONS is the number of most probable actions saved in a MoveEval.
+const MOVE_EVAL_TOP_ACTIONS = 3
+
+// MoveEval is the evaluation of a position of a match by the AI that played it,
+// optionally saved with the match for game review (see SaveMatchWithEvals).
+type MoveEval struct {
+	// Evaluated is false for positions not evaluated, e.g. moves played by a human.
+	Evaluated bool
+
+	// Score of the board for the player to move.
+	Score float32
+
+	// TopActions are the most probable actions according to the policy, and
+	// TopProbs their probabilities, up to MOVE_EVAL_TOP_ACTIONS.
+	TopActions []Action
+	TopProbs   []float32
+}
+
+// NewMoveEval creates the evaluation of board b, given the score and the
+// probabilities of each of its actions (b.Derived.Actions). actionProbs is
+// optional.
+func NewMoveEval(b *Board, score float32, actionProbs []float32) (eval MoveEval) {
+	eval.Evaluated = true
+	eval.Score = score
+	if len(actionProbs) != len(b.Derived.Actions) {
+		return
+	}
+	indices := make([]int, len(actionProbs))
+	for ii := range indices {
+		indices[ii] = ii
+	}
+	sort.SliceStable(indices, func(i, j int) bool { return actionProbs[indices[i]] > actionProbs[indices[j]] })
+	if len(indices) > MOVE_EVAL_TOP_ACTIONS {
+		indices = indices[:MOVE_EVAL_TOP_ACTIONS]
+	}
+	for _, idx := range indices {
+		eval.TopActions = append(eval.TopActions, b.Derived.Actions[idx])
+		eval.TopProbs = append(eval.TopProbs, actionProbs[idx])
+	}
+	return
+}
+
 // SaveMatch will "save" (encode) the match and scores for future reconstruction.
 // scores is opional.
 func SaveMatch(enc *gob.Encoder, MaxMoves int, actions []Action, scores []float32) error {
-	if err := enc.Encode(MaxMoves); err != nil {
+	return SaveMatchWithEvals(enc, MaxMoves, actions, scores, nil)
+}
+
+// MatchInfo is how a match was played, saved with it by SaveMatchWithInfo.
+type MatchInfo struct {
+	// Seed of the random number generator of the match (see Board.WithSeed), or
+	// 0 if it used the global one.
+	Seed int64
+
+	// Capped, Resigned and Adjudicated tell why a match stopped at an unfinished
+	// board, see ai.GameRecord.
+	Capped, Resigned, Adjudicated bool
+
+	// NoQueenFirstMove is the rule the match was played with, see
+	// Board.NoQueenFirstMove. It is set in the initial board returned by
+	// LoadMatchWithInfo.
+	NoQueenFirstMove bool
+}
+
+// MATCH_INFO_FLAG is added (negated) to the MaxMoves saved by SaveMatchWithInfo,
+// to flag that the evals (possibly nil) and the MatchInfo follow the scores.
+const MATCH_INFO_FLAG = 1 << 30
+
+// SaveMatchWithEvals is like SaveMatch, but also saves the evaluation of each
+// position, one per action, for game review. evals is optional: if nil, the
+// match is saved in the same format as SaveMatch. Otherwise the MaxMoves saved
+// is negated (-MaxMoves-1) to flag that the evals follow.
+func SaveMatchWithEvals(enc *gob.Encoder, MaxMoves int, actions []Action, scores []float32, evals []MoveEval) error {
+	encodedMaxMoves := MaxMoves
+	if evals != nil {
+		encodedMaxMoves = -MaxMoves - 1
+	}
+	return saveMatch(enc, encodedMaxMoves, actions, scores, evals, evals != nil)
+}
+
+// SaveMatchWithInfo is like SaveMatchWithEvals, but also saves the MatchInfo.
+// evals is optional.
+func SaveMatchWithInfo(enc *gob.Encoder, MaxMoves int, actions []Action, scores []float32, evals []MoveEval,
+	info MatchInfo) error {
+	if err := saveMatch(enc, -MATCH_INFO_FLAG-MaxMoves, actions, scores, evals, true); err != nil {
+		return err
+	}
+	if err := enc.Encode(info); err != nil {
+		return fmt.Errorf("Failed to encode match's info: %v", err)
+	}
+	return nil
+}
+
+// saveMatch saves the match with the given encoded MaxMoves, and evals if
+// saveEvals is set.
+func saveMatch(enc *gob.Encoder, encodedMaxMoves int, actions []Action, scores []float32, evals []MoveEval,
+	saveEvals bool) error {
+	if evals != nil && len(evals) != len(actions) {
+		return fmt.Errorf("Failed to encode match: %d evals given for %d actions", len(evals), len(actions))
+	}
+	if err := enc.Encode(encodedMaxMoves); err != nil {
 		return fmt.Errorf("Failed to encode match's board: %v", err)
 	}
 	if err := enc.Encode(actions); err != nil {
@@ -394,16 +608,44 @@ func SaveMatch(enc *gob.Encoder, MaxMoves int, actions []Action, scores []float3
 	if err := enc.Encode(scores); err != nil {
 		return fmt.Errorf("Failed to encode match's scores: %v", err)
 	}
+	if saveEvals {
+		if err := enc.Encode(evals); err != nil {
+			return fmt.Errorf("Failed to encode match's evals: %v", err)
+		}
+	}
 	return nil
 }
 
 // LoadMatch restores match initial board, actions and scores.
 func LoadMatch(dec *gob.Decoder) (initial *Board, actions []Action, scores []float32, err error) {
+	initial, actions, scores, _, err = LoadMatchWithEvals(dec)
+	return
+}
+
+// LoadMatchWithEvals is like LoadMatch, but also returns the evaluation of each
+// position, if saved with SaveMatchWithEvals, or nil otherwise.
+func LoadMatchWithEvals(dec *gob.Decoder) (initial *Board, actions []Action, scores []float32, evals []MoveEval, err error) {
+	initial, actions, scores, evals, _, err = LoadMatchWithInfo(dec)
+	return
+}
+
+// LoadMatchWithInfo is like LoadMatchWithEvals, but also returns the MatchInfo,
+// if saved with SaveMatchWithInfo, or nil otherwise. The initial board is
+// configured with the rules in the MatchInfo.
+func LoadMatchWithInfo(dec *gob.Decoder) (initial *Board, actions []Action, scores []float32, evals []MoveEval,
+	info *MatchInfo, err error) {
 	initial = NewBoard()
 	err = dec.Decode(&initial.MaxMoves)
 	if err != nil {
 		return
 	}
+	hasInfo := initial.MaxMoves <= -MATCH_INFO_FLAG
+	hasEvals := initial.MaxMoves < 0
+	if hasInfo {
+		initial.MaxMoves = -initial.MaxMoves - MATCH_INFO_FLAG
+	} else if hasEvals {
+		initial.MaxMoves = -initial.MaxMoves - 1
+	}
 	actions = make([]Action, 0, initial.MaxMoves)
 	err = dec.Decode(&actions)
 	if err != nil {
@@ -411,5 +653,20 @@ func LoadMatch(dec *gob.Decoder) (initial *Board, actions []Action, scores []flo
 	}
 	scores = make([]float32, 0, initial.MaxMoves)
 	err = dec.Decode(&scores)
+	if err != nil || !hasEvals {
+		return
+	}
+	err = dec.Decode(&evals)
+	if err != nil || !hasInfo {
+		return
+	}
+	info = &MatchInfo{}
+	if err = dec.Decode(info); err != nil {
+		return
+	}
+	if info.NoQueenFirstMove {
+		initial.NoQueenFirstMove = true
+		initial.BuildDerived()
+	}
 	return
 }
@@ -1,7 +1,11 @@
 package state_test
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
+	"math"
+	"math/rand"
 	"reflect"
 	"testing"
 
@@ -102,6 +106,18 @@ func TestOccupiedNeighbours(t *testing.T) {
 	}
 }
 
+func TestPosCartesian(t *testing.T) {
+	for _, pos := range []Pos{{0, 0}, {1, 0}, {-1, 0}, {2, -3}, {-3, 2}} {
+		x, y := pos.Cartesian()
+		for _, neighbour := range pos.Neighbours() {
+			nx, ny := neighbour.Cartesian()
+			if d := math.Hypot(nx-x, ny-y); math.Abs(d-1) > 1e-6 {
+				t.Errorf("Distance from %s to neighbour %s is %g, wanted 1", pos, neighbour, d)
+			}
+		}
+	}
+}
+
 func TestQueenMoves(t *testing.T) {
 	layout := []PieceLayout{
 		{Pos{0, 0}, 0, ANT},
@@ -313,31 +329,33 @@ func TestAct(t *testing.T) {
 	// printBoard(board)
 
 	// Player 0: unstack beetle.
+	previous := board
 	board = board.Act(Action{Move: true, Piece: BEETLE, SourcePos: Pos{0, 0}, TargetPos: Pos{-1, -1}})
 	player, piece, stacked := board.PieceAt(Pos{-1, -1})
 	if player != 0 || piece != BEETLE || stacked {
-		t.Errorf("Expected Player's 0 Beetle unstacked at (-1, -1), got player=%d, piece=%s, stacked=%v",
-			player, PieceNames[piece], stacked)
+		t.Errorf("Expected Player's 0 Beetle unstacked at (-1, -1), got player=%d, piece=%s, stacked=%v. Changes:\n%s",
+			player, PieceNames[piece], stacked, DiffBoards(previous, board))
 	}
 	player, piece, stacked = board.PieceAt(Pos{0, 0})
 	count := board.CountAt(Pos{0, 0})
 	if player != 1 || piece != BEETLE || !stacked || count != 2 {
-		t.Errorf("Expected Player's 1 Beetle stacked at (0, 0), got player=%d, piece=%s, stacked=%v, count=%d",
-			player, PieceNames[piece], stacked, count)
+		t.Errorf("Expected Player's 1 Beetle stacked at (0, 0), got player=%d, piece=%s, stacked=%v, count=%d. Changes:\n%s",
+			player, PieceNames[piece], stacked, count, DiffBoards(previous, board))
 	}
 
 	// Player 1: move beetle.
+	previous = board
 	board = board.Act(Action{Move: true, Piece: BEETLE, SourcePos: Pos{0, 0}, TargetPos: Pos{0, -1}})
 	player, piece, stacked = board.PieceAt(Pos{0, 0})
 	if player != 0 || piece != ANT || stacked {
-		t.Errorf("Expected Player's 0 Ant stacked at (0, 0), got player=%d, piece=%s, stacked=%v",
-			player, PieceNames[piece], stacked)
+		t.Errorf("Expected Player's 0 Ant stacked at (0, 0), got player=%d, piece=%s, stacked=%v. Changes:\n%s",
+			player, PieceNames[piece], stacked, DiffBoards(previous, board))
 	}
 	player, piece, stacked = board.PieceAt(Pos{0, -1})
 	count = board.CountAt(Pos{0, -1})
 	if player != 1 || piece != BEETLE || !stacked || count != 2 {
-		t.Errorf("Expected Player's 1 Beetle stacked at (0, -1), got player=%d, piece=%s, stacked=%v, count=%d",
-			player, PieceNames[piece], stacked, count)
+		t.Errorf("Expected Player's 1 Beetle stacked at (0, -1), got player=%d, piece=%s, stacked=%v, count=%d. Changes:\n%s",
+			player, PieceNames[piece], stacked, count, DiffBoards(previous, board))
 	}
 	// printBoard(board)
 
@@ -423,3 +441,478 @@ func BenchmarkCalcDerived(b *testing.B) {
 		board.Act(action)
 	}
 }
+
+// placeFirst plays the first placement of the given piece available.
+func placeFirst(t *testing.T, b *Board, piece Piece) *Board {
+	for _, action := range b.Derived.Actions {
+		if !action.Move && action.Piece == piece {
+			return b.Act(action)
+		}
+	}
+	t.Fatalf("Move #%d: player %d can't place %s", b.MoveNumber, b.NextPlayer, PieceNames[piece])
+	return nil
+}
+
+// TestQueenPlacementRule checks that the queen must be placed by each player's
+// fourth move.
+func TestQueenPlacementRule(t *testing.T) {
+	// Both players place 3 pieces, but no queen.
+	board := NewBoard()
+	for _, piece := range []Piece{ANT, ANT, GRASSHOPPER, GRASSHOPPER, SPIDER, SPIDER} {
+		board = placeFirst(t, board, piece)
+	}
+	for player := 0; player < NUM_PLAYERS; player++ {
+		if len(board.Derived.Actions) == 0 {
+			t.Fatalf("Player %d has no actions in its 4th move", board.NextPlayer)
+		}
+		for _, action := range board.Derived.Actions {
+			if action.Move || action.Piece != QUEEN {
+				t.Errorf("Player %d, 4th move with queen off-board: action %s is not a queen placement",
+					board.NextPlayer, action)
+			}
+		}
+		board = placeFirst(t, board, QUEEN)
+	}
+
+	// Player 0 places the queen early: in its 4th move it can place other pieces
+	// and also move.
+	board = NewBoard()
+	for _, piece := range []Piece{QUEEN, ANT, GRASSHOPPER, GRASSHOPPER, SPIDER, SPIDER} {
+		board = placeFirst(t, board, piece)
+	}
+	var hasOtherPlacement, hasMove bool
+	for _, action := range board.Derived.Actions {
+		if action.Move {
+			hasMove = true
+		} else if action.Piece != QUEEN {
+			hasOtherPlacement = true
+		}
+		if !action.Move && action.Piece == QUEEN {
+			t.Errorf("Player 0 has already placed its queen, but can place it again: %s", action)
+		}
+	}
+	if !hasOtherPlacement || !hasMove {
+		t.Errorf("Player 0 placed its queen early, expected other placements (%v) and moves (%v)",
+			hasOtherPlacement, hasMove)
+	}
+
+	// Player 1 still must place the queen in its 4th move.
+	board = placeFirst(t, board, ANT)
+	for _, action := range board.Derived.Actions {
+		if action.Move || action.Piece != QUEEN {
+			t.Errorf("Player 1, 4th move with queen off-board: action %s is not a queen placement", action)
+		}
+	}
+}
+
+// hasQueenPlacement returns whether any of the actions of the board places the queen.
+func hasQueenPlacement(b *Board) bool {
+	for _, action := range b.Derived.Actions {
+		if !action.Move && action.Piece == QUEEN {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNoQueenFirstMove(t *testing.T) {
+	board := NewBoard()
+	if !hasQueenPlacement(board) {
+		t.Errorf("Without NoQueenFirstMove the queen placement should be available in move 1")
+	}
+
+	board.NoQueenFirstMove = true
+	board.BuildDerived()
+	if hasQueenPlacement(board) {
+		t.Errorf("With NoQueenFirstMove the queen placement should not be available in move 1")
+	}
+	if len(board.Derived.Actions) == 0 {
+		t.Fatalf("With NoQueenFirstMove there should still be other placements in move 1")
+	}
+
+	// The rule applies to the first piece of each player, and is carried over to the
+	// next boards.
+	board = placeFirst(t, board, ANT)
+	if hasQueenPlacement(board) {
+		t.Errorf("With NoQueenFirstMove the queen placement should not be available in move 2")
+	}
+	board = placeFirst(t, board, ANT)
+	if !hasQueenPlacement(board) {
+		t.Errorf("With NoQueenFirstMove the queen placement should be available in move 3")
+	}
+}
+
+// stuckBoard returns a board where neither player can act: there are no pieces
+// left to place, and the only piece on the board, player 0's queen, can't move.
+func stuckBoard() *Board {
+	b := NewBoard()
+	b.StackPiece(Pos{0, 0}, 0, QUEEN)
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			b.SetAvailable(player, piece, 0)
+		}
+	}
+	b.MoveNumber = 20
+	b.BuildDerived()
+	return b
+}
+
+func TestBothStuck(t *testing.T) {
+	b := stuckBoard()
+	if len(b.Derived.Actions) != 0 {
+		t.Fatalf("Expected no actions for player 0, got %v", b.Derived.Actions)
+	}
+	if b.IsFinished() {
+		t.Errorf("Board should only be finished after a forced skip")
+	}
+
+	// After the forced skip, the other player can't move either: draw.
+	b = b.Act(SKIP_ACTION)
+	if len(b.Derived.Actions) != 0 {
+		t.Fatalf("Expected no actions for player 1, got %v", b.Derived.Actions)
+	}
+	if !b.IsFinished() || !b.Draw() {
+		t.Errorf("Both players stuck should be a draw: IsFinished()=%v, Draw()=%v", b.IsFinished(), b.Draw())
+	}
+}
+
+func TestLongWalk(t *testing.T) {
+	// A row of ants of alternating players, where each player moves its ant at
+	// the tail of the row to its head: the hive walks away from the origin. The
+	// positions repeat (up to translation), but only the move generation is
+	// checked here.
+	const numAnts, numMoves = 6, 400
+	b := NewBoard()
+	for x := 0; x < numAnts; x++ {
+		b.StackPiece(Pos{int8(x), 0}, uint8(x%2), ANT)
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			b.SetAvailable(player, piece, 0)
+		}
+	}
+	b.BuildDerived()
+
+	numRecentered := 0
+	for move := 0; move < numMoves; move++ {
+		if b.Translation != (Pos{}) {
+			numRecentered++
+			if b.Translation[0]%2 != 0 {
+				t.Fatalf("Move %d: board translated by %s, x must be even", move, b.Translation)
+			}
+		}
+		minX, maxX, minY, maxY := b.UsedLimits()
+		if int(maxX)-int(minX) != numAnts-1 || minY != maxY {
+			t.Fatalf("Move %d: row of ants broken, limits x=[%d, %d], y=[%d, %d]", move, minX, maxX, minY, maxY)
+		}
+		if minX < -RECENTER_LIMIT || maxX > RECENTER_LIMIT {
+			t.Fatalf("Move %d: hive drifted to x=[%d, %d], beyond RECENTER_LIMIT", move, minX, maxX)
+		}
+		tail, head := Pos{minX, minY}, Pos{maxX + 1, minY}
+		if player, _, _ := b.PieceAt(tail); player != b.NextPlayer {
+			t.Fatalf("Move %d: expected ant of player %d in the tail %s", move, b.NextPlayer, tail)
+		}
+		action := Action{Move: true, Piece: ANT, SourcePos: tail, TargetPos: head}
+		if !b.IsValid(action) {
+			t.Fatalf("Move %d: %s not available in %v", move, action, b.Derived.Actions)
+		}
+		b = b.Act(action)
+		if b.NumPiecesOnBoard() != numAnts {
+			t.Fatalf("Move %d: got %d pieces on board, wanted %d", move, b.NumPiecesOnBoard(), numAnts)
+		}
+	}
+	if numRecentered == 0 {
+		t.Errorf("Hive walked %d positions, but it was never recentered", numMoves)
+	}
+}
+
+func TestSaveMatchWithEvals(t *testing.T) {
+	board := NewBoard()
+	board.MaxMoves = 100
+	var actions []Action
+	var scores []float32
+	var evals []MoveEval
+	for ii := 0; ii < 4; ii++ {
+		action := board.Derived.Actions[0]
+		probs := make([]float32, board.NumActions())
+		probs[0] = 1
+		actions = append(actions, action)
+		scores = append(scores, float32(ii))
+		if ii%2 == 0 {
+			evals = append(evals, NewMoveEval(board, float32(ii), probs))
+		} else {
+			// Moves not evaluated, e.g. from a human player.
+			evals = append(evals, MoveEval{})
+		}
+		board = board.Act(action)
+	}
+	if len(evals[0].TopActions) != MOVE_EVAL_TOP_ACTIONS || evals[0].TopActions[0] != actions[0] ||
+		evals[0].TopProbs[0] != 1 {
+		t.Errorf("Expected %d top actions, with %s first with probability 1, got %v, %v",
+			MOVE_EVAL_TOP_ACTIONS, actions[0], evals[0].TopActions, evals[0].TopProbs)
+	}
+
+	// Save a match with evals followed by one without, and read them back.
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := SaveMatchWithEvals(enc, board.MaxMoves, actions, scores, evals); err != nil {
+		t.Fatalf("Failed to save match: %v", err)
+	}
+	if err := SaveMatch(enc, board.MaxMoves, actions, scores); err != nil {
+		t.Fatalf("Failed to save match: %v", err)
+	}
+	dec := gob.NewDecoder(&buf)
+	initial, gotActions, gotScores, gotEvals, err := LoadMatchWithEvals(dec)
+	if err != nil {
+		t.Fatalf("Failed to load match: %v", err)
+	}
+	if initial.MaxMoves != board.MaxMoves || !reflect.DeepEqual(gotActions, actions) ||
+		!reflect.DeepEqual(gotScores, scores) {
+		t.Errorf("Loaded match doesn't match: MaxMoves=%d, actions=%v, scores=%v", initial.MaxMoves, gotActions, gotScores)
+	}
+	for ii := range evals {
+		// Gob decodes empty slices as nil.
+		if evals[ii].Evaluated != gotEvals[ii].Evaluated || evals[ii].Score != gotEvals[ii].Score ||
+			!reflect.DeepEqual(evals[ii].TopActions, gotEvals[ii].TopActions) ||
+			!reflect.DeepEqual(evals[ii].TopProbs, gotEvals[ii].TopProbs) {
+			t.Errorf("Eval #%d: got %+v, wanted %+v", ii, gotEvals[ii], evals[ii])
+		}
+	}
+	initial, gotActions, _, gotEvals, err = LoadMatchWithEvals(dec)
+	if err != nil || gotEvals != nil || initial.MaxMoves != board.MaxMoves || len(gotActions) != len(actions) {
+		t.Errorf("Match saved without evals: got MaxMoves=%d, %d actions, evals=%v, err=%v",
+			initial.MaxMoves, len(gotActions), gotEvals, err)
+	}
+}
+
+func TestSaveMatchWithInfo(t *testing.T) {
+	board := NewBoard()
+	board.MaxMoves = 50
+	var actions []Action
+	for ii := 0; ii < 4; ii++ {
+		actions = append(actions, board.Derived.Actions[0])
+		board = board.Act(board.Derived.Actions[0])
+	}
+	scores := []float32{1, 2, 3, 4}
+	evals := make([]MoveEval, len(actions))
+	info := &MatchInfo{Seed: 1234, Resigned: true, NoQueenFirstMove: true}
+
+	// Matches with info, with and without evals, followed by the older formats.
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, save := range []func() error{
+		func() error { return SaveMatchWithInfo(enc, board.MaxMoves, actions, scores, evals, *info) },
+		func() error { return SaveMatchWithInfo(enc, board.MaxMoves, actions, scores, nil, *info) },
+		func() error { return SaveMatchWithEvals(enc, board.MaxMoves, actions, scores, evals) },
+		func() error { return SaveMatch(enc, board.MaxMoves, actions, scores) },
+	} {
+		if err := save(); err != nil {
+			t.Fatalf("Failed to save match: %v", err)
+		}
+	}
+	dec := gob.NewDecoder(&buf)
+	for ii, want := range []struct {
+		numEvals int
+		info     *MatchInfo
+	}{{len(evals), info}, {0, info}, {len(evals), nil}, {0, nil}} {
+		initial, gotActions, gotScores, gotEvals, gotInfo, err := LoadMatchWithInfo(dec)
+		if err != nil {
+			t.Fatalf("Match #%d: failed to load: %v", ii, err)
+		}
+		if initial.MaxMoves != board.MaxMoves || !reflect.DeepEqual(gotActions, actions) ||
+			!reflect.DeepEqual(gotScores, scores) || len(gotEvals) != want.numEvals ||
+			!reflect.DeepEqual(gotInfo, want.info) || initial.NoQueenFirstMove != (want.info != nil) {
+			t.Errorf("Match #%d: got MaxMoves=%d, NoQueenFirstMove=%v, actions=%v, scores=%v, %d evals, info=%+v",
+				ii, initial.MaxMoves, initial.NoQueenFirstMove, gotActions, gotScores, len(gotEvals), gotInfo)
+		}
+	}
+}
+
+func TestCountActions(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for game := 0; game < 20; game++ {
+		b := NewBoard()
+		b.NoQueenFirstMove = game%2 == 1
+		b.BuildDerived()
+		for !b.IsFinished() && b.MoveNumber < 60 {
+			for player := uint8(0); player < NUM_PLAYERS; player++ {
+				want := len(b.Derived.PlayersActions[player])
+				if got := b.CountActions(player); got != want {
+					t.Fatalf("Game %d, move %d: CountActions(%d)=%d, wanted %d", game, b.MoveNumber, player, got, want)
+				}
+				if got := b.NumPlayerActions(player); got != want {
+					t.Fatalf("Game %d, move %d: NumPlayerActions(%d)=%d, wanted %d", game, b.MoveNumber, player, got, want)
+				}
+			}
+			if b.NumActions() != len(b.Derived.Actions) {
+				t.Fatalf("NumActions()=%d, wanted %d", b.NumActions(), len(b.Derived.Actions))
+			}
+			action := SKIP_ACTION
+			if b.NumActions() > 0 {
+				action = b.Derived.Actions[rng.Intn(b.NumActions())]
+			}
+			b = b.Act(action)
+		}
+	}
+}
+
+// midGameBoard returns a board after 30 random moves, for benchmarks.
+func midGameBoard() *Board {
+	rng := rand.New(rand.NewSource(3))
+	b := NewBoard()
+	for b.MoveNumber < 30 && !b.IsFinished() {
+		action := SKIP_ACTION
+		if b.NumActions() > 0 {
+			action = b.Derived.Actions[rng.Intn(b.NumActions())]
+		}
+		b = b.Act(action)
+	}
+	return b
+}
+
+func BenchmarkNumActions(bench *testing.B) {
+	b := midGameBoard()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		b.NumActions()
+	}
+}
+
+func BenchmarkCountActions(bench *testing.B) {
+	b := midGameBoard()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		b.CountActions(b.NextPlayer)
+	}
+}
+
+func BenchmarkValidActions(bench *testing.B) {
+	b := midGameBoard()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		b.ValidActions(b.NextPlayer)
+	}
+}
+
+func TestPosDistance(t *testing.T) {
+	// Breadth-first search over the neighbours gives the distances.
+	for _, start := range []Pos{{0, 0}, {-3, 2}, {5, -1}} {
+		distances := map[Pos]int{start: 0}
+		frontier := []Pos{start}
+		for dist := 1; dist <= 4; dist++ {
+			var next []Pos
+			for _, pos := range frontier {
+				for _, neighbour := range pos.NeighboursArray() {
+					if _, found := distances[neighbour]; !found {
+						distances[neighbour] = dist
+						next = append(next, neighbour)
+					}
+				}
+			}
+			frontier = next
+		}
+		for pos, want := range distances {
+			if got := start.Distance(pos); got != want {
+				t.Errorf("Distance from %s to %s: got %d, wanted %d", start, pos, got, want)
+			}
+			if got := pos.Distance(start); got != want {
+				t.Errorf("Distance from %s to %s: got %d, wanted %d", pos, start, got, want)
+			}
+		}
+	}
+}
+
+// classicPlacementCells returns the cells where player can place a piece with the
+// classic rule: empty cells next to its pieces and not next to the opponent's.
+func classicPlacementCells(b *Board, player uint8) (cells []Pos) {
+	seen := make(map[Pos]bool)
+	for _, pos := range b.OccupiedPositions() {
+		for _, cell := range pos.Neighbours() {
+			if seen[cell] || b.HasPiece(cell) {
+				continue
+			}
+			seen[cell] = true
+			hasOwn, hasOpponent := false, false
+			for _, nPos := range cell.Neighbours() {
+				if !b.HasPiece(nPos) {
+					continue
+				}
+				if nPlayer, _, _ := b.PieceAt(nPos); nPlayer == player {
+					hasOwn = true
+				} else {
+					hasOpponent = true
+				}
+			}
+			if hasOwn && !hasOpponent {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	PosSort(cells)
+	return
+}
+
+func TestPlacementCells(t *testing.T) {
+	// First piece: only at (0, 0).
+	b := NewBoard()
+	for p := uint8(0); p < NUM_PLAYERS; p++ {
+		if got, want := b.PlacementCells(p), []Pos{{0, 0}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Empty board: PlacementCells(%d)=%v, wanted %v", p, got, want)
+		}
+	}
+
+	// Second piece: anywhere next to the first, even if it is the opponent's.
+	b = b.Act(Action{Piece: ANT, TargetPos: Pos{0, 0}})
+	want := append([]Pos(nil), Pos{0, 0}.Neighbours()...)
+	PosSort(want)
+	if got := b.PlacementCells(b.NextPlayer); !reflect.DeepEqual(got, want) {
+		t.Errorf("Second move: PlacementCells(%d)=%v, wanted %v", b.NextPlayer, got, want)
+	}
+
+	// Afterwards the classic rule applies.
+	b = midGameBoard()
+	for p := uint8(0); p < NUM_PLAYERS; p++ {
+		want := classicPlacementCells(b, p)
+		if len(want) == 0 {
+			t.Errorf("Player %d has no placement cells to test", p)
+		}
+		got := b.PlacementCells(p)
+		if !reflect.DeepEqual(got, want) {
+			printBoard(b)
+			t.Errorf("PlacementCells(%d)=%v, wanted %v", p, got, want)
+		}
+		cells := make(map[Pos]bool)
+		for _, pos := range got {
+			cells[pos] = true
+		}
+		for _, action := range b.Derived.PlayersActions[p] {
+			if !action.Move && !cells[action.TargetPos] {
+				t.Errorf("Placement action %s not in PlacementCells(%d)=%v", action, p, got)
+			}
+		}
+	}
+}
+
+func TestWithSeedReproducible(t *testing.T) {
+	// A random game, using the game's generator to choose the actions: the order
+	// of the actions must only depend on the seed, not on the iteration over the
+	// board's map.
+	play := func(seed int64) (actions []Action) {
+		b := NewBoard().WithSeed(seed)
+		for ii := 0; ii < 60 && !b.IsFinished(); ii++ {
+			action := SKIP_ACTION
+			if len(b.Derived.Actions) > 0 {
+				action = b.Derived.Actions[b.Rand().Intn(len(b.Derived.Actions))]
+			}
+			actions = append(actions, action)
+			b = b.Act(action)
+		}
+		return
+	}
+	want := play(17)
+	for ii := 0; ii < 5; ii++ {
+		if got := play(17); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Game with seed 17 not reproduced:\n%v\nwanted:\n%v", got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package state
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Parameters of ExportSVG.
+const (
+	// SVG_FACE is the side of the hexagons, in pixels.
+	SVG_FACE = 30.0
+
+	// SVG_STACK_SHIFT is how much each piece of a stack is shifted up and right,
+	// in pixels, so the pieces under it are visible.
+	SVG_STACK_SHIFT = 3.0
+
+	// SVG_HEATMAP_COLOR is the color of the heatmap overlay, see
+	// ExportSVGWithHeatmap.
+	SVG_HEATMAP_COLOR = "#e02020"
+
+	// SVG_HEATMAP_MAX_OPACITY is the opacity of the position with the largest
+	// value of the heatmap.
+	SVG_HEATMAP_MAX_OPACITY = 0.7
+)
+
+var (
+	// svgPlayerColors are the fill and stroke colors of the tiles of each player.
+	svgPlayerColors = [NUM_PLAYERS][2]string{{"#f4f0e6", "#5a5a5a"}, {"#2b2b2b", "#000000"}}
+
+	// svgPieceColors are the colors of the glyphs of each piece, as in the
+	// physical game.
+	svgPieceColors = [LAST_PIECE_TYPE]string{"#000000", "#2e6fd8", "#8a4fbf", "#3a9a3a", "#d9a400", "#9a5b2e"}
+)
+
+// ExportSVG writes an image of the pieces on the board in SVG format. Each piece
+// is drawn as a hexagon (a polygon element) with the piece's letter as glyph,
+// using the same geometry as the GUI (see HexLayout). Stacked pieces are drawn
+// bottom-up, each slightly shifted, with the number of pieces of the stack next
+// to the top one.
+func ExportSVG(b *Board, w io.Writer) error {
+	return ExportSVGWithHeatmap(b, w, nil)
+}
+
+// ExportSVGWithHeatmap is like ExportSVG, but also overlays the heatmap (e.g. the
+// policy, see ActionsHeatmap) on the board: each position with a positive value
+// is filled with SVG_HEATMAP_COLOR, with an opacity proportional to its value
+// relative to the largest one. The value is shown as a tooltip.
+func ExportSVGWithHeatmap(b *Board, w io.Writer, heatmap Heatmap) error {
+	layout := HexLayout{Face: SVG_FACE}
+	poss := b.OccupiedPositions()
+	PosSort(poss)
+	var heatPoss []Pos
+	for pos, value := range heatmap {
+		if value > 0 {
+			heatPoss = append(heatPoss, pos)
+		}
+	}
+	PosSort(heatPoss)
+
+	// Find the bounding box of the drawing.
+	minX, minY, maxX, maxY := -SVG_FACE, -SVG_FACE, SVG_FACE, SVG_FACE
+	for ii, pos := range append(poss, heatPoss...) {
+		x, y := layout.PosToXY(pos)
+		shift := float64(b.CountAt(pos)-1) * SVG_STACK_SHIFT
+		if shift < 0 {
+			shift = 0
+		}
+		if ii == 0 {
+			minX, minY, maxX, maxY = x, y, x, y
+		}
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x+shift)
+		minY, maxY = math.Min(minY, y-shift), math.Max(maxY, y)
+	}
+	margin := 1.5 * SVG_FACE
+	minX, minY, maxX, maxY = minX-margin, minY-margin, maxX+margin, maxY+margin
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="%.2f %.2f %.2f %.2f">`+"\n",
+		maxX-minX, maxY-minY, minX, minY, maxX-minX, maxY-minY)
+	fmt.Fprintf(bw, `<title>Move #%d, next player %d</title>`+"\n", b.MoveNumber, b.NextPlayer)
+	fmt.Fprintf(bw, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="#f4e7d2"/>`+"\n",
+		minX, minY, maxX-minX, maxY-minY)
+	for _, pos := range poss {
+		stack := b.StackAt(pos)
+		count := stack.CountPieces()
+		xc, yc := layout.PosToXY(pos)
+		for level := uint8(0); level < count; level++ {
+			player, piece := stack.PieceAt(count - 1 - level)
+			shift := float64(level) * SVG_STACK_SHIFT
+			writeSVGPiece(bw, layout, pos, player, piece, xc+shift, yc-shift)
+		}
+		if count > 1 {
+			shift := float64(count-1) * SVG_STACK_SHIFT
+			fmt.Fprintf(bw, `<text x="%.2f" y="%.2f" font-family="sans-serif" font-size="%.1f" fill="#c00000">%d</text>`+"\n",
+				xc+shift+0.45*SVG_FACE, yc-shift-0.3*SVG_FACE, 0.4*SVG_FACE, count)
+		}
+	}
+
+	// Heatmap is drawn over the pieces, so positions occupied by pieces are also
+	// visible (e.g. beetles moving on top of the hive).
+	maxValue := heatmap.Max()
+	for _, pos := range heatPoss {
+		xc, yc := layout.PosToXY(pos)
+		if count := b.CountAt(pos); count > 0 {
+			shift := float64(count-1) * SVG_STACK_SHIFT
+			xc, yc = xc+shift, yc-shift
+		}
+		fmt.Fprintf(bw, `<polygon class="heat" data-pos="%d,%d" points="%s" fill="%s" fill-opacity="%.3f">`+
+			`<title>%s: %.3f</title></polygon>`+"\n",
+			pos.X(), pos.Y(), svgPoints(layout, xc, yc), SVG_HEATMAP_COLOR,
+			SVG_HEATMAP_MAX_OPACITY*heatmap[pos]/maxValue, pos, heatmap[pos])
+	}
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
+
+// svgPoints returns the points attribute of the polygon of the hexagon centered
+// at xc, yc.
+func svgPoints(layout HexLayout, xc, yc float64) string {
+	corners := layout.Corners(xc, yc)
+	points := make([]string, len(corners))
+	for ii, corner := range corners {
+		points[ii] = fmt.Sprintf("%.2f,%.2f", corner[0], corner[1])
+	}
+	return strings.Join(points, " ")
+}
+
+// writeSVGPiece writes the hexagon and glyph of one piece.
+func writeSVGPiece(w io.Writer, layout HexLayout, pos Pos, player uint8, piece Piece, xc, yc float64) {
+	fmt.Fprintf(w, `<polygon class="piece" data-pos="%d,%d" points="%s" fill="%s" stroke="%s" stroke-width="2"/>`+"\n",
+		pos.X(), pos.Y(), svgPoints(layout, xc, yc), svgPlayerColors[player][0], svgPlayerColors[player][1])
+	fmt.Fprintf(w, `<text x="%.2f" y="%.2f" text-anchor="middle" dominant-baseline="central" `+
+		`font-family="sans-serif" font-weight="bold" font-size="%.1f" fill="%s">%s</text>`+"\n",
+		xc, yc, 0.9*SVG_FACE, svgPieceColors[piece], PieceLetters[piece])
+}
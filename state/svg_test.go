@@ -0,0 +1,115 @@
+package state_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+// countSVGPolygons parses the SVG, failing if it is not well-formed XML, and
+// returns the number of polygon elements of the given class.
+func countSVGPolygons(t *testing.T, svg []byte, class string) (count int) {
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Invalid SVG: %v\n%s", err, svg)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "polygon" {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "class" && attr.Value == class {
+					count++
+				}
+			}
+		}
+	}
+}
+
+func TestExportSVG(t *testing.T) {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, QUEEN},
+		{Pos{0, 0}, 1, BEETLE},
+		{Pos{0, 1}, 1, QUEEN},
+		{Pos{-1, 0}, 0, ANT},
+		{Pos{1, 1}, 1, SPIDER},
+	})
+	board.BuildDerived()
+	for _, test := range []struct {
+		board     *Board
+		numPieces int
+	}{{NewBoard(), 0}, {board, 5}} {
+		var buf bytes.Buffer
+		if err := ExportSVG(test.board, &buf); err != nil {
+			t.Fatalf("Failed to export SVG: %v", err)
+		}
+		if got := countSVGPolygons(t, buf.Bytes(), "piece"); got != test.numPieces {
+			t.Errorf("Got %d polygons in SVG, wanted one per piece (%d):\n%s", got, test.numPieces, buf.String())
+		}
+	}
+}
+
+func TestExportSVGWithHeatmap(t *testing.T) {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, QUEEN},
+		{Pos{0, 1}, 1, QUEEN},
+	})
+	board.BuildDerived()
+	probs := make([]float32, board.NumActions())
+	for ii := range probs {
+		probs[ii] = 1 / float32(len(probs))
+	}
+	heatmap := ActionsHeatmap(board, probs)
+
+	// Sum of the probabilities is preserved, and actions to the same target are
+	// aggregated.
+	total := float32(0)
+	targets := make(map[Pos]int)
+	for _, action := range board.Derived.Actions {
+		targets[action.TargetPos]++
+	}
+	for pos, value := range heatmap {
+		total += value
+		if want := float32(targets[pos]) / float32(len(probs)); math.Abs(float64(value-want)) > 1e-6 {
+			t.Errorf("Heatmap at %s is %g, wanted %g for %d actions", pos, value, want, targets[pos])
+		}
+	}
+	if math.Abs(float64(total-1)) > 1e-5 {
+		t.Errorf("Heatmap adds up to %g, wanted 1", total)
+	}
+	if len(heatmap) != len(targets) {
+		t.Errorf("Heatmap has %d positions, wanted %d", len(heatmap), len(targets))
+	}
+
+	var buf bytes.Buffer
+	if err := ExportSVGWithHeatmap(board, &buf, heatmap); err != nil {
+		t.Fatalf("Failed to export SVG: %v", err)
+	}
+	if got := countSVGPolygons(t, buf.Bytes(), "heat"); got != len(heatmap) {
+		t.Errorf("Got %d heatmap polygons in SVG, wanted %d:\n%s", got, len(heatmap), buf.String())
+	}
+	if got := countSVGPolygons(t, buf.Bytes(), "piece"); got != 2 {
+		t.Errorf("Got %d piece polygons in SVG, wanted 2:\n%s", got, buf.String())
+	}
+}
+
+func TestHexLayout(t *testing.T) {
+	layout := HexLayout{Face: 10}
+	for _, pos := range []Pos{{0, 0}, {1, 0}, {-1, 2}, {3, -2}} {
+		x, y := layout.PosToXY(pos)
+		if got := layout.XYToPos(x, y); got != pos {
+			t.Errorf("Position %s drawn at (%g, %g), which maps back to %s", pos, x, y, got)
+		}
+		// The distance between centers should match Pos.Cartesian.
+		cx, cy := pos.Cartesian()
+		if scale := layout.RowHeight(); math.Abs(cx*scale-x) > 1e-9 || math.Abs(cy*scale-y) > 1e-9 {
+			t.Errorf("Position %s drawn at (%g, %g), wanted (%g, %g)", pos, x, y, cx*scale, cy*scale)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// This file implements the symmetries of the hexagonal grid: rotations
+// (in steps of 60 degrees) around Pos{0, 0} and mirroring; and a board hash
+// that is invariant to them.
+package state
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+)
+
+// NUM_ROTATIONS is the number of distinct rotations of the hexagonal grid.
+const NUM_ROTATIONS = 6
+
+// axial converts the Pos (offset coordinates, where odd columns are shifted
+// down) to axial coordinates, where rotations are simple.
+func (pos Pos) axial() (q, r int) {
+	x, y := int(pos[0]), int(pos[1])
+	return x, y - (x-(x&1))/2
+}
+
+// posFromAxial converts back from axial coordinates.
+func posFromAxial(q, r int) Pos {
+	return Pos{int8(q), int8(r + (q-(q&1))/2)}
+}
+
+// Rotate returns the position rotated clockwise around Pos{0, 0} by steps*60
+// degrees. Negative steps rotate counter-clockwise.
+func (pos Pos) Rotate(steps int) Pos {
+	steps = ((steps % NUM_ROTATIONS) + NUM_ROTATIONS) % NUM_ROTATIONS
+	q, r := pos.axial()
+	s := -q - r
+	for ii := 0; ii < steps; ii++ {
+		q, r, s = -r, -s, -q
+	}
+	return posFromAxial(q, r)
+}
+
+// Mirror returns the position mirrored vertically: positions on the column
+// X=0 have their Y negated.
+func (pos Pos) Mirror() Pos {
+	q, r := pos.axial()
+	return posFromAxial(q, -q-r)
+}
+
+// Rotate returns the action with its positions rotated, see Pos.Rotate.
+func (a Action) Rotate(steps int) Action {
+	if a.IsSkipAction() {
+		return a
+	}
+	a.TargetPos = a.TargetPos.Rotate(steps)
+	if a.Move {
+		a.SourcePos = a.SourcePos.Rotate(steps)
+	}
+	return a
+}
+
+// Mirror returns the action with its positions mirrored, see Pos.Mirror.
+func (a Action) Mirror() Action {
+	if a.IsSkipAction() {
+		return a
+	}
+	a.TargetPos = a.TargetPos.Mirror()
+	if a.Move {
+		a.SourcePos = a.SourcePos.Mirror()
+	}
+	return a
+}
+
+// Rotate returns a new board with all the pieces rotated clockwise around Pos{0, 0}
+// by steps*60 degrees. The previous boards of the match are rotated as well, so
+// Derived.Repeats is preserved.
+func (b *Board) Rotate(steps int) *Board {
+	return b.mapPositions(func(pos Pos) Pos { return pos.Rotate(steps) })
+}
+
+// Mirror returns a new board with all the pieces mirrored, see Pos.Mirror. The
+// previous boards of the match are mirrored as well.
+func (b *Board) Mirror() *Board {
+	return b.mapPositions(Pos.Mirror)
+}
+
+// Symmetries returns the distinct boards obtained by rotating the board (see
+// Rotate), optionally mirrored (see Mirror): up to 12, the first being the board
+// itself. Transforms that leave the pieces in the same arrangement as a previous
+// one, up to a translation (as CanonicalHash), are dropped: e.g. for symmetric
+// boards.
+func (b *Board) Symmetries() []*Board {
+	symmetries := []*Board{b}
+	arrangements := []axialStackSlice{b.normalizedAxialStacks()}
+	for steps := 0; steps < NUM_ROTATIONS; steps++ {
+		for _, mirror := range []bool{false, true} {
+			if steps == 0 && !mirror {
+				continue
+			}
+			transformed := b.Rotate(steps)
+			if mirror {
+				transformed = transformed.Mirror()
+			}
+			arrangement := transformed.normalizedAxialStacks()
+			duplicate := false
+			for _, arrangement2 := range arrangements {
+				if arrangement.equal(arrangement2) {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				symmetries = append(symmetries, transformed)
+				arrangements = append(arrangements, arrangement)
+			}
+		}
+	}
+	return symmetries
+}
+
+// normalizedAxialStacks returns the stacks of pieces of the board in axial
+// coordinates, shifted to start at (0, 0) and sorted, so boards whose pieces are
+// translations of each other have the same ones.
+func (b *Board) normalizedAxialStacks() axialStackSlice {
+	stacks := make(axialStackSlice, 0, len(b.board))
+	for pos, stack := range b.board {
+		q, r := pos.axial()
+		stacks = append(stacks, axialStack{q, r, stack})
+	}
+	stacks.normalize()
+	return stacks
+}
+
+// mapPositions returns a copy of the board (and its previous boards) with the
+// positions of the pieces mapped by fn, which must be a symmetry of the grid.
+func (b *Board) mapPositions(fn func(pos Pos) Pos) *Board {
+	var history []*Board
+	for b2 := b; b2 != nil; b2 = b2.Previous {
+		history = append(history, b2)
+	}
+	var newB *Board
+	for ii := len(history) - 1; ii >= 0; ii-- {
+		previous := newB
+		newB = &Board{}
+		*newB = *history[ii]
+		newB.Previous = previous
+		newB.board = make(map[Pos]EncodedStack, len(history[ii].board))
+		for pos, stack := range history[ii].board {
+			newB.board[fn(pos)] = stack
+		}
+		newB.rebuildOccupancy()
+		newB.BuildDerived()
+	}
+	return newB
+}
+
+// CanonicalHash returns a hash of the board position that is invariant to
+// translations, rotations and mirroring of the pieces. It covers the pieces on
+// the board and the next player to move (the available pieces are implied by the
+// ones on the board), but not the history of the match or the move number.
+//
+// It is usually unique, but not guaranteed.
+func (b *Board) CanonicalHash() uint64 {
+	if len(b.board) == 0 {
+		return uint64(b.NextPlayer) + 1
+	}
+	var canonical uint64
+	stacks := make(axialStackSlice, 0, len(b.board))
+	for steps := 0; steps < NUM_ROTATIONS; steps++ {
+		for _, mirror := range []bool{false, true} {
+			stacks = stacks[:0]
+			for pos, stack := range b.board {
+				pos = pos.Rotate(steps)
+				if mirror {
+					pos = pos.Mirror()
+				}
+				q, r := pos.axial()
+				stacks = append(stacks, axialStack{q, r, stack})
+			}
+			hash := stacks.normalizedHash(b.NextPlayer)
+			if (steps == 0 && !mirror) || hash < canonical {
+				canonical = hash
+			}
+		}
+	}
+	return canonical
+}
+
+// Hash returns a hash of the pieces on the board, at their current positions,
+// and of the next player. Unlike CanonicalHash it is not invariant to
+// translations, rotations and mirroring, so it can be used to key information
+// that refers to the positions, like the features of an action.
+//
+// It is usually unique, but not guaranteed.
+func (b *Board) Hash() uint64 {
+	positions := make([]Pos, 0, len(b.board))
+	for pos := range b.board {
+		positions = append(positions, pos)
+	}
+	PosSort(positions)
+
+	hasher := fnv.New64a()
+	buf := make([]byte, 0, 1+len(positions)*(2+8))
+	buf = append(buf, b.NextPlayer)
+	for _, pos := range positions {
+		buf = append(buf, byte(pos.X()), byte(pos.Y()))
+		var stackBytes [8]byte
+		binary.LittleEndian.PutUint64(stackBytes[:], uint64(b.board[pos]))
+		buf = append(buf, stackBytes[:]...)
+	}
+	hasher.Write(buf)
+	return hasher.Sum64()
+}
+
+// axialStack is a stack of pieces in axial coordinates, where translations
+// preserve the neighbourhoods of all positions.
+type axialStack struct {
+	q, r  int
+	stack EncodedStack
+}
+
+type axialStackSlice []axialStack
+
+func (s axialStackSlice) Len() int { return len(s) }
+func (s axialStackSlice) Less(i, j int) bool {
+	if s[i].r != s[j].r {
+		return s[i].r < s[j].r
+	}
+	return s[i].q < s[j].q
+}
+func (s axialStackSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// normalize shifts the positions to start at (0, 0) and sorts them.
+func (s axialStackSlice) normalize() {
+	if len(s) == 0 {
+		return
+	}
+	minQ, minR := s[0].q, s[0].r
+	for _, as := range s {
+		if as.q < minQ {
+			minQ = as.q
+		}
+		if as.r < minR {
+			minR = as.r
+		}
+	}
+	for ii := range s {
+		s[ii].q -= minQ
+		s[ii].r -= minR
+	}
+	sort.Sort(s)
+}
+
+// equal returns whether both slices have the same stacks at the same positions.
+func (s axialStackSlice) equal(s2 axialStackSlice) bool {
+	if len(s) != len(s2) {
+		return false
+	}
+	for ii := range s {
+		if s[ii] != s2[ii] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizedHash normalizes the positions (see normalize) and hashes them.
+func (s axialStackSlice) normalizedHash(nextPlayer uint8) uint64 {
+	s.normalize()
+	hasher := fnv.New64a()
+	buf := make([]byte, 0, 1+len(s)*(2+8))
+	buf = append(buf, nextPlayer)
+	for _, as := range s {
+		buf = append(buf, byte(as.q), byte(as.r))
+		var stackBytes [8]byte
+		binary.LittleEndian.PutUint64(stackBytes[:], uint64(as.stack))
+		buf = append(buf, stackBytes[:]...)
+	}
+	hasher.Write(buf)
+	return hasher.Sum64()
+}
@@ -0,0 +1,176 @@
+package state_test
+
+import (
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestPosRotateMirror(t *testing.T) {
+	for _, pos := range []Pos{{0, 0}, {1, 0}, {-1, 2}, {3, -2}, {-4, -3}} {
+		if got := pos.Rotate(NUM_ROTATIONS); got != pos {
+			t.Errorf("Full rotation of %s gave %s", pos, got)
+		}
+		if got := pos.Rotate(2).Rotate(-2); got != pos {
+			t.Errorf("Rotating %s back and forth gave %s", pos, got)
+		}
+		if got := pos.Mirror().Mirror(); got != pos {
+			t.Errorf("Mirroring %s twice gave %s", pos, got)
+		}
+
+		// Neighbours must be preserved, in the same clockwise order for rotations.
+		neighbours := pos.Neighbours()
+		rotated := pos.Rotate(1).Neighbours()
+		for ii, nPos := range neighbours {
+			if got, want := nPos.Rotate(1), rotated[(ii+1)%NUM_NEIGHBOURS]; got != want {
+				t.Errorf("Rotated neighbour %d of %s: got %s, wanted %s", ii, pos, got, want)
+			}
+		}
+		mirrored := make(map[Pos]bool)
+		for _, nPos := range pos.Mirror().Neighbours() {
+			mirrored[nPos] = true
+		}
+		for _, nPos := range neighbours {
+			if !mirrored[nPos.Mirror()] {
+				t.Errorf("Mirrored neighbour %s of %s is not a neighbour of %s", nPos.Mirror(), pos, pos.Mirror())
+			}
+		}
+	}
+	if got, want := (Pos{0, -1}).Rotate(1), (Pos{1, -1}); got != want {
+		t.Errorf("Rotate(1) of (0,-1): got %s, wanted %s", got, want)
+	}
+	if got, want := (Pos{0, -2}).Mirror(), (Pos{0, 2}); got != want {
+		t.Errorf("Mirror of (0,-2): got %s, wanted %s", got, want)
+	}
+}
+
+func TestBoardRotateMirror(t *testing.T) {
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{2, 1}, 0, SPIDER},
+		{Pos{-2, 2}, 1, GRASSHOPPER},
+	})
+	board.BuildDerived()
+
+	for steps := 0; steps < NUM_ROTATIONS; steps++ {
+		for _, mirror := range []bool{false, true} {
+			b2 := board.Rotate(steps)
+			if mirror {
+				b2 = b2.Mirror()
+			}
+			if len(b2.Derived.Actions) != len(board.Derived.Actions) {
+				t.Errorf("steps=%d, mirror=%v: got %d actions, wanted %d", steps, mirror,
+					len(b2.Derived.Actions), len(board.Derived.Actions))
+			}
+			for _, action := range board.Derived.Actions {
+				a2 := action.Rotate(steps)
+				if mirror {
+					a2 = a2.Mirror()
+				}
+				if !b2.IsValid(a2) {
+					t.Errorf("steps=%d, mirror=%v: transformed action %s (from %s) not valid", steps, mirror, a2, action)
+				}
+			}
+			if b2.Derived.NumSurroundingQueen != board.Derived.NumSurroundingQueen {
+				t.Errorf("steps=%d, mirror=%v: queen surroundings changed from %v to %v", steps, mirror,
+					board.Derived.NumSurroundingQueen, b2.Derived.NumSurroundingQueen)
+			}
+		}
+	}
+}
+
+func TestCanonicalHash(t *testing.T) {
+	layout := []PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{2, 1}, 0, SPIDER},
+	}
+	board := buildBoard(layout)
+	hash := board.CanonicalHash()
+
+	// Translations, including odd shifts of X, must not change the hash.
+	for _, shift := range []Pos{{1, 0}, {0, 3}, {-3, 2}, {5, -1}} {
+		shifted := make([]PieceLayout, len(layout))
+		for ii, p := range layout {
+			shifted[ii] = p
+			shifted[ii].pos = Pos{p.pos.X() + shift.X(), p.pos.Y() + shift.Y()}
+			if shift.X()&1 != 0 && p.pos.X()&1 != 0 {
+				// Odd columns are shifted down.
+				shifted[ii].pos[1]++
+			}
+		}
+		if got := buildBoard(shifted).CanonicalHash(); got != hash {
+			t.Errorf("Hash changed from %x to %x after translation by %s", hash, got, shift)
+		}
+	}
+
+	for steps := 0; steps < NUM_ROTATIONS; steps++ {
+		if got := board.Rotate(steps).CanonicalHash(); got != hash {
+			t.Errorf("Hash changed from %x to %x after rotation by %d", hash, got, steps)
+		}
+		if got := board.Rotate(steps).Mirror().CanonicalHash(); got != hash {
+			t.Errorf("Hash changed from %x to %x after rotation by %d and mirroring", hash, got, steps)
+		}
+	}
+
+	// Different position, or next player.
+	other := buildBoard(layout[:4])
+	if other.CanonicalHash() == hash {
+		t.Errorf("Different boards should have different hashes")
+	}
+	board.NextPlayer = 1
+	if board.CanonicalHash() == hash {
+		t.Errorf("Different next player should change the hash")
+	}
+}
+
+func TestSymmetries(t *testing.T) {
+	// Generic position: all transforms are distinct.
+	board := buildBoard([]PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{2, 1}, 0, SPIDER},
+	})
+	symmetries := board.Symmetries()
+	if len(symmetries) != 2*NUM_ROTATIONS {
+		t.Errorf("Generic position has %d symmetries, wanted %d", len(symmetries), 2*NUM_ROTATIONS)
+	}
+	if symmetries[0] != board {
+		t.Errorf("First symmetry should be the board itself")
+	}
+	hash := board.CanonicalHash()
+	for ii, b2 := range symmetries {
+		if b2.CanonicalHash() != hash {
+			t.Errorf("Symmetry #%d is not equivalent to the board", ii)
+		}
+	}
+
+	// Symmetric by 180 degrees rotation around Pos{0, 0}, and by mirroring: only
+	// the 3 rotations by 0, 60 and 120 degrees are distinct.
+	board = buildBoard([]PieceLayout{
+		{Pos{0, -1}, 1, ANT},
+		{Pos{0, 0}, 0, QUEEN},
+		{Pos{0, 1}, 1, ANT},
+	})
+	if got := len(board.Symmetries()); got != 3 {
+		t.Errorf("Symmetric position has %d symmetries, wanted 3", got)
+	}
+
+	// The same position shifted away from Pos{0, 0} has the same symmetries, as
+	// they are compared up to translations.
+	board = buildBoard([]PieceLayout{
+		{Pos{2, -1}, 1, ANT},
+		{Pos{2, 0}, 0, QUEEN},
+		{Pos{2, 1}, 1, ANT},
+	})
+	if got := len(board.Symmetries()); got != 3 {
+		t.Errorf("Shifted symmetric position has %d symmetries, wanted 3", got)
+	}
+}
@@ -0,0 +1,97 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate checks that the board is internally consistent, for instance after
+// loading it, and returns an error describing each of the violations found, or
+// nil if there are none. It checks that:
+//
+//   * Each player has at most the initial number of each piece (INITIAL_AVAILABILITY),
+//     counting the ones on the board and the ones available.
+//   * The hive is connected.
+//   * Only beetles are stacked on top of other pieces.
+//   * Derived.QueenPos, if the derived information was built, is where the queens are.
+//     It is not set for boards past MaxMoves.
+func (b *Board) Validate() error {
+	var violations []string
+
+	// Pieces counts and stacks.
+	var onBoard [NUM_PLAYERS][NUM_PIECE_TYPES]int
+	positions := b.OccupiedPositions()
+	PosSort(positions)
+	var queenPos [NUM_PLAYERS][]Pos
+	for _, pos := range positions {
+		stack := b.StackAt(pos)
+		numPieces := stack.CountPieces()
+		for stackPos := uint8(0); stackPos < numPieces; stackPos++ {
+			player, piece := stack.PieceAt(stackPos)
+			if piece == NO_PIECE || piece >= LAST_PIECE_TYPE {
+				violations = append(violations, fmt.Sprintf("invalid piece %d of player %d at %s",
+					piece, player, pos))
+				continue
+			}
+			onBoard[player][piece-1]++
+			if piece == QUEEN {
+				queenPos[player] = append(queenPos[player], pos)
+			}
+			if stackPos < numPieces-1 && piece != BEETLE {
+				violations = append(violations, fmt.Sprintf("%s of player %d is stacked on top of "+
+					"another piece at %s, only beetles can climb", piece, player, pos))
+			}
+		}
+	}
+	for player := uint8(0); player < NUM_PLAYERS; player++ {
+		for _, piece := range Pieces {
+			count, available := onBoard[player][piece-1], int(b.Available(player, piece))
+			if maxCount := int(INITIAL_AVAILABILITY[piece-1]); count+available > maxCount {
+				violations = append(violations, fmt.Sprintf("player %d has %d %s on the board and %d "+
+					"available, more than the %d allowed", player, count, piece, available, maxCount))
+			}
+		}
+	}
+
+	// The hive is connected.
+	if len(positions) > 0 {
+		reached := map[Pos]bool{positions[0]: true}
+		toVisit := []Pos{positions[0]}
+		for len(toVisit) > 0 {
+			pos := toVisit[len(toVisit)-1]
+			toVisit = toVisit[:len(toVisit)-1]
+			for _, neighbour := range b.OccupiedNeighbours(pos) {
+				if !reached[neighbour] {
+					reached[neighbour] = true
+					toVisit = append(toVisit, neighbour)
+				}
+			}
+		}
+		if len(reached) != len(positions) {
+			var disconnected []string
+			for _, pos := range positions {
+				if !reached[pos] {
+					disconnected = append(disconnected, pos.String())
+				}
+			}
+			violations = append(violations, fmt.Sprintf("hive is not connected: %s not connected to %s",
+				strings.Join(disconnected, ", "), positions[0]))
+		}
+	}
+
+	// Derived queen positions.
+	if b.Derived != nil && b.MoveNumber <= b.MaxMoves {
+		for player := uint8(0); player < NUM_PLAYERS; player++ {
+			if len(queenPos[player]) == 1 && b.Derived.QueenPos[player] != queenPos[player][0] {
+				violations = append(violations, fmt.Sprintf("Derived.QueenPos of player %d is %s, but "+
+					"its queen is at %s", player, b.Derived.QueenPos[player], queenPos[player][0]))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("Invalid board, %d violations found:\n\t%s", len(violations),
+			strings.Join(violations, "\n\t"))
+	}
+	return nil
+}
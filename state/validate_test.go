@@ -0,0 +1,50 @@
+package state_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/janpfeifer/hiveGo/state"
+)
+
+func TestValidate(t *testing.T) {
+	layout := []PieceLayout{
+		{Pos{0, 0}, 0, ANT},
+		{Pos{-1, 0}, 1, BEETLE},
+		{Pos{1, 0}, 0, QUEEN},
+		{Pos{-1, 1}, 1, QUEEN},
+		{Pos{1, 0}, 1, BEETLE},
+	}
+	board := buildBoard(layout)
+	board.BuildDerived()
+	if err := board.Validate(); err != nil {
+		t.Errorf("Valid board failed validation: %v", err)
+	}
+
+	// Over-count: a second queen for player 0.
+	board = buildBoard(layout)
+	board.StackPiece(Pos{0, 1}, 0, QUEEN)
+	if err := board.Validate(); err == nil || !strings.Contains(err.Error(), "more than the 1 allowed") {
+		t.Errorf("Second queen not caught, got error %v", err)
+	}
+
+	// Disconnected hive.
+	board = buildBoard(append(layout, PieceLayout{Pos{4, 4}, 0, SPIDER}))
+	if err := board.Validate(); err == nil || !strings.Contains(err.Error(), "hive is not connected") {
+		t.Errorf("Disconnected hive not caught, got error %v", err)
+	}
+
+	// Only beetles climb.
+	board = buildBoard(append(layout, PieceLayout{Pos{0, 0}, 1, ANT}))
+	if err := board.Validate(); err == nil || !strings.Contains(err.Error(), "only beetles can climb") {
+		t.Errorf("Ant stacked on top not caught, got error %v", err)
+	}
+
+	// Loading an invalid board fails.
+	var loaded Board
+	data := `{"pieces":[{"pos":[0,0],"player":0,"piece":"Q"},{"pos":[3,3],"player":1,"piece":"Q"}]}`
+	if err := json.Unmarshal([]byte(data), &loaded); err == nil {
+		t.Errorf("Loading a board with a disconnected hive should fail")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	ai_players "github.com/janpfeifer/hiveGo/ai/players"
@@ -32,12 +33,53 @@ var (
 
 	flag_maxMoves = flag.Int(
 		"max_moves", 100, "Max moves before game is assumed to be a draw.")
+	flag_selfPlayMaxMoves = flag.Int("self_play_max_moves", 0, "If > 0, matches played are "+
+		"interrupted and considered a draw after these many moves. Unlike --max_moves, the "+
+		"players (and the MovesToDraw feature) are not aware of it.")
+	flag_noQueenFirstMove = flag.Bool("no_queen_first_move", false,
+		"Tournament rule: players can't place the queen as their first piece. Matches loaded "+
+			"use the rule they were saved with, unless saved by older versions.")
+	flag_resignMoves = flag.Int("resign_moves", 0, "If > 0, in matches played a player resigns "+
+		"after its score stays below --resign_threshold for these many consecutive moves.")
+	flag_resignThreshold = flag.Float64("resign_threshold", -8,
+		"Score below which a player considers itself lost, see --resign_moves.")
+	flag_resignCheckFraction = flag.Float64("resign_check_fraction", 0.1, "Fraction of the matches "+
+		"played to the end regardless of --resign_moves, to measure the false resignation rate.")
+	flag_adjudicateMoves = flag.Int("adjudicate_moves", 0, "If > 0, matches played are adjudicated a "+
+		"draw once the scores of these many consecutive moves are within --adjudicate_threshold, and "+
+		"the position repeated --adjudicate_repetitions times.")
+	flag_adjudicateThreshold = flag.Float64("adjudicate_threshold", 0.5,
+		"Absolute score below which a position is considered even, see --adjudicate_moves.")
+	flag_adjudicateRepetitions = flag.Int("adjudicate_repetitions", 1,
+		"Times a position must have been seen before for adjudication, see --adjudicate_moves.")
+	flag_adjudicateCheckFraction = flag.Float64("adjudicate_check_fraction", 0.1, "Fraction of the "+
+		"matches played to the end regardless of --adjudicate_moves, to measure the false draw rate.")
 
 	flag_numMatches = flag.Int("num_matches", 0, "Number of matches to play. If larger "+
 		"than one, starting position is alternated. Value of 0 means 1 match to play, or load all file.")
-	flag_print       = flag.Bool("print", false, "Print board at the end of the match.")
-	flag_printSteps  = flag.Bool("print_steps", false, "Print board at each step.")
-	flag_saveMatches = flag.String("save_matches", "", "File name where to save matches.")
+	flag_randomFirstPlayer = flag.Bool("random_first_player", false, "Randomly choose which player "+
+		"moves first in each match played, instead of alternating, see --first_player_seed.")
+	flag_firstPlayerSeed = flag.Int64("first_player_seed", 0, "Seed used by --random_first_player. "+
+		"If 0, a seed based on the time is used.")
+	flag_selfPlaySeed = flag.Int64("self_play_seed", 0, "If != 0, each match played uses its own random "+
+		"number generator, seeded from this seed and the match number, instead of the global one. The seed "+
+		"of each match is saved with it (see ai.GameRecord.Seed), to replay it with --game_seed.")
+	flag_gameSeed = flag.Int64("game_seed", 0, "If != 0, seed of the random number generator of the matches "+
+		"played, e.g. to replay a match saved with --self_play_seed, with the same players and --num_matches=1.")
+	flag_openings = flag.String("openings", "", "File with openings, one per line as actions in "+
+		"notation (e.g. \"G@0,0 A@0,1\"). If set, each pair of matches starts from the next opening, "+
+		"with the players swapped in the second match.")
+	flag_curriculum = flag.String("curriculum", "", "Curriculum of the search of the players in the "+
+		"matches played, e.g. \"0:max_depth=1;1000:max_depth=2\": each stage starts at a number of matches "+
+		"(or training steps, see --curriculum_by_step). See ai/players.ParseCurriculum.")
+	flag_curriculumByStep = flag.Bool("curriculum_by_step", false, "Stages of --curriculum start at the "+
+		"global step of the TensorFlow model of ai0, instead of the number of matches.")
+	flag_print        = flag.Bool("print", false, "Print board at the end of the match.")
+	flag_printSteps   = flag.Bool("print_steps", false, "Print board at each step.")
+	flag_saveMatches  = flag.String("save_matches", "", "File name where to save matches.")
+	flag_saveExamples = flag.String("save_examples", "", "File name where to save the labeled examples of "+
+		"the matches, as a dataset (see ai.ExampleWriter) with the outcome of each example, e.g. to balance "+
+		"it with ai.BalanceByOutcome. The examples are labeled as for --train.")
 	flag_loadMatches = flag.String("load_matches", "",
 		"Instead of actually playing matches, load pre-generated ones.")
 	flag_loadOnlyMatch = flag.Int("match_idx", -1, "If set it will only load this one "+
@@ -52,17 +94,65 @@ var (
 		"If to rescore loaded matches. A value higher than 1 means that it will loop "+
 			"over rescoring and retraining.")
 	flag_learningRate = flag.Float64("learning_rate", 1e-5, "Learning rate when learning")
+	flag_tdLambda     = flag.Float64("td_lambda", -1, "If >= 0, train the board values with TD(lambda) "+
+		"targets bootstrapped from the model being trained, instead of the scores of the match. "+
+		"1 means final outcome of the match, 0 means one-step bootstrap.")
+
+	flag_prioritizedReplay = flag.Bool("prioritized_replay", false,
+		"Train on batches sampled proportionally to the examples' loss, instead of all examples at once. "+
+			"Requires a linear model, or a TensorFlow model whose graph exports the losses of each board "+
+			"(see tensorflow.Scorer.HasExamplesLosses).")
+	flag_replayBatchSize = flag.Int("replay_batch_size", 1024, "Batch size when using --prioritized_replay.")
+	flag_replayAlpha     = flag.Float64("replay_alpha", 0.6, "How much prioritization to use with --prioritized_replay: 0 is uniform.")
+	flag_replayBeta      = flag.Float64("replay_beta", 0.4, "Importance-sampling correction used with --prioritized_replay: 1 is full correction.")
+
+	flag_collapseBoards = flag.Int("collapse_boards", 0, "If > 0, number of boards of the training data "+
+		"scored periodically while training, to detect a collapsed model: one that predicts the same "+
+		"score for every board. See --collapse_min_stddev.")
+	flag_collapseMinStdDev = flag.Float64("collapse_min_stddev", 0.01, "Standard deviation of the "+
+		"scores of --collapse_boards below which the model is considered collapsed.")
+	flag_collapseCheckSteps = flag.Int("collapse_check_steps", 10, "Number of train loops (or batches "+
+		"with --prioritized_replay) between checks of --collapse_boards.")
+	flag_collapseAbort = flag.Bool("collapse_abort", false, "Abort training, without saving the model, "+
+		"if it collapses (see --collapse_boards). Otherwise only a warning is logged.")
+
+	flag_dumpVariables = flag.Bool("dump_variables", false, "After training a TensorFlow model, log "+
+		"statistics of each of its variables. It is expensive.")
+	flag_normalizeFeatures = flag.Bool("normalize_features", false, "Normalize the features fed to a new "+
+		"TensorFlow model, with their mean and standard deviation in the training data. It is saved with "+
+		"the model, and ignored for models already trained without it.")
+	flag_features = flag.String("features", "", "Subset of the features fed to a new TensorFlow model "+
+		"(built with build_model.py --board_features_dim), see ai.ParseFeatureSet: e.g. "+
+		"\"-MovesToDraw,-QueenOffset\" to disable features. It is saved with the model, and ignored for "+
+		"models already trained.")
+	flag_exportPureGo = flag.String("export_pure_go", "", "Exports the value head of the TensorFlow model "+
+		"of ai0 to the given file, to be used with the pure_go player parameter (no TensorFlow needed). "+
+		"With --train it is exported after training, otherwise it is exported and the program exits.")
 
 	flag_parallelism = flag.Int("parallelism", 0, "If > 0 ignore GOMAXPROCS and play "+
 		"these many matches simultaneously.")
 	flag_maxAutoBatch = flag.Int("max_auto_batch", 0, "If > 0 ignore at most do given value of "+
 		"auto-batch for tensorflow evaluations.")
+	flag_progressInterval = flag.Duration("progress_interval", time.Minute, "Interval between logs of "+
+		"the progress (done, rate and ETA) of playing matches, rescoring them and training. "+
+		"0 disables them.")
 
 	players = [2]*ai_players.SearcherScorerPlayer{nil, nil}
+
+	// openings loaded from --openings.
+	openings [][]Action
+
+	// firstPlayerSeed used with --random_first_player.
+	firstPlayerSeed int64
+
+	// curriculum parsed from --curriculum.
+	curriculum *ai_players.Curriculum
 )
 
 func init() {
 	flag.BoolVar(&tensorflow.CpuOnly, "cpu", false, "Force to use CPU, even if GPU is available")
+	flag.BoolVar(&tensorflow.Deterministic, "tf_deterministic", false,
+		"Use deterministic TensorFlow ops, for reproducible self-play. It is considerably slower.")
 }
 
 // Results and if the players were swapped.
@@ -70,16 +160,11 @@ type Match struct {
 	// Wether p0/p1 swapped positions in this match.
 	Swapped bool
 
-	// Match actions, alternating players.
-	Actions []Action
-
-	// Probability distributions over actions, to learn from.
-	// For AlphaBetaPruning these will be one-hot-encoding of the action taken. But
+	// Boards, actions (alternating players) and probability distributions over
+	// actions, to learn from.
+	// For AlphaBetaPruning the labels will be one-hot-encoding of the action taken. But
 	// for MCTS (alpha-zero algorithm) these may be different.
-	ActionsLabels [][]float32
-
-	// All board states of the game: 1 more than the number of actions.
-	Boards []*Board
+	ai.GameRecord
 
 	// Scores for each board position. Can either be calculated during
 	// the match, or re-genarated when re-loading a match.
@@ -89,10 +174,10 @@ type Match struct {
 	MatchFileIdx int
 }
 
-func (m *Match) FinalBoard() *Board { return m.Boards[len(m.Boards)-1] }
-
 func (m *Match) Encode(enc *gob.Encoder) {
-	if err := SaveMatch(enc, m.Boards[0].MaxMoves, m.Actions, m.Scores); err != nil {
+	info := MatchInfo{Seed: m.Seed, Capped: m.Capped, Resigned: m.Resigned, Adjudicated: m.Adjudicated,
+		NoQueenFirstMove: m.Boards[0].NoQueenFirstMove}
+	if err := SaveMatchWithInfo(enc, m.Boards[0].MaxMoves, m.Actions, m.Scores, nil, info); err != nil {
 		log.Panicf("Failed to encode match: %v", err)
 	}
 }
@@ -105,25 +190,55 @@ func (m *Match) AppendLabeledExamples(boardExamples []*Board, boardLabels []floa
 		from = len(m.Actions) - *flag_lastActions
 	}
 	glog.V(2).Infof("Making LabeledExample, version=%d", players[0].Scorer.Version())
+	labels := m.labels()
 	for ii := from; ii < len(m.Actions); ii++ {
 		boardExamples = append(boardExamples, m.Boards[ii])
-		boardLabels = append(boardLabels, m.Scores[ii])
+		boardLabels = append(boardLabels, labels[ii])
 		actionsLabels = append(actionsLabels, m.ActionsLabels[ii])
 	}
 	return boardExamples, boardLabels, actionsLabels
 }
 
+// labels returns the labels of the boards of the match: its scores, or the
+// TD(lambda) targets if --td_lambda is set.
+func (m *Match) labels() []float32 {
+	if *flag_tdLambda >= 0 {
+		return ai.TDLambdaLabels(m.GameRecord, players[0].Scorer, float32(*flag_tdLambda))
+	}
+	return m.Scores
+}
+
+// WriteExamples writes the labeled examples of the match, the same ones as
+// AppendLabeledExamples, along with the outcome of the match for each of them.
+func (m *Match) WriteExamples(writer *ai.ExampleWriter) {
+	examples := ai.GameLabeledExamples(m.GameRecord, m.labels(), writer.FeaturesVersion)
+	if *flag_lastActions > 0 && *flag_lastActions < len(examples) {
+		examples = examples[len(examples)-*flag_lastActions:]
+	}
+	for ii := range examples {
+		if err := writer.Write(&examples[ii]); err != nil {
+			log.Panicf("Failed to write examples of match: %v", err)
+		}
+	}
+}
+
 func MatchDecode(dec *gob.Decoder, matchFileIdx int) (match *Match, err error) {
 	glog.V(2).Infof("Loading match ...")
 	match = &Match{MatchFileIdx: matchFileIdx}
 	initial := &Board{}
-	initial, match.Actions, match.Scores, err = LoadMatch(dec)
+	var info *MatchInfo
+	initial, match.Actions, match.Scores, _, info, err = LoadMatchWithInfo(dec)
 	match.ActionsLabels = make([][]float32, 0, len(match.Actions))
 	if err != nil {
 		return
 	}
 	glog.V(2).Infof("Loaded match with %d actions", len(match.Actions))
-	initial.BuildDerived()
+	if info == nil {
+		// Matches saved without MatchInfo must be loaded with the same
+		// --no_queen_first_move they were played.
+		initial.NoQueenFirstMove = *flag_noQueenFirstMove
+		initial.BuildDerived()
+	}
 	match.Boards = make([]*Board, 1, len(match.Actions)+1)
 	match.Boards[0] = initial
 	board := initial
@@ -143,72 +258,129 @@ func MatchDecode(dec *gob.Decoder, matchFileIdx int) (match *Match, err error) {
 		board = board.Act(action)
 		match.Boards = append(match.Boards, board)
 	}
+	if info != nil {
+		match.Seed = info.Seed
+		match.Capped, match.Resigned, match.Adjudicated = info.Capped, info.Resigned, info.Adjudicated
+		return
+	}
+
+	// Matches saved without MatchInfo: self-play only stops at an unfinished board
+	// if it was capped, adjudicated or resigned. They are told apart by replaying
+	// the cap and adjudication, so they must be loaded with the same
+	// --self_play_max_moves and --adjudicate_* flags they were played.
+	match.Capped = ai.SelfPlayCapReached(board, *flag_selfPlayMaxMoves)
+	if !match.Capped && !board.IsFinished() {
+		match.Adjudicated = adjudicate.Adjudicated(&match.GameRecord, match.Scores)
+		match.Resigned = !match.Adjudicated
+	}
 	return
 }
 
 var (
 	stepUI   = ascii_ui.NewUI(true, false)
 	muStepUI sync.Mutex
+
+	// resign is shared by all matches played, see --resign_moves.
+	resign ai_players.Resign
+
+	// adjudicate is shared by all matches played or loaded, see --adjudicate_moves.
+	adjudicate ai_players.Adjudicate
 )
 
-func runMatch(matchNum int) *Match {
-	swapped := (matchNum%2 == 1)
+// newInitialBoard returns the empty board, configured with the flags.
+func newInitialBoard() *Board {
 	board := NewBoard()
 	board.MaxMoves = *flag_maxMoves
-	match := &Match{Swapped: swapped, Boards: []*Board{board}}
+	if *flag_noQueenFirstMove {
+		board.NoQueenFirstMove = true
+		board.BuildDerived()
+	}
+	return board
+}
+
+// loadOpenings loads and checks the openings in --openings.
+func loadOpenings() {
+	file, err := os.Open(*flag_openings)
+	if err != nil {
+		log.Fatalf("Failed to open openings file %q: %v", *flag_openings, err)
+	}
+	defer file.Close()
+	openings, err = ai_players.LoadOpenings(file)
+	if err != nil {
+		log.Fatalf("Failed to load openings from %q: %v", *flag_openings, err)
+	}
+	if len(openings) == 0 {
+		log.Fatalf("No openings found in %q", *flag_openings)
+	}
+	for ii, opening := range openings {
+		if _, err := ai_players.PlayOpening(newInitialBoard(), opening); err != nil {
+			log.Fatalf("Invalid opening #%d in %q: %v", ii, *flag_openings, err)
+		}
+	}
+	glog.V(1).Infof("Loaded %d openings from %q", len(openings), *flag_openings)
+}
+
+func runMatch(matchNum int) *Match {
+	swapped := (matchNum%2 == 1)
+	if *flag_randomFirstPlayer {
+		swapped = ai_players.RandomFirstPlayer(firstPlayerSeed, matchNum)
+	}
+	board := newInitialBoard()
+	if seed := gameSeed(matchNum); seed != 0 {
+		glog.V(1).Infof("Match %d: game seed %d", matchNum, seed)
+		board = board.WithSeed(seed)
+	}
+	match := &Match{Swapped: swapped}
 	reorderedPlayers := players
 	if swapped {
 		reorderedPlayers[0], reorderedPlayers[1] = players[1], players[0]
 	}
-
-	// Run match.
-	lastWasSkip := false
-	for !board.IsFinished() {
-		player := board.NextPlayer
-		if swapped {
-			player = 1 - player
-		}
-		glog.V(1).Infof("\n\nMatch %d: player %d at turn %d (#actions=%d)\n\n",
-			matchNum, player, board.MoveNumber, len(board.Derived.Actions))
-		var action Action
-		score := float32(0)
-		var actionLabels []float32
-		if len(board.Derived.Actions) == 0 {
-			// Auto-play skip move.
-			action = SKIP_ACTION
-			board = board.Act(action)
-			lastWasSkip = true
-			if len(board.Derived.Actions) == 0 {
-				log.Panicf("No moves to either side!?\n\n%v\n", board)
-			}
-		} else {
-			action, board, score, actionLabels = reorderedPlayers[board.NextPlayer].Play(board)
-			if lastWasSkip {
-				// Use inverse of this score for previous "NOOP" move.
-				match.Scores[len(match.Scores)-1] = -score
-				lastWasSkip = false
-			}
+	if curriculum != nil {
+		progress := curriculumProgress(matchNum)
+		for ii := range reorderedPlayers {
+			reorderedPlayers[ii] = curriculum.Player(reorderedPlayers[ii], progress)
 		}
-		match.Actions = append(match.Actions, action)
-		match.Boards = append(match.Boards, board)
-		match.Scores = append(match.Scores, score)
-		match.ActionsLabels = append(match.ActionsLabels, actionLabels)
+	}
 
-		if *flag_printSteps {
+	// Run match.
+	var onAction func(action Action, board *Board, score float32) bool
+	if *flag_printSteps {
+		onAction = func(action Action, board *Board, _ float32) bool {
 			muStepUI.Lock()
 			fmt.Printf("Match %d action take: %s\n", match.MatchFileIdx, action)
 			stepUI.PrintBoard(board)
 			fmt.Println("")
 			muStepUI.Unlock()
+			return true
+		}
+	}
+	matchPlayers := [NUM_PLAYERS]ai_players.Player{reorderedPlayers[0], reorderedPlayers[1]}
+	if len(openings) > 0 {
+		// Both matches of a pair start from the same opening.
+		opening := openings[(matchNum/2)%len(openings)]
+		var err error
+		match.GameRecord, match.Scores, err = ai_players.SelfPlayFromOpening(board, opening,
+			matchPlayers, *flag_selfPlayMaxMoves, &resign, &adjudicate, onAction)
+		if err != nil {
+			log.Panicf("Match %d: %v", matchNum, err)
+		}
+	} else {
+		match.GameRecord, match.Scores = ai_players.SelfPlay(board, matchPlayers,
+			*flag_selfPlayMaxMoves, &resign, &adjudicate, onAction)
+	}
+
+	for _, player := range reorderedPlayers {
+		if recorder, ok := player.Scorer.(*ai.CalibrationRecorder); ok {
+			recorder.GameFinished(&match.GameRecord)
 		}
 	}
 
 	if glog.V(1) {
 		var msg string
-		if match.FinalBoard().Draw() {
+		if match.Draw() {
 			msg = "match was a draw!"
 		} else {
-			player := match.FinalBoard().Winner()
+			player := match.Winner()
 			if swapped {
 				player = 1 - player
 			}
@@ -221,13 +393,38 @@ func runMatch(matchNum int) *Match {
 	return match
 }
 
+// gameSeed returns the seed of the random number generator of the given match, or
+// 0 if it uses the global one. See --self_play_seed and --game_seed.
+func gameSeed(matchNum int) int64 {
+	if *flag_gameSeed != 0 {
+		return *flag_gameSeed
+	}
+	if *flag_selfPlaySeed != 0 {
+		return ai_players.GameSeed(*flag_selfPlaySeed, matchNum)
+	}
+	return 0
+}
+
+// curriculumProgress returns the progress used to select the stage of --curriculum
+// for the given match.
+func curriculumProgress(matchNum int) int {
+	if *flag_curriculumByStep {
+		tfScorer, ok := players[0].Learner.(*tensorflow.Scorer)
+		if !ok {
+			log.Fatalf("--curriculum_by_step requires a TensorFlow model for ai0, got %s", players[0].Learner)
+		}
+		return tfScorer.GlobalStep()
+	}
+	return matchNum
+}
+
 func setAutoBatchSizes(batchSize int) {
 	glog.V(1).Infof("setAutoBatchSize(%d), max=%d", batchSize, *flag_maxAutoBatch)
 	if *flag_maxAutoBatch > 0 && batchSize > *flag_maxAutoBatch {
 		batchSize = *flag_maxAutoBatch
 	}
 	for _, player := range players {
-		if tfscorer, ok := player.Scorer.(*tensorflow.Scorer); ok {
+		if tfscorer, ok := player.Learner.(*tensorflow.Scorer); ok {
 			tfscorer.SetBatchSize(batchSize)
 		}
 	}
@@ -252,16 +449,26 @@ func runMatches(results chan<- *Match) {
 	setAutoBatchSizes(parallelism / 4)
 	glog.V(1).Infof("Parallelism for running matches=%d", parallelism)
 	semaphore := make(chan bool, parallelism)
+	resign.Moves = *flag_resignMoves
+	resign.Threshold = float32(*flag_resignThreshold)
+	resign.CheckFraction = *flag_resignCheckFraction
 	done := false
 	wins := 0
 	matchCount := 0
+	progressTotal := numMatchesToPlay
+	if *flag_wins {
+		// Number of matches unknown.
+		progressTotal = 0
+	}
+	progress := newProgressTracker("Playing matches", progressTotal)
 	for ; !done; matchCount++ {
 		wg.Add(1)
 		semaphore <- true
 		go func(matchNum int) {
 			defer wg.Done()
 			match := runMatch(matchNum)
-			if !match.FinalBoard().Draw() {
+			progress.Add(1)
+			if !match.Draw() {
 				wins++
 				if *flag_wins {
 					done = done || (wins >= numMatchesToPlay)
@@ -273,7 +480,7 @@ func runMatches(results chan<- *Match) {
 				}
 			}
 			<-semaphore
-			if *flag_winsOnly && match.FinalBoard().Draw() {
+			if *flag_winsOnly && match.Draw() {
 				return
 			}
 			results <- match
@@ -294,9 +501,48 @@ func runMatches(results chan<- *Match) {
 
 	wg.Wait()
 	glog.V(1).Infof("Played %d matches, with %d wins", matchCount, wins)
+	if rate, numChecked := resign.FalseResignationRate(); numChecked > 0 {
+		glog.Infof("False resignation rate: %.1f%% of %d matches played to the end", 100*rate, numChecked)
+	}
+	if rate, numChecked := adjudicate.FalseDrawRate(); numChecked > 0 {
+		glog.Infof("False draw adjudication rate: %.1f%% of %d matches played to the end", 100*rate, numChecked)
+	}
+	logCalibration()
 	close(results)
 }
 
+// logCalibration logs the histogram of scores and outcomes, and the fitted value
+// scale, of the players configured with "calibrate".
+func logCalibration() {
+	for ii, player := range players {
+		recorder, ok := player.Scorer.(*ai.CalibrationRecorder)
+		if !ok {
+			continue
+		}
+		if glog.V(1) {
+			for _, bin := range recorder.Histogram() {
+				glog.V(1).Infof("Player %d calibration: score=%.1f, count=%d, win rate=%.3f",
+					ii, bin.Score, bin.Count, bin.WinRate)
+			}
+		}
+		if scale, err := recorder.Calibrate(); err != nil {
+			glog.Errorf("Player %d calibration: %v", ii, err)
+		} else {
+			glog.Infof("Player %d calibration: value scale=%.4f (see --value_scale)", ii, scale)
+		}
+	}
+}
+
+// newProgressTracker returns a tracker of the progress of the named job, logged
+// every --progress_interval.
+func newProgressTracker(name string, total int) *ai.ProgressTracker {
+	var fn ai.ProgressFn
+	if *flag_progressInterval > 0 {
+		fn = ai.LogProgress(name, *flag_progressInterval)
+	}
+	return ai.NewProgressTracker(total, 1, fn)
+}
+
 func backupName(filename string) string {
 	return filename + "~"
 }
@@ -365,18 +611,18 @@ LoopFilenames:
 				} else {
 					glog.V(1).Infof("Found match %d\n", *flag_loadOnlyMatch)
 					matchesCount++
-					if !match.FinalBoard().Draw() {
+					if !match.Draw() {
 						numWins++
 					}
 					results <- match
 					break LoopFilenames
 				}
 			}
-			if *flag_winsOnly && match.FinalBoard().Draw() {
+			if *flag_winsOnly && match.Draw() {
 				continue
 			}
 			matchesCount++
-			if !match.FinalBoard().Draw() {
+			if !match.Draw() {
 				numWins++
 			}
 			results <- match
@@ -405,9 +651,47 @@ func main() {
 	if *flag_maxMoves <= 0 {
 		log.Fatalf("Invalid --max_moves=%d", *flag_maxMoves)
 	}
+	if *flag_openings != "" {
+		if *flag_loadMatches != "" {
+			log.Fatal("Flag --openings can't be used with --load_matches.")
+		}
+		loadOpenings()
+	}
+	if *flag_randomFirstPlayer {
+		if *flag_openings != "" {
+			log.Fatal("Flag --random_first_player can't be used with --openings, which plays each " +
+				"opening with both players moving first.")
+		}
+		firstPlayerSeed = *flag_firstPlayerSeed
+		if firstPlayerSeed == 0 {
+			firstPlayerSeed = time.Now().UnixNano()
+		}
+		glog.Infof("Random first player with --first_player_seed=%d", firstPlayerSeed)
+	}
+	adjudicate.Moves = *flag_adjudicateMoves
+	adjudicate.Threshold = float32(*flag_adjudicateThreshold)
+	adjudicate.Repetitions = *flag_adjudicateRepetitions
+	adjudicate.CheckFraction = *flag_adjudicateCheckFraction
 	for ii := 0; ii < 2; ii++ {
 		players[ii] = ai_players.NewAIPlayer(*flag_players[ii], *flag_numMatches == 1)
 	}
+	if *flag_curriculum != "" {
+		var err error
+		curriculum, err = ai_players.ParseCurriculum(*flag_curriculum)
+		if err != nil {
+			log.Fatalf("Invalid --curriculum: %v", err)
+		}
+	}
+	if *flag_features != "" {
+		setFeatures()
+	}
+	if *flag_prioritizedReplay && *flag_train {
+		checkPrioritizedReplay()
+	}
+	if *flag_exportPureGo != "" && !*flag_train {
+		exportPureGo()
+		return
+	}
 
 	// Run/load matches.
 	results := make(chan *Match)
@@ -435,6 +719,16 @@ func reportMatches(matches chan *Match) {
 		file = openWriterAndBackup(*flag_saveMatches)
 		enc = gob.NewEncoder(file)
 	}
+	var examplesWriter *ai.ExampleWriter
+	var examplesFile io.WriteCloser
+	if *flag_saveExamples != "" {
+		examplesFile = openWriterAndBackup(*flag_saveExamples)
+		var err error
+		examplesWriter, err = ai.NewExampleWriter(examplesFile, players[0].Scorer.Version())
+		if err != nil {
+			log.Panicf("Failed to save examples to %q: %v", *flag_saveExamples, err)
+		}
+	}
 
 	count := 0
 	var (
@@ -448,6 +742,9 @@ func reportMatches(matches chan *Match) {
 		if enc != nil {
 			match.Encode(enc)
 		}
+		if examplesWriter != nil {
+			match.WriteExamples(examplesWriter)
+		}
 		if *flag_train {
 			boardExamples, boardLabels, actionsLabels = match.AppendLabeledExamples(
 				boardExamples, boardLabels, actionsLabels)
@@ -468,7 +765,7 @@ func reportMatches(matches chan *Match) {
 			fmt.Println()
 			fmt.Println()
 		}
-		if board.Draw() {
+		if match.Draw() {
 			totalWins[2]++
 		} else if wins[0] {
 			totalWins[0]++
@@ -483,6 +780,13 @@ func reportMatches(matches chan *Match) {
 		file.Close()
 		renameToFinal(*flag_saveMatches)
 	}
+	if examplesWriter != nil {
+		if err := examplesWriter.Flush(); err != nil {
+			log.Panicf("Failed to save examples to %q: %v", *flag_saveExamples, err)
+		}
+		examplesFile.Close()
+		renameToFinal(*flag_saveExamples)
+	}
 
 	// Train with examples.
 	if *flag_train {
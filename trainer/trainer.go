@@ -3,11 +3,16 @@ package main
 import (
 	"github.com/janpfeifer/hiveGo/state"
 	"log"
+	"math"
+	"math/rand"
 	"runtime"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/janpfeifer/hiveGo/ai"
+	"github.com/janpfeifer/hiveGo/ai/tensorflow"
 )
 
 // Rescore the matches according to player 0 -- during rescoring we are only trying to
@@ -21,12 +26,14 @@ func rescore(matches []*Match) {
 	setAutoBatchSizes(parallelism / 4)
 	glog.V(1).Infof("Rescoring: parallelization=%d", parallelism)
 	semaphore := make(chan bool, parallelism)
+	progress := newProgressTracker("Rescoring matches", len(matches))
 	for matchNum, match := range matches {
 		wg.Add(1)
 		semaphore <- true
 		go func(matchNum int, match *Match) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
+			defer progress.Add(1)
 
 			from := 0
 			if *flag_lastActions > 0 && *flag_lastActions < len(match.Actions) {
@@ -68,14 +75,61 @@ func trainFromExamples(boards []*state.Board, boardLabels []float32, actionsLabe
 		return players[0].Learner.Learn(boards, boardLabels, actionsLabels, learningRate, steps)
 	}
 	log.Printf("Number of labeled examples: %d", len(boards))
+	if *flag_normalizeFeatures {
+		fitFeatureStats(boards)
+	}
+	var monitor *ai.CollapseMonitor
+	if *flag_collapseBoards > 0 {
+		monitor = ai.NewCollapseMonitor(boards, *flag_collapseBoards, float32(*flag_collapseMinStdDev))
+	}
 	loss := learn(0)
 	log.Printf("  Loss before train loop: %.2f", loss)
-	if *flag_trainLoops > 0 {
-		loss = learn(*flag_trainLoops)
-		log.Printf("  Loss after %dth train loop: %.2f", *flag_trainLoops, loss)
+	if *flag_prioritizedReplay {
+		trainWithPrioritizedReplay(boards, boardLabels, actionsLabels, monitor)
+	} else if *flag_trainLoops > 0 {
+		// Train in chunks to check for a collapse of the model in between.
+		chunkSteps := *flag_trainLoops
+		if monitor != nil && *flag_collapseCheckSteps > 0 {
+			chunkSteps = *flag_collapseCheckSteps
+		}
+		tfScorer, _ := players[0].Learner.(*tensorflow.Scorer)
+		var lb tensorflow.LossBreakdown
+		progress := newProgressTracker("Training", *flag_trainLoops)
+		if tfScorer != nil && *flag_progressInterval > 0 {
+			// Report the progress from within the train loop of the model.
+			tfScorer.OnLearnStep = func() { progress.Add(1) }
+		}
+		for done := 0; done < *flag_trainLoops; {
+			steps := chunkSteps
+			if steps > *flag_trainLoops-done {
+				steps = *flag_trainLoops - done
+			}
+			if tfScorer != nil {
+				// Also report the gradient and weight norms, to help diagnose diverging training.
+				lb = tfScorer.LearnWithBreakdown(boards, boardLabels, actionsLabels, learningRate, steps)
+			} else {
+				lb.Total = learn(steps)
+				progress.Add(steps)
+			}
+			done += steps
+			if monitor != nil {
+				checkCollapse(monitor, done)
+			}
+		}
+		if tfScorer != nil {
+			tfScorer.OnLearnStep = nil
+		}
+		if tfScorer != nil {
+			log.Printf("  After %dth train loop: %s", *flag_trainLoops, lb)
+		} else {
+			log.Printf("  Loss after %dth train loop: %.2f", *flag_trainLoops, lb.Total)
+		}
 		loss = learn(0)
 		log.Printf("  Loss after train loop: %.2f", loss)
 	}
+	if *flag_dumpVariables {
+		logVariablesStats()
+	}
 	if players[0].ModelFile != "" {
 		log.Printf("Saving to %s", players[0].ModelFile)
 		ai.LinearModelFileName = players[0].ModelFile // Hack for linear models. TODO: fix.
@@ -84,6 +138,174 @@ func trainFromExamples(boards []*state.Board, boardLabels []float32, actionsLabe
 			glog.V(1).Infof("%s", players[0].Learner)
 		}
 	}
+	if *flag_exportPureGo != "" {
+		exportPureGo()
+	}
+}
+
+// checkCollapse checks whether player[0]'s model collapsed after the given number
+// of training steps, and warns or aborts (--collapse_abort) if it did.
+func checkCollapse(monitor *ai.CollapseMonitor, steps int) {
+	stddev, collapsed := monitor.Check(players[0].Learner)
+	glog.V(1).Infof("  Standard deviation of the scores of --collapse_boards after %d steps: %.4g", steps, stddev)
+	if !collapsed {
+		return
+	}
+	if *flag_collapseAbort {
+		log.Fatalf("Model collapsed after %d steps: standard deviation of the scores of %d boards is %.4g, "+
+			"below --collapse_min_stddev=%g", steps, len(monitor.Boards), stddev, *flag_collapseMinStdDev)
+	}
+	glog.Warningf("Model collapsed after %d steps: standard deviation of the scores of %d boards is %.4g, "+
+		"below --collapse_min_stddev=%g", steps, len(monitor.Boards), stddev, *flag_collapseMinStdDev)
+}
+
+// fitFeatureStats fits the normalization of the features of player[0]'s new
+// TensorFlow model to the given boards. Models already trained, or already
+// normalized, are not changed.
+func fitFeatureStats(boards []*state.Board) {
+	tfScorer, ok := players[0].Learner.(*tensorflow.Scorer)
+	if !ok {
+		log.Fatalf("--normalize_features only works for TensorFlow models")
+	}
+	if tfScorer.FeatureStats != nil {
+		return
+	}
+	if tfScorer.GlobalStep() > 0 {
+		log.Printf("Model already trained without normalized features, --normalize_features ignored")
+		return
+	}
+	features := make([][]float32, len(boards))
+	for ii, board := range boards {
+		features[ii] = tfScorer.FeatureVector(board)
+	}
+	tfScorer.FeatureStats = ai.FitFeatureStats(features)
+	log.Printf("Features normalization fitted to %d boards", len(boards))
+}
+
+// setFeatures sets --features as the subset of the features of player[0]'s
+// TensorFlow model, if it's a new one.
+func setFeatures() {
+	fs, err := ai.ParseFeatureSet(*flag_features)
+	if err != nil {
+		log.Fatalf("Invalid --features: %v", err)
+	}
+	tfScorer, ok := players[0].Learner.(*tensorflow.Scorer)
+	if !ok {
+		log.Fatalf("--features only works for TensorFlow models")
+	}
+	if tfScorer.GlobalStep() > 0 {
+		log.Printf("Model already trained with features %s, --features ignored", tfScorer.Features())
+		return
+	}
+	if err = tfScorer.SetFeatures(fs, ai.AllFeaturesDim); err != nil {
+		log.Fatalf("Failed to use --features: %v", err)
+	}
+	log.Printf("Model uses %d features: %s", fs.Dim(ai.AllFeaturesDim), fs)
+}
+
+// exportPureGo exports player[0]'s TensorFlow model to --export_pure_go.
+func exportPureGo() {
+	tfScorer, ok := players[0].Learner.(*tensorflow.Scorer)
+	if !ok {
+		log.Fatalf("--export_pure_go only works for TensorFlow models")
+	}
+	pure, err := tfScorer.ExportPureGo()
+	if err != nil {
+		log.Fatalf("Failed to export model: %v", err)
+	}
+	if err = pure.SaveFile(*flag_exportPureGo); err != nil {
+		log.Fatalf("Failed to save exported model: %v", err)
+	}
+	log.Printf("Exported %s to %s", pure, *flag_exportPureGo)
+}
+
+// logVariablesStats logs the size, norm, range and fraction of zeros of each of
+// the variables of player[0]'s TensorFlow model, to help diagnose dead weights or
+// exploding layers.
+func logVariablesStats() {
+	tfScorer, ok := players[0].Learner.(*tensorflow.Scorer)
+	if !ok {
+		log.Printf("--dump_variables only works for TensorFlow models")
+		return
+	}
+	variables, err := tfScorer.DumpVariables()
+	if err != nil {
+		log.Printf("Failed to dump variables: %v", err)
+		return
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := variables[name]
+		if len(values) == 0 {
+			continue
+		}
+		var sumSquares float64
+		min, max := values[0], values[0]
+		numZeros := 0
+		for _, value := range values {
+			sumSquares += float64(value) * float64(value)
+			if value < min {
+				min = value
+			}
+			if value > max {
+				max = value
+			}
+			if value == 0 {
+				numZeros++
+			}
+		}
+		log.Printf("  %s: size=%d, norm=%.4g, min=%.4g, max=%.4g, zeros=%.1f%%", name, len(values),
+			math.Sqrt(sumSquares), min, max, 100*float64(numZeros)/float64(len(values)))
+	}
+}
+
+// checkPrioritizedReplay checks that player[0]'s learner supports --prioritized_replay,
+// so it fails before playing any matches.
+func checkPrioritizedReplay() {
+	learner, ok := players[0].Learner.(ai.ExamplesLossesLearner)
+	if !ok {
+		log.Fatalf("Learner %s doesn't support --prioritized_replay: it requires the losses of each example",
+			players[0].Learner)
+	}
+	if tfScorer, ok := learner.(*tensorflow.Scorer); ok && !tfScorer.HasExamplesLosses() {
+		log.Fatalf("Model %s doesn't support --prioritized_replay: its graph doesn't export the losses "+
+			"of each board, rebuild it with build_model.py", tfScorer.Basename)
+	}
+}
+
+// trainWithPrioritizedReplay trains player[0] on batches sampled from a ReplayBuffer,
+// for the equivalent of --train_loops passes over the examples. If monitor is not
+// nil, the model is checked for a collapse every --collapse_check_steps batches.
+func trainWithPrioritizedReplay(boards []*state.Board, boardLabels []float32, actionsLabels [][]float32,
+	monitor *ai.CollapseMonitor) {
+	checkPrioritizedReplay()
+	learner := players[0].Learner.(ai.ExamplesLossesLearner)
+	learningRate := float32(*flag_learningRate)
+	_, losses := learner.LearnWithExamplesLosses(boards, boardLabels, actionsLabels, nil, learningRate, 0)
+	rb := ai.NewReplayBuffer(*flag_replayAlpha, *flag_replayBeta)
+	for ii, board := range boards {
+		rb.Add(board, boardLabels[ii], actionsLabels[ii], losses[ii])
+	}
+	batchSize := *flag_replayBatchSize
+	if batchSize <= 0 || batchSize > rb.Len() {
+		batchSize = rb.Len()
+	}
+	numBatches := *flag_trainLoops * rb.Len() / batchSize
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var loss float32
+	progress := newProgressTracker("Training with prioritized replay", numBatches)
+	for ii := 0; ii < numBatches; ii++ {
+		loss = rb.Learn(learner, batchSize, learningRate, 1, rng)
+		progress.Add(1)
+		if monitor != nil && *flag_collapseCheckSteps > 0 && (ii+1)%*flag_collapseCheckSteps == 0 {
+			checkCollapse(monitor, ii+1)
+		}
+	}
+	log.Printf("  Loss of last prioritized replay batch (%d batches): %.2f", numBatches, loss)
 }
 
 func loopRescoreAndRetrainMatches(matchesChan chan *Match) {
@@ -235,6 +235,27 @@ func RemovePiece(action state.Action) {
 	pons.Rect.Remove()
 }
 
+// ReplaceBoardPieces removes all pieces on the board from the screen, and places
+// them again from the given board. Used when the board is translated, see
+// state.Board.Translation.
+func ReplaceBoardPieces(b *state.Board) {
+	for pos, stack := range piecesOnBoard {
+		for _, pons := range stack {
+			pons.Hex.Remove()
+			pons.Rect.Remove()
+		}
+		delete(piecesOnBoard, pos)
+	}
+	for _, pos := range b.OccupiedPositions() {
+		stack := b.StackAt(pos)
+		// Place from the bottom of the stack up.
+		for stackPos := int(stack.CountPieces()) - 1; stackPos >= 0; stackPos-- {
+			player, piece := stack.PieceAt(uint8(stackPos))
+			Place(player, state.Action{Piece: piece, TargetPos: pos})
+		}
+	}
+}
+
 var (
 	piecesOffBoard [state.NUM_PLAYERS]map[state.Piece][]*PieceOnScreen
 )
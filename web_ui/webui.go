@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"log"
 	"math"
 
 	"github.com/gopherjs/gopherjs/js"
@@ -408,6 +407,10 @@ func ExecuteAction(action state.Action) {
 	}
 
 	Board = Board.Act(action)
+	if Board.Translation != (state.Pos{}) {
+		// Hive was recentered: redraw it.
+		ReplaceBoardPieces(Board)
+	}
 	if Board.IsFinished() {
 		MarkNextPlayer()
 		var msg string
@@ -424,13 +427,8 @@ func ExecuteAction(action state.Action) {
 	}
 
 	if len(Board.Derived.Actions) == 0 {
-		// Auto-execute skip action.
-		if action.Piece == state.NO_PIECE {
-			// Two skip actions in a row.
-			log.Fatal("No moves avaialble to either players !?")
-			return
-		}
-		// Recurse to a skip action.
+		// Auto-execute skip action. If the opponent can't move either, the
+		// board after the skip is finished, in a draw.
 		ExecuteAction(state.Action{Piece: state.NO_PIECE})
 		return
 	}